@@ -0,0 +1,151 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mp3repair/internal/files"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+const auditLogFile = "audit.jsonl"
+
+// auditLock serializes appends to the audit log, as tracks may be rewritten
+// concurrently
+var auditLock sync.Mutex
+
+// auditEntry records a single change to a single field of a track's metadata;
+// the audit log holds one entry per line, and entries are only ever appended
+type auditEntry struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user,omitempty"`
+	Path     string    `json:"path"`
+	Artist   string    `json:"artist"`
+	Album    string    `json:"album"`
+	Track    string    `json:"track"`
+	Source   string    `json:"source"`
+	Field    string    `json:"field"`
+	OldValue string    `json:"old"`
+	NewValue string    `json:"new"`
+}
+
+func auditLogPath() string {
+	return filepath.Join(applicationPath(), auditLogFile)
+}
+
+// auditUser identifies the user making a change; it is empty if the user
+// cannot be determined
+func auditUser() string {
+	if u, userErr := currentUser(); userErr == nil {
+		return u.Username
+	}
+	return ""
+}
+
+func newAuditEntries(t *files.Track, changes []files.MetadataChange, now time.Time, user string) []auditEntry {
+	entries := make([]auditEntry, 0, len(changes))
+	for _, change := range changes {
+		entries = append(entries, auditEntry{
+			Time:     now,
+			User:     user,
+			Path:     t.Path(),
+			Artist:   t.RecordingArtist(),
+			Album:    t.AlbumName(),
+			Track:    t.Name(),
+			Source:   change.Source,
+			Field:    change.Field.String(),
+			OldValue: change.OldValue,
+			NewValue: change.NewValue,
+		})
+	}
+	return entries
+}
+
+// recordMetadataChanges appends the changes that a command made to a track's
+// metadata to the audit log
+func recordMetadataChanges(o output.Bus, command string, t *files.Track,
+	changes []files.MetadataChange) *cmdtoolkit.ExitError {
+	if len(changes) == 0 {
+		return nil
+	}
+	var content bytes.Buffer
+	for _, entry := range newAuditEntries(t, changes, currentTime(), auditUser()) {
+		line, _ := json.Marshal(entry)
+		content.Write(line)
+		content.WriteByte('\n')
+	}
+	path := auditLogPath()
+	auditLock.Lock()
+	appendErr := appendToFile(path, content.Bytes())
+	auditLock.Unlock()
+	if appendErr != nil {
+		o.ErrorPrintf("The changes to track %q cannot be recorded in the audit log %q: %s.\n", t, path,
+			cmdtoolkit.ErrorToString(appendErr))
+		o.Log(output.Error, "cannot write audit log", map[string]any{
+			"command":  command,
+			"auditLog": path,
+			"track":    t.String(),
+			"error":    appendErr,
+		})
+		return cmdtoolkit.NewExitSystemError(command)
+	}
+	return nil
+}
+
+func appendToFile(path string, content []byte) (fileErr error) {
+	if dirErr := mkdirAll(filepath.Dir(path), 0o755); dirErr != nil {
+		return dirErr
+	}
+	var f *os.File
+	if f, fileErr = openFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, cmdtoolkit.StdFilePermissions); fileErr != nil {
+		return
+	}
+	defer func() {
+		fileErr = errors.Join(fileErr, f.Close())
+	}()
+	_, fileErr = f.Write(content)
+	return
+}
+
+// readAuditLog reads the audit log; a missing log is treated as an empty one.
+// Lines that cannot be parsed are reported by line number.
+func readAuditLog(path string) ([]auditEntry, error) {
+	content, readErr := readFile(path)
+	if readErr != nil {
+		if errors.Is(readErr, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, readErr
+	}
+	var entries []auditEntry
+	var problems []error
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry auditEntry
+		if jsonErr := json.Unmarshal([]byte(line), &entry); jsonErr != nil {
+			problems = append(problems, fmt.Errorf("line %d: %w", lineNumber, jsonErr))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, errors.Join(problems...)
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"mp3repair/internal/files"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/majohn-r/output"
+)
+
+func Test_recordMetadataChanges(t *testing.T) {
+	originalApplicationPath := applicationPath
+	originalCurrentTime := currentTime
+	originalCurrentUser := currentUser
+	originalMkdirAll := mkdirAll
+	defer func() {
+		applicationPath = originalApplicationPath
+		currentTime = originalCurrentTime
+		currentUser = originalCurrentUser
+		mkdirAll = originalMkdirAll
+	}()
+	now := time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC)
+	currentTime = func() time.Time { return now }
+	currentUser = func() (*user.User, error) { return &user.User{Username: "marc"}, nil }
+	track := generateAlbums(1, 1)[0].Tracks()[0]
+	changes := []files.MetadataChange{
+		{Source: "ID3V1", Field: files.YearField, OldValue: "2001", NewValue: "1999"},
+		{Source: "ID3V2", Field: files.YearField, OldValue: "2001", NewValue: "1999"},
+	}
+	tests := map[string]struct {
+		changes   []files.MetadataChange
+		existing  string
+		mkdirAll  func(string, fs.FileMode) error
+		wantErr   bool
+		wantLines int
+		output.WantedRecording
+	}{
+		"no changes": {},
+		"new log": {
+			changes:   changes,
+			mkdirAll:  os.MkdirAll,
+			wantLines: 2,
+		},
+		"existing log": {
+			changes:   changes,
+			existing:  "{}\n",
+			mkdirAll:  os.MkdirAll,
+			wantLines: 3,
+		},
+		"cannot create directory": {
+			changes:  changes,
+			mkdirAll: func(string, fs.FileMode) error { return errors.New("access denied") },
+			wantErr:  true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "appData")
+			applicationPath = func() string { return dir }
+			mkdirAll = tt.mkdirAll
+			path := filepath.Join(dir, auditLogFile)
+			if tt.existing != "" {
+				_ = os.MkdirAll(dir, 0o755)
+				_ = os.WriteFile(path, []byte(tt.existing), 0o644)
+			}
+			o := output.NewRecorder()
+			if got := recordMetadataChanges(o, rewriteCommandName, track, tt.changes); (got != nil) != tt.wantErr {
+				t.Errorf("recordMetadataChanges() = %v, wantErr %v", got, tt.wantErr)
+			}
+			if tt.wantErr {
+				tt.WantedRecording = output.WantedRecording{
+					Error: fmt.Sprintf("The changes to track %q cannot be recorded in the audit log %q: "+
+						"'access denied'.\n", track, path),
+					Log: "" +
+						"level='error'" +
+						" auditLog='" + path + "'" +
+						" command='rewrite'" +
+						" error='access denied'" +
+						" track='" + track.String() + "'" +
+						" msg='cannot write audit log'\n",
+				}
+			}
+			o.Report(t, "recordMetadataChanges()", tt.WantedRecording)
+			entries, _ := readAuditLog(path)
+			if len(entries) != tt.wantLines {
+				t.Errorf("recordMetadataChanges() wrote %d entries, want %d", len(entries), tt.wantLines)
+			}
+			if tt.wantLines != 0 {
+				want := auditEntry{
+					Time:     now,
+					User:     "marc",
+					Path:     track.Path(),
+					Artist:   "my artist 0",
+					Album:    "my album 00",
+					Track:    "my track 001",
+					Source:   "ID3V2",
+					Field:    "year",
+					OldValue: "2001",
+					NewValue: "1999",
+				}
+				if got := entries[len(entries)-1]; !reflect.DeepEqual(got, want) {
+					t.Errorf("recordMetadataChanges() last entry = %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func Test_auditUser(t *testing.T) {
+	originalCurrentUser := currentUser
+	defer func() {
+		currentUser = originalCurrentUser
+	}()
+	tests := map[string]struct {
+		currentUser func() (*user.User, error)
+		want        string
+	}{
+		"known":   {currentUser: func() (*user.User, error) { return &user.User{Username: "marc"}, nil }, want: "marc"},
+		"unknown": {currentUser: func() (*user.User, error) { return nil, errors.New("no user") }, want: ""},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			currentUser = tt.currentUser
+			if got := auditUser(); got != tt.want {
+				t.Errorf("auditUser() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_readAuditLog(t *testing.T) {
+	originalReadFile := readFile
+	defer func() {
+		readFile = originalReadFile
+	}()
+	tests := map[string]struct {
+		content  string
+		readErr  error
+		want     []auditEntry
+		wantErr  bool
+		errorMsg string
+	}{
+		"missing": {readErr: fs.ErrNotExist},
+		"unreadable": {
+			readErr:  errors.New("access denied"),
+			wantErr:  true,
+			errorMsg: "access denied",
+		},
+		"good and bad lines": {
+			content: "" +
+				"{\"artist\":\"a\",\"field\":\"year\"}\n" +
+				"\n" +
+				"not json\n" +
+				"{\"artist\":\"b\",\"field\":\"genre\"}\n",
+			want: []auditEntry{
+				{Artist: "a", Field: "year"},
+				{Artist: "b", Field: "genre"},
+			},
+			wantErr:  true,
+			errorMsg: "line 3: invalid character 'o' in literal null (expecting 'u')",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			readFile = func(string) ([]byte, error) {
+				return []byte(tt.content), tt.readErr
+			}
+			got, gotErr := readAuditLog("audit.jsonl")
+			if (gotErr != nil) != tt.wantErr {
+				t.Errorf("readAuditLog() error = %v, wantErr %v", gotErr, tt.wantErr)
+			}
+			if gotErr != nil && gotErr.Error() != tt.errorMsg {
+				t.Errorf("readAuditLog() error = %q, want %q", gotErr.Error(), tt.errorMsg)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readAuditLog() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
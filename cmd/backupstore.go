@@ -0,0 +1,403 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mp3repair/internal/files"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+const (
+	backupStoreDirectory = "backups"
+	backupManifestFile   = "manifest.jsonl"
+	backupStoreSuffix    = ".mp3"
+	backupPartialSuffix  = ".partial"
+	backupLockFile       = "lock"
+	backupLockRetry      = 100 * time.Millisecond
+)
+
+var (
+	// backupLockWait is how long to wait for another process to unlock the
+	// backup store
+	backupLockWait = 30 * time.Second
+	// backupLockStale is the age at which a lock file is deemed to have been
+	// left by a process that ended without unlocking the backup store
+	backupLockStale = 10 * time.Minute
+)
+
+// backupEntry records a single backup in the backup store's manifest; the
+// manifest holds one entry per line. Backups of identical files share the same
+// stored file, which is named for the hash of its content.
+type backupEntry struct {
+	Time   time.Time `json:"time"`
+	Path   string    `json:"path"`
+	Hash   string    `json:"hash"`
+	Size   int64     `json:"size"`
+	Reason string    `json:"reason"`
+}
+
+// backupStore is a central, content-addressed store of track backups, kept in
+// the application data directory; unlike an album's backup directory, it holds
+// every backup of a track, and never holds two copies of the same file
+type backupStore struct {
+	dir string
+	// serializes the use of the store within this process, as tracks may be
+	// backed up concurrently; the lock file serializes its use across
+	// processes
+	storeLock sync.Mutex
+}
+
+func newBackupStore() *backupStore {
+	return &backupStore{dir: filepath.Join(applicationPath(), backupStoreDirectory)}
+}
+
+func (s *backupStore) manifestPath() string {
+	return filepath.Join(s.dir, backupManifestFile)
+}
+
+func (s *backupStore) lockPath() string {
+	return filepath.Join(s.dir, backupLockFile)
+}
+
+// lock locks the store against its use by other goroutines and other
+// processes, such as a rewrite storing backups while a cleanup deletes them;
+// the returned function unlocks it
+func (s *backupStore) lock() (unlock func(), lockErr error) {
+	s.storeLock.Lock()
+	if lockErr = mkdirAll(s.dir, 0o755); lockErr == nil {
+		lockErr = createLockFile(s.lockPath())
+	}
+	if lockErr != nil {
+		s.storeLock.Unlock()
+		return nil, lockErr
+	}
+	return func() {
+		_ = remove(s.lockPath())
+		s.storeLock.Unlock()
+	}, nil
+}
+
+// createLockFile creates the lock file, waiting for another process holding it
+// to delete it; a lock file too old to belong to a running process is replaced
+func createLockFile(path string) error {
+	for waited := time.Duration(0); ; waited += backupLockRetry {
+		f, openErr := openFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, cmdtoolkit.StdFilePermissions)
+		if openErr == nil {
+			_, writeErr := fmt.Fprintf(f, "%d\n", getPid())
+			return errors.Join(writeErr, f.Close())
+		}
+		if !errors.Is(openErr, fs.ErrExist) {
+			return openErr
+		}
+		if modTime, timeErr := modificationTime(path); timeErr == nil && since(modTime) > backupLockStale {
+			_ = remove(path)
+			continue
+		}
+		if waited >= backupLockWait {
+			return fmt.Errorf("the backup store is locked by another process;"+
+				" if no other process is using it, delete %q", path)
+		}
+		time.Sleep(backupLockRetry)
+	}
+}
+
+// filePath returns the path of the stored file with the specified hash; the
+// files are spread across subdirectories named for the first two characters of
+// their hashes
+func (s *backupStore) filePath(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash+backupStoreSuffix)
+}
+
+// backupTrack stores the track file before it is rewritten, unless an
+// identical file is already stored, and records the backup in the manifest
+func (s *backupStore) backupTrack(o output.Bus, cT *concernedTrack) (backupFile string, backedUp bool) {
+	t := cT.backing
+	backupFile, strategy, storeErr := s.storeTrack(o, rewriteCommandName, t, cT.rewriteReason())
+	if storeErr != nil {
+		o.ErrorPrintf("The track file %q could not be backed up due to error %s.\n", t,
+			cmdtoolkit.ErrorToString(storeErr))
+		o.ErrorPrintf("The track file %q will not be rewritten.\n", t)
+		o.Log(output.Error, "cannot store backup", map[string]any{
+			"command":     rewriteCommandName,
+			"source":      t.Path(),
+			"backupStore": s.dir,
+			"error":       storeErr,
+		})
+		return "", false
+	}
+	o.ConsolePrintf("The track file %q has been backed up to %q%s.\n", t, backupFile, backupDescription(strategy))
+	return backupFile, true
+}
+
+// storeTrack stores the track file, unless an identical file is already
+// stored, and records the backup, made by the specified command for the
+// specified reason, in the manifest; it returns the path of the stored file and
+// the name of the backup strategy used. The store is locked throughout, so that
+// the stored file cannot be deleted before the backup is recorded.
+func (s *backupStore) storeTrack(
+	o output.Bus,
+	command string,
+	t *files.Track,
+	reason string,
+) (backupFile, strategy string, storeErr error) {
+	var hash string
+	var size int64
+	if hash, size, storeErr = hashFile(t.Path()); storeErr != nil {
+		return "", "", storeErr
+	}
+	unlock, lockErr := s.lock()
+	if lockErr != nil {
+		return "", "", lockErr
+	}
+	defer unlock()
+	backupFile = s.filePath(hash)
+	if strategy, storeErr = s.store(o, command, t.Path(), backupFile, hash); storeErr != nil {
+		return "", "", storeErr
+	}
+	storeErr = s.record(backupEntry{
+		Time:   currentTime(),
+		Path:   t.Path(),
+		Hash:   hash,
+		Size:   size,
+		Reason: reason,
+	})
+	if storeErr != nil {
+		return "", "", storeErr
+	}
+	return backupFile, strategy, nil
+}
+
+// store copies the source file into the store, unless it is already stored,
+// returning the name of the backup strategy used; the copy is renamed into
+// place only once it is complete, and its content has been verified to have
+// the hash for which it is named. A stored file is reused only if its content
+// still has that hash; otherwise, it is replaced.
+func (s *backupStore) store(o output.Bus, command, source, backupFile, hash string) (string, error) {
+	if plainFileExists(backupFile) {
+		storedHash, _, hashErr := hashFile(backupFile)
+		if hashErr == nil && storedHash == hash {
+			o.Log(output.Info, "backup already stored", map[string]any{
+				"command": command,
+				"file":    backupFile,
+				"source":  source,
+			})
+			return "", nil
+		}
+		if hashErr == nil {
+			hashErr = fmt.Errorf("the stored file does not match the hash for which it is named")
+		}
+		o.Log(output.Warning, "stored backup damaged", map[string]any{
+			"command": command,
+			"error":   hashErr,
+			"file":    backupFile,
+			"source":  source,
+		})
+	}
+	if dirErr := mkdirAll(filepath.Dir(backupFile), 0o755); dirErr != nil {
+		return "", dirErr
+	}
+	partial := backupFile + backupPartialSuffix
+	strategy, copyErr := makeBackup(o, command, source, partial)
+	if copyErr == nil {
+		// the source may have changed while it was being copied
+		if copyHash, _, hashErr := hashFile(partial); hashErr != nil {
+			copyErr = hashErr
+		} else if copyHash != hash {
+			copyErr = fmt.Errorf("the copy of %q does not match the file that was hashed", source)
+		}
+	}
+	if copyErr != nil {
+		_ = remove(partial)
+		return "", copyErr
+	}
+	return strategy, rename(partial, backupFile)
+}
+
+// record appends the entry to the manifest; the store must be locked
+func (s *backupStore) record(entry backupEntry) error {
+	line, _ := json.Marshal(entry)
+	return appendToFile(s.manifestPath(), append(line, '\n'))
+}
+
+// hashFile computes the SHA-256 hash of the file's content
+func hashFile(path string) (hash string, size int64, fileErr error) {
+	var f *os.File
+	if f, fileErr = openFile(path, os.O_RDONLY, 0); fileErr != nil {
+		return
+	}
+	defer func() {
+		fileErr = errors.Join(fileErr, f.Close())
+	}()
+	h := sha256.New()
+	if size, fileErr = io.Copy(h, f); fileErr == nil {
+		hash = hex.EncodeToString(h.Sum(nil))
+	}
+	return
+}
+
+// rewriteReason describes why the track is being rewritten, for the backup
+// store's manifest
+func (cT *concernedTrack) rewriteReason() string {
+	var reasons []string
+	for kind, list := range cT.concernsCollection {
+		if len(list) != 0 {
+			reasons = append(reasons, concernName(kind))
+		}
+	}
+	slices.Sort(reasons)
+	return rewriteCommandName + ": " + strings.Join(reasons, ", ")
+}
+
+// backupManifest is the content of the backup store's manifest
+type backupManifest struct {
+	entries []backupEntry
+	// the lines that cannot be parsed, which are kept as they are when the
+	// manifest is rewritten
+	badLines []string
+	// why each bad line cannot be parsed
+	problems []error
+}
+
+// readBackupManifest reads the backup store's manifest; a missing manifest is
+// treated as an empty one. Lines that cannot be parsed are skipped, and their
+// problems are reported by line number.
+func readBackupManifest(path string) (*backupManifest, error) {
+	manifest := &backupManifest{}
+	content, readErr := readFile(path)
+	if readErr != nil {
+		if errors.Is(readErr, fs.ErrNotExist) {
+			return manifest, nil
+		}
+		return nil, readErr
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry backupEntry
+		var problem error
+		if jsonErr := json.Unmarshal([]byte(line), &entry); jsonErr != nil {
+			problem = fmt.Errorf("line %d: %w", lineNumber, jsonErr)
+		} else if _, hexErr := hex.DecodeString(entry.Hash); hexErr != nil || len(entry.Hash) != 2*sha256.Size {
+			problem = fmt.Errorf("line %d: invalid hash %q", lineNumber, entry.Hash)
+		}
+		if problem != nil {
+			manifest.badLines = append(manifest.badLines, line)
+			manifest.problems = append(manifest.problems, problem)
+			continue
+		}
+		manifest.entries = append(manifest.entries, entry)
+	}
+	return manifest, nil
+}
+
+// writeBackupManifest replaces the manifest with the specified entries, after
+// the lines of the old manifest that could not be parsed; the new manifest is
+// written to a temporary file, which is then renamed into place
+func writeBackupManifest(path string, badLines []string, entries []backupEntry) error {
+	var content bytes.Buffer
+	for _, line := range badLines {
+		content.WriteString(line)
+		content.WriteByte('\n')
+	}
+	for _, entry := range entries {
+		line, _ := json.Marshal(entry)
+		content.Write(line)
+		content.WriteByte('\n')
+	}
+	partial := path + backupPartialSuffix
+	if writeErr := writeFile(partial, content.Bytes(), cmdtoolkit.StdFilePermissions); writeErr != nil {
+		return writeErr
+	}
+	return rename(partial, path)
+}
+
+// backupStoreUsage summarizes the contents of the backup store
+type backupStoreUsage struct {
+	backups int
+	tracks  int
+	files   int
+	// the size of the stored files
+	size int64
+	// the size that the backups would occupy if identical files were not
+	// shared
+	unsharedSize int64
+}
+
+func newBackupStoreUsage(entries []backupEntry) backupStoreUsage {
+	usage := backupStoreUsage{backups: len(entries)}
+	tracks := map[string]bool{}
+	hashes := map[string]bool{}
+	for _, entry := range entries {
+		tracks[entry.Path] = true
+		usage.unsharedSize += entry.Size
+		if !hashes[entry.Hash] {
+			hashes[entry.Hash] = true
+			usage.size += entry.Size
+		}
+	}
+	usage.tracks = len(tracks)
+	usage.files = len(hashes)
+	return usage
+}
+
+// backupRetention determines which backups in the backup store are kept
+type backupRetention struct {
+	// backups made within this many days are kept; 0 keeps none by age
+	days int
+	// each track's most recent backups, up to this many, are kept; 0 keeps
+	// none by count
+	latest int
+}
+
+// retain partitions the entries into those to keep and those to delete
+func (r backupRetention) retain(entries []backupEntry, now time.Time) (kept, deleted []backupEntry) {
+	byPath := map[string][]backupEntry{}
+	for _, entry := range entries {
+		byPath[entry.Path] = append(byPath[entry.Path], entry)
+	}
+	cutoff := now.AddDate(0, 0, -r.days)
+	for _, backups := range byPath {
+		// most recent first
+		slices.SortFunc(backups, func(a, b backupEntry) int {
+			return b.Time.Compare(a.Time)
+		})
+		for k, entry := range backups {
+			if k < r.latest || (r.days > 0 && entry.Time.After(cutoff)) {
+				kept = append(kept, entry)
+				continue
+			}
+			deleted = append(deleted, entry)
+		}
+	}
+	slices.SortFunc(kept, compareBackupEntries)
+	slices.SortFunc(deleted, compareBackupEntries)
+	return
+}
+
+func compareBackupEntries(a, b backupEntry) int {
+	return cmp.Or(a.Time.Compare(b.Time), strings.Compare(a.Path, b.Path), strings.Compare(a.Hash, b.Hash))
+}
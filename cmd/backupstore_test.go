@@ -0,0 +1,347 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/majohn-r/output"
+)
+
+func Test_backupStore_backupTrack(t *testing.T) {
+	useFullCopyBackups(t)
+	originalApplicationPath := applicationPath
+	originalCurrentTime := currentTime
+	defer func() {
+		applicationPath = originalApplicationPath
+		currentTime = originalCurrentTime
+	}()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	currentTime = func() time.Time { return now }
+	appData := t.TempDir()
+	applicationPath = func() string { return appData }
+	store := newBackupStore()
+	concernedArtists := createConcernedArtists(clutteredArtists(t))
+	tracks := concernedArtists[0].albums()[0].tracks()
+	// the first track is backed up twice, unchanged, and the second track is
+	// identical to it
+	for _, cT := range tracks {
+		cT.addConcern(conflictConcern, "the track contains the TENC frame")
+	}
+	tracks[0].addConcern(filesConcern, "the track name is wrong")
+	content, _ := os.ReadFile(tracks[0].backing.Path())
+	_ = os.WriteFile(tracks[1].backing.Path(), content, 0o644)
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	wantFile := filepath.Join(store.dir, hash[:2], hash+".mp3")
+	o := output.NewRecorder()
+	for _, cT := range []*concernedTrack{tracks[0], tracks[0], tracks[1]} {
+		backupFile, backedUp := store.backupTrack(o, cT)
+		if backupFile != wantFile || !backedUp {
+			t.Errorf("backupStore.backupTrack() = %q, %t, want %q, true", backupFile, backedUp, wantFile)
+		}
+	}
+	stored, _ := os.ReadFile(wantFile)
+	if string(stored) != string(content) {
+		t.Errorf("backupStore.backupTrack() stored %d bytes, want %d", len(stored), len(content))
+	}
+	if subdirectories, _ := os.ReadDir(store.dir); len(subdirectories) != 2 {
+		t.Errorf("backupStore.backupTrack() store holds %d entries, want manifest and 1 subdirectory",
+			len(subdirectories))
+	}
+	manifest, readErr := readBackupManifest(store.manifestPath())
+	size := int64(len(content))
+	want := []backupEntry{
+		{Time: now, Path: tracks[0].backing.Path(), Hash: hash, Size: size, Reason: "rewrite: files, metadata conflict"},
+		{Time: now, Path: tracks[0].backing.Path(), Hash: hash, Size: size, Reason: "rewrite: files, metadata conflict"},
+		{Time: now, Path: tracks[1].backing.Path(), Hash: hash, Size: size, Reason: "rewrite: metadata conflict"},
+	}
+	if readErr != nil || !reflect.DeepEqual(manifest.entries, want) {
+		t.Errorf("backupStore.backupTrack() manifest = %v, %v, want %v", manifest, readErr, want)
+	}
+	var console strings.Builder
+	for _, cT := range []*concernedTrack{tracks[0], tracks[0], tracks[1]} {
+		console.WriteString(fmt.Sprintf("The track file %q has been backed up to %q.\n", cT.backing, wantFile))
+	}
+	o.Report(t, "backupStore.backupTrack()", output.WantedRecording{
+		Console: console.String(),
+		Log: "" +
+			"level='info'" +
+			" command='rewrite'" +
+			fmt.Sprintf(" file='%s'", wantFile) +
+			fmt.Sprintf(" source='%s'", tracks[0].backing.Path()) +
+			" msg='backup already stored'\n" +
+			"level='info'" +
+			" command='rewrite'" +
+			fmt.Sprintf(" file='%s'", wantFile) +
+			fmt.Sprintf(" source='%s'", tracks[1].backing.Path()) +
+			" msg='backup already stored'\n",
+	})
+}
+
+func Test_backupStore_backupTrack_failure(t *testing.T) {
+	useFullCopyBackups(t)
+	originalCopyFile := copyFile
+	defer func() {
+		copyFile = originalCopyFile
+	}()
+	copyFile = func(_, _ string) error { return fmt.Errorf("disk full") }
+	store := &backupStore{dir: t.TempDir()}
+	cT := createConcernedArtists(clutteredArtists(t))[0].albums()[0].tracks()[0]
+	o := output.NewRecorder()
+	if backupFile, backedUp := store.backupTrack(o, cT); backupFile != "" || backedUp {
+		t.Errorf("backupStore.backupTrack() = %q, %t, want \"\", false", backupFile, backedUp)
+	}
+	if _, statErr := os.Stat(store.manifestPath()); statErr == nil {
+		t.Errorf("backupStore.backupTrack() recorded a backup that failed")
+	}
+	o.Report(t, "backupStore.backupTrack()", output.WantedRecording{
+		Error: fmt.Sprintf("The track file %q could not be backed up due to error 'disk full'.\n", cT.backing) +
+			fmt.Sprintf("The track file %q will not be rewritten.\n", cT.backing),
+		Log: "level='error'" +
+			fmt.Sprintf(" backupStore='%s'", store.dir) +
+			" command='rewrite'" +
+			" error='disk full'" +
+			fmt.Sprintf(" source='%s'", cT.backing.Path()) +
+			" msg='cannot store backup'\n",
+	})
+}
+
+func Test_backupStore_backupTrack_changedCopy(t *testing.T) {
+	useFullCopyBackups(t)
+	originalCopyFile := copyFile
+	defer func() {
+		copyFile = originalCopyFile
+	}()
+	// the track file changes while it is being copied
+	copyFile = func(_, destination string) error {
+		return os.WriteFile(destination, []byte("changed"), 0o644)
+	}
+	store := &backupStore{dir: t.TempDir()}
+	cT := createConcernedArtists(clutteredArtists(t))[0].albums()[0].tracks()[0]
+	o := output.NewRecorder()
+	if backupFile, backedUp := store.backupTrack(o, cT); backupFile != "" || backedUp {
+		t.Errorf("backupStore.backupTrack() = %q, %t, want \"\", false", backupFile, backedUp)
+	}
+	if _, statErr := os.Stat(store.manifestPath()); statErr == nil {
+		t.Errorf("backupStore.backupTrack() recorded a backup that failed")
+	}
+	content, _ := os.ReadFile(cT.backing.Path())
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	if entries, _ := os.ReadDir(filepath.Join(store.dir, hash[:2])); len(entries) != 0 {
+		t.Errorf("backupStore.backupTrack() left %d files in the store", len(entries))
+	}
+	wantErr := fmt.Sprintf("the copy of %q does not match the original", cT.backing.Path())
+	o.Report(t, "backupStore.backupTrack()", output.WantedRecording{
+		Error: fmt.Sprintf("The track file %q could not be backed up due to error '%s'.\n", cT.backing, wantErr) +
+			fmt.Sprintf("The track file %q will not be rewritten.\n", cT.backing),
+		Log: "level='error'" +
+			fmt.Sprintf(" backupStore='%s'", store.dir) +
+			" command='rewrite'" +
+			fmt.Sprintf(" error='%s'", wantErr) +
+			fmt.Sprintf(" source='%s'", cT.backing.Path()) +
+			" msg='cannot store backup'\n",
+	})
+}
+
+func Test_backupStore_backupTrack_damagedFile(t *testing.T) {
+	useFullCopyBackups(t)
+	store := &backupStore{dir: t.TempDir()}
+	cT := createConcernedArtists(clutteredArtists(t))[0].albums()[0].tracks()[0]
+	content, _ := os.ReadFile(cT.backing.Path())
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	backupFile := store.filePath(hash)
+	// the stored file has been damaged since it was stored
+	_ = os.MkdirAll(filepath.Dir(backupFile), 0o755)
+	_ = os.WriteFile(backupFile, content[:len(content)/2], 0o644)
+	o := output.NewRecorder()
+	if got, backedUp := store.backupTrack(o, cT); got != backupFile || !backedUp {
+		t.Errorf("backupStore.backupTrack() = %q, %t, want %q, true", got, backedUp, backupFile)
+	}
+	if stored, _ := os.ReadFile(backupFile); string(stored) != string(content) {
+		t.Errorf("backupStore.backupTrack() kept the damaged file")
+	}
+	o.Report(t, "backupStore.backupTrack()", output.WantedRecording{
+		Console: fmt.Sprintf("The track file %q has been backed up to %q.\n", cT.backing, backupFile),
+		Log: "level='warning'" +
+			" command='rewrite'" +
+			" error='the stored file does not match the hash for which it is named'" +
+			fmt.Sprintf(" file='%s'", backupFile) +
+			fmt.Sprintf(" source='%s'", cT.backing.Path()) +
+			" msg='stored backup damaged'\n",
+	})
+}
+
+func Test_backupStore_lock(t *testing.T) {
+	originalBackupLockWait := backupLockWait
+	defer func() {
+		backupLockWait = originalBackupLockWait
+	}()
+	backupLockWait = 0
+	tests := map[string]struct {
+		lockAge time.Duration
+		wantErr bool
+	}{
+		"unlocked": {},
+		"locked by another process": {
+			lockAge: time.Minute,
+			wantErr: true,
+		},
+		"lock left by a process that ended": {
+			lockAge: time.Hour,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			store := &backupStore{dir: filepath.Join(t.TempDir(), backupStoreDirectory)}
+			if tt.lockAge != 0 {
+				_ = os.MkdirAll(store.dir, 0o755)
+				_ = os.WriteFile(store.lockPath(), []byte("1\n"), 0o644)
+				locked := time.Now().Add(-tt.lockAge)
+				_ = os.Chtimes(store.lockPath(), locked, locked)
+			}
+			unlock, lockErr := store.lock()
+			if (lockErr != nil) != tt.wantErr {
+				t.Fatalf("backupStore.lock() error = %v, want error %t", lockErr, tt.wantErr)
+			}
+			if lockErr != nil {
+				// the other process's lock is left alone
+				if _, statErr := os.Stat(store.lockPath()); statErr != nil {
+					t.Errorf("backupStore.lock() deleted the lock held by another process")
+				}
+				return
+			}
+			if _, statErr := os.Stat(store.lockPath()); statErr != nil {
+				t.Errorf("backupStore.lock() did not create the lock file")
+			}
+			unlock()
+			if _, statErr := os.Stat(store.lockPath()); statErr == nil {
+				t.Errorf("backupStore.lock() unlock did not delete the lock file")
+			}
+			// the store can be locked again once it is unlocked
+			if unlock, lockErr = store.lock(); lockErr != nil {
+				t.Errorf("backupStore.lock() error = %v after unlocking", lockErr)
+			} else {
+				unlock()
+			}
+		})
+	}
+}
+
+func Test_readBackupManifest(t *testing.T) {
+	hash := strings.Repeat("ab", sha256.Size)
+	when := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	good := `{"time":"2026-10-18T12:00:00Z","path":"a.mp3","hash":"` + hash +
+		`","size":10,"reason":"rewrite: files"}`
+	tests := map[string]struct {
+		content      string
+		want         []backupEntry
+		wantBadLines []string
+		wantProblems []string
+	}{
+		"missing": {},
+		"good": {
+			content: good + "\n\n",
+			want:    []backupEntry{{Time: when, Path: "a.mp3", Hash: hash, Size: 10, Reason: "rewrite: files"}},
+		},
+		"bad lines": {
+			content:      "{\n" + good + "\n" + `{"path":"a.mp3","hash":"../../etc"}` + "\n",
+			want:         []backupEntry{{Time: when, Path: "a.mp3", Hash: hash, Size: 10, Reason: "rewrite: files"}},
+			wantBadLines: []string{"{", `{"path":"a.mp3","hash":"../../etc"}`},
+			wantProblems: []string{"line 1: unexpected end of JSON input", "line 3: invalid hash \"../../etc\""},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), backupManifestFile)
+			if tt.content != "" {
+				_ = os.WriteFile(path, []byte(tt.content), 0o644)
+			}
+			got, gotErr := readBackupManifest(path)
+			if gotErr != nil {
+				t.Fatalf("readBackupManifest() error = %v", gotErr)
+			}
+			if !reflect.DeepEqual(got.entries, tt.want) {
+				t.Errorf("readBackupManifest() entries = %v, want %v", got.entries, tt.want)
+			}
+			if !reflect.DeepEqual(got.badLines, tt.wantBadLines) {
+				t.Errorf("readBackupManifest() bad lines = %q, want %q", got.badLines, tt.wantBadLines)
+			}
+			var gotProblems []string
+			for _, problem := range got.problems {
+				gotProblems = append(gotProblems, problem.Error())
+			}
+			if !reflect.DeepEqual(gotProblems, tt.wantProblems) {
+				t.Errorf("readBackupManifest() problems = %q, want %q", gotProblems, tt.wantProblems)
+			}
+		})
+	}
+}
+
+func Test_newBackupStoreUsage(t *testing.T) {
+	entries := []backupEntry{
+		{Path: "a.mp3", Hash: "1", Size: 100},
+		{Path: "a.mp3", Hash: "2", Size: 110},
+		{Path: "b.mp3", Hash: "1", Size: 100},
+	}
+	want := backupStoreUsage{backups: 3, tracks: 2, files: 2, size: 210, unsharedSize: 310}
+	if got := newBackupStoreUsage(entries); got != want {
+		t.Errorf("newBackupStoreUsage() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_backupRetention_retain(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+	entries := []backupEntry{
+		{Time: daysAgo(40), Path: "a.mp3", Hash: "1"},
+		{Time: daysAgo(20), Path: "a.mp3", Hash: "2"},
+		{Time: daysAgo(1), Path: "a.mp3", Hash: "3"},
+		{Time: daysAgo(50), Path: "b.mp3", Hash: "4"},
+	}
+	tests := map[string]struct {
+		retention   backupRetention
+		wantKept    []backupEntry
+		wantDeleted []backupEntry
+	}{
+		"keep none": {wantDeleted: []backupEntry{entries[3], entries[0], entries[1], entries[2]}},
+		"keep by age": {
+			retention:   backupRetention{days: 30},
+			wantKept:    []backupEntry{entries[1], entries[2]},
+			wantDeleted: []backupEntry{entries[3], entries[0]},
+		},
+		"keep by count": {
+			retention:   backupRetention{latest: 1},
+			wantKept:    []backupEntry{entries[3], entries[2]},
+			wantDeleted: []backupEntry{entries[0], entries[1]},
+		},
+		"keep by age or count": {
+			retention:   backupRetention{days: 7, latest: 1},
+			wantKept:    []backupEntry{entries[3], entries[2]},
+			wantDeleted: []backupEntry{entries[0], entries[1]},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			gotKept, gotDeleted := tt.retention.retain(entries, now)
+			if !reflect.DeepEqual(gotKept, tt.wantKept) {
+				t.Errorf("backupRetention.retain() kept = %v, want %v", gotKept, tt.wantKept)
+			}
+			if !reflect.DeepEqual(gotDeleted, tt.wantDeleted) {
+				t.Errorf("backupRetention.retain() deleted = %v, want %v", gotDeleted, tt.wantDeleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+// backupStrategy is a way of backing up a file
+type backupStrategy interface {
+	// name identifies the strategy in the output
+	name() string
+	// probe reports whether the strategy can back up files in the source
+	// directory to the destination directory; it is called once for each pair
+	// of directories, and must leave both directories as it found them
+	probe(sourceDir, destinationDir string) error
+	// backup backs up the source file to the destination; if it fails, no
+	// backup has been made, and the source file is unchanged
+	backup(source, destination string) error
+}
+
+// fullCopy backs up a file by copying it, which works on any file system; the
+// copy is checked against the file, as copying may fail without saying so
+type fullCopy struct{}
+
+func (fullCopy) name() string {
+	return "full copy"
+}
+
+func (fullCopy) probe(_, _ string) error {
+	return nil
+}
+
+func (fullCopy) backup(source, destination string) error {
+	hash, _, hashErr := hashFile(source)
+	if hashErr != nil {
+		return hashErr
+	}
+	return verifiedCopy(source, destination, hash)
+}
+
+// verifiedCopy copies the source file to the destination, and checks that the
+// copy has the specified hash; a copy that cannot be checked, or that does not
+// have the hash, is removed
+func verifiedCopy(source, destination, hash string) error {
+	verifyErr := copyFile(source, destination)
+	if verifyErr == nil {
+		copyHash, _, hashErr := hashFile(destination)
+		switch {
+		case hashErr != nil:
+			verifyErr = hashErr
+		case copyHash != hash:
+			verifyErr = fmt.Errorf("the copy of %q does not match the original", source)
+		default:
+			return nil
+		}
+	}
+	_ = remove(destination)
+	return verifyErr
+}
+
+// hardLink backs up a file by hard linking the backup to it, and then replacing
+// the file with a copy of itself; the backup keeps the original file, with its
+// timestamps, and the file can be rewritten without changing the backup. It
+// works on any file system that supports hard links, NTFS included.
+type hardLink struct{}
+
+const (
+	hardLinkProbeFile         = ".mp3repair-probe"
+	hardLinkReplacementSuffix = ".replacing"
+)
+
+func (hardLink) name() string {
+	return "hard link"
+}
+
+func (hardLink) probe(sourceDir, destinationDir string) error {
+	probeFile := filepath.Join(sourceDir, fmt.Sprintf("%s-%d", hardLinkProbeFile, getPid()))
+	if writeErr := writeFile(probeFile, nil, cmdtoolkit.StdFilePermissions); writeErr != nil {
+		return writeErr
+	}
+	defer func() {
+		_ = remove(probeFile)
+	}()
+	probeLink := filepath.Join(destinationDir, filepath.Base(probeFile))
+	if linkErr := link(probeFile, probeLink); linkErr != nil {
+		return linkErr
+	}
+	return remove(probeLink)
+}
+
+func (hardLink) backup(source, destination string) error {
+	info, statErr := stat(source)
+	if statErr != nil {
+		return statErr
+	}
+	if linkErr := link(source, destination); linkErr != nil {
+		return linkErr
+	}
+	replacement := source + hardLinkReplacementSuffix
+	hash, _, backupErr := hashFile(destination)
+	if backupErr == nil {
+		backupErr = verifiedCopy(destination, replacement, hash)
+	}
+	if backupErr == nil {
+		if backupErr = chmod(replacement, info.Mode().Perm()); backupErr == nil {
+			backupErr = rename(replacement, source)
+		}
+		if backupErr != nil {
+			_ = remove(replacement)
+		}
+	}
+	if backupErr != nil {
+		// the file is still the original, so only the link is removed
+		_ = remove(destination)
+	}
+	return backupErr
+}
+
+var (
+	// backupStrategies lists the strategies to probe, cheapest first; the full
+	// copy, which always works, comes last
+	backupStrategies = []backupStrategy{hardLink{}, fullCopy{}}
+	// backupStrategyChoices holds the strategy chosen for each pair of source
+	// and destination directories
+	backupStrategyChoices = map[string]backupStrategy{}
+	// backupStrategyLock guards backupStrategyChoices, so that each pair of
+	// directories is probed only once
+	backupStrategyLock sync.Mutex
+)
+
+// chooseBackupStrategy returns the cheapest strategy that can back up files in
+// the source directory to the destination directory, probing the strategies the
+// first time the pair of directories is seen; as with backupDescription, the
+// choice is logged unless it is the usual full copy
+func chooseBackupStrategy(o output.Bus, command, sourceDir, destinationDir string) (backupStrategy, error) {
+	backupStrategyLock.Lock()
+	defer backupStrategyLock.Unlock()
+	key := sourceDir + string(filepath.ListSeparator) + destinationDir
+	if strategy, found := backupStrategyChoices[key]; found {
+		return strategy, nil
+	}
+	var probeErrs []error
+	for _, strategy := range backupStrategies {
+		probeErr := strategy.probe(sourceDir, destinationDir)
+		if probeErr == nil {
+			if backupDescription(strategy.name()) != "" {
+				o.Log(output.Info, "backup strategy chosen", map[string]any{
+					"command":     command,
+					"destination": destinationDir,
+					"source":      sourceDir,
+					"strategy":    strategy.name(),
+				})
+			}
+			backupStrategyChoices[key] = strategy
+			return strategy, nil
+		}
+		o.Log(output.Info, "backup strategy not usable", map[string]any{
+			"command":     command,
+			"destination": destinationDir,
+			"error":       probeErr,
+			"source":      sourceDir,
+			"strategy":    strategy.name(),
+		})
+		probeErrs = append(probeErrs, probeErr)
+	}
+	return nil, errors.Join(probeErrs...)
+}
+
+// makeBackup backs up the source file to the destination using the strategy
+// chosen for their directories, returning the name of the strategy used
+func makeBackup(o output.Bus, command, source, destination string) (string, error) {
+	strategy, chooseErr := chooseBackupStrategy(o, command, filepath.Dir(source), filepath.Dir(destination))
+	if chooseErr != nil {
+		return "", chooseErr
+	}
+	if backupErr := strategy.backup(source, destination); backupErr != nil {
+		return "", backupErr
+	}
+	return strategy.name(), nil
+}
+
+// backupDescription describes how a backup was made, for the output; a full
+// copy, the usual way, is not mentioned, nor is a backup that was already made
+func backupDescription(strategy string) string {
+	if strategy == "" || strategy == (fullCopy{}).name() {
+		return ""
+	}
+	return " (" + strategy + ")"
+}
@@ -0,0 +1,330 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/majohn-r/output"
+)
+
+// testBackupStrategy is a backup strategy that fails when told to, counting
+// its probes and backups
+type testBackupStrategy struct {
+	strategyName string
+	probeErr     error
+	backupErr    error
+	probes       *int
+	backups      *int
+}
+
+func (s testBackupStrategy) name() string {
+	return s.strategyName
+}
+
+func (s testBackupStrategy) probe(_, _ string) error {
+	*s.probes++
+	return s.probeErr
+}
+
+func (s testBackupStrategy) backup(_, _ string) error {
+	*s.backups++
+	return s.backupErr
+}
+
+// useFullCopyBackups makes the test's backups by copying, for tests that are
+// not concerned with the choice of backup strategy
+func useFullCopyBackups(t *testing.T) {
+	originalBackupStrategies := backupStrategies
+	t.Cleanup(func() {
+		backupStrategies = originalBackupStrategies
+		backupStrategyChoices = map[string]backupStrategy{}
+	})
+	backupStrategies = []backupStrategy{fullCopy{}}
+}
+
+func Test_hardLink_probe(t *testing.T) {
+	originalLink := link
+	defer func() {
+		link = originalLink
+	}()
+	tests := map[string]struct {
+		link    func(string, string) error
+		wantErr bool
+	}{
+		"links supported": {link: os.Link},
+		"links not supported": {
+			link:    func(_, _ string) error { return fmt.Errorf("operation not supported") },
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			link = tt.link
+			sourceDir := t.TempDir()
+			destinationDir := t.TempDir()
+			if gotErr := (hardLink{}).probe(sourceDir, destinationDir); (gotErr != nil) != tt.wantErr {
+				t.Errorf("hardLink.probe() error = %v, want error %t", gotErr, tt.wantErr)
+			}
+			for _, dir := range []string{sourceDir, destinationDir} {
+				if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+					t.Errorf("hardLink.probe() left %d files in %q", len(entries), dir)
+				}
+			}
+		})
+	}
+}
+
+func Test_hardLink_backup(t *testing.T) {
+	originalCopyFile := copyFile
+	defer func() {
+		copyFile = originalCopyFile
+	}()
+	content := []byte("the original track")
+	tests := map[string]struct {
+		copyFile func(string, string) error
+		wantErr  bool
+	}{
+		"backed up": {copyFile: originalCopyFile},
+		"copy fails": {
+			copyFile: func(_, _ string) error { return fmt.Errorf("disk full") },
+			wantErr:  true,
+		},
+		"copy is incomplete": {
+			copyFile: func(_, destination string) error {
+				return os.WriteFile(destination, content[:4], 0o644)
+			},
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			copyFile = tt.copyFile
+			source := filepath.Join(t.TempDir(), "track.mp3")
+			_ = os.WriteFile(source, content, 0o600)
+			original, _ := os.Stat(source)
+			destination := filepath.Join(t.TempDir(), "backup.mp3")
+			gotErr := (hardLink{}).backup(source, destination)
+			if (gotErr != nil) != tt.wantErr {
+				t.Errorf("hardLink.backup() error = %v, want error %t", gotErr, tt.wantErr)
+			}
+			if got, _ := os.ReadFile(source); !bytes.Equal(got, content) {
+				t.Errorf("hardLink.backup() changed the content of the file")
+			}
+			if _, statErr := os.Stat(source + hardLinkReplacementSuffix); statErr == nil {
+				t.Errorf("hardLink.backup() left the replacement file")
+			}
+			replaced, _ := os.Stat(source)
+			if replaced.Mode() != original.Mode() {
+				t.Errorf("hardLink.backup() file mode = %v, want %v", replaced.Mode(), original.Mode())
+			}
+			if tt.wantErr {
+				if _, statErr := os.Stat(destination); statErr == nil {
+					t.Errorf("hardLink.backup() left the link after failing")
+				}
+				if !os.SameFile(replaced, original) {
+					t.Errorf("hardLink.backup() replaced the file after failing")
+				}
+				return
+			}
+			// the backup is the original file, and the file has been replaced,
+			// so that rewriting it leaves the backup alone
+			backup, _ := os.Stat(destination)
+			if !os.SameFile(backup, original) || os.SameFile(replaced, original) {
+				t.Errorf("hardLink.backup() backup is original = %t, file is original = %t, want true, false",
+					os.SameFile(backup, original), os.SameFile(replaced, original))
+			}
+		})
+	}
+}
+
+func Test_tryTrackBackup_hardLink(t *testing.T) {
+	defer func() {
+		backupStrategyChoices = map[string]backupStrategy{}
+	}()
+	cAl := createConcernedArtists(clutteredArtists(t))[0].albums()[0]
+	track := cAl.tracks()[0].backing
+	content, _ := os.ReadFile(track.Path())
+	path, _ := ensureTrackBackupDirectoryExists(output.NewNilBus(), cAl)
+	backupFile := filepath.Join(path, "1.mp3")
+	o := output.NewRecorder()
+	if !tryTrackBackup(o, track, path) {
+		t.Errorf("tryTrackBackup() = false, want true")
+	}
+	if backup, _ := os.ReadFile(backupFile); !bytes.Equal(backup, content) {
+		t.Errorf("tryTrackBackup() backup does not match the track file")
+	}
+	o.Report(t, "tryTrackBackup()", output.WantedRecording{
+		Console: fmt.Sprintf("The track file %q has been backed up to %q (hard link).\n", track, backupFile),
+		Log: "level='info'" +
+			" command='rewrite'" +
+			fmt.Sprintf(" destination='%s'", path) +
+			fmt.Sprintf(" source='%s'", track.Directory()) +
+			" strategy='hard link'" +
+			" msg='backup strategy chosen'\n",
+	})
+}
+
+func Test_makeBackup(t *testing.T) {
+	originalBackupStrategies := backupStrategies
+	defer func() {
+		backupStrategies = originalBackupStrategies
+		backupStrategyChoices = map[string]backupStrategy{}
+	}()
+	tests := map[string]struct {
+		cloneProbeErr error
+		copyProbeErr  error
+		backupErr     error
+		want          string
+		wantErr       bool
+		wantProbes    []int // clone, copy
+		wantBackups   []int // clone, copy; two tracks are backed up
+		output.WantedRecording
+	}{
+		"clone": {
+			want:        "clone",
+			wantProbes:  []int{1, 0},
+			wantBackups: []int{2, 0},
+			WantedRecording: output.WantedRecording{
+				Log: "level='info'" +
+					" command='rewrite'" +
+					" destination='backups'" +
+					" source='music'" +
+					" strategy='clone'" +
+					" msg='backup strategy chosen'\n",
+			},
+		},
+		"full copy": {
+			cloneProbeErr: fmt.Errorf("operation not supported"),
+			want:          "full copy",
+			wantProbes:    []int{1, 1},
+			wantBackups:   []int{0, 2},
+			WantedRecording: output.WantedRecording{
+				Log: "level='info'" +
+					" command='rewrite'" +
+					" destination='backups'" +
+					" error='operation not supported'" +
+					" source='music'" +
+					" strategy='clone'" +
+					" msg='backup strategy not usable'\n",
+			},
+		},
+		"backup fails": {
+			cloneProbeErr: fmt.Errorf("operation not supported"),
+			backupErr:     fmt.Errorf("disk full"),
+			wantErr:       true,
+			wantProbes:    []int{1, 1},
+			wantBackups:   []int{0, 2},
+			WantedRecording: output.WantedRecording{
+				Log: "level='info'" +
+					" command='rewrite'" +
+					" destination='backups'" +
+					" error='operation not supported'" +
+					" source='music'" +
+					" strategy='clone'" +
+					" msg='backup strategy not usable'\n",
+			},
+		},
+		"nothing usable": {
+			cloneProbeErr: fmt.Errorf("operation not supported"),
+			copyProbeErr:  fmt.Errorf("permission denied"),
+			wantErr:       true,
+			wantProbes:    []int{2, 2},
+			wantBackups:   []int{0, 0},
+			WantedRecording: output.WantedRecording{
+				Log: "level='info'" +
+					" command='rewrite'" +
+					" destination='backups'" +
+					" error='operation not supported'" +
+					" source='music'" +
+					" strategy='clone'" +
+					" msg='backup strategy not usable'\n" +
+					"level='info'" +
+					" command='rewrite'" +
+					" destination='backups'" +
+					" error='permission denied'" +
+					" source='music'" +
+					" strategy='full copy'" +
+					" msg='backup strategy not usable'\n" +
+					"level='info'" +
+					" command='rewrite'" +
+					" destination='backups'" +
+					" error='operation not supported'" +
+					" source='music'" +
+					" strategy='clone'" +
+					" msg='backup strategy not usable'\n" +
+					"level='info'" +
+					" command='rewrite'" +
+					" destination='backups'" +
+					" error='permission denied'" +
+					" source='music'" +
+					" strategy='full copy'" +
+					" msg='backup strategy not usable'\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			backupStrategyChoices = map[string]backupStrategy{}
+			probes := make([]int, 2)
+			backups := make([]int, 2)
+			backupStrategies = []backupStrategy{
+				testBackupStrategy{
+					strategyName: "clone",
+					probeErr:     tt.cloneProbeErr,
+					backupErr:    tt.backupErr,
+					probes:       &probes[0],
+					backups:      &backups[0],
+				},
+				testBackupStrategy{
+					strategyName: "full copy",
+					probeErr:     tt.copyProbeErr,
+					backupErr:    tt.backupErr,
+					probes:       &probes[1],
+					backups:      &backups[1],
+				},
+			}
+			o := output.NewRecorder()
+			for _, track := range []string{"track1.mp3", "track2.mp3"} {
+				got, gotErr := makeBackup(o, "rewrite", filepath.Join("music", track),
+					filepath.Join("backups", track))
+				if got != tt.want || (gotErr != nil) != tt.wantErr {
+					t.Errorf("makeBackup() = %q, %v, want %q, error %t", got, gotErr, tt.want, tt.wantErr)
+				}
+			}
+			// the directories are probed once a strategy has been chosen for
+			// them
+			if probes[0] != tt.wantProbes[0] || probes[1] != tt.wantProbes[1] {
+				t.Errorf("makeBackup() probes = %v, want %v", probes, tt.wantProbes)
+			}
+			if backups[0] != tt.wantBackups[0] || backups[1] != tt.wantBackups[1] {
+				t.Errorf("makeBackup() backups = %v, want %v", backups, tt.wantBackups)
+			}
+			o.Report(t, "makeBackup()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_backupDescription(t *testing.T) {
+	tests := map[string]struct {
+		strategy string
+		want     string
+	}{
+		"already made": {strategy: "", want: ""},
+		"full copy":    {strategy: "full copy", want: ""},
+		"hard link":    {strategy: "hard link", want: " (hard link)"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := backupDescription(tt.strategy); got != tt.want {
+				t.Errorf("backupDescription(%q) = %q, want %q", tt.strategy, got, tt.want)
+			}
+		})
+	}
+}
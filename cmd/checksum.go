@@ -0,0 +1,343 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mp3repair/internal/files"
+	"path/filepath"
+	"time"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+
+	"github.com/majohn-r/output"
+	"github.com/spf13/cobra"
+)
+
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+const (
+	checksumCommandName    = "checksum"
+	checksumVerify         = "verify"
+	checksumVerifyFlag     = "--" + checksumVerify
+	checksumReplace        = "replaceChanged"
+	checksumReplaceFlag    = "--" + checksumReplace
+	checksumAlgorithm      = "sha256"
+	checksumManifestName   = "mp3repair-checksums.json"
+	checksumRecordedLayout = "2006-01-02 15:04:05"
+)
+
+var (
+	checksumCmd = &cobra.Command{
+		Use: checksumCommandName + " [" + checksumVerifyFlag + "] [" + checksumReplaceFlag + "] " +
+			searchUsage + " " + ioUsage,
+		DisableFlagsInUseLine: true,
+		Short:                 "Records or verifies checksums of the selected tracks' audio",
+		Long: "" +
+			fmt.Sprintf("%q records or verifies checksums of the selected tracks' audio\n",
+				checksumCommandName) +
+			"\n" +
+			"The checksum covers only the audio, excluding any ID3V1, ID3V2, and APE tags, so\n" +
+			"rewriting a track's tags does not change it. The checksums of each album's tracks\n" +
+			"are recorded in the file " + checksumManifestName + " in the album's directory; a\n" +
+			"checksum that has changed since it was recorded is reported and kept, and the\n" +
+			"command fails, unless " + checksumReplaceFlag + " is used, in which case the new\n" +
+			"checksum replaces it.\n" +
+			"\n" +
+			"Use " + checksumVerifyFlag + " to compute the checksums again and report the tracks whose audio\n" +
+			"no longer matches its recorded checksum, which may indicate that the track file has\n" +
+			"been corrupted; the command fails if any track does not match. Nothing is recorded\n" +
+			"when verifying.",
+		Example: checksumCommandName + "\n" +
+			"  Record the audio checksums of all tracks\n" +
+			checksumCommandName + " " + checksumVerifyFlag + "\n" +
+			"  Report the tracks whose audio no longer matches its recorded checksum\n" +
+			checksumCommandName + " " + checksumReplaceFlag + "\n" +
+			"  Record the audio checksums of all tracks, replacing any that have changed",
+		RunE: checksumRun,
+	}
+	checksumFlags = &cmdtoolkit.FlagSet{
+		Name: checksumCommandName,
+		Details: map[string]*cmdtoolkit.FlagDetails{
+			checksumVerify: {
+				Usage:        "verify the tracks' audio against the recorded checksums, rather than recording them",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+			checksumReplace: {
+				Usage:        "replace recorded checksums that have changed, rather than keeping them",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+		},
+	}
+)
+
+func checksumRun(cmd *cobra.Command, _ []string) error {
+	exitError := cmdtoolkit.NewExitProgrammingError(checksumCommandName)
+	o := getBus()
+	ctx := commandContext(cmd)
+	producer := cmd.Flags()
+	values, eSlice := cmdtoolkit.ReadFlags(producer, checksumFlags)
+	ss, searchFlagsOk := evaluateSearchFlags(o, producer)
+	ios, ioFlagsOk := evaluateIOFlags(o, producer)
+	if cmdtoolkit.ProcessFlagErrors(o, eSlice) && searchFlagsOk && ioFlagsOk {
+		if cs, flagsOk := processChecksumFlags(o, values); flagsOk {
+			exitError = cs.process(ctx, o, ss.load(ctx, o), ss, ios)
+		}
+	}
+	return cmdtoolkit.ToErrorInterface(exitError)
+}
+
+type checksumSettings struct {
+	verify         cmdtoolkit.CommandFlag[bool]
+	replaceChanged cmdtoolkit.CommandFlag[bool]
+}
+
+func processChecksumFlags(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any]) (*checksumSettings, bool) {
+	cs := &checksumSettings{}
+	flagsOk := true // optimistic
+	var flagErr error
+	if cs.verify, flagErr = cmdtoolkit.GetBool(o, values, checksumVerify); flagErr != nil {
+		flagsOk = false
+	}
+	if cs.replaceChanged, flagErr = cmdtoolkit.GetBool(o, values, checksumReplace); flagErr != nil {
+		flagsOk = false
+	}
+	return cs, flagsOk
+}
+
+// checksumManifest records the audio checksums of an album's tracks, keyed by
+// the names of the track files
+type checksumManifest struct {
+	Algorithm string                   `json:"algorithm"`
+	Tracks    map[string]trackChecksum `json:"tracks"`
+}
+
+// trackChecksum is a track's audio checksum and the time it was recorded
+type trackChecksum struct {
+	Checksum string    `json:"checksum"`
+	Recorded time.Time `json:"recorded"`
+}
+
+// albumChecksums holds the audio checksums computed for an album's tracks
+type albumChecksums struct {
+	directory string
+	results   []files.AudioChecksumResult
+}
+
+func (cs *checksumSettings) process(
+	ctx context.Context,
+	o output.Bus,
+	allArtists []*files.Artist,
+	ss *searchSettings,
+	ios *ioSettings,
+) (e *cmdtoolkit.ExitError) {
+	e = cmdtoolkit.NewExitUserError(checksumCommandName)
+	if len(allArtists) != 0 {
+		if filteredArtists := ss.filter(o, allArtists); len(filteredArtists) != 0 {
+			results := computeAudioChecksums(ctx, o, filteredArtists, ios.openFileLimit)
+			if ctx.Err() != nil {
+				return nil
+			}
+			albums := groupChecksumsByAlbum(results)
+			if cs.verify.Value {
+				return verifyChecksums(o, albums)
+			}
+			return recordChecksums(o, albums, currentTime(), cs.replaceChanged.Value)
+		}
+	}
+	return
+}
+
+// groupChecksumsByAlbum groups the checksums by album directory, in the order
+// in which the albums were read
+func groupChecksumsByAlbum(results []files.AudioChecksumResult) []*albumChecksums {
+	var albums []*albumChecksums
+	byDirectory := map[string]*albumChecksums{}
+	for _, result := range results {
+		dir := result.Track.Directory()
+		album, found := byDirectory[dir]
+		if !found {
+			album = &albumChecksums{directory: dir}
+			byDirectory[dir] = album
+			albums = append(albums, album)
+		}
+		album.results = append(album.results, result)
+	}
+	return albums
+}
+
+// recordChecksums records the checksums in each album's manifest; checksums
+// already recorded for the album's other tracks are kept, as are recorded
+// checksums that have changed, unless they are to be replaced
+func recordChecksums(o output.Bus, albums []*albumChecksums, now time.Time, replaceChanged bool) *cmdtoolkit.ExitError {
+	var e *cmdtoolkit.ExitError
+	recorded := 0
+	albumsRecorded := 0
+	for _, album := range albums {
+		manifest, manifestOk := readChecksumManifest(o, album.directory)
+		if !manifestOk {
+			e = cmdtoolkit.NewExitSystemError(checksumCommandName)
+			continue
+		}
+		count := 0
+		for _, result := range album.results {
+			if result.Err != nil {
+				reportChecksumFailure(o, checksumCommandName, result)
+				e = cmdtoolkit.NewExitSystemError(checksumCommandName)
+				continue
+			}
+			name := result.Track.FileName()
+			if previous, found := manifest.Tracks[name]; found && previous.Checksum != result.Checksum {
+				if !replaceChanged {
+					o.ErrorPrintf("The audio of track %q has changed since its checksum was recorded at %s;"+
+						" the recorded checksum is kept.\n", result.Track,
+						previous.Recorded.Format(checksumRecordedLayout))
+					o.Log(output.Warning, "audio checksum changed", map[string]any{
+						"checksum":  result.Checksum,
+						"command":   checksumCommandName,
+						"directory": result.Track.Directory(),
+						"fileName":  name,
+						"recorded":  previous.Checksum,
+					})
+					e = cmdtoolkit.NewExitSystemError(checksumCommandName)
+					continue
+				}
+				o.ErrorPrintf("The audio of track %q has changed since its checksum was recorded at %s;"+
+					" the new checksum replaces it.\n", result.Track, previous.Recorded.Format(checksumRecordedLayout))
+			}
+			manifest.Tracks[name] = trackChecksum{Checksum: result.Checksum, Recorded: now}
+			count++
+		}
+		if count == 0 {
+			continue
+		}
+		if !writeChecksumManifest(o, album.directory, manifest) {
+			e = cmdtoolkit.NewExitSystemError(checksumCommandName)
+			continue
+		}
+		recorded += count
+		albumsRecorded++
+	}
+	o.ConsolePrintf("%d audio checksums recorded in %d albums.\n", recorded, albumsRecorded)
+	return e
+}
+
+// verifyChecksums compares the checksums with those recorded in each album's
+// manifest and reports the tracks whose audio has changed; if any has, the
+// verification fails
+func verifyChecksums(o output.Bus, albums []*albumChecksums) *cmdtoolkit.ExitError {
+	var e *cmdtoolkit.ExitError
+	matched := 0
+	mismatched := 0
+	unrecorded := 0
+	for _, album := range albums {
+		manifest, manifestOk := readChecksumManifest(o, album.directory)
+		if !manifestOk {
+			e = cmdtoolkit.NewExitSystemError(checksumCommandName)
+			continue
+		}
+		for _, result := range album.results {
+			if result.Err != nil {
+				reportChecksumFailure(o, checksumCommandName, result)
+				e = cmdtoolkit.NewExitSystemError(checksumCommandName)
+				continue
+			}
+			recorded, found := manifest.Tracks[result.Track.FileName()]
+			switch {
+			case !found:
+				unrecorded++
+			case recorded.Checksum == result.Checksum:
+				matched++
+			default:
+				mismatched++
+				o.ConsolePrintf("The audio of track %q does not match its checksum, recorded at %s.\n",
+					result.Track, recorded.Recorded.Format(checksumRecordedLayout))
+				o.Log(output.Warning, "audio checksum mismatch", map[string]any{
+					"checksum":  result.Checksum,
+					"command":   checksumCommandName,
+					"directory": result.Track.Directory(),
+					"fileName":  result.Track.FileName(),
+					"recorded":  recorded.Checksum,
+				})
+			}
+		}
+	}
+	o.ConsolePrintf("%d tracks match their recorded checksums, %d do not, and %d have no recorded checksum.\n",
+		matched, mismatched, unrecorded)
+	if mismatched > 0 && e == nil {
+		e = cmdtoolkit.NewExitSystemError(checksumCommandName)
+	}
+	return e
+}
+
+func reportChecksumFailure(o output.Bus, command string, result files.AudioChecksumResult) {
+	o.ErrorPrintf("The audio checksum of track %q cannot be computed: %s.\n", result.Track,
+		cmdtoolkit.ErrorToString(result.Err))
+	o.Log(output.Error, "cannot compute audio checksum", map[string]any{
+		"command":   command,
+		"directory": result.Track.Directory(),
+		"error":     result.Err,
+		"fileName":  result.Track.FileName(),
+	})
+}
+
+// readChecksumManifest reads the album's manifest; an album without a manifest
+// has an empty one
+func readChecksumManifest(o output.Bus, dir string) (*checksumManifest, bool) {
+	path := filepath.Join(dir, checksumManifestName)
+	manifest := &checksumManifest{Algorithm: checksumAlgorithm, Tracks: map[string]trackChecksum{}}
+	content, readErr := readFile(path)
+	switch {
+	case errors.Is(readErr, fs.ErrNotExist):
+		return manifest, true
+	case readErr == nil:
+		readErr = json.Unmarshal(content, manifest)
+		if readErr == nil && manifest.Algorithm != checksumAlgorithm {
+			readErr = fmt.Errorf("the checksum algorithm %q is not supported", manifest.Algorithm)
+		}
+	}
+	if readErr != nil {
+		o.ErrorPrintf("The checksum manifest %q cannot be read: %s.\n", path, cmdtoolkit.ErrorToString(readErr))
+		o.Log(output.Error, "cannot read checksum manifest", map[string]any{
+			"command":  checksumCommandName,
+			"error":    readErr,
+			"manifest": path,
+		})
+		return nil, false
+	}
+	if manifest.Tracks == nil {
+		manifest.Tracks = map[string]trackChecksum{}
+	}
+	return manifest, true
+}
+
+// writeChecksumManifest writes the album's manifest to a temporary file, which
+// is then renamed into place, so that an interrupted write leaves the previous
+// manifest intact
+func writeChecksumManifest(o output.Bus, dir string, manifest *checksumManifest) bool {
+	path := filepath.Join(dir, checksumManifestName)
+	content, _ := json.MarshalIndent(manifest, "", "  ")
+	partial := path + backupPartialSuffix
+	writeErr := writeFile(partial, content, cmdtoolkit.StdFilePermissions)
+	if writeErr == nil {
+		writeErr = rename(partial, path)
+	}
+	if writeErr != nil {
+		_ = remove(partial)
+		cmdtoolkit.ReportFileCreationFailure(o, checksumCommandName, path, writeErr)
+		return false
+	}
+	return true
+}
+
+func init() {
+	rootCmd.AddCommand(checksumCmd)
+	cmdtoolkit.AddDefaults(checksumFlags)
+	cmdtoolkit.AddFlags(getBus(), getConfiguration(), checksumCmd.Flags(), checksumFlags, searchFlags, ioFlags)
+}
@@ -0,0 +1,381 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"mp3repair/internal/files"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+func Test_processChecksumFlags(t *testing.T) {
+	tests := map[string]struct {
+		values map[string]*cmdtoolkit.CommandFlag[any]
+		want   *checksumSettings
+		want1  bool
+		output.WantedRecording
+	}{
+		"no data": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{},
+			want:   &checksumSettings{},
+			want1:  false,
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"An internal error occurred: flag \"verify\" is not found.\n" +
+					"An internal error occurred: flag \"replaceChanged\" is not found.\n",
+				Log: "" +
+					"level='error' error='flag not found' flag='verify' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='replaceChanged' msg='internal error'\n",
+			},
+		},
+		"verify": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				checksumVerify:  {Value: true, UserSet: true},
+				checksumReplace: {Value: false},
+			},
+			want:  &checksumSettings{verify: cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true}},
+			want1: true,
+		},
+		"replace changed": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				checksumVerify:  {Value: false},
+				checksumReplace: {Value: true, UserSet: true},
+			},
+			want:  &checksumSettings{replaceChanged: cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true}},
+			want1: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			got, got1 := processChecksumFlags(o, tt.values)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("processChecksumFlags() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("processChecksumFlags() got1 = %v, want %v", got1, tt.want1)
+			}
+			o.Report(t, "processChecksumFlags()", tt.WantedRecording)
+		})
+	}
+}
+
+// checksummedArtists creates an artist with an album of two tracks, which
+// differ in their tags but not in their audio
+func checksummedArtists(t *testing.T) ([]*files.Artist, string) {
+	musicDir := t.TempDir()
+	artistDir := filepath.Join(musicDir, "my artist")
+	albumDir := filepath.Join(artistDir, "my album")
+	_ = os.MkdirAll(albumDir, 0o755)
+	artist := files.NewArtist("my artist", artistDir)
+	album := files.AlbumMaker{Title: "my album", Artist: artist, Directory: albumDir}.NewAlbum(true)
+	for k := 1; k <= 2; k++ {
+		title := fmt.Sprintf("my track %d", k)
+		frame := append([]byte("TIT2"), 0, 0, 0, byte(len(title)+1), 0, 0, 0)
+		frame = append(frame, title...)
+		content := append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, byte(len(frame))}, frame...)
+		content = append(content, make([]byte, 256)...)
+		fileName := fmt.Sprintf("%d %s.mp3", k, title)
+		_ = os.WriteFile(filepath.Join(albumDir, fileName), content, 0o644)
+		files.TrackMaker{Album: album, FileName: fileName, SimpleName: title, Number: k}.NewTrack(true)
+	}
+	return []*files.Artist{artist}, albumDir
+}
+
+func Test_checksumSettings_process(t *testing.T) {
+	originalCurrentTime := currentTime
+	defer func() {
+		currentTime = originalCurrentTime
+	}()
+	recorded := time.Date(2026, time.March, 4, 5, 6, 7, 0, time.UTC)
+	currentTime = func() time.Time { return recorded }
+	ss := &searchSettings{
+		artistFilter: regexp.MustCompile(".*"),
+		albumFilter:  regexp.MustCompile(".*"),
+		trackFilter:  regexp.MustCompile(".*"),
+	}
+	ios := &ioSettings{openFileLimit: 4}
+	record := &checksumSettings{}
+	verify := &checksumSettings{verify: cmdtoolkit.CommandFlag[bool]{Value: true}}
+	replace := &checksumSettings{replaceChanged: cmdtoolkit.CommandFlag[bool]{Value: true}}
+	artists, albumDir := checksummedArtists(t)
+	track2 := artists[0].Albums()[0].Tracks()[1]
+	originalChecksum := mustChecksum(t, track2.Path())
+	corruptedAudio := make([]byte, 256)
+	corruptedAudio[255] = 0xFF
+	corruptedChecksum := fmt.Sprintf("%x", sha256.Sum256(corruptedAudio))
+	steps := []struct {
+		name       string
+		cs         *checksumSettings
+		artists    []*files.Artist
+		prepare    func()
+		wantStatus *cmdtoolkit.ExitError
+		output.WantedRecording
+	}{
+		{
+			name:       "no artists",
+			cs:         record,
+			wantStatus: cmdtoolkit.NewExitUserError("checksum"),
+		},
+		{
+			name:    "verify before recording",
+			cs:      verify,
+			artists: artists,
+			WantedRecording: output.WantedRecording{
+				Console: "0 tracks match their recorded checksums, 0 do not, and 2 have no recorded checksum.\n",
+				Error:   "Computing audio checksums.\n",
+			},
+		},
+		{
+			name:    "record",
+			cs:      record,
+			artists: artists,
+			WantedRecording: output.WantedRecording{
+				Console: "2 audio checksums recorded in 1 albums.\n",
+				Error:   "Computing audio checksums.\n",
+			},
+		},
+		{
+			name:    "verify unchanged audio",
+			cs:      verify,
+			artists: artists,
+			WantedRecording: output.WantedRecording{
+				Console: "2 tracks match their recorded checksums, 0 do not, and 0 have no recorded checksum.\n",
+				Error:   "Computing audio checksums.\n",
+			},
+		},
+		{
+			name:    "verify corrupted audio",
+			cs:      verify,
+			artists: artists,
+			prepare: func() {
+				content, _ := os.ReadFile(track2.Path())
+				content[len(content)-1] = 0xFF
+				_ = os.WriteFile(track2.Path(), content, 0o644)
+			},
+			wantStatus: cmdtoolkit.NewExitSystemError("checksum"),
+			WantedRecording: output.WantedRecording{
+				Console: fmt.Sprintf("The audio of track %q does not match its checksum,"+
+					" recorded at 2026-03-04 05:06:07.\n", track2) +
+					"1 tracks match their recorded checksums, 1 do not, and 0 have no recorded checksum.\n",
+				Error: "Computing audio checksums.\n",
+				Log: "level='warning'" +
+					" checksum='" + corruptedChecksum + "'" +
+					" command='checksum'" +
+					fmt.Sprintf(" directory='%s'", albumDir) +
+					fmt.Sprintf(" fileName='%s'", track2.FileName()) +
+					" recorded='" + originalChecksum + "'" +
+					" msg='audio checksum mismatch'\n",
+			},
+		},
+		{
+			name:       "record changed audio",
+			cs:         record,
+			artists:    artists,
+			wantStatus: cmdtoolkit.NewExitSystemError("checksum"),
+			WantedRecording: output.WantedRecording{
+				Console: "1 audio checksums recorded in 1 albums.\n",
+				Error: "Computing audio checksums.\n" +
+					fmt.Sprintf("The audio of track %q has changed since its checksum was recorded at"+
+						" 2026-03-04 05:06:07; the recorded checksum is kept.\n", track2),
+				Log: "level='warning'" +
+					" checksum='" + corruptedChecksum + "'" +
+					" command='checksum'" +
+					fmt.Sprintf(" directory='%s'", albumDir) +
+					fmt.Sprintf(" fileName='%s'", track2.FileName()) +
+					" recorded='" + originalChecksum + "'" +
+					" msg='audio checksum changed'\n",
+			},
+		},
+		{
+			name:    "replace changed checksum",
+			cs:      replace,
+			artists: artists,
+			WantedRecording: output.WantedRecording{
+				Console: "2 audio checksums recorded in 1 albums.\n",
+				Error: "Computing audio checksums.\n" +
+					fmt.Sprintf("The audio of track %q has changed since its checksum was recorded at"+
+						" 2026-03-04 05:06:07; the new checksum replaces it.\n", track2),
+			},
+		},
+		{
+			name:    "unreadable manifest",
+			cs:      verify,
+			artists: artists,
+			prepare: func() {
+				_ = os.WriteFile(filepath.Join(albumDir, checksumManifestName), []byte("{"), 0o644)
+			},
+			wantStatus: cmdtoolkit.NewExitSystemError("checksum"),
+			WantedRecording: output.WantedRecording{
+				Console: "0 tracks match their recorded checksums, 0 do not, and 0 have no recorded checksum.\n",
+				Error: "Computing audio checksums.\n" +
+					fmt.Sprintf("The checksum manifest %q cannot be read: '*json.SyntaxError: unexpected end of JSON input'.\n",
+						filepath.Join(albumDir, checksumManifestName)),
+				Log: "level='error'" +
+					" command='checksum'" +
+					" error='unexpected end of JSON input'" +
+					fmt.Sprintf(" manifest='%s'", filepath.Join(albumDir, checksumManifestName)) +
+					" msg='cannot read checksum manifest'\n",
+			},
+		},
+	}
+	for _, step := range steps {
+		if step.prepare != nil {
+			step.prepare()
+		}
+		o := output.NewRecorder()
+		got := step.cs.process(context.Background(), o, step.artists, ss, ios)
+		if !compareExitErrors(got, step.wantStatus) {
+			t.Errorf("%s: checksumSettings.process() got %s want %s", step.name, got, step.wantStatus)
+		}
+		o.Report(t, step.name+": checksumSettings.process()", step.WantedRecording)
+	}
+}
+
+func Test_writeChecksumManifest(t *testing.T) {
+	originalRename := rename
+	defer func() {
+		rename = originalRename
+	}()
+	manifest := &checksumManifest{Algorithm: checksumAlgorithm, Tracks: map[string]trackChecksum{
+		"1 my track 1.mp3": {Checksum: "abc", Recorded: time.Date(2026, time.March, 4, 5, 6, 7, 0, time.UTC)},
+	}}
+	tests := map[string]struct {
+		rename       func(string, string) error
+		want         bool
+		wantManifest bool
+		output.WantedRecording
+	}{
+		"written": {
+			rename:       os.Rename,
+			want:         true,
+			wantManifest: true,
+		},
+		"cannot be renamed into place": {
+			rename: func(_, _ string) error { return fmt.Errorf("access denied") },
+			WantedRecording: output.WantedRecording{
+				Error: "The file %q cannot be created: 'access denied'.\n",
+				Log: "level='error'" +
+					" command='checksum'" +
+					" error='access denied'" +
+					" fileName='%s'" +
+					" msg='cannot create file'\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, checksumManifestName)
+			// the previous manifest is left intact if the new one cannot be
+			// renamed into place
+			_ = os.WriteFile(path, []byte("previous"), 0o644)
+			rename = tt.rename
+			o := output.NewRecorder()
+			if got := writeChecksumManifest(o, dir, manifest); got != tt.want {
+				t.Errorf("writeChecksumManifest() = %t, want %t", got, tt.want)
+			}
+			if _, statErr := os.Stat(path + backupPartialSuffix); statErr == nil {
+				t.Errorf("writeChecksumManifest() left the temporary file")
+			}
+			got, _ := readChecksumManifest(output.NewNilBus(), dir)
+			if gotManifest := reflect.DeepEqual(got, manifest); gotManifest != tt.wantManifest {
+				t.Errorf("writeChecksumManifest() wrote the manifest = %t, want %t", gotManifest, tt.wantManifest)
+			}
+			want := tt.WantedRecording
+			if want.Error != "" {
+				want.Error = fmt.Sprintf(want.Error, path)
+				want.Log = fmt.Sprintf(want.Log, path)
+			}
+			o.Report(t, "writeChecksumManifest()", want)
+		})
+	}
+}
+
+func mustChecksum(t *testing.T, path string) string {
+	t.Helper()
+	checksum, checksumErr := files.AudioChecksum(path)
+	if checksumErr != nil {
+		t.Fatalf("files.AudioChecksum(%q) error = %v", path, checksumErr)
+	}
+	return checksum
+}
+
+func Test_checksum_Help(t *testing.T) {
+	originalSearchFlags := searchFlags
+	originalMusicDir := xdg.UserDirs.Music
+	defer func() {
+		searchFlags = originalSearchFlags
+		xdg.UserDirs.Music = originalMusicDir
+	}()
+	searchFlags = safeSearchFlags
+	xdg.UserDirs.Music = "."
+	commandUnderTest := cloneCommand(checksumCmd)
+	cmdtoolkit.AddFlags(output.NewNilBus(), cmdtoolkit.EmptyConfiguration(),
+		commandUnderTest.Flags(), checksumFlags, searchFlags, ioFlags)
+	tests := map[string]struct {
+		output.WantedRecording
+	}{
+		"good": {
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"\"checksum\" records or verifies checksums of the selected tracks' audio\n" +
+					"\n" +
+					"The checksum covers only the audio, excluding any ID3V1, ID3V2, and APE tags, so\n" +
+					"rewriting a track's tags does not change it. The checksums of each album's tracks\n" +
+					"are recorded in the file mp3repair-checksums.json in the album's directory; a\n" +
+					"checksum that has changed since it was recorded is reported and kept, and the\n" +
+					"command fails, unless --replaceChanged is used, in which case the new\n" +
+					"checksum replaces it.\n" +
+					"\n" +
+					"Use --verify to compute the checksums again and report the tracks whose audio\n" +
+					"no longer matches its recorded checksum, which may indicate that the track file has\n" +
+					"been corrupted; the command fails if any track does not match. Nothing is recorded\n" +
+					"when verifying.\n" +
+					"\n" +
+					"Usage:\n" +
+					"  checksum [--verify] [--replaceChanged] [--albumFilter regex] [--artistFilter regex] [--trackFilter regex] " +
+					"[--extensions extensions] [--maxOpenFiles count]\n" +
+					"\n" +
+					"Examples:\n" +
+					"checksum\n" +
+					"  Record the audio checksums of all tracks\n" +
+					"checksum --verify\n" +
+					"  Report the tracks whose audio no longer matches its recorded checksum\n" +
+					"checksum --replaceChanged\n" +
+					"  Record the audio checksums of all tracks, replacing any that have changed\n" +
+					"\n" +
+					"Flags:\n" +
+					"      --albumFilter string    regular expression specifying which albums to select (default \".*\")\n" +
+					"      --artistFilter string   regular expression specifying which artists to select (default \".*\")\n" +
+					"      --extensions string     comma-delimited list of file extensions used by mp3 files (default " +
+					"\".mp3\")\n" +
+					"      --maxOpenFiles int      the maximum number of files that can be read simultaneously (at least " +
+					"1, at most 32767, default 1000) (default 1000)\n" +
+					"      --replaceChanged        replace recorded checksums that have changed, rather than keeping " +
+					"them (default false)\n" +
+					"      --trackFilter string    regular expression specifying which tracks to select (default \".*\")\n" +
+					"      --verify                verify the tracks' audio against the recorded checksums, rather than " +
+					"recording them (default false)\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			command := commandUnderTest
+			enableCommandRecording(o, command)
+			_ = command.Help()
+			o.Report(t, "checksum Help()", tt.WantedRecording)
+		})
+	}
+}
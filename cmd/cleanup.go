@@ -5,8 +5,13 @@ Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"math"
 	"mp3repair/internal/files"
+	"path/filepath"
+	"slices"
 	"sort"
 
 	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
@@ -15,34 +20,111 @@ import (
 	"github.com/spf13/cobra"
 )
 
-const cleanupCommandName = "cleanup"
+const (
+	cleanupCommandName    = "cleanup"
+	cleanupKeepDays       = "keepDays"
+	cleanupKeepDaysFlag   = "--" + cleanupKeepDays
+	cleanupKeepLatest     = "keepLatest"
+	cleanupKeepLatestFlag = "--" + cleanupKeepLatest
+	cleanupKeepMinimum    = 0
+	cleanupKeepMaximum    = math.MaxInt16
+	// by default, the stored backups made within the last 30 days, and each
+	// track's most recent stored backup, are kept
+	cleanupKeepDaysDefault   = 30
+	cleanupKeepLatestDefault = 1
+)
 
 var (
+	cleanupKeepDaysBounds = cmdtoolkit.NewIntBounds(cleanupKeepMinimum, cleanupKeepDaysDefault,
+		cleanupKeepMaximum)
+	cleanupKeepLatestBounds = cmdtoolkit.NewIntBounds(cleanupKeepMinimum, cleanupKeepLatestDefault,
+		cleanupKeepMaximum)
 	cleanupCmd = &cobra.Command{
-		Use:                   cleanupCommandName + " " + searchUsage,
+		Use: cleanupCommandName + " [" + cleanupKeepDaysFlag + " days] [" + cleanupKeepLatestFlag + " count] " +
+			searchUsage,
 		DisableFlagsInUseLine: true,
 		Short: "Deletes the backup directories, and their contents, created" +
 			" by the " + rewriteCommandName + " command",
-		Long: fmt.Sprintf(
-			"%q deletes the backup directories (and their contents) created by the %q command",
-			cleanupCommandName, rewriteCommandName),
+		Long: "" +
+			fmt.Sprintf("%q deletes the backup directories (and their contents) created by the %q command\n",
+				cleanupCommandName, rewriteCommandName) +
+			"\n" +
+			"The backups of the selected albums' tracks in the central backup store (see\n" +
+			"'" + rewriteCommandName + " --help') are deleted too, except those kept by " + cleanupKeepDaysFlag + " and\n" +
+			cleanupKeepLatestFlag + ". The stored backups of tracks that no longer exist, in artist and album\n" +
+			"directories matching the search filters, are deleted once they are older than\n" +
+			cleanupKeepDaysFlag + " days. A stored file is deleted once no remaining backup shares it.\n" +
+			"The size of the backup store, and the space saved by sharing identical files, are\n" +
+			"reported.",
+		Example: cleanupCommandName + "\n" +
+			"  Delete the backup directories, and the stored backups more than 30 days old,\n" +
+			"  except for each track's most recent backup\n" +
+			cleanupCommandName + " " + cleanupKeepDaysFlag + " 0 " + cleanupKeepLatestFlag + " 0\n" +
+			"  Delete all backups",
 		RunE: cleanupRun,
 	}
+	cleanupFlags = &cmdtoolkit.FlagSet{
+		Name: cleanupCommandName,
+		Details: map[string]*cmdtoolkit.FlagDetails{
+			cleanupKeepDays: {
+				Usage: fmt.Sprintf("keep the stored backups made within this many days; 0 keeps none by age "+
+					"(at least %d, at most %d, default %d)", cleanupKeepMinimum, cleanupKeepMaximum,
+					cleanupKeepDaysDefault),
+				ExpectedType: cmdtoolkit.IntType,
+				DefaultValue: cleanupKeepDaysBounds,
+			},
+			cleanupKeepLatest: {
+				Usage: fmt.Sprintf("keep this many of each track's most recent stored backups "+
+					"(at least %d, at most %d, default %d)", cleanupKeepMinimum, cleanupKeepMaximum,
+					cleanupKeepLatestDefault),
+				ExpectedType: cmdtoolkit.IntType,
+				DefaultValue: cleanupKeepLatestBounds,
+			},
+		},
+	}
 )
 
 func cleanupRun(cmd *cobra.Command, _ []string) error {
 	exitError := cmdtoolkit.NewExitProgrammingError(cleanupCommandName)
 	o := getBus()
+	ctx := commandContext(cmd)
 	producer := cmd.Flags()
+	values, eSlice := cmdtoolkit.ReadFlags(producer, cleanupFlags)
 	ss, searchFlagsOk := evaluateSearchFlags(o, producer)
-	if searchFlagsOk {
-		// do some work here!
-		exitError = cleanupWork(o, ss, ss.load(o))
+	if cmdtoolkit.ProcessFlagErrors(o, eSlice) && searchFlagsOk {
+		if cs, flagsOk := processCleanupFlags(o, values); flagsOk {
+			cs.store = newBackupStore()
+			exitError = cleanupWork(o, ss, cs, ss.load(ctx, o))
+		}
 	}
 	return cmdtoolkit.ToErrorInterface(exitError)
 }
 
-func cleanupWork(o output.Bus, ss *searchSettings, allArtists []*files.Artist) (e *cmdtoolkit.ExitError) {
+type cleanupSettings struct {
+	retention backupRetention
+	// the backup store to clean up; if nil, only the backup directories are
+	// deleted
+	store *backupStore
+}
+
+func processCleanupFlags(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any]) (*cleanupSettings, bool) {
+	cs := &cleanupSettings{}
+	flagsOk := true // optimistic
+	if rawValue, intErr := cmdtoolkit.GetInt(o, values, cleanupKeepDays); intErr == nil {
+		cs.retention.days = constrainBoundedValue(o, cleanupKeepDaysFlag, rawValue.Value, cleanupKeepDaysBounds)
+	} else {
+		flagsOk = false
+	}
+	if rawValue, intErr := cmdtoolkit.GetInt(o, values, cleanupKeepLatest); intErr == nil {
+		cs.retention.latest = constrainBoundedValue(o, cleanupKeepLatestFlag, rawValue.Value, cleanupKeepLatestBounds)
+	} else {
+		flagsOk = false
+	}
+	return cs, flagsOk
+}
+
+func cleanupWork(o output.Bus, ss *searchSettings, cs *cleanupSettings,
+	allArtists []*files.Artist) (e *cmdtoolkit.ExitError) {
 	e = cmdtoolkit.NewExitUserError(cleanupCommandName)
 	if len(allArtists) != 0 {
 		if filteredArtists := ss.filter(o, allArtists); len(filteredArtists) != 0 {
@@ -74,11 +156,153 @@ func cleanupWork(o output.Bus, ss *searchSettings, allArtists []*files.Artist) (
 				}
 				o.ConsolePrintf("Backup directories deleted: %d.\n", dirsDeleted)
 			}
+			if cs.store != nil {
+				if e2 := cs.cleanBackupStore(o, ss, filteredArtists); e2 != nil {
+					e = e2
+				}
+			}
 		}
 	}
 	return
 }
 
+// cleanBackupStore deletes the stored backups of the selected albums' tracks
+// that the retention settings do not keep, and the orphaned backups that are
+// too old to keep, and then the stored files that no remaining backup shares.
+// The store is locked throughout, so that no backup is stored meanwhile.
+func (cs *cleanupSettings) cleanBackupStore(o output.Bus, ss *searchSettings,
+	artists []*files.Artist) *cmdtoolkit.ExitError {
+	if !dirExists(cs.store.dir) {
+		return nil
+	}
+	unlock, lockErr := cs.store.lock()
+	if lockErr != nil {
+		o.ErrorPrintf("The backup store %q cannot be locked: %s.\n", cs.store.dir, cmdtoolkit.ErrorToString(lockErr))
+		o.Log(output.Error, "cannot lock backup store", map[string]any{
+			"backupStore": cs.store.dir,
+			"command":     cleanupCommandName,
+			"error":       lockErr,
+		})
+		return cmdtoolkit.NewExitSystemError(cleanupCommandName)
+	}
+	defer unlock()
+	path := cs.store.manifestPath()
+	manifest, readErr := readBackupManifest(path)
+	if readErr != nil {
+		o.ErrorPrintf("The backup store manifest %q cannot be read: %s.\n", path, cmdtoolkit.ErrorToString(readErr))
+		o.Log(output.Error, "cannot read backup manifest", map[string]any{
+			"command":  cleanupCommandName,
+			"error":    readErr,
+			"manifest": path,
+		})
+		return cmdtoolkit.NewExitSystemError(cleanupCommandName)
+	}
+	var e *cmdtoolkit.ExitError
+	for _, problem := range manifest.problems {
+		o.ErrorPrintf("The backup store manifest %q has a line that cannot be read, which is kept: %s.\n", path,
+			cmdtoolkit.ErrorToString(problem))
+		o.Log(output.Error, "cannot read backup manifest line", map[string]any{
+			"command":  cleanupCommandName,
+			"error":    problem,
+			"manifest": path,
+		})
+		e = cmdtoolkit.NewExitSystemError(cleanupCommandName)
+	}
+	entries := manifest.entries
+	if len(entries) == 0 {
+		return e
+	}
+	usage := newBackupStoreUsage(entries)
+	o.ConsolePrintf("Backup store: %d backups of %d tracks, in %d files totaling %s; sharing identical files saved %s.\n",
+		usage.backups, usage.tracks, usage.files, formatSize(usage.size), formatSize(usage.unsharedSize-usage.size))
+	albumDirs := map[string]bool{}
+	for _, artist := range artists {
+		for _, album := range artist.Albums() {
+			albumDirs[album.Directory()] = true
+		}
+	}
+	var selected, orphaned, remaining []backupEntry
+	for _, entry := range entries {
+		switch {
+		case albumDirs[filepath.Dir(entry.Path)]:
+			selected = append(selected, entry)
+		case isOrphanedBackup(ss, entry):
+			orphaned = append(orphaned, entry)
+		default:
+			remaining = append(remaining, entry)
+		}
+	}
+	now := currentTime()
+	kept, deleted := cs.retention.retain(selected, now)
+	if len(orphaned) != 0 {
+		o.ConsolePrintf("Stored backups of tracks that no longer exist: %d.\n", len(orphaned))
+		// there is no track whose latest backups could be kept
+		keptOrphans, deletedOrphans := backupRetention{days: cs.retention.days}.retain(orphaned, now)
+		kept = append(kept, keptOrphans...)
+		deleted = append(deleted, deletedOrphans...)
+		slices.SortFunc(deleted, compareBackupEntries)
+	}
+	o.ConsolePrintf("Stored backups to delete: %d.\n", len(deleted))
+	if len(deleted) == 0 {
+		return e
+	}
+	remaining = append(remaining, kept...)
+	shared := map[string]bool{}
+	for _, entry := range remaining {
+		shared[entry.Hash] = true
+	}
+	undeletable := map[string]bool{}
+	filesDeleted := 0
+	var freed int64
+	for _, entry := range deleted {
+		if shared[entry.Hash] || undeletable[entry.Hash] {
+			continue
+		}
+		// a file shared by several deleted backups is deleted only once
+		shared[entry.Hash] = true
+		file := cs.store.filePath(entry.Hash)
+		if removeErr := remove(file); removeErr != nil && !errors.Is(removeErr, fs.ErrNotExist) {
+			o.Log(output.Error, "cannot delete file", map[string]any{
+				"command": cleanupCommandName,
+				"error":   removeErr,
+				"file":    file,
+			})
+			undeletable[entry.Hash] = true
+			e = cmdtoolkit.NewExitSystemError(cleanupCommandName)
+			continue
+		}
+		o.Log(output.Info, "file deleted", map[string]any{"file": file})
+		filesDeleted++
+		freed += entry.Size
+	}
+	backupsDeleted := 0
+	for _, entry := range deleted {
+		if undeletable[entry.Hash] {
+			// the backup still has its file
+			remaining = append(remaining, entry)
+			continue
+		}
+		backupsDeleted++
+	}
+	slices.SortFunc(remaining, compareBackupEntries)
+	if writeErr := writeBackupManifest(path, manifest.badLines, remaining); writeErr != nil {
+		cmdtoolkit.ReportFileCreationFailure(o, cleanupCommandName, path, writeErr)
+		return cmdtoolkit.NewExitSystemError(cleanupCommandName)
+	}
+	o.ConsolePrintf("Stored backups deleted: %d; files deleted: %d, freeing %s.\n", backupsDeleted, filesDeleted,
+		formatSize(freed))
+	return e
+}
+
+// isOrphanedBackup determines whether the backup is of a track that no longer
+// exists, in artist and album directories matching the search filters
+func isOrphanedBackup(ss *searchSettings, entry backupEntry) bool {
+	albumDir := filepath.Dir(entry.Path)
+	return ss.artistFilter.MatchString(filepath.Base(filepath.Dir(albumDir))) &&
+		ss.albumFilter.MatchString(filepath.Base(albumDir)) &&
+		!plainFileExists(entry.Path)
+}
+
 func removeTrackBackupDirectory(o output.Bus, dir string) bool {
 	if fileErr := removeAll(dir); fileErr != nil {
 		o.Log(output.Error, "cannot delete directory", map[string]any{
@@ -93,5 +317,6 @@ func removeTrackBackupDirectory(o output.Bus, dir string) bool {
 
 func init() {
 	rootCmd.AddCommand(cleanupCmd)
-	cmdtoolkit.AddFlags(getBus(), getConfiguration(), cleanupCmd.Flags(), searchFlags)
+	cmdtoolkit.AddDefaults(cleanupFlags)
+	cmdtoolkit.AddFlags(getBus(), getConfiguration(), cleanupCmd.Flags(), cleanupFlags, searchFlags)
 }
@@ -6,8 +6,14 @@ package cmd
 import (
 	"fmt"
 	"mp3repair/internal/files"
+	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/adrg/xdg"
 	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
@@ -183,12 +189,270 @@ func Test_cleanupWork(t *testing.T) {
 			removeAll = tt.removeAll
 			dirExists = tt.dirExists
 			o := output.NewRecorder()
-			_ = cleanupWork(o, tt.args.ss, tt.args.allArtists)
+			_ = cleanupWork(o, tt.args.ss, &cleanupSettings{}, tt.args.allArtists)
 			o.Report(t, "cleanupWork()", tt.WantedRecording)
 		})
 	}
 }
 
+func Test_processCleanupFlags(t *testing.T) {
+	tests := map[string]struct {
+		values map[string]*cmdtoolkit.CommandFlag[any]
+		want   *cleanupSettings
+		want1  bool
+		output.WantedRecording
+	}{
+		"no data": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{},
+			want:   &cleanupSettings{},
+			want1:  false,
+			WantedRecording: output.WantedRecording{
+				Error: "An internal error occurred: flag \"keepDays\" is not found.\n" +
+					"An internal error occurred: flag \"keepLatest\" is not found.\n",
+				Log: "level='error' error='flag not found' flag='keepDays' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='keepLatest' msg='internal error'\n",
+			},
+		},
+		"good": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				cleanupKeepDays:   {Value: 30},
+				cleanupKeepLatest: {Value: 2},
+			},
+			want:  &cleanupSettings{retention: backupRetention{days: 30, latest: 2}},
+			want1: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			got, got1 := processCleanupFlags(o, tt.values)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("processCleanupFlags() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("processCleanupFlags() got1 = %v, want %v", got1, tt.want1)
+			}
+			o.Report(t, "processCleanupFlags()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_cleanupSettings_cleanBackupStore(t *testing.T) {
+	originalCurrentTime := currentTime
+	originalRemove := remove
+	defer func() {
+		currentTime = originalCurrentTime
+		remove = originalRemove
+	}()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	currentTime = func() time.Time { return now }
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+	artists := generateArtists(1, 1, 2, nil)
+	albumDir := artists[0].Albums()[0].Directory()
+	track1 := filepath.Join(albumDir, "1 my track 001.mp3")
+	track2 := filepath.Join(albumDir, "2 my track 002.mp3")
+	// a track that is not selected, and one that no longer exists
+	library := t.TempDir()
+	other := filepath.Join(library, "other artist", "other album", "1 other track.mp3")
+	_ = os.MkdirAll(filepath.Dir(other), 0o755)
+	_ = os.WriteFile(other, []byte("other"), 0o644)
+	gone := filepath.Join(library, "gone artist", "gone album", "1 gone track.mp3")
+	hashA := strings.Repeat("a", 64)
+	hashB := strings.Repeat("b", 64)
+	hashC := strings.Repeat("c", 64)
+	hashD := strings.Repeat("d", 64)
+	hashE := strings.Repeat("e", 64)
+	hashes := []string{hashA, hashB, hashC, hashD, hashE}
+	// the selected tracks' oldest backups are deleted, but only the file
+	// holding track 2's oldest backup is unshared; the orphaned backup is
+	// deleted unless it is kept by age
+	entries := []backupEntry{
+		{Time: daysAgo(10), Path: track1, Hash: hashA, Size: 100, Reason: "rewrite: files"},
+		{Time: daysAgo(5), Path: track1, Hash: hashB, Size: 200, Reason: "rewrite: files"},
+		{Time: daysAgo(3), Path: track2, Hash: hashA, Size: 100, Reason: "rewrite: files"},
+		{Time: daysAgo(20), Path: other, Hash: hashC, Size: 300, Reason: "rewrite: files"},
+		{Time: daysAgo(30), Path: track2, Hash: hashD, Size: 400, Reason: "rewrite: files"},
+		{Time: daysAgo(40), Path: gone, Hash: hashE, Size: 500, Reason: "rewrite: files"},
+	}
+	ss := &searchSettings{
+		artistFilter: regexp.MustCompile(".*"),
+		albumFilter:  regexp.MustCompile(".*"),
+		trackFilter:  regexp.MustCompile(".*"),
+	}
+	tests := map[string]struct {
+		manifest     string
+		badLines     []string
+		retention    *backupRetention
+		remove       func(string) error
+		wantStatus   *cmdtoolkit.ExitError
+		wantManifest []backupEntry
+		wantFiles    []string
+		want         func(store *backupStore) output.WantedRecording
+	}{
+		"no store": {
+			want: func(_ *backupStore) output.WantedRecording { return output.WantedRecording{} },
+		},
+		"corrupt manifest": {
+			manifest:   "{\n",
+			wantStatus: cmdtoolkit.NewExitSystemError("cleanup"),
+			want: func(store *backupStore) output.WantedRecording {
+				return output.WantedRecording{
+					Error: fmt.Sprintf("The backup store manifest %q has a line that cannot be read, which is kept:"+
+						" '*fmt.wrapError: line 1: unexpected end of JSON input'.\n", store.manifestPath()),
+					Log: "level='error'" +
+						" command='cleanup'" +
+						" error='line 1: unexpected end of JSON input'" +
+						fmt.Sprintf(" manifest='%s'", store.manifestPath()) +
+						" msg='cannot read backup manifest line'\n",
+				}
+			},
+		},
+		"bad manifest lines kept": {
+			badLines:     []string{"{", `{"path":"a.mp3","hash":"../../etc"}`},
+			remove:       os.Remove,
+			wantStatus:   cmdtoolkit.NewExitSystemError("cleanup"),
+			wantManifest: []backupEntry{entries[3], entries[1], entries[2]},
+			wantFiles:    []string{hashA, hashB, hashC},
+			want: func(store *backupStore) output.WantedRecording {
+				return output.WantedRecording{
+					Console: "" +
+						"Backup store: 6 backups of 4 tracks, in 5 files totaling 1.5 KiB (1500 bytes);" +
+						" sharing identical files saved 100 bytes.\n" +
+						"Stored backups of tracks that no longer exist: 1.\n" +
+						"Stored backups to delete: 3.\n" +
+						"Stored backups deleted: 3; files deleted: 2, freeing 900 bytes.\n",
+					Error: fmt.Sprintf("The backup store manifest %q has a line that cannot be read, which is kept:"+
+						" '*fmt.wrapError: line 1: unexpected end of JSON input'.\n", store.manifestPath()) +
+						fmt.Sprintf("The backup store manifest %q has a line that cannot be read, which is kept:"+
+							" 'line 2: invalid hash \"../../etc\"'.\n", store.manifestPath()),
+					Log: "level='error'" +
+						" command='cleanup'" +
+						" error='line 1: unexpected end of JSON input'" +
+						fmt.Sprintf(" manifest='%s'", store.manifestPath()) +
+						" msg='cannot read backup manifest line'\n" +
+						"level='error'" +
+						" command='cleanup'" +
+						" error='line 2: invalid hash \"../../etc\"'" +
+						fmt.Sprintf(" manifest='%s'", store.manifestPath()) +
+						" msg='cannot read backup manifest line'\n" +
+						"level='info'" +
+						fmt.Sprintf(" file='%s'", store.filePath(hashE)) +
+						" msg='file deleted'\n" +
+						"level='info'" +
+						fmt.Sprintf(" file='%s'", store.filePath(hashD)) +
+						" msg='file deleted'\n",
+				}
+			},
+		},
+		"old backups deleted": {
+			remove:       os.Remove,
+			wantManifest: []backupEntry{entries[3], entries[1], entries[2]},
+			wantFiles:    []string{hashA, hashB, hashC},
+			want: func(store *backupStore) output.WantedRecording {
+				return output.WantedRecording{
+					Console: "" +
+						"Backup store: 6 backups of 4 tracks, in 5 files totaling 1.5 KiB (1500 bytes);" +
+						" sharing identical files saved 100 bytes.\n" +
+						"Stored backups of tracks that no longer exist: 1.\n" +
+						"Stored backups to delete: 3.\n" +
+						"Stored backups deleted: 3; files deleted: 2, freeing 900 bytes.\n",
+					Log: "level='info'" +
+						fmt.Sprintf(" file='%s'", store.filePath(hashE)) +
+						" msg='file deleted'\n" +
+						"level='info'" +
+						fmt.Sprintf(" file='%s'", store.filePath(hashD)) +
+						" msg='file deleted'\n",
+				}
+			},
+		},
+		"backups kept by age": {
+			retention:    &backupRetention{days: 60, latest: 1},
+			remove:       os.Remove,
+			wantManifest: entries,
+			wantFiles:    hashes,
+			want: func(_ *backupStore) output.WantedRecording {
+				return output.WantedRecording{
+					Console: "" +
+						"Backup store: 6 backups of 4 tracks, in 5 files totaling 1.5 KiB (1500 bytes);" +
+						" sharing identical files saved 100 bytes.\n" +
+						"Stored backups of tracks that no longer exist: 1.\n" +
+						"Stored backups to delete: 0.\n",
+				}
+			},
+		},
+		"file cannot be deleted": {
+			remove:       func(_ string) error { return fmt.Errorf("file locked") },
+			wantStatus:   cmdtoolkit.NewExitSystemError("cleanup"),
+			wantManifest: []backupEntry{entries[5], entries[4], entries[3], entries[1], entries[2]},
+			wantFiles:    hashes,
+			want: func(store *backupStore) output.WantedRecording {
+				return output.WantedRecording{
+					Console: "" +
+						"Backup store: 6 backups of 4 tracks, in 5 files totaling 1.5 KiB (1500 bytes);" +
+						" sharing identical files saved 100 bytes.\n" +
+						"Stored backups of tracks that no longer exist: 1.\n" +
+						"Stored backups to delete: 3.\n" +
+						"Stored backups deleted: 1; files deleted: 0, freeing 0 bytes.\n",
+					Log: "level='error'" +
+						" command='cleanup'" +
+						" error='file locked'" +
+						fmt.Sprintf(" file='%s'", store.filePath(hashE)) +
+						" msg='cannot delete file'\n" +
+						"level='error'" +
+						" command='cleanup'" +
+						" error='file locked'" +
+						fmt.Sprintf(" file='%s'", store.filePath(hashD)) +
+						" msg='cannot delete file'\n",
+				}
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			store := &backupStore{dir: t.TempDir()}
+			if tt.manifest != "" {
+				_ = os.WriteFile(store.manifestPath(), []byte(tt.manifest), 0o644)
+			}
+			if tt.wantManifest != nil {
+				_ = writeBackupManifest(store.manifestPath(), tt.badLines, entries)
+				for _, hash := range hashes {
+					_ = os.MkdirAll(filepath.Dir(store.filePath(hash)), 0o755)
+					_ = os.WriteFile(store.filePath(hash), []byte(hash), 0o644)
+				}
+			}
+			remove = os.Remove
+			if tt.remove != nil {
+				remove = tt.remove
+			}
+			cs := &cleanupSettings{retention: backupRetention{latest: 1}, store: store}
+			if tt.retention != nil {
+				cs.retention = *tt.retention
+			}
+			o := output.NewRecorder()
+			if got := cs.cleanBackupStore(o, ss, artists); !compareExitErrors(got, tt.wantStatus) {
+				t.Errorf("cleanupSettings.cleanBackupStore() got %s want %s", got, tt.wantStatus)
+			}
+			o.Report(t, "cleanupSettings.cleanBackupStore()", tt.want(store))
+			if tt.wantManifest == nil {
+				return
+			}
+			got, _ := readBackupManifest(store.manifestPath())
+			if !reflect.DeepEqual(got.entries, tt.wantManifest) {
+				t.Errorf("cleanupSettings.cleanBackupStore() manifest = %v, want %v", got.entries, tt.wantManifest)
+			}
+			if !reflect.DeepEqual(got.badLines, tt.badLines) {
+				t.Errorf("cleanupSettings.cleanBackupStore() bad lines = %q, want %q", got.badLines, tt.badLines)
+			}
+			for _, hash := range hashes {
+				_, statErr := os.Stat(store.filePath(hash))
+				if got, want := statErr == nil, slices.Contains(tt.wantFiles, hash); got != want {
+					t.Errorf("cleanupSettings.cleanBackupStore() file %q exists = %t, want %t", hash, got, want)
+				}
+			}
+		})
+	}
+}
+
 func Test_cleanupRun(t *testing.T) {
 	initGlobals()
 	originalBus := bus
@@ -202,7 +466,7 @@ func Test_cleanupRun(t *testing.T) {
 	xdg.UserDirs.Music = "."
 	command := &cobra.Command{}
 	cmdtoolkit.AddFlags(output.NewNilBus(), cmdtoolkit.EmptyConfiguration(), command.Flags(),
-		safeSearchFlags)
+		cleanupFlags, safeSearchFlags)
 	type args struct {
 		cmd *cobra.Command
 		in1 []string
@@ -246,7 +510,7 @@ func Test_cleanup_Help(t *testing.T) {
 	xdg.UserDirs.Music = "."
 	commandUnderTest := cloneCommand(cleanupCmd)
 	cmdtoolkit.AddFlags(output.NewNilBus(), cmdtoolkit.EmptyConfiguration(),
-		commandUnderTest.Flags(), safeSearchFlags)
+		commandUnderTest.Flags(), cleanupFlags, safeSearchFlags)
 	tests := map[string]struct {
 		output.WantedRecording
 	}{
@@ -256,9 +520,24 @@ func Test_cleanup_Help(t *testing.T) {
 					"\"cleanup\" deletes the backup directories (and their contents) created by the " +
 					"\"rewrite\" command\n" +
 					"\n" +
+					"The backups of the selected albums' tracks in the central backup store (see\n" +
+					"'rewrite --help') are deleted too, except those kept by --keepDays and\n" +
+					"--keepLatest. The stored backups of tracks that no longer exist, in artist and album\n" +
+					"directories matching the search filters, are deleted once they are older than\n" +
+					"--keepDays days. A stored file is deleted once no remaining backup shares it.\n" +
+					"The size of the backup store, and the space saved by sharing identical files, are\n" +
+					"reported.\n" +
+					"\n" +
 					"Usage:\n" +
-					"  cleanup [--albumFilter regex] [--artistFilter regex]" + " [--trackFilter regex] " +
-					"[--extensions extensions]\n" +
+					"  cleanup [--keepDays days] [--keepLatest count] [--albumFilter regex] [--artistFilter regex]" +
+					" [--trackFilter regex] [--extensions extensions]\n" +
+					"\n" +
+					"Examples:\n" +
+					"cleanup\n" +
+					"  Delete the backup directories, and the stored backups more than 30 days old,\n" +
+					"  except for each track's most recent backup\n" +
+					"cleanup --keepDays 0 --keepLatest 0\n" +
+					"  Delete all backups\n" +
 					"\n" +
 					"Flags:\n" +
 					"      --albumFilter string    regular expression specifying which albums to select " +
@@ -267,6 +546,10 @@ func Test_cleanup_Help(t *testing.T) {
 					"(default \".*\")\n" +
 					"      --extensions string     comma-delimited list of file extensions used by mp3 files " +
 					"(default \".mp3\")\n" +
+					"      --keepDays int          keep the stored backups made within this many days; 0 keeps " +
+					"none by age (at least 0, at most 32767, default 30) (default 30)\n" +
+					"      --keepLatest int        keep this many of each track's most recent stored backups " +
+					"(at least 0, at most 32767, default 1) (default 1)\n" +
 					"      --trackFilter string    regular expression specifying which" + " tracks to select " +
 					"(default \".*\")\n",
 			},
@@ -291,7 +574,7 @@ func Test_cleanup_Usage(t *testing.T) {
 	xdg.UserDirs.Music = "."
 	commandUnderTest := cloneCommand(cleanupCmd)
 	cmdtoolkit.AddFlags(output.NewNilBus(), cmdtoolkit.EmptyConfiguration(),
-		commandUnderTest.Flags(), safeSearchFlags)
+		commandUnderTest.Flags(), cleanupFlags, safeSearchFlags)
 	tests := map[string]struct {
 		output.WantedRecording
 	}{
@@ -299,8 +582,15 @@ func Test_cleanup_Usage(t *testing.T) {
 			WantedRecording: output.WantedRecording{
 				Console: "" +
 					"Usage:\n" +
-					"  cleanup [--albumFilter regex] [--artistFilter regex] [--trackFilter regex] " +
-					"[--extensions extensions]\n" +
+					"  cleanup [--keepDays days] [--keepLatest count] [--albumFilter regex] [--artistFilter regex] " +
+					"[--trackFilter regex] [--extensions extensions]\n" +
+					"\n" +
+					"Examples:\n" +
+					"cleanup\n" +
+					"  Delete the backup directories, and the stored backups more than 30 days old,\n" +
+					"  except for each track's most recent backup\n" +
+					"cleanup --keepDays 0 --keepLatest 0\n" +
+					"  Delete all backups\n" +
 					"\n" +
 					"Flags:\n" +
 					"      --albumFilter string    regular expression specifying which albums to select " +
@@ -309,6 +599,10 @@ func Test_cleanup_Usage(t *testing.T) {
 					"(default \".*\")\n" +
 					"      --extensions string     comma-delimited list of file extensions used by mp3 files " +
 					"(default \".mp3\")\n" +
+					"      --keepDays int          keep the stored backups made within this many days; 0 keeps " +
+					"none by age (at least 0, at most 32767, default 30) (default 30)\n" +
+					"      --keepLatest int        keep this many of each track's most recent stored backups " +
+					"(at least 0, at most 32767, default 1) (default 1)\n" +
 					"      --trackFilter string    regular expression specifying which tracks to select " +
 					"(default \".*\")\n",
 			},
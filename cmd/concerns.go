@@ -9,6 +9,7 @@ import (
 	"mp3repair/internal/files"
 	"reflect"
 	"slices"
+	"strings"
 
 	"github.com/majohn-r/output"
 )
@@ -21,13 +22,15 @@ const (
 	filesConcern
 	numberingConcern
 	conflictConcern
+	portabilityConcern
 )
 
 var concernNames = map[concernType]string{
-	emptyConcern:     "empty",
-	filesConcern:     "files",
-	numberingConcern: "numbering",
-	conflictConcern:  "metadata conflict",
+	emptyConcern:       "empty",
+	filesConcern:       "files",
+	numberingConcern:   "numbering",
+	conflictConcern:    "metadata conflict",
+	portabilityConcern: "portability",
 }
 
 func concernName(i concernType) string {
@@ -76,6 +79,17 @@ func (c concerns) toConsole(o output.Bus) {
 type concernedTrack struct {
 	concerns
 	backing *files.Track
+	// the names of the metadata sources whose missing tags are to be created
+	createTags []string
+	// whether the ID3V2 tag is to be converted to the configured ID3V2 version
+	// and text encoding
+	reformat bool
+	// whether the track's structurally defective ID3V2 tags are to be
+	// replaced by a single clean tag
+	repairStructure bool
+	// the frame policy whose unpermitted frames, and any duplicated text
+	// frames, are to be removed from the ID3V2 tag; nil if there are none
+	framePolicy *files.FramePolicy
 }
 
 func newConcernedTrack(track *files.Track) *concernedTrack {
@@ -347,3 +361,56 @@ func createConcernedArtists(artists []*files.Artist) []*concernedArtist {
 	}
 	return concernedArtists
 }
+
+// concernReport is the structured form of an artist's, album's, or track's
+// concerns, keyed by concern name; it is used by the HTTP API
+type concernReport struct {
+	Name     string              `json:"name"`
+	Concerns map[string][]string `json:"concerns,omitempty"`
+	Children []concernReport     `json:"children,omitempty"`
+}
+
+func (c concerns) toMap() map[string][]string {
+	if !c.isConcerned() {
+		return nil
+	}
+	m := map[string][]string{}
+	for key, value := range c.concernsCollection {
+		if len(value) != 0 {
+			issues := slices.Clone(value)
+			slices.Sort(issues)
+			m[concernName(key)] = issues
+		}
+	}
+	return m
+}
+
+func (cT *concernedTrack) toReport() concernReport {
+	return concernReport{Name: cT.name(), Concerns: cT.concerns.toMap()}
+}
+
+func (cAl *concernedAlbum) toReport() concernReport {
+	report := concernReport{Name: cAl.name(), Concerns: cAl.concerns.toMap()}
+	for _, cT := range cAl.concernedTracks {
+		if cT.isConcerned() {
+			report.Children = append(report.Children, cT.toReport())
+		}
+	}
+	slices.SortFunc(report.Children, compareConcernReports)
+	return report
+}
+
+func (cAr *concernedArtist) toReport() concernReport {
+	report := concernReport{Name: cAr.name(), Concerns: cAr.concerns.toMap()}
+	for _, cAl := range cAr.concernedAlbums {
+		if cAl.isConcerned() {
+			report.Children = append(report.Children, cAl.toReport())
+		}
+	}
+	slices.SortFunc(report.Children, compareConcernReports)
+	return report
+}
+
+func compareConcernReports(a, b concernReport) int {
+	return strings.Compare(a.Name, b.Name)
+}
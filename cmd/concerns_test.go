@@ -5,6 +5,7 @@ package cmd
 
 import (
 	"mp3repair/internal/files"
+	"reflect"
 	"testing"
 
 	"github.com/majohn-r/output"
@@ -764,3 +765,56 @@ func Test_concernedAlbum_rollup(t *testing.T) {
 		})
 	}
 }
+
+func Test_concernedArtist_toReport(t *testing.T) {
+	var artist1 *files.Artist
+	if artists := generateArtists(1, 1, 1, nil); len(artists) > 0 {
+		artist1 = artists[0]
+	}
+	clean := newConcernedArtist(artist1)
+	var artist2 *files.Artist
+	if artists := generateArtists(1, 2, 2, nil); len(artists) > 0 {
+		artist2 = artists[0]
+	}
+	concerned := newConcernedArtist(artist2)
+	if concerned != nil {
+		concerned.addConcern(emptyConcern, "expected no albums")
+		concerned.albums()[1].tracks()[0].addConcern(filesConcern, "no metadata")
+		concerned.albums()[1].tracks()[0].addConcern(filesConcern, "bad year")
+		concerned.albums()[1].tracks()[0].addConcern(numberingConcern, "duplicate number")
+	}
+	tests := map[string]struct {
+		cAr  *concernedArtist
+		want concernReport
+	}{
+		"nothing": {cAr: clean, want: concernReport{Name: "my artist 0"}},
+		"concerns": {
+			cAr: concerned,
+			want: concernReport{
+				Name:     "my artist 0",
+				Concerns: map[string][]string{"empty": {"expected no albums"}},
+				Children: []concernReport{
+					{
+						Name: "my album 01",
+						Children: []concernReport{
+							{
+								Name: "my track 011",
+								Concerns: map[string][]string{
+									"files":     {"bad year", "no metadata"},
+									"numbering": {"duplicate number"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.cAr.toReport(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("concernedArtist.toReport() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/majohn-r/output"
+)
+
+// deferredBus holds the console, error, and log output written by a goroutine
+// until flush replays it, in order, to the underlying bus; this keeps the
+// output of work done concurrently from being interleaved. Its remaining
+// methods are those of the underlying bus.
+type deferredBus struct {
+	output.Bus
+	lock    sync.Mutex
+	pending []func(output.Bus)
+}
+
+func newDeferredBus(o output.Bus) *deferredBus {
+	return &deferredBus{Bus: o}
+}
+
+func (db *deferredBus) hold(f func(output.Bus)) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.pending = append(db.pending, f)
+}
+
+func (db *deferredBus) Log(l output.Level, msg string, fields map[string]any) {
+	db.hold(func(o output.Bus) { o.Log(l, msg, fields) })
+}
+
+func (db *deferredBus) ConsolePrintf(format string, args ...any) {
+	text := fmt.Sprintf(format, args...)
+	db.hold(func(o output.Bus) { o.ConsolePrintf("%s", text) })
+}
+
+func (db *deferredBus) ConsolePrintln(msg string) {
+	db.hold(func(o output.Bus) { o.ConsolePrintln(msg) })
+}
+
+func (db *deferredBus) ErrorPrintf(format string, args ...any) {
+	text := fmt.Sprintf(format, args...)
+	db.hold(func(o output.Bus) { o.ErrorPrintf("%s", text) })
+}
+
+func (db *deferredBus) ErrorPrintln(msg string) {
+	db.hold(func(o output.Bus) { o.ErrorPrintln(msg) })
+}
+
+// flush writes the held output to the underlying bus
+func (db *deferredBus) flush() {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	for _, f := range db.pending {
+		f(db.Bus)
+	}
+	db.pending = nil
+}
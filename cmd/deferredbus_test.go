@@ -0,0 +1,34 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/majohn-r/output"
+)
+
+func Test_deferredBus(t *testing.T) {
+	o := output.NewRecorder()
+	db := newDeferredBus(o)
+	db.ConsolePrintf("%d %s\n", 1, "console")
+	db.ErrorPrintln("error")
+	db.Log(output.Info, "logged", map[string]any{"k": "v"})
+	db.ConsolePrintln("console 2")
+	db.ErrorPrintf("%s %d\n", "error", 2)
+	o.Report(t, "deferredBus before flush", output.WantedRecording{})
+	db.flush()
+	o.Report(t, "deferredBus.flush()", output.WantedRecording{
+		Console: "1 console\nconsole 2\n",
+		Error:   "error\nerror 2\n",
+		Log:     "level='info' k='v' msg='logged'\n",
+	})
+	db.flush()
+	o.Report(t, "deferredBus.flush() again", output.WantedRecording{
+		Console: "1 console\nconsole 2\n",
+		Error:   "error\nerror 2\n",
+		Log:     "level='info' k='v' msg='logged'\n",
+	})
+}
@@ -0,0 +1,225 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package cmd
+
+import (
+	"cmp"
+	"encoding/hex"
+	"fmt"
+	"mp3repair/internal/files"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/majohn-r/output"
+)
+
+// likely duplicates may differ in duration by this much, as different rips of
+// the same recording are rarely trimmed identically
+const duplicateDurationTolerance = 2 * time.Second
+
+// duplicateGroup is a set of tracks, or of albums, that appear to be copies of
+// each other; the first path is the copy suggested to keep
+type duplicateGroup struct {
+	reason string
+	paths  []string
+}
+
+// findDuplicates finds the identical tracks, the albums ripped from the same
+// CD, and the tracks that are likely to be the same recording
+func findDuplicates(
+	artists []*files.Artist,
+	results []files.AudioChecksumResult,
+	e files.NameEquivalence,
+) []*duplicateGroup {
+	albumSizes := map[string]int{}
+	for _, artist := range artists {
+		for _, album := range artist.Albums() {
+			albumSizes[album.Directory()] = len(album.Tracks())
+		}
+	}
+	var groups []*duplicateGroup
+	groups = append(groups, findIdenticalTracks(results, albumSizes)...)
+	groups = append(groups, findDuplicateAlbums(artists)...)
+	groups = append(groups, findLikelyDuplicateTracks(results, albumSizes, e)...)
+	return groups
+}
+
+// findIdenticalTracks groups the tracks whose audio checksums are the same
+func findIdenticalTracks(results []files.AudioChecksumResult, albumSizes map[string]int) []*duplicateGroup {
+	byChecksum := map[string][]*files.Track{}
+	for _, result := range results {
+		if result.Err == nil {
+			byChecksum[result.Checksum] = append(byChecksum[result.Checksum], result.Track)
+		}
+	}
+	var groups []*duplicateGroup
+	for _, tracks := range byChecksum {
+		if len(tracks) > 1 {
+			groups = append(groups, newTrackDuplicateGroup("identical audio", tracks, albumSizes))
+		}
+	}
+	return sortDuplicateGroups(groups)
+}
+
+// findDuplicateAlbums groups the albums whose tracks have the same music CD
+// identifier (MCDI) frame
+func findDuplicateAlbums(artists []*files.Artist) []*duplicateGroup {
+	byIdentifier := map[string][]*files.Album{}
+	for _, artist := range artists {
+		for _, album := range artist.Albums() {
+			for _, track := range album.Tracks() {
+				if identifier := track.CDIdentifier(); len(identifier) != 0 {
+					key := hex.EncodeToString(identifier)
+					byIdentifier[key] = append(byIdentifier[key], album)
+					break
+				}
+			}
+		}
+	}
+	var groups []*duplicateGroup
+	for _, albums := range byIdentifier {
+		if len(albums) > 1 {
+			// keep the most complete copy of the album
+			slices.SortFunc(albums, func(a, b *files.Album) int {
+				return cmp.Or(cmp.Compare(len(b.Tracks()), len(a.Tracks())),
+					strings.Compare(a.Directory(), b.Directory()))
+			})
+			group := &duplicateGroup{reason: "identical music CD identifier"}
+			for _, album := range albums {
+				group.paths = append(group.paths, album.Directory())
+			}
+			groups = append(groups, group)
+		}
+	}
+	return sortDuplicateGroups(groups)
+}
+
+// findLikelyDuplicateTracks groups the tracks that have the same artist and
+// title, after normalization, and nearly the same duration; groups whose
+// tracks are all identical are omitted, as they have already been reported
+func findLikelyDuplicateTracks(
+	results []files.AudioChecksumResult,
+	albumSizes map[string]int,
+	e files.NameEquivalence,
+) []*duplicateGroup {
+	byName := map[string][]files.AudioChecksumResult{}
+	for _, result := range results {
+		if result.Err == nil && result.Duration > 0 {
+			key := normalizeDuplicateName(result.Track.ArtistName(), e) + "\x00" +
+				normalizeDuplicateName(result.Track.Name(), e)
+			byName[key] = append(byName[key], result)
+		}
+	}
+	var groups []*duplicateGroup
+	for _, candidates := range byName {
+		slices.SortFunc(candidates, func(a, b files.AudioChecksumResult) int {
+			return cmp.Compare(a.Duration, b.Duration)
+		})
+		for start := 0; start < len(candidates); {
+			end := start + 1
+			for end < len(candidates) &&
+				candidates[end].Duration-candidates[start].Duration <= duplicateDurationTolerance {
+				end++
+			}
+			if cluster := candidates[start:end]; len(cluster) > 1 && !allIdentical(cluster) {
+				tracks := make([]*files.Track, 0, len(cluster))
+				for _, result := range cluster {
+					tracks = append(tracks, result.Track)
+				}
+				groups = append(groups, newTrackDuplicateGroup(
+					fmt.Sprintf("same artist, title, and duration (about %s)", formatDuration(cluster[0].Duration)),
+					tracks, albumSizes))
+			}
+			start = end
+		}
+	}
+	return sortDuplicateGroups(groups)
+}
+
+func allIdentical(results []files.AudioChecksumResult) bool {
+	for _, result := range results[1:] {
+		if result.Checksum != results[0].Checksum {
+			return false
+		}
+	}
+	return true
+}
+
+// newTrackDuplicateGroup creates a group of duplicate tracks; the copy
+// suggested to keep is the one on the album with the most tracks, which is
+// more likely to be the original album than a compilation or a partial rip;
+// the album sizes are keyed by album directory
+func newTrackDuplicateGroup(reason string, tracks []*files.Track, albumSizes map[string]int) *duplicateGroup {
+	slices.SortFunc(tracks, func(a, b *files.Track) int {
+		return cmp.Or(cmp.Compare(albumSizes[b.Directory()], albumSizes[a.Directory()]),
+			strings.Compare(a.Path(), b.Path()))
+	})
+	group := &duplicateGroup{reason: reason}
+	for _, track := range tracks {
+		group.paths = append(group.paths, track.Path())
+	}
+	return group
+}
+
+// sortDuplicateGroups sorts the groups by the paths of the copies to keep, so
+// that the report is stable
+func sortDuplicateGroups(groups []*duplicateGroup) []*duplicateGroup {
+	slices.SortFunc(groups, func(a, b *duplicateGroup) int {
+		return strings.Compare(a.paths[0], b.paths[0])
+	})
+	return groups
+}
+
+// normalizeDuplicateName reduces a name to its canonical form, using the name
+// equivalence rules, and then to its lowercase letters and digits, ignoring any
+// parenthesized or bracketed qualifiers such as "(Remastered)"
+func normalizeDuplicateName(s string, e files.NameEquivalence) string {
+	var b strings.Builder
+	depth := 0
+	pendingSpace := false
+	for _, r := range strings.ToLower(e.CanonicalName(s)) {
+		switch {
+		case r == '(' || r == '[':
+			depth++
+		case r == ')' || r == ']':
+			depth = max(depth-1, 0)
+		case depth > 0:
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if pendingSpace && b.Len() != 0 {
+				b.WriteByte(' ')
+			}
+			pendingSpace = false
+			b.WriteRune(r)
+		default:
+			pendingSpace = true
+		}
+	}
+	return b.String()
+}
+
+func formatDuration(d time.Duration) string {
+	seconds := int(d.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+func reportDuplicates(o output.Bus, groups []*duplicateGroup) {
+	if len(groups) == 0 {
+		o.ConsolePrintln("Duplicate Analysis: no duplicates found.")
+		return
+	}
+	o.ConsolePrintln("Duplicate Analysis:")
+	for _, group := range groups {
+		o.ConsolePrintf("* %s:\n", group.reason)
+		for k, path := range group.paths {
+			if k == 0 {
+				o.ConsolePrintf("  - %q (suggested copy to keep)\n", path)
+				continue
+			}
+			o.ConsolePrintf("  - %q\n", path)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mp3repair/internal/files"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+// makeDuplicateLibrary makes a library holding the same CD ripped twice under
+// different album names, and a compilation sharing a track with the original
+// album
+func makeDuplicateLibrary() ([]*files.Artist, map[string]*files.Track) {
+	tracks := map[string]*files.Track{}
+	beatles := files.NewArtist("The Beatles", filepath.Join("Music", "The Beatles"))
+	various := files.NewArtist("Various Artists", filepath.Join("Music", "Various Artists"))
+	addAlbum := func(artist *files.Artist, title string, mcdi []byte, names ...string) {
+		album := files.AlbumMaker{
+			Title:     title,
+			Artist:    artist,
+			Directory: filepath.Join(artist.Directory(), title),
+		}.NewAlbum(true)
+		for k, name := range names {
+			tracks[title+"/"+name] = files.TrackMaker{
+				Album:      album,
+				FileName:   name + ".mp3",
+				SimpleName: name,
+				Number:     k + 1,
+				Metadata: (&files.TrackMetadataMaker{
+					// even the compilation's track is performed by The Beatles
+					Artist:       "The Beatles",
+					TrackName:    name,
+					TrackNumber:  k + 1,
+					CDIdentifier: mcdi,
+					Source:       files.ID3V2,
+				}).MakeMetadata(),
+			}.NewTrack(true)
+		}
+	}
+	addAlbum(beatles, "Abbey Road", []byte("abbey road"), "Come Together", "Something", "Octopus's Garden")
+	addAlbum(beatles, "Abbey Road (Remastered)", []byte("abbey road"), "Come Together", "Something")
+	addAlbum(beatles, "Let It Be", []byte("let it be"), "Let It Be")
+	addAlbum(various, "Hits", nil, "Something (Remastered)")
+	return []*files.Artist{beatles, various}, tracks
+}
+
+func Test_findDuplicates(t *testing.T) {
+	artists, tracks := makeDuplicateLibrary()
+	results := []files.AudioChecksumResult{
+		{Track: tracks["Abbey Road/Come Together"], Checksum: "a", Duration: 259 * time.Second},
+		{Track: tracks["Abbey Road/Something"], Checksum: "b", Duration: 182 * time.Second},
+		{Track: tracks["Abbey Road/Octopus's Garden"], Checksum: "c", Duration: 171 * time.Second},
+		{Track: tracks["Abbey Road (Remastered)/Come Together"], Checksum: "a", Duration: 259 * time.Second},
+		{Track: tracks["Abbey Road (Remastered)/Something"], Checksum: "d", Duration: 183 * time.Second},
+		{Track: tracks["Let It Be/Let It Be"], Checksum: "e", Duration: 243 * time.Second},
+		{Track: tracks["Hits/Something (Remastered)"], Checksum: "f", Duration: 183 * time.Second},
+		{Track: tracks["Hits/Something (Remastered)"], Err: errors.New("unreadable")},
+	}
+	abbeyRoad := filepath.Join("Music", "The Beatles", "Abbey Road")
+	remastered := filepath.Join("Music", "The Beatles", "Abbey Road (Remastered)")
+	want := []*duplicateGroup{
+		{
+			reason: "identical audio",
+			paths: []string{
+				filepath.Join(abbeyRoad, "Come Together.mp3"),
+				filepath.Join(remastered, "Come Together.mp3"),
+			},
+		},
+		{reason: "identical music CD identifier", paths: []string{abbeyRoad, remastered}},
+		{
+			reason: "same artist, title, and duration (about 3:02)",
+			paths: []string{
+				filepath.Join(abbeyRoad, "Something.mp3"),
+				filepath.Join(remastered, "Something.mp3"),
+				filepath.Join("Music", "Various Artists", "Hits", "Something (Remastered).mp3"),
+			},
+		},
+	}
+	if got := findDuplicates(artists, results, files.NameEquivalence{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("findDuplicates() = %v, want %v", got, want)
+	}
+}
+
+func Test_normalizeDuplicateName(t *testing.T) {
+	tests := map[string]struct {
+		s    string
+		e    files.NameEquivalence
+		want string
+	}{
+		"plain":         {s: "Something", want: "something"},
+		"punctuation":   {s: "Octopus's  Garden!", want: "octopus s garden"},
+		"qualified":     {s: "Let It Be (Remastered 2009) [Live]", want: "let it be"},
+		"unbalanced":    {s: "Help!)", want: "help"},
+		"only brackets": {s: "(Untitled)", want: ""},
+		"equivalence": {
+			s:    "Beatles, The",
+			e:    files.NameEquivalence{InvertArticles: true},
+			want: "the beatles",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := normalizeDuplicateName(tt.s, tt.e); got != tt.want {
+				t.Errorf("normalizeDuplicateName(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_reportDuplicates(t *testing.T) {
+	tests := map[string]struct {
+		groups []*duplicateGroup
+		output.WantedRecording
+	}{
+		"none": {
+			WantedRecording: output.WantedRecording{Console: "Duplicate Analysis: no duplicates found.\n"},
+		},
+		"some": {
+			groups: []*duplicateGroup{
+				{reason: "identical audio", paths: []string{"a.mp3", "b.mp3", "c.mp3"}},
+				{reason: "identical music CD identifier", paths: []string{"album 1", "album 2"}},
+			},
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"Duplicate Analysis:\n" +
+					"* identical audio:\n" +
+					"  - \"a.mp3\" (suggested copy to keep)\n" +
+					"  - \"b.mp3\"\n" +
+					"  - \"c.mp3\"\n" +
+					"* identical music CD identifier:\n" +
+					"  - \"album 1\" (suggested copy to keep)\n" +
+					"  - \"album 2\"\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			reportDuplicates(o, tt.groups)
+			o.Report(t, "reportDuplicates()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_scanSettings_performDuplicateAnalysis(t *testing.T) {
+	originalReadMetadata := readMetadata
+	originalComputeAudioChecksums := computeAudioChecksums
+	defer func() {
+		readMetadata = originalReadMetadata
+		computeAudioChecksums = originalComputeAudioChecksums
+	}()
+	reads := 0
+	readMetadata = func(_ context.Context, _ output.Bus, _ []*files.Artist, _ int) { reads++ }
+	computeAudioChecksums = func(_ context.Context, _ output.Bus, artists []*files.Artist,
+		_ int) []files.AudioChecksumResult {
+		var results []files.AudioChecksumResult
+		for _, artist := range artists {
+			for _, album := range artist.Albums() {
+				for _, track := range album.Tracks() {
+					result := files.AudioChecksumResult{Track: track, Checksum: "same", Duration: time.Minute}
+					if track.Number() == 2 {
+						result = files.AudioChecksumResult{Track: track, Err: errors.New("unreadable")}
+					}
+					results = append(results, result)
+				}
+			}
+		}
+		return results
+	}
+	ss := &searchSettings{
+		artistFilter: regexp.MustCompile(".*"),
+		albumFilter:  regexp.MustCompile(".*"),
+		trackFilter:  regexp.MustCompile(".*"),
+	}
+	ios := &ioSettings{openFileLimit: 100}
+	concernedArtists := createConcernedArtists(generateArtists(1, 1, 2, nil))
+	if got := (&scanSettings{}).performDuplicateAnalysis(context.Background(), output.NewNilBus(),
+		concernedArtists, ss, ios); got != nil {
+		t.Errorf("scanSettings.performDuplicateAnalysis() not requested = %v, want nil", got)
+	}
+	scanSets := &scanSettings{
+		duplicates: cmdtoolkit.CommandFlag[bool]{Value: true},
+		files:      cmdtoolkit.CommandFlag[bool]{Value: true},
+	}
+	o := output.NewRecorder()
+	scanSets.performFileAnalysis(context.Background(), o, concernedArtists, ss, ios)
+	got := scanSets.performDuplicateAnalysis(context.Background(), o, concernedArtists, ss, ios)
+	if reads != 1 {
+		t.Errorf("scanSettings.performDuplicateAnalysis() read metadata %d times, want 1", reads)
+	}
+	if len(got) != 0 {
+		t.Errorf("scanSettings.performDuplicateAnalysis() = %v, want no duplicates", got)
+	}
+	path := filepath.Join("Music", "my artist", "my album 00")
+	o.Report(t, "scanSettings.performDuplicateAnalysis()", output.WantedRecording{
+		Error: fmt.Sprintf("The audio checksum of track %q cannot be computed: 'unreadable'.\n",
+			filepath.Join(path, "2 my track 002.mp3")),
+		Log: "" +
+			"level='error'" +
+			" command='scan'" +
+			" directory='" + path + "'" +
+			" error='unreadable'" +
+			" fileName='2 my track 002.mp3'" +
+			" msg='cannot compute audio checksum'\n",
+	})
+}
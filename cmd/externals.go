@@ -7,7 +7,10 @@ Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
 // code to easily override them
 import (
 	"mp3repair/internal/files"
+	"net/http"
 	"os"
+	"os/user"
+	"path/filepath"
 	"time"
 
 	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
@@ -16,6 +19,7 @@ import (
 )
 
 var (
+	applicationPath        = cmdtoolkit.ApplicationPath
 	copyFile               = cmdtoolkit.CopyFile
 	dereferenceEnvVar      = cmdtoolkit.DereferenceEnvVar
 	dirExists              = cmdtoolkit.DirExists
@@ -33,14 +37,31 @@ var (
 	dirty                  = files.Dirty
 	markDirty              = files.MarkDirty
 	readMetadata           = files.ReadMetadata
+	readID3V2Diagnostics   = (*files.Track).ID3V2Diagnostics
+	setID3V2Policy         = files.SetID3V2Policy
+	applyID3V2Conversion   = files.ID3V2Conversion.Apply
+	addID3V1Tag            = (*files.Track).AddID3V1Tag
+	audioChecksum          = files.AudioChecksum
+	computeAudioChecksums  = files.ComputeAudioChecksums
+	verifyRewrite          = (*files.Track).VerifyRewrite
 	connect                = mgr.Connect
 	Exit                   = os.Exit
 	getPid                 = os.Getpid
 	getPpid                = os.Getppid
+	mkdirAll               = os.MkdirAll
+	chmod                  = os.Chmod
+	link                   = os.Link
+	openFile               = os.OpenFile
+	readFile               = os.ReadFile
 	rename                 = os.Rename
 	remove                 = os.Remove
 	removeAll              = os.RemoveAll
+	stat                   = os.Stat
 	writeFile              = os.WriteFile
 	newDefaultBus          = output.NewDefaultBus
+	currentUser            = user.Current
+	currentTime            = time.Now
 	since                  = time.Since
+	walkDir                = filepath.WalkDir
+	listenAndServe         = (*http.Server).ListenAndServe
 )
@@ -0,0 +1,106 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"mp3repair/internal/files"
+	"slices"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	framePolicyFile     = "framePolicy"
+	framePolicyFileFlag = "--" + framePolicyFile
+	framePolicyUsage    = "the path of a YAML file listing the ID3V2 frames that tags may or must contain; if " +
+		"empty, no frame policy is applied"
+)
+
+// framePolicyEntry is a frame policy, as written in the frame policy file
+type framePolicyEntry struct {
+	Allow   []string `yaml:"allow"`
+	Deny    []string `yaml:"deny"`
+	Require []string `yaml:"require"`
+}
+
+func (entry framePolicyEntry) policy() files.FramePolicy {
+	return files.FramePolicy{Allow: entry.Allow, Deny: entry.Deny, Require: entry.Require}
+}
+
+// framePolicies holds the library's frame policy and the frame policies of
+// individual artists, which replace the library's policy for their tracks
+type framePolicies struct {
+	Library framePolicyEntry            `yaml:"library"`
+	Artists map[string]framePolicyEntry `yaml:"artists"`
+}
+
+// evaluateFramePolicies reads the frame policy file named by the framePolicy
+// flag; it returns nil if no file is named
+func evaluateFramePolicies(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any]) (*framePolicies, bool) {
+	rawValue, flagErr := cmdtoolkit.GetString(o, values, framePolicyFile)
+	if flagErr != nil {
+		return nil, false
+	}
+	if rawValue.Value == "" {
+		return nil, true
+	}
+	policies, loadErr := loadFramePolicies(rawValue.Value)
+	if loadErr != nil {
+		o.ErrorPrintf("The %s value %q cannot be used.\n", framePolicyFileFlag, rawValue.Value)
+		o.ErrorPrintln("Why?")
+		o.ErrorPrintf("The file cannot be read or is not valid: %s.\n", cmdtoolkit.ErrorToString(loadErr))
+		o.ErrorPrintln("What to do:")
+		o.ErrorPrintln("Provide a YAML file containing a library frame policy and, optionally, frame policies " +
+			"for individual artists; each policy may list allowed or denied frames, and required frames.")
+		o.Log(output.Error, "invalid frame policy", map[string]any{
+			framePolicyFileFlag: rawValue.Value,
+			"user-set":          rawValue.UserSet,
+			"error":             loadErr,
+		})
+		return nil, false
+	}
+	return policies, true
+}
+
+func loadFramePolicies(path string) (*framePolicies, error) {
+	content, readErr := readFile(path)
+	if readErr != nil {
+		return nil, readErr
+	}
+	policies := &framePolicies{}
+	if yamlErr := yaml.Unmarshal(content, policies); yamlErr != nil {
+		return nil, yamlErr
+	}
+	var problems []error
+	if policyErr := policies.Library.policy().Validate(); policyErr != nil {
+		problems = append(problems, fmt.Errorf("library: %w", policyErr))
+	}
+	names := make([]string, 0, len(policies.Artists))
+	for name := range policies.Artists {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if policyErr := policies.Artists[name].policy().Validate(); policyErr != nil {
+			problems = append(problems, fmt.Errorf("artist %q: %w", name, policyErr))
+		}
+	}
+	if len(problems) != 0 {
+		return nil, errors.Join(problems...)
+	}
+	return policies, nil
+}
+
+// forArtist returns the frame policy that applies to the artist's tracks
+func (fp *framePolicies) forArtist(name string) files.FramePolicy {
+	if entry, found := fp.Artists[name]; found {
+		return entry.policy()
+	}
+	return fp.Library.policy()
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"errors"
+	"mp3repair/internal/files"
+	"reflect"
+	"testing"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+func Test_loadFramePolicies(t *testing.T) {
+	originalReadFile := readFile
+	defer func() {
+		readFile = originalReadFile
+	}()
+	tests := map[string]struct {
+		content  string
+		readErr  error
+		want     *framePolicies
+		wantErr  bool
+		errorMsg string
+	}{
+		"unreadable": {
+			readErr:  errors.New("file not found"),
+			wantErr:  true,
+			errorMsg: "file not found",
+		},
+		"not yaml": {
+			content: "library: [",
+			wantErr: true,
+		},
+		"empty": {
+			content: "",
+			want:    &framePolicies{},
+		},
+		"valid": {
+			content: "" +
+				"library:\n" +
+				"  deny: [PRIV, TENC]\n" +
+				"artists:\n" +
+				"  my artist:\n" +
+				"    allow: [APIC]\n" +
+				"    require: [APIC]\n",
+			want: &framePolicies{
+				Library: framePolicyEntry{Deny: []string{"PRIV", "TENC"}},
+				Artists: map[string]framePolicyEntry{
+					"my artist": {Allow: []string{"APIC"}, Require: []string{"APIC"}},
+				},
+			},
+		},
+		"invalid policies": {
+			content: "" +
+				"library:\n" +
+				"  deny: [TIT2]\n" +
+				"artists:\n" +
+				"  b:\n" +
+				"    allow: [APIC]\n" +
+				"    deny: [PRIV]\n" +
+				"  a:\n" +
+				"    require: [apic]\n",
+			wantErr: true,
+			errorMsg: "" +
+				"library: the TIT2 frame holds metadata and cannot be denied\n" +
+				"artist \"a\": \"apic\" is not a valid ID3V2 frame identifier\n" +
+				"artist \"b\": a frame policy cannot have both allowed and denied frames",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			readFile = func(_ string) ([]byte, error) {
+				return []byte(tt.content), tt.readErr
+			}
+			got, gotErr := loadFramePolicies("f.yaml")
+			if (gotErr != nil) != tt.wantErr {
+				t.Errorf("loadFramePolicies() error = %v, wantErr %v", gotErr, tt.wantErr)
+				return
+			}
+			if gotErr != nil && tt.errorMsg != "" && gotErr.Error() != tt.errorMsg {
+				t.Errorf("loadFramePolicies() error = %q, want %q", gotErr.Error(), tt.errorMsg)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadFramePolicies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_evaluateFramePolicies(t *testing.T) {
+	originalReadFile := readFile
+	defer func() {
+		readFile = originalReadFile
+	}()
+	readFile = func(path string) ([]byte, error) {
+		if path == "good.yaml" {
+			return []byte("library:\n  deny: [PRIV]\n"), nil
+		}
+		return []byte("library:\n  deny: [TALB]\n"), nil
+	}
+	tests := map[string]struct {
+		values map[string]*cmdtoolkit.CommandFlag[any]
+		want   *framePolicies
+		want1  bool
+		output.WantedRecording
+	}{
+		"missing": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{},
+			want1:  false,
+			WantedRecording: output.WantedRecording{
+				Error: "An internal error occurred: flag \"framePolicy\" is not found.\n",
+				Log: "" +
+					"level='error'" +
+					" error='flag not found'" +
+					" flag='framePolicy'" +
+					" msg='internal error'\n",
+			},
+		},
+		"unset": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{"framePolicy": {Value: ""}},
+			want1:  true,
+		},
+		"good": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				"framePolicy": {Value: "good.yaml", UserSet: true},
+			},
+			want:  &framePolicies{Library: framePolicyEntry{Deny: []string{"PRIV"}}},
+			want1: true,
+		},
+		"bad": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				"framePolicy": {Value: "bad.yaml", UserSet: true},
+			},
+			want1: false,
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"The --framePolicy value \"bad.yaml\" cannot be used.\n" +
+					"Why?\n" +
+					"The file cannot be read or is not valid: '*errors.joinError: library: the TALB frame holds " +
+					"metadata and cannot be denied'.\n" +
+					"What to do:\n" +
+					"Provide a YAML file containing a library frame policy and, optionally, frame policies for " +
+					"individual artists; each policy may list allowed or denied frames, and required frames.\n",
+				Log: "" +
+					"level='error'" +
+					" --framePolicy='bad.yaml'" +
+					" error='library: the TALB frame holds metadata and cannot be denied'" +
+					" user-set='true'" +
+					" msg='invalid frame policy'\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			got, got1 := evaluateFramePolicies(o, tt.values)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evaluateFramePolicies() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("evaluateFramePolicies() got1 = %v, want %v", got1, tt.want1)
+			}
+			o.Report(t, "evaluateFramePolicies()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_framePolicies_forArtist(t *testing.T) {
+	fp := &framePolicies{
+		Library: framePolicyEntry{Deny: []string{"PRIV"}},
+		Artists: map[string]framePolicyEntry{
+			"picky artist": {Allow: []string{"APIC"}, Require: []string{"APIC"}},
+		},
+	}
+	tests := map[string]struct {
+		name string
+		want files.FramePolicy
+	}{
+		"library": {
+			name: "any artist",
+			want: files.FramePolicy{Deny: []string{"PRIV"}},
+		},
+		"artist": {
+			name: "picky artist",
+			want: files.FramePolicy{Allow: []string{"APIC"}, Require: []string{"APIC"}},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := fp.forArtist(tt.name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("framePolicies.forArtist() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
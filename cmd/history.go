@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"fmt"
+	"mp3repair/internal/files"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+
+	"github.com/majohn-r/output"
+	"github.com/spf13/cobra"
+)
+
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+const (
+	historyCommandName = "history"
+	historyAlbum       = "album"
+	historyAlbumFlag   = "--" + historyAlbum
+	historyArtist      = "artist"
+	historyArtistFlag  = "--" + historyArtist
+	historyField       = "field"
+	historyFieldFlag   = "--" + historyField
+	historyFrom        = "from"
+	historyFromFlag    = "--" + historyFrom
+	historyTo          = "to"
+	historyToFlag      = "--" + historyTo
+	historyTrack       = "track"
+	historyTrackFlag   = "--" + historyTrack
+	historyDateLayout  = "2006-01-02"
+	historyTimeLayout  = "2006-01-02 15:04:05"
+)
+
+var (
+	historyCmd = &cobra.Command{
+		Use: historyCommandName + " [" + historyArtistFlag + " regex] [" + historyAlbumFlag + " regex] [" +
+			historyTrackFlag + " regex] [" + historyFieldFlag + " field] [" + historyFromFlag + " date] [" +
+			historyToFlag + " date]",
+		DisableFlagsInUseLine: true,
+		Short: "Lists the metadata changes recorded by the " + rewriteCommandName + " and " + revertCommandName +
+			" commands",
+		Long: "" +
+			fmt.Sprintf("%q lists the metadata changes recorded in the audit log\n", historyCommandName) +
+			"\n" +
+			"Each time the " + rewriteCommandName + " or " + revertCommandName +
+			" command changes a field of a track's ID3V1 or\n" +
+			"ID3V2 metadata, it appends the time, the user, the track's path, the source,\n" +
+			"the field, and the old and new values to the audit log, " + auditLogFile + ", in\n" +
+			"the application data directory. The artist, album, and track filters are\n" +
+			"regular expressions matched against the names recorded in the log; the\n" +
+			"dates (YYYY-MM-DD) are inclusive.",
+		Example: historyCommandName + " " + historyArtistFlag + " \"^The Beatles$\" " + historyAlbumFlag +
+			" \"^Abbey Road$\" " + historyFieldFlag + " year\n" +
+			"  Lists every change to the year of the tracks on the Beatles' Abbey Road\n" +
+			historyCommandName + " " + historyFromFlag + " 2026-10-01 " + historyToFlag + " 2026-10-31\n" +
+			"  Lists every change made in October 2026",
+		RunE: historyRun,
+	}
+	historyFlags = &cmdtoolkit.FlagSet{
+		Name: historyCommandName,
+		Details: map[string]*cmdtoolkit.FlagDetails{
+			historyArtist: {
+				Usage:        "regular expression specifying which artists to list changes for; if empty, all artists",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			historyAlbum: {
+				Usage:        "regular expression specifying which albums to list changes for; if empty, all albums",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			historyTrack: {
+				Usage:        "regular expression specifying which tracks to list changes for; if empty, all tracks",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			historyField: {
+				Usage: "the field to list changes for: one of " + strings.Join(files.MetadataFieldNames(), ", ") +
+					"; if empty, all fields",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			historyFrom: {
+				Usage:        "the earliest date (YYYY-MM-DD) to list changes for; if empty, the log's beginning",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			historyTo: {
+				Usage:        "the latest date (YYYY-MM-DD) to list changes for; if empty, the present",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+		},
+	}
+)
+
+func historyRun(cmd *cobra.Command, _ []string) error {
+	exitError := cmdtoolkit.NewExitProgrammingError(historyCommandName)
+	o := getBus()
+	values, eSlice := cmdtoolkit.ReadFlags(cmd.Flags(), historyFlags)
+	if cmdtoolkit.ProcessFlagErrors(o, eSlice) {
+		if hs, flagsOk := processHistoryFlags(o, values); flagsOk {
+			exitError = hs.listChanges(o)
+		}
+	}
+	return cmdtoolkit.ToErrorInterface(exitError)
+}
+
+type historySettings struct {
+	artist *regexp.Regexp
+	album  *regexp.Regexp
+	track  *regexp.Regexp
+	field  string
+	// from and to bound the dates; to is exclusive, and either may be zero
+	from time.Time
+	to   time.Time
+}
+
+func (hs *historySettings) matches(entry auditEntry) bool {
+	switch {
+	case hs.artist != nil && !hs.artist.MatchString(entry.Artist):
+		return false
+	case hs.album != nil && !hs.album.MatchString(entry.Album):
+		return false
+	case hs.track != nil && !hs.track.MatchString(entry.Track):
+		return false
+	case hs.field != "" && hs.field != entry.Field:
+		return false
+	case !hs.from.IsZero() && entry.Time.Before(hs.from):
+		return false
+	case !hs.to.IsZero() && !entry.Time.Before(hs.to):
+		return false
+	default:
+		return true
+	}
+}
+
+// isUnfiltered returns true if the settings select every entry
+func (hs *historySettings) isUnfiltered() bool {
+	return hs.artist == nil && hs.album == nil && hs.track == nil && hs.field == "" && hs.from.IsZero() &&
+		hs.to.IsZero()
+}
+
+func (hs *historySettings) listChanges(o output.Bus) *cmdtoolkit.ExitError {
+	path := auditLogPath()
+	entries, readErr := readAuditLog(path)
+	if readErr != nil {
+		o.ErrorPrintf("The audit log %q cannot be read: %s.\n", path, cmdtoolkit.ErrorToString(readErr))
+		o.Log(output.Error, "cannot read audit log", map[string]any{
+			"command":  historyCommandName,
+			"auditLog": path,
+			"error":    readErr,
+		})
+		if len(entries) == 0 {
+			return cmdtoolkit.NewExitSystemError(historyCommandName)
+		}
+	}
+	var selected []auditEntry
+	for _, entry := range entries {
+		if hs.matches(entry) {
+			selected = append(selected, entry)
+		}
+	}
+	slices.SortStableFunc(selected, func(a, b auditEntry) int {
+		return a.Time.Compare(b.Time)
+	})
+	if len(selected) == 0 {
+		o.ConsolePrintln("No recorded metadata changes match the specified filters.")
+		return nil
+	}
+	for _, entry := range selected {
+		who := ""
+		if entry.User != "" {
+			who = " by " + entry.User
+		}
+		o.ConsolePrintf("%s%s: %q %s %s changed from %q to %q\n", entry.Time.Local().Format(historyTimeLayout), who,
+			entry.Path, entry.Source, entry.Field, entry.OldValue, entry.NewValue)
+	}
+	o.ConsolePrintf("Changes listed: %d.\n", len(selected))
+	if readErr != nil {
+		return cmdtoolkit.NewExitSystemError(historyCommandName)
+	}
+	return nil
+}
+
+func processHistoryFlags(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any]) (*historySettings, bool) {
+	hs := &historySettings{}
+	flagsOk := true // optimistic
+	var filterOk bool
+	if hs.artist, filterOk = evaluateHistoryFilter(o, values, historyArtist); !filterOk {
+		flagsOk = false
+	}
+	if hs.album, filterOk = evaluateHistoryFilter(o, values, historyAlbum); !filterOk {
+		flagsOk = false
+	}
+	if hs.track, filterOk = evaluateHistoryFilter(o, values, historyTrack); !filterOk {
+		flagsOk = false
+	}
+	if field, fieldOk := evaluateHistoryField(o, values); fieldOk {
+		hs.field = field
+	} else {
+		flagsOk = false
+	}
+	var dateOk bool
+	if hs.from, dateOk = evaluateHistoryDate(o, values, historyFrom); !dateOk {
+		flagsOk = false
+	}
+	if hs.to, dateOk = evaluateHistoryDate(o, values, historyTo); dateOk {
+		if !hs.to.IsZero() {
+			// include the whole of the last day
+			hs.to = hs.to.AddDate(0, 0, 1)
+		}
+	} else {
+		flagsOk = false
+	}
+	if flagsOk && !hs.from.IsZero() && !hs.to.IsZero() && !hs.from.Before(hs.to) {
+		o.ErrorPrintf("The %s and %s values cannot be used together.\n", historyFromFlag, historyToFlag)
+		o.ErrorPrintln("Why?")
+		o.ErrorPrintf("The %s date is later than the %s date.\n", historyFromFlag, historyToFlag)
+		o.ErrorPrintln("What to do:")
+		o.ErrorPrintf("Use a %s date that is no later than the %s date.\n", historyFromFlag, historyToFlag)
+		o.Log(output.Error, "invalid date range", map[string]any{
+			historyFromFlag: hs.from.Format(historyDateLayout),
+			historyToFlag:   hs.to.AddDate(0, 0, -1).Format(historyDateLayout),
+		})
+		flagsOk = false
+	}
+	return hs, flagsOk
+}
+
+func evaluateHistoryFilter(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any],
+	name string) (*regexp.Regexp, bool) {
+	rawValue, flagErr := cmdtoolkit.GetString(o, values, name)
+	if flagErr != nil {
+		return nil, false
+	}
+	if rawValue.Value == "" {
+		return nil, true
+	}
+	filter, regexErr := regexp.Compile(rawValue.Value)
+	if regexErr != nil {
+		o.ErrorPrintf("The --%s value %q cannot be used.\n", name, rawValue.Value)
+		o.ErrorPrintln("Why?")
+		o.ErrorPrintf("The value cannot be parsed as a regular expression: %s.\n",
+			cmdtoolkit.ErrorToString(regexErr))
+		o.ErrorPrintln("What to do:")
+		o.ErrorPrintln(searchRegexInstructions)
+		o.Log(output.Error, "the filter cannot be parsed as a regular expression", map[string]any{
+			"--" + name: rawValue.Value,
+			"error":     regexErr,
+		})
+		return nil, false
+	}
+	return filter, true
+}
+
+func evaluateHistoryField(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any]) (string, bool) {
+	rawValue, flagErr := cmdtoolkit.GetString(o, values, historyField)
+	if flagErr != nil {
+		return "", false
+	}
+	if rawValue.Value == "" {
+		return "", true
+	}
+	if _, found := files.LookupMetadataField(rawValue.Value); !found {
+		o.ErrorPrintf("The %s value %q cannot be used.\n", historyFieldFlag, rawValue.Value)
+		o.ErrorPrintln("Why?")
+		o.ErrorPrintln("The value is not a known metadata field.")
+		o.ErrorPrintln("What to do:")
+		o.ErrorPrintf("Use one of these values: %s.\n", strings.Join(files.MetadataFieldNames(), ", "))
+		o.Log(output.Error, "invalid field", map[string]any{
+			historyFieldFlag: rawValue.Value,
+			"user-set":       rawValue.UserSet,
+		})
+		return "", false
+	}
+	return rawValue.Value, true
+}
+
+func evaluateHistoryDate(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any], name string) (time.Time,
+	bool) {
+	rawValue, flagErr := cmdtoolkit.GetString(o, values, name)
+	if flagErr != nil {
+		return time.Time{}, false
+	}
+	if rawValue.Value == "" {
+		return time.Time{}, true
+	}
+	date, parseErr := time.ParseInLocation(historyDateLayout, rawValue.Value, time.Local)
+	if parseErr != nil {
+		o.ErrorPrintf("The --%s value %q cannot be used.\n", name, rawValue.Value)
+		o.ErrorPrintln("Why?")
+		o.ErrorPrintln("The value is not a date formatted as YYYY-MM-DD.")
+		o.ErrorPrintln("What to do:")
+		o.ErrorPrintln("Use a value such as 2026-10-18.")
+		o.Log(output.Error, "invalid date", map[string]any{
+			"--" + name: rawValue.Value,
+			"user-set":  rawValue.UserSet,
+		})
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	cmdtoolkit.AddDefaults(historyFlags)
+	cmdtoolkit.AddFlags(getBus(), getConfiguration(), historyCmd.Flags(), historyFlags)
+}
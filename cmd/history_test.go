@@ -0,0 +1,314 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+func historyFlagValues(artist, album, track, field, from, to string) map[string]*cmdtoolkit.CommandFlag[any] {
+	return map[string]*cmdtoolkit.CommandFlag[any]{
+		"artist": {Value: artist},
+		"album":  {Value: album},
+		"track":  {Value: track},
+		"field":  {Value: field},
+		"from":   {Value: from},
+		"to":     {Value: to},
+	}
+}
+
+func Test_processHistoryFlags(t *testing.T) {
+	tests := map[string]struct {
+		values map[string]*cmdtoolkit.CommandFlag[any]
+		want   *historySettings
+		want1  bool
+		output.WantedRecording
+	}{
+		"defaults": {
+			values: historyFlagValues("", "", "", "", "", ""),
+			want:   &historySettings{},
+			want1:  true,
+		},
+		"everything": {
+			values: historyFlagValues("^a$", "^b$", "^c$", "year", "2026-10-01", "2026-10-31"),
+			want: &historySettings{
+				artist: regexp.MustCompile("^a$"),
+				album:  regexp.MustCompile("^b$"),
+				track:  regexp.MustCompile("^c$"),
+				field:  "year",
+				from:   time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local),
+				to:     time.Date(2026, 11, 1, 0, 0, 0, 0, time.Local),
+			},
+			want1: true,
+		},
+		"one day": {
+			values: historyFlagValues("", "", "", "", "2026-10-18", "2026-10-18"),
+			want: &historySettings{
+				from: time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local),
+				to:   time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local),
+			},
+			want1: true,
+		},
+		"bad values": {
+			values: historyFlagValues("[", "", "", "composer", "yesterday", ""),
+			want:   &historySettings{},
+			want1:  false,
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"The --artist value \"[\" cannot be used.\n" +
+					"Why?\n" +
+					"The value cannot be parsed as a regular expression: " +
+					"'*syntax.Error: error parsing regexp: missing closing ]: `[`'.\n" +
+					"What to do:\n" +
+					searchRegexInstructions + "\n" +
+					"The --field value \"composer\" cannot be used.\n" +
+					"Why?\n" +
+					"The value is not a known metadata field.\n" +
+					"What to do:\n" +
+					"Use one of these values: album, artist, genre, mcdi, number, title, year.\n" +
+					"The --from value \"yesterday\" cannot be used.\n" +
+					"Why?\n" +
+					"The value is not a date formatted as YYYY-MM-DD.\n" +
+					"What to do:\n" +
+					"Use a value such as 2026-10-18.\n",
+				Log: "" +
+					"level='error'" +
+					" --artist='['" +
+					" error='error parsing regexp: missing closing ]: `[`'" +
+					" msg='the filter cannot be parsed as a regular expression'\n" +
+					"level='error'" +
+					" --field='composer'" +
+					" user-set='false'" +
+					" msg='invalid field'\n" +
+					"level='error'" +
+					" --from='yesterday'" +
+					" user-set='false'" +
+					" msg='invalid date'\n",
+			},
+		},
+		"backwards range": {
+			values: historyFlagValues("", "", "", "", "2026-10-18", "2026-10-17"),
+			want: &historySettings{
+				from: time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local),
+				to:   time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local),
+			},
+			want1: false,
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"The --from and --to values cannot be used together.\n" +
+					"Why?\n" +
+					"The --from date is later than the --to date.\n" +
+					"What to do:\n" +
+					"Use a --from date that is no later than the --to date.\n",
+				Log: "" +
+					"level='error'" +
+					" --from='2026-10-18'" +
+					" --to='2026-10-17'" +
+					" msg='invalid date range'\n",
+			},
+		},
+		"missing flags": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{},
+			want:   &historySettings{},
+			want1:  false,
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"An internal error occurred: flag \"artist\" is not found.\n" +
+					"An internal error occurred: flag \"album\" is not found.\n" +
+					"An internal error occurred: flag \"track\" is not found.\n" +
+					"An internal error occurred: flag \"field\" is not found.\n" +
+					"An internal error occurred: flag \"from\" is not found.\n" +
+					"An internal error occurred: flag \"to\" is not found.\n",
+				Log: "" +
+					"level='error' error='flag not found' flag='artist' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='album' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='track' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='field' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='from' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='to' msg='internal error'\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			got, got1 := processHistoryFlags(o, tt.values)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("processHistoryFlags() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("processHistoryFlags() got1 = %v, want %v", got1, tt.want1)
+			}
+			o.Report(t, "processHistoryFlags()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_historySettings_listChanges(t *testing.T) {
+	originalApplicationPath := applicationPath
+	originalReadFile := readFile
+	defer func() {
+		applicationPath = originalApplicationPath
+		readFile = originalReadFile
+	}()
+	applicationPath = func() string { return "appData" }
+	path := filepath.Join("appData", auditLogFile)
+	day1 := time.Date(2026, 10, 17, 2, 0, 0, 0, time.Local)
+	day2 := time.Date(2026, 10, 18, 2, 0, 0, 0, time.Local)
+	log := "" +
+		fmt.Sprintf(`{"time":%q,"user":"marc","path":"p2","artist":"a","album":"b","track":"t2","source":"ID3V2",`+
+			`"field":"year","old":"2001","new":"1999"}`, day2.Format(time.RFC3339)) + "\n" +
+		fmt.Sprintf(`{"time":%q,"path":"p1","artist":"a","album":"b","track":"t1","source":"ID3V1",`+
+			`"field":"genre","old":"Pop","new":"Rock"}`, day1.Format(time.RFC3339)) + "\n" +
+		fmt.Sprintf(`{"time":%q,"path":"p3","artist":"z","album":"y","track":"x","source":"ID3V1",`+
+			`"field":"year","old":"1","new":"2"}`, day1.Format(time.RFC3339)) + "\n"
+	tests := map[string]struct {
+		hs      *historySettings
+		content string
+		readErr error
+		wantErr bool
+		output.WantedRecording
+	}{
+		"all": {
+			hs:      &historySettings{},
+			content: log,
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"2026-10-17 02:00:00: \"p1\" ID3V1 genre changed from \"Pop\" to \"Rock\"\n" +
+					"2026-10-17 02:00:00: \"p3\" ID3V1 year changed from \"1\" to \"2\"\n" +
+					"2026-10-18 02:00:00 by marc: \"p2\" ID3V2 year changed from \"2001\" to \"1999\"\n" +
+					"Changes listed: 3.\n",
+			},
+		},
+		"filtered": {
+			hs: &historySettings{
+				artist: regexp.MustCompile("^a$"),
+				field:  "year",
+				from:   time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local),
+			},
+			content: log,
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"2026-10-18 02:00:00 by marc: \"p2\" ID3V2 year changed from \"2001\" to \"1999\"\n" +
+					"Changes listed: 1.\n",
+			},
+		},
+		"nothing matches": {
+			hs:      &historySettings{to: time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)},
+			content: log,
+			WantedRecording: output.WantedRecording{
+				Console: "No recorded metadata changes match the specified filters.\n",
+			},
+		},
+		"unreadable": {
+			hs:      &historySettings{},
+			readErr: errors.New("access denied"),
+			wantErr: true,
+			WantedRecording: output.WantedRecording{
+				Error: fmt.Sprintf("The audit log %q cannot be read: 'access denied'.\n", path),
+				Log: "" +
+					"level='error'" +
+					" auditLog='" + path + "'" +
+					" command='history'" +
+					" error='access denied'" +
+					" msg='cannot read audit log'\n",
+			},
+		},
+		"partly corrupt": {
+			hs:      &historySettings{track: regexp.MustCompile("^x$")},
+			content: "garbage\n" + log,
+			wantErr: true,
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"2026-10-17 02:00:00: \"p3\" ID3V1 year changed from \"1\" to \"2\"\n" +
+					"Changes listed: 1.\n",
+				Error: fmt.Sprintf("The audit log %q cannot be read: '*errors.joinError: line 1: invalid "+
+					"character 'g' looking for beginning of value'.\n", path),
+				Log: "" +
+					"level='error'" +
+					" auditLog='" + path + "'" +
+					" command='history'" +
+					" error='line 1: invalid character 'g' looking for beginning of value'" +
+					" msg='cannot read audit log'\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			readFile = func(string) ([]byte, error) {
+				return []byte(tt.content), tt.readErr
+			}
+			o := output.NewRecorder()
+			if got := tt.hs.listChanges(o); (got != nil) != tt.wantErr {
+				t.Errorf("historySettings.listChanges() = %v, wantErr %v", got, tt.wantErr)
+			}
+			o.Report(t, "historySettings.listChanges()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_history_Help(t *testing.T) {
+	commandUnderTest := cloneCommand(historyCmd)
+	cmdtoolkit.AddFlags(output.NewNilBus(), cmdtoolkit.EmptyConfiguration(),
+		commandUnderTest.Flags(), historyFlags)
+	tests := map[string]struct {
+		output.WantedRecording
+	}{
+		"good": {
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"\"history\" lists the metadata changes recorded in the audit log\n" +
+					"\n" +
+					"Each time the rewrite or revert command changes a field of a track's ID3V1 or\n" +
+					"ID3V2 metadata, it appends the time, the user, the track's path, the source,\n" +
+					"the field, and the old and new values to the audit log, audit.jsonl, in\n" +
+					"the application data directory. The artist, album, and track filters are\n" +
+					"regular expressions matched against the names recorded in the log; the\n" +
+					"dates (YYYY-MM-DD) are inclusive.\n" +
+					"\n" +
+					"Usage:\n" +
+					"  history [--artist regex] [--album regex] [--track regex] [--field field] [--from date] [--to " +
+					"date]\n" +
+					"\n" +
+					"Examples:\n" +
+					"history --artist \"^The Beatles$\" --album \"^Abbey Road$\" --field year\n" +
+					"  Lists every change to the year of the tracks on the Beatles' Abbey Road\n" +
+					"history --from 2026-10-01 --to 2026-10-31\n" +
+					"  Lists every change made in October 2026\n" +
+					"\n" +
+					"Flags:\n" +
+					"      --album string    regular expression specifying which albums to list changes for; if empty, " +
+					"all albums (default \"\")\n" +
+					"      --artist string   regular expression specifying which artists to list changes for; if empty, " +
+					"all artists (default \"\")\n" +
+					"      --field string    the field to list changes for: one of album, artist, genre, mcdi, number, " +
+					"title, year; if empty, all fields (default \"\")\n" +
+					"      --from string     the earliest date (YYYY-MM-DD) to list changes for; if empty, the log's " +
+					"beginning (default \"\")\n" +
+					"      --to string       the latest date (YYYY-MM-DD) to list changes for; if empty, the present " +
+					"(default \"\")\n" +
+					"      --track string    regular expression specifying which tracks to list changes for; if empty, " +
+					"all tracks (default \"\")\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			enableCommandRecording(o, commandUnderTest)
+			_ = commandUnderTest.Help()
+			o.Report(t, "history Help()", tt.WantedRecording)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"mp3repair/internal/files"
+	"strings"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+const (
+	id3v2Encoding     = "id3v2Encoding"
+	id3v2EncodingFlag = "--" + id3v2Encoding
+	id3v2Version      = "id3v2Version"
+	id3v2VersionFlag  = "--" + id3v2Version
+	id3v2Keep         = "keep"
+	id3v2Version3     = "2.3"
+	id3v2Version4     = "2.4"
+	id3v2ISO          = "iso-8859-1"
+	id3v2UTF16        = "utf-16"
+	id3v2UTF8         = "utf-8"
+	id3v2Usage        = "[" + id3v2VersionFlag + " version] [" + id3v2EncodingFlag + " encoding]"
+)
+
+var (
+	id3v2VersionChoices = []string{id3v2Keep, id3v2Version3, id3v2Version4}
+	// id3v2Versions maps the id3v2Version values to ID3V2 major versions
+	id3v2Versions        = map[string]byte{id3v2Keep: 0, id3v2Version3: 3, id3v2Version4: 4}
+	id3v2EncodingChoices = []string{id3v2Keep, id3v2ISO, id3v2UTF16, id3v2UTF8}
+	// id3v2Encodings maps the id3v2Encoding values to ID3V2 text encodings
+	id3v2Encodings = map[string]string{
+		id3v2Keep:  files.KeepEncoding,
+		id3v2ISO:   files.ISOEncoding,
+		id3v2UTF16: files.UTF16Encoding,
+		id3v2UTF8:  files.UTF8Encoding,
+	}
+	id3v2Flags = &cmdtoolkit.FlagSet{
+		Name: "id3v2",
+		Details: map[string]*cmdtoolkit.FlagDetails{
+			id3v2Version: {
+				Usage: fmt.Sprintf("ID3V2 version of rewritten tags: %s (each tag's own version), %s, or %s",
+					id3v2Keep, id3v2Version3, id3v2Version4),
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: id3v2Keep,
+			},
+			id3v2Encoding: {
+				Usage: fmt.Sprintf("text encoding of rewritten ID3V2 tags: %s (each frame's own encoding), %s, %s,"+
+					" or %s (%s only)", id3v2Keep, id3v2ISO, id3v2UTF16, id3v2UTF8, id3v2Version4),
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: id3v2Keep,
+			},
+		},
+	}
+)
+
+type id3v2Settings struct {
+	policy files.ID3V2Conversion
+}
+
+func evaluateID3V2Flags(o output.Bus, producer cmdtoolkit.FlagProducer) (*id3v2Settings, bool) {
+	values, eSlice := cmdtoolkit.ReadFlags(producer, id3v2Flags)
+	if cmdtoolkit.ProcessFlagErrors(o, eSlice) {
+		return processID3V2Flags(o, values)
+	}
+	return &id3v2Settings{}, false
+}
+
+func processID3V2Flags(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any]) (*id3v2Settings, bool) {
+	settings := &id3v2Settings{}
+	flagsOk := true // optimistic
+	version, versionOk := evaluateChoice(o, values, id3v2Version, id3v2VersionFlag, id3v2VersionChoices)
+	if versionOk {
+		settings.policy.Version = id3v2Versions[version]
+	} else {
+		flagsOk = false
+	}
+	encoding, encodingOk := evaluateChoice(o, values, id3v2Encoding, id3v2EncodingFlag, id3v2EncodingChoices)
+	if encodingOk {
+		settings.policy.Encoding = id3v2Encodings[encoding]
+	} else {
+		flagsOk = false
+	}
+	if versionOk && encodingOk && version == id3v2Version3 && encoding == id3v2UTF8 {
+		o.ErrorPrintf("The %s value %q cannot be used with the %s value %q.\n", id3v2EncodingFlag, encoding,
+			id3v2VersionFlag, version)
+		o.ErrorPrintln("Why?")
+		o.ErrorPrintf("ID3V2 version %s does not support the %s encoding.\n", version,
+			strings.ToUpper(encoding))
+		o.ErrorPrintln("What to do:")
+		o.ErrorPrintf("Use %s %s, or use a different encoding.\n", id3v2VersionFlag, id3v2Version4)
+		o.Log(output.Error, "incompatible values", map[string]any{
+			id3v2EncodingFlag: encoding,
+			id3v2VersionFlag:  version,
+		})
+		flagsOk = false
+	}
+	return settings, flagsOk
+}
+
+// apply sets the ID3V2 version and text encoding used when ID3V2 tags are
+// written, and against which scanned ID3V2 tags are checked
+func (is *id3v2Settings) apply() {
+	setID3V2Policy(is.policy)
+}
+
+func init() {
+	cmdtoolkit.AddDefaults(id3v2Flags)
+}
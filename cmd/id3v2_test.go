@@ -0,0 +1,110 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"mp3repair/internal/files"
+	"reflect"
+	"testing"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+func Test_processID3V2Flags(t *testing.T) {
+	tests := map[string]struct {
+		values map[string]*cmdtoolkit.CommandFlag[any]
+		want   *id3v2Settings
+		want1  bool
+		output.WantedRecording
+	}{
+		"no data": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{},
+			want:   &id3v2Settings{},
+			want1:  false,
+			WantedRecording: output.WantedRecording{
+				Error: "An internal error occurred: flag \"id3v2Version\" is not found.\n" +
+					"An internal error occurred: flag \"id3v2Encoding\" is not found.\n",
+				Log: "level='error' error='flag not found' flag='id3v2Version' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='id3v2Encoding' msg='internal error'\n",
+			},
+		},
+		"defaults": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				id3v2Version:  {Value: id3v2Keep},
+				id3v2Encoding: {Value: id3v2Keep},
+			},
+			want:  &id3v2Settings{policy: files.ID3V2Conversion{Encoding: files.KeepEncoding}},
+			want1: true,
+		},
+		"ID3V2.3 with ISO-8859-1": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				id3v2Version:  {Value: "2.3"},
+				id3v2Encoding: {Value: "ISO-8859-1"},
+			},
+			want:  &id3v2Settings{policy: files.ID3V2Conversion{Version: 3, Encoding: files.ISOEncoding}},
+			want1: true,
+		},
+		"ID3V2.4 with UTF-8": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				id3v2Version:  {Value: "2.4"},
+				id3v2Encoding: {Value: "utf-8"},
+			},
+			want:  &id3v2Settings{policy: files.ID3V2Conversion{Version: 4, Encoding: files.UTF8Encoding}},
+			want1: true,
+		},
+		"bad values": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				id3v2Version:  {Value: "2.2"},
+				id3v2Encoding: {Value: "ascii", UserSet: true},
+			},
+			want:  &id3v2Settings{},
+			want1: false,
+			WantedRecording: output.WantedRecording{
+				Error: "The --id3v2Version value \"2.2\" cannot be used.\n" +
+					"Why?\n" +
+					"The value is not one of the supported values.\n" +
+					"What to do:\n" +
+					"Use one of these values: keep, 2.3, 2.4.\n" +
+					"The --id3v2Encoding value \"ascii\" cannot be used.\n" +
+					"Why?\n" +
+					"The value is not one of the supported values.\n" +
+					"What to do:\n" +
+					"Use one of these values: keep, iso-8859-1, utf-16, utf-8.\n",
+				Log: "level='error' --id3v2Version='2.2' user-set='false' msg='invalid value'\n" +
+					"level='error' --id3v2Encoding='ascii' user-set='true' msg='invalid value'\n",
+			},
+		},
+		"UTF-8 in ID3V2.3": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				id3v2Version:  {Value: "2.3"},
+				id3v2Encoding: {Value: "utf-8"},
+			},
+			want:  &id3v2Settings{policy: files.ID3V2Conversion{Version: 3, Encoding: files.UTF8Encoding}},
+			want1: false,
+			WantedRecording: output.WantedRecording{
+				Error: "The --id3v2Encoding value \"utf-8\" cannot be used with the --id3v2Version value \"2.3\".\n" +
+					"Why?\n" +
+					"ID3V2 version 2.3 does not support the UTF-8 encoding.\n" +
+					"What to do:\n" +
+					"Use --id3v2Version 2.4, or use a different encoding.\n",
+				Log: "level='error' --id3v2Encoding='utf-8' --id3v2Version='2.3' msg='incompatible values'\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			got, got1 := processID3V2Flags(o, tt.values)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("processID3V2Flags() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("processID3V2Flags() got1 = %v, want %v", got1, tt.want1)
+			}
+			o.Report(t, "processID3V2Flags()", tt.WantedRecording)
+		})
+	}
+}
@@ -109,6 +109,7 @@ var (
 func listRun(cmd *cobra.Command, _ []string) error {
 	exitError := cmdtoolkit.NewExitProgrammingError(listCommand)
 	o := getBus()
+	ctx := commandContext(cmd)
 	producer := cmd.Flags()
 	values, eSlice := cmdtoolkit.ReadFlags(producer, listFlags)
 	searchSettings, searchFlagsOk := evaluateSearchFlags(o, producer)
@@ -118,7 +119,7 @@ func listRun(cmd *cobra.Command, _ []string) error {
 			case true:
 				switch ls.tracksSortable(o) {
 				case true:
-					allArtists := searchSettings.load(o)
+					allArtists := searchSettings.load(ctx, o)
 					exitError = ls.listArtists(o, allArtists, searchSettings)
 				case false:
 					exitError = cmdtoolkit.NewExitUserError(listCommand)
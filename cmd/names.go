@@ -0,0 +1,153 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"mp3repair/internal/files"
+	"strings"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+const (
+	namesAliases              = "aliases"
+	namesAliasesFlag          = "--" + namesAliases
+	namesAmpersand            = "ampersand"
+	namesAmpersandFlag        = "--" + namesAmpersand
+	namesFoldCase             = "foldCase"
+	namesFoldCaseFlag         = "--" + namesFoldCase
+	namesInvertArticles       = "invertArticles"
+	namesInvertArticlesFlag   = "--" + namesInvertArticles
+	namesNormalizeUnicode     = "normalizeUnicode"
+	namesNormalizeUnicodeFlag = "--" + namesNormalizeUnicode
+	namesUsage                = "[" + namesAliasesFlag + " aliases] [" + namesAmpersandFlag + "] [" +
+		namesFoldCaseFlag + "] [" + namesInvertArticlesFlag + "] [" + namesNormalizeUnicodeFlag + "]"
+)
+
+var (
+	namesFlags = &cmdtoolkit.FlagSet{
+		Name: "names",
+		Details: map[string]*cmdtoolkit.FlagDetails{
+			namesAliases: {
+				Usage:        "semicolon-delimited list of alias=preferred name pairs for artist and album names",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			namesAmpersand: {
+				Usage:        "treat '&' and 'and' as equal in artist and album names",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+			namesFoldCase: {
+				Usage:        "treat artist and album names differing only in letter case as equal",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+			namesInvertArticles: {
+				Usage:        "treat artist and album names such as 'Beatles, The' and 'The Beatles' as equal",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+			namesNormalizeUnicode: {
+				Usage:        "treat the NFC and NFD forms of artist and album names as equal",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+		},
+	}
+)
+
+type namesSettings struct {
+	equivalence files.NameEquivalence
+}
+
+func evaluateNamesFlags(o output.Bus, producer cmdtoolkit.FlagProducer) (*namesSettings, bool) {
+	values, eSlice := cmdtoolkit.ReadFlags(producer, namesFlags)
+	if cmdtoolkit.ProcessFlagErrors(o, eSlice) {
+		return processNamesFlags(o, values)
+	}
+	return &namesSettings{}, false
+}
+
+func processNamesFlags(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any]) (*namesSettings, bool) {
+	settings := &namesSettings{}
+	flagsOk := true // optimistic
+	if flag, flagErr := cmdtoolkit.GetBool(o, values, namesAmpersand); flagErr == nil {
+		settings.equivalence.Ampersand = flag.Value
+	} else {
+		flagsOk = false
+	}
+	if flag, flagErr := cmdtoolkit.GetBool(o, values, namesFoldCase); flagErr == nil {
+		settings.equivalence.FoldCase = flag.Value
+	} else {
+		flagsOk = false
+	}
+	if flag, flagErr := cmdtoolkit.GetBool(o, values, namesInvertArticles); flagErr == nil {
+		settings.equivalence.InvertArticles = flag.Value
+	} else {
+		flagsOk = false
+	}
+	if flag, flagErr := cmdtoolkit.GetBool(o, values, namesNormalizeUnicode); flagErr == nil {
+		settings.equivalence.NormalizeUnicode = flag.Value
+	} else {
+		flagsOk = false
+	}
+	if aliases, aliasesOk := evaluateAliases(o, values); aliasesOk {
+		settings.equivalence.Aliases = aliases
+	} else {
+		flagsOk = false
+	}
+	return settings, flagsOk
+}
+
+func evaluateAliases(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any]) (map[string]string, bool) {
+	rawValue, flagErr := cmdtoolkit.GetString(o, values, namesAliases)
+	if flagErr != nil {
+		return nil, false
+	}
+	aliases := map[string]string{}
+	var rejected []string
+	for _, pair := range strings.Split(rawValue.Value, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		alias, preferred, found := strings.Cut(pair, "=")
+		alias = strings.TrimSpace(alias)
+		preferred = strings.TrimSpace(preferred)
+		if !found || alias == "" || preferred == "" {
+			o.ErrorPrintf("The alias %q cannot be used.\n", pair)
+			rejected = append(rejected, pair)
+			continue
+		}
+		aliases[alias] = preferred
+	}
+	if len(rejected) != 0 {
+		o.ErrorPrintln("Why?")
+		o.ErrorPrintln("Aliases must be written as alias=preferred name, and neither name may be empty.")
+		o.ErrorPrintln("What to do:")
+		o.ErrorPrintf("Provide appropriate aliases, separated by ';', for example %s %q.\n",
+			namesAliasesFlag, "Beatles=The Beatles;Fab Four=The Beatles")
+		o.Log(output.Error, "invalid aliases", map[string]any{
+			"rejected":       rejected,
+			namesAliasesFlag: rawValue.Value,
+		})
+		return nil, false
+	}
+	return aliases, true
+}
+
+// applyNameEquivalence sets the rules used to compare the names of the artists
+// and their albums with their metadata; it must be called before the artists'
+// metadata is read
+func applyNameEquivalence(artists []*files.Artist, e files.NameEquivalence) {
+	for _, artist := range artists {
+		artist.SetNameEquivalence(e)
+	}
+}
+
+func init() {
+	cmdtoolkit.AddDefaults(namesFlags)
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"mp3repair/internal/files"
+	"reflect"
+	"testing"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+func Test_processNamesFlags(t *testing.T) {
+	tests := map[string]struct {
+		values map[string]*cmdtoolkit.CommandFlag[any]
+		want   *namesSettings
+		want1  bool
+		output.WantedRecording
+	}{
+		"no data": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{},
+			want:   &namesSettings{},
+			want1:  false,
+			WantedRecording: output.WantedRecording{
+				Error: "An internal error occurred: flag \"ampersand\" is not found.\n" +
+					"An internal error occurred: flag \"foldCase\" is not found.\n" +
+					"An internal error occurred: flag \"invertArticles\" is not found.\n" +
+					"An internal error occurred: flag \"normalizeUnicode\" is not found.\n" +
+					"An internal error occurred: flag \"aliases\" is not found.\n",
+				Log: "level='error' error='flag not found' flag='ampersand' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='foldCase' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='invertArticles' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='normalizeUnicode' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='aliases' msg='internal error'\n",
+			},
+		},
+		"all rules": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				namesAliases:          {Value: ""},
+				namesAmpersand:        {Value: true},
+				namesFoldCase:         {Value: true},
+				namesInvertArticles:   {Value: true},
+				namesNormalizeUnicode: {Value: true},
+			},
+			want: &namesSettings{equivalence: files.NameEquivalence{
+				NormalizeUnicode: true,
+				FoldCase:         true,
+				InvertArticles:   true,
+				Ampersand:        true,
+				Aliases:          map[string]string{},
+			}},
+			want1: true,
+		},
+		"aliases": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				namesAliases:          {Value: "Fab Four = The Beatles;;Stones=The Rolling Stones"},
+				namesAmpersand:        {Value: false},
+				namesFoldCase:         {Value: true},
+				namesInvertArticles:   {Value: false},
+				namesNormalizeUnicode: {Value: true},
+			},
+			want: &namesSettings{equivalence: files.NameEquivalence{
+				NormalizeUnicode: true,
+				FoldCase:         true,
+				Aliases: map[string]string{
+					"Fab Four": "The Beatles",
+					"Stones":   "The Rolling Stones",
+				},
+			}},
+			want1: true,
+		},
+		"bad aliases": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				namesAliases:          {Value: "Fab Four;=The Beatles;Stones=The Rolling Stones"},
+				namesAmpersand:        {Value: true},
+				namesFoldCase:         {Value: true},
+				namesInvertArticles:   {Value: true},
+				namesNormalizeUnicode: {Value: true},
+			},
+			want: &namesSettings{equivalence: files.NameEquivalence{
+				NormalizeUnicode: true,
+				FoldCase:         true,
+				InvertArticles:   true,
+				Ampersand:        true,
+			}},
+			want1: false,
+			WantedRecording: output.WantedRecording{
+				Error: "The alias \"Fab Four\" cannot be used.\n" +
+					"The alias \"=The Beatles\" cannot be used.\n" +
+					"Why?\n" +
+					"Aliases must be written as alias=preferred name, and neither name may be empty.\n" +
+					"What to do:\n" +
+					"Provide appropriate aliases, separated by ';', for example --aliases " +
+					"\"Beatles=The Beatles;Fab Four=The Beatles\".\n",
+				Log: "level='error'" +
+					" --aliases='Fab Four;=The Beatles;Stones=The Rolling Stones'" +
+					" rejected='[Fab Four =The Beatles]'" +
+					" msg='invalid aliases'\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			got, got1 := processNamesFlags(o, tt.values)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("processNamesFlags() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("processNamesFlags() got1 = %v, want %v", got1, tt.want1)
+			}
+			o.Report(t, "processNamesFlags()", tt.WantedRecording)
+		})
+	}
+}
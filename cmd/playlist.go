@@ -0,0 +1,627 @@
+package cmd
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"mp3repair/internal/files"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+
+	"github.com/majohn-r/output"
+	"github.com/spf13/cobra"
+)
+
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+const (
+	playlistCommandName   = "playlist"
+	playlistAbsolute      = "absolute"
+	playlistAbsoluteFlag  = "--" + playlistAbsolute
+	playlistByTitle       = "byTitle"
+	playlistByTitleFlag   = "--" + playlistByTitle
+	playlistDirectory     = "directory"
+	playlistDirectoryFlag = "--" + playlistDirectory
+	playlistFormat        = "format"
+	playlistFormatFlag    = "--" + playlistFormat
+	playlistGenre         = "genre"
+	playlistGenreFlag     = "--" + playlistGenre
+	playlistName          = "name"
+	playlistNameFlag      = "--" + playlistName
+	playlistScope         = "scope"
+	playlistScopeFlag     = "--" + playlistScope
+	playlistYears         = "years"
+	playlistYearsFlag     = "--" + playlistYears
+	playlistScopeAlbum    = "album"
+	playlistScopeArtist   = "artist"
+	playlistScopeAll      = "all"
+	playlistUnknownLength = -1
+)
+
+var (
+	playlistCmd = &cobra.Command{
+		Use: playlistCommandName + " [" + playlistFormatFlag + " format] [" + playlistScopeFlag + " scope] [" +
+			playlistDirectoryFlag + " directory] [" + playlistNameFlag + " name] [" + playlistAbsoluteFlag + "] [" +
+			playlistByTitleFlag + "] [" + playlistGenreFlag + " regex] [" + playlistYearsFlag + " range] " +
+			searchUsage + " " + ioUsage,
+		DisableFlagsInUseLine: true,
+		Short:                 "Writes playlists of the selected tracks",
+		Long: "" +
+			fmt.Sprintf("%q writes playlists of the tracks selected by the search filters\n", playlistCommandName) +
+			"\n" +
+			"Playlists can be written in M3U8, PLS, or XSPF format, and can be written for each\n" +
+			"album, for each artist, or for the whole selection. Tracks are ordered by album and\n" +
+			"track number, or by title. Tracks can be further selected by genre and by year; doing\n" +
+			"so requires reading the tracks' metadata.",
+		Example: playlistCommandName + " " + playlistScopeFlag + " " + playlistScopeAlbum + "\n" +
+			"  Write an M3U8 playlist for each album into the music directory\n" +
+			playlistCommandName + " " + playlistFormatFlag + " xspf " + playlistGenreFlag + " \"^jazz$\" " +
+			playlistYearsFlag + " 1955-1965 " + playlistNameFlag + " \"classic jazz\"\n" +
+			"  Write an XSPF playlist named \"classic jazz\" of jazz tracks from 1955 through 1965\n" +
+			playlistCommandName + " " + playlistScopeFlag + " " + playlistScopeArtist + " " +
+			playlistAbsoluteFlag + " " + playlistDirectoryFlag + " playlists\n" +
+			"  Write an M3U8 playlist for each artist into the playlists directory, using\n" +
+			"  absolute paths to the tracks",
+		RunE: playlistRun,
+	}
+	playlistFlags = &cmdtoolkit.FlagSet{
+		Name: playlistCommandName,
+		Details: map[string]*cmdtoolkit.FlagDetails{
+			playlistAbsolute: {
+				Usage:        "write absolute paths to the tracks, rather than paths relative to the playlist",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+			playlistByTitle: {
+				Usage:        "order tracks by title, rather than by album and track number",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+			playlistDirectory: {
+				Usage:        "the directory in which the playlists are written; if empty, the music directory",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			playlistFormat: {
+				AbbreviatedName: "f",
+				Usage:           "playlist format: one of " + strings.Join(playlistFormatNames(), ", "),
+				ExpectedType:    cmdtoolkit.StringType,
+				DefaultValue:    "m3u8",
+			},
+			playlistGenre: {
+				Usage:        "regular expression specifying which genres to select; if empty, all genres",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			playlistName: {
+				Usage: fmt.Sprintf("the name of the playlist written when %s is %s",
+					playlistScopeFlag, playlistScopeAll),
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "playlist",
+			},
+			playlistScope: {
+				AbbreviatedName: "s",
+				Usage: fmt.Sprintf("write a playlist for each %s, for each %s, or for %s of the selected tracks",
+					playlistScopeAlbum, playlistScopeArtist, playlistScopeAll),
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: playlistScopeAll,
+			},
+			playlistYears: {
+				Usage: "range of years to select, such as 1969, 1965-1970, 1965-, or -1970; " +
+					"if empty, all years",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+		},
+	}
+	playlistFormatters = map[string]func(entries []playlistEntry) []byte{
+		"m3u8": formatM3U8,
+		"pls":  formatPLS,
+		"xspf": formatXSPF,
+	}
+	playlistScopes = []string{playlistScopeAlbum, playlistScopeArtist, playlistScopeAll}
+	yearPattern    = regexp.MustCompile(`^\d{4}`)
+)
+
+func playlistFormatNames() []string {
+	names := make([]string, 0, len(playlistFormatters))
+	for name := range playlistFormatters {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func playlistRun(cmd *cobra.Command, _ []string) error {
+	exitError := cmdtoolkit.NewExitProgrammingError(playlistCommandName)
+	o := getBus()
+	ctx := commandContext(cmd)
+	producer := cmd.Flags()
+	values, eSlice := cmdtoolkit.ReadFlags(producer, playlistFlags)
+	ss, searchFlagsOk := evaluateSearchFlags(o, producer)
+	ios, ioFlagsOk := evaluateIOFlags(o, producer)
+	if cmdtoolkit.ProcessFlagErrors(o, eSlice) && searchFlagsOk && ioFlagsOk {
+		exitError = cmdtoolkit.NewExitUserError(playlistCommandName)
+		if ps, flagsOk := processPlaylistFlags(o, values, ss.musicDir); flagsOk {
+			exitError = ps.writePlaylists(ctx, o, ss.load(ctx, o), ss, ios)
+		}
+	}
+	return cmdtoolkit.ToErrorInterface(exitError)
+}
+
+type playlistSettings struct {
+	absolute  bool
+	byTitle   bool
+	directory string
+	format    string
+	genre     *regexp.Regexp
+	name      string
+	scope     string
+	years     yearRange
+}
+
+// yearRange is an inclusive range of years; a zero bound is unbounded
+type yearRange struct {
+	from int
+	to   int
+}
+
+func (yr yearRange) bounded() bool {
+	return yr.from != 0 || yr.to != 0
+}
+
+func (yr yearRange) includes(year int) bool {
+	return (yr.from == 0 || year >= yr.from) && (yr.to == 0 || year <= yr.to)
+}
+
+// playlist is a named, ordered collection of tracks
+type playlist struct {
+	name   string
+	tracks []*files.Track
+}
+
+// playlistEntry describes a track as it appears in a playlist
+type playlistEntry struct {
+	location string
+	absolute bool
+	title    string
+	artist   string
+	album    string
+	number   int
+}
+
+func (pe playlistEntry) displayName() string {
+	return pe.artist + " - " + pe.title
+}
+
+func (ps *playlistSettings) writePlaylists(
+	ctx context.Context,
+	o output.Bus,
+	allArtists []*files.Artist,
+	ss *searchSettings,
+	ios *ioSettings,
+) (e *cmdtoolkit.ExitError) {
+	e = cmdtoolkit.NewExitUserError(playlistCommandName)
+	if len(allArtists) != 0 {
+		if filteredArtists := ss.filter(o, allArtists); len(filteredArtists) != 0 {
+			if ps.hasRules() {
+				// genres and years are only known from the tracks' metadata
+				readMetadata(ctx, o, filteredArtists, ios.openFileLimit)
+				if ctx.Err() != nil {
+					return nil
+				}
+			}
+			e = ps.writeFilteredPlaylists(o, filteredArtists)
+		}
+	}
+	return
+}
+
+func (ps *playlistSettings) hasRules() bool {
+	return ps.genre != nil || ps.years.bounded()
+}
+
+func (ps *playlistSettings) writeFilteredPlaylists(o output.Bus, artists []*files.Artist) *cmdtoolkit.ExitError {
+	playlists := ps.collect(artists)
+	if len(playlists) == 0 {
+		o.ErrorPrintln("No playlists will be written.")
+		o.ErrorPrintln("Why?")
+		o.ErrorPrintf("None of the selected tracks match the %s and %s values.\n", playlistGenreFlag,
+			playlistYearsFlag)
+		o.ErrorPrintln("What to do:")
+		o.ErrorPrintf("Try different %s and %s values.\n", playlistGenreFlag, playlistYearsFlag)
+		return cmdtoolkit.NewExitUserError(playlistCommandName)
+	}
+	if dirErr := mkdirAll(ps.directory, 0o755); dirErr != nil {
+		o.ErrorPrintf("The directory %q cannot be created: %s.\n", ps.directory, cmdtoolkit.ErrorToString(dirErr))
+		o.Log(output.Error, "cannot create directory", map[string]any{
+			"command":   playlistCommandName,
+			"directory": ps.directory,
+			"error":     dirErr,
+		})
+		return cmdtoolkit.NewExitSystemError(playlistCommandName)
+	}
+	var e *cmdtoolkit.ExitError
+	written := 0
+	for _, p := range playlists {
+		path := filepath.Join(ps.directory, p.name+"."+ps.format)
+		content := playlistFormatters[ps.format](ps.entries(p))
+		if writeErr := writeFile(path, content, cmdtoolkit.StdFilePermissions); writeErr != nil {
+			o.ErrorPrintf("The playlist %q cannot be written: %s.\n", path, cmdtoolkit.ErrorToString(writeErr))
+			o.Log(output.Error, "cannot write playlist", map[string]any{
+				"command":  playlistCommandName,
+				"playlist": path,
+				"error":    writeErr,
+			})
+			e = cmdtoolkit.NewExitSystemError(playlistCommandName)
+			continue
+		}
+		o.ConsolePrintf("Playlist %q written with %d tracks.\n", path, len(p.tracks))
+		written++
+	}
+	o.ConsolePrintf("Playlists written: %d.\n", written)
+	return e
+}
+
+// collect assembles the playlists; artists, and albums within each artist, are
+// ordered by name, and playlists with no selected tracks are omitted
+func (ps *playlistSettings) collect(artists []*files.Artist) []playlist {
+	sortedArtists := slices.Clone(artists)
+	sort.Slice(sortedArtists, func(i, j int) bool {
+		return sortedArtists[i].Name() < sortedArtists[j].Name()
+	})
+	var playlists []playlist
+	used := map[string]bool{}
+	add := func(name string, tracks []*files.Track) {
+		if len(tracks) == 0 {
+			return
+		}
+		if ps.byTitle {
+			files.SortTracks(tracks)
+		}
+		playlists = append(playlists, playlist{name: uniquePlaylistName(name, used), tracks: tracks})
+	}
+	var allTracks []*files.Track
+	for _, artist := range sortedArtists {
+		var artistTracks []*files.Track
+		albums := slices.Clone(artist.Albums())
+		files.SortAlbums(albums)
+		for _, album := range albums {
+			albumTracks := ps.selectTracks(album.Tracks())
+			if ps.scope == playlistScopeAlbum {
+				add(artist.Name()+" - "+album.Title(), albumTracks)
+			}
+			artistTracks = append(artistTracks, albumTracks...)
+		}
+		if ps.scope == playlistScopeArtist {
+			add(artist.Name(), artistTracks)
+		}
+		allTracks = append(allTracks, artistTracks...)
+	}
+	if ps.scope == playlistScopeAll {
+		add(ps.name, allTracks)
+	}
+	return playlists
+}
+
+// uniquePlaylistName converts a name into a portable file name, adding a
+// numeric suffix if needed to distinguish it from names already used
+func uniquePlaylistName(name string, used map[string]bool) string {
+	base := files.PortableName(name, 0)
+	for n := 1; ; n++ {
+		candidate := base
+		if n > 1 {
+			candidate = fmt.Sprintf("%s (%d)", base, n)
+		}
+		if key := strings.ToLower(candidate); !used[key] {
+			used[key] = true
+			return candidate
+		}
+	}
+}
+
+// selectTracks returns the tracks, in track number order, that satisfy the
+// genre and year rules
+func (ps *playlistSettings) selectTracks(tracks []*files.Track) []*files.Track {
+	selected := make([]*files.Track, 0, len(tracks))
+	for _, track := range tracks {
+		if ps.selects(track) {
+			selected = append(selected, track)
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].Number() < selected[j].Number()
+	})
+	return selected
+}
+
+func (ps *playlistSettings) selects(track *files.Track) bool {
+	if ps.genre != nil && !ps.genre.MatchString(track.Genre()) {
+		return false
+	}
+	if ps.years.bounded() {
+		year, found := parseYear(track.Year())
+		if !found || !ps.years.includes(year) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseYear extracts the year from a metadata year value, which may be a full
+// ID3V2.4 timestamp
+func parseYear(s string) (int, bool) {
+	digits := yearPattern.FindString(strings.TrimSpace(s))
+	if digits == "" {
+		return 0, false
+	}
+	year, _ := strconv.Atoi(digits)
+	return year, true
+}
+
+func (ps *playlistSettings) entries(p playlist) []playlistEntry {
+	entries := make([]playlistEntry, 0, len(p.tracks))
+	dir, dirErr := filepath.Abs(ps.directory)
+	for _, track := range p.tracks {
+		location, absErr := filepath.Abs(track.Path())
+		if absErr != nil {
+			location = track.Path()
+		}
+		absolute := true
+		if !ps.absolute && dirErr == nil {
+			// paths on different volumes cannot be made relative
+			if relative, relErr := filepath.Rel(dir, location); relErr == nil {
+				location = relative
+				absolute = false
+			}
+		}
+		entries = append(entries, playlistEntry{
+			location: location,
+			absolute: absolute,
+			title:    track.Name(),
+			artist:   track.RecordingArtist(),
+			album:    track.AlbumName(),
+			number:   track.Number(),
+		})
+	}
+	return entries
+}
+
+// formatM3U8 writes an extended M3U playlist, encoded in UTF-8
+func formatM3U8(entries []playlistEntry) []byte {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "#EXTINF:%d,%s\n", playlistUnknownLength, entry.displayName())
+		b.WriteString(entry.location + "\n")
+	}
+	return []byte(b.String())
+}
+
+// formatPLS writes a PLS (version 2) playlist
+func formatPLS(entries []playlistEntry) []byte {
+	var b strings.Builder
+	b.WriteString("[playlist]\n")
+	for k, entry := range entries {
+		n := k + 1
+		fmt.Fprintf(&b, "File%d=%s\n", n, entry.location)
+		fmt.Fprintf(&b, "Title%d=%s\n", n, entry.displayName())
+		fmt.Fprintf(&b, "Length%d=%d\n", n, playlistUnknownLength)
+	}
+	fmt.Fprintf(&b, "NumberOfEntries=%d\n", len(entries))
+	b.WriteString("Version=2\n")
+	return []byte(b.String())
+}
+
+type xspfPlaylist struct {
+	XMLName   xml.Name    `xml:"playlist"`
+	Version   string      `xml:"version,attr"`
+	Namespace string      `xml:"xmlns,attr"`
+	Tracks    []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location string `xml:"location"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	Album    string `xml:"album,omitempty"`
+	TrackNum int    `xml:"trackNum,omitempty"`
+}
+
+// formatXSPF writes an XSPF (version 1) playlist; XSPF locations are URIs
+func formatXSPF(entries []playlistEntry) []byte {
+	p := xspfPlaylist{Version: "1", Namespace: "http://xspf.org/ns/0/"}
+	for _, entry := range entries {
+		p.Tracks = append(p.Tracks, xspfTrack{
+			Location: xspfLocation(entry),
+			Title:    entry.title,
+			Creator:  entry.artist,
+			Album:    entry.album,
+			TrackNum: entry.number,
+		})
+	}
+	// marshaling cannot fail: the playlist contains only strings and integers
+	content, _ := xml.MarshalIndent(p, "", "  ")
+	return []byte(xml.Header + string(content) + "\n")
+}
+
+func xspfLocation(entry playlistEntry) string {
+	path := filepath.ToSlash(entry.location)
+	if !entry.absolute {
+		return (&url.URL{Path: path}).String()
+	}
+	if !strings.HasPrefix(path, "/") {
+		// Windows paths begin with a volume name
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+func processPlaylistFlags(
+	o output.Bus,
+	values map[string]*cmdtoolkit.CommandFlag[any],
+	musicDir string,
+) (*playlistSettings, bool) {
+	ps := &playlistSettings{}
+	flagsOk := true // optimistic
+	if rawValue, flagErr := cmdtoolkit.GetBool(o, values, playlistAbsolute); flagErr == nil {
+		ps.absolute = rawValue.Value
+	} else {
+		flagsOk = false
+	}
+	if rawValue, flagErr := cmdtoolkit.GetBool(o, values, playlistByTitle); flagErr == nil {
+		ps.byTitle = rawValue.Value
+	} else {
+		flagsOk = false
+	}
+	if rawValue, flagErr := cmdtoolkit.GetString(o, values, playlistDirectory); flagErr == nil {
+		ps.directory = rawValue.Value
+		if ps.directory == "" {
+			ps.directory = musicDir
+		}
+	} else {
+		flagsOk = false
+	}
+	if rawValue, flagErr := cmdtoolkit.GetString(o, values, playlistName); flagErr == nil {
+		ps.name = rawValue.Value
+	} else {
+		flagsOk = false
+	}
+	var valueOk bool
+	if ps.format, valueOk = evaluateChoice(o, values, playlistFormat, playlistFormatFlag,
+		playlistFormatNames()); !valueOk {
+		flagsOk = false
+	}
+	if ps.scope, valueOk = evaluateChoice(o, values, playlistScope, playlistScopeFlag,
+		playlistScopes); !valueOk {
+		flagsOk = false
+	}
+	if ps.genre, valueOk = evaluatePlaylistGenre(o, values); !valueOk {
+		flagsOk = false
+	}
+	if ps.years, valueOk = evaluatePlaylistYears(o, values); !valueOk {
+		flagsOk = false
+	}
+	return ps, flagsOk
+}
+
+// evaluateChoice verifies that a flag's value is one of the allowed
+// choices; the comparison ignores case
+func evaluateChoice(
+	o output.Bus,
+	values map[string]*cmdtoolkit.CommandFlag[any],
+	flag, representation string,
+	choices []string,
+) (string, bool) {
+	rawValue, flagErr := cmdtoolkit.GetString(o, values, flag)
+	if flagErr != nil {
+		return "", false
+	}
+	choice := strings.ToLower(rawValue.Value)
+	if slices.Contains(choices, choice) {
+		return choice, true
+	}
+	o.ErrorPrintf("The %s value %q cannot be used.\n", representation, rawValue.Value)
+	o.ErrorPrintln("Why?")
+	o.ErrorPrintln("The value is not one of the supported values.")
+	o.ErrorPrintln("What to do:")
+	o.ErrorPrintf("Use one of these values: %s.\n", strings.Join(choices, ", "))
+	o.Log(output.Error, "invalid value", map[string]any{
+		representation: rawValue.Value,
+		"user-set":     rawValue.UserSet,
+	})
+	return "", false
+}
+
+func evaluatePlaylistGenre(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any]) (*regexp.Regexp, bool) {
+	rawValue, flagErr := cmdtoolkit.GetString(o, values, playlistGenre)
+	if flagErr != nil {
+		return nil, false
+	}
+	if rawValue.Value == "" {
+		return nil, true
+	}
+	// genres are compared without regard to case
+	genre, regexErr := regexp.Compile("(?i)" + rawValue.Value)
+	if regexErr != nil {
+		o.ErrorPrintf("The %s value %q cannot be used.\n", playlistGenreFlag, rawValue.Value)
+		o.ErrorPrintln("Why?")
+		o.ErrorPrintf("The value cannot be parsed as a regular expression: %s.\n",
+			cmdtoolkit.ErrorToString(regexErr))
+		o.ErrorPrintln("What to do:")
+		o.ErrorPrintln(searchRegexInstructions)
+		o.Log(output.Error, "the genre cannot be parsed as a regular expression", map[string]any{
+			playlistGenreFlag: rawValue.Value,
+			"error":           regexErr,
+		})
+		return nil, false
+	}
+	return genre, true
+}
+
+func evaluatePlaylistYears(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any]) (yearRange, bool) {
+	rawValue, flagErr := cmdtoolkit.GetString(o, values, playlistYears)
+	if flagErr != nil {
+		return yearRange{}, false
+	}
+	years, parsed := parseYearRange(rawValue.Value)
+	if !parsed {
+		o.ErrorPrintf("The %s value %q cannot be used.\n", playlistYearsFlag, rawValue.Value)
+		o.ErrorPrintln("Why?")
+		o.ErrorPrintln("The value is not a year or a range of years.")
+		o.ErrorPrintln("What to do:")
+		o.ErrorPrintln("Use a value such as 1969, 1965-1970, 1965-, or -1970.")
+		o.Log(output.Error, "invalid year range", map[string]any{
+			playlistYearsFlag: rawValue.Value,
+			"user-set":        rawValue.UserSet,
+		})
+	}
+	return years, parsed
+}
+
+// parseYearRange parses a year ("1969") or a range of years ("1965-1970");
+// either bound of a range may be omitted
+func parseYearRange(s string) (yearRange, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return yearRange{}, true
+	}
+	fromText, toText, isRange := strings.Cut(s, "-")
+	if !isRange {
+		toText = fromText
+	}
+	var yr yearRange
+	for _, bound := range []struct {
+		text  string
+		value *int
+	}{{text: fromText, value: &yr.from}, {text: toText, value: &yr.to}} {
+		text := strings.TrimSpace(bound.text)
+		if text == "" {
+			continue
+		}
+		year, err := strconv.Atoi(text)
+		if err != nil || year < 1 {
+			return yearRange{}, false
+		}
+		*bound.value = year
+	}
+	if !yr.bounded() || (yr.from != 0 && yr.to != 0 && yr.from > yr.to) {
+		return yearRange{}, false
+	}
+	return yr, true
+}
+
+func init() {
+	rootCmd.AddCommand(playlistCmd)
+	cmdtoolkit.AddDefaults(playlistFlags)
+	cmdtoolkit.AddFlags(getBus(), getConfiguration(), playlistCmd.Flags(), playlistFlags, searchFlags, ioFlags)
+}
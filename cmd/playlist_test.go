@@ -0,0 +1,535 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"mp3repair/internal/files"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/adrg/xdg"
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+func Test_processPlaylistFlags(t *testing.T) {
+	flagValues := func(format, scope, genre, years string) map[string]*cmdtoolkit.CommandFlag[any] {
+		return map[string]*cmdtoolkit.CommandFlag[any]{
+			playlistAbsolute:  {Value: false},
+			playlistByTitle:   {Value: true},
+			playlistDirectory: {Value: ""},
+			playlistFormat:    {Value: format},
+			playlistGenre:     {Value: genre},
+			playlistName:      {Value: "favorites"},
+			playlistScope:     {Value: scope},
+			playlistYears:     {Value: years, UserSet: true},
+		}
+	}
+	tests := map[string]struct {
+		values map[string]*cmdtoolkit.CommandFlag[any]
+		want   *playlistSettings
+		want1  bool
+		output.WantedRecording
+	}{
+		"no data": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{},
+			want:   &playlistSettings{},
+			want1:  false,
+			WantedRecording: output.WantedRecording{
+				Error: "An internal error occurred: flag \"absolute\" is not found.\n" +
+					"An internal error occurred: flag \"byTitle\" is not found.\n" +
+					"An internal error occurred: flag \"directory\" is not found.\n" +
+					"An internal error occurred: flag \"name\" is not found.\n" +
+					"An internal error occurred: flag \"format\" is not found.\n" +
+					"An internal error occurred: flag \"scope\" is not found.\n" +
+					"An internal error occurred: flag \"genre\" is not found.\n" +
+					"An internal error occurred: flag \"years\" is not found.\n",
+				Log: "level='error' error='flag not found' flag='absolute' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='byTitle' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='directory' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='name' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='format' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='scope' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='genre' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='years' msg='internal error'\n",
+			},
+		},
+		"defaults": {
+			values: flagValues("m3u8", "all", "", ""),
+			want: &playlistSettings{
+				byTitle:   true,
+				directory: "Music",
+				format:    "m3u8",
+				name:      "favorites",
+				scope:     "all",
+			},
+			want1: true,
+		},
+		"rules": {
+			values: flagValues("XSPF", "Album", "^rock$", "1965-1970"),
+			want: &playlistSettings{
+				byTitle:   true,
+				directory: "Music",
+				format:    "xspf",
+				genre:     regexp.MustCompile("(?i)^rock$"),
+				name:      "favorites",
+				scope:     "album",
+				years:     yearRange{from: 1965, to: 1970},
+			},
+			want1: true,
+		},
+		"bad values": {
+			values: flagValues("wpl", "genre", "[rock", "1970-1965"),
+			want: &playlistSettings{
+				byTitle:   true,
+				directory: "Music",
+				name:      "favorites",
+			},
+			want1: false,
+			WantedRecording: output.WantedRecording{
+				Error: "The --format value \"wpl\" cannot be used.\n" +
+					"Why?\n" +
+					"The value is not one of the supported values.\n" +
+					"What to do:\n" +
+					"Use one of these values: m3u8, pls, xspf.\n" +
+					"The --scope value \"genre\" cannot be used.\n" +
+					"Why?\n" +
+					"The value is not one of the supported values.\n" +
+					"What to do:\n" +
+					"Use one of these values: album, artist, all.\n" +
+					"The --genre value \"[rock\" cannot be used.\n" +
+					"Why?\n" +
+					"The value cannot be parsed as a regular expression: " +
+					"'*syntax.Error: error parsing regexp: missing closing ]: `[rock`'.\n" +
+					"What to do:\n" +
+					searchRegexInstructions + "\n" +
+					"The --years value \"1970-1965\" cannot be used.\n" +
+					"Why?\n" +
+					"The value is not a year or a range of years.\n" +
+					"What to do:\n" +
+					"Use a value such as 1969, 1965-1970, 1965-, or -1970.\n",
+				Log: "level='error' --format='wpl' user-set='false' msg='invalid value'\n" +
+					"level='error' --scope='genre' user-set='false' msg='invalid value'\n" +
+					"level='error'" +
+					" --genre='[rock'" +
+					" error='error parsing regexp: missing closing ]: `[rock`'" +
+					" msg='the genre cannot be parsed as a regular expression'\n" +
+					"level='error' --years='1970-1965' user-set='true' msg='invalid year range'\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			got, got1 := processPlaylistFlags(o, tt.values, "Music")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("processPlaylistFlags() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("processPlaylistFlags() got1 = %v, want %v", got1, tt.want1)
+			}
+			o.Report(t, "processPlaylistFlags()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_parseYearRange(t *testing.T) {
+	tests := map[string]struct {
+		s     string
+		want  yearRange
+		want1 bool
+	}{
+		"empty":          {s: "", want: yearRange{}, want1: true},
+		"single year":    {s: "1969", want: yearRange{from: 1969, to: 1969}, want1: true},
+		"range":          {s: "1965 - 1970", want: yearRange{from: 1965, to: 1970}, want1: true},
+		"open end":       {s: "1965-", want: yearRange{from: 1965}, want1: true},
+		"open start":     {s: "-1970", want: yearRange{to: 1970}, want1: true},
+		"reversed range": {s: "1970-1965", want: yearRange{}, want1: false},
+		"no bounds":      {s: "-", want: yearRange{}, want1: false},
+		"not a year":     {s: "sixties", want: yearRange{}, want1: false},
+		"zero":           {s: "0", want: yearRange{}, want1: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, got1 := parseYearRange(tt.s)
+			if got != tt.want {
+				t.Errorf("parseYearRange() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("parseYearRange() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func Test_parseYear(t *testing.T) {
+	tests := map[string]struct {
+		s     string
+		want  int
+		want1 bool
+	}{
+		"year":      {s: "1969", want: 1969, want1: true},
+		"timestamp": {s: "1969-09-26T00:00", want: 1969, want1: true},
+		"empty":     {s: "", want: 0, want1: false},
+		"garbage":   {s: "69", want: 0, want1: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, got1 := parseYear(tt.s)
+			if got != tt.want {
+				t.Errorf("parseYear() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("parseYear() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func newPlaylistTestArtists() []*files.Artist {
+	var artists []*files.Artist
+	for _, artistName := range []string{"The Rolling Stones", "The Beatles"} {
+		artist := files.NewArtist(artistName, filepath.Join("Music", artistName))
+		for _, albumTitle := range []string{"Second Album", "First Album"} {
+			album := files.AlbumMaker{
+				Title:     albumTitle,
+				Artist:    artist,
+				Directory: filepath.Join("Music", artistName, albumTitle),
+			}.NewAlbum(true)
+			for _, number := range []int{2, 1} {
+				trackName := fmt.Sprintf("%s track %d", albumTitle, number)
+				files.TrackMaker{
+					Album:      album,
+					FileName:   fmt.Sprintf("%02d %s.mp3", number, trackName),
+					SimpleName: trackName,
+					Number:     number,
+				}.NewTrack(true)
+			}
+		}
+		artists = append(artists, artist)
+	}
+	return artists
+}
+
+func Test_playlistSettings_collect(t *testing.T) {
+	type summary struct {
+		name   string
+		tracks []string
+	}
+	tests := map[string]struct {
+		ps   *playlistSettings
+		want []summary
+	}{
+		"all": {
+			ps: &playlistSettings{scope: playlistScopeAll, name: "everything?"},
+			want: []summary{{
+				name: "everything_",
+				tracks: []string{
+					"First Album track 1", "First Album track 2", "Second Album track 1", "Second Album track 2",
+					"First Album track 1", "First Album track 2", "Second Album track 1", "Second Album track 2",
+				},
+			}},
+		},
+		"artist": {
+			ps: &playlistSettings{scope: playlistScopeArtist},
+			want: []summary{
+				{
+					name: "The Beatles",
+					tracks: []string{
+						"First Album track 1", "First Album track 2", "Second Album track 1", "Second Album track 2",
+					},
+				},
+				{
+					name: "The Rolling Stones",
+					tracks: []string{
+						"First Album track 1", "First Album track 2", "Second Album track 1", "Second Album track 2",
+					},
+				},
+			},
+		},
+		"album by title": {
+			ps: &playlistSettings{scope: playlistScopeAlbum, byTitle: true},
+			want: []summary{
+				{name: "The Beatles - First Album", tracks: []string{"First Album track 1", "First Album track 2"}},
+				{name: "The Beatles - Second Album", tracks: []string{"Second Album track 1", "Second Album track 2"}},
+				{
+					name:   "The Rolling Stones - First Album",
+					tracks: []string{"First Album track 1", "First Album track 2"},
+				},
+				{
+					name:   "The Rolling Stones - Second Album",
+					tracks: []string{"Second Album track 1", "Second Album track 2"},
+				},
+			},
+		},
+		"genre rule excludes everything": {
+			ps:   &playlistSettings{scope: playlistScopeAll, genre: regexp.MustCompile("(?i)jazz")},
+			want: nil,
+		},
+		"year rule excludes everything": {
+			ps:   &playlistSettings{scope: playlistScopeAll, years: yearRange{from: 1969}},
+			want: nil,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got []summary
+			for _, p := range tt.ps.collect(newPlaylistTestArtists()) {
+				s := summary{name: p.name}
+				for _, track := range p.tracks {
+					s.tracks = append(s.tracks, track.Name())
+				}
+				got = append(got, s)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("playlistSettings.collect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_uniquePlaylistName(t *testing.T) {
+	used := map[string]bool{}
+	var got []string
+	for _, name := range []string{"AC/DC", "ac?dc", "Abbey Road"} {
+		got = append(got, uniquePlaylistName(name, used))
+	}
+	want := []string{"AC_DC", "ac_dc (2)", "Abbey Road"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("uniquePlaylistName() = %v, want %v", got, want)
+	}
+}
+
+var playlistTestEntries = []playlistEntry{
+	{
+		location: filepath.Join("The Beatles", "Abbey Road", "01 Come Together.mp3"),
+		title:    "Come Together",
+		artist:   "The Beatles",
+		album:    "Abbey Road",
+		number:   1,
+	},
+	{
+		location: filepath.Join("/", "Music", "Simon & Garfunkel", "Bookends", "07 Mrs. Robinson.mp3"),
+		absolute: true,
+		title:    "Mrs. Robinson",
+		artist:   "Simon & Garfunkel",
+		album:    "Bookends",
+		number:   7,
+	},
+}
+
+func Test_formatM3U8(t *testing.T) {
+	want := "#EXTM3U\n" +
+		"#EXTINF:-1,The Beatles - Come Together\n" +
+		filepath.Join("The Beatles", "Abbey Road", "01 Come Together.mp3") + "\n" +
+		"#EXTINF:-1,Simon & Garfunkel - Mrs. Robinson\n" +
+		filepath.Join("/", "Music", "Simon & Garfunkel", "Bookends", "07 Mrs. Robinson.mp3") + "\n"
+	if got := string(formatM3U8(playlistTestEntries)); got != want {
+		t.Errorf("formatM3U8() = %q, want %q", got, want)
+	}
+}
+
+func Test_formatPLS(t *testing.T) {
+	want := "[playlist]\n" +
+		"File1=" + filepath.Join("The Beatles", "Abbey Road", "01 Come Together.mp3") + "\n" +
+		"Title1=The Beatles - Come Together\n" +
+		"Length1=-1\n" +
+		"File2=" + filepath.Join("/", "Music", "Simon & Garfunkel", "Bookends", "07 Mrs. Robinson.mp3") + "\n" +
+		"Title2=Simon & Garfunkel - Mrs. Robinson\n" +
+		"Length2=-1\n" +
+		"NumberOfEntries=2\n" +
+		"Version=2\n"
+	if got := string(formatPLS(playlistTestEntries)); got != want {
+		t.Errorf("formatPLS() = %q, want %q", got, want)
+	}
+}
+
+func Test_formatXSPF(t *testing.T) {
+	want := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+		"<playlist version=\"1\" xmlns=\"http://xspf.org/ns/0/\">\n" +
+		"  <trackList>\n" +
+		"    <track>\n" +
+		"      <location>The%20Beatles/Abbey%20Road/01%20Come%20Together.mp3</location>\n" +
+		"      <title>Come Together</title>\n" +
+		"      <creator>The Beatles</creator>\n" +
+		"      <album>Abbey Road</album>\n" +
+		"      <trackNum>1</trackNum>\n" +
+		"    </track>\n" +
+		"    <track>\n" +
+		"      <location>file:///Music/Simon%20&amp;%20Garfunkel/Bookends/07%20Mrs.%20Robinson.mp3</location>\n" +
+		"      <title>Mrs. Robinson</title>\n" +
+		"      <creator>Simon &amp; Garfunkel</creator>\n" +
+		"      <album>Bookends</album>\n" +
+		"      <trackNum>7</trackNum>\n" +
+		"    </track>\n" +
+		"  </trackList>\n" +
+		"</playlist>\n"
+	if got := string(formatXSPF(playlistTestEntries)); got != want {
+		t.Errorf("formatXSPF() = %q, want %q", got, want)
+	}
+}
+
+func Test_playlistSettings_writeFilteredPlaylists(t *testing.T) {
+	originalMkdirAll := mkdirAll
+	originalWriteFile := writeFile
+	defer func() {
+		mkdirAll = originalMkdirAll
+		writeFile = originalWriteFile
+	}()
+	mkdirAll = func(_ string, _ os.FileMode) error { return nil }
+	written := map[string]string{}
+	tests := map[string]struct {
+		ps        *playlistSettings
+		writeFile func(string, []byte, os.FileMode) error
+		want      *cmdtoolkit.ExitError
+		wantFiles []string
+		output.WantedRecording
+	}{
+		"per artist": {
+			ps: &playlistSettings{directory: "Music", format: "m3u8", scope: playlistScopeArtist},
+			writeFile: func(name string, content []byte, _ os.FileMode) error {
+				written[name] = string(content)
+				return nil
+			},
+			want:      nil,
+			wantFiles: []string{filepath.Join("Music", "The Beatles.m3u8"), filepath.Join("Music", "The Rolling Stones.m3u8")},
+			WantedRecording: output.WantedRecording{
+				Console: "Playlist \"" + filepath.Join("Music", "The Beatles.m3u8") + "\" written with 4 tracks.\n" +
+					"Playlist \"" + filepath.Join("Music", "The Rolling Stones.m3u8") + "\" written with 4 tracks.\n" +
+					"Playlists written: 2.\n",
+			},
+		},
+		"write failure": {
+			ps: &playlistSettings{directory: "Music", format: "pls", scope: playlistScopeAll, name: "all"},
+			writeFile: func(_ string, _ []byte, _ os.FileMode) error {
+				return fs.ErrPermission
+			},
+			want: cmdtoolkit.NewExitSystemError(playlistCommandName),
+			WantedRecording: output.WantedRecording{
+				Console: "Playlists written: 0.\n",
+				Error: "The playlist \"" + filepath.Join("Music", "all.pls") +
+					"\" cannot be written: 'permission denied'.\n",
+				Log: "level='error'" +
+					" command='playlist'" +
+					" error='permission denied'" +
+					" playlist='" + filepath.Join("Music", "all.pls") + "'" +
+					" msg='cannot write playlist'\n",
+			},
+		},
+		"nothing selected": {
+			ps: &playlistSettings{
+				directory: "Music",
+				format:    "xspf",
+				scope:     playlistScopeAll,
+				years:     yearRange{to: 1900},
+			},
+			want: cmdtoolkit.NewExitUserError(playlistCommandName),
+			WantedRecording: output.WantedRecording{
+				Error: "No playlists will be written.\n" +
+					"Why?\n" +
+					"None of the selected tracks match the --genre and --years values.\n" +
+					"What to do:\n" +
+					"Try different --genre and --years values.\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			clear(written)
+			writeFile = tt.writeFile
+			o := output.NewRecorder()
+			if got := tt.ps.writeFilteredPlaylists(o, newPlaylistTestArtists()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("playlistSettings.writeFilteredPlaylists() = %v, want %v", got, tt.want)
+			}
+			for _, file := range tt.wantFiles {
+				if _, found := written[file]; !found {
+					t.Errorf("playlistSettings.writeFilteredPlaylists() did not write %q", file)
+				}
+			}
+			o.Report(t, "playlistSettings.writeFilteredPlaylists()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_playlist_Help(t *testing.T) {
+	originalSearchFlags := searchFlags
+	originalMusicDir := xdg.UserDirs.Music
+	defer func() {
+		searchFlags = originalSearchFlags
+		xdg.UserDirs.Music = originalMusicDir
+	}()
+	searchFlags = safeSearchFlags
+	xdg.UserDirs.Music = "."
+	commandUnderTest := cloneCommand(playlistCmd)
+	cmdtoolkit.AddFlags(output.NewNilBus(), cmdtoolkit.EmptyConfiguration(),
+		commandUnderTest.Flags(), playlistFlags, searchFlags, ioFlags)
+	tests := map[string]struct {
+		output.WantedRecording
+	}{
+		"good": {
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"\"playlist\" writes playlists of the tracks selected by the search filters\n" +
+					"\n" +
+					"Playlists can be written in M3U8, PLS, or XSPF format, and can be written for each\n" +
+					"album, for each artist, or for the whole selection. Tracks are ordered by album and\n" +
+					"track number, or by title. Tracks can be further selected by genre and by year; doing\n" +
+					"so requires reading the tracks' metadata.\n" +
+					"\n" +
+					"Usage:\n" +
+					"  playlist [--format format] [--scope scope] [--directory directory] [--name name] [--absolute] " +
+					"[--byTitle] [--genre regex] [--years range] [--albumFilter regex] [--artistFilter regex] " +
+					"[--trackFilter regex] [--extensions extensions] [--maxOpenFiles count]\n" +
+					"\n" +
+					"Examples:\n" +
+					"playlist --scope album\n" +
+					"  Write an M3U8 playlist for each album into the music directory\n" +
+					"playlist --format xspf --genre \"^jazz$\" --years 1955-1965 --name \"classic jazz\"\n" +
+					"  Write an XSPF playlist named \"classic jazz\" of jazz tracks from 1955 through 1965\n" +
+					"playlist --scope artist --absolute --directory playlists\n" +
+					"  Write an M3U8 playlist for each artist into the playlists directory, using\n" +
+					"  absolute paths to the tracks\n" +
+					"\n" +
+					"Flags:\n" +
+					"      --absolute              write absolute paths to the tracks, rather than paths relative to the " +
+					"playlist (default false)\n" +
+					"      --albumFilter string    regular expression specifying which albums to select (default \".*\")\n" +
+					"      --artistFilter string   regular expression specifying which artists to select (default \".*\")\n" +
+					"      --byTitle               order tracks by title, rather than by album and track number (default " +
+					"false)\n" +
+					"      --directory string      the directory in which the playlists are written; if empty, the music " +
+					"directory (default \"\")\n" +
+					"      --extensions string     comma-delimited list of file extensions used by mp3 files (default " +
+					"\".mp3\")\n" +
+					"  -f, --format string         playlist format: one of m3u8, pls, xspf (default \"m3u8\")\n" +
+					"      --genre string          regular expression specifying which genres to select; if empty, all " +
+					"genres (default \"\")\n" +
+					"      --maxOpenFiles int      the maximum number of files that can be read simultaneously (at least " +
+					"1, at most 32767, default 1000) (default 1000)\n" +
+					"      --name string           the name of the playlist written when --scope is all (default " +
+					"\"playlist\")\n" +
+					"  -s, --scope string          write a playlist for each album, for each artist, or for all of the " +
+					"selected tracks (default \"all\")\n" +
+					"      --trackFilter string    regular expression specifying which tracks to select (default \".*\")\n" +
+					"      --years string          range of years to select, such as 1969, 1965-1970, 1965-, or -1970; " +
+					"if empty, all years (default \"\")\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			command := commandUnderTest
+			enableCommandRecording(o, command)
+			_ = command.Help()
+			o.Report(t, "playlist Help()", tt.WantedRecording)
+		})
+	}
+}
@@ -0,0 +1,406 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"mp3repair/internal/files"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+
+	"github.com/majohn-r/output"
+	"github.com/spf13/cobra"
+)
+
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+const (
+	revertCommandName = "revert"
+	revertDryRun      = "dryRun"
+	revertDryRunFlag  = "--" + revertDryRun
+)
+
+var (
+	revertCmd = &cobra.Command{
+		Use: revertCommandName + " [" + historyArtistFlag + " regex] [" + historyAlbumFlag + " regex] [" +
+			historyTrackFlag + " regex] [" + historyFieldFlag + " field] [" + historyFromFlag + " date] [" +
+			historyToFlag + " date] [" + revertDryRunFlag + "] " + ioUsage,
+		DisableFlagsInUseLine: true,
+		Short:                 "Restores the metadata values changed by the " + rewriteCommandName + " command",
+		Long: "" +
+			fmt.Sprintf("%q restores metadata fields to the values recorded in the audit log\n", revertCommandName) +
+			"\n" +
+			"The changes to revert are selected from the audit log with the same filters\n" +
+			"that the " + historyCommandName + " command uses; at least one filter is required. When a field\n" +
+			"was changed more than once, it is restored to the value it held before the\n" +
+			"earliest selected change. Before a track is changed, it is backed up to the\n" +
+			"central backup store, as the " + rewriteCommandName + " command's " + rewriteBackupStoreFlag +
+			" flag does; a track\n" +
+			"that cannot be backed up is not changed.\n" +
+			"\n" +
+			"A track is not changed if any of its selected fields no longer holds the\n" +
+			"value that the recorded change wrote; the field has been changed since, and\n" +
+			"restoring it would lose that change. Each restored field is recorded in the\n" +
+			"audit log.",
+		Example: revertCommandName + " " + historyAlbumFlag + " \"^Abbey Road$\" " + historyFieldFlag + " year " +
+			revertDryRunFlag + "\n" +
+			"  Lists the year changes to the tracks on Abbey Road that would be reverted\n" +
+			revertCommandName + " " + historyFromFlag + " 2026-10-18 " + historyToFlag + " 2026-10-18\n" +
+			"  Reverts every change made on October 18, 2026",
+		RunE: revertRun,
+	}
+	revertFlags = &cmdtoolkit.FlagSet{
+		Name: revertCommandName,
+		Details: map[string]*cmdtoolkit.FlagDetails{
+			historyArtist: {
+				Usage:        "regular expression specifying which artists to revert changes for; if empty, all artists",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			historyAlbum: {
+				Usage:        "regular expression specifying which albums to revert changes for; if empty, all albums",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			historyTrack: {
+				Usage:        "regular expression specifying which tracks to revert changes for; if empty, all tracks",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			historyField: {
+				Usage: "the field to revert changes for: one of " + strings.Join(files.MetadataFieldNames(), ", ") +
+					"; if empty, all fields",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			historyFrom: {
+				Usage:        "the earliest date (YYYY-MM-DD) to revert changes for; if empty, the log's beginning",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			historyTo: {
+				Usage:        "the latest date (YYYY-MM-DD) to revert changes for; if empty, the present",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			revertDryRun: {
+				Usage:        "output what would have been reverted, but changes no files",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+		},
+	}
+)
+
+func revertRun(cmd *cobra.Command, _ []string) error {
+	exitError := cmdtoolkit.NewExitProgrammingError(revertCommandName)
+	o := getBus()
+	ctx := commandContext(cmd)
+	producer := cmd.Flags()
+	values, eSlice := cmdtoolkit.ReadFlags(producer, revertFlags)
+	ios, ioFlagsOk := evaluateIOFlags(o, producer)
+	if cmdtoolkit.ProcessFlagErrors(o, eSlice) && ioFlagsOk {
+		if rs, flagsOk := processRevertFlags(o, values); flagsOk {
+			exitError = rs.revert(ctx, o, ios)
+		}
+	}
+	return cmdtoolkit.ToErrorInterface(exitError)
+}
+
+type revertSettings struct {
+	filter *historySettings
+	dryRun bool
+	// the backup store to which the tracks are backed up before they are
+	// reverted
+	store *backupStore
+}
+
+// revertKey identifies a field of a track's metadata
+type revertKey struct {
+	path   string
+	source string
+	field  string
+}
+
+// revertTrack holds the changes to revert for a single track; entry supplies
+// the names of the track, its album, and its artist
+type revertTrack struct {
+	entry   auditEntry
+	changes []files.MetadataChange
+	backing *files.Track
+}
+
+func processRevertFlags(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any]) (*revertSettings, bool) {
+	rs := &revertSettings{}
+	flagsOk := true // optimistic
+	var filterOk bool
+	if rs.filter, filterOk = processHistoryFlags(o, values); !filterOk {
+		flagsOk = false
+	}
+	if dryRun, flagErr := cmdtoolkit.GetBool(o, values, revertDryRun); flagErr == nil {
+		rs.dryRun = dryRun.Value
+	} else {
+		flagsOk = false
+	}
+	if flagsOk && rs.filter.isUnfiltered() {
+		o.ErrorPrintln("No changes are selected.")
+		o.ErrorPrintln("Why?")
+		o.ErrorPrintln("Without a filter, every change in the audit log would be reverted.")
+		o.ErrorPrintln("What to do:")
+		o.ErrorPrintf("Use at least one of %s, %s, %s, %s, %s, or %s.\n", historyArtistFlag, historyAlbumFlag,
+			historyTrackFlag, historyFieldFlag, historyFromFlag, historyToFlag)
+		o.Log(output.Error, "no filter specified", map[string]any{"command": revertCommandName})
+		flagsOk = false
+	}
+	return rs, flagsOk
+}
+
+// selectChanges combines the selected audit log entries into one change per
+// track field, from the value before the earliest change to the value after
+// the latest; fields whose changes cancel out are omitted. The tracks are
+// sorted by path.
+func selectChanges(entries []auditEntry, hs *historySettings) ([]*revertTrack, error) {
+	var selected []auditEntry
+	for _, entry := range entries {
+		if hs.matches(entry) {
+			selected = append(selected, entry)
+		}
+	}
+	slices.SortStableFunc(selected, func(a, b auditEntry) int {
+		return a.Time.Compare(b.Time)
+	})
+	combined := map[revertKey]*files.MetadataChange{}
+	tracks := map[string]*revertTrack{}
+	var problems []error
+	for _, entry := range selected {
+		field, found := files.LookupMetadataField(entry.Field)
+		if !found {
+			problems = append(problems, fmt.Errorf("the field %q recorded for %q is not recognized", entry.Field,
+				entry.Path))
+			continue
+		}
+		key := revertKey{path: entry.Path, source: entry.Source, field: entry.Field}
+		if change, exists := combined[key]; exists {
+			change.NewValue = entry.NewValue
+			continue
+		}
+		combined[key] = &files.MetadataChange{
+			Source:   entry.Source,
+			Field:    field,
+			OldValue: entry.OldValue,
+			NewValue: entry.NewValue,
+		}
+		if _, exists := tracks[entry.Path]; !exists {
+			tracks[entry.Path] = &revertTrack{entry: entry}
+		}
+	}
+	keys := make([]revertKey, 0, len(combined))
+	for key := range combined {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b revertKey) int {
+		return cmp.Or(
+			strings.Compare(a.path, b.path),
+			strings.Compare(a.source, b.source),
+			cmp.Compare(combined[a].Field, combined[b].Field),
+		)
+	})
+	var result []*revertTrack
+	for _, key := range keys {
+		change := combined[key]
+		if change.OldValue == change.NewValue {
+			continue
+		}
+		rt := tracks[key.path]
+		if len(rt.changes) == 0 {
+			result = append(result, rt)
+		}
+		rt.changes = append(rt.changes, *change)
+	}
+	return result, errors.Join(problems...)
+}
+
+// buildRevertArtists creates the artists, albums, and tracks named by the
+// audit log, so that the tracks' metadata can be read
+func buildRevertArtists(tracks []*revertTrack) []*files.Artist {
+	var artists []*files.Artist
+	artistsByDir := map[string]*files.Artist{}
+	albumsByDir := map[string]*files.Album{}
+	for _, rt := range tracks {
+		albumDir := filepath.Dir(rt.entry.Path)
+		album, albumFound := albumsByDir[albumDir]
+		if !albumFound {
+			artistDir := filepath.Dir(albumDir)
+			artist, artistFound := artistsByDir[artistDir]
+			if !artistFound {
+				artist = files.NewArtist(rt.entry.Artist, artistDir)
+				artistsByDir[artistDir] = artist
+				artists = append(artists, artist)
+			}
+			album = files.AlbumMaker{Title: rt.entry.Album, Artist: artist, Directory: albumDir}.NewAlbum(true)
+			albumsByDir[albumDir] = album
+		}
+		rt.backing = files.TrackMaker{
+			Album:      album,
+			FileName:   filepath.Base(rt.entry.Path),
+			SimpleName: rt.entry.Track,
+		}.NewTrack(true)
+	}
+	return artists
+}
+
+func (rs *revertSettings) revert(ctx context.Context, o output.Bus, ios *ioSettings) *cmdtoolkit.ExitError {
+	path := auditLogPath()
+	entries, readErr := readAuditLog(path)
+	if readErr != nil {
+		o.ErrorPrintf("The audit log %q cannot be read: %s.\n", path, cmdtoolkit.ErrorToString(readErr))
+		o.Log(output.Error, "cannot read audit log", map[string]any{
+			"command":  revertCommandName,
+			"auditLog": path,
+			"error":    readErr,
+		})
+		if len(entries) == 0 {
+			return cmdtoolkit.NewExitSystemError(revertCommandName)
+		}
+	}
+	tracks, selectErr := selectChanges(entries, rs.filter)
+	if selectErr != nil {
+		o.ErrorPrintf("Some audit log entries cannot be reverted: %s.\n", cmdtoolkit.ErrorToString(selectErr))
+		o.Log(output.Error, "cannot revert audit log entries", map[string]any{
+			"command":  revertCommandName,
+			"auditLog": path,
+			"error":    selectErr,
+		})
+	}
+	systemFailure := readErr != nil || selectErr != nil
+	if len(tracks) == 0 {
+		o.ConsolePrintln("No recorded metadata changes to revert match the specified filters.")
+		if systemFailure {
+			return cmdtoolkit.NewExitSystemError(revertCommandName)
+		}
+		return nil
+	}
+	readMetadata(ctx, o, buildRevertArtists(tracks), ios.openFileLimit)
+	if ctx.Err() != nil {
+		return nil
+	}
+	if !rs.dryRun && rs.store == nil {
+		rs.store = newBackupStore()
+	}
+	userFailure := false
+	count := 0
+	for k, rt := range tracks {
+		if ctx.Err() != nil {
+			o.ErrorPrintf("The revert was interrupted; %d tracks were not reverted.\n", len(tracks)-k)
+			break
+		}
+		revertErr := rs.revertTrack(o, rt)
+		switch {
+		case revertErr == nil:
+			count++
+			if !rs.dryRun && recordMetadataChanges(o, revertCommandName, rt.backing,
+				restorations(rt.changes)) != nil {
+				systemFailure = true
+			}
+			continue
+		case errors.Is(revertErr, errRevertBackupFailed):
+			// already reported
+			systemFailure = true
+			continue
+		case errors.Is(revertErr, files.ErrValueChanged):
+			userFailure = true
+		default:
+			systemFailure = true
+		}
+		o.ErrorPrintf("The changes to track %q cannot be reverted: %s.\n", rt.backing,
+			cmdtoolkit.ErrorToString(revertErr))
+		o.Log(output.Error, "cannot revert track", map[string]any{
+			"command":   revertCommandName,
+			"directory": rt.backing.Directory(),
+			"fileName":  rt.backing.FileName(),
+			"error":     revertErr,
+		})
+	}
+	if rs.dryRun {
+		o.ConsolePrintf("Tracks that would be reverted: %d.\n", count)
+	} else {
+		o.ConsolePrintf("Tracks reverted: %d.\n", count)
+	}
+	switch {
+	case systemFailure:
+		return cmdtoolkit.NewExitSystemError(revertCommandName)
+	case userFailure:
+		return cmdtoolkit.NewExitUserError(revertCommandName)
+	default:
+		return nil
+	}
+}
+
+// errRevertBackupFailed is returned by revertTrack when the track cannot be
+// backed up, and so is not reverted
+var errRevertBackupFailed = errors.New("the track cannot be backed up")
+
+// revertTrack restores a track's fields, after backing the track up to the
+// backup store, or, on a dry run, verifies that they can be restored
+func (rs *revertSettings) revertTrack(o output.Bus, rt *revertTrack) error {
+	t := rt.backing
+	if checkErr := t.CanRevertMetadata(rt.changes); checkErr != nil {
+		return checkErr
+	}
+	if rs.dryRun {
+		for _, change := range rt.changes {
+			o.ConsolePrintf("%q: %s %s would be restored from %q to %q.\n", t, change.Source, change.Field,
+				change.NewValue, change.OldValue)
+		}
+		return nil
+	}
+	backupFile, strategy, backupErr := rs.store.storeTrack(o, revertCommandName, t, revertCommandName)
+	if backupErr != nil {
+		o.ErrorPrintf("The track file %q could not be backed up due to error %s.\n", t,
+			cmdtoolkit.ErrorToString(backupErr))
+		o.ErrorPrintf("The track file %q will not be reverted.\n", t)
+		o.Log(output.Error, "cannot store backup", map[string]any{
+			"command":     revertCommandName,
+			"source":      t.Path(),
+			"backupStore": rs.store.dir,
+			"error":       backupErr,
+		})
+		return errRevertBackupFailed
+	}
+	o.ConsolePrintf("The track file %q has been backed up to %q%s.\n", t, backupFile, backupDescription(strategy))
+	if revertErr := t.RevertMetadata(rt.changes); revertErr != nil {
+		return revertErr
+	}
+	for _, change := range rt.changes {
+		o.ConsolePrintf("%q: %s %s restored from %q to %q.\n", t, change.Source, change.Field, change.NewValue,
+			change.OldValue)
+	}
+	markDirty(o)
+	return nil
+}
+
+// restorations returns the changes that reverting the changes makes
+func restorations(changes []files.MetadataChange) []files.MetadataChange {
+	result := make([]files.MetadataChange, 0, len(changes))
+	for _, change := range changes {
+		result = append(result, files.MetadataChange{
+			Source:   change.Source,
+			Field:    change.Field,
+			OldValue: change.NewValue,
+			NewValue: change.OldValue,
+		})
+	}
+	return result
+}
+
+func init() {
+	rootCmd.AddCommand(revertCmd)
+	cmdtoolkit.AddDefaults(revertFlags)
+	cmdtoolkit.AddFlags(getBus(), getConfiguration(), revertCmd.Flags(), revertFlags, ioFlags)
+}
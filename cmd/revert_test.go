@@ -0,0 +1,454 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mp3repair/internal/files"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+func Test_processRevertFlags(t *testing.T) {
+	withDryRun := func(values map[string]*cmdtoolkit.CommandFlag[any],
+		dryRun bool) map[string]*cmdtoolkit.CommandFlag[any] {
+		values[revertDryRun] = &cmdtoolkit.CommandFlag[any]{Value: dryRun}
+		return values
+	}
+	tests := map[string]struct {
+		values map[string]*cmdtoolkit.CommandFlag[any]
+		want   *revertSettings
+		want1  bool
+		output.WantedRecording
+	}{
+		"filtered": {
+			values: withDryRun(historyFlagValues("", "", "", "year", "", ""), true),
+			want:   &revertSettings{filter: &historySettings{field: "year"}, dryRun: true},
+			want1:  true,
+		},
+		"unfiltered": {
+			values: withDryRun(historyFlagValues("", "", "", "", "", ""), false),
+			want:   &revertSettings{filter: &historySettings{}},
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"No changes are selected.\n" +
+					"Why?\n" +
+					"Without a filter, every change in the audit log would be reverted.\n" +
+					"What to do:\n" +
+					"Use at least one of --artist, --album, --track, --field, --from, or --to.\n",
+				Log: "level='error' command='revert' msg='no filter specified'\n",
+			},
+		},
+		"bad filter": {
+			values: withDryRun(historyFlagValues("", "", "", "composer", "", ""), false),
+			want:   &revertSettings{filter: &historySettings{}},
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"The --field value \"composer\" cannot be used.\n" +
+					"Why?\n" +
+					"The value is not a known metadata field.\n" +
+					"What to do:\n" +
+					"Use one of these values: album, artist, genre, mcdi, number, title, year.\n",
+				Log: "level='error' --field='composer' user-set='false' msg='invalid field'\n",
+			},
+		},
+		"missing dry run": {
+			values: historyFlagValues("", "", "", "year", "", ""),
+			want:   &revertSettings{filter: &historySettings{field: "year"}},
+			WantedRecording: output.WantedRecording{
+				Error: "An internal error occurred: flag \"dryRun\" is not found.\n",
+				Log: "" +
+					"level='error'" +
+					" error='flag not found'" +
+					" flag='dryRun'" +
+					" msg='internal error'\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			got, got1 := processRevertFlags(o, tt.values)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("processRevertFlags() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("processRevertFlags() got1 = %v, want %v", got1, tt.want1)
+			}
+			o.Report(t, "processRevertFlags()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_selectChanges(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 2, 0, 0, 0, time.Local) }
+	entry := func(when time.Time, path, source, field, oldValue, newValue string) auditEntry {
+		return auditEntry{
+			Time:     when,
+			Path:     path,
+			Artist:   "a",
+			Album:    "b",
+			Track:    "t",
+			Source:   source,
+			Field:    field,
+			OldValue: oldValue,
+			NewValue: newValue,
+		}
+	}
+	tests := map[string]struct {
+		entries []auditEntry
+		hs      *historySettings
+		want    []*revertTrack
+		wantErr string
+	}{
+		"nothing recorded": {hs: &historySettings{field: "year"}},
+		"combined": {
+			entries: []auditEntry{
+				entry(day(18), "p2", "ID3V2", "year", "1999", "2001"),
+				entry(day(17), "p2", "ID3V2", "year", "1970", "1999"),
+				entry(day(17), "p1", "ID3V2", "genre", "Pop", "Rock"),
+				entry(day(17), "p1", "ID3V1", "genre", "Pop", "Rock"),
+				entry(day(17), "p1", "ID3V1", "year", "1970", "1999"),
+			},
+			hs: &historySettings{artist: regexp.MustCompile("^a$")},
+			want: []*revertTrack{
+				{
+					entry: entry(day(17), "p1", "ID3V2", "genre", "Pop", "Rock"),
+					changes: []files.MetadataChange{
+						{Source: "ID3V1", Field: files.GenreField, OldValue: "Pop", NewValue: "Rock"},
+						{Source: "ID3V1", Field: files.YearField, OldValue: "1970", NewValue: "1999"},
+						{Source: "ID3V2", Field: files.GenreField, OldValue: "Pop", NewValue: "Rock"},
+					},
+				},
+				{
+					entry: entry(day(17), "p2", "ID3V2", "year", "1970", "1999"),
+					changes: []files.MetadataChange{
+						{Source: "ID3V2", Field: files.YearField, OldValue: "1970", NewValue: "2001"},
+					},
+				},
+			},
+		},
+		"filtered": {
+			entries: []auditEntry{
+				entry(day(18), "p2", "ID3V2", "year", "1999", "2001"),
+				entry(day(17), "p2", "ID3V2", "year", "1970", "1999"),
+			},
+			hs: &historySettings{from: time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local)},
+			want: []*revertTrack{
+				{
+					entry: entry(day(18), "p2", "ID3V2", "year", "1999", "2001"),
+					changes: []files.MetadataChange{
+						{Source: "ID3V2", Field: files.YearField, OldValue: "1999", NewValue: "2001"},
+					},
+				},
+			},
+		},
+		"already reverted": {
+			entries: []auditEntry{
+				entry(day(17), "p2", "ID3V2", "year", "1970", "1999"),
+				entry(day(18), "p2", "ID3V2", "year", "1999", "1970"),
+			},
+			hs: &historySettings{field: "year"},
+		},
+		"unknown field": {
+			entries: []auditEntry{entry(day(17), "p2", "ID3V2", "composer", "x", "y")},
+			hs:      &historySettings{track: regexp.MustCompile("t")},
+			wantErr: `the field "composer" recorded for "p2" is not recognized`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, gotErr := selectChanges(tt.entries, tt.hs)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectChanges() got = %v, want %v", got, tt.want)
+			}
+			if gotErr == nil && tt.wantErr != "" || gotErr != nil && gotErr.Error() != tt.wantErr {
+				t.Errorf("selectChanges() error = %v, want %q", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_buildRevertArtists(t *testing.T) {
+	path1 := filepath.Join("Music", "a", "b", "01 t1.mp3")
+	path2 := filepath.Join("Music", "a", "b", "02 t2.mp3")
+	path3 := filepath.Join("Music", "a", "c", "01 t3.mp3")
+	tracks := []*revertTrack{
+		{entry: auditEntry{Path: path1, Artist: "a", Album: "b", Track: "t1"}},
+		{entry: auditEntry{Path: path2, Artist: "a", Album: "b", Track: "t2"}},
+		{entry: auditEntry{Path: path3, Artist: "a", Album: "c", Track: "t3"}},
+	}
+	artists := buildRevertArtists(tracks)
+	if len(artists) != 1 || len(artists[0].Albums()) != 2 {
+		t.Fatalf("buildRevertArtists() = %v, want 1 artist with 2 albums", artists)
+	}
+	if got := len(artists[0].Albums()[0].Tracks()); got != 2 {
+		t.Errorf("buildRevertArtists() first album has %d tracks, want 2", got)
+	}
+	for _, rt := range tracks {
+		if rt.backing == nil || rt.backing.Path() != rt.entry.Path || rt.backing.Name() != rt.entry.Track {
+			t.Errorf("buildRevertArtists() track = %v, want %q", rt.backing, rt.entry.Path)
+		}
+	}
+}
+
+func Test_revertSettings_revert(t *testing.T) {
+	originalApplicationPath := applicationPath
+	originalReadFile := readFile
+	originalReadMetadata := readMetadata
+	defer func() {
+		applicationPath = originalApplicationPath
+		readFile = originalReadFile
+		readMetadata = originalReadMetadata
+	}()
+	applicationPath = func() string { return "appData" }
+	// leaving the metadata unread causes each track to fail
+	readMetadata = func(_ context.Context, _ output.Bus, _ []*files.Artist, _ int) {}
+	path := filepath.Join("appData", auditLogFile)
+	trackPath := filepath.Join("Music", "a", "b", "01 t.mp3")
+	log := fmt.Sprintf(`{"time":%q,"path":%q,"artist":"a","album":"b","track":"t","source":"ID3V2",`+
+		`"field":"year","old":"2001","new":"1999"}`,
+		time.Date(2026, 10, 17, 2, 0, 0, 0, time.Local).Format(time.RFC3339), trackPath) + "\n"
+	tests := map[string]struct {
+		rs      *revertSettings
+		content string
+		readErr error
+		wantErr bool
+		output.WantedRecording
+	}{
+		"unreadable": {
+			rs:      &revertSettings{filter: &historySettings{field: "year"}},
+			readErr: errors.New("access denied"),
+			wantErr: true,
+			WantedRecording: output.WantedRecording{
+				Error: fmt.Sprintf("The audit log %q cannot be read: 'access denied'.\n", path),
+				Log: "" +
+					"level='error'" +
+					" auditLog='" + path + "'" +
+					" command='revert'" +
+					" error='access denied'" +
+					" msg='cannot read audit log'\n",
+			},
+		},
+		"nothing matches": {
+			rs:      &revertSettings{filter: &historySettings{field: "genre"}},
+			content: log,
+			WantedRecording: output.WantedRecording{
+				Console: "No recorded metadata changes to revert match the specified filters.\n",
+			},
+		},
+		"cannot revert": {
+			rs:      &revertSettings{filter: &historySettings{field: "year"}, dryRun: true},
+			content: log,
+			wantErr: true,
+			WantedRecording: output.WantedRecording{
+				Console: "Tracks that would be reverted: 0.\n",
+				Error: fmt.Sprintf("The changes to track %q cannot be reverted: 'the metadata has not been read'.\n",
+					trackPath),
+				Log: "" +
+					"level='error'" +
+					" command='revert'" +
+					" directory='" + filepath.Dir(trackPath) + "'" +
+					" error='the metadata has not been read'" +
+					" fileName='01 t.mp3'" +
+					" msg='cannot revert track'\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			readFile = func(string) ([]byte, error) {
+				return []byte(tt.content), tt.readErr
+			}
+			o := output.NewRecorder()
+			if got := tt.rs.revert(context.Background(), o, &ioSettings{openFileLimit: 1}); (got != nil) != tt.wantErr {
+				t.Errorf("revertSettings.revert() = %v, wantErr %v", got, tt.wantErr)
+			}
+			o.Report(t, "revertSettings.revert()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_revertSettings_revertTrack(t *testing.T) {
+	useFullCopyBackups(t)
+	originalCopyFile := copyFile
+	originalMarkDirty := markDirty
+	defer func() {
+		copyFile = originalCopyFile
+		markDirty = originalMarkDirty
+	}()
+	markDirty = func(_ output.Bus) {}
+	tests := map[string]struct {
+		copyErr    error
+		wantErr    error
+		wantStored bool
+		wantArtist string
+		want       func(track *files.Track, backupFile, storeDir string) output.WantedRecording
+	}{
+		"backed up": {
+			wantStored: true,
+			wantArtist: "the artist",
+			want: func(track *files.Track, backupFile, _ string) output.WantedRecording {
+				return output.WantedRecording{
+					Console: fmt.Sprintf("The track file %q has been backed up to %q.\n", track, backupFile) +
+						fmt.Sprintf("%q: ID3V2 artist restored from \"my artist\" to \"the artist\".\n", track),
+				}
+			},
+		},
+		"cannot be backed up": {
+			copyErr:    errors.New("disk full"),
+			wantErr:    errRevertBackupFailed,
+			wantArtist: "my artist",
+			want: func(track *files.Track, _, storeDir string) output.WantedRecording {
+				return output.WantedRecording{
+					Error: fmt.Sprintf("The track file %q could not be backed up due to error 'disk full'.\n", track) +
+						fmt.Sprintf("The track file %q will not be reverted.\n", track),
+					Log: "level='error'" +
+						fmt.Sprintf(" backupStore='%s'", storeDir) +
+						" command='revert'" +
+						" error='disk full'" +
+						fmt.Sprintf(" source='%s'", track.Path()) +
+						" msg='cannot store backup'\n",
+				}
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			copyFile = originalCopyFile
+			if tt.copyErr != nil {
+				copyFile = func(_, _ string) error { return tt.copyErr }
+			}
+			track := clutteredArtists(t)[0].Albums()[0].Tracks()[1]
+			content, _ := os.ReadFile(track.Path())
+			sum := sha256.Sum256(content)
+			hash := hex.EncodeToString(sum[:])
+			store := &backupStore{dir: t.TempDir()}
+			backupFile := store.filePath(hash)
+			rs := &revertSettings{store: store}
+			rt := &revertTrack{
+				backing: track,
+				changes: []files.MetadataChange{
+					{Source: "ID3V2", Field: files.ArtistNameField, OldValue: "the artist", NewValue: "my artist"},
+				},
+			}
+			o := output.NewRecorder()
+			if got := rs.revertTrack(o, rt); !errors.Is(got, tt.wantErr) {
+				t.Errorf("revertSettings.revertTrack() = %v, want %v", got, tt.wantErr)
+			}
+			o.Report(t, "revertSettings.revertTrack()", tt.want(track, backupFile, store.dir))
+			if stored, _ := os.ReadFile(backupFile); bytes.Equal(stored, content) != tt.wantStored {
+				t.Errorf("revertSettings.revertTrack() stored the original track = %t, want %t", !tt.wantStored,
+					tt.wantStored)
+			}
+			manifest, _ := readBackupManifest(store.manifestPath())
+			entries := manifest.entries
+			if got := len(entries) == 1 && entries[0].Reason == "revert"; got != tt.wantStored {
+				t.Errorf("revertSettings.revertTrack() recorded the backup = %t, want %t", got, tt.wantStored)
+			}
+			albumDir := filepath.Dir(track.Path())
+			artist := files.NewArtist("my artist", filepath.Dir(albumDir))
+			album := files.AlbumMaker{Title: "my album", Artist: artist, Directory: albumDir}.NewAlbum(true)
+			reread := files.TrackMaker{
+				Album:      album,
+				FileName:   track.FileName(),
+				SimpleName: "my track 2",
+				Number:     2,
+			}.NewTrack(true)
+			files.ReadMetadata(context.Background(), output.NewNilBus(), []*files.Artist{artist}, 1)
+			if got := reread.ArtistName(); got != tt.wantArtist {
+				t.Errorf("revertSettings.revertTrack() artist = %q, want %q", got, tt.wantArtist)
+			}
+		})
+	}
+}
+
+func Test_restorations(t *testing.T) {
+	changes := []files.MetadataChange{
+		{Source: "ID3V1", Field: files.YearField, OldValue: "2001", NewValue: "1999"},
+	}
+	want := []files.MetadataChange{
+		{Source: "ID3V1", Field: files.YearField, OldValue: "1999", NewValue: "2001"},
+	}
+	if got := restorations(changes); !reflect.DeepEqual(got, want) {
+		t.Errorf("restorations() = %v, want %v", got, want)
+	}
+}
+
+func Test_revert_Help(t *testing.T) {
+	commandUnderTest := cloneCommand(revertCmd)
+	cmdtoolkit.AddFlags(output.NewNilBus(), cmdtoolkit.EmptyConfiguration(),
+		commandUnderTest.Flags(), revertFlags, ioFlags)
+	tests := map[string]struct {
+		output.WantedRecording
+	}{
+		"good": {
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"\"revert\" restores metadata fields to the values recorded in the audit log\n" +
+					"\n" +
+					"The changes to revert are selected from the audit log with the same filters\n" +
+					"that the history command uses; at least one filter is required. When a field\n" +
+					"was changed more than once, it is restored to the value it held before the\n" +
+					"earliest selected change. Before a track is changed, it is backed up to the\n" +
+					"central backup store, as the rewrite command's --backupStore flag does; a track\n" +
+					"that cannot be backed up is not changed.\n" +
+					"\n" +
+					"A track is not changed if any of its selected fields no longer holds the\n" +
+					"value that the recorded change wrote; the field has been changed since, and\n" +
+					"restoring it would lose that change. Each restored field is recorded in the\n" +
+					"audit log.\n" +
+					"\n" +
+					"Usage:\n" +
+					"  revert [--artist regex] [--album regex] [--track regex] [--field field] [--from date] [--to date] " +
+					"[--dryRun] [--maxOpenFiles count]\n" +
+					"\n" +
+					"Examples:\n" +
+					"revert --album \"^Abbey Road$\" --field year --dryRun\n" +
+					"  Lists the year changes to the tracks on Abbey Road that would be reverted\n" +
+					"revert --from 2026-10-18 --to 2026-10-18\n" +
+					"  Reverts every change made on October 18, 2026\n" +
+					"\n" +
+					"Flags:\n" +
+					"      --album string       regular expression specifying which albums to revert changes for; if " +
+					"empty, all albums (default \"\")\n" +
+					"      --artist string      regular expression specifying which artists to revert changes for; if " +
+					"empty, all artists (default \"\")\n" +
+					"      --dryRun             output what would have been reverted, but changes no files (default " +
+					"false)\n" +
+					"      --field string       the field to revert changes for: one of album, artist, genre, mcdi, " +
+					"number, title, year; if empty, all fields (default \"\")\n" +
+					"      --from string        the earliest date (YYYY-MM-DD) to revert changes for; if empty, the " +
+					"log's beginning (default \"\")\n" +
+					"      --maxOpenFiles int   the maximum number of files that can be read simultaneously (at least 1, " +
+					"at most 32767, default 1000) (default 1000)\n" +
+					"      --to string          the latest date (YYYY-MM-DD) to revert changes for; if empty, the " +
+					"present (default \"\")\n" +
+					"      --track string       regular expression specifying which tracks to revert changes for; if " +
+					"empty, all tracks (default \"\")\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			enableCommandRecording(o, commandUnderTest)
+			_ = commandUnderTest.Help()
+			o.Report(t, "revert Help()", tt.WantedRecording)
+		})
+	}
+}
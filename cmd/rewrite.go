@@ -1,12 +1,17 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"mp3repair/internal/files"
 	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
 
+	"github.com/cheggaaa/pb/v3"
 	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
 
 	"github.com/majohn-r/output"
@@ -18,14 +23,44 @@ Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
 */
 
 const (
-	rewriteCommandName = "rewrite"
-	rewriteDryRun      = "dryRun"
-	rewriteDryRunFlag  = "--" + rewriteDryRun
+	rewriteCommandName     = "rewrite"
+	rewriteAtomic          = "atomic"
+	rewriteAtomicFlag      = "--" + rewriteAtomic
+	rewriteBackupStore     = "backupStore"
+	rewriteBackupStoreFlag = "--" + rewriteBackupStore
+	rewriteCreateTags      = "createTags"
+	rewriteCreateTagsFlag  = "--" + rewriteCreateTags
+	rewriteDryRun          = "dryRun"
+	rewriteDryRunFlag      = "--" + rewriteDryRun
+	// rewriteRepair is the name of the flag that repairs ID3V2 tag structure
+	rewriteRepair     = "repairStructure"
+	rewriteRepairFlag = "--" + rewriteRepair
+	rewriteTagsNone   = "none"
+	rewriteTagsID3V1  = "id3v1"
+	rewriteTagsID3V2  = "id3v2"
+	rewriteTagsBoth   = "both"
+	// rewriteStagingSuffix is appended to the names of the files to which an
+	// album's tracks are rewritten before they are renamed into place
+	rewriteStagingSuffix = "-staged"
+)
+
+var (
+	rewriteTagChoices = []string{rewriteTagsNone, rewriteTagsID3V1, rewriteTagsID3V2, rewriteTagsBoth}
+	// rewriteTagSources maps the createTags values to metadata source names
+	rewriteTagSources = map[string][]string{
+		rewriteTagsNone:  nil,
+		rewriteTagsID3V1: {"ID3V1"},
+		rewriteTagsID3V2: {"ID3V2"},
+		rewriteTagsBoth:  {"ID3V1", "ID3V2"},
+	}
 )
 
 var (
 	rewriteCmd = &cobra.Command{
-		Use:                   rewriteCommandName + " [" + rewriteDryRunFlag + "] " + searchUsage + " " + ioUsage,
+		Use: rewriteCommandName + " [" + rewriteDryRunFlag + "] [" + rewriteAtomicFlag + "] [" +
+			rewriteBackupStoreFlag + "] [" + rewriteCreateTagsFlag + " tags] [" + rewriteRepairFlag + "] [" +
+			suppressionsFileFlag + " file] [" + framePolicyFileFlag + " file] " +
+			searchUsage + " " + ioUsage + " " + namesUsage + " " + id3v2Usage,
 		DisableFlagsInUseLine: true,
 		Short: "Rewrites files with problems found by running '" + scanCommand + " " + scanFilesFlag +
 			"'",
@@ -37,19 +72,110 @@ var (
 			"inconsistent with the file structure. Prior to rewriting an mp3 file, the " + rewriteCommandName + "\n" +
 			"command creates a backup directory for the parent album and copies the" + " original mp3\n" +
 			"file into that backup directory. Use the " + cleanupCommandName + " command to automatically delete\n" +
-			"the backup folders.",
+			"the backup folders. Where the file system supports hard links, the backup is instead\n" +
+			"the original file, hard linked into the backup directory, and the track file is\n" +
+			"replaced by a copy of itself; such backups are noted as hard links.\n" +
+			"\n" +
+			"Each rewritten track is verified: its metadata is read again and must agree with the\n" +
+			"file structure, and its audio must be unchanged. A track that fails verification\n" +
+			"is restored from its backup and counted as a failure.\n" +
+			"\n" +
+			"Albums are rewritten concurrently, each album's tracks in order; the --" + ioOpenFileLimit + "\n" +
+			"flag limits how many files are open at once. The output is written album by album.\n" +
+			"If interrupted (Ctrl+C), no further tracks are rewritten; the tracks being\n" +
+			"rewritten are finished, and the tracks that were not rewritten are counted.\n" +
+			"\n" +
+			"Use " + rewriteAtomicFlag + " to rewrite each album as a whole: its tracks are rewritten to\n" +
+			"temporary files, which replace the track files only if every track was rewritten\n" +
+			"and verified. Otherwise, none of the album's track files are changed, and the album\n" +
+			"is reported as a single failure. This keeps an album from being left with some\n" +
+			"tracks fixed and others not, such as with mixed album names or years.\n" +
+			"\n" +
+			"Use " + rewriteBackupStoreFlag + " to back up the track files to a central backup store in the\n" +
+			"application data directory, rather than to each album's backup directory. The\n" +
+			"store keeps every backup of a track, named for the hash of its content, so that\n" +
+			"identical files are stored once; its manifest records each backup's original\n" +
+			"path, time, and reason. Use the " + cleanupCommandName + " command to delete old backups.\n" +
+			"\n" +
+			"A track file with no ID3V1 or no ID3V2 metadata cannot be rewritten, as there is no\n" +
+			"tag to correct; use " + rewriteCreateTagsFlag + " to create the missing tags. The artist, album,\n" +
+			"track name, and track number are taken from the track's directory and file\n" +
+			"names, and the genre, year, and music CD identifier from the values shared by\n" +
+			"the album's other tracks.\n" +
+			"\n" +
+			"Rewritten and newly created ID3V2 tags use the ID3V2 version and text encoding set\n" +
+			"by " + id3v2VersionFlag + " and " + id3v2EncodingFlag + "; tracks whose ID3V2 tags use a different\n" +
+			"version or encoding are rewritten, even if their metadata is otherwise correct.\n" +
+			"Converting a tag between versions 2.3 and 2.4 moves the recording date between the\n" +
+			"TYER and TDAT frames and the TDRC frame.\n" +
+			"\n" +
+			"Use " + rewriteRepairFlag + " to rewrite ID3V2 tags with structural defects, such as\n" +
+			"several tags stacked at the start of the file, a tag appended to its end, ID3V2.4\n" +
+			"frame sizes that are not synchsafe, or oversized padding, as a single clean tag at\n" +
+			"the start of the file. Frames found only in the additional tags are kept.\n" +
+			"\n" +
+			"The ID3V2 frames that the " + framePolicyFileFlag + " file does not permit, and duplicated text\n" +
+			"frames, are removed; see '" + scanCommand + " --help'.\n" +
+			"\n" +
+			"Fields covered by the files and metadata conflict entries of the " + suppressionsFileFlag + " file are\n" +
+			"not rewritten; see '" + scanCommand + " --help'.\n" +
+			"\n" +
+			"Each field change is recorded in the audit log; see '" + historyCommandName + " --help'.",
 		Example: rewriteCommandName + " " + rewriteDryRunFlag + "\n" +
-			"  Output what would be rewritten, but does not rewrite the files",
+			"  Output what would be rewritten, but does not rewrite the files\n" +
+			rewriteCommandName + " " + rewriteAtomicFlag + "\n" +
+			"  Rewrite the files, changing none of an album's files unless all of them can be rewritten\n" +
+			rewriteCommandName + " " + rewriteBackupStoreFlag + "\n" +
+			"  Rewrite the files, backing them up to the central backup store\n" +
+			rewriteCommandName + " " + rewriteCreateTagsFlag + " " + rewriteTagsBoth + "\n" +
+			"  Rewrite the files, first creating any missing ID3V1 and ID3V2 tags\n" +
+			rewriteCommandName + " " + rewriteRepairFlag + "\n" +
+			"  Rewrite the files, first repairing the structure of any defective ID3V2 tags\n" +
+			rewriteCommandName + " " + id3v2VersionFlag + " " + id3v2Version3 + " " + id3v2EncodingFlag + " " +
+			id3v2ISO + "\n" +
+			"  Rewrite the files, converting their ID3V2 tags to version 2.3, with ISO-8859-1 text\n" +
+			"  wherever possible",
 		RunE: rewriteRun,
 	}
 	rewriteFlags = &cmdtoolkit.FlagSet{
 		Name: rewriteCommandName,
 		Details: map[string]*cmdtoolkit.FlagDetails{
+			rewriteAtomic: {
+				Usage:        "rewrite each album's tracks together, changing none of them unless all can be rewritten",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+			rewriteBackupStore: {
+				Usage:        "back up the tracks to the central backup store, rather than to each album's backup directory",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
 			"dryRun": {
 				Usage:        "output what would have been rewritten, but rewrites no files",
 				ExpectedType: cmdtoolkit.BoolType,
 				DefaultValue: false,
 			},
+			rewriteCreateTags: {
+				Usage: fmt.Sprintf("create the missing tags of track files: %s, %s, %s, or %s",
+					rewriteTagsNone, rewriteTagsID3V1, rewriteTagsID3V2, rewriteTagsBoth),
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: rewriteTagsNone,
+			},
+			rewriteRepair: {
+				Usage:        "rewrite structurally defective ID3V2 tags as a single clean tag",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+			suppressionsFile: {
+				Usage:        suppressionsUsage,
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			framePolicyFile: {
+				Usage:        framePolicyUsage,
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
 		},
 	}
 )
@@ -57,23 +183,37 @@ var (
 func rewriteRun(cmd *cobra.Command, _ []string) error {
 	exitError := cmdtoolkit.NewExitProgrammingError(rewriteCommandName)
 	o := getBus()
+	ctx := commandContext(cmd)
 	producer := cmd.Flags()
 	values, eSlice := cmdtoolkit.ReadFlags(producer, rewriteFlags)
 	ss, searchFlagsOk := evaluateSearchFlags(o, producer)
 	ios, ioFlagsOk := evaluateIOFlags(o, producer)
-	if cmdtoolkit.ProcessFlagErrors(o, eSlice) && searchFlagsOk && ioFlagsOk {
+	ns, namesFlagsOk := evaluateNamesFlags(o, producer)
+	is, id3v2FlagsOk := evaluateID3V2Flags(o, producer)
+	if cmdtoolkit.ProcessFlagErrors(o, eSlice) && searchFlagsOk && ioFlagsOk && namesFlagsOk && id3v2FlagsOk {
+		is.apply()
 		if rs, flagsOk := processRewriteFlags(o, values); flagsOk {
-			exitError = rs.processArtists(o, ss.load(o), ss, ios)
+			rs.names = ns.equivalence
+			exitError = rs.processArtists(ctx, o, ss.load(ctx, o), ss, ios)
 		}
 	}
 	return cmdtoolkit.ToErrorInterface(exitError)
 }
 
 type rewriteSettings struct {
-	dryRun cmdtoolkit.CommandFlag[bool]
+	atomic          cmdtoolkit.CommandFlag[bool]
+	backupStore     cmdtoolkit.CommandFlag[bool]
+	dryRun          cmdtoolkit.CommandFlag[bool]
+	repairStructure cmdtoolkit.CommandFlag[bool]
+	suppressions    *suppressions
+	framePolicy     *framePolicies
+	names           files.NameEquivalence
+	// the names of the metadata sources whose missing tags are to be created
+	createTags []string
 }
 
 func (rs *rewriteSettings) processArtists(
+	ctx context.Context,
 	o output.Bus,
 	allArtists []*files.Artist,
 	ss *searchSettings,
@@ -82,18 +222,27 @@ func (rs *rewriteSettings) processArtists(
 	e = cmdtoolkit.NewExitUserError(rewriteCommandName)
 	if len(allArtists) != 0 {
 		if filteredArtists := ss.filter(o, allArtists); len(filteredArtists) != 0 {
-			e = rs.rewriteArtists(o, filteredArtists, ios)
+			e = rs.rewriteArtists(ctx, o, filteredArtists, ios)
 		}
 	}
 	return
 }
 
 func (rs *rewriteSettings) rewriteArtists(
-	o output.Bus, artists []*files.Artist, ios *ioSettings) *cmdtoolkit.ExitError {
+	ctx context.Context, o output.Bus, artists []*files.Artist, ios *ioSettings) *cmdtoolkit.ExitError {
 	// read all track metadata
-	readMetadata(o, artists, ios.openFileLimit)
+	applyNameEquivalence(artists, rs.names)
+	readMetadata(ctx, o, artists, ios.openFileLimit)
+	if ctx.Err() != nil {
+		return nil
+	}
+	if rs.suppressions != nil {
+		rs.suppressions.suppressFields(artists, currentTime())
+	}
 	concernedArtists := createConcernedArtists(artists)
-	count := findConflictedTracks(concernedArtists)
+	count := findConflictedTracks(concernedArtists) + findUntaggedTracks(concernedArtists, rs.createTags) +
+		findMisformattedTracks(concernedArtists) + findUncleanTracks(concernedArtists, rs.framePolicy) +
+		findDefectiveTracks(concernedArtists, rs.repairStructure.Value)
 	if rs.dryRun.Value {
 		reportRewritesNeeded(o, concernedArtists)
 		return nil
@@ -102,7 +251,11 @@ func (rs *rewriteSettings) rewriteArtists(
 		nothingToDo(o)
 		return nil
 	}
-	return backupAndRewriteTracks(o, concernedArtists)
+	var store *backupStore
+	if rs.backupStore.Value {
+		store = newBackupStore()
+	}
+	return backupAndRewriteTracks(ctx, o, concernedArtists, ios.openFileLimit, rs.atomic.Value, store)
 }
 
 func findConflictedTracks(concernedArtists []*concernedArtist) int {
@@ -151,6 +304,121 @@ func findConflictedTracks(concernedArtists []*concernedArtist) int {
 	return count
 }
 
+// findUntaggedTracks notes the tracks whose files lack tags that are to be
+// created, and returns how many of them had no other concerns
+func findUntaggedTracks(concernedArtists []*concernedArtist, createTags []string) int {
+	count := 0
+	if len(createTags) == 0 {
+		return count
+	}
+	for _, cAr := range concernedArtists {
+		for _, cAl := range cAr.albums() {
+			for _, cT := range cAl.tracks() {
+				var missing []string
+				for _, name := range cT.backing.MissingTags() {
+					if slices.Contains(createTags, name) {
+						missing = append(missing, name)
+					}
+				}
+				if len(missing) == 0 {
+					continue
+				}
+				if !cT.isConcerned() {
+					count++
+				}
+				for _, name := range missing {
+					cT.addConcern(conflictConcern, fmt.Sprintf("the track file has no %s metadata", name))
+				}
+				cT.createTags = missing
+			}
+		}
+	}
+	return count
+}
+
+// findMisformattedTracks notes the tracks whose ID3V2 tags do not use the
+// configured ID3V2 version and text encoding, and returns how many of them had
+// no other concerns
+func findMisformattedTracks(concernedArtists []*concernedArtist) int {
+	count := 0
+	for _, cAr := range concernedArtists {
+		for _, cAl := range cAr.albums() {
+			for _, cT := range cAl.tracks() {
+				problems := cT.backing.ID3V2FormatProblems()
+				if len(problems) == 0 {
+					continue
+				}
+				if !cT.isConcerned() {
+					count++
+				}
+				for _, problem := range problems {
+					cT.addConcern(conflictConcern, problem)
+				}
+				cT.reformat = true
+			}
+		}
+	}
+	return count
+}
+
+// findUncleanTracks notes the tracks whose ID3V2 tags contain frames that the
+// frame policy does not permit, or duplicated text frames, and returns how
+// many of them had no other concerns
+func findUncleanTracks(concernedArtists []*concernedArtist, policies *framePolicies) int {
+	count := 0
+	if policies == nil {
+		return count
+	}
+	for _, cAr := range concernedArtists {
+		policy := policies.forArtist(cAr.name())
+		// missing frames cannot be supplied by rewriting
+		removable := files.FramePolicy{Allow: policy.Allow, Deny: policy.Deny}
+		for _, cAl := range cAr.albums() {
+			for _, cT := range cAl.tracks() {
+				if !cT.backing.HasRemovableFrames(removable) {
+					continue
+				}
+				if !cT.isConcerned() {
+					count++
+				}
+				for _, violation := range cT.backing.FramePolicyViolations(removable) {
+					cT.addConcern(conflictConcern, violation)
+				}
+				cT.framePolicy = &removable
+			}
+		}
+	}
+	return count
+}
+
+// findDefectiveTracks notes the tracks whose ID3V2 tags have structural
+// defects, if they are to be repaired, and returns how many of them had no
+// other concerns
+func findDefectiveTracks(concernedArtists []*concernedArtist, repair bool) int {
+	count := 0
+	if !repair {
+		return count
+	}
+	for _, cAr := range concernedArtists {
+		for _, cAl := range cAr.albums() {
+			for _, cT := range cAl.tracks() {
+				defects := cT.backing.ID3V2StructureDefects()
+				if len(defects) == 0 {
+					continue
+				}
+				if !cT.isConcerned() {
+					count++
+				}
+				for _, defect := range defects {
+					cT.addConcern(conflictConcern, defect)
+				}
+				cT.repairStructure = true
+			}
+		}
+	}
+	return count
+}
+
 func reportRewritesNeeded(o output.Bus, concernedArtists []*concernedArtist) {
 	artistNames := make([]string, 0, len(concernedArtists))
 	artistMap := map[string]*concernedArtist{}
@@ -181,8 +449,43 @@ func nothingToDo(o output.Bus) {
 	o.ConsolePrintln("No rewritable track defects were found.")
 }
 
-func backupAndRewriteTracks(o output.Bus, concernedArtists []*concernedArtist) *cmdtoolkit.ExitError {
-	var e *cmdtoolkit.ExitError
+// albumRewrite is the work of backing up and rewriting an album's concerned
+// tracks; its output is held until all the albums have been rewritten
+type albumRewrite struct {
+	album *concernedAlbum
+	// whether the album's tracks are all rewritten, or none are
+	atomic bool
+	// the backup store to which the tracks are backed up; if nil, they are
+	// backed up to the album's backup directory
+	store     *backupStore
+	bus       *deferredBus
+	tracks    int
+	rewritten int
+	// the number of tracks that were neither rewritten nor attempted, because
+	// the rewrite was interrupted
+	skipped int
+	err     *cmdtoolkit.ExitError
+}
+
+// backupAndRewriteTracks backs up and rewrites the concerned tracks. Albums are
+// rewritten concurrently, each album's tracks in order; as each worker has at
+// most two files open at a time, while backing up a track, the number of
+// workers is half the open file limit. The output is written album by album,
+// followed by a summary. If the context is cancelled, no further tracks are
+// rewritten; the tracks being rewritten are allowed to finish, and the summary
+// reports the tracks that were skipped. If atomic is true, each album's tracks
+// are all rewritten, or none are. If store is not nil, the tracks are backed up
+// to it, rather than to their albums' backup directories.
+func backupAndRewriteTracks(
+	ctx context.Context,
+	o output.Bus,
+	concernedArtists []*concernedArtist,
+	fileLimit int,
+	atomic bool,
+	store *backupStore,
+) *cmdtoolkit.ExitError {
+	var work []*albumRewrite
+	count := 0
 	for _, cAr := range concernedArtists {
 		if !cAr.isConcerned() {
 			continue
@@ -191,31 +494,439 @@ func backupAndRewriteTracks(o output.Bus, concernedArtists []*concernedArtist) *
 			if !cAl.isConcerned() {
 				continue
 			}
-			path, exists := ensureTrackBackupDirectoryExists(o, cAl)
-			if !exists {
-				e = cmdtoolkit.NewExitSystemError(rewriteCommandName)
-				continue
-			}
+			aR := &albumRewrite{album: cAl, atomic: atomic, store: store, bus: newDeferredBus(o)}
 			for _, cT := range cAl.concernedTracks {
-				if !cT.isConcerned() {
-					continue
-				}
-				t := cT.backing
-				if !tryTrackBackup(o, t, path) {
-					e = cmdtoolkit.NewExitSystemError(rewriteCommandName)
-					continue
-				}
-				err := t.UpdateMetadata()
-				if e2 := processTrackRewriteResults(o, t, err); e2 != nil {
-					e = e2
+				if cT.isConcerned() {
+					aR.tracks++
 				}
 			}
+			count += aR.tracks
+			work = append(work, aR)
+		}
+	}
+	o.ErrorPrintln("Rewriting tracks.")
+	bar := files.NewTrackProgressBar(o, count)
+	workers := make(chan struct{}, max(1, fileLimit/2))
+	var wg sync.WaitGroup
+	for _, aR := range work {
+		// block while all workers are busy
+		select {
+		case workers <- struct{}{}:
+		case <-ctx.Done():
+			aR.skipped = aR.tracks
+			continue
+		}
+		wg.Go(func() {
+			defer func() {
+				<-workers
+			}()
+			if aR.atomic {
+				aR.rewriteAtomically(ctx, bar)
+				return
+			}
+			aR.rewrite(ctx, bar)
+		})
+	}
+	wg.Wait()
+	bar.Finish()
+	var e *cmdtoolkit.ExitError
+	rewritten := 0
+	skipped := 0
+	for _, aR := range work {
+		aR.bus.flush()
+		rewritten += aR.rewritten
+		skipped += aR.skipped
+		if aR.err != nil {
+			e = aR.err
 		}
 	}
+	o.ConsolePrintf("%d of %d tracks rewritten.\n", rewritten, count)
+	if skipped != 0 {
+		o.ErrorPrintf("The rewrite was interrupted; %d tracks were not rewritten.\n", skipped)
+		o.Log(output.Info, "rewrite interrupted", map[string]any{
+			"command":   rewriteCommandName,
+			"rewritten": rewritten,
+			"skipped":   skipped,
+		})
+	}
 	return e
 }
 
-func processTrackRewriteResults(o output.Bus, t *files.Track, updateErrs []error) *cmdtoolkit.ExitError {
+// rewrite backs up and rewrites the album's concerned tracks, in order, until
+// the context is cancelled
+func (aR *albumRewrite) rewrite(ctx context.Context, bar *pb.ProgressBar) {
+	// the worker may have been started just as the context was cancelled
+	if ctx.Err() != nil {
+		aR.skipped = aR.tracks
+		return
+	}
+	backup, ok := aR.trackBackup()
+	if !ok {
+		aR.err = cmdtoolkit.NewExitSystemError(rewriteCommandName)
+		bar.Add(aR.tracks)
+		return
+	}
+	for _, cT := range aR.album.concernedTracks {
+		if !cT.isConcerned() {
+			continue
+		}
+		if ctx.Err() != nil {
+			aR.skipped++
+			continue
+		}
+		if e := rewriteTrack(aR.bus, cT, backup); e != nil {
+			aR.err = e
+		} else {
+			aR.rewritten++
+		}
+		bar.Increment()
+	}
+}
+
+// stagedTrack is a track that has been rewritten to a staging file, which is to
+// replace the track file once all the album's tracks have been rewritten
+type stagedTrack struct {
+	track  *files.Track
+	staged *files.Track
+	// the track file before it was rewritten
+	baseline rewriteBaseline
+	// the backup of the track file
+	backupFile string
+	// the metadata changes to be recorded once the staging file replaces the
+	// track file
+	changes []files.MetadataChange
+}
+
+// stagingBus discards the console output written while rewriting staging
+// files, whose names mean nothing to the user; errors and log entries are
+// passed on
+type stagingBus struct {
+	output.Bus
+}
+
+func (stagingBus) ConsolePrintf(string, ...any) {}
+
+func (stagingBus) ConsolePrintln(string) {}
+
+// rewriteAtomically backs up the album's concerned tracks and rewrites them to
+// staging files; only if every track is rewritten and verified do the staging
+// files replace the track files. Otherwise, or if the context is cancelled
+// before all the tracks are rewritten, the staging files are removed and the
+// album is left untouched.
+func (aR *albumRewrite) rewriteAtomically(ctx context.Context, bar *pb.ProgressBar) {
+	// the worker may have been started just as the context was cancelled
+	if ctx.Err() != nil {
+		aR.skipped = aR.tracks
+		return
+	}
+	backup, ok := aR.trackBackup()
+	if !ok {
+		aR.err = cmdtoolkit.NewExitSystemError(rewriteCommandName)
+		bar.Add(aR.tracks)
+		return
+	}
+	var staged []*stagedTrack
+	attempted := 0
+	for _, cT := range aR.album.concernedTracks {
+		if !cT.isConcerned() {
+			continue
+		}
+		if ctx.Err() != nil {
+			discardStagedTracks(aR.bus, staged)
+			aR.skipped = aR.tracks
+			bar.Add(aR.tracks - attempted)
+			return
+		}
+		sT, ok := stageTrack(aR.bus, cT, backup)
+		attempted++
+		bar.Increment()
+		if sT != nil {
+			staged = append(staged, sT)
+		}
+		if !ok {
+			discardStagedTracks(aR.bus, staged)
+			aR.reportFailure()
+			bar.Add(aR.tracks - attempted)
+			return
+		}
+	}
+	if !commitStagedTracks(aR.bus, staged) {
+		aR.reportFailure()
+		return
+	}
+	for _, sT := range staged {
+		aR.bus.ConsolePrintf("%q rewritten.\n", sT.track)
+		if e := auditRewrite(aR.bus, sT.track, sT.changes); e != nil {
+			aR.err = e
+		}
+	}
+	aR.rewritten = len(staged)
+}
+
+// reportFailure reports that none of the album's tracks were rewritten
+func (aR *albumRewrite) reportFailure() {
+	aR.err = cmdtoolkit.NewExitSystemError(rewriteCommandName)
+	album := aR.album.backing
+	aR.bus.ErrorPrintf("The album %q was not rewritten; none of its %d track files were changed.\n",
+		album.Directory(), aR.tracks)
+	aR.bus.Log(output.Error, "album not rewritten", map[string]any{
+		"command":   rewriteCommandName,
+		"directory": album.Directory(),
+		"tracks":    aR.tracks,
+	})
+}
+
+// stageTrack backs up the track, copies it to a staging file, and rewrites and
+// verifies the staging file. The staged track is returned if the staging file
+// was created, even if it could not be rewritten, so that it can be removed.
+func stageTrack(o output.Bus, cT *concernedTrack, backup trackBackup) (*stagedTrack, bool) {
+	t := cT.backing
+	backupFile, backedUp := backup(o, cT)
+	if !backedUp {
+		return nil, false
+	}
+	baseline, baselineOk := newRewriteBaseline(o, t)
+	if !baselineOk {
+		return nil, false
+	}
+	sT := &stagedTrack{
+		track:      t,
+		staged:     t.StagingCopy(t.FileName() + rewriteStagingSuffix),
+		baseline:   baseline,
+		backupFile: backupFile,
+	}
+	if copyErr := copyFile(t.Path(), sT.staged.Path()); copyErr != nil {
+		o.ErrorPrintf("The track file %q could not be copied to %q: %s.\n", t, sT.staged,
+			cmdtoolkit.ErrorToString(copyErr))
+		o.Log(output.Error, "error copying file", map[string]any{
+			"command":     rewriteCommandName,
+			"source":      t.Path(),
+			"destination": sT.staged.Path(),
+			"error":       copyErr,
+		})
+		return nil, false
+	}
+	stagedCT := *cT
+	stagedCT.backing = sT.staged
+	if e := applyTrackRewrite(stagingBus{Bus: o}, &stagedCT, collectChanges(&sT.changes)); e != nil {
+		return sT, false
+	}
+	if verifyErr := verifyRewrite(sT.staged, baseline.checksum); verifyErr != nil {
+		o.ErrorPrintf("The rewritten track %q failed verification: %s.\n", t, cmdtoolkit.ErrorToString(verifyErr))
+		o.Log(output.Error, "rewritten track failed verification", map[string]any{
+			"command":   rewriteCommandName,
+			"directory": t.Directory(),
+			"error":     verifyErr,
+			"fileName":  sT.staged.FileName(),
+		})
+		return sT, false
+	}
+	return sT, true
+}
+
+// commitStagedTracks renames the staging files into place. If a staging file
+// cannot be renamed, the track files already replaced are restored from their
+// backups, and the remaining staging files are removed.
+func commitStagedTracks(o output.Bus, staged []*stagedTrack) bool {
+	for k, sT := range staged {
+		renameErr := rename(sT.staged.Path(), sT.track.Path())
+		if renameErr == nil {
+			sT.track.ReloadMetadata()
+			continue
+		}
+		o.ErrorPrintf("The file %q cannot be renamed to %q: %s.\n", sT.staged, sT.track,
+			cmdtoolkit.ErrorToString(renameErr))
+		o.Log(output.Error, "rename failed", map[string]any{
+			"command": rewriteCommandName,
+			"error":   renameErr,
+			"old":     sT.staged.Path(),
+			"new":     sT.track.Path(),
+		})
+		for _, replaced := range staged[:k] {
+			restoreErr := restoreFromBackup(replaced.track, replaced.backupFile, replaced.baseline)
+			if restoreErr != nil {
+				o.ErrorPrintf("The track file %q could not be restored from %q: %s.\n", replaced.track,
+					replaced.backupFile, cmdtoolkit.ErrorToString(restoreErr))
+				o.Log(output.Error, "cannot restore track", map[string]any{
+					"backup":    replaced.backupFile,
+					"command":   rewriteCommandName,
+					"directory": replaced.track.Directory(),
+					"error":     restoreErr,
+					"fileName":  replaced.track.FileName(),
+				})
+			}
+			replaced.track.ReloadMetadata()
+		}
+		discardStagedTracks(o, staged[k:])
+		return false
+	}
+	return true
+}
+
+// discardStagedTracks removes the staging files; the tracks' metadata, which
+// the staged tracks share, is read again from the untouched track files
+func discardStagedTracks(o output.Bus, staged []*stagedTrack) {
+	for _, sT := range staged {
+		if removeErr := remove(sT.staged.Path()); removeErr != nil && !errors.Is(removeErr, fs.ErrNotExist) {
+			o.ErrorPrintf("The file %q cannot be deleted: %s.\n", sT.staged, cmdtoolkit.ErrorToString(removeErr))
+			o.Log(output.Error, "cannot delete file", map[string]any{
+				"command": rewriteCommandName,
+				"error":   removeErr,
+				"file":    sT.staged.Path(),
+			})
+		}
+		sT.track.ReloadMetadata()
+	}
+}
+
+// deferringBus holds back the console output of a track's rewrite, so that
+// what was done to the track is reported only once the rewritten track has
+// been verified; the rest of the output is passed on
+type deferringBus struct {
+	output.Bus
+	lines []string
+}
+
+func (b *deferringBus) ConsolePrintf(format string, a ...any) {
+	b.lines = append(b.lines, fmt.Sprintf(format, a...))
+}
+
+func (b *deferringBus) ConsolePrintln(s string) {
+	b.lines = append(b.lines, s+"\n")
+}
+
+// flush writes the console output held back
+func (b *deferringBus) flush() {
+	for _, line := range b.lines {
+		b.Bus.ConsolePrintf("%s", line)
+	}
+	b.lines = nil
+}
+
+// rewriteTrack backs up, rewrites, and verifies a single track. If the
+// rewritten track fails verification, it is restored from the backup; what was
+// done to the track is reported, and the metadata changes are recorded in the
+// audit log, only if it passes.
+func rewriteTrack(o output.Bus, cT *concernedTrack, backup trackBackup) *cmdtoolkit.ExitError {
+	t := cT.backing
+	backupFile, backedUp := backup(o, cT)
+	if !backedUp {
+		return cmdtoolkit.NewExitSystemError(rewriteCommandName)
+	}
+	baseline, baselineOk := newRewriteBaseline(o, t)
+	if !baselineOk {
+		return cmdtoolkit.NewExitSystemError(rewriteCommandName)
+	}
+	// a write that failed may have left the track file half-written, so the
+	// track is verified regardless
+	var changes []files.MetadataChange
+	deferred := &deferringBus{Bus: o}
+	e := applyTrackRewrite(deferred, cT, collectChanges(&changes))
+	if verifyErr := verifyRewrite(t, baseline.checksum); verifyErr != nil {
+		restoreTrack(o, t, backupFile, baseline, verifyErr)
+		return cmdtoolkit.NewExitSystemError(rewriteCommandName)
+	}
+	deferred.flush()
+	if auditErr := auditRewrite(o, t, changes); auditErr != nil && e == nil {
+		e = auditErr
+	}
+	return e
+}
+
+// rewriteBaseline records the track file as it was before it was rewritten
+type rewriteBaseline struct {
+	// the checksum of the track's audio, against which the rewritten track is
+	// verified
+	checksum string
+	// the hash of the whole track file, against which its backup is checked
+	// before the track is restored from it
+	fileHash string
+}
+
+// newRewriteBaseline records the track file before it is rewritten
+func newRewriteBaseline(o output.Bus, t *files.Track) (rewriteBaseline, bool) {
+	checksum, checksumErr := audioChecksum(t.Path())
+	if checksumErr != nil {
+		o.ErrorPrintf("The audio checksum of track %q cannot be computed: %s.\n", t,
+			cmdtoolkit.ErrorToString(checksumErr))
+		o.ErrorPrintf("The track file %q will not be rewritten.\n", t)
+		o.Log(output.Error, "cannot compute audio checksum", map[string]any{
+			"command":   rewriteCommandName,
+			"directory": t.Directory(),
+			"error":     checksumErr,
+			"fileName":  t.FileName(),
+		})
+		return rewriteBaseline{}, false
+	}
+	fileHash, _, hashErr := hashFile(t.Path())
+	if hashErr != nil {
+		o.ErrorPrintf("The track file %q cannot be read: %s.\n", t, cmdtoolkit.ErrorToString(hashErr))
+		o.ErrorPrintf("The track file %q will not be rewritten.\n", t)
+		o.Log(output.Error, "cannot read file", map[string]any{
+			"command":   rewriteCommandName,
+			"directory": t.Directory(),
+			"error":     hashErr,
+			"fileName":  t.FileName(),
+		})
+		return rewriteBaseline{}, false
+	}
+	return rewriteBaseline{checksum: checksum, fileHash: fileHash}, true
+}
+
+// changeRecorder records the metadata changes made to a track
+type changeRecorder func(o output.Bus, t *files.Track, changes []files.MetadataChange) *cmdtoolkit.ExitError
+
+// collectChanges returns a changeRecorder that collects the changes, so that
+// they can be recorded once the rewritten track has been verified
+func collectChanges(changes *[]files.MetadataChange) changeRecorder {
+	return func(_ output.Bus, _ *files.Track, c []files.MetadataChange) *cmdtoolkit.ExitError {
+		*changes = append(*changes, c...)
+		return nil
+	}
+}
+
+// auditRewrite records the changes made to a rewritten track in the audit log
+func auditRewrite(o output.Bus, t *files.Track, changes []files.MetadataChange) *cmdtoolkit.ExitError {
+	return recordMetadataChanges(o, rewriteCommandName, t, changes)
+}
+
+// applyTrackRewrite makes the changes to the track that its concerns call for;
+// the metadata changes are passed to the recorder
+func applyTrackRewrite(o output.Bus, cT *concernedTrack, record changeRecorder) *cmdtoolkit.ExitError {
+	t := cT.backing
+	if cT.repairStructure {
+		if e := repairTrackStructure(o, t); e != nil {
+			return e
+		}
+	}
+	if len(cT.createTags) != 0 {
+		if e := createTrackTags(o, t, cT.createTags, record); e != nil {
+			return e
+		}
+	}
+	if (cT.repairStructure || len(cT.createTags) != 0 || cT.reformat || cT.framePolicy != nil) &&
+		!t.ReconcileMetadata().HasConflicts() {
+		switch {
+		case cT.framePolicy != nil:
+			// removing the frames also converts the tag
+			return cleanTrackFrames(o, t, *cT.framePolicy)
+		case cT.reformat:
+			return reformatTrackTag(o, t)
+		}
+		return nil
+	}
+	err := t.UpdateMetadata()
+	if e := processTrackRewriteResults(o, t, err, record); e != nil {
+		return e
+	}
+	if cT.framePolicy != nil {
+		return cleanTrackFrames(o, t, *cT.framePolicy)
+	}
+	return nil
+}
+
+func processTrackRewriteResults(o output.Bus, t *files.Track, updateErrs []error,
+	record changeRecorder) *cmdtoolkit.ExitError {
 	if len(updateErrs) != 0 {
 		o.ErrorPrintf("An error occurred rewriting track %q.\n", t)
 		errorStrings := make([]string, 0, len(updateErrs))
@@ -232,46 +943,215 @@ func processTrackRewriteResults(o output.Bus, t *files.Track, updateErrs []error
 	}
 	o.ConsolePrintf("%q rewritten.\n", t)
 	markDirty(o)
+	return record(o, t, t.MetadataChanges())
+}
+
+// createTrackTags creates the track file's missing tags and passes the fields
+// written to the recorder
+func createTrackTags(o output.Bus, t *files.Track, createTags []string, record changeRecorder) *cmdtoolkit.ExitError {
+	created, createErrs := t.CreateMissingTags(createTags...)
+	var e *cmdtoolkit.ExitError
+	if len(createErrs) != 0 {
+		o.ErrorPrintf("An error occurred creating metadata for track %q.\n", t)
+		errorStrings := make([]string, 0, len(createErrs))
+		for _, e2 := range createErrs {
+			errorStrings = append(errorStrings, fmt.Sprintf("%q", e2.Error()))
+		}
+		o.Log(output.Error, "cannot create track metadata", map[string]any{
+			"command":   rewriteCommandName,
+			"directory": t.Directory(),
+			"fileName":  t.FileName(),
+			"error":     fmt.Sprintf("[%s]", strings.Join(errorStrings, ", ")),
+		})
+		e = cmdtoolkit.NewExitSystemError(rewriteCommandName)
+	}
+	if len(created) == 0 {
+		return e
+	}
+	o.ConsolePrintf("%q tagged.\n", t)
+	markDirty(o)
+	if e2 := record(o, t, created); e2 != nil && e == nil {
+		e = e2
+	}
+	return e
+}
+
+// reformatTrackTag rewrites the track's ID3V2 tag with the configured ID3V2
+// version and text encoding
+func reformatTrackTag(o output.Bus, t *files.Track) *cmdtoolkit.ExitError {
+	if convertErr := t.ConvertID3V2Tag(); convertErr != nil {
+		o.ErrorPrintf("An error occurred rewriting track %q.\n", t)
+		o.Log(output.Error, "cannot convert ID3V2 tag", map[string]any{
+			"command":   rewriteCommandName,
+			"directory": t.Directory(),
+			"fileName":  t.FileName(),
+			"error":     convertErr,
+		})
+		return cmdtoolkit.NewExitSystemError(rewriteCommandName)
+	}
+	o.ConsolePrintf("%q rewritten.\n", t)
+	markDirty(o)
 	return nil
 }
 
-func tryTrackBackup(o output.Bus, t *files.Track, path string) (backedUp bool) {
-	backupFile := filepath.Join(path, fmt.Sprintf("%d.mp3", t.Number()))
+// repairTrackStructure replaces the track's structurally defective ID3V2 tags
+// with a single clean tag
+func repairTrackStructure(o output.Bus, t *files.Track) *cmdtoolkit.ExitError {
+	if repairErr := t.RepairID3V2Structure(); repairErr != nil {
+		o.ErrorPrintf("An error occurred repairing the ID3V2 tag of track %q.\n", t)
+		o.Log(output.Error, "cannot repair ID3V2 tag", map[string]any{
+			"command":   rewriteCommandName,
+			"directory": t.Directory(),
+			"fileName":  t.FileName(),
+			"error":     repairErr,
+		})
+		return cmdtoolkit.NewExitSystemError(rewriteCommandName)
+	}
+	o.ConsolePrintf("%q: ID3V2 tag structure repaired.\n", t)
+	markDirty(o)
+	return nil
+}
+
+// cleanTrackFrames removes the frames that the frame policy does not permit,
+// and any duplicated text frames, from the track's ID3V2 tag
+func cleanTrackFrames(o output.Bus, t *files.Track, policy files.FramePolicy) *cmdtoolkit.ExitError {
+	removed, cleanErr := t.CleanFrames(policy)
+	if cleanErr != nil {
+		o.ErrorPrintf("An error occurred removing ID3V2 frames from track %q.\n", t)
+		o.Log(output.Error, "cannot remove ID3V2 frames", map[string]any{
+			"command":   rewriteCommandName,
+			"directory": t.Directory(),
+			"fileName":  t.FileName(),
+			"error":     cleanErr,
+		})
+		return cmdtoolkit.NewExitSystemError(rewriteCommandName)
+	}
+	o.ConsolePrintf("%q: ID3V2 frames removed: %s.\n", t, strings.Join(removed, ", "))
+	markDirty(o)
+	return nil
+}
+
+// restoreTrack restores a rewritten track that failed verification from its
+// backup
+func restoreTrack(o output.Bus, t *files.Track, backupFile string, baseline rewriteBaseline, verifyErr error) {
+	o.ErrorPrintf("The rewritten track %q failed verification: %s.\n", t, cmdtoolkit.ErrorToString(verifyErr))
+	o.Log(output.Error, "rewritten track failed verification", map[string]any{
+		"command":   rewriteCommandName,
+		"directory": t.Directory(),
+		"error":     verifyErr,
+		"fileName":  t.FileName(),
+	})
+	if restoreErr := restoreFromBackup(t, backupFile, baseline); restoreErr != nil {
+		o.ErrorPrintf("The track file %q could not be restored from %q: %s.\n", t, backupFile,
+			cmdtoolkit.ErrorToString(restoreErr))
+		o.Log(output.Error, "cannot restore track", map[string]any{
+			"backup":    backupFile,
+			"command":   rewriteCommandName,
+			"directory": t.Directory(),
+			"error":     restoreErr,
+			"fileName":  t.FileName(),
+		})
+		return
+	}
+	t.ReloadMetadata()
+	o.ConsolePrintf("The track file %q has been restored from %q.\n", t, backupFile)
+}
+
+// restoreFromBackup replaces the track file with a copy of the backup; the
+// backup is used only if it is identical to the track file as it was before it
+// was rewritten. The copy is made next to the track file, and is renamed over
+// the track file only once it, too, has been verified to be identical.
+func restoreFromBackup(t *files.Track, backupFile string, baseline rewriteBaseline) error {
+	backupHash, _, hashErr := hashFile(backupFile)
 	switch {
-	case plainFileExists(backupFile):
-		backedUp = true
-		var status string
+	case hashErr != nil:
+		return hashErr
+	case backupHash != baseline.fileHash:
+		return fmt.Errorf("the backup is not a copy of the track file as it was before it was rewritten")
+	}
+	restored := t.Path() + backupPartialSuffix
+	if copyErr := verifiedCopy(backupFile, restored, baseline.fileHash); copyErr != nil {
+		return copyErr
+	}
+	if renameErr := rename(restored, t.Path()); renameErr != nil {
+		_ = remove(restored)
+		return renameErr
+	}
+	return nil
+}
+
+// trackBackup backs up a track before it is rewritten, returning the path of
+// the backup
+type trackBackup func(o output.Bus, cT *concernedTrack) (backupFile string, backedUp bool)
+
+// trackBackup returns the means of backing up the album's tracks: the backup
+// store, if there is one, or else the album's backup directory, which is
+// created if necessary
+func (aR *albumRewrite) trackBackup() (trackBackup, bool) {
+	if aR.store != nil {
+		return aR.store.backupTrack, true
+	}
+	path, exists := ensureTrackBackupDirectoryExists(aR.bus, aR.album)
+	return albumTrackBackup(path), exists
+}
+
+// albumTrackBackup backs up tracks to the specified album backup directory
+func albumTrackBackup(path string) trackBackup {
+	return func(o output.Bus, cT *concernedTrack) (string, bool) {
+		return trackBackupFile(cT.backing, path), tryTrackBackup(o, cT.backing, path)
+	}
+}
+
+// trackBackupFile returns the path of the track's backup in the specified
+// directory
+func trackBackupFile(t *files.Track, path string) string {
+	return filepath.Join(path, fmt.Sprintf("%d.mp3", t.Number()))
+}
+
+// tryTrackBackup backs up the track to the album backup directory. A backup
+// left by an earlier rewrite is replaced, so that the backup is always a copy
+// of the track file as it is just before it is rewritten; the new backup is
+// renamed into place only once it is complete.
+func tryTrackBackup(o output.Bus, t *files.Track, path string) (backedUp bool) {
+	backupFile := trackBackupFile(t, path)
+	var earlier string
+	if plainFileExists(backupFile) {
 		if modTime, err := modificationTime(backupFile); err == nil {
-			status = modTime.Format("2006-01-02 15:04:05")
+			earlier = modTime.Format("2006-01-02 15:04:05")
 		} else {
-			status = fmt.Sprintf("error getting modification time: %v", err)
+			earlier = fmt.Sprintf("error getting modification time: %v", err)
 		}
-		o.Log(output.Info, "file already exists", map[string]any{
-			"command": rewriteCommandName,
-			"file":    backupFile,
-			"modTime": status,
-		})
-	default:
-		copyErr := copyFile(t.Path(), backupFile)
-		switch copyErr {
-		case nil:
-			o.ConsolePrintf("The track file %q has been backed up to %q.\n", t, backupFile)
-			backedUp = true
-		default:
-			o.ErrorPrintf(
-				"The track file %q could not be backed up due to error %s.\n",
-				t,
-				cmdtoolkit.ErrorToString(copyErr),
-			)
-			o.Log(output.Error, "error copying file", map[string]any{
-				"command":     rewriteCommandName,
-				"source":      t.Path(),
-				"destination": backupFile,
-				"error":       copyErr,
+	}
+	partial := backupFile + backupPartialSuffix
+	strategy, copyErr := makeBackup(o, rewriteCommandName, t.Path(), partial)
+	if copyErr == nil {
+		copyErr = rename(partial, backupFile)
+	}
+	switch copyErr {
+	case nil:
+		if earlier != "" {
+			o.Log(output.Info, "earlier backup replaced", map[string]any{
+				"command": rewriteCommandName,
+				"file":    backupFile,
+				"modTime": earlier,
 			})
 		}
-	}
-	if !backedUp {
+		o.ConsolePrintf("The track file %q has been backed up to %q%s.\n", t, backupFile,
+			backupDescription(strategy))
+		backedUp = true
+	default:
+		_ = remove(partial)
+		o.ErrorPrintf(
+			"The track file %q could not be backed up due to error %s.\n",
+			t,
+			cmdtoolkit.ErrorToString(copyErr),
+		)
+		o.Log(output.Error, "error copying file", map[string]any{
+			"command":     rewriteCommandName,
+			"source":      t.Path(),
+			"destination": backupFile,
+			"error":       copyErr,
+		})
 		o.ErrorPrintf("The track file %q will not be rewritten.\n", t)
 	}
 	return
@@ -302,11 +1182,37 @@ func processRewriteFlags(o output.Bus, values map[string]*cmdtoolkit.CommandFlag
 	if rs.dryRun, flagErr = cmdtoolkit.GetBool(o, values, rewriteDryRun); flagErr != nil {
 		flagsOk = false
 	}
+	if rs.repairStructure, flagErr = cmdtoolkit.GetBool(o, values, rewriteRepair); flagErr != nil {
+		flagsOk = false
+	}
+	if rs.atomic, flagErr = cmdtoolkit.GetBool(o, values, rewriteAtomic); flagErr != nil {
+		flagsOk = false
+	}
+	if rs.backupStore, flagErr = cmdtoolkit.GetBool(o, values, rewriteBackupStore); flagErr != nil {
+		flagsOk = false
+	}
+	if sups, suppressionsOk := evaluateSuppressions(o, values); suppressionsOk {
+		rs.suppressions = sups
+	} else {
+		flagsOk = false
+	}
+	if policies, policiesOk := evaluateFramePolicies(o, values); policiesOk {
+		rs.framePolicy = policies
+	} else {
+		flagsOk = false
+	}
+	if choice, choiceOk := evaluateChoice(o, values, rewriteCreateTags, rewriteCreateTagsFlag,
+		rewriteTagChoices); choiceOk {
+		rs.createTags = rewriteTagSources[choice]
+	} else {
+		flagsOk = false
+	}
 	return rs, flagsOk
 }
 
 func init() {
 	rootCmd.AddCommand(rewriteCmd)
 	cmdtoolkit.AddDefaults(rewriteFlags)
-	cmdtoolkit.AddFlags(getBus(), getConfiguration(), rewriteCmd.Flags(), rewriteFlags, searchFlags, ioFlags)
+	cmdtoolkit.AddFlags(getBus(), getConfiguration(), rewriteCmd.Flags(),
+		rewriteFlags, searchFlags, ioFlags, namesFlags, id3v2Flags)
 }
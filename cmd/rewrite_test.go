@@ -4,10 +4,15 @@ Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"mp3repair/internal/files"
+	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -29,18 +34,92 @@ func Test_processRewriteFlags(t *testing.T) {
 			want:   &rewriteSettings{},
 			want1:  false,
 			WantedRecording: output.WantedRecording{
-				Error: "An internal error occurred: flag \"dryRun\" is not found.\n",
+				Error: "" +
+					"An internal error occurred: flag \"dryRun\" is not found.\n" +
+					"An internal error occurred: flag \"repairStructure\" is not found.\n" +
+					"An internal error occurred: flag \"atomic\" is not found.\n" +
+					"An internal error occurred: flag \"backupStore\" is not found.\n" +
+					"An internal error occurred: flag \"suppressions\" is not found.\n" +
+					"An internal error occurred: flag \"framePolicy\" is not found.\n" +
+					"An internal error occurred: flag \"createTags\" is not found.\n",
 				Log: "" +
 					"level='error'" +
 					" error='flag not found'" +
 					" flag='dryRun'" +
+					" msg='internal error'\n" +
+					"level='error'" +
+					" error='flag not found'" +
+					" flag='repairStructure'" +
+					" msg='internal error'\n" +
+					"level='error'" +
+					" error='flag not found'" +
+					" flag='atomic'" +
+					" msg='internal error'\n" +
+					"level='error'" +
+					" error='flag not found'" +
+					" flag='backupStore'" +
+					" msg='internal error'\n" +
+					"level='error'" +
+					" error='flag not found'" +
+					" flag='suppressions'" +
+					" msg='internal error'\n" +
+					"level='error'" +
+					" error='flag not found'" +
+					" flag='framePolicy'" +
+					" msg='internal error'\n" +
+					"level='error'" +
+					" error='flag not found'" +
+					" flag='createTags'" +
 					" msg='internal error'\n",
 			},
 		},
 		"good value": {
-			values: map[string]*cmdtoolkit.CommandFlag[any]{"dryRun": {Value: true}},
-			want:   &rewriteSettings{dryRun: cmdtoolkit.CommandFlag[bool]{Value: true}},
-			want1:  true,
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				"dryRun":          {Value: true},
+				"repairStructure": {Value: false},
+				"atomic":          {Value: false},
+				"backupStore":     {Value: false},
+				"suppressions":    {Value: ""},
+				"framePolicy":     {Value: ""},
+				"createTags":      {Value: "none"},
+			},
+			want:  &rewriteSettings{dryRun: cmdtoolkit.CommandFlag[bool]{Value: true}},
+			want1: true,
+		},
+		"create tags": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				"dryRun":          {Value: false},
+				"repairStructure": {Value: false},
+				"atomic":          {Value: false},
+				"backupStore":     {Value: false},
+				"suppressions":    {Value: ""},
+				"framePolicy":     {Value: ""},
+				"createTags":      {Value: "ID3V2"},
+			},
+			want:  &rewriteSettings{createTags: []string{"ID3V2"}},
+			want1: true,
+		},
+		"bad create tags": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				"dryRun":          {Value: false},
+				"repairStructure": {Value: false},
+				"atomic":          {Value: false},
+				"backupStore":     {Value: false},
+				"suppressions":    {Value: ""},
+				"framePolicy":     {Value: ""},
+				"createTags":      {Value: "id3v3", UserSet: true},
+			},
+			want:  &rewriteSettings{},
+			want1: false,
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"The --createTags value \"id3v3\" cannot be used.\n" +
+					"Why?\n" +
+					"The value is not one of the supported values.\n" +
+					"What to do:\n" +
+					"Use one of these values: none, id3v1, id3v2, both.\n",
+				Log: "level='error' --createTags='id3v3' user-set='true' msg='invalid value'\n",
+			},
 		},
 	}
 	for name, tt := range tests {
@@ -133,11 +212,25 @@ func Test_tryTrackBackup(t *testing.T) {
 	originalPlainFileExists := plainFileExists
 	originalCopyFile := copyFile
 	originalModificationTime := modificationTime
+	originalRename := rename
+	originalRemove := remove
+	originalOpenFile := openFile
 	defer func() {
 		plainFileExists = originalPlainFileExists
 		copyFile = originalCopyFile
 		modificationTime = originalModificationTime
+		rename = originalRename
+		remove = originalRemove
+		openFile = originalOpenFile
 	}()
+	remove = func(_ string) error { return nil }
+	// the track and its copy are read from real files, so that the copy can be
+	// checked
+	dir := t.TempDir()
+	content := filepath.Join(dir, "track")
+	_ = os.WriteFile(content, []byte("track content"), cmdtoolkit.StdFilePermissions)
+	corrupt := filepath.Join(dir, "corrupt")
+	_ = os.WriteFile(corrupt, []byte("track contents"), cmdtoolkit.StdFilePermissions)
 	track := &files.Track{}
 	if tracks := generateTracks(1); len(tracks) > 0 {
 		track = tracks[0]
@@ -151,40 +244,52 @@ func Test_tryTrackBackup(t *testing.T) {
 		plainFileExists  func(path string) bool
 		copyFile         func(src, destination string) error
 		modificationTime func(path string) (time.Time, error)
+		rename           func(oldPath, newPath string) error
+		corruptCopy      bool
 		args
 		wantBackedUp bool
 		output.WantedRecording
 	}{
 		"backup already exists (normal)": {
 			plainFileExists: func(_ string) bool { return true },
+			copyFile:        func(_, _ string) error { return nil },
 			modificationTime: func(_ string) (time.Time, error) {
 				return safeTime, nil
 			},
+			rename:       func(_, _ string) error { return nil },
 			args:         args{t: track, path: "backupDir"},
 			wantBackedUp: true,
 			WantedRecording: output.WantedRecording{
+				Console: "The track file" +
+					" \"Music\\\\my artist\\\\my album 00\\\\1 my track 001.mp3\"" +
+					" has been backed up to \"backupDir\\\\1.mp3\".\n",
 				Log: "" +
 					"level='info'" +
 					" command='rewrite'" +
 					" file='backupDir\\1.mp3'" +
 					" modTime='" + safeTime.Format("2006-01-02 15:04:05") + "'" +
-					" msg='file already exists'\n",
+					" msg='earlier backup replaced'\n",
 			},
 		},
 		"backup already exists (error on modification time": {
 			plainFileExists: func(_ string) bool { return true },
+			copyFile:        func(_, _ string) error { return nil },
 			modificationTime: func(_ string) (time.Time, error) {
 				return safeTime, fmt.Errorf("file disappeared")
 			},
+			rename:       func(_, _ string) error { return nil },
 			args:         args{t: track, path: "backupDir"},
 			wantBackedUp: true,
 			WantedRecording: output.WantedRecording{
+				Console: "The track file" +
+					" \"Music\\\\my artist\\\\my album 00\\\\1 my track 001.mp3\"" +
+					" has been backed up to \"backupDir\\\\1.mp3\".\n",
 				Log: "" +
 					"level='info'" +
 					" command='rewrite'" +
 					" file='backupDir\\1.mp3'" +
 					" modTime='error getting modification time: file disappeared'" +
-					" msg='file already exists'\n",
+					" msg='earlier backup replaced'\n",
 			},
 		},
 		"backup does not exist but copy fails": {
@@ -210,9 +315,58 @@ func Test_tryTrackBackup(t *testing.T) {
 					" msg='error copying file'\n",
 			},
 		},
+		"backup does not match the track": {
+			plainFileExists: func(_ string) bool { return false },
+			copyFile:        func(_, _ string) error { return nil },
+			corruptCopy:     true,
+			args:            args{t: track, path: "backupDir"},
+			wantBackedUp:    false,
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"The track file" +
+					" \"Music\\\\my artist\\\\my album 00\\\\1 my track 001.mp3\"" +
+					" could not be backed up due to error 'the copy of" +
+					" \"Music\\\\my artist\\\\my album 00\\\\1 my track 001.mp3\"" +
+					" does not match the original'.\n" +
+					"The track file" +
+					" \"Music\\\\my artist\\\\my album 00\\\\1 my track 001.mp3\"" +
+					" will not be rewritten.\n",
+				Log: "" +
+					"level='error'" +
+					" command='rewrite'" +
+					" destination='backupDir\\1.mp3'" +
+					" error='the copy of \"Music\\\\my artist\\\\my album 00\\\\1 my track 001.mp3\"" +
+					" does not match the original'" +
+					" source='Music\\my artist\\my album 00\\1 my track 001.mp3'" +
+					" msg='error copying file'\n",
+			},
+		},
+		"backup cannot be renamed into place": {
+			plainFileExists: func(_ string) bool { return false },
+			copyFile:        func(_, _ string) error { return nil },
+			rename:          func(_, _ string) error { return fmt.Errorf("access denied") },
+			args:            args{t: track, path: "backupDir"},
+			wantBackedUp:    false,
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"The track file" +
+					" \"Music\\\\my artist\\\\my album 00\\\\1 my track 001.mp3\"" +
+					" could not be backed up due to error 'access denied'.\n" +
+					"The track file" +
+					" \"Music\\\\my artist\\\\my album 00\\\\1 my track 001.mp3\"" +
+					" will not be rewritten.\n",
+				Log: "" +
+					"level='error'" +
+					" command='rewrite'" +
+					" destination='backupDir\\1.mp3' error='access denied'" +
+					" source='Music\\my artist\\my album 00\\1 my track 001.mp3'" +
+					" msg='error copying file'\n",
+			},
+		},
 		"successful backup": {
 			plainFileExists: func(_ string) bool { return false },
 			copyFile:        func(_, _ string) error { return nil },
+			rename:          func(_, _ string) error { return nil },
 			args:            args{t: track, path: "backupDir"},
 			wantBackedUp:    true,
 			WantedRecording: output.WantedRecording{
@@ -227,6 +381,13 @@ func Test_tryTrackBackup(t *testing.T) {
 			plainFileExists = tt.plainFileExists
 			modificationTime = tt.modificationTime
 			copyFile = tt.copyFile
+			rename = tt.rename
+			openFile = func(path string, flag int, perm os.FileMode) (*os.File, error) {
+				if tt.corruptCopy && strings.HasSuffix(path, backupPartialSuffix) {
+					return os.OpenFile(corrupt, flag, perm)
+				}
+				return os.OpenFile(content, flag, perm)
+			}
 			o := output.NewRecorder()
 			gotBackedUp := tryTrackBackup(o, tt.args.t, tt.args.path)
 			if gotBackedUp != tt.wantBackedUp {
@@ -308,7 +469,7 @@ func Test_processTrackRewriteResults(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			o := output.NewRecorder()
 			markedDirty = false
-			if got := processTrackRewriteResults(o, tt.args.t, tt.args.err); !compareExitErrors(got, tt.wantStatus) {
+			if got := processTrackRewriteResults(o, tt.args.t, tt.args.err, auditRewrite); !compareExitErrors(got, tt.wantStatus) {
 				t.Errorf("processTrackRewriteResults() got %s want %s", got, tt.wantStatus)
 			}
 			if got := markedDirty; got != tt.wantDirty {
@@ -347,11 +508,17 @@ func Test_backupAndRewriteTracks(t *testing.T) {
 	originalDirExists := dirExists
 	originalPlainFileExists := plainFileExists
 	originalCopyFile := copyFile
+	originalAudioChecksum := audioChecksum
+	originalVerifyRewrite := verifyRewrite
 	defer func() {
 		dirExists = originalDirExists
 		plainFileExists = originalPlainFileExists
 		copyFile = originalCopyFile
+		audioChecksum = originalAudioChecksum
+		verifyRewrite = originalVerifyRewrite
 	}()
+	audioChecksum = func(_ string) (string, error) { return "", nil }
+	verifyRewrite = func(_ *files.Track, _ string) error { return nil }
 	tests := map[string]struct {
 		dirExists        func(string) bool
 		plainFileExists  func(string) bool
@@ -395,8 +562,10 @@ func Test_backupAndRewriteTracks(t *testing.T) {
 					"The track file" +
 					" \"Music\\\\my artist\\\\my album 12\\\\4 my track 124.mp3\"" +
 					" has been backed up to" +
-					" \"Music\\\\my artist\\\\my album 12\\\\pre-rewrite-backup\\\\4.mp3\".\n",
+					" \"Music\\\\my artist\\\\my album 12\\\\pre-rewrite-backup\\\\4.mp3\".\n" +
+					"0 of 7 tracks rewritten.\n",
 				Error: "" +
+					"Rewriting tracks.\n" +
 					"An error occurred rewriting track" +
 					" \"Music\\\\my artist\\\\my album 11\\\\2 my track 112.mp3\".\n" +
 					"An error occurred rewriting track" +
@@ -463,7 +632,9 @@ func Test_backupAndRewriteTracks(t *testing.T) {
 			concernedArtists: concernedArtists,
 			wantStatus:       cmdtoolkit.NewExitSystemError("rewrite"),
 			WantedRecording: output.WantedRecording{
+				Console: "0 of 7 tracks rewritten.\n",
 				Error: "" +
+					"Rewriting tracks.\n" +
 					"The directory" +
 					" \"Music\\\\my artist\\\\my album 11\\\\pre-rewrite-backup\"" +
 					" cannot be created: 'parent directory is not a directory'.\n" +
@@ -494,7 +665,9 @@ func Test_backupAndRewriteTracks(t *testing.T) {
 			concernedArtists: concernedArtists,
 			wantStatus:       cmdtoolkit.NewExitSystemError("rewrite"),
 			WantedRecording: output.WantedRecording{
+				Console: "0 of 7 tracks rewritten.\n",
 				Error: "" +
+					"Rewriting tracks.\n" +
 					"The track file" +
 					" \"Music\\\\my artist\\\\my album 11\\\\2 my track 112.mp3\"" +
 					" could not be backed up due to error 'oops'.\n" +
@@ -589,7 +762,8 @@ func Test_backupAndRewriteTracks(t *testing.T) {
 			plainFileExists = tt.plainFileExists
 			copyFile = tt.copyFile
 			o := output.NewRecorder()
-			if got := backupAndRewriteTracks(o, tt.concernedArtists); !compareExitErrors(got, tt.wantStatus) {
+			got := backupAndRewriteTracks(context.Background(), o, tt.concernedArtists, 10, false, nil)
+			if !compareExitErrors(got, tt.wantStatus) {
 				t.Errorf("backupAndRewriteTracks() got %s want %s", got, tt.wantStatus)
 			}
 			o.Report(t, "backupAndRewriteTracks()", tt.WantedRecording)
@@ -597,6 +771,459 @@ func Test_backupAndRewriteTracks(t *testing.T) {
 	}
 }
 
+func Test_backupAndRewriteTracks_concurrently(t *testing.T) {
+	useFullCopyBackups(t)
+	originalMarkDirty := markDirty
+	defer func() {
+		markDirty = originalMarkDirty
+	}()
+	markDirty = func(_ output.Bus) {}
+	for _, fileLimit := range []int{1, 64} {
+		t.Run(fmt.Sprintf("limit %d", fileLimit), func(t *testing.T) {
+			var artists []*files.Artist
+			for range 3 {
+				artists = append(artists, clutteredArtists(t)...)
+			}
+			concernedArtists := createConcernedArtists(artists)
+			policies := &framePolicies{Library: framePolicyEntry{Deny: []string{"TENC"}}}
+			if got := findUncleanTracks(concernedArtists, policies); got != 6 {
+				t.Fatalf("findUncleanTracks() = %d, want 6", got)
+			}
+			var console strings.Builder
+			for _, artist := range artists {
+				for _, album := range artist.Albums() {
+					for _, track := range album.Tracks() {
+						console.WriteString(fmt.Sprintf("The track file %q has been backed up to %q.\n", track,
+							filepath.Join(album.BackupDirectory(), fmt.Sprintf("%d.mp3", track.Number()))))
+						removed := "TENC"
+						if track.Number() == 1 {
+							removed = "TENC, TIT2"
+						}
+						console.WriteString(fmt.Sprintf("%q: ID3V2 frames removed: %s.\n", track, removed))
+					}
+				}
+			}
+			console.WriteString("6 of 6 tracks rewritten.\n")
+			o := output.NewRecorder()
+			if got := backupAndRewriteTracks(context.Background(), o, concernedArtists, fileLimit, false, nil); got != nil {
+				t.Errorf("backupAndRewriteTracks() got %s want nil", got)
+			}
+			o.Report(t, "backupAndRewriteTracks()", output.WantedRecording{
+				Console: console.String(),
+				Error:   "Rewriting tracks.\n",
+			})
+		})
+	}
+}
+
+func Test_backupAndRewriteTracks_interrupted(t *testing.T) {
+	artists := clutteredArtists(t)
+	concernedArtists := createConcernedArtists(artists)
+	policies := &framePolicies{Library: framePolicyEntry{Deny: []string{"TENC"}}}
+	if got := findUncleanTracks(concernedArtists, policies); got != 2 {
+		t.Fatalf("findUncleanTracks() = %d, want 2", got)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	o := output.NewRecorder()
+	if got := backupAndRewriteTracks(ctx, o, concernedArtists, 10, false, nil); got != nil {
+		t.Errorf("backupAndRewriteTracks() got %s want nil", got)
+	}
+	o.Report(t, "backupAndRewriteTracks()", output.WantedRecording{
+		Console: "0 of 2 tracks rewritten.\n",
+		Error:   "Rewriting tracks.\nThe rewrite was interrupted; 2 tracks were not rewritten.\n",
+		Log: "level='info'" +
+			" command='rewrite'" +
+			" rewritten='0'" +
+			" skipped='2'" +
+			" msg='rewrite interrupted'\n",
+	})
+	backupDir := artists[0].Albums()[0].BackupDirectory()
+	if _, statErr := os.Stat(backupDir); statErr == nil {
+		t.Errorf("backupAndRewriteTracks() created %q after being interrupted", backupDir)
+	}
+}
+
+func Test_backupAndRewriteTracks_atomic(t *testing.T) {
+	useFullCopyBackups(t)
+	originalMarkDirty := markDirty
+	originalVerifyRewrite := verifyRewrite
+	originalRename := rename
+	defer func() {
+		markDirty = originalMarkDirty
+		verifyRewrite = originalVerifyRewrite
+		rename = originalRename
+	}()
+	markDirty = func(_ output.Bus) {}
+	tests := map[string]struct {
+		verifyRewrite func(*files.Track, string) error
+		rename        func(*files.Track) func(string, string) error
+		wantStatus    *cmdtoolkit.ExitError
+		wantOriginal  bool
+		want          func(tracks []*files.Track, backupFiles []string) output.WantedRecording
+	}{
+		"all rewritten": {
+			verifyRewrite: (*files.Track).VerifyRewrite,
+			want: func(tracks []*files.Track, backupFiles []string) output.WantedRecording {
+				return output.WantedRecording{
+					Console: fmt.Sprintf("The track file %q has been backed up to %q.\n", tracks[0], backupFiles[0]) +
+						fmt.Sprintf("The track file %q has been backed up to %q.\n", tracks[1], backupFiles[1]) +
+						fmt.Sprintf("%q rewritten.\n", tracks[0]) +
+						fmt.Sprintf("%q rewritten.\n", tracks[1]) +
+						"2 of 2 tracks rewritten.\n",
+					Error: "Rewriting tracks.\n",
+				}
+			},
+		},
+		"one track fails verification": {
+			verifyRewrite: func(t *files.Track, checksum string) error {
+				if t.Number() == 2 {
+					return fmt.Errorf("the audio has changed")
+				}
+				return t.VerifyRewrite(checksum)
+			},
+			wantStatus:   cmdtoolkit.NewExitSystemError("rewrite"),
+			wantOriginal: true,
+			want: func(tracks []*files.Track, backupFiles []string) output.WantedRecording {
+				return output.WantedRecording{
+					Console: fmt.Sprintf("The track file %q has been backed up to %q.\n", tracks[0], backupFiles[0]) +
+						fmt.Sprintf("The track file %q has been backed up to %q.\n", tracks[1], backupFiles[1]) +
+						"0 of 2 tracks rewritten.\n",
+					Error: "Rewriting tracks.\n" +
+						fmt.Sprintf("The rewritten track %q failed verification: 'the audio has changed'.\n",
+							tracks[1]) +
+						fmt.Sprintf("The album %q was not rewritten; none of its 2 track files were changed.\n",
+							tracks[1].Directory()),
+					Log: "level='error'" +
+						" command='rewrite'" +
+						fmt.Sprintf(" directory='%s'", tracks[1].Directory()) +
+						" error='the audio has changed'" +
+						fmt.Sprintf(" fileName='%s-staged'", tracks[1].FileName()) +
+						" msg='rewritten track failed verification'\n" +
+						"level='error'" +
+						" command='rewrite'" +
+						fmt.Sprintf(" directory='%s'", tracks[1].Directory()) +
+						" tracks='2'" +
+						" msg='album not rewritten'\n",
+				}
+			},
+		},
+		"one staging file cannot be renamed": {
+			verifyRewrite: (*files.Track).VerifyRewrite,
+			rename: func(second *files.Track) func(string, string) error {
+				return func(oldPath, newPath string) error {
+					if newPath == second.Path() {
+						return fmt.Errorf("access denied")
+					}
+					return os.Rename(oldPath, newPath)
+				}
+			},
+			wantStatus:   cmdtoolkit.NewExitSystemError("rewrite"),
+			wantOriginal: true,
+			want: func(tracks []*files.Track, backupFiles []string) output.WantedRecording {
+				staged := tracks[1].Path() + "-staged"
+				return output.WantedRecording{
+					Console: fmt.Sprintf("The track file %q has been backed up to %q.\n", tracks[0], backupFiles[0]) +
+						fmt.Sprintf("The track file %q has been backed up to %q.\n", tracks[1], backupFiles[1]) +
+						"0 of 2 tracks rewritten.\n",
+					Error: "Rewriting tracks.\n" +
+						fmt.Sprintf("The file %q cannot be renamed to %q: 'access denied'.\n", staged, tracks[1]) +
+						fmt.Sprintf("The album %q was not rewritten; none of its 2 track files were changed.\n",
+							tracks[1].Directory()),
+					Log: "level='error'" +
+						" command='rewrite'" +
+						" error='access denied'" +
+						fmt.Sprintf(" new='%s'", tracks[1].Path()) +
+						fmt.Sprintf(" old='%s'", staged) +
+						" msg='rename failed'\n" +
+						"level='error'" +
+						" command='rewrite'" +
+						fmt.Sprintf(" directory='%s'", tracks[1].Directory()) +
+						" tracks='2'" +
+						" msg='album not rewritten'\n",
+				}
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			artists := clutteredArtists(t)
+			concernedArtists := createConcernedArtists(artists)
+			policies := &framePolicies{Library: framePolicyEntry{Deny: []string{"TENC"}}}
+			if got := findUncleanTracks(concernedArtists, policies); got != 2 {
+				t.Fatalf("findUncleanTracks() = %d, want 2", got)
+			}
+			album := artists[0].Albums()[0]
+			tracks := album.Tracks()
+			var backupFiles []string
+			var originals [][]byte
+			for _, track := range tracks {
+				backupFiles = append(backupFiles, filepath.Join(album.BackupDirectory(),
+					fmt.Sprintf("%d.mp3", track.Number())))
+				content, _ := os.ReadFile(track.Path())
+				originals = append(originals, content)
+			}
+			verifyRewrite = tt.verifyRewrite
+			rename = os.Rename
+			if tt.rename != nil {
+				rename = tt.rename(tracks[1])
+			}
+			o := output.NewRecorder()
+			if got := backupAndRewriteTracks(context.Background(), o, concernedArtists, 10,
+				true, nil); !compareExitErrors(got, tt.wantStatus) {
+				t.Errorf("backupAndRewriteTracks() got %s want %s", got, tt.wantStatus)
+			}
+			o.Report(t, "backupAndRewriteTracks()", tt.want(tracks, backupFiles))
+			for k, track := range tracks {
+				content, _ := os.ReadFile(track.Path())
+				if got := bytes.Equal(content, originals[k]); got != tt.wantOriginal {
+					t.Errorf("backupAndRewriteTracks() left the original track file %q = %t, want %t",
+						track, got, tt.wantOriginal)
+				}
+				if _, statErr := os.Stat(track.Path() + "-staged"); statErr == nil {
+					t.Errorf("backupAndRewriteTracks() left the staging file for %q", track)
+				}
+			}
+		})
+	}
+}
+
+func Test_rewriteTrack_verification(t *testing.T) {
+	useFullCopyBackups(t)
+	originalMarkDirty := markDirty
+	originalAudioChecksum := audioChecksum
+	originalVerifyRewrite := verifyRewrite
+	defer func() {
+		markDirty = originalMarkDirty
+		audioChecksum = originalAudioChecksum
+		verifyRewrite = originalVerifyRewrite
+	}()
+	markDirty = func(_ output.Bus) {}
+	tests := map[string]struct {
+		audioChecksum func(*files.Track, string) func(string) (string, error)
+		verifyRewrite func(*files.Track, string) error
+		// a backup is left by an earlier rewrite
+		earlierBackup bool
+		// the backup is changed after it is made, before the track is restored
+		alterBackup  bool
+		wantStatus   *cmdtoolkit.ExitError
+		wantOriginal bool
+		want         func(track *files.Track, backupFile string) output.WantedRecording
+	}{
+		"verified": {
+			verifyRewrite: (*files.Track).VerifyRewrite,
+			want: func(track *files.Track, backupFile string) output.WantedRecording {
+				return output.WantedRecording{
+					Console: fmt.Sprintf("The track file %q has been backed up to %q.\n", track, backupFile) +
+						fmt.Sprintf("%q: ID3V2 frames removed: TENC.\n", track),
+				}
+			},
+		},
+		"restored": {
+			verifyRewrite: func(_ *files.Track, _ string) error { return fmt.Errorf("the audio has changed") },
+			wantStatus:    cmdtoolkit.NewExitSystemError("rewrite"),
+			wantOriginal:  true,
+			want: func(track *files.Track, backupFile string) output.WantedRecording {
+				return output.WantedRecording{
+					Console: fmt.Sprintf("The track file %q has been backed up to %q.\n", track, backupFile) +
+						fmt.Sprintf("The track file %q has been restored from %q.\n", track, backupFile),
+					Error: fmt.Sprintf("The rewritten track %q failed verification: 'the audio has changed'.\n", track),
+					Log: "level='error'" +
+						" command='rewrite'" +
+						fmt.Sprintf(" directory='%s'", track.Directory()) +
+						" error='the audio has changed'" +
+						fmt.Sprintf(" fileName='%s'", track.FileName()) +
+						" msg='rewritten track failed verification'\n",
+				}
+			},
+		},
+		"earlier backup replaced": {
+			verifyRewrite: func(_ *files.Track, _ string) error { return fmt.Errorf("the audio has changed") },
+			earlierBackup: true,
+			wantStatus:    cmdtoolkit.NewExitSystemError("rewrite"),
+			wantOriginal:  true,
+			want: func(track *files.Track, backupFile string) output.WantedRecording {
+				return output.WantedRecording{
+					Console: fmt.Sprintf("The track file %q has been backed up to %q.\n", track, backupFile) +
+						fmt.Sprintf("The track file %q has been restored from %q.\n", track, backupFile),
+					Error: fmt.Sprintf("The rewritten track %q failed verification: 'the audio has changed'.\n", track),
+					Log: "level='info'" +
+						" command='rewrite'" +
+						fmt.Sprintf(" file='%s'", backupFile) +
+						" modTime='2020-01-02 03:04:05'" +
+						" msg='earlier backup replaced'\n" +
+						"level='error'" +
+						" command='rewrite'" +
+						fmt.Sprintf(" directory='%s'", track.Directory()) +
+						" error='the audio has changed'" +
+						fmt.Sprintf(" fileName='%s'", track.FileName()) +
+						" msg='rewritten track failed verification'\n",
+				}
+			},
+		},
+		"backup changed since it was made": {
+			verifyRewrite: func(_ *files.Track, _ string) error { return fmt.Errorf("the audio has changed") },
+			alterBackup:   true,
+			wantStatus:    cmdtoolkit.NewExitSystemError("rewrite"),
+			want: func(track *files.Track, backupFile string) output.WantedRecording {
+				return output.WantedRecording{
+					Console: fmt.Sprintf("The track file %q has been backed up to %q.\n", track, backupFile),
+					Error: fmt.Sprintf("The rewritten track %q failed verification: 'the audio has changed'.\n", track) +
+						fmt.Sprintf("The track file %q could not be restored from %q:"+
+							" 'the backup is not a copy of the track file as it was before it was rewritten'.\n",
+							track, backupFile),
+					Log: "level='error'" +
+						" command='rewrite'" +
+						fmt.Sprintf(" directory='%s'", track.Directory()) +
+						" error='the audio has changed'" +
+						fmt.Sprintf(" fileName='%s'", track.FileName()) +
+						" msg='rewritten track failed verification'\n" +
+						"level='error'" +
+						fmt.Sprintf(" backup='%s'", backupFile) +
+						" command='rewrite'" +
+						fmt.Sprintf(" directory='%s'", track.Directory()) +
+						" error='the backup is not a copy of the track file as it was before it was rewritten'" +
+						fmt.Sprintf(" fileName='%s'", track.FileName()) +
+						" msg='cannot restore track'\n",
+				}
+			},
+		},
+		"unreadable audio": {
+			audioChecksum: func(_ *files.Track, _ string) func(string) (string, error) {
+				return func(_ string) (string, error) { return "", fmt.Errorf("read error") }
+			},
+			wantStatus:   cmdtoolkit.NewExitSystemError("rewrite"),
+			wantOriginal: true,
+			want: func(track *files.Track, backupFile string) output.WantedRecording {
+				return output.WantedRecording{
+					Console: fmt.Sprintf("The track file %q has been backed up to %q.\n", track, backupFile),
+					Error: fmt.Sprintf("The audio checksum of track %q cannot be computed: 'read error'.\n", track) +
+						fmt.Sprintf("The track file %q will not be rewritten.\n", track),
+					Log: "level='error'" +
+						" command='rewrite'" +
+						fmt.Sprintf(" directory='%s'", track.Directory()) +
+						" error='read error'" +
+						fmt.Sprintf(" fileName='%s'", track.FileName()) +
+						" msg='cannot compute audio checksum'\n",
+				}
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			concernedArtists := createConcernedArtists(clutteredArtists(t))
+			policy := files.FramePolicy{Deny: []string{"TENC"}}
+			cAl := concernedArtists[0].albums()[0]
+			cT := cAl.tracks()[1]
+			cT.addConcern(conflictConcern, "the track contains the TENC frame")
+			cT.framePolicy = &policy
+			track := cT.backing
+			path, _ := ensureTrackBackupDirectoryExists(output.NewNilBus(), cAl)
+			backupFile := filepath.Join(path, "2.mp3")
+			original, _ := os.ReadFile(track.Path())
+			audioChecksum = files.AudioChecksum
+			if tt.audioChecksum != nil {
+				audioChecksum = tt.audioChecksum(track, backupFile)
+			}
+			if tt.earlierBackup {
+				earlier := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+				_ = os.WriteFile(backupFile, []byte("an earlier backup"), cmdtoolkit.StdFilePermissions)
+				_ = os.Chtimes(backupFile, earlier, earlier)
+			}
+			verifyRewrite = tt.verifyRewrite
+			if tt.alterBackup {
+				verifyRewrite = func(t *files.Track, checksum string) error {
+					_ = os.WriteFile(backupFile, []byte("another file"), cmdtoolkit.StdFilePermissions)
+					return tt.verifyRewrite(t, checksum)
+				}
+			}
+			o := output.NewRecorder()
+			if got := rewriteTrack(o, cT, albumTrackBackup(path)); !compareExitErrors(got, tt.wantStatus) {
+				t.Errorf("rewriteTrack() got %s want %s", got, tt.wantStatus)
+			}
+			o.Report(t, "rewriteTrack()", tt.want(track, backupFile))
+			content, _ := os.ReadFile(track.Path())
+			if got := bytes.Equal(content, original); got != tt.wantOriginal {
+				t.Errorf("rewriteTrack() left the original track file = %t, want %t", got, tt.wantOriginal)
+			}
+		})
+	}
+}
+
+func Test_restoreFromBackup(t *testing.T) {
+	originalCopyFile := copyFile
+	originalRename := rename
+	defer func() {
+		copyFile = originalCopyFile
+		rename = originalRename
+	}()
+	tests := map[string]struct {
+		alterBackup  bool
+		copyFile     func(string, string) error
+		rename       func(string, string) error
+		wantErr      string
+		wantRestored bool
+	}{
+		"restored": {
+			wantRestored: true,
+		},
+		"backup changed since it was made": {
+			alterBackup: true,
+			wantErr:     "the backup is not a copy of the track file as it was before it was rewritten",
+		},
+		"copy fails": {
+			copyFile: func(_, _ string) error { return fmt.Errorf("disk full") },
+			wantErr:  "disk full",
+		},
+		"copy is incomplete": {
+			copyFile: func(_, destination string) error {
+				return os.WriteFile(destination, []byte("half a track"), cmdtoolkit.StdFilePermissions)
+			},
+			wantErr: "does not match the original",
+		},
+		"copy cannot be renamed": {
+			rename:  func(_, _ string) error { return fmt.Errorf("access denied") },
+			wantErr: "access denied",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			track := clutteredArtists(t)[0].Albums()[0].Tracks()[0]
+			original, _ := os.ReadFile(track.Path())
+			backupFile := filepath.Join(t.TempDir(), "1.mp3")
+			_ = os.WriteFile(backupFile, original, cmdtoolkit.StdFilePermissions)
+			baseline := rewriteBaseline{}
+			baseline.fileHash, _, _ = hashFile(track.Path())
+			_ = os.WriteFile(track.Path(), []byte("a rewritten track"), cmdtoolkit.StdFilePermissions)
+			if tt.alterBackup {
+				_ = os.WriteFile(backupFile, []byte("another file"), cmdtoolkit.StdFilePermissions)
+			}
+			copyFile = originalCopyFile
+			if tt.copyFile != nil {
+				copyFile = tt.copyFile
+			}
+			rename = os.Rename
+			if tt.rename != nil {
+				rename = tt.rename
+			}
+			gotErr := restoreFromBackup(track, backupFile, baseline)
+			switch {
+			case tt.wantErr == "" && gotErr != nil:
+				t.Errorf("restoreFromBackup() = %v, want nil", gotErr)
+			case tt.wantErr != "" && (gotErr == nil || !strings.Contains(gotErr.Error(), tt.wantErr)):
+				t.Errorf("restoreFromBackup() = %v, want %q", gotErr, tt.wantErr)
+			}
+			content, _ := os.ReadFile(track.Path())
+			if got := bytes.Equal(content, original); got != tt.wantRestored {
+				t.Errorf("restoreFromBackup() restored the track file = %t, want %t", got, tt.wantRestored)
+			}
+			if _, statErr := os.Stat(track.Path() + backupPartialSuffix); statErr == nil {
+				t.Errorf("restoreFromBackup() left the copy of the backup")
+			}
+		})
+	}
+}
+
 func Test_reportRewritesNeeded(t *testing.T) {
 	dirty := createConcernedArtists(generateArtists(2, 3, 4, nil))
 	for _, cAr := range dirty {
@@ -720,24 +1347,355 @@ func Test_findConflictedTracks(t *testing.T) {
 	}
 }
 
+// untaggedArtists creates an artist with one album of two untagged track files
+func untaggedArtists(t *testing.T) []*files.Artist {
+	artistDir := filepath.Join(t.TempDir(), "my artist")
+	albumDir := filepath.Join(artistDir, "my album")
+	_ = os.MkdirAll(albumDir, 0o755)
+	artist := files.NewArtist("my artist", artistDir)
+	album := files.AlbumMaker{Title: "my album", Artist: artist, Directory: albumDir}.NewAlbum(true)
+	for k := 1; k <= 2; k++ {
+		fileName := fmt.Sprintf("%d my track %d.mp3", k, k)
+		_ = os.WriteFile(filepath.Join(albumDir, fileName), make([]byte, 256), 0o644)
+		files.TrackMaker{
+			Album:      album,
+			FileName:   fileName,
+			SimpleName: fmt.Sprintf("my track %d", k),
+			Number:     k,
+		}.NewTrack(true)
+	}
+	artists := []*files.Artist{artist}
+	files.ReadMetadata(context.Background(), output.NewNilBus(), artists, 1)
+	return artists
+}
+
+func Test_findUntaggedTracks(t *testing.T) {
+	tests := map[string]struct {
+		createTags   []string
+		want         int
+		wantConcerns []string
+	}{
+		"none": {},
+		"ID3V2": {
+			createTags:   []string{"ID3V2"},
+			want:         2,
+			wantConcerns: []string{"the track file has no ID3V2 metadata"},
+		},
+		"both": {
+			createTags: []string{"ID3V1", "ID3V2"},
+			want:       2,
+			wantConcerns: []string{
+				"the track file has no ID3V1 metadata",
+				"the track file has no ID3V2 metadata",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			concernedArtists := createConcernedArtists(untaggedArtists(t))
+			if got := findUntaggedTracks(concernedArtists, tt.createTags); got != tt.want {
+				t.Errorf("findUntaggedTracks() = %d, want %d", got, tt.want)
+			}
+			for _, cT := range concernedArtists[0].albums()[0].tracks() {
+				if got := cT.concernsCollection[conflictConcern]; !reflect.DeepEqual(got, tt.wantConcerns) {
+					t.Errorf("findUntaggedTracks() concerns = %v, want %v", got, tt.wantConcerns)
+				}
+				if !reflect.DeepEqual(cT.createTags, tt.createTags) {
+					t.Errorf("findUntaggedTracks() createTags = %v, want %v", cT.createTags, tt.createTags)
+				}
+			}
+		})
+	}
+}
+
+func Test_createTrackTags(t *testing.T) {
+	originalApplicationPath := applicationPath
+	originalMarkDirty := markDirty
+	defer func() {
+		applicationPath = originalApplicationPath
+		markDirty = originalMarkDirty
+	}()
+	appData := t.TempDir()
+	applicationPath = func() string { return appData }
+	var markedDirty bool
+	markDirty = func(o output.Bus) {
+		markedDirty = true
+	}
+	tracks := untaggedArtists(t)[0].Albums()[0].Tracks()
+	tagged := untaggedArtists(t)[0].Albums()[0].Tracks()[0]
+	_, _ = tagged.CreateMissingTags("ID3V1", "ID3V2")
+	tests := map[string]struct {
+		track      *files.Track
+		createTags []string
+		wantErr    bool
+		wantDirty  bool
+		wantAfter  []string
+		output.WantedRecording
+	}{
+		"create ID3V2": {
+			track:      tracks[0],
+			createTags: []string{"ID3V2"},
+			wantDirty:  true,
+			wantAfter:  []string{"ID3V1"},
+			WantedRecording: output.WantedRecording{
+				Console: fmt.Sprintf("%q tagged.\n", tracks[0]),
+			},
+		},
+		"create both": {
+			track:      tracks[1],
+			createTags: []string{"ID3V1", "ID3V2"},
+			wantDirty:  true,
+			WantedRecording: output.WantedRecording{
+				Console: fmt.Sprintf("%q tagged.\n", tracks[1]),
+			},
+		},
+		"nothing missing": {
+			track:      tagged,
+			createTags: []string{"ID3V1", "ID3V2"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			markedDirty = false
+			o := output.NewRecorder()
+			if got := createTrackTags(o, tt.track, tt.createTags, auditRewrite); (got != nil) != tt.wantErr {
+				t.Errorf("createTrackTags() = %v, wantErr %t", got, tt.wantErr)
+			}
+			if markedDirty != tt.wantDirty {
+				t.Errorf("createTrackTags() marked dirty %t, want %t", markedDirty, tt.wantDirty)
+			}
+			if got := tt.track.MissingTags(); !reflect.DeepEqual(got, tt.wantAfter) {
+				t.Errorf("createTrackTags() left missing tags %v, want %v", got, tt.wantAfter)
+			}
+			o.Report(t, "createTrackTags()", tt.WantedRecording)
+		})
+	}
+	// the album has no genre, year, or music CD identifier, so each new tag
+	// gets four fields
+	if entries, _ := readAuditLog(filepath.Join(appData, auditLogFile)); len(entries) != 12 {
+		t.Errorf("createTrackTags() recorded %d audit log entries, want 12", len(entries))
+	}
+}
+
+func Test_findMisformattedTracks(t *testing.T) {
+	originalMarkDirty := markDirty
+	defer func() {
+		markDirty = originalMarkDirty
+		files.SetID3V2Policy(files.ID3V2Conversion{Encoding: files.KeepEncoding})
+	}()
+	markDirty = func(_ output.Bus) {}
+	artists := untaggedArtists(t)
+	for _, track := range artists[0].Albums()[0].Tracks() {
+		// new ID3V2 tags are written as ID3V2.4 tags, with UTF-8 text
+		_, _ = track.CreateMissingTags("ID3V2")
+	}
+	files.SetID3V2Policy(files.ID3V2Conversion{Encoding: files.KeepEncoding})
+	if got := findMisformattedTracks(createConcernedArtists(artists)); got != 0 {
+		t.Errorf("findMisformattedTracks() = %d, want 0", got)
+	}
+	files.SetID3V2Policy(files.ID3V2Conversion{Version: 3, Encoding: files.KeepEncoding})
+	concernedArtists := createConcernedArtists(artists)
+	if got := findMisformattedTracks(concernedArtists); got != 2 {
+		t.Errorf("findMisformattedTracks() = %d, want 2", got)
+	}
+	wantConcerns := []string{
+		"the ID3V2 tag is version 2.4, not 2.3",
+		"the ID3V2 TALB, TIT2, TPE1, TRCK frames are encoded as UTF-8, not ISO-8859-1",
+	}
+	for _, cT := range concernedArtists[0].albums()[0].tracks() {
+		if got := cT.concernsCollection[conflictConcern]; !reflect.DeepEqual(got, wantConcerns) {
+			t.Errorf("findMisformattedTracks() concerns = %v, want %v", got, wantConcerns)
+		}
+		if !cT.reformat {
+			t.Errorf("findMisformattedTracks() did not mark %q to be reformatted", cT.backing)
+		}
+		o := output.NewRecorder()
+		if got := reformatTrackTag(o, cT.backing); got != nil {
+			t.Errorf("reformatTrackTag() = %v, want nil", got)
+		}
+		o.Report(t, "reformatTrackTag()", output.WantedRecording{
+			Console: fmt.Sprintf("%q rewritten.\n", cT.backing),
+		})
+		if got := cT.backing.ID3V2FormatProblems(); len(got) != 0 {
+			t.Errorf("reformatTrackTag() left problems %v", got)
+		}
+	}
+}
+
+// clutteredArtists returns an artist whose tracks' ID3V2.3 tags contain an
+// encoder frame and, for the first track, a duplicated title frame
+func clutteredArtists(t *testing.T) []*files.Artist {
+	artistDir := filepath.Join(t.TempDir(), "my artist")
+	albumDir := filepath.Join(artistDir, "my album")
+	_ = os.MkdirAll(albumDir, 0o755)
+	artist := files.NewArtist("my artist", artistDir)
+	album := files.AlbumMaker{Title: "my album", Artist: artist, Directory: albumDir}.NewAlbum(true)
+	textFrame := func(id, value string) []byte {
+		size := len(value) + 1
+		frame := []byte(id)
+		frame = append(frame, byte(size>>24), byte(size>>16), byte(size>>8), byte(size), 0, 0, 0)
+		return append(frame, value...)
+	}
+	for k := 1; k <= 2; k++ {
+		fileName := fmt.Sprintf("%d my track %d.mp3", k, k)
+		var frames []byte
+		if k == 1 {
+			frames = append(frames, textFrame("TIT2", "old title")...)
+		}
+		frames = append(frames, textFrame("TIT2", fmt.Sprintf("my track %d", k))...)
+		frames = append(frames, textFrame("TALB", "my album")...)
+		frames = append(frames, textFrame("TPE1", "my artist")...)
+		frames = append(frames, textFrame("TRCK", fmt.Sprintf("%d", k))...)
+		frames = append(frames, textFrame("TENC", "some ripper")...)
+		size := len(frames)
+		content := []byte{'I', 'D', '3', 3, 0, 0,
+			byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)}
+		content = append(content, frames...)
+		content = append(content, make([]byte, 256)...)
+		_ = os.WriteFile(filepath.Join(albumDir, fileName), content, 0o644)
+		files.TrackMaker{
+			Album:      album,
+			FileName:   fileName,
+			SimpleName: fmt.Sprintf("my track %d", k),
+			Number:     k,
+		}.NewTrack(true)
+	}
+	artists := []*files.Artist{artist}
+	files.ReadMetadata(context.Background(), output.NewNilBus(), artists, 1)
+	return artists
+}
+
+func Test_findUncleanTracks(t *testing.T) {
+	originalMarkDirty := markDirty
+	defer func() {
+		markDirty = originalMarkDirty
+	}()
+	markDirty = func(_ output.Bus) {}
+	artists := clutteredArtists(t)
+	if got := findUncleanTracks(createConcernedArtists(artists), nil); got != 0 {
+		t.Errorf("findUncleanTracks() = %d, want 0", got)
+	}
+	lenient := &framePolicies{
+		Library: framePolicyEntry{Deny: []string{"TENC"}},
+		Artists: map[string]framePolicyEntry{"my artist": {Deny: []string{"PRIV"}}},
+	}
+	concernedArtists := createConcernedArtists(artists)
+	if got := findUncleanTracks(concernedArtists, lenient); got != 1 {
+		t.Errorf("findUncleanTracks() = %d, want 1", got)
+	}
+	strict := &framePolicies{Library: framePolicyEntry{Deny: []string{"TENC"}, Require: []string{"APIC"}}}
+	concernedArtists = createConcernedArtists(artists)
+	if got := findUncleanTracks(concernedArtists, strict); got != 2 {
+		t.Errorf("findUncleanTracks() = %d, want 2", got)
+	}
+	wantConcerns := [][]string{
+		{
+			"the ID3V2 tag contains the TENC frame (Encoded by), which the frame policy does not permit",
+			"the ID3V2 tag contains 2 TIT2 frames (Title/songname/content description)",
+		},
+		{
+			"the ID3V2 tag contains the TENC frame (Encoded by), which the frame policy does not permit",
+		},
+	}
+	wantRemoved := []string{"TENC, TIT2", "TENC"}
+	for k, cT := range concernedArtists[0].albums()[0].tracks() {
+		if got := cT.concernsCollection[conflictConcern]; !reflect.DeepEqual(got, wantConcerns[k]) {
+			t.Errorf("findUncleanTracks() concerns = %v, want %v", got, wantConcerns[k])
+		}
+		if cT.framePolicy == nil {
+			t.Errorf("findUncleanTracks() did not mark %q to be cleaned", cT.backing)
+			continue
+		}
+		o := output.NewRecorder()
+		if got := cleanTrackFrames(o, cT.backing, *cT.framePolicy); got != nil {
+			t.Errorf("cleanTrackFrames() = %v, want nil", got)
+		}
+		o.Report(t, "cleanTrackFrames()", output.WantedRecording{
+			Console: fmt.Sprintf("%q: ID3V2 frames removed: %s.\n", cT.backing, wantRemoved[k]),
+		})
+		if cT.backing.HasRemovableFrames(*cT.framePolicy) {
+			t.Errorf("cleanTrackFrames() left removable frames in %q", cT.backing)
+		}
+	}
+}
+
+func Test_findDefectiveTracks(t *testing.T) {
+	originalMarkDirty := markDirty
+	defer func() {
+		markDirty = originalMarkDirty
+	}()
+	markDirty = func(_ output.Bus) {}
+	artists := clutteredArtists(t)
+	// stack an empty ID3V2 tag in front of each track's tag
+	for _, track := range artists[0].Albums()[0].Tracks() {
+		content, _ := os.ReadFile(track.Path())
+		_ = os.WriteFile(track.Path(), append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 0}, content...), 0o644)
+	}
+	if got := findDefectiveTracks(createConcernedArtists(artists), false); got != 0 {
+		t.Errorf("findDefectiveTracks() = %d, want 0", got)
+	}
+	concernedArtists := createConcernedArtists(artists)
+	if got := findDefectiveTracks(concernedArtists, true); got != 2 {
+		t.Errorf("findDefectiveTracks() = %d, want 2", got)
+	}
+	wantConcerns := []string{"the file begins with 2 ID3V2 tags"}
+	for _, cT := range concernedArtists[0].albums()[0].tracks() {
+		if got := cT.concernsCollection[conflictConcern]; !reflect.DeepEqual(got, wantConcerns) {
+			t.Errorf("findDefectiveTracks() concerns = %v, want %v", got, wantConcerns)
+		}
+		if !cT.repairStructure {
+			t.Errorf("findDefectiveTracks() did not mark %q to be repaired", cT.backing)
+		}
+		o := output.NewRecorder()
+		if got := repairTrackStructure(o, cT.backing); got != nil {
+			t.Errorf("repairTrackStructure() = %v, want nil", got)
+		}
+		o.Report(t, "repairTrackStructure()", output.WantedRecording{
+			Console: fmt.Sprintf("%q: ID3V2 tag structure repaired.\n", cT.backing),
+		})
+		if got := cT.backing.ID3V2StructureDefects(); len(got) != 0 {
+			t.Errorf("repairTrackStructure() left defects %v", got)
+		}
+		o = output.NewRecorder()
+		if got := repairTrackStructure(o, cT.backing); got == nil {
+			t.Errorf("repairTrackStructure() = nil, want error")
+		}
+		o.Report(t, "repairTrackStructure()", output.WantedRecording{
+			Error: fmt.Sprintf("An error occurred repairing the ID3V2 tag of track %q.\n", cT.backing),
+			Log: fmt.Sprintf("level='error'"+
+				" command='rewrite'"+
+				" directory='%s'"+
+				" error='the ID3V2 tags have no structural defects'"+
+				" fileName='%s'"+
+				" msg='cannot repair ID3V2 tag'\n", cT.backing.Directory(), cT.backing.FileName()),
+		})
+	}
+}
+
 func Test_rewriteSettings_rewriteArtists(t *testing.T) {
 	originalReadMetadata := readMetadata
 	originalDirExists := dirExists
 	originalPlainFileExists := plainFileExists
 	originalCopyFile := copyFile
 	originalMarkDirty := markDirty
+	originalAudioChecksum := audioChecksum
+	originalVerifyRewrite := verifyRewrite
 	defer func() {
 		readMetadata = originalReadMetadata
 		dirExists = originalDirExists
 		plainFileExists = originalPlainFileExists
 		copyFile = originalCopyFile
 		markDirty = originalMarkDirty
+		audioChecksum = originalAudioChecksum
+		verifyRewrite = originalVerifyRewrite
 	}()
-	readMetadata = func(_ output.Bus, _ []*files.Artist, _ int) {}
+	readMetadata = func(_ context.Context, _ output.Bus, _ []*files.Artist, _ int) {}
 	dirExists = func(_ string) bool { return true }
 	plainFileExists = func(_ string) bool { return false }
 	copyFile = func(_, _ string) error { return nil }
 	markDirty = func(_ output.Bus) {}
+	audioChecksum = func(_ string) (string, error) { return "", nil }
+	verifyRewrite = func(_ *files.Track, _ string) error { return nil }
 	maker := &files.TrackMetadataMaker{
 		Artist:       "",
 		Album:        "",
@@ -1154,8 +2112,10 @@ func Test_rewriteSettings_rewriteArtists(t *testing.T) {
 					"The track file" +
 					" \"Music\\\\my artist\\\\my album 12\\\\4 my track 124.mp3\"" +
 					" has been backed up to" +
-					" \"Music\\\\my artist\\\\my album 12\\\\pre-rewrite-backup\\\\4.mp3\".\n",
+					" \"Music\\\\my artist\\\\my album 12\\\\pre-rewrite-backup\\\\4.mp3\".\n" +
+					"0 of 24 tracks rewritten.\n",
 				Error: "" +
+					"Rewriting tracks.\n" +
 					"An error occurred rewriting track" +
 					" \"Music\\\\my artist\\\\my album 00\\\\1 my track 001.mp3\".\n" +
 					"An error occurred rewriting track" +
@@ -1426,7 +2386,7 @@ func Test_rewriteSettings_rewriteArtists(t *testing.T) {
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			o := output.NewRecorder()
-			got := tt.rs.rewriteArtists(o, tt.artists, &ioSettings{openFileLimit: 100})
+			got := tt.rs.rewriteArtists(context.Background(), o, tt.artists, &ioSettings{openFileLimit: 100})
 			if !compareExitErrors(got, tt.wantStatus) {
 				t.Errorf("rewriteSettings.rewriteArtists() got %s want %s", got, tt.wantStatus)
 			}
@@ -1440,7 +2400,7 @@ func Test_rewriteSettings_processArtists(t *testing.T) {
 	defer func() {
 		readMetadata = originalReadMetadata
 	}()
-	readMetadata = func(_ output.Bus, _ []*files.Artist, _ int) {}
+	readMetadata = func(_ context.Context, _ output.Bus, _ []*files.Artist, _ int) {}
 	type args struct {
 		allArtists []*files.Artist
 		ss         *searchSettings
@@ -1477,7 +2437,7 @@ func Test_rewriteSettings_processArtists(t *testing.T) {
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			o := output.NewRecorder()
-			got := tt.rs.processArtists(o, tt.args.allArtists, tt.args.ss, tt.args.ios)
+			got := tt.rs.processArtists(context.Background(), o, tt.args.allArtists, tt.args.ss, tt.args.ios)
 			if !compareExitErrors(got, tt.wantStatus) {
 				t.Errorf("rewriteSettings.processArtists() got %s want %s", got, tt.wantStatus)
 			}
@@ -1508,11 +2468,41 @@ func Test_rewriteRun(t *testing.T) {
 				ExpectedType: cmdtoolkit.BoolType,
 				DefaultValue: false,
 			},
+			"repairStructure": {
+				Usage:        "rewrite structurally defective ID3V2 tags as a single clean tag",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+			"atomic": {
+				Usage:        "rewrite each album's tracks together, changing none of them unless all can be rewritten",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+			"backupStore": {
+				Usage:        "back up the tracks to the central backup store, rather than to each album's backup directory",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+			"suppressions": {
+				Usage:        suppressionsUsage,
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			"framePolicy": {
+				Usage:        framePolicyUsage,
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			"createTags": {
+				Usage:        "create the missing tags of track files",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "none",
+			},
 		},
 	}
 	command := &cobra.Command{}
 	cmdtoolkit.AddFlags(output.NewNilBus(), cmdtoolkit.EmptyConfiguration(), command.Flags(),
-		rewriteFlags, searchFlags, ioFlags)
+		rewriteFlags, searchFlags, ioFlags, namesFlags, id3v2Flags)
 	tests := map[string]struct {
 		cmd *cobra.Command
 		in1 []string
@@ -1558,7 +2548,7 @@ func Test_rewrite_Help(t *testing.T) {
 	searchFlags = safeSearchFlags
 	commandUnderTest := cloneCommand(rewriteCmd)
 	cmdtoolkit.AddFlags(output.NewNilBus(), cmdtoolkit.EmptyConfiguration(),
-		commandUnderTest.Flags(), rewriteFlags, searchFlags, ioFlags)
+		commandUnderTest.Flags(), rewriteFlags, searchFlags, ioFlags, namesFlags, id3v2Flags)
 	tests := map[string]struct {
 		output.WantedRecording
 	}{
@@ -1571,27 +2561,114 @@ func Test_rewrite_Help(t *testing.T) {
 					"inconsistent with the file structure. Prior to rewriting an mp3 file, the rewrite\n" +
 					"command creates a backup directory for the parent album and copies the original mp3\n" +
 					"file into that backup directory. Use the cleanup command to automatically delete\n" +
-					"the backup folders.\n" +
+					"the backup folders. Where the file system supports hard links, the backup is instead\n" +
+					"the original file, hard linked into the backup directory, and the track file is\n" +
+					"replaced by a copy of itself; such backups are noted as hard links.\n" +
+					"\n" +
+					"Each rewritten track is verified: its metadata is read again and must agree with the\n" +
+					"file structure, and its audio must be unchanged. A track that fails verification\n" +
+					"is restored from its backup and counted as a failure.\n" +
+					"\n" +
+					"Albums are rewritten concurrently, each album's tracks in order; the --maxOpenFiles\n" +
+					"flag limits how many files are open at once. The output is written album by album.\n" +
+					"If interrupted (Ctrl+C), no further tracks are rewritten; the tracks being\n" +
+					"rewritten are finished, and the tracks that were not rewritten are counted.\n" +
+					"\n" +
+					"Use --atomic to rewrite each album as a whole: its tracks are rewritten to\n" +
+					"temporary files, which replace the track files only if every track was rewritten\n" +
+					"and verified. Otherwise, none of the album's track files are changed, and the album\n" +
+					"is reported as a single failure. This keeps an album from being left with some\n" +
+					"tracks fixed and others not, such as with mixed album names or years.\n" +
+					"\n" +
+					"Use --backupStore to back up the track files to a central backup store in the\n" +
+					"application data directory, rather than to each album's backup directory. The\n" +
+					"store keeps every backup of a track, named for the hash of its content, so that\n" +
+					"identical files are stored once; its manifest records each backup's original\n" +
+					"path, time, and reason. Use the cleanup command to delete old backups.\n" +
+					"\n" +
+					"A track file with no ID3V1 or no ID3V2 metadata cannot be rewritten, as there is no\n" +
+					"tag to correct; use --createTags to create the missing tags. The artist, album,\n" +
+					"track name, and track number are taken from the track's directory and file\n" +
+					"names, and the genre, year, and music CD identifier from the values shared by\n" +
+					"the album's other tracks.\n" +
+					"\n" +
+					"Rewritten and newly created ID3V2 tags use the ID3V2 version and text encoding set\n" +
+					"by --id3v2Version and --id3v2Encoding; tracks whose ID3V2 tags use a different\n" +
+					"version or encoding are rewritten, even if their metadata is otherwise correct.\n" +
+					"Converting a tag between versions 2.3 and 2.4 moves the recording date between the\n" +
+					"TYER and TDAT frames and the TDRC frame.\n" +
+					"\n" +
+					"Use --repairStructure to rewrite ID3V2 tags with structural defects, such as\n" +
+					"several tags stacked at the start of the file, a tag appended to its end, ID3V2.4\n" +
+					"frame sizes that are not synchsafe, or oversized padding, as a single clean tag at\n" +
+					"the start of the file. Frames found only in the additional tags are kept.\n" +
+					"\n" +
+					"The ID3V2 frames that the --framePolicy file does not permit, and duplicated text\n" +
+					"frames, are removed; see 'scan --help'.\n" +
+					"\n" +
+					"Fields covered by the files and metadata conflict entries of the --suppressions file are\n" +
+					"not rewritten; see 'scan --help'.\n" +
+					"\n" +
+					"Each field change is recorded in the audit log; see 'history --help'.\n" +
 					"\n" +
 					"Usage:\n" +
-					"  rewrite [--dryRun] [--albumFilter regex] [--artistFilter regex]" +
-					" [--trackFilter regex] [--extensions extensions] [--maxOpenFiles count]\n" +
+					"  rewrite [--dryRun] [--atomic] [--backupStore] [--createTags tags] [--repairStructure] [--suppressions file] [--framePolicy " +
+					"file] [--albumFilter regex] [--artistFilter regex] [--trackFilter regex] [--extensions extensions] " +
+					"[--maxOpenFiles count] [--aliases aliases] [--ampersand] [--foldCase] [--invertArticles] " +
+					"[--normalizeUnicode] [--id3v2Version version] [--id3v2Encoding encoding]\n" +
 					"\n" +
 					"Examples:\n" +
 					"rewrite --dryRun\n  Output what would be rewritten, but does not rewrite the files\n" +
+					"rewrite --atomic\n" +
+					"  Rewrite the files, changing none of an album's files unless all of them can be rewritten\n" +
+					"rewrite --backupStore\n" +
+					"  Rewrite the files, backing them up to the central backup store\n" +
+					"rewrite --createTags both\n" +
+					"  Rewrite the files, first creating any missing ID3V1 and ID3V2 tags\n" +
+					"rewrite --repairStructure\n" +
+					"  Rewrite the files, first repairing the structure of any defective ID3V2 tags\n" +
+					"rewrite --id3v2Version 2.3 --id3v2Encoding iso-8859-1\n" +
+					"  Rewrite the files, converting their ID3V2 tags to version 2.3, with ISO-8859-1 text\n" +
+					"  wherever possible\n" +
 					"\n" +
 					"Flags:\n" +
-					"      --albumFilter string    " +
+					"      --albumFilter string     " +
 					"regular expression specifying which albums to select (default \".*\")\n" +
-					"      --artistFilter string   " +
+					"      --aliases string         semicolon-delimited list of alias=preferred name pairs for artist " +
+					"and album names (default \"\")\n" +
+					"      --ampersand              treat '&' and 'and' as equal in artist and album names (default " +
+					"false)\n" +
+					"      --artistFilter string    " +
 					"regular expression specifying which artists to select (default \".*\")\n" +
-					"      --dryRun                " +
+					"      --atomic                 rewrite each album's tracks together, changing none of them unless " +
+					"all can be rewritten (default false)\n" +
+					"      --backupStore            back up the tracks to the central backup store, rather than to " +
+					"each album's backup directory (default false)\n" +
+					"      --createTags string      create the missing tags of track files: none, id3v1, id3v2, or both " +
+					"(default \"none\")\n" +
+					"      --dryRun                 " +
 					"output what would have been rewritten, but rewrites no files (default false)\n" +
-					"      --extensions string     " +
+					"      --extensions string      " +
 					"comma-delimited list of file extensions used by mp3 files (default \".mp3\")\n" +
-					"      --maxOpenFiles int      the maximum number of files that can be read simultaneously " +
+					"      --foldCase               treat artist and album names differing only in letter case as equal " +
+					"(default false)\n" +
+					"      --framePolicy string     the path of a YAML file listing the ID3V2 frames that tags may or " +
+					"must contain; if empty, no frame policy is applied (default \"\")\n" +
+					"      --id3v2Encoding string   text encoding of rewritten ID3V2 tags: keep (each frame's own " +
+					"encoding), iso-8859-1, utf-16, or utf-8 (2.4 only) (default \"keep\")\n" +
+					"      --id3v2Version string    ID3V2 version of rewritten tags: keep (each tag's own version), 2.3, " +
+					"or 2.4 (default \"keep\")\n" +
+					"      --invertArticles         treat artist and album names such as 'Beatles, The' and 'The " +
+					"Beatles' as equal (default false)\n" +
+					"      --maxOpenFiles int       the maximum number of files that can be read simultaneously " +
 					"(at least 1, at most 32767, default 1000) (default 1000)\n" +
-					"      --trackFilter string    " +
+					"      --normalizeUnicode       treat the NFC and NFD forms of artist and album names as equal " +
+					"(default false)\n" +
+					"      --repairStructure        rewrite structurally defective ID3V2 tags as a single clean tag " +
+					"(default false)\n" +
+					"      --suppressions string    the path of a YAML file listing concerns that are known and " +
+					"accepted; if empty, no concerns are suppressed (default \"\")\n" +
+					"      --trackFilter string     " +
 					"regular expression specifying which tracks to select (default \".*\")\n",
 			},
 		},
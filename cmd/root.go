@@ -1,11 +1,15 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
@@ -24,6 +28,9 @@ const (
 	// DefaultElevatedPrivilegesPermission is the setting to use if ElevatedPrivilegesPermissionVar is not set or is set
 	// to a non-boolean value
 	DefaultElevatedPrivilegesPermission = true
+	// interruptedExitCode is the exit code used when mp3repair is interrupted
+	// by SIGINT or SIGTERM; it is distinct from the exit codes used for errors
+	interruptedExitCode = 130
 )
 
 var (
@@ -136,19 +143,31 @@ func cookCommandLineArguments(o output.Bus, inputArgs []string) []string {
 
 type commandExecutor interface {
 	SetArgs(a []string)
-	Execute() error
+	ExecuteContext(ctx context.Context) error
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately. This is called by main.main(). It
 // only needs to happen once to the rootCmd.
+//
+// The commands run with a context that is cancelled by SIGINT (Ctrl+C) or SIGTERM; once it is cancelled, the commands
+// start no new work, and let the work in progress finish. A second interruption terminates mp3repair immediately.
+// An interrupted command exits with interruptedExitCode, unless, like serve and watch, it runs until it is
+// interrupted.
 func Execute() {
 	start := time.Now()
 	o := getBus()
-	exitCode := runMain(o, rootCmd, start)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, func() {
+		// restore the default behavior, so that a second interruption is not ignored
+		stop()
+		o.ErrorPrintln("Interrupted; finishing the work in progress. Interrupt again to stop immediately.")
+	})
+	exitCode := runMain(ctx, o, rootCmd, start)
 	Exit(exitCode)
 }
 
-func runMain(o output.Bus, cmd commandExecutor, start time.Time) int {
+func runMain(ctx context.Context, o output.Bus, cmd commandExecutor, start time.Time) int {
 	defer func() {
 		if r := recover(); r != nil {
 			o.ErrorPrintf("A runtime error occurred: %q.\n", r)
@@ -171,18 +190,48 @@ func runMain(o output.Bus, cmd commandExecutor, start time.Time) int {
 	})
 	mp3repairElevationControl.Log(o, output.Info)
 	cmd.SetArgs(cookedArgs)
-	err := cmd.Execute()
+	stoppedByInterruption := &atomic.Bool{}
+	err := cmd.ExecuteContext(context.WithValue(ctx, stoppedByInterruptionKey{}, stoppedByInterruption))
 	exitCode := obtainExitCode(err)
+	if ctx.Err() != nil && !stoppedByInterruption.Load() {
+		exitCode = interruptedExitCode
+	}
 	o.Log(output.Info, "execution ends", map[string]any{
 		"duration": since(start),
 		"exitCode": exitCode,
 	})
-	if exitCode != 0 {
+	switch {
+	case exitCode == interruptedExitCode:
+		o.ErrorPrintf("%q version %s, created at %s, was interrupted.\n", applicationName, version, creation)
+	case exitCode != 0:
 		o.ErrorPrintf("%q version %s, created at %s, failed.\n", applicationName, version, creation)
 	}
 	return exitCode
 }
 
+// stoppedByInterruptionKey is the context key of the flag that a command sets
+// when interrupting it is the normal way to stop it
+type stoppedByInterruptionKey struct{}
+
+// runsUntilInterrupted marks the command running in the context as one that
+// runs until it is interrupted, such as serve and watch; interrupting it is
+// then a clean shutdown, and mp3repair exits with the command's own exit code
+func runsUntilInterrupted(ctx context.Context) {
+	if stoppedByInterruption, found := ctx.Value(stoppedByInterruptionKey{}).(*atomic.Bool); found {
+		stoppedByInterruption.Store(true)
+	}
+}
+
+// commandContext returns the context in which the command runs; it is
+// cancelled when mp3repair is interrupted. Commands that are run directly,
+// rather than by Execute, have no context, and run in the background context.
+func commandContext(cmd *cobra.Command) context.Context {
+	if ctx := cmd.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
 func obtainExitCode(err error) int {
 	switch {
 	case err == nil:
@@ -4,6 +4,7 @@ Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"reflect"
@@ -47,18 +48,27 @@ func Test_execute(t *testing.T) {
 
 type happyCommand struct{}
 
-func (h happyCommand) SetArgs(_ []string) {}
-func (h happyCommand) Execute() error     { return nil }
+func (h happyCommand) SetArgs(_ []string)                     {}
+func (h happyCommand) ExecuteContext(_ context.Context) error { return nil }
+
+// serverCommand, like serve and watch, runs until it is interrupted
+type serverCommand struct{}
+
+func (s serverCommand) SetArgs(_ []string) {}
+func (s serverCommand) ExecuteContext(ctx context.Context) error {
+	runsUntilInterrupted(ctx)
+	return nil
+}
 
 type sadCommand struct{}
 
-func (s sadCommand) SetArgs(_ []string) {}
-func (s sadCommand) Execute() error     { return fmt.Errorf("sad") }
+func (s sadCommand) SetArgs(_ []string)                     {}
+func (s sadCommand) ExecuteContext(_ context.Context) error { return fmt.Errorf("sad") }
 
 type panickyCommand struct{}
 
-func (p panickyCommand) SetArgs(_ []string) {}
-func (p panickyCommand) Execute() error     { panic("oh dear") }
+func (p panickyCommand) SetArgs(_ []string)                     {}
+func (p panickyCommand) ExecuteContext(_ context.Context) error { panic("oh dear") }
 
 type localBuildInfo struct {
 	goVersion    string
@@ -121,9 +131,25 @@ func Test_runMain(t *testing.T) {
 		" defaults='" +
 		"about:\n" +
 		"    style: rounded\n" +
+		"checksum:\n" +
+		"    replaceChanged: false\n" +
+		"    verify: false\n" +
+		"cleanup:\n" +
+		"    keepDays: 30\n" +
+		"    keepLatest: 1\n" +
 		"export:\n" +
 		"    defaults: false\n" +
 		"    overwrite: false\n" +
+		"history:\n" +
+		"    album: \"\"\n" +
+		"    artist: \"\"\n" +
+		"    field: \"\"\n" +
+		"    from: \"\"\n" +
+		"    to: \"\"\n" +
+		"    track: \"\"\n" +
+		"id3v2:\n" +
+		"    id3v2Encoding: keep\n" +
+		"    id3v2Version: keep\n" +
 		"io:\n" +
 		"    maxOpenFiles: 1000\n" +
 		"list:\n" +
@@ -134,28 +160,89 @@ func Test_runMain(t *testing.T) {
 		"    byTitle: false\n" +
 		"    diagnostic: false\n" +
 		"    tracks: false\n" +
+		"names:\n" +
+		"    aliases: \"\"\n" +
+		"    ampersand: false\n" +
+		"    foldCase: false\n" +
+		"    invertArticles: false\n" +
+		"    normalizeUnicode: false\n" +
+		"playlist:\n" +
+		"    absolute: false\n" +
+		"    byTitle: false\n" +
+		"    directory: \"\"\n" +
+		"    format: m3u8\n" +
+		"    genre: \"\"\n" +
+		"    name: playlist\n" +
+		"    scope: all\n" +
+		"    years: \"\"\n" +
 		"resetDatabase:\n" +
 		"    force: false\n" +
 		"    ignoreServiceErrors: false\n" +
 		"    timeout: 10\n" +
+		"revert:\n" +
+		"    album: \"\"\n" +
+		"    artist: \"\"\n" +
+		"    dryRun: false\n" +
+		"    field: \"\"\n" +
+		"    from: \"\"\n" +
+		"    to: \"\"\n" +
+		"    track: \"\"\n" +
 		"rewrite:\n" +
+		"    atomic: false\n" +
+		"    backupStore: false\n" +
+		"    createTags: none\n" +
 		"    dryRun: false\n" +
+		"    framePolicy: \"\"\n" +
+		"    repairStructure: false\n" +
+		"    suppressions: \"\"\n" +
 		"scan:\n" +
+		"    duplicates: false\n" +
 		"    empty: false\n" +
 		"    files: false\n" +
+		"    framePolicy: \"\"\n" +
 		"    numbering: false\n" +
+		"    portability: false\n" +
+		"    profile: windows\n" +
+		"    sinceLast: false\n" +
+		"    snapshot: false\n" +
+		"    suppressions: \"\"\n" +
 		"search:\n" +
 		"    albumFilter: .*\n" +
 		"    artistFilter: .*\n" +
 		"    extensions: .mp3\n" +
-		"    trackFilter: .*\n'" +
+		"    trackFilter: .*\n" +
+		"serve:\n" +
+		"    address: 127.0.0.1:8080\n" +
+		"    allowRemote: false\n" +
+		"    framePolicy: \"\"\n" +
+		"    suppressions: \"\"\n" +
+		"    token: \"\"\n" +
+		"stats:\n" +
+		"    json: false\n" +
+		"sync:\n" +
+		"    dryRun: false\n" +
+		"    id3v2Version: \"2.3\"\n" +
+		"    maxArtworkSize: 0\n" +
+		"    maxNameLength: 64\n" +
+		"    prune: false\n" +
+		"    target: \"\"\n" +
+		"watch:\n" +
+		"    framePolicy: \"\"\n" +
+		"    interval: 5\n" +
+		"    maxRewrites: 20\n" +
+		"    quiet: 30\n" +
+		"    rewrite: false\n" +
+		"    suppressions: \"\"\n'" +
 		" dependencies='[foo v1.1.1 bar v1.2.2]'" +
 		" goVersion='1.22.x'" +
 		" mainVersion='0.45.0'" +
 		" timeStamp='2021-11-28T12:01:02Z05:00'" +
 		" version='0.1.2'" +
 		" msg='execution starts'\n"
+	interrupted, cancel := context.WithCancel(context.Background())
+	cancel()
 	type args struct {
+		ctx   context.Context
 		cmd   commandExecutor
 		start time.Time
 	}
@@ -171,7 +258,7 @@ func Test_runMain(t *testing.T) {
 		output.WantedRecording
 	}{
 		"happy": {
-			args:         args{cmd: happyCommand{}, start: time.Now()},
+			args:         args{ctx: context.Background(), cmd: happyCommand{}, start: time.Now()},
 			cmdline:      []string{"happyApp", "arg1", "arg2"},
 			appVersion:   "0.1.2",
 			timestamp:    "2021-11-28T12:01:02Z05:00",
@@ -196,7 +283,7 @@ func Test_runMain(t *testing.T) {
 			},
 		},
 		"sad": {
-			args:         args{cmd: sadCommand{}, start: time.Now()},
+			args:         args{ctx: context.Background(), cmd: sadCommand{}, start: time.Now()},
 			appVersion:   "0.1.2",
 			timestamp:    "2021-11-28T12:01:02Z05:00",
 			cmdline:      []string{"sadApp", "arg1", "arg2"},
@@ -222,8 +309,60 @@ func Test_runMain(t *testing.T) {
 					" msg='execution ends'\n",
 			},
 		},
+		"interrupted": {
+			args:         args{ctx: interrupted, cmd: happyCommand{}, start: time.Now()},
+			appVersion:   "0.1.2",
+			timestamp:    "2021-11-28T12:01:02Z05:00",
+			cmdline:      []string{"happyApp", "arg1", "arg2"},
+			goVersion:    "1.22.x",
+			mainVersion:  "0.45.0",
+			settings:     []string{"-ldflags: -X main.version=0.45.0", "cmd: gcc", "git: 2.3.4"},
+			dependencies: []string{"foo v1.1.1", "bar v1.2.2"},
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"\"mp3repair\" version 0.1.2, created at 2021-11-28T12:01:02Z05:00, was interrupted.\n",
+				Log: startLog +
+					"level='info'" +
+					" admin_permission='true'" +
+					" elevated='true'" +
+					" environment_variable='MP3REPAIR_RUNS_AS_ADMIN'" +
+					" stderr_redirected='false'" +
+					" stdin_redirected='false'" +
+					" stdout_redirected='false'" +
+					" msg='elevation state'\n" +
+					"level='info'" +
+					" duration='0s'" +
+					" exitCode='130'" +
+					" msg='execution ends'\n",
+			},
+		},
+		"server stopped": {
+			args:         args{ctx: interrupted, cmd: serverCommand{}, start: time.Now()},
+			appVersion:   "0.1.2",
+			timestamp:    "2021-11-28T12:01:02Z05:00",
+			cmdline:      []string{"happyApp", "arg1", "arg2"},
+			goVersion:    "1.22.x",
+			mainVersion:  "0.45.0",
+			settings:     []string{"-ldflags: -X main.version=0.45.0", "cmd: gcc", "git: 2.3.4"},
+			dependencies: []string{"foo v1.1.1", "bar v1.2.2"},
+			WantedRecording: output.WantedRecording{
+				Log: startLog +
+					"level='info'" +
+					" admin_permission='true'" +
+					" elevated='true'" +
+					" environment_variable='MP3REPAIR_RUNS_AS_ADMIN'" +
+					" stderr_redirected='false'" +
+					" stdin_redirected='false'" +
+					" stdout_redirected='false'" +
+					" msg='elevation state'\n" +
+					"level='info'" +
+					" duration='0s'" +
+					" exitCode='0'" +
+					" msg='execution ends'\n",
+			},
+		},
 		"panicky": {
-			args:         args{cmd: panickyCommand{}, start: time.Now()},
+			args:         args{ctx: context.Background(), cmd: panickyCommand{}, start: time.Now()},
 			appVersion:   "0.1.2",
 			timestamp:    "2021-11-28T12:01:02Z05:00",
 			cmdline:      []string{"sadApp", "arg1", "arg2"},
@@ -266,7 +405,7 @@ func Test_runMain(t *testing.T) {
 				}
 			}
 			o := output.NewRecorder()
-			runMain(o, tt.args.cmd, tt.args.start)
+			runMain(tt.args.ctx, o, tt.args.cmd, tt.args.start)
 			o.Report(t, "runMain()", tt.WantedRecording)
 		})
 	}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"mp3repair/internal/files"
 	"slices"
@@ -48,6 +49,97 @@ Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
 //   forward slash (/) greater than (>)   less than (<)
 //   question mark (?) quotation mark (") vertical bar (|)
 
+//   Artist and album names are also subject to optional equivalence rules (see the --normalizeUnicode,
+//   --foldCase, --invertArticles, --ampersand, and --aliases flags): when enabled, NFC and NFD forms of a name, names
+//   differing only in letter case, "X, The" and "The X", "&" and "and", and an alias and its preferred name are all
+//   treated as equal. The rules are off by default.
+
+// About portability:
+
+//   The portability scan reports names that may not survive being copied to other file systems, such as the FAT32
+//   and exFAT file systems used by car stereos and portable players: Windows reserved names (CON, PRN, AUX, NUL, COM1
+//   through COM9, and LPT1 through LPT9, with or without an extension), names ending in a period or a space, paths
+//   longer than 260 characters, names within the same directory that differ only in letter case or in Unicode
+//   normalization (NFC vs NFD), and names containing characters that the --profile file system does not allow.
+
+// About suppressions:
+
+//   The --suppressions flag names a YAML file listing concerns that are known and accepted, such as albums whose
+//   metadata deliberately uses a transliterated title. Each entry names an artist, optionally an album and a track, and
+//   a concern type (empty, files, metadata conflict, numbering, or portability); files and metadata conflict entries
+//   may also name a field (album, artist, genre, mcdi, number, title, or year). An entry may give a reason, and an
+//   expiration date (YYYY-MM-DD) after which it no longer applies. For example:
+
+//   - artist: Tchaikovsky
+//     album: Lebedinoye Ozero
+//     concern: files
+//     field: album
+//     reason: transliterated title
+//     expires: 2027-06-30
+
+//   Matching concerns are not reported; instead, the scan reports how many concerns were suppressed, which entries
+//   have expired, and which entries no longer match any concern. The rewrite command does not correct the fields
+//   covered by files and metadata conflict entries.
+
+// About frame policies:
+
+//   The --framePolicy flag names a YAML file describing which ID3V2 frames the tags may or must contain; ripping
+//   software often leaves clutter such as PRIV (private), COMM (comment), TENC (encoded by), and WXXX (user defined
+//   URL) frames. A policy either lists the frames that are allowed, or the frames that are denied, and may list
+//   frames that are required. The frames holding the metadata that mp3repair manages (TALB, TCON, TDAT, TDRC, TIT2,
+//   TPE1, TRCK, TYER, and MCDI) are always allowed. The library policy applies to every artist without a policy of
+//   its own. For example:
+
+//   library:
+//     deny: [COMM, PRIV, TENC, WXXX]
+//   artists:
+//     Tchaikovsky:
+//       allow: [APIC, TCOM]
+//       require: [APIC, TCOM]
+
+//   The file scan reports the frames that a policy does not permit, the required frames that are missing, and text
+//   frames that appear more than once in a tag; the rewrite command removes the frames that a policy does not
+//   permit and the duplicated text frames.
+
+// About snapshots:
+
+//   The --snapshot flag saves the scan's results to a timestamped file in the snapshots subdirectory of the
+//   application data directory. The --sinceLast flag compares the scan's results to the most recent snapshot and
+//   reports only the concerns that are new, resolved, or changed (a concern of the same type about the same artist,
+//   album, or track, with a different message) since then, instead of reporting every concern. Only the concern types
+//   that both scans looked for are compared, so a nightly job running
+//     scan --files --numbering --snapshot --sinceLast
+//   reports only regressions and repairs, not the whole backlog. Both scans should use the same search filters;
+//   concerns about artists, albums, and tracks excluded from the current scan are reported as resolved.
+
+// About ID3V2 versions and encodings:
+
+//   The --id3v2Version and --id3v2Encoding flags set the ID3V2 version (2.3 or 2.4) and text encoding (ISO-8859-1,
+//   UTF-16, or UTF-8) that the rewrite command writes; some older hardware players cannot read ID3V2.4 tags or UTF-8
+//   text. The file scan reports tracks whose ID3V2 tags use a different version, or whose frames use a different
+//   encoding. ISO-8859-1 is only required for text that it can represent, and ID3V2.3 tags, which cannot use UTF-8,
+//   are expected to use ISO-8859-1 or UTF-16. By default, each tag's version and each frame's encoding are kept, and
+//   only UTF-8 text in ID3V2.3 tags is reported.
+
+// About ID3V2 tag structure:
+
+//   The file scan reports ID3V2 tags with structural defects: several tags stacked at the start of a file, a tag
+//   appended to the end of a file, ID3V2.4 tags whose frame sizes are not synchsafe, frames that cannot be read, and
+//   more than 64 KiB of padding. Most software, including mp3repair, reads only the first tag at the start of a
+//   file, and misreads frames whose sizes are written incorrectly. The rewrite command's --repairStructure flag
+//   replaces such tags with a single clean tag.
+
+// About duplicates:
+
+//   The --duplicates flag computes a checksum of each track's audio, excluding its tags, and reports groups of
+//   tracks whose audio is identical, groups of albums whose tracks have the same MCDI (music CD identifier) frame,
+//   such as the same CD ripped twice under different album names, and groups of tracks that are likely to be the
+//   same recording: tracks with the same artist and title, ignoring letter case, punctuation, and parenthesized
+//   qualifiers such as "(Remastered)", whose durations differ by no more than two seconds. Each group suggests the
+//   copy to keep: the album with the most tracks, or the track on the album with the most tracks, which is more
+//   likely to be the original album than a compilation or a partial rip. Duplicates are not recorded in snapshots,
+//   and are always reported in full.
+
 // About ID3V1 and ID3V2 consistency:
 
 //   The ID3V1 format is older (more primitive) than the ID3V2 format, and the scan code takes into account:
@@ -56,22 +148,38 @@ Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
 //   - ID3V1 encodes genre as a numeric code that indexes a table of genre names; ID3V2 encodes genre as free-form text.
 
 const (
-	scanCommand       = "scan"
-	scanEmpty         = "empty"
-	scanEmptyAbbr     = "e"
-	scanEmptyFlag     = "--" + scanEmpty
-	scanFiles         = "files"
-	scanFilesAbbr     = "f"
-	scanFilesFlag     = "--" + scanFiles
-	scanNumbering     = "numbering"
-	scanNumberingAbbr = "n"
-	scanNumberingFlag = "--" + scanNumbering
+	scanCommand         = "scan"
+	scanDuplicates      = "duplicates"
+	scanDuplicatesAbbr  = "d"
+	scanDuplicatesFlag  = "--" + scanDuplicates
+	scanEmpty           = "empty"
+	scanEmptyAbbr       = "e"
+	scanEmptyFlag       = "--" + scanEmpty
+	scanFiles           = "files"
+	scanFilesAbbr       = "f"
+	scanFilesFlag       = "--" + scanFiles
+	scanNumbering       = "numbering"
+	scanNumberingAbbr   = "n"
+	scanNumberingFlag   = "--" + scanNumbering
+	scanPortability     = "portability"
+	scanPortabilityAbbr = "p"
+	scanPortabilityFlag = "--" + scanPortability
+	scanProfile         = "profile"
+	scanProfileFlag     = "--" + scanProfile
+	scanSinceLast       = "sinceLast"
+	scanSinceLastFlag   = "--" + scanSinceLast
+	scanSnapshot        = "snapshot"
+	scanSnapshotFlag    = "--" + scanSnapshot
+	scanSuppressionsEg  = "suppressions.yaml"
+	scanFramePolicyEg   = "frames.yaml"
 )
 
 var (
 	scanCmd = &cobra.Command{
-		Use: scanCommand + " [" + scanEmptyFlag + "] [" + scanFilesFlag + "] [" + scanNumberingFlag + "] " +
-			searchUsage + " " + ioUsage,
+		Use: scanCommand + " [" + scanDuplicatesFlag + "] [" + scanEmptyFlag + "] [" + scanFilesFlag + "] [" +
+			scanNumberingFlag + "] [" + scanPortabilityFlag + "] [" + scanProfileFlag + " profile] [" +
+			suppressionsFileFlag + " file] [" + framePolicyFileFlag + " file] [" + scanSnapshotFlag + "] [" +
+			scanSinceLastFlag + "] " + searchUsage + " " + ioUsage + " " + namesUsage + " " + id3v2Usage,
 		DisableFlagsInUseLine: true,
 		Short: "" +
 			"Inspects mp3 files and their directories and reports" + " problems",
@@ -84,12 +192,31 @@ var (
 			scanCommand + " " + scanFilesFlag + "\n" +
 			"  reads each mp3 file's metadata and reports any inconsistencies found\n" +
 			scanCommand + " " + scanNumberingFlag + "\n" +
-			"  reports errors in the track numbers of mp3 files",
+			"  reports errors in the track numbers of mp3 files\n" +
+			scanCommand + " " + scanDuplicatesFlag + "\n" +
+			"  reports identical tracks, albums ripped from the same CD, and tracks that are likely the same\n" +
+			"  recording, suggesting which copy to keep\n" +
+			scanCommand + " " + scanPortabilityFlag + " " + scanProfileFlag + " fat32\n" +
+			"  reports file and directory names that cannot be copied to a FAT32 device\n" +
+			scanCommand + " " + scanFilesFlag + " " + suppressionsFileFlag + " " + scanSuppressionsEg + "\n" +
+			"  reports metadata/file inconsistencies, except for those listed in " + scanSuppressionsEg + "\n" +
+			scanCommand + " " + scanFilesFlag + " " + framePolicyFileFlag + " " + scanFramePolicyEg + "\n" +
+			"  reports metadata/file inconsistencies, and ID3V2 frames that violate the policies in " +
+			scanFramePolicyEg + "\n" +
+			scanCommand + " " + scanFilesFlag + " " + scanSnapshotFlag + " " + scanSinceLastFlag + "\n" +
+			"  reports only the metadata/file inconsistencies that are new, resolved, or changed since the\n" +
+			"  previous snapshot, and saves a new snapshot",
 		RunE: scanRun,
 	}
 	scanFlags = &cmdtoolkit.FlagSet{
 		Name: scanCommand,
 		Details: map[string]*cmdtoolkit.FlagDetails{
+			scanDuplicates: {
+				AbbreviatedName: scanDuplicatesAbbr,
+				Usage:           "report duplicate tracks and albums",
+				ExpectedType:    cmdtoolkit.BoolType,
+				DefaultValue:    false,
+			},
 			scanEmpty: {
 				AbbreviatedName: scanEmptyAbbr,
 				Usage:           "report empty album and artist directories",
@@ -108,6 +235,38 @@ var (
 				ExpectedType:    cmdtoolkit.BoolType,
 				DefaultValue:    false,
 			},
+			scanPortability: {
+				AbbreviatedName: scanPortabilityAbbr,
+				Usage:           "report file and directory names that may not be usable on other file systems",
+				ExpectedType:    cmdtoolkit.BoolType,
+				DefaultValue:    false,
+			},
+			scanProfile: {
+				Usage: "target file system for " + scanPortabilityFlag + ": one of " +
+					strings.Join(files.PortabilityProfileNames(), ", "),
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "windows",
+			},
+			suppressionsFile: {
+				Usage:        suppressionsUsage,
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			framePolicyFile: {
+				Usage:        framePolicyUsage,
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			scanSnapshot: {
+				Usage:        "save the results to a timestamped snapshot in the application data directory",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+			scanSinceLast: {
+				Usage:        "report only the concerns that are new, resolved, or changed since the most recent snapshot",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
 		},
 	}
 )
@@ -115,33 +274,55 @@ var (
 func scanRun(cmd *cobra.Command, _ []string) error {
 	exitError := cmdtoolkit.NewExitProgrammingError(scanCommand)
 	o := getBus()
+	ctx := commandContext(cmd)
 	producer := cmd.Flags()
 	values, eSlice := cmdtoolkit.ReadFlags(producer, scanFlags)
 	ss, searchFlagsOk := evaluateSearchFlags(o, producer)
 	ios, ioFlagsOk := evaluateIOFlags(o, producer)
-	if cmdtoolkit.ProcessFlagErrors(o, eSlice) && searchFlagsOk && ioFlagsOk {
+	ns, namesFlagsOk := evaluateNamesFlags(o, producer)
+	is, id3v2FlagsOk := evaluateID3V2Flags(o, producer)
+	if cmdtoolkit.ProcessFlagErrors(o, eSlice) && searchFlagsOk && ioFlagsOk && namesFlagsOk && id3v2FlagsOk {
+		is.apply()
 		if cs, flagsOk := processScanFlags(o, values); flagsOk {
-			exitError = cs.maybeDoWork(o, ss, ios)
+			cs.names = ns.equivalence
+			exitError = cs.maybeDoWork(ctx, o, ss, ios)
 		}
 	}
 	return cmdtoolkit.ToErrorInterface(exitError)
 }
 
 type scanSettings struct {
-	empty     cmdtoolkit.CommandFlag[bool]
-	files     cmdtoolkit.CommandFlag[bool]
-	numbering cmdtoolkit.CommandFlag[bool]
+	duplicates   cmdtoolkit.CommandFlag[bool]
+	empty        cmdtoolkit.CommandFlag[bool]
+	files        cmdtoolkit.CommandFlag[bool]
+	numbering    cmdtoolkit.CommandFlag[bool]
+	portability  cmdtoolkit.CommandFlag[bool]
+	profile      files.PortabilityProfile
+	suppressions *suppressions
+	framePolicy  *framePolicies
+	names        files.NameEquivalence
+	snapshot     cmdtoolkit.CommandFlag[bool]
+	sinceLast    cmdtoolkit.CommandFlag[bool]
+	// the artists selected by the search filters, with their metadata read;
+	// nil until a scan needs them
+	selected []*files.Artist
 }
 
-func (scanSets *scanSettings) maybeDoWork(o output.Bus, ss *searchSettings, ios *ioSettings) (err *cmdtoolkit.ExitError) {
+func (scanSets *scanSettings) maybeDoWork(
+	ctx context.Context,
+	o output.Bus,
+	ss *searchSettings,
+	ios *ioSettings,
+) (err *cmdtoolkit.ExitError) {
 	err = cmdtoolkit.NewExitUserError(scanCommand)
 	if scanSets.hasWorkToDo(o) {
-		err = scanSets.performScans(o, ss.load(o), ss, ios)
+		err = scanSets.performScans(ctx, o, ss.load(ctx, o), ss, ios)
 	}
 	return
 }
 
 func (scanSets *scanSettings) performScans(
+	ctx context.Context,
 	o output.Bus,
 	artists []*files.Artist,
 	ss *searchSettings,
@@ -154,20 +335,144 @@ func (scanSets *scanSettings) performScans(
 		concernedArtists := createConcernedArtists(artists)
 		requests.reportEmptyScanResults = scanSets.performEmptyAnalysis(concernedArtists)
 		requests.reportNumberingScanResults = scanSets.performNumberingAnalysis(concernedArtists)
-		requests.reportFilesScanResults = scanSets.performFileAnalysis(o, concernedArtists, ss, ios)
-		for _, artist := range concernedArtists {
-			artist.rollup()
-			artist.toConsole(o)
+		requests.reportFilesScanResults = scanSets.performFileAnalysis(ctx, o, concernedArtists, ss, ios)
+		duplicates := scanSets.performDuplicateAnalysis(ctx, o, concernedArtists, ss, ios)
+		interrupted := ctx.Err() != nil
+		requests.reportPortabilityScanResults = scanSets.performPortabilityAnalysis(concernedArtists)
+		hidden := 0
+		if scanSets.suppressions != nil {
+			hidden = scanSets.suppressions.hide(concernedArtists, currentTime())
+			requests.reportEmptyScanResults = requests.reportEmptyScanResults &&
+				anyConcerns(concernedArtists, emptyConcern)
+			requests.reportNumberingScanResults = requests.reportNumberingScanResults &&
+				anyConcerns(concernedArtists, numberingConcern)
+			requests.reportFilesScanResults = requests.reportFilesScanResults &&
+				anyConcerns(concernedArtists, filesConcern)
+			requests.reportPortabilityScanResults = requests.reportPortabilityScanResults &&
+				anyConcerns(concernedArtists, portabilityConcern)
+		}
+		switch {
+		case interrupted:
+			// an incomplete scan is reported, but not recorded
+			o.ConsolePrintln("The scan was interrupted; these results are partial. The file analysis " +
+				"covers only the albums whose metadata was completely read, and no snapshot was recorded.")
+			o.Log(output.Info, "scan interrupted", map[string]any{
+				"command": scanCommand,
+			})
+		case scanSets.snapshot.Value || scanSets.sinceLast.Value:
+			err = scanSets.processSnapshot(o, newConcernSnapshot(concernedArtists, scanSets.scanTypes(), currentTime()))
+		}
+		if interrupted || !scanSets.sinceLast.Value {
+			for _, artist := range concernedArtists {
+				artist.rollup()
+				artist.toConsole(o)
+			}
+			scanSets.maybeReportCleanResults(o, requests)
+		}
+		if scanSets.duplicates.Value {
+			if interrupted {
+				o.ConsolePrintln("Duplicate Analysis: interrupted; no duplicates can be reported.")
+			} else {
+				reportDuplicates(o, duplicates)
+			}
+		}
+		if scanSets.suppressions != nil {
+			scanSets.suppressions.report(o, hidden, func(sup *suppression) bool {
+				// an interrupted file analysis cannot show a files suppression
+				// to be stale
+				return !(interrupted && sup.concern == filesConcern) && scanSets.scannedFor(sup, ss)
+			}, currentTime())
 		}
-		scanSets.maybeReportCleanResults(o, requests)
 	}
 	return
 }
 
+// scanTypes returns the names of the concern types that the scan looks for
+func (scanSets *scanSettings) scanTypes() []string {
+	var scans []string
+	if scanSets.empty.Value {
+		scans = append(scans, concernName(emptyConcern))
+	}
+	if scanSets.files.Value {
+		scans = append(scans, concernName(filesConcern))
+	}
+	if scanSets.numbering.Value {
+		scans = append(scans, concernName(numberingConcern))
+	}
+	if scanSets.portability.Value {
+		scans = append(scans, concernName(portabilityConcern))
+	}
+	return scans
+}
+
+// processSnapshot reports the differences between the current snapshot and
+// the most recent saved snapshot, if requested, and then saves the current
+// snapshot, if requested
+func (scanSets *scanSettings) processSnapshot(o output.Bus, current *concernSnapshot) *cmdtoolkit.ExitError {
+	if scanSets.sinceLast.Value {
+		previous, loaded := loadLatestSnapshot(o)
+		if !loaded {
+			return cmdtoolkit.NewExitSystemError(scanCommand)
+		}
+		baseline := previous
+		if baseline == nil {
+			baseline = &concernSnapshot{Scans: current.Scans}
+		}
+		current.diff(baseline).report(o, previous)
+	}
+	if scanSets.snapshot.Value {
+		return current.save(o)
+	}
+	return nil
+}
+
+// anyConcerns determines whether any artist, album, or track has a concern of
+// the specified type
+func anyConcerns(concernedArtists []*concernedArtist, kind concernType) bool {
+	for _, cAr := range concernedArtists {
+		if len(cAr.concerns.concernsCollection[kind]) != 0 {
+			return true
+		}
+		for _, cAl := range cAr.albums() {
+			if len(cAl.concerns.concernsCollection[kind]) != 0 {
+				return true
+			}
+			for _, cT := range cAl.tracks() {
+				if len(cT.concerns.concernsCollection[kind]) != 0 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// scannedFor determines whether the scans could have found the concerns that a
+// suppression hides; if not, the suppression cannot be judged to be stale
+func (scanSets *scanSettings) scannedFor(sup *suppression, ss *searchSettings) bool {
+	switch sup.concern {
+	case emptyConcern:
+		return scanSets.empty.Value
+	case numberingConcern:
+		return scanSets.numbering.Value
+	case portabilityConcern:
+		return scanSets.portability.Value
+	case filesConcern:
+		// the file analysis only examines the tracks selected by the search
+		// filters
+		return scanSets.files.Value && ss.artistFilter.MatchString(sup.Artist) &&
+			(sup.Album == "" || ss.albumFilter.MatchString(sup.Album)) &&
+			(sup.Track == "" || ss.trackFilter.MatchString(sup.Track))
+	default:
+		return false
+	}
+}
+
 type scanReportRequests struct {
-	reportEmptyScanResults     bool
-	reportFilesScanResults     bool
-	reportNumberingScanResults bool
+	reportEmptyScanResults       bool
+	reportFilesScanResults       bool
+	reportNumberingScanResults   bool
+	reportPortabilityScanResults bool
 }
 
 func (scanSets *scanSettings) maybeReportCleanResults(o output.Bus, requests scanReportRequests) {
@@ -180,9 +485,13 @@ func (scanSets *scanSettings) maybeReportCleanResults(o output.Bus, requests sca
 	if !requests.reportFilesScanResults && scanSets.files.Value {
 		o.ConsolePrintln("File Analysis: no inconsistencies found.")
 	}
+	if !requests.reportPortabilityScanResults && scanSets.portability.Value {
+		o.ConsolePrintf("Portability Analysis: no problems found for %s.\n", scanSets.profile.Name())
+	}
 }
 
 func (scanSets *scanSettings) performFileAnalysis(
+	ctx context.Context,
 	o output.Bus,
 	concernedArtists []*concernedArtist,
 	ss *searchSettings,
@@ -190,16 +499,20 @@ func (scanSets *scanSettings) performFileAnalysis(
 ) bool {
 	foundConcerns := false
 	if scanSets.files.Value {
-		artists := make([]*files.Artist, 0, len(concernedArtists))
-		for _, cAr := range concernedArtists {
-			artists = append(artists, cAr.backingArtist())
-		}
-		if filteredArtists := ss.filter(o, artists); len(filteredArtists) != 0 {
-			readMetadata(o, filteredArtists, ios.openFileLimit)
+		if filteredArtists := scanSets.selectedArtists(ctx, o, concernedArtists, ss, ios); len(filteredArtists) != 0 {
 			for _, artist := range filteredArtists {
 				for _, album := range artist.Albums() {
+					if ctx.Err() != nil && !album.MetadataRead() {
+						// the scan was interrupted before the album was read
+						continue
+					}
 					for _, track := range album.Tracks() {
-						concerns := track.ReportMetadataProblems()
+						concerns := append(track.ReportMetadataProblems(), track.ID3V2FormatProblems()...)
+						concerns = append(concerns, track.ID3V2StructureDefects()...)
+						if scanSets.framePolicy != nil {
+							concerns = append(concerns,
+								track.FramePolicyViolations(scanSets.framePolicy.forArtist(artist.Name()))...)
+						}
 						if found := recordTrackFileConcerns(concernedArtists, track, concerns); found {
 							foundConcerns = true
 						}
@@ -211,6 +524,58 @@ func (scanSets *scanSettings) performFileAnalysis(
 	return foundConcerns
 }
 
+// selectedArtists returns the artists, albums, and tracks selected by the
+// search filters, with their metadata read; the metadata is read only once,
+// however many scans need it
+func (scanSets *scanSettings) selectedArtists(
+	ctx context.Context,
+	o output.Bus,
+	concernedArtists []*concernedArtist,
+	ss *searchSettings,
+	ios *ioSettings,
+) []*files.Artist {
+	if scanSets.selected == nil {
+		artists := make([]*files.Artist, 0, len(concernedArtists))
+		for _, cAr := range concernedArtists {
+			artists = append(artists, cAr.backingArtist())
+		}
+		scanSets.selected = ss.filter(o, artists)
+		if len(scanSets.selected) != 0 {
+			applyNameEquivalence(scanSets.selected, scanSets.names)
+			readMetadata(ctx, o, scanSets.selected, ios.openFileLimit)
+		}
+	}
+	return scanSets.selected
+}
+
+// performDuplicateAnalysis finds the duplicated tracks and albums among the
+// tracks selected by the search filters
+func (scanSets *scanSettings) performDuplicateAnalysis(
+	ctx context.Context,
+	o output.Bus,
+	concernedArtists []*concernedArtist,
+	ss *searchSettings,
+	ios *ioSettings,
+) []*duplicateGroup {
+	if !scanSets.duplicates.Value {
+		return nil
+	}
+	filteredArtists := scanSets.selectedArtists(ctx, o, concernedArtists, ss, ios)
+	if len(filteredArtists) == 0 || ctx.Err() != nil {
+		return nil
+	}
+	results := computeAudioChecksums(ctx, o, filteredArtists, ios.openFileLimit)
+	if ctx.Err() != nil {
+		return nil
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			reportChecksumFailure(o, scanCommand, result)
+		}
+	}
+	return findDuplicates(filteredArtists, results, scanSets.names)
+}
+
 func recordTrackFileConcerns(artists []*concernedArtist, track *files.Track, concerns []string) (foundConcerns bool) {
 	if len(concerns) > 0 {
 		foundConcerns = true
@@ -340,56 +705,119 @@ func (scanSets *scanSettings) performEmptyAnalysis(concernedArtists []*concerned
 	return emptyFoldersFound
 }
 
-func (scanSets *scanSettings) hasWorkToDo(o output.Bus) bool {
-	if scanSets.empty.Value || scanSets.files.Value || scanSets.numbering.Value {
-		return true
+// concernRecorder is implemented by concerned artists, albums, and tracks
+type concernRecorder interface {
+	addConcern(source concernType, concern string)
+}
+
+func recordConcerns(recorder concernRecorder, source concernType, concerns []string) bool {
+	for _, s := range concerns {
+		recorder.addConcern(source, s)
 	}
-	userPartiallyAtFault := scanSets.empty.UserSet || scanSets.files.UserSet || scanSets.numbering.UserSet
-	o.ErrorPrintln("No scans will be performed.")
-	o.ErrorPrintln("Why?")
-	switch userPartiallyAtFault {
-	case true:
-		flagsUserSet := make([]string, 0, 3)
-		flagsFromConfig := make([]string, 0, 3)
-		switch scanSets.empty.UserSet {
-		case true:
-			flagsUserSet = append(flagsUserSet, scanEmptyFlag)
-		case false:
-			flagsFromConfig = append(flagsFromConfig, scanEmptyFlag)
+	return len(concerns) != 0
+}
+
+func (scanSets *scanSettings) performPortabilityAnalysis(concernedArtists []*concernedArtist) bool {
+	foundConcerns := false
+	if scanSets.portability.Value {
+		artistNames := make([]string, 0, len(concernedArtists))
+		for _, cAr := range concernedArtists {
+			artistNames = append(artistNames, cAr.name())
 		}
-		switch scanSets.files.UserSet {
-		case true:
-			flagsUserSet = append(flagsUserSet, scanFilesFlag)
-		case false:
-			flagsFromConfig = append(flagsFromConfig, scanFilesFlag)
+		artistCollisions := files.NameCollisions(artistNames)
+		for _, cAr := range concernedArtists {
+			artist := cAr.backingArtist()
+			if scanSets.checkPortability(cAr, artist.Name(), artistCollisions, artist.Directory(),
+				!artist.HasAlbums()) {
+				foundConcerns = true
+			}
+			albumNames := make([]string, 0, len(cAr.albums()))
+			for _, cAl := range cAr.albums() {
+				albumNames = append(albumNames, cAl.name())
+			}
+			albumCollisions := files.NameCollisions(albumNames)
+			for _, cAl := range cAr.albums() {
+				album := cAl.backingAlbum()
+				if scanSets.checkPortability(cAl, album.Title(), albumCollisions, album.Directory(),
+					!album.HasTracks()) {
+					foundConcerns = true
+				}
+				trackNames := make([]string, 0, len(cAl.tracks()))
+				for _, cT := range cAl.tracks() {
+					trackNames = append(trackNames, cT.backingTrack().FileName())
+				}
+				trackCollisions := files.NameCollisions(trackNames)
+				for _, cT := range cAl.tracks() {
+					track := cT.backingTrack()
+					if scanSets.checkPortability(cT, track.FileName(), trackCollisions, track.Path(), true) {
+						foundConcerns = true
+					}
+				}
+			}
+		}
+	}
+	return foundConcerns
+}
+
+// checkPortability records the portability concerns for a file or directory;
+// the path length is only checked for the deepest paths, as the paths of any
+// files or directories they contain are longer
+func (scanSets *scanSettings) checkPortability(
+	recorder concernRecorder,
+	name string,
+	collisions map[string][]string,
+	path string,
+	checkPath bool,
+) bool {
+	concerns := scanSets.profile.NameProblems(name)
+	concerns = append(concerns, collisions[name]...)
+	if checkPath {
+		if length := files.PathLength(path); length > files.MaxPortablePathLength {
+			concerns = append(concerns, fmt.Sprintf("path is %d characters long; Windows limits paths to %d characters",
+				length, files.MaxPortablePathLength))
+		}
+	}
+	return recordConcerns(recorder, portabilityConcern, concerns)
+}
+
+func (scanSets *scanSettings) hasWorkToDo(o output.Bus) bool {
+	scans := []struct {
+		flag    string
+		setting cmdtoolkit.CommandFlag[bool]
+	}{
+		{flag: scanDuplicatesFlag, setting: scanSets.duplicates},
+		{flag: scanEmptyFlag, setting: scanSets.empty},
+		{flag: scanFilesFlag, setting: scanSets.files},
+		{flag: scanNumberingFlag, setting: scanSets.numbering},
+		{flag: scanPortabilityFlag, setting: scanSets.portability},
+	}
+	allFlags := make([]string, 0, len(scans))
+	flagsUserSet := make([]string, 0, len(scans))
+	flagsFromConfig := make([]string, 0, len(scans))
+	for _, scan := range scans {
+		if scan.setting.Value {
+			return true
 		}
-		switch scanSets.numbering.UserSet {
+		allFlags = append(allFlags, scan.flag)
+		switch scan.setting.UserSet {
 		case true:
-			flagsUserSet = append(flagsUserSet, scanNumberingFlag)
+			flagsUserSet = append(flagsUserSet, scan.flag)
 		case false:
-			flagsFromConfig = append(flagsFromConfig, scanNumberingFlag)
-		}
-		switch len(flagsFromConfig) {
-		case 0:
-			o.ErrorPrintf(
-				"You explicitly set %s, %s, and %s false.\n",
-				scanEmptyFlag,
-				scanFilesFlag,
-				scanNumberingFlag,
-			)
-		default:
-			o.ErrorPrintf(
-				"In addition to %s configured false, you explicitly set %s false.\n",
-				strings.Join(flagsFromConfig, " and "),
-				strings.Join(flagsUserSet, " and "))
+			flagsFromConfig = append(flagsFromConfig, scan.flag)
 		}
+	}
+	o.ErrorPrintln("No scans will be performed.")
+	o.ErrorPrintln("Why?")
+	switch {
+	case len(flagsUserSet) == 0:
+		o.ErrorPrintf("The flags %s are all configured false.\n", joinFlagNames(allFlags))
+	case len(flagsFromConfig) == 0:
+		o.ErrorPrintf("You explicitly set %s false.\n", joinFlagNames(allFlags))
 	default:
 		o.ErrorPrintf(
-			"The flags %s, %s, and %s are all configured false.\n",
-			scanEmptyFlag,
-			scanFilesFlag,
-			scanNumberingFlag,
-		)
+			"In addition to %s configured false, you explicitly set %s false.\n",
+			joinFlagNames(flagsFromConfig),
+			joinFlagNames(flagsUserSet))
 	}
 	o.ErrorPrintln("What to do:")
 	o.ErrorPrintln("Either:")
@@ -400,10 +828,27 @@ func (scanSets *scanSettings) hasWorkToDo(o output.Bus) bool {
 	return false
 }
 
+// joinFlagNames formats a list of flags as "a", "a and b", or "a, b, and c"
+func joinFlagNames(flags []string) string {
+	switch len(flags) {
+	case 0:
+		return ""
+	case 1:
+		return flags[0]
+	case 2:
+		return flags[0] + " and " + flags[1]
+	default:
+		return strings.Join(flags[:len(flags)-1], ", ") + ", and " + flags[len(flags)-1]
+	}
+}
+
 func processScanFlags(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any]) (*scanSettings, bool) {
 	settings := &scanSettings{}
 	flagsOk := true // optimistic
 	var flagErr error
+	if settings.duplicates, flagErr = cmdtoolkit.GetBool(o, values, scanDuplicates); flagErr != nil {
+		flagsOk = false
+	}
 	if settings.empty, flagErr = cmdtoolkit.GetBool(o, values, scanEmpty); flagErr != nil {
 		flagsOk = false
 	}
@@ -413,11 +858,57 @@ func processScanFlags(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[an
 	if settings.numbering, flagErr = cmdtoolkit.GetBool(o, values, scanNumbering); flagErr != nil {
 		flagsOk = false
 	}
+	if settings.portability, flagErr = cmdtoolkit.GetBool(o, values, scanPortability); flagErr != nil {
+		flagsOk = false
+	}
+	if profile, profileOk := evaluateProfile(o, values); profileOk {
+		settings.profile = profile
+	} else {
+		flagsOk = false
+	}
+	if sups, suppressionsOk := evaluateSuppressions(o, values); suppressionsOk {
+		settings.suppressions = sups
+	} else {
+		flagsOk = false
+	}
+	if policies, policiesOk := evaluateFramePolicies(o, values); policiesOk {
+		settings.framePolicy = policies
+	} else {
+		flagsOk = false
+	}
+	if settings.snapshot, flagErr = cmdtoolkit.GetBool(o, values, scanSnapshot); flagErr != nil {
+		flagsOk = false
+	}
+	if settings.sinceLast, flagErr = cmdtoolkit.GetBool(o, values, scanSinceLast); flagErr != nil {
+		flagsOk = false
+	}
 	return settings, flagsOk
 }
 
+func evaluateProfile(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any]) (files.PortabilityProfile,
+	bool) {
+	rawValue, flagErr := cmdtoolkit.GetString(o, values, scanProfile)
+	if flagErr != nil {
+		return files.PortabilityProfile{}, false
+	}
+	profile, found := files.LookupPortabilityProfile(rawValue.Value)
+	if !found {
+		o.ErrorPrintf("The %s value %q cannot be used.\n", scanProfileFlag, rawValue.Value)
+		o.ErrorPrintln("Why?")
+		o.ErrorPrintln("The value is not a known file system profile.")
+		o.ErrorPrintln("What to do:")
+		o.ErrorPrintf("Use one of these values: %s.\n", strings.Join(files.PortabilityProfileNames(), ", "))
+		o.Log(output.Error, "invalid profile", map[string]any{
+			scanProfileFlag: rawValue.Value,
+			"user-set":      rawValue.UserSet,
+		})
+	}
+	return profile, found
+}
+
 func init() {
 	rootCmd.AddCommand(scanCmd)
 	cmdtoolkit.AddDefaults(scanFlags)
-	cmdtoolkit.AddFlags(getBus(), getConfiguration(), scanCmd.Flags(), scanFlags, searchFlags, ioFlags)
+	cmdtoolkit.AddFlags(getBus(), getConfiguration(), scanCmd.Flags(), scanFlags, searchFlags, ioFlags,
+		namesFlags, id3v2Flags)
 }
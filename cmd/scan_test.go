@@ -4,11 +4,14 @@ Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"mp3repair/internal/files"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/adrg/xdg"
@@ -17,6 +20,11 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	windowsProfile, _ = files.LookupPortabilityProfile("windows")
+	fat32Profile, _   = files.LookupPortabilityProfile("fat32")
+)
+
 func Test_processScanFlags(t *testing.T) {
 	tests := map[string]struct {
 		values map[string]*cmdtoolkit.CommandFlag[any]
@@ -30,10 +38,21 @@ func Test_processScanFlags(t *testing.T) {
 			want1:  false,
 			WantedRecording: output.WantedRecording{
 				Error: "" +
+					"An internal error occurred: flag \"duplicates\" is not found.\n" +
 					"An internal error occurred: flag \"empty\" is not found.\n" +
 					"An internal error occurred: flag \"files\" is not found.\n" +
-					"An internal error occurred: flag \"numbering\" is not found.\n",
+					"An internal error occurred: flag \"numbering\" is not found.\n" +
+					"An internal error occurred: flag \"portability\" is not found.\n" +
+					"An internal error occurred: flag \"profile\" is not found.\n" +
+					"An internal error occurred: flag \"suppressions\" is not found.\n" +
+					"An internal error occurred: flag \"framePolicy\" is not found.\n" +
+					"An internal error occurred: flag \"snapshot\" is not found.\n" +
+					"An internal error occurred: flag \"sinceLast\" is not found.\n",
 				Log: "" +
+					"level='error'" +
+					" error='flag not found'" +
+					" flag='duplicates'" +
+					" msg='internal error'\n" +
 					"level='error'" +
 					" error='flag not found'" +
 					" flag='empty'" +
@@ -45,31 +64,105 @@ func Test_processScanFlags(t *testing.T) {
 					"level='error'" +
 					" error='flag not found'" +
 					" flag='numbering'" +
+					" msg='internal error'\n" +
+					"level='error'" +
+					" error='flag not found'" +
+					" flag='portability'" +
+					" msg='internal error'\n" +
+					"level='error'" +
+					" error='flag not found'" +
+					" flag='profile'" +
+					" msg='internal error'\n" +
+					"level='error'" +
+					" error='flag not found'" +
+					" flag='suppressions'" +
+					" msg='internal error'\n" +
+					"level='error'" +
+					" error='flag not found'" +
+					" flag='framePolicy'" +
+					" msg='internal error'\n" +
+					"level='error'" +
+					" error='flag not found'" +
+					" flag='snapshot'" +
+					" msg='internal error'\n" +
+					"level='error'" +
+					" error='flag not found'" +
+					" flag='sinceLast'" +
 					" msg='internal error'\n",
 			},
 		},
 		"out of the box": {
 			values: map[string]*cmdtoolkit.CommandFlag[any]{
-				"empty":     {Value: false},
-				"files":     {Value: false},
-				"numbering": {Value: false},
+				"duplicates":   {Value: false},
+				"empty":        {Value: false},
+				"files":        {Value: false},
+				"numbering":    {Value: false},
+				"portability":  {Value: false},
+				"profile":      {Value: "windows"},
+				"suppressions": {Value: ""},
+				"framePolicy":  {Value: ""},
+				"snapshot":     {Value: false},
+				"sinceLast":    {Value: false},
 			},
-			want:  &scanSettings{},
+			want:  &scanSettings{profile: windowsProfile},
 			want1: true,
 		},
 		"overridden": {
 			values: map[string]*cmdtoolkit.CommandFlag[any]{
-				"empty":     {Value: true, UserSet: true},
-				"files":     {Value: true, UserSet: true},
-				"numbering": {Value: true, UserSet: true},
+				"duplicates":   {Value: true, UserSet: true},
+				"empty":        {Value: true, UserSet: true},
+				"files":        {Value: true, UserSet: true},
+				"numbering":    {Value: true, UserSet: true},
+				"portability":  {Value: true, UserSet: true},
+				"profile":      {Value: "FAT32", UserSet: true},
+				"suppressions": {Value: ""},
+				"framePolicy":  {Value: ""},
+				"snapshot":     {Value: true, UserSet: true},
+				"sinceLast":    {Value: true, UserSet: true},
 			},
 			want: &scanSettings{
-				empty:     cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true},
-				files:     cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true},
-				numbering: cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true},
+				duplicates:  cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true},
+				empty:       cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true},
+				files:       cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true},
+				numbering:   cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true},
+				portability: cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true},
+				profile:     fat32Profile,
+				snapshot:    cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true},
+				sinceLast:   cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true},
 			},
 			want1: true,
 		},
+		"bad profile": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				"duplicates":   {Value: false},
+				"empty":        {Value: false},
+				"files":        {Value: false},
+				"numbering":    {Value: false},
+				"portability":  {Value: true, UserSet: true},
+				"profile":      {Value: "amiga", UserSet: true},
+				"suppressions": {Value: ""},
+				"framePolicy":  {Value: ""},
+				"snapshot":     {Value: false},
+				"sinceLast":    {Value: false},
+			},
+			want: &scanSettings{
+				portability: cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true},
+			},
+			want1: false,
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"The --profile value \"amiga\" cannot be used.\n" +
+					"Why?\n" +
+					"The value is not a known file system profile.\n" +
+					"What to do:\n" +
+					"Use one of these values: exfat, fat32, linux, macos, posix, windows.\n",
+				Log: "" +
+					"level='error'" +
+					" --profile='amiga'" +
+					" user-set='true'" +
+					" msg='invalid profile'\n",
+			},
+		},
 	}
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -99,7 +192,7 @@ func Test_scanSettings_hasWorkToDo(t *testing.T) {
 				Error: "" +
 					"No scans will be performed.\n" +
 					"Why?\n" +
-					"The flags --empty, --files, and --numbering are all configured false.\n" +
+					"The flags --duplicates, --empty, --files, --numbering, and --portability are all configured false.\n" +
 					"What to do:\n" +
 					"Either:\n" +
 					" 1. Edit the configuration file so that at least one of these flags is true, or\n" +
@@ -113,7 +206,8 @@ func Test_scanSettings_hasWorkToDo(t *testing.T) {
 				Error: "" +
 					"No scans will be performed.\n" +
 					"Why?\n" +
-					"In addition to --files and --numbering configured false, you explicitly set --empty false.\n" +
+					"In addition to --duplicates, --files, --numbering, and --portability configured false, " +
+					"you explicitly set --empty false.\n" +
 					"What to do:\n" +
 					"Either:\n" +
 					" 1. Edit the configuration file so that at least one of these flags is true, or\n" +
@@ -127,7 +221,8 @@ func Test_scanSettings_hasWorkToDo(t *testing.T) {
 				Error: "" +
 					"No scans will be performed.\n" +
 					"Why?\n" +
-					"In addition to --empty and --numbering configured false, you explicitly set --files false.\n" +
+					"In addition to --duplicates, --empty, --numbering, and --portability configured false, " +
+					"you explicitly set --files false.\n" +
 					"What to do:\n" +
 					"Either:\n" +
 					" 1. Edit the configuration file so that at least one of these flags is true, or\n" +
@@ -141,7 +236,8 @@ func Test_scanSettings_hasWorkToDo(t *testing.T) {
 				Error: "" +
 					"No scans will be performed.\n" +
 					"Why?\n" +
-					"In addition to --empty and --files configured false, you explicitly set --numbering false.\n" +
+					"In addition to --duplicates, --empty, --files, and --portability configured false, " +
+					"you explicitly set --numbering false.\n" +
 					"What to do:\n" +
 					"Either:\n" +
 					" 1. Edit the configuration file so that at least one of these flags is true, or\n" +
@@ -158,7 +254,8 @@ func Test_scanSettings_hasWorkToDo(t *testing.T) {
 				Error: "" +
 					"No scans will be performed.\n" +
 					"Why?\n" +
-					"In addition to --numbering configured false, you explicitly set --empty and --files false.\n" +
+					"In addition to --duplicates, --numbering, and --portability configured false, " +
+					"you explicitly set --empty and --files false.\n" +
 					"What to do:\n" +
 					"Either:\n" +
 					" 1. Edit the configuration file so that at least one of these flags is true, or\n" +
@@ -175,7 +272,8 @@ func Test_scanSettings_hasWorkToDo(t *testing.T) {
 				Error: "" +
 					"No scans will be performed.\n" +
 					"Why?\n" +
-					"In addition to --files configured false, you explicitly set --empty and --numbering false.\n" +
+					"In addition to --duplicates, --files, and --portability configured false, " +
+					"you explicitly set --empty and --numbering false.\n" +
 					"What to do:\n" +
 					"Either:\n" +
 					" 1. Edit the configuration file so that at least one of these flags is true, or\n" +
@@ -192,7 +290,8 @@ func Test_scanSettings_hasWorkToDo(t *testing.T) {
 				Error: "" +
 					"No scans will be performed.\n" +
 					"Why?\n" +
-					"In addition to --empty configured false, you explicitly set --files and --numbering false.\n" +
+					"In addition to --duplicates, --empty, and --portability configured false, " +
+					"you explicitly set --files and --numbering false.\n" +
 					"What to do:\n" +
 					"Either:\n" +
 					" 1. Edit the configuration file so that at least one of these flags is true, or\n" +
@@ -210,13 +309,42 @@ func Test_scanSettings_hasWorkToDo(t *testing.T) {
 				Error: "" +
 					"No scans will be performed.\n" +
 					"Why?\n" +
-					"You explicitly set --empty, --files, and --numbering false.\n" +
+					"In addition to --duplicates and --portability configured false, " +
+					"you explicitly set --empty, --files, and --numbering false.\n" +
 					"What to do:\n" +
 					"Either:\n" +
 					" 1. Edit the configuration file so that at least one of these flags is true, or\n" +
 					" 2. Explicitly set at least one of these flags true on the command line.\n",
 			},
 		},
+		"no work, all five flags configured that way": {
+			scanSet: &scanSettings{
+				duplicates:  cmdtoolkit.CommandFlag[bool]{UserSet: true},
+				numbering:   cmdtoolkit.CommandFlag[bool]{UserSet: true},
+				files:       cmdtoolkit.CommandFlag[bool]{UserSet: true},
+				empty:       cmdtoolkit.CommandFlag[bool]{UserSet: true},
+				portability: cmdtoolkit.CommandFlag[bool]{UserSet: true},
+			},
+			want: false,
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"No scans will be performed.\n" +
+					"Why?\n" +
+					"You explicitly set --duplicates, --empty, --files, --numbering, and --portability false.\n" +
+					"What to do:\n" +
+					"Either:\n" +
+					" 1. Edit the configuration file so that at least one of these flags is true, or\n" +
+					" 2. Explicitly set at least one of these flags true on the command line.\n",
+			},
+		},
+		"scan portability": {
+			scanSet: &scanSettings{portability: cmdtoolkit.CommandFlag[bool]{Value: true}},
+			want:    true,
+		},
+		"scan duplicates": {
+			scanSet: &scanSettings{duplicates: cmdtoolkit.CommandFlag[bool]{Value: true}},
+			want:    true,
+		},
 		"scan empty": {
 			scanSet: &scanSettings{empty: cmdtoolkit.CommandFlag[bool]{Value: true}},
 			want:    true,
@@ -315,6 +443,97 @@ func Test_scanSettings_performEmptyAnalysis(t *testing.T) {
 	}
 }
 
+func Test_scanSettings_performPortabilityAnalysis(t *testing.T) {
+	portableArtist := func(artistName string, albumNames []string, trackNames ...string) *files.Artist {
+		artist := files.NewArtist(artistName, filepath.Join("Music", artistName))
+		for _, albumName := range albumNames {
+			album := files.AlbumMaker{
+				Title:     albumName,
+				Artist:    artist,
+				Directory: filepath.Join("Music", artistName, albumName),
+			}.NewAlbum(true)
+			for k, trackName := range trackNames {
+				files.TrackMaker{
+					Album:      album,
+					FileName:   trackName,
+					SimpleName: strings.TrimSuffix(trackName, ".mp3"),
+					Number:     k + 1,
+				}.NewTrack(true)
+			}
+		}
+		return artist
+	}
+	tests := map[string]struct {
+		scanSet        *scanSettings
+		scannedArtists []*concernedArtist
+		want           bool
+		output.WantedRecording
+	}{
+		"do nothing": {
+			scanSet: &scanSettings{portability: cmdtoolkit.CommandFlag[bool]{Value: false}},
+			scannedArtists: createConcernedArtists([]*files.Artist{
+				portableArtist("CON", []string{"album"}, "1 track.mp3"),
+			}),
+		},
+		"full slice, no problems": {
+			scanSet: &scanSettings{
+				portability: cmdtoolkit.CommandFlag[bool]{Value: true},
+				profile:     windowsProfile,
+			},
+			scannedArtists: createConcernedArtists(generateArtists(5, 6, 7, nil)),
+		},
+		"problems": {
+			scanSet: &scanSettings{
+				portability: cmdtoolkit.CommandFlag[bool]{Value: true},
+				profile:     fat32Profile,
+			},
+			scannedArtists: createConcernedArtists([]*files.Artist{
+				portableArtist("con", []string{"Abbey Road", "abbey road"}, "1 Come Together.mp3"),
+				portableArtist("Beyonce\u0301", nil),
+				portableArtist("Beyonc\u00e9", []string{"album."}, "1 a track.mp3", "2 what?.mp3",
+					strings.Repeat("x", files.MaxPortablePathLength)+".mp3"),
+			}),
+			want: true,
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"Artist \"con\"\n" +
+					"* [portability] \"con\" is a reserved name on Windows\n" +
+					"  Album \"Abbey Road\"\n" +
+					"  * [portability] \"Abbey Road\" differs only in letter case from \"abbey road\"\n" +
+					"  Album \"abbey road\"\n" +
+					"  * [portability] \"abbey road\" differs only in letter case from \"Abbey Road\"\n" +
+					"Artist \"Beyonce\u0301\"\n" +
+					"* [portability] \"Beyonce\u0301\" differs only in Unicode normalization (NFC vs NFD) from " +
+					"\"Beyonc\u00e9\"\n" +
+					"Artist \"Beyonc\u00e9\"\n" +
+					"* [portability] \"Beyonc\u00e9\" differs only in Unicode normalization (NFC vs NFD) from " +
+					"\"Beyonce\u0301\"\n" +
+					"  Album \"album.\"\n" +
+					"  * [portability] \"album.\" ends with a period\n" +
+					"    Track \"2 what?\"\n" +
+					"    * [portability] \"2 what?.mp3\" contains characters that cannot be used on fat32: '?'\n" +
+					"    Track \"" + strings.Repeat("x", files.MaxPortablePathLength) + "\"\n" +
+					"    * [portability] path is " +
+					strconv.Itoa(files.PathLength(filepath.Join("Music", "Beyonc\u00e9", "album.",
+						strings.Repeat("x", files.MaxPortablePathLength)+".mp3"))) +
+					" characters long; Windows limits paths to 260 characters\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.scanSet.performPortabilityAnalysis(tt.scannedArtists); got != tt.want {
+				t.Errorf("scanSettings.performPortabilityAnalysis() = %v, want %v", got, tt.want)
+			}
+			o := output.NewRecorder()
+			for _, artist := range tt.scannedArtists {
+				artist.toConsole(o)
+			}
+			o.Report(t, "scanSettings.performPortabilityAnalysis()", tt.WantedRecording)
+		})
+	}
+}
+
 func Test_numberGap_generateMissingTrackNumbers(t *testing.T) {
 	tests := map[string]struct {
 		gap  numberGap
@@ -512,7 +731,7 @@ func Test_scanSettings_performFileAnalysis(t *testing.T) {
 	defer func() {
 		readMetadata = originalReadMetadata
 	}()
-	readMetadata = func(_ output.Bus, _ []*files.Artist, _ int) {}
+	readMetadata = func(_ context.Context, _ output.Bus, _ []*files.Artist, _ int) {}
 	type args struct {
 		scannedArtists []*concernedArtist
 		ss             *searchSettings
@@ -558,7 +777,7 @@ func Test_scanSettings_performFileAnalysis(t *testing.T) {
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			o := output.NewRecorder()
-			got := tt.scanSet.performFileAnalysis(o, tt.args.scannedArtists, tt.args.ss, tt.args.ios)
+			got := tt.scanSet.performFileAnalysis(context.Background(), o, tt.args.scannedArtists, tt.args.ss, tt.args.ios)
 			if got != tt.want {
 				t.Errorf("scanSettings.performFileAnalysis() = %v, want %v", got, tt.want)
 			}
@@ -624,12 +843,15 @@ func Test_scanSettings_performScans(t *testing.T) {
 	defer func() {
 		readMetadata = originalReadMetadata
 	}()
-	readMetadata = func(_ output.Bus, _ []*files.Artist, _ int) {}
+	readMetadata = func(_ context.Context, _ output.Bus, _ []*files.Artist, _ int) {}
 	type args struct {
+		ctx     context.Context
 		artists []*files.Artist
 		ss      *searchSettings
 		ios     *ioSettings
 	}
+	interrupted, cancel := context.WithCancel(context.Background())
+	cancel()
 	tests := map[string]struct {
 		scanSet *scanSettings
 		args
@@ -667,11 +889,45 @@ func Test_scanSettings_performScans(t *testing.T) {
 					"Numbering Analysis: no missing or duplicate tracks found.\n",
 			},
 		},
+		"interrupted scan": {
+			scanSet: &scanSettings{
+				empty:      cmdtoolkit.CommandFlag[bool]{Value: true},
+				numbering:  cmdtoolkit.CommandFlag[bool]{Value: true},
+				files:      cmdtoolkit.CommandFlag[bool]{Value: true},
+				duplicates: cmdtoolkit.CommandFlag[bool]{Value: true},
+				snapshot:   cmdtoolkit.CommandFlag[bool]{Value: true},
+			},
+			args: args{
+				ctx:     interrupted,
+				artists: generateArtists(1, 2, 3, nil),
+				ss: &searchSettings{
+					artistFilter: regexp.MustCompile(".*"),
+					albumFilter:  regexp.MustCompile(".*"),
+					trackFilter:  regexp.MustCompile(".*"),
+				},
+				ios: &ioSettings{openFileLimit: 100},
+			},
+			wantStatus: nil,
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"The scan was interrupted; these results are partial. The file analysis covers only the" +
+					" albums whose metadata was completely read, and no snapshot was recorded.\n" +
+					"Empty Folder Analysis: no empty folders found.\n" +
+					"Numbering Analysis: no missing or duplicate tracks found.\n" +
+					"File Analysis: no inconsistencies found.\n" +
+					"Duplicate Analysis: interrupted; no duplicates can be reported.\n",
+				Log: "level='info' command='scan' msg='scan interrupted'\n",
+			},
+		},
 	}
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			o := output.NewRecorder()
-			got := tt.scanSet.performScans(o, tt.args.artists, tt.args.ss, tt.args.ios)
+			ctx := tt.args.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			got := tt.scanSet.performScans(ctx, o, tt.args.artists, tt.args.ss, tt.args.ios)
 			if !compareExitErrors(got, tt.wantStatus) {
 				t.Errorf("scanSettings.performScans() got %s want %s", got, tt.wantStatus)
 			}
@@ -697,7 +953,7 @@ func Test_scanSettings_maybeDoWork(t *testing.T) {
 				Error: "" +
 					"No scans will be performed.\n" +
 					"Why?\n" +
-					"The flags --empty, --files, and --numbering are all configured false.\n" +
+					"The flags --duplicates, --empty, --files, --numbering, and --portability are all configured false.\n" +
 					"What to do:\n" +
 					"Either:\n" +
 					" 1. Edit the configuration file so that at least one of these flags is true, or\n" +
@@ -738,7 +994,7 @@ func Test_scanSettings_maybeDoWork(t *testing.T) {
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			o := output.NewRecorder()
-			if got := tt.scanSet.maybeDoWork(o, tt.ss, tt.ios); !compareExitErrors(got, tt.wantStatus) {
+			if got := tt.scanSet.maybeDoWork(context.Background(), o, tt.ss, tt.ios); !compareExitErrors(got, tt.wantStatus) {
 				t.Errorf("scanSettings.maybeDoWork() got %s want %s", got, tt.wantStatus)
 			}
 			o.Report(t, "scanSettings.maybeDoWork()", tt.WantedRecording)
@@ -761,6 +1017,12 @@ func Test_scanRun(t *testing.T) {
 	scanFlags := &cmdtoolkit.FlagSet{
 		Name: scanCommand,
 		Details: map[string]*cmdtoolkit.FlagDetails{
+			scanDuplicates: {
+				AbbreviatedName: scanDuplicatesAbbr,
+				Usage:           "report duplicate tracks and albums",
+				ExpectedType:    cmdtoolkit.BoolType,
+				DefaultValue:    false,
+			},
 			scanEmpty: {
 				AbbreviatedName: scanEmptyAbbr,
 				Usage:           "report empty album and artist directories",
@@ -779,11 +1041,42 @@ func Test_scanRun(t *testing.T) {
 				ExpectedType:    cmdtoolkit.BoolType,
 				DefaultValue:    false,
 			},
+			scanPortability: {
+				AbbreviatedName: scanPortabilityAbbr,
+				Usage:           "report file and directory names that may not be usable on other file systems",
+				ExpectedType:    cmdtoolkit.BoolType,
+				DefaultValue:    false,
+			},
+			scanProfile: {
+				Usage:        "target file system for --portability",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "windows",
+			},
+			suppressionsFile: {
+				Usage:        suppressionsUsage,
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			framePolicyFile: {
+				Usage:        framePolicyUsage,
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			scanSnapshot: {
+				Usage:        "save the results to a snapshot",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+			scanSinceLast: {
+				Usage:        "report changes since the most recent snapshot",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
 		},
 	}
 	command := &cobra.Command{}
 	cmdtoolkit.AddFlags(output.NewNilBus(), cmdtoolkit.EmptyConfiguration(), command.Flags(),
-		scanFlags, searchFlags, ioFlags)
+		scanFlags, searchFlags, ioFlags, namesFlags, id3v2Flags)
 	type args struct {
 		cmd *cobra.Command
 		in1 []string
@@ -798,7 +1091,7 @@ func Test_scanRun(t *testing.T) {
 				Error: "" +
 					"No scans will be performed.\n" +
 					"Why?\n" +
-					"The flags --empty, --files, and --numbering are all configured false.\n" +
+					"The flags --duplicates, --empty, --files, --numbering, and --portability are all configured false.\n" +
 					"What to do:\n" +
 					"Either:\n" +
 					" 1. Edit the configuration file so that at least one of these flags is true, or\n" +
@@ -840,7 +1133,7 @@ func Test_scan_Help(t *testing.T) {
 	xdg.UserDirs.Music = "."
 	commandUnderTest := cloneCommand(scanCmd)
 	cmdtoolkit.AddFlags(output.NewNilBus(), cmdtoolkit.EmptyConfiguration(),
-		commandUnderTest.Flags(), scanFlags, searchFlags, ioFlags)
+		commandUnderTest.Flags(), scanFlags, searchFlags, ioFlags, namesFlags, id3v2Flags)
 	tests := map[string]struct {
 		output.WantedRecording
 	}{
@@ -851,8 +1144,11 @@ func Test_scan_Help(t *testing.T) {
 					"reports any problems detected\n" +
 					"\n" +
 					"Usage:\n" +
-					"  scan [--empty] [--files] [--numbering] [--albumFilter regex] [--artistFilter regex] " +
-					"[--trackFilter regex] [--extensions extensions] [--maxOpenFiles count]\n" +
+					"  scan [--duplicates] [--empty] [--files] [--numbering] [--portability] [--profile profile] [--suppressions file] " +
+					"[--framePolicy file] [--snapshot] [--sinceLast] [--albumFilter regex] [--artistFilter regex] " +
+					"[--trackFilter regex] [--extensions extensions] [--maxOpenFiles count] [--aliases aliases] " +
+					"[--ampersand] [--foldCase] [--invertArticles] [--normalizeUnicode] [--id3v2Version version] " +
+					"[--id3v2Encoding encoding]\n" +
 					"\n" +
 					"Examples:\n" +
 					"scan --empty\n" +
@@ -861,21 +1157,60 @@ func Test_scan_Help(t *testing.T) {
 					"  reads each mp3 file's metadata and reports any inconsistencies found\n" +
 					"scan --numbering\n" +
 					"  reports errors in the track numbers of mp3 files\n" +
+					"scan --duplicates\n" +
+					"  reports identical tracks, albums ripped from the same CD, and tracks that are likely the same\n" +
+					"  recording, suggesting which copy to keep\n" +
+					"scan --portability --profile fat32\n" +
+					"  reports file and directory names that cannot be copied to a FAT32 device\n" +
+					"scan --files --suppressions suppressions.yaml\n" +
+					"  reports metadata/file inconsistencies, except for those listed in suppressions.yaml\n" +
+					"scan --files --framePolicy frames.yaml\n" +
+					"  reports metadata/file inconsistencies, and ID3V2 frames that violate the policies in frames.yaml\n" +
+					"scan --files --snapshot --sinceLast\n" +
+					"  reports only the metadata/file inconsistencies that are new, resolved, or changed since the\n" +
+					"  previous snapshot, and saves a new snapshot\n" +
 					"\n" +
 					"Flags:\n" +
-					"      --albumFilter string    regular expression specifying which albums to " +
+					"      --albumFilter string     regular expression specifying which albums to " +
 					"select (default \".*\")\n" +
-					"      --artistFilter string   regular expression specifying which " +
+					"      --aliases string         semicolon-delimited list of alias=preferred name pairs for artist " +
+					"and album names (default \"\")\n" +
+					"      --ampersand              treat '&' and 'and' as equal in artist and album names (default " +
+					"false)\n" +
+					"      --artistFilter string    regular expression specifying which " +
 					"artists to select (default \".*\")\n" +
-					"  -e, --empty                 report empty album and artist directories (default false)\n" +
-					"      --extensions string     comma-delimited list of file " +
+					"  -d, --duplicates             report duplicate tracks and albums (default false)\n" +
+					"  -e, --empty                  report empty album and artist directories (default false)\n" +
+					"      --extensions string      comma-delimited list of file " +
 					"extensions used by mp3 files (default \".mp3\")\n" +
-					"  -f, --files                 report metadata/file inconsistencies (default false)\n" +
-					"      --maxOpenFiles int      the maximum number of files that can be read simultaneously " +
+					"  -f, --files                  report metadata/file inconsistencies (default false)\n" +
+					"      --foldCase               treat artist and album names differing only in letter case as equal " +
+					"(default false)\n" +
+					"      --framePolicy string     the path of a YAML file listing the ID3V2 frames that tags may or " +
+					"must contain; if empty, no frame policy is applied (default \"\")\n" +
+					"      --id3v2Encoding string   text encoding of rewritten ID3V2 tags: keep (each frame's own " +
+					"encoding), iso-8859-1, utf-16, or utf-8 (2.4 only) (default \"keep\")\n" +
+					"      --id3v2Version string    ID3V2 version of rewritten tags: keep (each tag's own version), 2.3, " +
+					"or 2.4 (default \"keep\")\n" +
+					"      --invertArticles         treat artist and album names such as 'Beatles, The' and 'The " +
+					"Beatles' as equal (default false)\n" +
+					"      --maxOpenFiles int       the maximum number of files that can be read simultaneously " +
 					"(at least 1, at most 32767, default 1000) (default 1000)\n" +
-					"  -n, --numbering             report missing track " +
+					"      --normalizeUnicode       treat the NFC and NFD forms of artist and album names as equal " +
+					"(default false)\n" +
+					"  -n, --numbering              report missing track " +
 					"numbers and duplicated track numbering (default false)\n" +
-					"      --trackFilter string    regular expression " +
+					"  -p, --portability            report file and directory names that may not be usable on other file " +
+					"systems (default false)\n" +
+					"      --profile string         target file system for --portability: one of exfat, fat32, linux, " +
+					"macos, posix, windows (default \"windows\")\n" +
+					"      --sinceLast              report only the concerns that are new, resolved, or changed since " +
+					"the most recent snapshot (default false)\n" +
+					"      --snapshot               save the results to a timestamped snapshot in the application data " +
+					"directory (default false)\n" +
+					"      --suppressions string    the path of a YAML file listing concerns that are known and " +
+					"accepted; if empty, no concerns are suppressed (default \"\")\n" +
+					"      --trackFilter string     regular expression " +
 					"specifying which tracks to select (default \".*\")\n",
 			},
 		},
@@ -902,7 +1237,7 @@ func Test_scan_Usage(t *testing.T) {
 	xdg.UserDirs.Music = "."
 	commandUnderTest := cloneCommand(scanCmd)
 	cmdtoolkit.AddFlags(output.NewNilBus(), cmdtoolkit.EmptyConfiguration(),
-		commandUnderTest.Flags(), scanFlags, searchFlags, ioFlags)
+		commandUnderTest.Flags(), scanFlags, searchFlags, ioFlags, namesFlags, id3v2Flags)
 	tests := map[string]struct {
 		output.WantedRecording
 	}{
@@ -910,8 +1245,11 @@ func Test_scan_Usage(t *testing.T) {
 			WantedRecording: output.WantedRecording{
 				Console: "" +
 					"Usage:\n" +
-					"  scan [--empty] [--files] [--numbering] [--albumFilter regex] [--artistFilter regex] " +
-					"[--trackFilter regex] [--extensions extensions] [--maxOpenFiles count]\n" +
+					"  scan [--duplicates] [--empty] [--files] [--numbering] [--portability] [--profile profile] [--suppressions file] " +
+					"[--framePolicy file] [--snapshot] [--sinceLast] [--albumFilter regex] [--artistFilter regex] " +
+					"[--trackFilter regex] [--extensions extensions] [--maxOpenFiles count] [--aliases aliases] " +
+					"[--ampersand] [--foldCase] [--invertArticles] [--normalizeUnicode] [--id3v2Version version] " +
+					"[--id3v2Encoding encoding]\n" +
 					"\n" +
 					"Examples:\n" +
 					"scan --empty\n" +
@@ -921,23 +1259,62 @@ func Test_scan_Usage(t *testing.T) {
 					" found\n" +
 					"scan --numbering\n" +
 					"  reports errors in the track numbers of mp3 files\n" +
+					"scan --duplicates\n" +
+					"  reports identical tracks, albums ripped from the same CD, and tracks that are likely the same\n" +
+					"  recording, suggesting which copy to keep\n" +
+					"scan --portability --profile fat32\n" +
+					"  reports file and directory names that cannot be copied to a FAT32 device\n" +
+					"scan --files --suppressions suppressions.yaml\n" +
+					"  reports metadata/file inconsistencies, except for those listed in suppressions.yaml\n" +
+					"scan --files --framePolicy frames.yaml\n" +
+					"  reports metadata/file inconsistencies, and ID3V2 frames that violate the policies in frames.yaml\n" +
+					"scan --files --snapshot --sinceLast\n" +
+					"  reports only the metadata/file inconsistencies that are new, resolved, or changed since the\n" +
+					"  previous snapshot, and saves a new snapshot\n" +
 					"\n" +
 					"Flags:\n" +
-					"      --albumFilter string    " +
+					"      --albumFilter string     " +
 					"regular expression specifying which albums to select (default \".*\")\n" +
-					"      --artistFilter string   " +
+					"      --aliases string         semicolon-delimited list of alias=preferred name pairs for artist " +
+					"and album names (default \"\")\n" +
+					"      --ampersand              treat '&' and 'and' as equal in artist and album names (default " +
+					"false)\n" +
+					"      --artistFilter string    " +
 					"regular expression specifying which artists to select (default \".*\")\n" +
-					"  -e, --empty                 " +
+					"  -d, --duplicates             report duplicate tracks and albums (default false)\n" +
+					"  -e, --empty                  " +
 					"report empty album and artist directories (default false)\n" +
-					"      --extensions string     " +
+					"      --extensions string      " +
 					"comma-delimited list of file extensions used by mp3 files (default \".mp3\")\n" +
-					"  -f, --files                 " +
+					"  -f, --files                  " +
 					"report metadata/file inconsistencies (default false)\n" +
-					"      --maxOpenFiles int      the maximum number of files that can be read simultaneously " +
+					"      --foldCase               treat artist and album names differing only in letter case as equal " +
+					"(default false)\n" +
+					"      --framePolicy string     the path of a YAML file listing the ID3V2 frames that tags may or " +
+					"must contain; if empty, no frame policy is applied (default \"\")\n" +
+					"      --id3v2Encoding string   text encoding of rewritten ID3V2 tags: keep (each frame's own " +
+					"encoding), iso-8859-1, utf-16, or utf-8 (2.4 only) (default \"keep\")\n" +
+					"      --id3v2Version string    ID3V2 version of rewritten tags: keep (each tag's own version), 2.3, " +
+					"or 2.4 (default \"keep\")\n" +
+					"      --invertArticles         treat artist and album names such as 'Beatles, The' and 'The " +
+					"Beatles' as equal (default false)\n" +
+					"      --maxOpenFiles int       the maximum number of files that can be read simultaneously " +
 					"(at least 1, at most 32767, default 1000) (default 1000)\n" +
-					"  -n, --numbering             " +
+					"      --normalizeUnicode       treat the NFC and NFD forms of artist and album names as equal " +
+					"(default false)\n" +
+					"  -n, --numbering              " +
 					"report missing track numbers and duplicated track numbering (default false)\n" +
-					"      --trackFilter string    " +
+					"  -p, --portability            report file and directory names that may not be usable on other file " +
+					"systems (default false)\n" +
+					"      --profile string         target file system for --portability: one of exfat, fat32, linux, " +
+					"macos, posix, windows (default \"windows\")\n" +
+					"      --sinceLast              report only the concerns that are new, resolved, or changed since " +
+					"the most recent snapshot (default false)\n" +
+					"      --snapshot               save the results to a timestamped snapshot in the application data " +
+					"directory (default false)\n" +
+					"      --suppressions string    the path of a YAML file listing concerns that are known and " +
+					"accepted; if empty, no concerns are suppressed (default \"\")\n" +
+					"      --trackFilter string     " +
 					"regular expression specifying which tracks to select (default \".*\")\n",
 			},
 		},
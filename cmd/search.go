@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"io/fs"
 	"mp3repair/internal/files"
 	"path/filepath"
@@ -335,11 +336,18 @@ func (ss *searchSettings) filter(o output.Bus, originalArtists []*files.Artist)
 	return filteredArtists
 }
 
-func (ss *searchSettings) load(o output.Bus) []*files.Artist {
+// load reads the artists, albums, and tracks in the music directory; if the
+// context is cancelled, no further artist directories are read, and no artists
+// are returned
+func (ss *searchSettings) load(ctx context.Context, o output.Bus) []*files.Artist {
 	artistFiles, dirRead := readDirectory(o, ss.musicDir)
 	artists := make([]*files.Artist, 0, len(artistFiles))
 	if dirRead {
 		for _, artistFile := range artistFiles {
+			if ctx.Err() != nil {
+				o.ErrorPrintln("Loading the music library was interrupted.")
+				return nil
+			}
 			if artistFile.IsDir() {
 				artist := files.NewArtistFromFile(artistFile, ss.musicDir)
 				ss.addAlbums(o, artist)
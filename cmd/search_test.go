@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"mp3repair/internal/files"
@@ -656,12 +657,16 @@ func Test_searchSettings_load(t *testing.T) {
 		}
 		return []fs.FileInfo{}, false
 	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
 	tests := map[string]struct {
+		ctx  context.Context
 		ss   *searchSettings
 		want []*files.Artist
 		output.WantedRecording
 	}{
 		"musicDir read error": {
+			ctx:  context.Background(),
 			ss:   &searchSettings{musicDir: "td"},
 			want: []*files.Artist{},
 			WantedRecording: output.WantedRecording{
@@ -676,17 +681,29 @@ func Test_searchSettings_load(t *testing.T) {
 			},
 		},
 		"good read": {
+			ctx: context.Background(),
 			ss: &searchSettings{
 				fileExtensions: []string{".mp3"},
 				musicDir:       "music",
 			},
 			want: []*files.Artist{testArtist},
 		},
+		"interrupted": {
+			ctx: cancelled,
+			ss: &searchSettings{
+				fileExtensions: []string{".mp3"},
+				musicDir:       "music",
+			},
+			want: nil,
+			WantedRecording: output.WantedRecording{
+				Error: "Loading the music library was interrupted.\n",
+			},
+		},
 	}
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			o := output.NewRecorder()
-			got := tt.ss.load(o)
+			got := tt.ss.load(tt.ctx, o)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("searchSettings.load() got = %v, want %v", got, tt.want)
 			}
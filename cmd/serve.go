@@ -0,0 +1,726 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mp3repair/internal/files"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+
+	"github.com/majohn-r/output"
+	"github.com/spf13/cobra"
+)
+
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+const (
+	serveCommandName = "serve"
+	serveAddress     = "address"
+	serveAddressFlag = "--" + serveAddress
+	serveAllowRemote = "allowRemote"
+	serveRemoteFlag  = "--" + serveAllowRemote
+	serveToken       = "token"
+	serveTokenFlag   = "--" + serveToken
+	jobRunning       = "running"
+	jobSucceeded     = "succeeded"
+	jobFailed        = "failed"
+	scanJob          = "scan"
+	rewriteJob       = "rewrite"
+	maxRequestBody   = 1 << 20
+	// maxFinishedJobs is how many finished jobs are kept; beyond that, the job
+	// that finished first is forgotten
+	maxFinishedJobs = 100
+)
+
+var (
+	errServerInterrupted = errors.New("the server was interrupted")
+	serveCmd             = &cobra.Command{
+		Use: serveCommandName + " [" + serveAddressFlag + " host:port] [" + serveRemoteFlag + "] [" +
+			serveTokenFlag + " token] [" + suppressionsFileFlag + " file] [" + framePolicyFileFlag + " file] " +
+			searchUsage + " " + ioUsage + " " + namesUsage + " " + id3v2Usage,
+		DisableFlagsInUseLine: true,
+		Short:                 "Serves the music library over a local HTTP API",
+		Long: "" +
+			fmt.Sprintf("%q starts an HTTP server that exposes the music library as JSON\n", serveCommandName) +
+			"\n" +
+			"The server provides these endpoints:\n" +
+			"\n" +
+			"GET  /api/library                          the artists, albums, and tracks\n" +
+			"GET  /api/diagnostics?artist=&album=&track= the ID3V1 and ID3V2 metadata of a track,\n" +
+			"                                           identified by its file name\n" +
+			"POST /api/scans                            start a scan; the optional JSON body selects\n" +
+			"                                           the scans, e.g. {\"empty\": true, \"files\": true,\n" +
+			"                                           \"numbering\": true, \"portability\": false,\n" +
+			"                                           \"profile\": \"windows\"}\n" +
+			"POST /api/rewrites                         back up and rewrite the selected albums; the\n" +
+			"                                           JSON body lists them, e.g. {\"albums\":\n" +
+			"                                           [{\"artist\": \"The Beatles\", \"album\": \"Abbey Road\"}]}\n" +
+			"GET  /api/jobs/{id}                        the status, and eventually the result, of a scan\n" +
+			"                                           or rewrite\n" +
+			"\n" +
+			"Scans and rewrites run in the background, one at a time; their responses identify\n" +
+			fmt.Sprintf("the job to poll. The %d most recently finished jobs are kept.\n", maxFinishedJobs) +
+			"\n" +
+			fmt.Sprintf("Rewrites are only available if %s is set, and each rewrite request must\n", serveTokenFlag) +
+			"include the header \"Authorization: Bearer <token>\". As requests are not encrypted,\n" +
+			fmt.Sprintf("the server only listens on a loopback address unless %s is set.\n", serveRemoteFlag) +
+			"\n" +
+			"Scans and rewrites use the suppressions, frame policy, name equivalence rules, and\n" +
+			"ID3V2 settings given to the server.",
+		Example: serveCommandName + "\n" +
+			"  Serve the library at http://127.0.0.1:8080/, without the rewrite endpoint\n" +
+			serveCommandName + " " + serveAddressFlag + " localhost:9000 " + serveTokenFlag + " s3cret\n" +
+			"  Serve the library at http://localhost:9000/, allowing rewrites by clients that\n" +
+			"  present the token s3cret",
+		RunE: serveRun,
+	}
+	serveFlags = &cmdtoolkit.FlagSet{
+		Name: serveCommandName,
+		Details: map[string]*cmdtoolkit.FlagDetails{
+			serveAddress: {
+				Usage:        "the host and port on which the server listens",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "127.0.0.1:8080",
+			},
+			serveAllowRemote: {
+				Usage: "allow listening on an address other than a loopback address; requests, including the " +
+					"bearer token, are not encrypted",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+			serveToken: {
+				Usage:        "the bearer token required by the rewrite endpoint; if empty, rewrites are disabled",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			suppressionsFile: {
+				Usage:        suppressionsUsage,
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			framePolicyFile: {
+				Usage:        framePolicyUsage,
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+		},
+	}
+)
+
+func serveRun(cmd *cobra.Command, _ []string) error {
+	exitError := cmdtoolkit.NewExitProgrammingError(serveCommandName)
+	o := getBus()
+	ctx := commandContext(cmd)
+	runsUntilInterrupted(ctx)
+	producer := cmd.Flags()
+	values, eSlice := cmdtoolkit.ReadFlags(producer, serveFlags)
+	ss, searchFlagsOk := evaluateSearchFlags(o, producer)
+	ios, ioFlagsOk := evaluateIOFlags(o, producer)
+	ns, namesFlagsOk := evaluateNamesFlags(o, producer)
+	is, id3v2FlagsOk := evaluateID3V2Flags(o, producer)
+	if cmdtoolkit.ProcessFlagErrors(o, eSlice) && searchFlagsOk && ioFlagsOk && namesFlagsOk && id3v2FlagsOk {
+		exitError = cmdtoolkit.NewExitUserError(serveCommandName)
+		is.apply()
+		if srv, flagsOk := processServeFlags(o, values); flagsOk {
+			srv.ctx = ctx
+			srv.ss = ss
+			srv.ios = ios
+			srv.names = ns.equivalence
+			exitError = srv.serve(o)
+		}
+	}
+	return cmdtoolkit.ToErrorInterface(exitError)
+}
+
+// server holds the state shared by the HTTP handlers
+type server struct {
+	// ctx is cancelled when the server is interrupted; the server then stops,
+	// and its jobs start no further work
+	ctx     context.Context
+	address string
+	token   string
+	ss      *searchSettings
+	ios     *ioSettings
+	jobs    *jobStore
+	// the settings that scans and rewrites share with the scan and rewrite
+	// commands
+	suppressions *suppressions
+	framePolicy  *framePolicies
+	names        files.NameEquivalence
+	// scans and rewrites each read the track files using up to the open file
+	// limit, and rewrites modify them, and so jobs are run one at a time
+	workLock sync.Mutex
+}
+
+func (srv *server) serve(o output.Bus) *cmdtoolkit.ExitError {
+	httpServer := &http.Server{
+		Addr:              srv.address,
+		Handler:           srv.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// once interrupted, stop accepting requests, and let the requests in
+	// progress finish
+	stopShutdown := context.AfterFunc(srv.ctx, func() {
+		_ = httpServer.Shutdown(context.Background())
+	})
+	defer stopShutdown()
+	o.ConsolePrintf("Serving the music library at http://%s/.\n", srv.address)
+	if srv.token == "" {
+		o.ConsolePrintf("Rewrites are disabled; set %s to enable them.\n", serveTokenFlag)
+	}
+	if !isLoopbackAddress(srv.address) {
+		o.ConsolePrintln("Requests, including the bearer token, are not encrypted.")
+	}
+	o.Log(output.Info, "server starting", map[string]any{
+		"command":        serveCommandName,
+		serveAddressFlag: srv.address,
+		"rewrites":       srv.token != "",
+	})
+	if serveErr := listenAndServe(httpServer); serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+		o.ErrorPrintf("The server cannot run: %s.\n", cmdtoolkit.ErrorToString(serveErr))
+		o.Log(output.Error, "server failed", map[string]any{
+			"command":        serveCommandName,
+			serveAddressFlag: srv.address,
+			"error":          serveErr,
+		})
+		return cmdtoolkit.NewExitSystemError(serveCommandName)
+	}
+	if srv.ctx.Err() != nil {
+		o.ConsolePrintln("Stopping; waiting for the running jobs to finish.")
+		srv.jobs.wait()
+		o.ConsolePrintln("Stopped serving.")
+	}
+	return nil
+}
+
+func (srv *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/library", srv.handleLibrary)
+	mux.HandleFunc("GET /api/diagnostics", srv.handleDiagnostics)
+	mux.HandleFunc("POST /api/scans", srv.handleScan)
+	mux.HandleFunc("POST /api/rewrites", srv.handleRewrite)
+	mux.HandleFunc("GET /api/jobs/{id}", srv.handleJob)
+	return mux
+}
+
+type libraryTrack struct {
+	Number   int    `json:"number"`
+	Name     string `json:"name"`
+	FileName string `json:"fileName"`
+}
+
+type libraryAlbum struct {
+	Title  string         `json:"title"`
+	Tracks []libraryTrack `json:"tracks"`
+}
+
+type libraryArtist struct {
+	Name   string         `json:"name"`
+	Albums []libraryAlbum `json:"albums"`
+}
+
+// loadLibrary loads and filters the library; the messages written while doing
+// so are returned as an error if no tracks are found
+func (srv *server) loadLibrary() ([]*files.Artist, error) {
+	o := output.NewRecorder()
+	var filtered []*files.Artist
+	if artists := srv.ss.load(srv.ctx, o); len(artists) != 0 {
+		filtered = srv.ss.filter(o, artists)
+	}
+	if len(filtered) == 0 {
+		return nil, errors.New(strings.TrimSpace(o.ErrorOutput()))
+	}
+	slices.SortFunc(filtered, func(a, b *files.Artist) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return filtered, nil
+}
+
+func (srv *server) handleLibrary(w http.ResponseWriter, _ *http.Request) {
+	artists, loadErr := srv.loadLibrary()
+	if loadErr != nil {
+		writeJSONError(w, http.StatusNotFound, loadErr.Error())
+		return
+	}
+	library := make([]libraryArtist, 0, len(artists))
+	for _, artist := range artists {
+		la := libraryArtist{Name: artist.Name(), Albums: []libraryAlbum{}}
+		albums := slices.Clone(artist.Albums())
+		files.SortAlbums(albums)
+		for _, album := range albums {
+			lal := libraryAlbum{Title: album.Title(), Tracks: []libraryTrack{}}
+			for _, track := range album.Tracks() {
+				lal.Tracks = append(lal.Tracks, libraryTrack{
+					Number:   track.Number(),
+					Name:     track.Name(),
+					FileName: track.FileName(),
+				})
+			}
+			slices.SortFunc(lal.Tracks, func(a, b libraryTrack) int { return a.Number - b.Number })
+			la.Albums = append(la.Albums, lal)
+		}
+		library = append(library, la)
+	}
+	writeJSON(w, http.StatusOK, library)
+}
+
+// findAlbum looks up an album by its artist's name and its title
+func findAlbum(artists []*files.Artist, artistName, albumTitle string) *files.Album {
+	for _, artist := range artists {
+		if artist.Name() != artistName {
+			continue
+		}
+		for _, album := range artist.Albums() {
+			if album.Title() == albumTitle {
+				return album
+			}
+		}
+	}
+	return nil
+}
+
+type trackDiagnostics struct {
+	ID3V1      []string          `json:"id3v1,omitempty"`
+	ID3V1Error string            `json:"id3v1Error,omitempty"`
+	ID3V2      *id3v2Diagnostics `json:"id3v2,omitempty"`
+	ID3V2Error string            `json:"id3v2Error,omitempty"`
+}
+
+type id3v2Diagnostics struct {
+	Version  byte                `json:"version"`
+	Encoding string              `json:"encoding"`
+	Frames   map[string][]string `json:"frames"`
+}
+
+func (srv *server) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	artistName := query.Get("artist")
+	albumTitle := query.Get("album")
+	fileName := query.Get("track")
+	artists, loadErr := srv.loadLibrary()
+	if loadErr != nil {
+		writeJSONError(w, http.StatusNotFound, loadErr.Error())
+		return
+	}
+	album := findAlbum(artists, artistName, albumTitle)
+	if album == nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("the album %q by %q is not found", albumTitle, artistName))
+		return
+	}
+	var track *files.Track
+	for _, t := range album.Tracks() {
+		if t.FileName() == fileName {
+			track = t
+		}
+	}
+	if track == nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("the track %q is not found", fileName))
+		return
+	}
+	var diagnostics trackDiagnostics
+	if tags, id3v1Err := track.ID3V1Diagnostics(); id3v1Err == nil {
+		slices.Sort(tags)
+		diagnostics.ID3V1 = tags
+	} else {
+		diagnostics.ID3V1Error = id3v1Err.Error()
+	}
+	if info, id3v2Err := readID3V2Diagnostics(track); id3v2Err == nil {
+		diagnostics.ID3V2 = &id3v2Diagnostics{
+			Version:  info.Version(),
+			Encoding: info.Encoding(),
+			Frames:   info.Frames(),
+		}
+	} else {
+		diagnostics.ID3V2Error = id3v2Err.Error()
+	}
+	writeJSON(w, http.StatusOK, diagnostics)
+}
+
+// scanRequest selects the scans to run; omitted fields take the values set by
+// newScanRequest
+type scanRequest struct {
+	Empty       bool   `json:"empty"`
+	Files       bool   `json:"files"`
+	Numbering   bool   `json:"numbering"`
+	Portability bool   `json:"portability"`
+	Profile     string `json:"profile"`
+}
+
+func newScanRequest() scanRequest {
+	return scanRequest{Empty: true, Files: true, Numbering: true, Profile: "windows"}
+}
+
+func (srv *server) handleScan(w http.ResponseWriter, r *http.Request) {
+	request := newScanRequest()
+	if decodeErr := decodeJSONBody(r, &request); decodeErr != nil {
+		writeJSONError(w, http.StatusBadRequest, decodeErr.Error())
+		return
+	}
+	profile, found := files.LookupPortabilityProfile(request.Profile)
+	if !found {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("the profile %q is not one of %s", request.Profile,
+			strings.Join(files.PortabilityProfileNames(), ", ")))
+		return
+	}
+	if !request.Empty && !request.Files && !request.Numbering && !request.Portability {
+		writeJSONError(w, http.StatusBadRequest, "no scans are selected")
+		return
+	}
+	scanSets := &scanSettings{
+		empty:        cmdtoolkit.CommandFlag[bool]{Value: request.Empty},
+		files:        cmdtoolkit.CommandFlag[bool]{Value: request.Files},
+		numbering:    cmdtoolkit.CommandFlag[bool]{Value: request.Numbering},
+		portability:  cmdtoolkit.CommandFlag[bool]{Value: request.Portability},
+		profile:      profile,
+		suppressions: srv.suppressions,
+		framePolicy:  srv.framePolicy,
+		names:        srv.names,
+	}
+	j := srv.jobs.start(scanJob, func() (any, error) {
+		return srv.scan(scanSets)
+	})
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+// scan runs the selected scans, much as the scan command does, and returns the
+// concerns found, organized by artist, album, and track
+func (srv *server) scan(scanSets *scanSettings) ([]concernReport, error) {
+	srv.workLock.Lock()
+	defer srv.workLock.Unlock()
+	o := output.NewRecorder()
+	artists := srv.ss.load(srv.ctx, o)
+	if len(artists) == 0 {
+		return nil, errors.New(strings.TrimSpace(o.ErrorOutput()))
+	}
+	concernedArtists := createConcernedArtists(artists)
+	scanSets.performEmptyAnalysis(concernedArtists)
+	scanSets.performNumberingAnalysis(concernedArtists)
+	scanSets.performFileAnalysis(srv.ctx, o, concernedArtists, srv.ss, srv.ios)
+	if srv.ctx.Err() != nil {
+		return nil, errServerInterrupted
+	}
+	scanSets.performPortabilityAnalysis(concernedArtists)
+	if scanSets.suppressions != nil {
+		scanSets.suppressions.hide(concernedArtists, currentTime())
+	}
+	reports := []concernReport{}
+	for _, cAr := range concernedArtists {
+		cAr.rollup()
+		if cAr.isConcerned() {
+			reports = append(reports, cAr.toReport())
+		}
+	}
+	slices.SortFunc(reports, compareConcernReports)
+	return reports, nil
+}
+
+type albumSelection struct {
+	Artist string `json:"artist"`
+	Album  string `json:"album"`
+}
+
+type rewriteRequest struct {
+	Albums []albumSelection `json:"albums"`
+}
+
+// rewriteResult reports the messages written by a rewrite
+type rewriteResult struct {
+	Output []string `json:"output"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+func (srv *server) authorized(r *http.Request) bool {
+	presented, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return found && subtle.ConstantTimeCompare([]byte(presented), []byte(srv.token)) == 1
+}
+
+func (srv *server) handleRewrite(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case srv.token == "":
+		writeJSONError(w, http.StatusForbidden, fmt.Sprintf("rewrites are disabled; start the server with %s",
+			serveTokenFlag))
+		return
+	case !srv.authorized(r):
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeJSONError(w, http.StatusUnauthorized, "a valid bearer token is required")
+		return
+	}
+	var request rewriteRequest
+	if decodeErr := decodeJSONBody(r, &request); decodeErr != nil {
+		writeJSONError(w, http.StatusBadRequest, decodeErr.Error())
+		return
+	}
+	if len(request.Albums) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "no albums are selected")
+		return
+	}
+	artists, loadErr := srv.loadLibrary()
+	if loadErr != nil {
+		writeJSONError(w, http.StatusNotFound, loadErr.Error())
+		return
+	}
+	selected, selectErr := selectAlbums(artists, request.Albums)
+	if selectErr != nil {
+		writeJSONError(w, http.StatusNotFound, selectErr.Error())
+		return
+	}
+	j := srv.jobs.start(rewriteJob, func() (any, error) {
+		return srv.rewrite(selected)
+	})
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+// selectAlbums copies the selected albums, grouped by artist
+func selectAlbums(artists []*files.Artist, selections []albumSelection) ([]*files.Artist, error) {
+	copies := map[string]*files.Artist{}
+	var selected []*files.Artist
+	for _, selection := range selections {
+		album := findAlbum(artists, selection.Artist, selection.Album)
+		if album == nil {
+			return nil, fmt.Errorf("the album %q by %q is not found", selection.Album, selection.Artist)
+		}
+		artistCopy, found := copies[selection.Artist]
+		if !found {
+			for _, artist := range artists {
+				if artist.Name() == selection.Artist {
+					artistCopy = artist.Copy()
+				}
+			}
+			copies[selection.Artist] = artistCopy
+			selected = append(selected, artistCopy)
+		}
+		if findAlbum([]*files.Artist{artistCopy}, selection.Artist, selection.Album) == nil {
+			album.Copy(artistCopy, true, true)
+		}
+	}
+	return selected, nil
+}
+
+// rewrite backs up and rewrites the tracks in the selected albums whose
+// metadata conflicts with the file system, as the rewrite command does
+func (srv *server) rewrite(artists []*files.Artist) (*rewriteResult, error) {
+	srv.workLock.Lock()
+	defer srv.workLock.Unlock()
+	o := output.NewRecorder()
+	applyNameEquivalence(artists, srv.names)
+	readMetadata(srv.ctx, o, artists, srv.ios.openFileLimit)
+	if srv.suppressions != nil {
+		srv.suppressions.suppressFields(artists, currentTime())
+	}
+	concernedArtists := createConcernedArtists(artists)
+	var rewriteErr *cmdtoolkit.ExitError
+	switch {
+	case srv.ctx.Err() != nil:
+		return nil, errServerInterrupted
+	case findConflictedTracks(concernedArtists) == 0:
+		nothingToDo(o)
+	default:
+		rewriteErr = backupAndRewriteTracks(srv.ctx, o, concernedArtists, srv.ios.openFileLimit, false, nil)
+	}
+	result := &rewriteResult{Output: splitLines(o.ConsoleOutput()), Errors: splitLines(o.ErrorOutput())}
+	if rewriteErr != nil {
+		return result, errors.New("one or more tracks could not be rewritten")
+	}
+	return result, nil
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimRight(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func (srv *server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if j, found := srv.jobs.lookup(r.PathValue("id")); found {
+		writeJSON(w, http.StatusOK, j)
+		return
+	}
+	writeJSONError(w, http.StatusNotFound, fmt.Sprintf("the job %q is not found", r.PathValue("id")))
+}
+
+// job is a snapshot of a background task's state
+type job struct {
+	ID       string     `json:"id"`
+	Kind     string     `json:"kind"`
+	Status   string     `json:"status"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Result   any        `json:"result,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// jobStore runs background tasks and records their state; it keeps every
+// running job, but only the most recently finished ones
+type jobStore struct {
+	lock    sync.Mutex
+	jobs    map[string]*job
+	lastID  int
+	running sync.WaitGroup
+	// the IDs of the finished jobs that are kept, in the order in which they
+	// finished, and how many of them are kept
+	finished    []string
+	maxFinished int
+}
+
+func newJobStore() *jobStore {
+	return &jobStore{jobs: map[string]*job{}, maxFinished: maxFinishedJobs}
+}
+
+// start runs the task in the background and returns a snapshot of its job
+func (js *jobStore) start(kind string, task func() (any, error)) job {
+	js.lock.Lock()
+	js.lastID++
+	j := &job{ID: strconv.Itoa(js.lastID), Kind: kind, Status: jobRunning, Started: time.Now()}
+	js.jobs[j.ID] = j
+	snapshot := *j
+	js.lock.Unlock()
+	js.running.Go(func() {
+		result, taskErr := task()
+		js.lock.Lock()
+		defer js.lock.Unlock()
+		finished := time.Now()
+		j.Finished = &finished
+		j.Result = result
+		j.Status = jobSucceeded
+		if taskErr != nil {
+			j.Status = jobFailed
+			j.Error = taskErr.Error()
+		}
+		js.finished = append(js.finished, j.ID)
+		if len(js.finished) > js.maxFinished {
+			delete(js.jobs, js.finished[0])
+			js.finished = js.finished[1:]
+		}
+	})
+	return snapshot
+}
+
+// wait waits for the running jobs to finish
+func (js *jobStore) wait() {
+	js.running.Wait()
+}
+
+func (js *jobStore) lookup(id string) (job, bool) {
+	js.lock.Lock()
+	defer js.lock.Unlock()
+	if j, found := js.jobs[id]; found {
+		return *j, true
+	}
+	return job{}, false
+}
+
+// decodeJSONBody decodes the request's body, if any, into v
+func decodeJSONBody(r *http.Request, v any) error {
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	if decodeErr := decoder.Decode(v); decodeErr != nil && !errors.Is(decodeErr, io.EOF) {
+		return fmt.Errorf("the request body cannot be parsed: %w", decodeErr)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func processServeFlags(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any]) (*server, bool) {
+	srv := &server{jobs: newJobStore()}
+	flagsOk := true // optimistic
+	allowRemote, flagErr := cmdtoolkit.GetBool(o, values, serveAllowRemote)
+	if flagErr != nil {
+		flagsOk = false
+	}
+	if rawValue, flagErr := cmdtoolkit.GetString(o, values, serveAddress); flagErr == nil {
+		_, _, splitErr := net.SplitHostPort(rawValue.Value)
+		switch {
+		case splitErr != nil:
+			o.ErrorPrintf("The %s value %q cannot be used.\n", serveAddressFlag, rawValue.Value)
+			o.ErrorPrintln("Why?")
+			o.ErrorPrintf("The value is not a host and port: %s.\n", cmdtoolkit.ErrorToString(splitErr))
+			o.ErrorPrintln("What to do:")
+			o.ErrorPrintln("Use a value such as 127.0.0.1:8080 or localhost:9000.")
+			o.Log(output.Error, "invalid address", map[string]any{
+				serveAddressFlag: rawValue.Value,
+				"user-set":       rawValue.UserSet,
+				"error":          splitErr,
+			})
+			flagsOk = false
+		case !isLoopbackAddress(rawValue.Value) && !allowRemote.Value:
+			o.ErrorPrintf("The %s value %q cannot be used.\n", serveAddressFlag, rawValue.Value)
+			o.ErrorPrintln("Why?")
+			o.ErrorPrintln("The host is not a loopback address, and requests, including the bearer token, " +
+				"would travel over the network unencrypted.")
+			o.ErrorPrintln("What to do:")
+			o.ErrorPrintf("Use a value such as 127.0.0.1:8080 or localhost:9000, or set %s.\n", serveRemoteFlag)
+			o.Log(output.Error, "address is not a loopback address", map[string]any{
+				serveAddressFlag: rawValue.Value,
+				"user-set":       rawValue.UserSet,
+			})
+			flagsOk = false
+		default:
+			srv.address = rawValue.Value
+		}
+	} else {
+		flagsOk = false
+	}
+	if rawValue, flagErr := cmdtoolkit.GetString(o, values, serveToken); flagErr == nil {
+		srv.token = rawValue.Value
+	} else {
+		flagsOk = false
+	}
+	if sups, suppressionsOk := evaluateSuppressions(o, values); suppressionsOk {
+		srv.suppressions = sups
+	} else {
+		flagsOk = false
+	}
+	if policies, policiesOk := evaluateFramePolicies(o, values); policiesOk {
+		srv.framePolicy = policies
+	} else {
+		flagsOk = false
+	}
+	return srv, flagsOk
+}
+
+// isLoopbackAddress determines whether the address's host is localhost or a
+// loopback IP address; an address without a host listens on every interface
+func isLoopbackAddress(address string) bool {
+	host, _, splitErr := net.SplitHostPort(address)
+	if splitErr != nil {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	cmdtoolkit.AddDefaults(serveFlags)
+	cmdtoolkit.AddFlags(getBus(), getConfiguration(), serveCmd.Flags(), serveFlags, searchFlags, ioFlags,
+		namesFlags, id3v2Flags)
+}
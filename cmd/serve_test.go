@@ -0,0 +1,717 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"mp3repair/internal/files"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+func Test_processServeFlags(t *testing.T) {
+	tests := map[string]struct {
+		values      map[string]*cmdtoolkit.CommandFlag[any]
+		wantAddress string
+		wantToken   string
+		want1       bool
+		output.WantedRecording
+	}{
+		"no data": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{},
+			want1:  false,
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"An internal error occurred: flag \"allowRemote\" is not found.\n" +
+					"An internal error occurred: flag \"address\" is not found.\n" +
+					"An internal error occurred: flag \"token\" is not found.\n" +
+					"An internal error occurred: flag \"suppressions\" is not found.\n" +
+					"An internal error occurred: flag \"framePolicy\" is not found.\n",
+				Log: "" +
+					"level='error' error='flag not found' flag='allowRemote' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='address' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='token' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='suppressions' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='framePolicy' msg='internal error'\n",
+			},
+		},
+		"bad address": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				serveAddress:     {Value: "localhost", UserSet: true},
+				serveAllowRemote: {Value: false},
+				serveToken:       {Value: ""},
+				suppressionsFile: {Value: ""},
+				framePolicyFile:  {Value: ""},
+			},
+			want1: false,
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"The --address value \"localhost\" cannot be used.\n" +
+					"Why?\n" +
+					"The value is not a host and port: '*net.AddrError: address localhost: missing port in address'.\n" +
+					"What to do:\n" +
+					"Use a value such as 127.0.0.1:8080 or localhost:9000.\n",
+				Log: "level='error'" +
+					" --address='localhost'" +
+					" error='address localhost: missing port in address'" +
+					" user-set='true'" +
+					" msg='invalid address'\n",
+			},
+		},
+		"remote address": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				serveAddress:     {Value: "0.0.0.0:8080", UserSet: true},
+				serveAllowRemote: {Value: false},
+				serveToken:       {Value: "s3cret", UserSet: true},
+				suppressionsFile: {Value: ""},
+				framePolicyFile:  {Value: ""},
+			},
+			wantToken: "s3cret",
+			want1:     false,
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"The --address value \"0.0.0.0:8080\" cannot be used.\n" +
+					"Why?\n" +
+					"The host is not a loopback address, and requests, including the bearer token, would travel " +
+					"over the network unencrypted.\n" +
+					"What to do:\n" +
+					"Use a value such as 127.0.0.1:8080 or localhost:9000, or set --allowRemote.\n",
+				Log: "level='error'" +
+					" --address='0.0.0.0:8080'" +
+					" user-set='true'" +
+					" msg='address is not a loopback address'\n",
+			},
+		},
+		"remote address allowed": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				serveAddress:     {Value: ":8080", UserSet: true},
+				serveAllowRemote: {Value: true, UserSet: true},
+				serveToken:       {Value: "s3cret", UserSet: true},
+				suppressionsFile: {Value: ""},
+				framePolicyFile:  {Value: ""},
+			},
+			wantAddress: ":8080",
+			wantToken:   "s3cret",
+			want1:       true,
+		},
+		"good": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				serveAddress:     {Value: "localhost:9000", UserSet: true},
+				serveAllowRemote: {Value: false},
+				serveToken:       {Value: "s3cret", UserSet: true},
+				suppressionsFile: {Value: ""},
+				framePolicyFile:  {Value: ""},
+			},
+			wantAddress: "localhost:9000",
+			wantToken:   "s3cret",
+			want1:       true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			got, got1 := processServeFlags(o, tt.values)
+			if got.address != tt.wantAddress {
+				t.Errorf("processServeFlags() got address = %q, want %q", got.address, tt.wantAddress)
+			}
+			if got.token != tt.wantToken {
+				t.Errorf("processServeFlags() got token = %q, want %q", got.token, tt.wantToken)
+			}
+			if got.jobs == nil {
+				t.Errorf("processServeFlags() got no job store")
+			}
+			if got1 != tt.want1 {
+				t.Errorf("processServeFlags() got1 = %v, want %v", got1, tt.want1)
+			}
+			o.Report(t, "processServeFlags()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_server_serve(t *testing.T) {
+	originalListenAndServe := listenAndServe
+	defer func() {
+		listenAndServe = originalListenAndServe
+	}()
+	interrupted, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := map[string]struct {
+		ctx       context.Context
+		token     string
+		serveErr  error
+		wantError bool
+		output.WantedRecording
+	}{
+		"closed": {
+			ctx:      context.Background(),
+			token:    "s3cret",
+			serveErr: http.ErrServerClosed,
+			WantedRecording: output.WantedRecording{
+				Console: "Serving the music library at http://127.0.0.1:8080/.\n",
+				Log: "level='info'" +
+					" --address='127.0.0.1:8080'" +
+					" command='serve'" +
+					" rewrites='true'" +
+					" msg='server starting'\n",
+			},
+		},
+		"interrupted": {
+			ctx:      interrupted,
+			token:    "s3cret",
+			serveErr: http.ErrServerClosed,
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"Serving the music library at http://127.0.0.1:8080/.\n" +
+					"Stopping; waiting for the running jobs to finish.\n" +
+					"Stopped serving.\n",
+				Log: "level='info'" +
+					" --address='127.0.0.1:8080'" +
+					" command='serve'" +
+					" rewrites='true'" +
+					" msg='server starting'\n",
+			},
+		},
+		"failed": {
+			ctx:       context.Background(),
+			serveErr:  errors.New("address in use"),
+			wantError: true,
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"Serving the music library at http://127.0.0.1:8080/.\n" +
+					"Rewrites are disabled; set --token to enable them.\n",
+				Error: "The server cannot run: 'address in use'.\n",
+				Log: "" +
+					"level='info'" +
+					" --address='127.0.0.1:8080'" +
+					" command='serve'" +
+					" rewrites='false'" +
+					" msg='server starting'\n" +
+					"level='error'" +
+					" --address='127.0.0.1:8080'" +
+					" command='serve'" +
+					" error='address in use'" +
+					" msg='server failed'\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			listenAndServe = func(s *http.Server) error {
+				if s.Handler == nil {
+					t.Errorf("server.serve() has no handler")
+				}
+				return tt.serveErr
+			}
+			srv := &server{ctx: tt.ctx, address: "127.0.0.1:8080", token: tt.token, jobs: newJobStore()}
+			o := output.NewRecorder()
+			got := srv.serve(o)
+			if (got != nil) != tt.wantError {
+				t.Errorf("server.serve() = %v, wantError %v", got, tt.wantError)
+			}
+			o.Report(t, "server.serve()", tt.WantedRecording)
+		})
+	}
+}
+
+// newTestServer creates a server whose library consists of a single track,
+// music/artist/album/1 lovely music.mp3
+func newTestServer(t *testing.T, token string) *server {
+	t.Helper()
+	originalReadDirectory := readDirectory
+	t.Cleanup(func() {
+		readDirectory = originalReadDirectory
+	})
+	track := newTestFile("1 lovely music.mp3", nil)
+	album := newTestFile("album", []*testFile{track})
+	artist := newTestFile("artist", []*testFile{album})
+	musicDir := newTestFile("music", []*testFile{artist})
+	testFiles := map[string]*testFile{
+		"music":                          musicDir,
+		filepath.Join("music", "artist"): artist,
+		filepath.Join("music", "artist", "album"): album,
+	}
+	readDirectory = func(_ output.Bus, dir string) ([]fs.FileInfo, bool) {
+		if tf, found := testFiles[dir]; found {
+			var entries []fs.FileInfo
+			for _, f := range tf.files {
+				entries = append(entries, f)
+			}
+			return entries, true
+		}
+		return []fs.FileInfo{}, false
+	}
+	return &server{
+		ctx:   context.Background(),
+		token: token,
+		jobs:  newJobStore(),
+		ss: &searchSettings{
+			artistFilter:   regexp.MustCompile(".*"),
+			albumFilter:    regexp.MustCompile(".*"),
+			trackFilter:    regexp.MustCompile(".*"),
+			fileExtensions: []string{".mp3"},
+			musicDir:       "music",
+		},
+		ios: &ioSettings{openFileLimit: 1},
+	}
+}
+
+func serveRequest(handler http.Handler, method, target, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func Test_server_handleLibrary(t *testing.T) {
+	srv := newTestServer(t, "")
+	w := serveRequest(srv.handler(), http.MethodGet, "/api/library", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/library status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var got []libraryArtist
+	if decodeErr := json.Unmarshal(w.Body.Bytes(), &got); decodeErr != nil {
+		t.Fatalf("GET /api/library body cannot be decoded: %v", decodeErr)
+	}
+	want := []libraryArtist{
+		{
+			Name: "artist",
+			Albums: []libraryAlbum{
+				{
+					Title: "album",
+					Tracks: []libraryTrack{
+						{Number: 1, Name: "lovely music", FileName: "1 lovely music.mp3"},
+					},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GET /api/library = %v, want %v", got, want)
+	}
+	srv.ss.musicDir = "no music"
+	if w = serveRequest(srv.handler(), http.MethodGet, "/api/library", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /api/library with no library status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func Test_server_handleDiagnostics(t *testing.T) {
+	originalReadID3V2Diagnostics := readID3V2Diagnostics
+	defer func() {
+		readID3V2Diagnostics = originalReadID3V2Diagnostics
+	}()
+	readID3V2Diagnostics = func(_ *files.Track) (*files.ID3V2Info, error) {
+		return files.NewID3V2Info(3, "ISO-8859-1", map[string][]string{"TIT2": {"lovely music"}}, nil), nil
+	}
+	srv := newTestServer(t, "")
+	tests := map[string]struct {
+		target     string
+		wantStatus int
+	}{
+		"missing album": {
+			target:     "/api/diagnostics?artist=artist&album=other&track=1+lovely+music.mp3",
+			wantStatus: http.StatusNotFound,
+		},
+		"missing track": {
+			target:     "/api/diagnostics?artist=artist&album=album&track=2+other.mp3",
+			wantStatus: http.StatusNotFound,
+		},
+		"good": {
+			target:     "/api/diagnostics?artist=artist&album=album&track=1+lovely+music.mp3",
+			wantStatus: http.StatusOK,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := serveRequest(srv.handler(), http.MethodGet, tt.target, "", "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("GET %s status = %d, want %d", tt.target, w.Code, tt.wantStatus)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var got trackDiagnostics
+			if decodeErr := json.Unmarshal(w.Body.Bytes(), &got); decodeErr != nil {
+				t.Fatalf("GET %s body cannot be decoded: %v", tt.target, decodeErr)
+			}
+			// the track file does not exist, so its ID3V1 metadata cannot be read
+			if got.ID3V1Error == "" {
+				t.Errorf("GET %s reported no ID3V1 error", tt.target)
+			}
+			wantID3V2 := &id3v2Diagnostics{
+				Version:  3,
+				Encoding: "ISO-8859-1",
+				Frames:   map[string][]string{"TIT2": {"lovely music"}},
+			}
+			if !reflect.DeepEqual(got.ID3V2, wantID3V2) {
+				t.Errorf("GET %s ID3V2 = %v, want %v", tt.target, got.ID3V2, wantID3V2)
+			}
+		})
+	}
+}
+
+// awaitJob polls the job until it is no longer running
+func awaitJob(t *testing.T, handler http.Handler, id string) job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		w := serveRequest(handler, http.MethodGet, "/api/jobs/"+id, "", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /api/jobs/%s status = %d, want %d", id, w.Code, http.StatusOK)
+		}
+		var j job
+		if decodeErr := json.Unmarshal(w.Body.Bytes(), &j); decodeErr != nil {
+			t.Fatalf("GET /api/jobs/%s body cannot be decoded: %v", id, decodeErr)
+		}
+		if j.Status != jobRunning {
+			return j
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return job{}
+}
+
+func Test_server_handleScan(t *testing.T) {
+	srv := newTestServer(t, "")
+	handler := srv.handler()
+	tests := map[string]struct {
+		body       string
+		wantStatus int
+	}{
+		"bad body":    {body: "{\"files\": 1}", wantStatus: http.StatusBadRequest},
+		"bad profile": {body: "{\"profile\": \"vms\"}", wantStatus: http.StatusBadRequest},
+		"no scans": {
+			body:       "{\"empty\": false, \"files\": false, \"numbering\": false}",
+			wantStatus: http.StatusBadRequest,
+		},
+		"good": {
+			body:       "{\"files\": false, \"portability\": true}",
+			wantStatus: http.StatusAccepted,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := serveRequest(handler, http.MethodPost, "/api/scans", "", tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("POST /api/scans status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Code != http.StatusAccepted {
+				return
+			}
+			var started job
+			if decodeErr := json.Unmarshal(w.Body.Bytes(), &started); decodeErr != nil {
+				t.Fatalf("POST /api/scans body cannot be decoded: %v", decodeErr)
+			}
+			if started.Kind != scanJob {
+				t.Errorf("POST /api/scans kind = %q, want %q", started.Kind, scanJob)
+			}
+			finished := awaitJob(t, handler, started.ID)
+			if finished.Status != jobSucceeded || finished.Finished == nil {
+				t.Errorf("scan job = %v, want succeeded", finished)
+			}
+			if !reflect.DeepEqual(finished.Result, []any{}) {
+				t.Errorf("scan job result = %v, want no concerns", finished.Result)
+			}
+		})
+	}
+	if w := serveRequest(handler, http.MethodGet, "/api/jobs/99", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /api/jobs/99 status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func Test_server_handleRewrite(t *testing.T) {
+	goodBody := "{\"albums\": [{\"artist\": \"artist\", \"album\": \"album\"}]}"
+	tests := map[string]struct {
+		serverToken string
+		token       string
+		body        string
+		wantStatus  int
+	}{
+		"disabled": {token: "s3cret", body: goodBody, wantStatus: http.StatusForbidden},
+		"no token": {serverToken: "s3cret", body: goodBody, wantStatus: http.StatusUnauthorized},
+		"wrong token": {
+			serverToken: "s3cret",
+			token:       "guess",
+			body:        goodBody,
+			wantStatus:  http.StatusUnauthorized,
+		},
+		"bad body": {serverToken: "s3cret", token: "s3cret", body: "[", wantStatus: http.StatusBadRequest},
+		"no albums": {
+			serverToken: "s3cret",
+			token:       "s3cret",
+			body:        "{\"albums\": []}",
+			wantStatus:  http.StatusBadRequest,
+		},
+		"unknown album": {
+			serverToken: "s3cret",
+			token:       "s3cret",
+			body:        "{\"albums\": [{\"artist\": \"artist\", \"album\": \"other\"}]}",
+			wantStatus:  http.StatusNotFound,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestServer(t, tt.serverToken)
+			w := serveRequest(srv.handler(), http.MethodPost, "/api/rewrites", tt.token, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Errorf("POST /api/rewrites status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func Test_selectAlbums(t *testing.T) {
+	artist := files.NewArtist("The Beatles", filepath.Join("Music", "The Beatles"))
+	for _, title := range []string{"Abbey Road", "Help!", "Let It Be"} {
+		album := files.AlbumMaker{
+			Title:     title,
+			Artist:    artist,
+			Directory: filepath.Join("Music", "The Beatles", title),
+		}.NewAlbum(true)
+		files.TrackMaker{
+			Album:      album,
+			FileName:   "01 track.mp3",
+			SimpleName: "track",
+			Number:     1,
+		}.NewTrack(true)
+	}
+	artists := []*files.Artist{artist}
+	got, gotErr := selectAlbums(artists, []albumSelection{
+		{Artist: "The Beatles", Album: "Let It Be"},
+		{Artist: "The Beatles", Album: "Abbey Road"},
+		{Artist: "The Beatles", Album: "Let It Be"},
+	})
+	if gotErr != nil {
+		t.Fatalf("selectAlbums() error = %v", gotErr)
+	}
+	if len(got) != 1 || got[0] == artist {
+		t.Fatalf("selectAlbums() = %v, want one copied artist", got)
+	}
+	var titles []string
+	for _, album := range got[0].Albums() {
+		titles = append(titles, album.Title())
+		if len(album.Tracks()) != 1 {
+			t.Errorf("selectAlbums() album %q has %d tracks, want 1", album.Title(), len(album.Tracks()))
+		}
+	}
+	if want := []string{"Let It Be", "Abbey Road"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("selectAlbums() albums = %v, want %v", titles, want)
+	}
+	if _, gotErr = selectAlbums(artists, []albumSelection{{Artist: "The Who", Album: "Tommy"}}); gotErr == nil {
+		t.Errorf("selectAlbums() found a missing album")
+	}
+}
+
+func Test_jobStore(t *testing.T) {
+	js := newJobStore()
+	release := make(chan struct{})
+	first := js.start(scanJob, func() (any, error) {
+		<-release
+		return "done", nil
+	})
+	second := js.start(rewriteJob, func() (any, error) {
+		return nil, errors.New("no luck")
+	})
+	if first.ID != "1" || second.ID != "2" {
+		t.Errorf("jobStore.start() ids = %q, %q, want \"1\", \"2\"", first.ID, second.ID)
+	}
+	if got, found := js.lookup(first.ID); !found || got.Status != jobRunning {
+		t.Errorf("jobStore.lookup() = %v, %v, want running job", got, found)
+	}
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		j1, _ := js.lookup(first.ID)
+		j2, _ := js.lookup(second.ID)
+		if j1.Status != jobRunning && j2.Status != jobRunning {
+			if j1.Status != jobSucceeded || j1.Result != "done" {
+				t.Errorf("jobStore first job = %v, want succeeded with result", j1)
+			}
+			if j2.Status != jobFailed || j2.Error != "no luck" {
+				t.Errorf("jobStore second job = %v, want failed with error", j2)
+			}
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, found := js.lookup("3"); found {
+		t.Errorf("jobStore.lookup() found a job that was never started")
+	}
+}
+
+func Test_jobStore_retention(t *testing.T) {
+	js := newJobStore()
+	js.maxFinished = 1
+	first := js.start(scanJob, func() (any, error) { return nil, nil })
+	js.wait()
+	release := make(chan struct{})
+	running := js.start(scanJob, func() (any, error) {
+		<-release
+		return nil, nil
+	})
+	last := js.start(scanJob, func() (any, error) { return nil, nil })
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if j, _ := js.lookup(last.ID); j.Status == jobSucceeded {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, found := js.lookup(first.ID); found {
+		t.Errorf("jobStore.lookup() found job %s, which should have been forgotten", first.ID)
+	}
+	if j, found := js.lookup(running.ID); !found || j.Status != jobRunning {
+		t.Errorf("jobStore.lookup() = %v, %t, want running job", j, found)
+	}
+	if j, found := js.lookup(last.ID); !found || j.Status != jobSucceeded {
+		t.Errorf("jobStore.lookup() = %v, %t, want succeeded job", j, found)
+	}
+	close(release)
+	js.wait()
+	if _, found := js.lookup(last.ID); found {
+		t.Errorf("jobStore.lookup() found job %s, which should have been forgotten", last.ID)
+	}
+}
+
+func Test_isLoopbackAddress(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:8080":   true,
+		"127.1.2.3:8080":   true,
+		"[::1]:8080":       true,
+		"LocalHost:9000":   true,
+		"0.0.0.0:8080":     false,
+		":8080":            false,
+		"192.168.1.2:8080": false,
+		"example.com:80":   false,
+		"localhost":        false,
+	}
+	for address, want := range tests {
+		t.Run(address, func(t *testing.T) {
+			if got := isLoopbackAddress(address); got != want {
+				t.Errorf("isLoopbackAddress(%q) = %t, want %t", address, got, want)
+			}
+		})
+	}
+}
+
+func Test_serve_Help(t *testing.T) {
+	originalSearchFlags := searchFlags
+	originalMusicDir := xdg.UserDirs.Music
+	defer func() {
+		searchFlags = originalSearchFlags
+		xdg.UserDirs.Music = originalMusicDir
+	}()
+	searchFlags = safeSearchFlags
+	xdg.UserDirs.Music = "."
+	commandUnderTest := cloneCommand(serveCmd)
+	cmdtoolkit.AddFlags(output.NewNilBus(), cmdtoolkit.EmptyConfiguration(),
+		commandUnderTest.Flags(), serveFlags, searchFlags, ioFlags, namesFlags, id3v2Flags)
+	tests := map[string]struct {
+		output.WantedRecording
+	}{
+		"good": {
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"\"serve\" starts an HTTP server that exposes the music library as JSON\n" +
+					"\n" +
+					"The server provides these endpoints:\n" +
+					"\n" +
+					"GET  /api/library                          the artists, albums, and tracks\n" +
+					"GET  /api/diagnostics?artist=&album=&track= the ID3V1 and ID3V2 metadata of a track,\n" +
+					"                                           identified by its file name\n" +
+					"POST /api/scans                            start a scan; the optional JSON body selects\n" +
+					"                                           the scans, e.g. {\"empty\": true, \"files\": true,\n" +
+					"                                           \"numbering\": true, \"portability\": false,\n" +
+					"                                           \"profile\": \"windows\"}\n" +
+					"POST /api/rewrites                         back up and rewrite the selected albums; the\n" +
+					"                                           JSON body lists them, e.g. {\"albums\":\n" +
+					"                                           [{\"artist\": \"The Beatles\", \"album\": \"Abbey Road\"}]}\n" +
+					"GET  /api/jobs/{id}                        the status, and eventually the result, of a scan\n" +
+					"                                           or rewrite\n" +
+					"\n" +
+					"Scans and rewrites run in the background, one at a time; their responses identify\n" +
+					"the job to poll. The 100 most recently finished jobs are kept.\n" +
+					"\n" +
+					"Rewrites are only available if --token is set, and each rewrite request must\n" +
+					"include the header \"Authorization: Bearer <token>\". As requests are not encrypted,\n" +
+					"the server only listens on a loopback address unless --allowRemote is set.\n" +
+					"\n" +
+					"Scans and rewrites use the suppressions, frame policy, name equivalence rules, and\n" +
+					"ID3V2 settings given to the server.\n" +
+					"\n" +
+					"Usage:\n" +
+					"  serve [--address host:port] [--allowRemote] [--token token] [--suppressions file] " +
+					"[--framePolicy file] [--albumFilter regex] [--artistFilter regex] [--trackFilter regex] " +
+					"[--extensions extensions] [--maxOpenFiles count] [--aliases aliases] [--ampersand] [--foldCase] " +
+					"[--invertArticles] [--normalizeUnicode] [--id3v2Version version] [--id3v2Encoding encoding]\n" +
+					"\n" +
+					"Examples:\n" +
+					"serve\n" +
+					"  Serve the library at http://127.0.0.1:8080/, without the rewrite endpoint\n" +
+					"serve --address localhost:9000 --token s3cret\n" +
+					"  Serve the library at http://localhost:9000/, allowing rewrites by clients that\n" +
+					"  present the token s3cret\n" +
+					"\n" +
+					"Flags:\n" +
+					"      --address string         the host and port on which the server listens (default " +
+					"\"127.0.0.1:8080\")\n" +
+					"      --albumFilter string     regular expression specifying which albums to select (default \".*\")\n" +
+					"      --aliases string         semicolon-delimited list of alias=preferred name pairs for artist " +
+					"and album names (default \"\")\n" +
+					"      --allowRemote            allow listening on an address other than a loopback address; " +
+					"requests, including the bearer token, are not encrypted (default false)\n" +
+					"      --ampersand              treat '&' and 'and' as equal in artist and album names (default " +
+					"false)\n" +
+					"      --artistFilter string    regular expression specifying which artists to select (default \".*\")\n" +
+					"      --extensions string      comma-delimited list of file extensions used by mp3 files (default " +
+					"\".mp3\")\n" +
+					"      --foldCase               treat artist and album names differing only in letter case as equal " +
+					"(default false)\n" +
+					"      --framePolicy string     the path of a YAML file listing the ID3V2 frames that tags may or must " +
+					"contain; if empty, no frame policy is applied (default \"\")\n" +
+					"      --id3v2Encoding string   text encoding of rewritten ID3V2 tags: keep (each frame's own " +
+					"encoding), iso-8859-1, utf-16, or utf-8 (2.4 only) (default \"keep\")\n" +
+					"      --id3v2Version string    ID3V2 version of rewritten tags: keep (each tag's own version), 2.3, " +
+					"or 2.4 (default \"keep\")\n" +
+					"      --invertArticles         treat artist and album names such as 'Beatles, The' and 'The Beatles' " +
+					"as equal (default false)\n" +
+					"      --maxOpenFiles int       the maximum number of files that can be read simultaneously (at least " +
+					"1, at most 32767, default 1000) (default 1000)\n" +
+					"      --normalizeUnicode       treat the NFC and NFD forms of artist and album names as equal " +
+					"(default false)\n" +
+					"      --suppressions string    the path of a YAML file listing concerns that are known and accepted; " +
+					"if empty, no concerns are suppressed (default \"\")\n" +
+					"      --token string           the bearer token required by the rewrite endpoint; if empty, rewrites " +
+					"are disabled (default \"\")\n" +
+					"      --trackFilter string     regular expression specifying which tracks to select (default \".*\")\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			command := commandUnderTest
+			enableCommandRecording(o, command)
+			_ = command.Help()
+			o.Report(t, "serve Help()", tt.WantedRecording)
+		})
+	}
+}
@@ -0,0 +1,303 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+const (
+	snapshotDirectory    = "snapshots"
+	snapshotPrefix       = "scan-"
+	snapshotSuffix       = ".json"
+	snapshotNameLayout   = "20060102-150405"
+	snapshotReportLayout = "2006-01-02 15:04:05"
+)
+
+// concernSnapshot records the results of a scan; scans lists the names of the
+// concern types that the scan looked for
+type concernSnapshot struct {
+	Time     time.Time         `json:"time"`
+	Scans    []string          `json:"scans"`
+	Concerns []snapshotConcern `json:"concerns"`
+}
+
+// snapshotConcern is a single concern; an empty album or track name identifies
+// an artist or album concern
+type snapshotConcern struct {
+	Artist  string `json:"artist"`
+	Album   string `json:"album,omitempty"`
+	Track   string `json:"track,omitempty"`
+	Concern string `json:"concern"`
+	Message string `json:"message"`
+}
+
+func (sc snapshotConcern) location() string {
+	switch {
+	case sc.Track != "":
+		return fmt.Sprintf("Artist %q Album %q Track %q", sc.Artist, sc.Album, sc.Track)
+	case sc.Album != "":
+		return fmt.Sprintf("Artist %q Album %q", sc.Artist, sc.Album)
+	default:
+		return fmt.Sprintf("Artist %q", sc.Artist)
+	}
+}
+
+func (sc snapshotConcern) key() snapshotKey {
+	return snapshotKey{artist: sc.Artist, album: sc.Album, track: sc.Track, concern: sc.Concern}
+}
+
+func compareSnapshotConcerns(a, b snapshotConcern) int {
+	return cmp.Or(
+		strings.Compare(a.Artist, b.Artist),
+		strings.Compare(a.Album, b.Album),
+		strings.Compare(a.Track, b.Track),
+		strings.Compare(a.Concern, b.Concern),
+		strings.Compare(a.Message, b.Message),
+	)
+}
+
+// snapshotKey identifies the concerns of one type about one artist, album, or
+// track
+type snapshotKey struct {
+	artist  string
+	album   string
+	track   string
+	concern string
+}
+
+// newConcernSnapshot records the concerns found by a scan; it must be called
+// before the concerns are rolled up, so that each concern is recorded against
+// the artist, album, or track that it was found in
+func newConcernSnapshot(concernedArtists []*concernedArtist, scans []string, now time.Time) *concernSnapshot {
+	snapshot := &concernSnapshot{Time: now, Scans: scans, Concerns: []snapshotConcern{}}
+	for _, cAr := range concernedArtists {
+		artist := cAr.name()
+		snapshot.add(cAr.concerns, artist, "", "")
+		for _, cAl := range cAr.albums() {
+			album := cAl.name()
+			snapshot.add(cAl.concerns, artist, album, "")
+			for _, cT := range cAl.tracks() {
+				snapshot.add(cT.concerns, artist, album, cT.name())
+			}
+		}
+	}
+	slices.SortFunc(snapshot.Concerns, compareSnapshotConcerns)
+	return snapshot
+}
+
+func (snapshot *concernSnapshot) add(c concerns, artist, album, track string) {
+	for kind, list := range c.concernsCollection {
+		for _, message := range list {
+			snapshot.Concerns = append(snapshot.Concerns, snapshotConcern{
+				Artist:  artist,
+				Album:   album,
+				Track:   track,
+				Concern: concernName(kind),
+				Message: message,
+			})
+		}
+	}
+}
+
+func snapshotPath() string {
+	return filepath.Join(applicationPath(), snapshotDirectory)
+}
+
+// save writes the snapshot to a timestamped file in the application data
+// directory
+func (snapshot *concernSnapshot) save(o output.Bus) *cmdtoolkit.ExitError {
+	dir := snapshotPath()
+	if dirErr := mkdirAll(dir, 0o755); dirErr != nil {
+		o.ErrorPrintf("The directory %q cannot be created: %s.\n", dir, cmdtoolkit.ErrorToString(dirErr))
+		o.Log(output.Error, "cannot create directory", map[string]any{
+			"command":   scanCommand,
+			"directory": dir,
+			"error":     dirErr,
+		})
+		return cmdtoolkit.NewExitSystemError(scanCommand)
+	}
+	path := filepath.Join(dir, snapshotPrefix+snapshot.Time.Format(snapshotNameLayout)+snapshotSuffix)
+	content, _ := json.MarshalIndent(snapshot, "", "  ")
+	if writeErr := writeFile(path, content, cmdtoolkit.StdFilePermissions); writeErr != nil {
+		cmdtoolkit.ReportFileCreationFailure(o, scanCommand, path, writeErr)
+		return cmdtoolkit.NewExitSystemError(scanCommand)
+	}
+	o.ConsolePrintf("Scan snapshot saved to %q.\n", path)
+	return nil
+}
+
+// loadLatestSnapshot reads the most recent snapshot; it returns nil, true if
+// there are no snapshots
+func loadLatestSnapshot(o output.Bus) (*concernSnapshot, bool) {
+	dir := snapshotPath()
+	if !dirExists(dir) {
+		return nil, true
+	}
+	entries, dirOk := readDirectory(o, dir)
+	if !dirOk {
+		return nil, false
+	}
+	latest := ""
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, snapshotPrefix) && strings.HasSuffix(name, snapshotSuffix) &&
+			name > latest {
+			latest = name
+		}
+	}
+	if latest == "" {
+		return nil, true
+	}
+	path := filepath.Join(dir, latest)
+	content, readErr := readFile(path)
+	snapshot := &concernSnapshot{}
+	if readErr == nil {
+		readErr = json.Unmarshal(content, snapshot)
+	}
+	if readErr != nil {
+		o.ErrorPrintf("The scan snapshot %q cannot be read: %s.\n", path, cmdtoolkit.ErrorToString(readErr))
+		o.Log(output.Error, "cannot read scan snapshot", map[string]any{
+			"command":  scanCommand,
+			"snapshot": path,
+			"error":    readErr,
+		})
+		return nil, false
+	}
+	return snapshot, true
+}
+
+type changedConcern struct {
+	was []snapshotConcern
+	now []snapshotConcern
+}
+
+// snapshotDiff holds the concerns that have appeared, disappeared, or changed
+// between two snapshots
+type snapshotDiff struct {
+	added    []snapshotConcern
+	resolved []snapshotConcern
+	changed  []changedConcern
+	// the concern types that the current snapshot scanned for, but the previous
+	// one did not
+	uncompared []string
+}
+
+func (sd *snapshotDiff) isEmpty() bool {
+	return len(sd.added) == 0 && len(sd.resolved) == 0 && len(sd.changed) == 0
+}
+
+// diff compares the snapshot to a previous one; only the concern types that
+// both scanned for are compared. Concerns of the same type about the same
+// artist, album, or track whose messages differ are reported as changed.
+func (snapshot *concernSnapshot) diff(previous *concernSnapshot) *snapshotDiff {
+	sd := &snapshotDiff{}
+	for _, scan := range snapshot.Scans {
+		if !slices.Contains(previous.Scans, scan) {
+			sd.uncompared = append(sd.uncompared, scan)
+		}
+	}
+	compared := func(sc snapshotConcern) bool {
+		return slices.Contains(snapshot.Scans, sc.Concern) && slices.Contains(previous.Scans, sc.Concern)
+	}
+	was := groupSnapshotConcerns(previous.Concerns, compared)
+	now := groupSnapshotConcerns(snapshot.Concerns, compared)
+	keys := make([]snapshotKey, 0, len(was)+len(now))
+	for key := range was {
+		keys = append(keys, key)
+	}
+	for key := range now {
+		if _, found := was[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		wasList, nowList := was[key], now[key]
+		switch {
+		case len(wasList) == 0:
+			sd.added = append(sd.added, nowList...)
+		case len(nowList) == 0:
+			sd.resolved = append(sd.resolved, wasList...)
+		case !slices.Equal(wasList, nowList):
+			sd.changed = append(sd.changed, changedConcern{was: wasList, now: nowList})
+		}
+	}
+	slices.SortFunc(sd.added, compareSnapshotConcerns)
+	slices.SortFunc(sd.resolved, compareSnapshotConcerns)
+	slices.SortFunc(sd.changed, func(a, b changedConcern) int {
+		return compareSnapshotConcerns(a.now[0], b.now[0])
+	})
+	return sd
+}
+
+func groupSnapshotConcerns(list []snapshotConcern,
+	include func(snapshotConcern) bool) map[snapshotKey][]snapshotConcern {
+	groups := map[snapshotKey][]snapshotConcern{}
+	for _, sc := range list {
+		if include(sc) {
+			groups[sc.key()] = append(groups[sc.key()], sc)
+		}
+	}
+	for key, group := range groups {
+		slices.SortFunc(group, compareSnapshotConcerns)
+		groups[key] = group
+	}
+	return groups
+}
+
+// report writes the differences; previous is nil if there was no snapshot to
+// compare against, in which case every concern is new
+func (sd *snapshotDiff) report(o output.Bus, previous *concernSnapshot) {
+	if previous == nil {
+		o.ConsolePrintln("There is no previous scan snapshot; all concerns are new.")
+		if sd.isEmpty() {
+			o.ConsolePrintln("No concerns were found.")
+			return
+		}
+	} else {
+		when := previous.Time.Format(snapshotReportLayout)
+		for _, scan := range sd.uncompared {
+			o.ConsolePrintf("The scan of %s did not look for %s concerns; they are not compared.\n", when, scan)
+		}
+		if sd.isEmpty() {
+			o.ConsolePrintf("No concerns are new, resolved, or changed since the scan of %s.\n", when)
+			return
+		}
+		o.ConsolePrintf("Changes since the scan of %s:\n", when)
+	}
+	if len(sd.added) != 0 {
+		o.ConsolePrintf("New concerns: %d\n", len(sd.added))
+		for _, sc := range sd.added {
+			o.ConsolePrintf("* %s: [%s] %s\n", sc.location(), sc.Concern, sc.Message)
+		}
+	}
+	if len(sd.resolved) != 0 {
+		o.ConsolePrintf("Resolved concerns: %d\n", len(sd.resolved))
+		for _, sc := range sd.resolved {
+			o.ConsolePrintf("* %s: [%s] %s\n", sc.location(), sc.Concern, sc.Message)
+		}
+	}
+	if len(sd.changed) != 0 {
+		o.ConsolePrintf("Changed concerns: %d\n", len(sd.changed))
+		for _, cc := range sd.changed {
+			o.ConsolePrintf("* %s: [%s]\n", cc.now[0].location(), cc.now[0].Concern)
+			for _, sc := range cc.was {
+				o.ConsolePrintf("  was: %s\n", sc.Message)
+			}
+			for _, sc := range cc.now {
+				o.ConsolePrintf("  now: %s\n", sc.Message)
+			}
+		}
+	}
+}
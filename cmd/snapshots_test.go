@@ -0,0 +1,439 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+func Test_newConcernSnapshot(t *testing.T) {
+	now := time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC)
+	cArs := createConcernedArtists(generateArtists(1, 1, 2, nil))
+	cArs[0].addConcern(emptyConcern, "no albums found")
+	cAl := cArs[0].albums()[0]
+	cAl.addConcern(numberingConcern, "missing track 3")
+	cAl.tracks()[1].addConcern(filesConcern, "metadata does not agree with track number 2")
+	got := newConcernSnapshot(cArs, []string{"empty", "files", "numbering"}, now)
+	want := &concernSnapshot{
+		Time:  now,
+		Scans: []string{"empty", "files", "numbering"},
+		Concerns: []snapshotConcern{
+			{Artist: "my artist 0", Concern: "empty", Message: "no albums found"},
+			{Artist: "my artist 0", Album: "my album 00", Concern: "numbering", Message: "missing track 3"},
+			{
+				Artist:  "my artist 0",
+				Album:   "my album 00",
+				Track:   "my track 002",
+				Concern: "files",
+				Message: "metadata does not agree with track number 2",
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("newConcernSnapshot() = %v, want %v", got, want)
+	}
+}
+
+func Test_concernSnapshot_save(t *testing.T) {
+	originalApplicationPath := applicationPath
+	originalMkdirAll := mkdirAll
+	originalWriteFile := writeFile
+	defer func() {
+		applicationPath = originalApplicationPath
+		mkdirAll = originalMkdirAll
+		writeFile = originalWriteFile
+	}()
+	applicationPath = func() string { return "appData" }
+	dir := filepath.Join("appData", "snapshots")
+	path := filepath.Join(dir, "scan-20261018-020000.json")
+	snapshot := &concernSnapshot{
+		Time:     time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC),
+		Scans:    []string{"files"},
+		Concerns: []snapshotConcern{{Artist: "a", Concern: "files", Message: "m"}},
+	}
+	tests := map[string]struct {
+		mkdirAll    func(string, fs.FileMode) error
+		writeFile   func(string, []byte, fs.FileMode) error
+		wantContent string
+		wantErr     bool
+		output.WantedRecording
+	}{
+		"success": {
+			mkdirAll: func(string, fs.FileMode) error { return nil },
+			wantContent: "" +
+				"{\n" +
+				"  \"time\": \"2026-10-18T02:00:00Z\",\n" +
+				"  \"scans\": [\n" +
+				"    \"files\"\n" +
+				"  ],\n" +
+				"  \"concerns\": [\n" +
+				"    {\n" +
+				"      \"artist\": \"a\",\n" +
+				"      \"concern\": \"files\",\n" +
+				"      \"message\": \"m\"\n" +
+				"    }\n" +
+				"  ]\n" +
+				"}",
+			WantedRecording: output.WantedRecording{
+				Console: fmt.Sprintf("Scan snapshot saved to %q.\n", path),
+			},
+		},
+		"cannot create directory": {
+			mkdirAll: func(string, fs.FileMode) error { return errors.New("access denied") },
+			wantErr:  true,
+			WantedRecording: output.WantedRecording{
+				Error: fmt.Sprintf("The directory %q cannot be created: 'access denied'.\n", dir),
+				Log: "" +
+					"level='error'" +
+					" command='scan'" +
+					" directory='" + dir + "'" +
+					" error='access denied'" +
+					" msg='cannot create directory'\n",
+			},
+		},
+		"cannot write file": {
+			mkdirAll:  func(string, fs.FileMode) error { return nil },
+			writeFile: func(string, []byte, fs.FileMode) error { return errors.New("disk full") },
+			wantErr:   true,
+			WantedRecording: output.WantedRecording{
+				Error: fmt.Sprintf("The file %q cannot be created: 'disk full'.\n", path),
+				Log: "" +
+					"level='error'" +
+					" command='scan'" +
+					" error='disk full'" +
+					" fileName='" + path + "'" +
+					" msg='cannot create file'\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			mkdirAll = tt.mkdirAll
+			gotContent := ""
+			writeFile = func(name string, content []byte, perm fs.FileMode) error {
+				if tt.writeFile != nil {
+					return tt.writeFile(name, content, perm)
+				}
+				if name != path {
+					t.Errorf("concernSnapshot.save() wrote %q, want %q", name, path)
+				}
+				gotContent = string(content)
+				return nil
+			}
+			o := output.NewRecorder()
+			if got := snapshot.save(o); (got != nil) != tt.wantErr {
+				t.Errorf("concernSnapshot.save() = %v, wantErr %v", got, tt.wantErr)
+			}
+			if gotContent != tt.wantContent {
+				t.Errorf("concernSnapshot.save() content = %q, want %q", gotContent, tt.wantContent)
+			}
+			o.Report(t, "concernSnapshot.save()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_loadLatestSnapshot(t *testing.T) {
+	originalApplicationPath := applicationPath
+	originalDirExists := dirExists
+	originalReadDirectory := readDirectory
+	originalReadFile := readFile
+	defer func() {
+		applicationPath = originalApplicationPath
+		dirExists = originalDirExists
+		readDirectory = originalReadDirectory
+		readFile = originalReadFile
+	}()
+	applicationPath = func() string { return "appData" }
+	latest := filepath.Join("appData", "snapshots", "scan-20261018-020000.json")
+	snapshotFiles := []fs.FileInfo{
+		newTestFile("scan-20261017-020000.json", nil),
+		newTestFile("scan-20261018-020000.json", nil),
+		newTestFile("notes.txt", nil),
+		newTestFile("scan-20261019-020000.json", []*testFile{newTestFile("x", nil)}),
+	}
+	tests := map[string]struct {
+		dirExists     bool
+		readDirectory func(output.Bus, string) ([]fs.FileInfo, bool)
+		content       string
+		readErr       error
+		want          *concernSnapshot
+		wantOk        bool
+		output.WantedRecording
+	}{
+		"no directory": {
+			dirExists: false,
+			wantOk:    true,
+		},
+		"unreadable directory": {
+			dirExists:     true,
+			readDirectory: func(output.Bus, string) ([]fs.FileInfo, bool) { return nil, false },
+			wantOk:        false,
+		},
+		"no snapshots": {
+			dirExists: true,
+			readDirectory: func(output.Bus, string) ([]fs.FileInfo, bool) {
+				return []fs.FileInfo{newTestFile("notes.txt", nil)}, true
+			},
+			wantOk: true,
+		},
+		"latest snapshot": {
+			dirExists:     true,
+			readDirectory: func(output.Bus, string) ([]fs.FileInfo, bool) { return snapshotFiles, true },
+			content:       `{"time":"2026-10-18T02:00:00Z","scans":["files"],"concerns":[]}`,
+			want: &concernSnapshot{
+				Time:     time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC),
+				Scans:    []string{"files"},
+				Concerns: []snapshotConcern{},
+			},
+			wantOk: true,
+		},
+		"corrupt snapshot": {
+			dirExists:     true,
+			readDirectory: func(output.Bus, string) ([]fs.FileInfo, bool) { return snapshotFiles, true },
+			content:       `{"time":`,
+			wantOk:        false,
+			WantedRecording: output.WantedRecording{
+				Error: fmt.Sprintf("The scan snapshot %q cannot be read: '*json.SyntaxError: unexpected end of "+
+					"JSON input'.\n", latest),
+				Log: "" +
+					"level='error'" +
+					" command='scan'" +
+					" error='unexpected end of JSON input'" +
+					" snapshot='" + latest + "'" +
+					" msg='cannot read scan snapshot'\n",
+			},
+		},
+		"unreadable snapshot": {
+			dirExists:     true,
+			readDirectory: func(output.Bus, string) ([]fs.FileInfo, bool) { return snapshotFiles, true },
+			readErr:       errors.New("access denied"),
+			wantOk:        false,
+			WantedRecording: output.WantedRecording{
+				Error: fmt.Sprintf("The scan snapshot %q cannot be read: 'access denied'.\n", latest),
+				Log: "" +
+					"level='error'" +
+					" command='scan'" +
+					" error='access denied'" +
+					" snapshot='" + latest + "'" +
+					" msg='cannot read scan snapshot'\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dirExists = func(string) bool { return tt.dirExists }
+			readDirectory = tt.readDirectory
+			readFile = func(path string) ([]byte, error) {
+				if path != latest {
+					t.Errorf("loadLatestSnapshot() read %q, want %q", path, latest)
+				}
+				return []byte(tt.content), tt.readErr
+			}
+			o := output.NewRecorder()
+			got, gotOk := loadLatestSnapshot(o)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadLatestSnapshot() got = %v, want %v", got, tt.want)
+			}
+			if gotOk != tt.wantOk {
+				t.Errorf("loadLatestSnapshot() gotOk = %v, want %v", gotOk, tt.wantOk)
+			}
+			o.Report(t, "loadLatestSnapshot()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_concernSnapshot_diff(t *testing.T) {
+	previous := &concernSnapshot{
+		Scans: []string{"files", "numbering"},
+		Concerns: []snapshotConcern{
+			{Artist: "a", Album: "b", Concern: "numbering", Message: "missing track 3"},
+			{Artist: "a", Album: "b", Track: "t1", Concern: "files", Message: "old problem"},
+			{Artist: "a", Album: "c", Concern: "numbering", Message: "missing track 2"},
+			{Artist: "z", Concern: "files", Message: "unchanged"},
+		},
+	}
+	current := &concernSnapshot{
+		Scans: []string{"empty", "files", "numbering"},
+		Concerns: []snapshotConcern{
+			{Artist: "a", Album: "b", Concern: "numbering", Message: "missing track 3"},
+			{Artist: "a", Album: "b", Track: "t1", Concern: "files", Message: "new problem"},
+			{Artist: "a", Album: "b", Track: "t2", Concern: "files", Message: "brand new"},
+			{Artist: "e", Concern: "empty", Message: "no albums found"},
+			{Artist: "z", Concern: "files", Message: "unchanged"},
+		},
+	}
+	got := current.diff(previous)
+	want := &snapshotDiff{
+		added:    []snapshotConcern{{Artist: "a", Album: "b", Track: "t2", Concern: "files", Message: "brand new"}},
+		resolved: []snapshotConcern{{Artist: "a", Album: "c", Concern: "numbering", Message: "missing track 2"}},
+		changed: []changedConcern{
+			{
+				was: []snapshotConcern{{Artist: "a", Album: "b", Track: "t1", Concern: "files", Message: "old problem"}},
+				now: []snapshotConcern{{Artist: "a", Album: "b", Track: "t1", Concern: "files", Message: "new problem"}},
+			},
+		},
+		uncompared: []string{"empty"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("concernSnapshot.diff() = %v, want %v", got, want)
+	}
+}
+
+func Test_snapshotDiff_report(t *testing.T) {
+	previous := &concernSnapshot{Time: time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC)}
+	tests := map[string]struct {
+		sd       *snapshotDiff
+		previous *concernSnapshot
+		output.WantedRecording
+	}{
+		"no previous snapshot, no concerns": {
+			sd: &snapshotDiff{},
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"There is no previous scan snapshot; all concerns are new.\n" +
+					"No concerns were found.\n",
+			},
+		},
+		"no previous snapshot": {
+			sd: &snapshotDiff{added: []snapshotConcern{{Artist: "a", Concern: "empty", Message: "no albums"}}},
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"There is no previous scan snapshot; all concerns are new.\n" +
+					"New concerns: 1\n" +
+					"* Artist \"a\": [empty] no albums\n",
+			},
+		},
+		"no changes": {
+			sd:       &snapshotDiff{uncompared: []string{"portability"}},
+			previous: previous,
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"The scan of 2026-10-17 02:00:00 did not look for portability concerns; they are not compared.\n" +
+					"No concerns are new, resolved, or changed since the scan of 2026-10-17 02:00:00.\n",
+			},
+		},
+		"changes": {
+			sd: &snapshotDiff{
+				added: []snapshotConcern{
+					{Artist: "a", Album: "b", Track: "t2", Concern: "files", Message: "brand new"},
+				},
+				resolved: []snapshotConcern{
+					{Artist: "a", Album: "c", Concern: "numbering", Message: "missing track 2"},
+				},
+				changed: []changedConcern{
+					{
+						was: []snapshotConcern{{Artist: "a", Album: "b", Track: "t1", Concern: "files", Message: "old"}},
+						now: []snapshotConcern{
+							{Artist: "a", Album: "b", Track: "t1", Concern: "files", Message: "new 1"},
+							{Artist: "a", Album: "b", Track: "t1", Concern: "files", Message: "new 2"},
+						},
+					},
+				},
+			},
+			previous: previous,
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"Changes since the scan of 2026-10-17 02:00:00:\n" +
+					"New concerns: 1\n" +
+					"* Artist \"a\" Album \"b\" Track \"t2\": [files] brand new\n" +
+					"Resolved concerns: 1\n" +
+					"* Artist \"a\" Album \"c\": [numbering] missing track 2\n" +
+					"Changed concerns: 1\n" +
+					"* Artist \"a\" Album \"b\" Track \"t1\": [files]\n" +
+					"  was: old\n" +
+					"  now: new 1\n" +
+					"  now: new 2\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			tt.sd.report(o, tt.previous)
+			o.Report(t, "snapshotDiff.report()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_scanSettings_processSnapshot(t *testing.T) {
+	originalApplicationPath := applicationPath
+	originalDirExists := dirExists
+	originalReadDirectory := readDirectory
+	originalMkdirAll := mkdirAll
+	originalWriteFile := writeFile
+	defer func() {
+		applicationPath = originalApplicationPath
+		dirExists = originalDirExists
+		readDirectory = originalReadDirectory
+		mkdirAll = originalMkdirAll
+		writeFile = originalWriteFile
+	}()
+	applicationPath = func() string { return "appData" }
+	mkdirAll = func(string, fs.FileMode) error { return nil }
+	writeFile = func(string, []byte, fs.FileMode) error { return nil }
+	path := filepath.Join("appData", "snapshots", "scan-20261018-020000.json")
+	current := &concernSnapshot{
+		Time:     time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC),
+		Scans:    []string{"empty"},
+		Concerns: []snapshotConcern{{Artist: "a", Concern: "empty", Message: "no albums"}},
+	}
+	tests := map[string]struct {
+		scanSets      *scanSettings
+		dirExists     bool
+		readDirectory func(output.Bus, string) ([]fs.FileInfo, bool)
+		want          *cmdtoolkit.ExitError
+		output.WantedRecording
+	}{
+		"save only": {
+			scanSets: &scanSettings{snapshot: cmdtoolkit.CommandFlag[bool]{Value: true}},
+			WantedRecording: output.WantedRecording{
+				Console: fmt.Sprintf("Scan snapshot saved to %q.\n", path),
+			},
+		},
+		"compare and save": {
+			scanSets: &scanSettings{
+				snapshot:  cmdtoolkit.CommandFlag[bool]{Value: true},
+				sinceLast: cmdtoolkit.CommandFlag[bool]{Value: true},
+			},
+			dirExists: false,
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"There is no previous scan snapshot; all concerns are new.\n" +
+					"New concerns: 1\n" +
+					"* Artist \"a\": [empty] no albums\n" +
+					fmt.Sprintf("Scan snapshot saved to %q.\n", path),
+			},
+		},
+		"cannot compare": {
+			scanSets: &scanSettings{
+				snapshot:  cmdtoolkit.CommandFlag[bool]{Value: true},
+				sinceLast: cmdtoolkit.CommandFlag[bool]{Value: true},
+			},
+			dirExists:     true,
+			readDirectory: func(output.Bus, string) ([]fs.FileInfo, bool) { return nil, false },
+			want:          cmdtoolkit.NewExitSystemError(scanCommand),
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dirExists = func(string) bool { return tt.dirExists }
+			readDirectory = tt.readDirectory
+			o := output.NewRecorder()
+			if got := tt.scanSets.processSnapshot(o, current); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scanSettings.processSnapshot() = %v, want %v", got, tt.want)
+			}
+			o.Report(t, "scanSettings.processSnapshot()", tt.WantedRecording)
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"mp3repair/internal/files"
+	"slices"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+
+	"github.com/majohn-r/output"
+	"github.com/spf13/cobra"
+)
+
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+const (
+	statsCommandName = "stats"
+	statsJSON        = "json"
+	statsJSONFlag    = "--" + statsJSON
+	statsUnknown     = "unknown"
+	tagsBoth         = "ID3V1 and ID3V2"
+	tagsID3V1Only    = "ID3V1 only"
+	tagsID3V2Only    = "ID3V2 only"
+	tagsNeither      = "neither"
+)
+
+var (
+	statsCmd = &cobra.Command{
+		Use:                   statsCommandName + " [" + statsJSONFlag + "] " + searchUsage + " " + ioUsage,
+		DisableFlagsInUseLine: true,
+		Short:                 "Summarizes the selected tracks",
+		Long: "" +
+			fmt.Sprintf("%q summarizes the tracks selected by the search filters\n", statsCommandName) +
+			"\n" +
+			"The summary includes the number of artists, albums, and tracks; the distribution of\n" +
+			"genres and decades; which tracks have ID3V1 metadata, ID3V2 metadata, or both; the\n" +
+			"mix of ID3V2 versions and encodings; how many tracks have a music CD identifier; and\n" +
+			"the total size of the track files.",
+		Example: statsCommandName + " " + searchArtistFilterFlag + " \"^The Beatles$\"\n" +
+			"  Summarize the Beatles' tracks\n" +
+			statsCommandName + " " + statsJSONFlag + "\n" +
+			"  Summarize all tracks as JSON",
+		RunE: statsRun,
+	}
+	statsFlags = &cmdtoolkit.FlagSet{
+		Name: statsCommandName,
+		Details: map[string]*cmdtoolkit.FlagDetails{
+			statsJSON: {
+				Usage:        "output the summary as JSON",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+		},
+	}
+)
+
+func statsRun(cmd *cobra.Command, _ []string) error {
+	exitError := cmdtoolkit.NewExitProgrammingError(statsCommandName)
+	o := getBus()
+	ctx := commandContext(cmd)
+	producer := cmd.Flags()
+	values, eSlice := cmdtoolkit.ReadFlags(producer, statsFlags)
+	ss, searchFlagsOk := evaluateSearchFlags(o, producer)
+	ios, ioFlagsOk := evaluateIOFlags(o, producer)
+	if cmdtoolkit.ProcessFlagErrors(o, eSlice) && searchFlagsOk && ioFlagsOk {
+		if sts, flagsOk := processStatsFlags(o, values); flagsOk {
+			exitError = sts.summarize(ctx, o, ss.load(ctx, o), ss, ios)
+		}
+	}
+	return cmdtoolkit.ToErrorInterface(exitError)
+}
+
+type statsSettings struct {
+	json cmdtoolkit.CommandFlag[bool]
+}
+
+// libraryStats summarizes a collection of tracks; the field names are used in
+// the JSON output
+type libraryStats struct {
+	Artists                 int            `json:"artists"`
+	Albums                  int            `json:"albums"`
+	Tracks                  int            `json:"tracks"`
+	TotalSize               int64          `json:"totalSize"`
+	Genres                  map[string]int `json:"genres"`
+	Decades                 map[string]int `json:"decades"`
+	Tags                    map[string]int `json:"tags"`
+	ID3V2Versions           map[string]int `json:"id3v2Versions"`
+	ID3V2Encodings          map[string]int `json:"id3v2Encodings"`
+	TracksWithCDIdentifiers int            `json:"tracksWithMCDI"`
+	AlbumsWithCDIdentifiers int            `json:"albumsWithMCDI"`
+	UnreadableFiles         int            `json:"unreadableFiles,omitempty"`
+}
+
+func newLibraryStats() *libraryStats {
+	return &libraryStats{
+		Genres:         map[string]int{},
+		Decades:        map[string]int{},
+		Tags:           map[string]int{},
+		ID3V2Versions:  map[string]int{},
+		ID3V2Encodings: map[string]int{},
+	}
+}
+
+func (sts *statsSettings) summarize(
+	ctx context.Context,
+	o output.Bus,
+	allArtists []*files.Artist,
+	ss *searchSettings,
+	ios *ioSettings,
+) (e *cmdtoolkit.ExitError) {
+	e = cmdtoolkit.NewExitUserError(statsCommandName)
+	if len(allArtists) != 0 {
+		if filteredArtists := ss.filter(o, allArtists); len(filteredArtists) != 0 {
+			readMetadata(ctx, o, filteredArtists, ios.openFileLimit)
+			if ctx.Err() != nil {
+				return nil
+			}
+			e = sts.report(o, collectStats(filteredArtists))
+		}
+	}
+	return
+}
+
+func collectStats(artists []*files.Artist) *libraryStats {
+	stats := newLibraryStats()
+	stats.Artists = len(artists)
+	for _, artist := range artists {
+		stats.Albums += len(artist.Albums())
+		for _, album := range artist.Albums() {
+			albumHasCDIdentifier := false
+			for _, track := range album.Tracks() {
+				stats.addTrack(track)
+				if track.HasCDIdentifier() {
+					albumHasCDIdentifier = true
+				}
+			}
+			if albumHasCDIdentifier {
+				stats.AlbumsWithCDIdentifiers++
+			}
+		}
+	}
+	return stats
+}
+
+func (stats *libraryStats) addTrack(track *files.Track) {
+	stats.Tracks++
+	if info, statErr := stat(track.Path()); statErr == nil {
+		stats.TotalSize += info.Size()
+	} else {
+		stats.UnreadableFiles++
+	}
+	genre := track.Genre()
+	if genre == "" {
+		genre = statsUnknown
+	}
+	stats.Genres[genre]++
+	decade := statsUnknown
+	if year, found := parseYear(track.Year()); found {
+		decade = fmt.Sprintf("%ds", year-year%10)
+	}
+	stats.Decades[decade]++
+	hasID3V1 := track.HasMetadata(files.ID3V1)
+	hasID3V2 := track.HasMetadata(files.ID3V2)
+	switch {
+	case hasID3V1 && hasID3V2:
+		stats.Tags[tagsBoth]++
+	case hasID3V1:
+		stats.Tags[tagsID3V1Only]++
+	case hasID3V2:
+		stats.Tags[tagsID3V2Only]++
+	default:
+		stats.Tags[tagsNeither]++
+	}
+	if version, encoding, ok := track.ID3V2Format(); ok {
+		stats.ID3V2Versions[fmt.Sprintf("ID3V2.%d", version)]++
+		stats.ID3V2Encodings[encoding]++
+	}
+	if track.HasCDIdentifier() {
+		stats.TracksWithCDIdentifiers++
+	}
+}
+
+func (sts *statsSettings) report(o output.Bus, stats *libraryStats) *cmdtoolkit.ExitError {
+	if sts.json.Value {
+		// marshaling cannot fail: the statistics contain only strings and integers
+		content, _ := json.MarshalIndent(stats, "", "  ")
+		o.ConsolePrintln(string(content))
+		return nil
+	}
+	o.ConsolePrintf("Artists: %d\n", stats.Artists)
+	o.ConsolePrintf("Albums: %d\n", stats.Albums)
+	o.ConsolePrintf("Tracks: %d\n", stats.Tracks)
+	o.ConsolePrintf("Total size: %s\n", formatSize(stats.TotalSize))
+	if stats.UnreadableFiles != 0 {
+		o.ConsolePrintf("Tracks whose size could not be read: %d\n", stats.UnreadableFiles)
+	}
+	o.ConsolePrintf("Albums with a music CD identifier: %d of %d\n", stats.AlbumsWithCDIdentifiers, stats.Albums)
+	o.ConsolePrintf("Tracks with a music CD identifier: %d of %d\n", stats.TracksWithCDIdentifiers, stats.Tracks)
+	reportDistribution(o, "Metadata", stats.Tags)
+	reportDistribution(o, "ID3V2 versions", stats.ID3V2Versions)
+	reportDistribution(o, "ID3V2 encodings", stats.ID3V2Encodings)
+	reportDistribution(o, "Genres", stats.Genres)
+	reportDistribution(o, "Decades", stats.Decades)
+	return nil
+}
+
+func reportDistribution(o output.Bus, heading string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+	o.ConsolePrintf("%s:\n", heading)
+	o.IncrementTab(2)
+	for _, key := range slices.Sorted(maps.Keys(counts)) {
+		o.ConsolePrintf("%s: %d\n", key, counts[key])
+	}
+	o.DecrementTab(2)
+}
+
+// formatSize renders a size in bytes using binary units
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d bytes", size)
+	}
+	value := float64(size)
+	suffixes := []string{"KiB", "MiB", "GiB", "TiB"}
+	k := -1
+	for value >= unit && k < len(suffixes)-1 {
+		value /= unit
+		k++
+	}
+	return fmt.Sprintf("%.1f %s (%d bytes)", value, suffixes[k], size)
+}
+
+func processStatsFlags(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any]) (*statsSettings, bool) {
+	sts := &statsSettings{}
+	flagsOk := true // optimistic
+	var flagErr error
+	if sts.json, flagErr = cmdtoolkit.GetBool(o, values, statsJSON); flagErr != nil {
+		flagsOk = false
+	}
+	return sts, flagsOk
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+	cmdtoolkit.AddDefaults(statsFlags)
+	cmdtoolkit.AddFlags(getBus(), getConfiguration(), statsCmd.Flags(), statsFlags, searchFlags, ioFlags)
+}
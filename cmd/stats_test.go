@@ -0,0 +1,302 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"io/fs"
+	"mp3repair/internal/files"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+type fakeFileInfo struct {
+	size int64
+}
+
+func (f fakeFileInfo) Name() string       { return "track.mp3" }
+func (f fakeFileInfo) Size() int64        { return f.size }
+func (f fakeFileInfo) Mode() fs.FileMode  { return 0o644 }
+func (f fakeFileInfo) ModTime() time.Time { return time.Time{} }
+func (f fakeFileInfo) IsDir() bool        { return false }
+func (f fakeFileInfo) Sys() any           { return nil }
+
+func Test_processStatsFlags(t *testing.T) {
+	tests := map[string]struct {
+		values map[string]*cmdtoolkit.CommandFlag[any]
+		want   *statsSettings
+		want1  bool
+		output.WantedRecording
+	}{
+		"no data": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{},
+			want:   &statsSettings{},
+			want1:  false,
+			WantedRecording: output.WantedRecording{
+				Error: "An internal error occurred: flag \"json\" is not found.\n",
+				Log:   "level='error' error='flag not found' flag='json' msg='internal error'\n",
+			},
+		},
+		"json": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{statsJSON: {Value: true, UserSet: true}},
+			want:   &statsSettings{json: cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true}},
+			want1:  true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			got, got1 := processStatsFlags(o, tt.values)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("processStatsFlags() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("processStatsFlags() got1 = %v, want %v", got1, tt.want1)
+			}
+			o.Report(t, "processStatsFlags()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_collectStats(t *testing.T) {
+	originalStat := stat
+	defer func() {
+		stat = originalStat
+	}()
+	stat = func(name string) (fs.FileInfo, error) {
+		if filepath.Base(name) == "03 missing.mp3" {
+			return nil, fs.ErrNotExist
+		}
+		return fakeFileInfo{size: 1000}, nil
+	}
+	artist := files.NewArtist("The Beatles", filepath.Join("Music", "The Beatles"))
+	abbeyRoad := files.AlbumMaker{
+		Title:     "Abbey Road",
+		Artist:    artist,
+		Directory: filepath.Join("Music", "The Beatles", "Abbey Road"),
+	}.NewAlbum(true)
+	files.TrackMaker{
+		Album:      abbeyRoad,
+		FileName:   "01 Come Together.mp3",
+		SimpleName: "Come Together",
+		Number:     1,
+		Metadata: (&files.TrackMetadataMaker{
+			Genre:        "Rock",
+			Year:         "1969",
+			CDIdentifier: []byte("mcdi"),
+			Source:       files.ID3V2,
+			ID3V2Version: 3,
+		}).MakeMetadata(),
+	}.NewTrack(true)
+	files.TrackMaker{
+		Album:      abbeyRoad,
+		FileName:   "02 Something.mp3",
+		SimpleName: "Something",
+		Number:     2,
+		Metadata: (&files.TrackMetadataMaker{
+			Genre:        "Rock",
+			Year:         "1969-09-26",
+			Source:       files.ID3V2,
+			ID3V2Version: 3,
+		}).MakeMetadata(),
+	}.NewTrack(true)
+	files.TrackMaker{
+		Album:      abbeyRoad,
+		FileName:   "03 missing.mp3",
+		SimpleName: "missing",
+		Number:     3,
+	}.NewTrack(true)
+	files.AlbumMaker{
+		Title:     "Let It Be",
+		Artist:    artist,
+		Directory: filepath.Join("Music", "The Beatles", "Let It Be"),
+	}.NewAlbum(true)
+	want := &libraryStats{
+		Artists:                 1,
+		Albums:                  2,
+		Tracks:                  3,
+		TotalSize:               2000,
+		Genres:                  map[string]int{"Rock": 2, "unknown": 1},
+		Decades:                 map[string]int{"1960s": 2, "unknown": 1},
+		Tags:                    map[string]int{"ID3V1 and ID3V2": 2, "neither": 1},
+		ID3V2Versions:           map[string]int{"ID3V2.3": 2},
+		ID3V2Encodings:          map[string]int{"ISO-8859-1": 2},
+		TracksWithCDIdentifiers: 1,
+		AlbumsWithCDIdentifiers: 1,
+		UnreadableFiles:         1,
+	}
+	if got := collectStats([]*files.Artist{artist}); !reflect.DeepEqual(got, want) {
+		t.Errorf("collectStats() = %v, want %v", got, want)
+	}
+}
+
+func Test_statsSettings_report(t *testing.T) {
+	stats := &libraryStats{
+		Artists:                 1,
+		Albums:                  2,
+		Tracks:                  3,
+		TotalSize:               3 * 1024 * 1024,
+		Genres:                  map[string]int{"Rock": 2, "unknown": 1},
+		Decades:                 map[string]int{"1960s": 2, "unknown": 1},
+		Tags:                    map[string]int{"ID3V1 and ID3V2": 2, "neither": 1},
+		ID3V2Versions:           map[string]int{"ID3V2.3": 2},
+		ID3V2Encodings:          map[string]int{"ISO-8859-1": 2},
+		TracksWithCDIdentifiers: 1,
+		AlbumsWithCDIdentifiers: 1,
+	}
+	tests := map[string]struct {
+		sts *statsSettings
+		output.WantedRecording
+	}{
+		"human": {
+			sts: &statsSettings{},
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"Artists: 1\n" +
+					"Albums: 2\n" +
+					"Tracks: 3\n" +
+					"Total size: 3.0 MiB (3145728 bytes)\n" +
+					"Albums with a music CD identifier: 1 of 2\n" +
+					"Tracks with a music CD identifier: 1 of 3\n" +
+					"Metadata:\n" +
+					"  ID3V1 and ID3V2: 2\n" +
+					"  neither: 1\n" +
+					"ID3V2 versions:\n" +
+					"  ID3V2.3: 2\n" +
+					"ID3V2 encodings:\n" +
+					"  ISO-8859-1: 2\n" +
+					"Genres:\n" +
+					"  Rock: 2\n" +
+					"  unknown: 1\n" +
+					"Decades:\n" +
+					"  1960s: 2\n" +
+					"  unknown: 1\n",
+			},
+		},
+		"json": {
+			sts: &statsSettings{json: cmdtoolkit.CommandFlag[bool]{Value: true}},
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"{\n" +
+					"  \"artists\": 1,\n" +
+					"  \"albums\": 2,\n" +
+					"  \"tracks\": 3,\n" +
+					"  \"totalSize\": 3145728,\n" +
+					"  \"genres\": {\n" +
+					"    \"Rock\": 2,\n" +
+					"    \"unknown\": 1\n" +
+					"  },\n" +
+					"  \"decades\": {\n" +
+					"    \"1960s\": 2,\n" +
+					"    \"unknown\": 1\n" +
+					"  },\n" +
+					"  \"tags\": {\n" +
+					"    \"ID3V1 and ID3V2\": 2,\n" +
+					"    \"neither\": 1\n" +
+					"  },\n" +
+					"  \"id3v2Versions\": {\n" +
+					"    \"ID3V2.3\": 2\n" +
+					"  },\n" +
+					"  \"id3v2Encodings\": {\n" +
+					"    \"ISO-8859-1\": 2\n" +
+					"  },\n" +
+					"  \"tracksWithMCDI\": 1,\n" +
+					"  \"albumsWithMCDI\": 1\n" +
+					"}\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			if got := tt.sts.report(o, stats); got != nil {
+				t.Errorf("statsSettings.report() = %v, want nil", got)
+			}
+			o.Report(t, "statsSettings.report()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_formatSize(t *testing.T) {
+	tests := map[string]struct {
+		size int64
+		want string
+	}{
+		"bytes":     {size: 1023, want: "1023 bytes"},
+		"kibibytes": {size: 1536, want: "1.5 KiB (1536 bytes)"},
+		"gibibytes": {size: 5 * 1024 * 1024 * 1024, want: "5.0 GiB (5368709120 bytes)"},
+		"huge":      {size: 2048 * 1024 * 1024 * 1024 * 1024, want: "2048.0 TiB (2251799813685248 bytes)"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := formatSize(tt.size); got != tt.want {
+				t.Errorf("formatSize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_stats_Help(t *testing.T) {
+	originalSearchFlags := searchFlags
+	originalMusicDir := xdg.UserDirs.Music
+	defer func() {
+		searchFlags = originalSearchFlags
+		xdg.UserDirs.Music = originalMusicDir
+	}()
+	searchFlags = safeSearchFlags
+	xdg.UserDirs.Music = "."
+	commandUnderTest := cloneCommand(statsCmd)
+	cmdtoolkit.AddFlags(output.NewNilBus(), cmdtoolkit.EmptyConfiguration(),
+		commandUnderTest.Flags(), statsFlags, searchFlags, ioFlags)
+	tests := map[string]struct {
+		output.WantedRecording
+	}{
+		"good": {
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"\"stats\" summarizes the tracks selected by the search filters\n" +
+					"\n" +
+					"The summary includes the number of artists, albums, and tracks; the distribution of\n" +
+					"genres and decades; which tracks have ID3V1 metadata, ID3V2 metadata, or both; the\n" +
+					"mix of ID3V2 versions and encodings; how many tracks have a music CD identifier; and\n" +
+					"the total size of the track files.\n" +
+					"\n" +
+					"Usage:\n" +
+					"  stats [--json] [--albumFilter regex] [--artistFilter regex] [--trackFilter regex] [--extensions " +
+					"extensions] [--maxOpenFiles count]\n" +
+					"\n" +
+					"Examples:\n" +
+					"stats --artistFilter \"^The Beatles$\"\n" +
+					"  Summarize the Beatles' tracks\n" +
+					"stats --json\n" +
+					"  Summarize all tracks as JSON\n" +
+					"\n" +
+					"Flags:\n" +
+					"      --albumFilter string    regular expression specifying which albums to select (default \".*\")\n" +
+					"      --artistFilter string   regular expression specifying which artists to select (default \".*\")\n" +
+					"      --extensions string     comma-delimited list of file extensions used by mp3 files (default " +
+					"\".mp3\")\n" +
+					"      --json                  output the summary as JSON (default false)\n" +
+					"      --maxOpenFiles int      the maximum number of files that can be read simultaneously (at least " +
+					"1, at most 32767, default 1000) (default 1000)\n" +
+					"      --trackFilter string    regular expression specifying which tracks to select (default \".*\")\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			command := commandUnderTest
+			enableCommandRecording(o, command)
+			_ = command.Help()
+			o.Report(t, "stats Help()", tt.WantedRecording)
+		})
+	}
+}
@@ -0,0 +1,319 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"mp3repair/internal/files"
+	"slices"
+	"strings"
+	"time"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	suppressionsFile     = "suppressions"
+	suppressionsFileFlag = "--" + suppressionsFile
+	suppressionsUsage    = "the path of a YAML file listing concerns that are known and accepted; if empty, no " +
+		"concerns are suppressed"
+	suppressionDateLayout = "2006-01-02"
+)
+
+// fieldPhrases identifies the metadata field that a files or metadata conflict
+// concern is about; the phrases come from files.Track.ReportMetadataProblems
+// and findConflictedTracks
+var fieldPhrases = map[files.MetadataField][]string{
+	files.ArtistNameField:   {"does not agree with artist name", "the artist name field"},
+	files.AlbumNameField:    {"does not agree with album name", "the album name field"},
+	files.GenreField:        {"does not agree with album genre", "the genre field"},
+	files.YearField:         {"does not agree with album year", "the year field"},
+	files.TrackNameField:    {"does not agree with track name", "the track name field"},
+	files.TrackNumberField:  {"does not agree with track number", "the track number field"},
+	files.CDIdentifierField: {"does not agree with the MCDI frame", "the music CD identifier field"},
+}
+
+// suppression is an entry in the suppression file
+type suppression struct {
+	Artist  string `yaml:"artist"`
+	Album   string `yaml:"album"`
+	Track   string `yaml:"track"`
+	Concern string `yaml:"concern"`
+	Field   string `yaml:"field"`
+	Reason  string `yaml:"reason"`
+	Expires string `yaml:"expires"`
+
+	concern  concernType
+	field    files.MetadataField
+	hasField bool
+	// the last day on which the suppression applies; zero if it never expires
+	expires time.Time
+	// the number of concerns hidden by the suppression
+	matches int
+}
+
+type suppressions struct {
+	path    string
+	entries []*suppression
+}
+
+// evaluateSuppressions reads the suppression file named by the suppressions
+// flag; it returns nil if no file is named
+func evaluateSuppressions(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any]) (*suppressions, bool) {
+	rawValue, flagErr := cmdtoolkit.GetString(o, values, suppressionsFile)
+	if flagErr != nil {
+		return nil, false
+	}
+	if rawValue.Value == "" {
+		return nil, true
+	}
+	sups, loadErr := loadSuppressions(rawValue.Value)
+	if loadErr != nil {
+		o.ErrorPrintf("The %s value %q cannot be used.\n", suppressionsFileFlag, rawValue.Value)
+		o.ErrorPrintln("Why?")
+		o.ErrorPrintf("The file cannot be read or is not valid: %s.\n", cmdtoolkit.ErrorToString(loadErr))
+		o.ErrorPrintln("What to do:")
+		o.ErrorPrintln("Provide a YAML file containing a list of suppressions, each with an artist, an optional " +
+			"album and track, a concern type, and optionally a field, a reason, and an expiration date " +
+			"(YYYY-MM-DD).")
+		o.ErrorPrintf("The concern types are %s; the fields are %s.\n",
+			strings.Join(suppressibleConcernNames(), ", "), strings.Join(files.MetadataFieldNames(), ", "))
+		o.Log(output.Error, "invalid suppressions", map[string]any{
+			suppressionsFileFlag: rawValue.Value,
+			"user-set":           rawValue.UserSet,
+			"error":              loadErr,
+		})
+		return nil, false
+	}
+	return sups, true
+}
+
+func suppressibleConcernNames() []string {
+	names := make([]string, 0, len(concernNames))
+	for _, name := range concernNames {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func lookupConcernType(name string) (concernType, bool) {
+	for kind, kindName := range concernNames {
+		if kindName == name {
+			return kind, true
+		}
+	}
+	return unspecifiedConcern, false
+}
+
+func loadSuppressions(path string) (*suppressions, error) {
+	content, readErr := readFile(path)
+	if readErr != nil {
+		return nil, readErr
+	}
+	var entries []*suppression
+	if yamlErr := yaml.Unmarshal(content, &entries); yamlErr != nil {
+		return nil, yamlErr
+	}
+	var problems []error
+	for k, entry := range entries {
+		if entryErr := entry.validate(); entryErr != nil {
+			problems = append(problems, fmt.Errorf("entry %d: %w", k+1, entryErr))
+		}
+	}
+	if len(problems) != 0 {
+		return nil, errors.Join(problems...)
+	}
+	return &suppressions{path: path, entries: entries}, nil
+}
+
+func (sup *suppression) validate() error {
+	var found bool
+	switch {
+	case sup.Artist == "":
+		return errors.New("no artist is specified")
+	case sup.Track != "" && sup.Album == "":
+		return errors.New("a track is specified without an album")
+	}
+	if sup.concern, found = lookupConcernType(sup.Concern); !found {
+		return fmt.Errorf("the concern %q is not recognized", sup.Concern)
+	}
+	if sup.Field != "" {
+		if sup.concern != filesConcern && sup.concern != conflictConcern {
+			return fmt.Errorf("a field cannot be specified for %s concerns", sup.Concern)
+		}
+		if sup.field, found = files.LookupMetadataField(sup.Field); !found {
+			return fmt.Errorf("the field %q is not recognized", sup.Field)
+		}
+		sup.hasField = true
+	}
+	if sup.Expires != "" {
+		expires, parseErr := time.ParseInLocation(suppressionDateLayout, sup.Expires, time.Local)
+		if parseErr != nil {
+			return fmt.Errorf("the expiration date %q is not formatted as YYYY-MM-DD", sup.Expires)
+		}
+		sup.expires = expires
+	}
+	return nil
+}
+
+func (sup *suppression) expired(now time.Time) bool {
+	return !sup.expires.IsZero() && !now.Before(sup.expires.AddDate(0, 0, 1))
+}
+
+// scope describes what the suppression applies to
+func (sup *suppression) scope() string {
+	switch {
+	case sup.Track != "":
+		return fmt.Sprintf("track %q on %q by %q", sup.Track, sup.Album, sup.Artist)
+	case sup.Album != "":
+		return fmt.Sprintf("album %q by %q", sup.Album, sup.Artist)
+	default:
+		return fmt.Sprintf("artist %q", sup.Artist)
+	}
+}
+
+func (sup *suppression) description() string {
+	kind := sup.Concern
+	if sup.hasField {
+		kind = fmt.Sprintf("%s (%s)", sup.Concern, sup.Field)
+	}
+	return fmt.Sprintf("%s concerns for %s", kind, sup.scope())
+}
+
+// covers determines whether the suppression applies to the artist, album, and
+// track; an empty album or track name identifies an artist or album concern
+func (sup *suppression) covers(artist, album, track string) bool {
+	switch {
+	case sup.Artist != artist:
+		return false
+	case sup.Album == "":
+		return true
+	case sup.Album != album:
+		return false
+	default:
+		return sup.Track == "" || sup.Track == track
+	}
+}
+
+func (sup *suppression) matchesConcern(kind concernType, concern string) bool {
+	if sup.concern != kind {
+		return false
+	}
+	if !sup.hasField {
+		return true
+	}
+	for _, phrase := range fieldPhrases[sup.field] {
+		if strings.Contains(concern, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// active returns the suppressions that have not expired
+func (sups *suppressions) active(now time.Time) []*suppression {
+	var result []*suppression
+	for _, sup := range sups.entries {
+		if !sup.expired(now) {
+			result = append(result, sup)
+		}
+	}
+	return result
+}
+
+// hide removes suppressed concerns from the concerned artists, and returns the
+// number of concerns removed
+func (sups *suppressions) hide(concernedArtists []*concernedArtist, now time.Time) int {
+	active := sups.active(now)
+	hidden := 0
+	for _, cAr := range concernedArtists {
+		artist := cAr.name()
+		hidden += hideConcerns(cAr.concerns, active, artist, "", "")
+		for _, cAl := range cAr.albums() {
+			album := cAl.name()
+			hidden += hideConcerns(cAl.concerns, active, artist, album, "")
+			for _, cT := range cAl.tracks() {
+				hidden += hideConcerns(cT.concerns, active, artist, album, cT.name())
+			}
+		}
+	}
+	return hidden
+}
+
+func hideConcerns(c concerns, active []*suppression, artist, album, track string) int {
+	hidden := 0
+	for kind, list := range c.concernsCollection {
+		var kept []string
+		for _, concern := range list {
+			suppressed := false
+			for _, sup := range active {
+				if sup.covers(artist, album, track) && sup.matchesConcern(kind, concern) {
+					sup.matches++
+					suppressed = true
+					break
+				}
+			}
+			if suppressed {
+				hidden++
+			} else {
+				kept = append(kept, concern)
+			}
+		}
+		c.concernsCollection[kind] = kept
+	}
+	return hidden
+}
+
+// report writes how many concerns were suppressed, which suppressions have
+// expired, and which suppressions no longer match any of the concerns that
+// were scanned for
+func (sups *suppressions) report(o output.Bus, hidden int, scanned func(*suppression) bool, now time.Time) {
+	if hidden != 0 {
+		o.ConsolePrintf("Suppressed concerns: %d (see %q).\n", hidden, sups.path)
+	}
+	for _, sup := range sups.entries {
+		switch {
+		case sup.expired(now):
+			o.ConsolePrintf("The suppression of %s expired on %s.\n", sup.description(), sup.Expires)
+			o.Log(output.Warning, "suppression expired", map[string]any{
+				"suppression": sup.description(),
+				"expires":     sup.Expires,
+			})
+		case sup.matches == 0 && scanned(sup):
+			o.ConsolePrintf("The suppression of %s is stale: no such concern was found.\n", sup.description())
+			o.Log(output.Warning, "stale suppression", map[string]any{
+				"suppression": sup.description(),
+				"reason":      sup.Reason,
+			})
+		}
+	}
+}
+
+// suppressFields keeps the rewrite command from correcting the metadata fields
+// covered by files and metadata conflict suppressions
+func (sups *suppressions) suppressFields(artists []*files.Artist, now time.Time) {
+	active := sups.active(now)
+	for _, artist := range artists {
+		for _, album := range artist.Albums() {
+			for _, track := range album.Tracks() {
+				for _, sup := range active {
+					if (sup.concern != filesConcern && sup.concern != conflictConcern) ||
+						!sup.covers(artist.Name(), album.Title(), track.Name()) {
+						continue
+					}
+					if sup.hasField {
+						track.SuppressFields(sup.field)
+					} else {
+						track.SuppressFields(files.MetadataFields()...)
+					}
+				}
+			}
+		}
+	}
+}
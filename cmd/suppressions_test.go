@@ -0,0 +1,542 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"errors"
+	"mp3repair/internal/files"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+func Test_loadSuppressions(t *testing.T) {
+	originalReadFile := readFile
+	defer func() {
+		readFile = originalReadFile
+	}()
+	tests := map[string]struct {
+		content  string
+		readErr  error
+		want     *suppressions
+		wantErr  bool
+		errorMsg string
+	}{
+		"unreadable": {
+			readErr:  errors.New("file not found"),
+			wantErr:  true,
+			errorMsg: "file not found",
+		},
+		"not yaml": {
+			content: "artist: [",
+			wantErr: true,
+		},
+		"empty": {
+			content: "",
+			want:    &suppressions{path: "s.yaml"},
+		},
+		"valid": {
+			content: "" +
+				"- artist: a\n" +
+				"  album: b\n" +
+				"  concern: files\n" +
+				"  field: album\n" +
+				"  reason: transliterated\n" +
+				"  expires: 2026-12-31\n" +
+				"- artist: c\n" +
+				"  concern: empty\n",
+			want: &suppressions{
+				path: "s.yaml",
+				entries: []*suppression{
+					{
+						Artist:   "a",
+						Album:    "b",
+						Concern:  "files",
+						Field:    "album",
+						Reason:   "transliterated",
+						Expires:  "2026-12-31",
+						concern:  filesConcern,
+						field:    files.AlbumNameField,
+						hasField: true,
+						expires:  time.Date(2026, 12, 31, 0, 0, 0, 0, time.Local),
+					},
+					{Artist: "c", Concern: "empty", concern: emptyConcern},
+				},
+			},
+		},
+		"invalid entries": {
+			content: "" +
+				"- album: b\n" +
+				"  concern: files\n" +
+				"- artist: a\n" +
+				"  track: t\n" +
+				"  concern: files\n" +
+				"- artist: a\n" +
+				"  concern: bogus\n" +
+				"- artist: a\n" +
+				"  concern: numbering\n" +
+				"  field: year\n" +
+				"- artist: a\n" +
+				"  concern: files\n" +
+				"  field: composer\n" +
+				"- artist: a\n" +
+				"  concern: files\n" +
+				"  expires: 12/31/2026\n",
+			wantErr: true,
+			errorMsg: "" +
+				"entry 1: no artist is specified\n" +
+				"entry 2: a track is specified without an album\n" +
+				"entry 3: the concern \"bogus\" is not recognized\n" +
+				"entry 4: a field cannot be specified for numbering concerns\n" +
+				"entry 5: the field \"composer\" is not recognized\n" +
+				"entry 6: the expiration date \"12/31/2026\" is not formatted as YYYY-MM-DD",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			readFile = func(_ string) ([]byte, error) {
+				return []byte(tt.content), tt.readErr
+			}
+			got, gotErr := loadSuppressions("s.yaml")
+			if (gotErr != nil) != tt.wantErr {
+				t.Errorf("loadSuppressions() error = %v, wantErr %v", gotErr, tt.wantErr)
+				return
+			}
+			if gotErr != nil && tt.errorMsg != "" && gotErr.Error() != tt.errorMsg {
+				t.Errorf("loadSuppressions() error = %q, want %q", gotErr.Error(), tt.errorMsg)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadSuppressions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_evaluateSuppressions(t *testing.T) {
+	originalReadFile := readFile
+	defer func() {
+		readFile = originalReadFile
+	}()
+	readFile = func(path string) ([]byte, error) {
+		if path == "good.yaml" {
+			return []byte("- artist: a\n  concern: empty\n"), nil
+		}
+		return []byte("- artist: a\n  concern: bogus\n"), nil
+	}
+	tests := map[string]struct {
+		values map[string]*cmdtoolkit.CommandFlag[any]
+		want   *suppressions
+		want1  bool
+		output.WantedRecording
+	}{
+		"missing": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{},
+			want1:  false,
+			WantedRecording: output.WantedRecording{
+				Error: "An internal error occurred: flag \"suppressions\" is not found.\n",
+				Log: "" +
+					"level='error'" +
+					" error='flag not found'" +
+					" flag='suppressions'" +
+					" msg='internal error'\n",
+			},
+		},
+		"unset": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{"suppressions": {Value: ""}},
+			want1:  true,
+		},
+		"good": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				"suppressions": {Value: "good.yaml", UserSet: true},
+			},
+			want: &suppressions{
+				path:    "good.yaml",
+				entries: []*suppression{{Artist: "a", Concern: "empty", concern: emptyConcern}},
+			},
+			want1: true,
+		},
+		"bad": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				"suppressions": {Value: "bad.yaml", UserSet: true},
+			},
+			want1: false,
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"The --suppressions value \"bad.yaml\" cannot be used.\n" +
+					"Why?\n" +
+					"The file cannot be read or is not valid: '*errors.joinError: entry 1: the concern \"bogus\" is " +
+					"not recognized'.\n" +
+					"What to do:\n" +
+					"Provide a YAML file containing a list of suppressions, each with an artist, an optional " +
+					"album and track, a concern type, and optionally a field, a reason, and an expiration date " +
+					"(YYYY-MM-DD).\n" +
+					"The concern types are empty, files, metadata conflict, numbering, portability; the fields " +
+					"are album, artist, genre, mcdi, number, title, year.\n",
+				Log: "" +
+					"level='error'" +
+					" --suppressions='bad.yaml'" +
+					" error='entry 1: the concern \"bogus\" is not recognized'" +
+					" user-set='true'" +
+					" msg='invalid suppressions'\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			got, got1 := evaluateSuppressions(o, tt.values)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evaluateSuppressions() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("evaluateSuppressions() got1 = %v, want %v", got1, tt.want1)
+			}
+			o.Report(t, "evaluateSuppressions()", tt.WantedRecording)
+		})
+	}
+}
+
+func newTestSuppression(t *testing.T, sup *suppression) *suppression {
+	t.Helper()
+	if err := sup.validate(); err != nil {
+		t.Fatalf("invalid suppression: %v", err)
+	}
+	return sup
+}
+
+func Test_suppression_expired(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	tests := map[string]struct {
+		expires string
+		want    bool
+	}{
+		"never":         {expires: "", want: false},
+		"yesterday":     {expires: "2026-10-17", want: true},
+		"today":         {expires: "2026-10-18", want: false},
+		"in the future": {expires: "2027-01-01", want: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			sup := newTestSuppression(t, &suppression{Artist: "a", Concern: "empty", Expires: tt.expires})
+			if got := sup.expired(now); got != tt.want {
+				t.Errorf("suppression.expired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_suppression_covers(t *testing.T) {
+	tests := map[string]struct {
+		sup                  *suppression
+		artist, album, track string
+		want                 bool
+	}{
+		"artist suppression, artist concern": {
+			sup:    &suppression{Artist: "a"},
+			artist: "a",
+			want:   true,
+		},
+		"artist suppression, track concern": {
+			sup:    &suppression{Artist: "a"},
+			artist: "a", album: "b", track: "c",
+			want: true,
+		},
+		"other artist": {
+			sup:    &suppression{Artist: "a"},
+			artist: "z",
+			want:   false,
+		},
+		"album suppression, artist concern": {
+			sup:    &suppression{Artist: "a", Album: "b"},
+			artist: "a",
+			want:   false,
+		},
+		"album suppression, track concern": {
+			sup:    &suppression{Artist: "a", Album: "b"},
+			artist: "a", album: "b", track: "c",
+			want: true,
+		},
+		"track suppression, other track": {
+			sup:    &suppression{Artist: "a", Album: "b", Track: "c"},
+			artist: "a", album: "b", track: "d",
+			want: false,
+		},
+		"track suppression, album concern": {
+			sup:    &suppression{Artist: "a", Album: "b", Track: "c"},
+			artist: "a", album: "b",
+			want: false,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.sup.covers(tt.artist, tt.album, tt.track); got != tt.want {
+				t.Errorf("suppression.covers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_suppression_matchesConcern(t *testing.T) {
+	tests := map[string]struct {
+		sup     *suppression
+		kind    concernType
+		concern string
+		want    bool
+	}{
+		"different concern type": {
+			sup:  &suppression{Artist: "a", Concern: "files"},
+			kind: numberingConcern,
+			want: false,
+		},
+		"any field": {
+			sup:     &suppression{Artist: "a", Concern: "files"},
+			kind:    filesConcern,
+			concern: "metadata does not agree with album name \"b\"",
+			want:    true,
+		},
+		"matching field": {
+			sup:     &suppression{Artist: "a", Concern: "files", Field: "album"},
+			kind:    filesConcern,
+			concern: "metadata does not agree with album name \"b\"",
+			want:    true,
+		},
+		"other field": {
+			sup:     &suppression{Artist: "a", Concern: "files", Field: "year"},
+			kind:    filesConcern,
+			concern: "metadata does not agree with album name \"b\"",
+			want:    false,
+		},
+		"matching conflict field": {
+			sup:     &suppression{Artist: "a", Concern: "metadata conflict", Field: "genre"},
+			kind:    conflictConcern,
+			concern: "the genre field does not agree between ID3V1 and ID3V2",
+			want:    true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			sup := newTestSuppression(t, tt.sup)
+			if got := sup.matchesConcern(tt.kind, tt.concern); got != tt.want {
+				t.Errorf("suppression.matchesConcern() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_suppressions_hide(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	cArs := createConcernedArtists(generateArtists(2, 1, 2, nil))
+	cAr := cArs[0]
+	cAr.addConcern(emptyConcern, "no albums found")
+	cAl := cAr.albums()[0]
+	cAl.addConcern(numberingConcern, "missing track 3")
+	cT := cAl.tracks()[0]
+	cT.addConcern(filesConcern, "metadata does not agree with album name \"my album 00\"")
+	cT.addConcern(filesConcern, "metadata does not agree with track number 1")
+	cArs[1].addConcern(emptyConcern, "no albums found")
+	sups := &suppressions{
+		entries: []*suppression{
+			newTestSuppression(t, &suppression{Artist: "my artist 0", Concern: "empty"}),
+			newTestSuppression(t, &suppression{
+				Artist:  "my artist 0",
+				Album:   "my album 00",
+				Track:   "my track 001",
+				Concern: "files",
+				Field:   "album",
+			}),
+			newTestSuppression(t, &suppression{
+				Artist:  "my artist 0",
+				Album:   "my album 00",
+				Concern: "numbering",
+				Expires: "2026-01-01",
+			}),
+			newTestSuppression(t, &suppression{Artist: "my artist 9", Concern: "portability"}),
+		},
+	}
+	if got := sups.hide(cArs, now); got != 2 {
+		t.Errorf("suppressions.hide() = %d, want 2", got)
+	}
+	if got := cAr.concerns.concernsCollection[emptyConcern]; len(got) != 0 {
+		t.Errorf("suppressions.hide() artist empty concerns = %v, want none", got)
+	}
+	if got := cAl.concerns.concernsCollection[numberingConcern]; len(got) != 1 {
+		t.Errorf("suppressions.hide() album numbering concerns = %v, want 1", got)
+	}
+	wantTrackConcerns := []string{"metadata does not agree with track number 1"}
+	if got := cT.concerns.concernsCollection[filesConcern]; !reflect.DeepEqual(got, wantTrackConcerns) {
+		t.Errorf("suppressions.hide() track files concerns = %v, want %v", got, wantTrackConcerns)
+	}
+	if got := cArs[1].concerns.concernsCollection[emptyConcern]; len(got) != 1 {
+		t.Errorf("suppressions.hide() other artist empty concerns = %v, want 1", got)
+	}
+	wantMatches := []int{1, 1, 0, 0}
+	for k, sup := range sups.entries {
+		if sup.matches != wantMatches[k] {
+			t.Errorf("suppressions.hide() entry %d matches = %d, want %d", k, sup.matches, wantMatches[k])
+		}
+	}
+}
+
+func Test_suppressions_report(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	tests := map[string]struct {
+		entries []*suppression
+		hidden  int
+		scanned func(*suppression) bool
+		output.WantedRecording
+	}{
+		"nothing to say": {
+			entries: []*suppression{{Artist: "a", Concern: "empty", concern: emptyConcern, matches: 1}},
+			hidden:  1,
+			scanned: func(*suppression) bool { return true },
+			WantedRecording: output.WantedRecording{
+				Console: "Suppressed concerns: 1 (see \"s.yaml\").\n",
+			},
+		},
+		"expired and stale": {
+			entries: []*suppression{
+				newTestSuppression(t, &suppression{
+					Artist:  "a",
+					Album:   "b",
+					Concern: "files",
+					Field:   "album",
+					Expires: "2026-10-01",
+				}),
+				newTestSuppression(t, &suppression{
+					Artist:  "a",
+					Album:   "b",
+					Track:   "c",
+					Concern: "numbering",
+					Reason:  "bonus track",
+				}),
+			},
+			scanned: func(*suppression) bool { return true },
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"The suppression of files (album) concerns for album \"b\" by \"a\" expired on 2026-10-01.\n" +
+					"The suppression of numbering concerns for track \"c\" on \"b\" by \"a\" is stale: no such " +
+					"concern was found.\n",
+				Log: "" +
+					"level='warning'" +
+					" expires='2026-10-01'" +
+					" suppression='files (album) concerns for album \"b\" by \"a\"'" +
+					" msg='suppression expired'\n" +
+					"level='warning'" +
+					" reason='bonus track'" +
+					" suppression='numbering concerns for track \"c\" on \"b\" by \"a\"'" +
+					" msg='stale suppression'\n",
+			},
+		},
+		"not scanned for": {
+			entries: []*suppression{newTestSuppression(t, &suppression{Artist: "a", Concern: "portability"})},
+			scanned: func(*suppression) bool { return false },
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			sups := &suppressions{path: "s.yaml", entries: tt.entries}
+			sups.report(o, tt.hidden, tt.scanned, now)
+			o.Report(t, "suppressions.report()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_suppressions_suppressFields(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	sups := &suppressions{
+		entries: []*suppression{
+			newTestSuppression(t, &suppression{
+				Artist:  "my artist 0",
+				Album:   "my album 00",
+				Concern: "files",
+				Field:   "album",
+			}),
+			newTestSuppression(t, &suppression{
+				Artist:  "my artist 0",
+				Album:   "my album 00",
+				Track:   "my track 002",
+				Concern: "metadata conflict",
+			}),
+			newTestSuppression(t, &suppression{Artist: "my artist 0", Concern: "numbering"}),
+			newTestSuppression(t, &suppression{
+				Artist:  "my artist 1",
+				Concern: "files",
+				Expires: "2026-01-01",
+			}),
+		},
+	}
+	got := generateArtists(2, 1, 2, nil)
+	want := generateArtists(2, 1, 2, nil)
+	tracks := want[0].Albums()[0].Tracks()
+	tracks[0].SuppressFields(files.AlbumNameField)
+	tracks[1].SuppressFields(files.AlbumNameField)
+	tracks[1].SuppressFields(files.MetadataFields()...)
+	sups.suppressFields(got, now)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("suppressions.suppressFields() got %v, want %v", got, want)
+	}
+}
+
+func Test_scanSettings_scannedFor(t *testing.T) {
+	ss := &searchSettings{
+		artistFilter: regexp.MustCompile("^a"),
+		albumFilter:  regexp.MustCompile(".*"),
+		trackFilter:  regexp.MustCompile("^t"),
+	}
+	allScans := &scanSettings{
+		empty:       cmdtoolkit.CommandFlag[bool]{Value: true},
+		files:       cmdtoolkit.CommandFlag[bool]{Value: true},
+		numbering:   cmdtoolkit.CommandFlag[bool]{Value: true},
+		portability: cmdtoolkit.CommandFlag[bool]{Value: true},
+	}
+	tests := map[string]struct {
+		scanSets *scanSettings
+		sup      *suppression
+		want     bool
+	}{
+		"empty, scanned": {
+			scanSets: allScans,
+			sup:      &suppression{Artist: "z", concern: emptyConcern},
+			want:     true,
+		},
+		"empty, not scanned": {
+			scanSets: &scanSettings{},
+			sup:      &suppression{Artist: "z", concern: emptyConcern},
+			want:     false,
+		},
+		"files, selected": {
+			scanSets: allScans,
+			sup:      &suppression{Artist: "abc", Album: "b", Track: "tt", concern: filesConcern},
+			want:     true,
+		},
+		"files, artist filtered out": {
+			scanSets: allScans,
+			sup:      &suppression{Artist: "zed", concern: filesConcern},
+			want:     false,
+		},
+		"files, track filtered out": {
+			scanSets: allScans,
+			sup:      &suppression{Artist: "abc", Album: "b", Track: "x", concern: filesConcern},
+			want:     false,
+		},
+		"metadata conflict": {
+			scanSets: allScans,
+			sup:      &suppression{Artist: "abc", concern: conflictConcern},
+			want:     false,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.scanSets.scannedFor(tt.sup, ss); got != tt.want {
+				t.Errorf("scanSettings.scannedFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,591 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"math"
+	"mp3repair/internal/files"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+
+	"github.com/majohn-r/output"
+	"github.com/spf13/cobra"
+)
+
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+const (
+	syncCommandName       = "sync"
+	syncDryRun            = "dryRun"
+	syncDryRunFlag        = "--" + syncDryRun
+	syncMaxArtworkSize    = "maxArtworkSize"
+	syncMaxArtworkFlag    = "--" + syncMaxArtworkSize
+	syncMaxNameLength     = "maxNameLength"
+	syncMaxNameLengthFlag = "--" + syncMaxNameLength
+	syncPrune             = "prune"
+	syncPruneFlag         = "--" + syncPrune
+	syncTarget            = "target"
+	syncTargetFlag        = "--" + syncTarget
+	syncArtworkMinimum    = 0
+	syncArtworkDefault    = 0
+	syncArtworkMaximum    = math.MaxInt16
+	syncNameMinimum       = 8
+	syncNameDefault       = 64
+	syncNameMaximum       = 255
+	syncExampleFilter     = searchArtistFilterFlag + " \"^The Beatles$\""
+	syncManifestFile      = ".mp3repair-sync.json"
+)
+
+var (
+	syncArtworkBounds = cmdtoolkit.NewIntBounds(syncArtworkMinimum, syncArtworkDefault, syncArtworkMaximum)
+	syncNameBounds    = cmdtoolkit.NewIntBounds(syncNameMinimum, syncNameDefault, syncNameMaximum)
+	// syncVersionChoices are the id3v2Version values that sync accepts; the
+	// copies' tags cannot keep their own versions
+	syncVersionChoices = []string{id3v2Version3, id3v2Version4}
+	syncCmd            = &cobra.Command{
+		Use: syncCommandName + " " + syncTargetFlag + " directory [" + syncDryRunFlag + "] [" +
+			id3v2VersionFlag + " version] [" + syncMaxArtworkFlag + " KiB] [" + syncMaxNameLengthFlag +
+			" length] [" + syncPruneFlag + "] " + searchUsage,
+		DisableFlagsInUseLine: true,
+		Short:                 "Copies selected tracks to a portable directory, such as a USB stick",
+		Long: "" +
+			fmt.Sprintf("%q copies the tracks selected by the search filters to a target directory\n",
+				syncCommandName) +
+			"\n" +
+			"Each copied track is written to target/artist/album/NN title.mp3, where the artist,\n" +
+			"album, and title are converted to short names that FAT32 and exFAT devices can use,\n" +
+			"and the copy's ID3V2 tag is rewritten to the requested version; a copy without an\n" +
+			"ID3V1 tag is given one. Oversized artwork can be stripped from the copies.\n" +
+			"\n" +
+			"A manifest in the target directory records how each copy was made. Tracks whose\n" +
+			"copies were made from the unchanged original with the same settings are not copied\n" +
+			"again, and only copies listed in the manifest that are no longer selected can be\n" +
+			"removed; other files in the target directory are never removed. The files in the\n" +
+			"music directory are never modified.\n" +
+			"\n" +
+			"If interrupted (Ctrl+C), no further tracks are copied, and no copies are removed.",
+		Example: syncCommandName + " " + syncTargetFlag + " E:\\ " + syncExampleFilter + "\n" +
+			"  Copy all of the Beatles' tracks to E:\\, tagged as ID3V2.3\n" +
+			syncCommandName + " " + syncTargetFlag + " E:\\ " + syncMaxArtworkFlag + " 256 " +
+			syncPruneFlag + "\n" +
+			"  Copy all tracks to E:\\, dropping artwork larger than 256 KiB and removing\n" +
+			"  tracks that are no longer in the music directory",
+		RunE: syncRun,
+	}
+	syncFlags = &cmdtoolkit.FlagSet{
+		Name: syncCommandName,
+		Details: map[string]*cmdtoolkit.FlagDetails{
+			syncDryRun: {
+				Usage:        "output what would have been copied and removed, but copies and removes no files",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+			syncMaxArtworkSize: {
+				Usage: fmt.Sprintf("the size, in KiB, of the largest artwork kept in the copies; 0 keeps all "+
+					"artwork (at least %d, at most %d, default %d)",
+					syncArtworkMinimum, syncArtworkMaximum, syncArtworkDefault),
+				ExpectedType: cmdtoolkit.IntType,
+				DefaultValue: syncArtworkBounds,
+			},
+			syncMaxNameLength: {
+				Usage: fmt.Sprintf("the maximum length of the copies' file and directory names "+
+					"(at least %d, at most %d, default %d)", syncNameMinimum, syncNameMaximum, syncNameDefault),
+				ExpectedType: cmdtoolkit.IntType,
+				DefaultValue: syncNameBounds,
+			},
+			syncPrune: {
+				Usage:        "remove copies made by earlier syncs that are not selected",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+			syncTarget: {
+				Usage:        "the directory to which the selected tracks are copied",
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			id3v2Version: {
+				Usage:        fmt.Sprintf("ID3V2 version of the copies' tags: %s or %s", id3v2Version3, id3v2Version4),
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: id3v2Version3,
+			},
+		},
+	}
+)
+
+func syncRun(cmd *cobra.Command, _ []string) error {
+	exitError := cmdtoolkit.NewExitProgrammingError(syncCommandName)
+	o := getBus()
+	ctx := commandContext(cmd)
+	producer := cmd.Flags()
+	values, eSlice := cmdtoolkit.ReadFlags(producer, syncFlags)
+	ss, searchFlagsOk := evaluateSearchFlags(o, producer)
+	if cmdtoolkit.ProcessFlagErrors(o, eSlice) && searchFlagsOk {
+		exitError = cmdtoolkit.NewExitUserError(syncCommandName)
+		if syncs, flagsOk := processSyncFlags(o, values, ss.musicDir); flagsOk {
+			exitError = syncs.synchronize(ctx, o, ss.load(ctx, o), ss)
+		}
+	}
+	return cmdtoolkit.ToErrorInterface(exitError)
+}
+
+type syncSettings struct {
+	dryRun        cmdtoolkit.CommandFlag[bool]
+	prune         cmdtoolkit.CommandFlag[bool]
+	target        string
+	maxNameLength int
+	conversion    files.ID3V2Conversion
+}
+
+// syncedTrack pairs a selected track with the path of its copy
+type syncedTrack struct {
+	source      *files.Track
+	destination string
+}
+
+func (syncs *syncSettings) synchronize(
+	ctx context.Context,
+	o output.Bus,
+	allArtists []*files.Artist,
+	ss *searchSettings,
+) (e *cmdtoolkit.ExitError) {
+	e = cmdtoolkit.NewExitUserError(syncCommandName)
+	if len(allArtists) != 0 {
+		if filteredArtists := ss.filter(o, allArtists); len(filteredArtists) != 0 {
+			e = syncs.syncArtists(ctx, o, filteredArtists)
+		}
+	}
+	return
+}
+
+// syncArtists copies the artists' tracks to the target directory. If
+// interrupted, no further tracks are copied, and no copies are removed, as
+// the tracks that were not copied cannot be told apart from those that are no
+// longer selected.
+func (syncs *syncSettings) syncArtists(
+	ctx context.Context,
+	o output.Bus,
+	artists []*files.Artist,
+) (e *cmdtoolkit.ExitError) {
+	manifest := syncs.readManifest(o)
+	manifestChanged := false
+	plan := syncs.plan(artists)
+	planned := map[string]bool{}
+	copied := 0
+	upToDate := 0
+	interrupted := false
+	for k, st := range plan {
+		if ctx.Err() != nil {
+			o.ErrorPrintf("The sync was interrupted; %d tracks were not copied.\n", len(plan)-k)
+			o.Log(output.Info, "sync interrupted", map[string]any{
+				"command": syncCommandName,
+				"skipped": len(plan) - k,
+			})
+			interrupted = true
+			break
+		}
+		key := syncs.manifestKey(st.destination)
+		planned[strings.ToLower(key)] = true
+		record, recordErr := syncs.newRecord(st)
+		previous, recorded := manifest[key]
+		switch {
+		case recordErr == nil && recorded && previous.matches(record) && plainFileExists(st.destination):
+			upToDate++
+		case syncs.dryRun.Value:
+			o.ConsolePrintf("%q would be copied to %q.\n", st.source, st.destination)
+			copied++
+		case recordErr == nil && syncs.copyTrack(o, st, record.Size):
+			manifest[key] = record
+			manifestChanged = true
+			copied++
+		default:
+			if recordErr != nil {
+				reportSyncError(o, st, "cannot read file information", recordErr)
+			}
+			// the copy, if there was one, has been removed or is suspect
+			if recorded {
+				delete(manifest, key)
+				manifestChanged = true
+			}
+			e = cmdtoolkit.NewExitSystemError(syncCommandName)
+		}
+	}
+	removed := 0
+	if syncs.prune.Value && !interrupted {
+		var pruned, pruneOk bool
+		if removed, pruned, pruneOk = syncs.pruneTarget(o, manifest, planned); !pruneOk {
+			e = cmdtoolkit.NewExitSystemError(syncCommandName)
+		}
+		manifestChanged = manifestChanged || pruned
+	}
+	if manifestChanged && !syncs.dryRun.Value {
+		if writeErr := syncs.writeManifest(manifest); writeErr != nil {
+			o.ErrorPrintf("The sync manifest %q cannot be written: %s.\n", syncs.manifestPath(),
+				cmdtoolkit.ErrorToString(writeErr))
+			o.Log(output.Error, "cannot write sync manifest", map[string]any{
+				"command": syncCommandName,
+				"file":    syncs.manifestPath(),
+				"error":   writeErr,
+			})
+			e = cmdtoolkit.NewExitSystemError(syncCommandName)
+		}
+	}
+	switch {
+	case syncs.dryRun.Value:
+		o.ConsolePrintf("Tracks to copy: %d; tracks already up to date: %d.\n", copied, upToDate)
+		if syncs.prune.Value && !interrupted {
+			o.ConsolePrintf("Tracks to remove: %d.\n", removed)
+		}
+	default:
+		o.ConsolePrintf("Tracks copied: %d; tracks already up to date: %d.\n", copied, upToDate)
+		if syncs.prune.Value && !interrupted {
+			o.ConsolePrintf("Tracks removed: %d.\n", removed)
+		}
+	}
+	return
+}
+
+// plan determines where each track is to be copied. Names are compared without
+// regard to case, as FAT32 and exFAT file systems do not distinguish names
+// that differ only in case; colliding names are made unique by adding a
+// numeric suffix.
+func (syncs *syncSettings) plan(artists []*files.Artist) []syncedTrack {
+	var plan []syncedTrack
+	used := map[string]bool{}
+	for _, artist := range artists {
+		artistDir := filepath.Join(syncs.target, files.PortableName(artist.Name(), syncs.maxNameLength))
+		for _, album := range artist.Albums() {
+			albumDir := filepath.Join(artistDir, files.PortableName(album.Title(), syncs.maxNameLength))
+			for _, track := range album.Tracks() {
+				destination := syncs.uniqueTrackPath(albumDir, track, used)
+				used[strings.ToLower(destination)] = true
+				plan = append(plan, syncedTrack{source: track, destination: destination})
+			}
+		}
+	}
+	return plan
+}
+
+func (syncs *syncSettings) uniqueTrackPath(dir string, track *files.Track, used map[string]bool) string {
+	extension := strings.ToLower(filepath.Ext(track.FileName()))
+	prefix := fmt.Sprintf("%02d ", track.Number())
+	for n := 1; ; n++ {
+		suffix := ""
+		if n > 1 {
+			suffix = fmt.Sprintf(" (%d)", n)
+		}
+		titleLength := syncs.maxNameLength - len(prefix) - len(suffix) - len(extension)
+		fileName := prefix + files.PortableName(track.Name(), max(titleLength, 1)) + suffix + extension
+		if path := filepath.Join(dir, fileName); !used[strings.ToLower(path)] {
+			return path
+		}
+	}
+}
+
+// syncRecord records, in the sync manifest, how a copy was made: from which
+// track, in which state, and with which settings. A copy whose record matches
+// the track's current state and the current settings is up to date.
+type syncRecord struct {
+	Source         string    `json:"source"`
+	Size           int64     `json:"size"`
+	ModTime        time.Time `json:"modTime"`
+	ID3V2Version   byte      `json:"id3v2Version"`
+	MaxArtworkSize int       `json:"maxArtworkSize"`
+}
+
+func (r syncRecord) matches(other syncRecord) bool {
+	return r.Source == other.Source && r.Size == other.Size && r.ModTime.Equal(other.ModTime) &&
+		r.ID3V2Version == other.ID3V2Version && r.MaxArtworkSize == other.MaxArtworkSize
+}
+
+// newRecord creates the record of a copy of the track made with the current
+// settings
+func (syncs *syncSettings) newRecord(st syncedTrack) (syncRecord, error) {
+	record := syncRecord{
+		Source:         st.source.Path(),
+		ID3V2Version:   syncs.conversion.Version,
+		MaxArtworkSize: syncs.conversion.MaxArtworkSize,
+	}
+	info, statErr := stat(st.source.Path())
+	if statErr != nil {
+		return record, statErr
+	}
+	record.Size = info.Size()
+	record.ModTime = info.ModTime()
+	return record, nil
+}
+
+// the sync manifest, kept in the target directory, lists the copies that sync
+// has made, keyed by their paths relative to the target directory; only those
+// copies are ever removed
+func (syncs *syncSettings) manifestPath() string {
+	return filepath.Join(syncs.target, syncManifestFile)
+}
+
+func (syncs *syncSettings) manifestKey(destination string) string {
+	rel, relErr := filepath.Rel(syncs.target, destination)
+	if relErr != nil {
+		return filepath.ToSlash(destination)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// readManifest reads the sync manifest; a missing manifest is treated as an
+// empty one, and so is a manifest that cannot be read, after reporting it: the
+// copies it listed are then copied again, but none are removed
+func (syncs *syncSettings) readManifest(o output.Bus) map[string]syncRecord {
+	manifest := map[string]syncRecord{}
+	content, readErr := readFile(syncs.manifestPath())
+	if readErr == nil {
+		readErr = json.Unmarshal(content, &manifest)
+	}
+	if readErr != nil && !errors.Is(readErr, fs.ErrNotExist) {
+		o.ErrorPrintf("The sync manifest %q cannot be read: %s; no copies will be removed.\n",
+			syncs.manifestPath(), cmdtoolkit.ErrorToString(readErr))
+		o.Log(output.Error, "cannot read sync manifest", map[string]any{
+			"command": syncCommandName,
+			"file":    syncs.manifestPath(),
+			"error":   readErr,
+		})
+		manifest = map[string]syncRecord{}
+	}
+	return manifest
+}
+
+// writeManifest replaces the sync manifest; the new manifest is written to a
+// temporary file, which is then renamed into place
+func (syncs *syncSettings) writeManifest(manifest map[string]syncRecord) error {
+	content, _ := json.MarshalIndent(manifest, "", "  ")
+	partial := syncs.manifestPath() + backupPartialSuffix
+	if writeErr := writeFile(partial, content, cmdtoolkit.StdFilePermissions); writeErr != nil {
+		return writeErr
+	}
+	return rename(partial, syncs.manifestPath())
+}
+
+// copyTrack copies the track, which is expected to have the specified size;
+// the copy is checked before its tags are rewritten, as the copy itself does
+// not report every write error
+func (syncs *syncSettings) copyTrack(o output.Bus, st syncedTrack, size int64) bool {
+	if dirErr := mkdirAll(filepath.Dir(st.destination), 0o755); dirErr != nil {
+		reportSyncError(o, st, "cannot create directory", dirErr)
+		return false
+	}
+	if copyErr := copyFile(st.source.Path(), st.destination); copyErr != nil {
+		reportSyncError(o, st, "error copying file", copyErr)
+		return false
+	}
+	if checkErr := checkCopySize(st.destination, size); checkErr != nil {
+		_ = remove(st.destination)
+		reportSyncError(o, st, "incomplete copy", checkErr)
+		return false
+	}
+	if conversionErr := applyID3V2Conversion(syncs.conversion, st.destination); conversionErr != nil {
+		// remove the partial copy, so that the next sync tries again
+		_ = remove(st.destination)
+		reportSyncError(o, st, "cannot rewrite metadata", conversionErr)
+		return false
+	}
+	if _, tagErr := addID3V1Tag(st.source, st.destination); tagErr != nil {
+		_ = remove(st.destination)
+		reportSyncError(o, st, "cannot create ID3V1 tag", tagErr)
+		return false
+	}
+	o.ConsolePrintf("%q copied to %q.\n", st.source, st.destination)
+	return true
+}
+
+// checkCopySize verifies that a copy has the size of the file it was copied
+// from
+func checkCopySize(path string, size int64) error {
+	info, statErr := stat(path)
+	if statErr != nil {
+		return statErr
+	}
+	if info.Size() != size {
+		return fmt.Errorf("the copy has %d bytes, but the track file has %d bytes", info.Size(), size)
+	}
+	return nil
+}
+
+func reportSyncError(o output.Bus, st syncedTrack, msg string, err error) {
+	o.ErrorPrintf("The track file %q could not be copied to %q: %s.\n", st.source, st.destination,
+		cmdtoolkit.ErrorToString(err))
+	o.Log(output.Error, msg, map[string]any{
+		"command":     syncCommandName,
+		"source":      st.source.Path(),
+		"destination": st.destination,
+		"error":       err,
+	})
+}
+
+// pruneTarget removes the copies listed in the manifest that are not part of
+// the plan, and then removes any directories left empty; files that sync did
+// not create are never removed. It reports how many copies were (or would be)
+// removed and whether the manifest changed.
+func (syncs *syncSettings) pruneTarget(
+	o output.Bus,
+	manifest map[string]syncRecord,
+	planned map[string]bool,
+) (removed int, changed, pruneOk bool) {
+	pruneOk = true
+	var unwanted []string
+	for key := range manifest {
+		if !planned[strings.ToLower(key)] {
+			unwanted = append(unwanted, key)
+		}
+	}
+	slices.Sort(unwanted)
+	dirs := map[string]bool{}
+	for _, key := range unwanted {
+		path := filepath.Join(syncs.target, filepath.FromSlash(key))
+		if syncs.dryRun.Value {
+			o.ConsolePrintf("%q would be removed.\n", path)
+			removed++
+			continue
+		}
+		removeErr := remove(path)
+		switch {
+		case removeErr == nil:
+			o.ConsolePrintf("%q removed.\n", path)
+			removed++
+		case errors.Is(removeErr, fs.ErrNotExist):
+			// already gone
+		default:
+			o.ErrorPrintf("The file %q cannot be removed: %s.\n", path, cmdtoolkit.ErrorToString(removeErr))
+			o.Log(output.Error, "cannot remove file", map[string]any{
+				"command": syncCommandName,
+				"file":    path,
+				"error":   removeErr,
+			})
+			pruneOk = false
+			continue
+		}
+		delete(manifest, key)
+		changed = true
+		for dir := filepath.Dir(path); dir != syncs.target && isWithin(dir, syncs.target); dir = filepath.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	// remove the deepest directories first; directories that are not empty
+	// cannot be removed, and that is fine
+	emptied := slices.Collect(maps.Keys(dirs))
+	slices.SortFunc(emptied, func(a, b string) int {
+		return cmp.Compare(len(b), len(a))
+	})
+	for _, dir := range emptied {
+		_ = remove(dir)
+	}
+	return
+}
+
+func processSyncFlags(
+	o output.Bus,
+	values map[string]*cmdtoolkit.CommandFlag[any],
+	musicDir string,
+) (*syncSettings, bool) {
+	syncs := &syncSettings{}
+	flagsOk := true // optimistic
+	var flagErr error
+	if syncs.dryRun, flagErr = cmdtoolkit.GetBool(o, values, syncDryRun); flagErr != nil {
+		flagsOk = false
+	}
+	if syncs.prune, flagErr = cmdtoolkit.GetBool(o, values, syncPrune); flagErr != nil {
+		flagsOk = false
+	}
+	if version, versionOk := evaluateChoice(o, values, id3v2Version, id3v2VersionFlag,
+		syncVersionChoices); versionOk {
+		syncs.conversion.Version = id3v2Versions[version]
+	} else {
+		flagsOk = false
+	}
+	if rawValue, intErr := cmdtoolkit.GetInt(o, values, syncMaxArtworkSize); intErr == nil {
+		syncs.conversion.MaxArtworkSize = 1024 * constrainBoundedValue(o, syncMaxArtworkFlag, rawValue.Value,
+			syncArtworkBounds)
+	} else {
+		flagsOk = false
+	}
+	if rawValue, intErr := cmdtoolkit.GetInt(o, values, syncMaxNameLength); intErr == nil {
+		syncs.maxNameLength = constrainBoundedValue(o, syncMaxNameLengthFlag, rawValue.Value, syncNameBounds)
+	} else {
+		flagsOk = false
+	}
+	if target, targetOk := evaluateSyncTarget(o, values, musicDir); targetOk {
+		syncs.target = target
+	} else {
+		flagsOk = false
+	}
+	return syncs, flagsOk
+}
+
+// evaluateSyncTarget verifies that the target directory has been specified and
+// that it neither contains nor is contained by the music directory: copying
+// into the music directory would modify it, and pruning a target directory
+// that contains the music directory would delete the music
+func evaluateSyncTarget(
+	o output.Bus,
+	values map[string]*cmdtoolkit.CommandFlag[any],
+	musicDir string,
+) (string, bool) {
+	rawValue, flagErr := cmdtoolkit.GetString(o, values, syncTarget)
+	if flagErr != nil {
+		return "", false
+	}
+	if rawValue.Value == "" {
+		o.ErrorPrintln("No tracks will be copied.")
+		o.ErrorPrintln("Why?")
+		o.ErrorPrintf("The %s flag was not set.\n", syncTargetFlag)
+		o.ErrorPrintln("What to do:")
+		o.ErrorPrintf("Set %s to the directory to which the tracks should be copied.\n", syncTargetFlag)
+		return "", false
+	}
+	target := filepath.Clean(rawValue.Value)
+	if pathsOverlap(target, musicDir) {
+		o.ErrorPrintf("The %s value %q cannot be used.\n", syncTargetFlag, rawValue.Value)
+		o.ErrorPrintln("Why?")
+		o.ErrorPrintf("The directory overlaps the music directory %q.\n", musicDir)
+		o.ErrorPrintln("What to do:")
+		o.ErrorPrintf("Set %s to a directory outside the music directory.\n", syncTargetFlag)
+		o.Log(output.Error, "invalid target directory", map[string]any{
+			syncTargetFlag:   rawValue.Value,
+			"$XDG_MUSIC_DIR": musicDir,
+		})
+		return "", false
+	}
+	return target, true
+}
+
+// pathsOverlap determines whether either path is the same as, or contained in,
+// the other
+func pathsOverlap(path1, path2 string) bool {
+	abs1, err1 := filepath.Abs(path1)
+	abs2, err2 := filepath.Abs(path2)
+	if err1 != nil || err2 != nil {
+		return true
+	}
+	return isWithin(abs1, abs2) || isWithin(abs2, abs1)
+}
+
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+	cmdtoolkit.AddDefaults(syncFlags)
+	cmdtoolkit.AddFlags(getBus(), getConfiguration(), syncCmd.Flags(), syncFlags, searchFlags)
+}
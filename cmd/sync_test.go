@@ -0,0 +1,537 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"context"
+	"mp3repair/internal/files"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/adrg/xdg"
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+	"github.com/spf13/afero"
+)
+
+func Test_processSyncFlags(t *testing.T) {
+	musicDir := filepath.Join("Music", "mp3")
+	goodValues := func(target string) map[string]*cmdtoolkit.CommandFlag[any] {
+		return map[string]*cmdtoolkit.CommandFlag[any]{
+			syncDryRun:         {Value: true, UserSet: true},
+			syncMaxArtworkSize: {Value: 256},
+			syncMaxNameLength:  {Value: 32},
+			syncPrune:          {Value: false},
+			syncTarget:         {Value: target},
+			id3v2Version:       {Value: "2.4"},
+		}
+	}
+	tests := map[string]struct {
+		values map[string]*cmdtoolkit.CommandFlag[any]
+		want   *syncSettings
+		want1  bool
+		output.WantedRecording
+	}{
+		"no data": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{},
+			want:   &syncSettings{},
+			want1:  false,
+			WantedRecording: output.WantedRecording{
+				Error: "An internal error occurred: flag \"dryRun\" is not found.\n" +
+					"An internal error occurred: flag \"prune\" is not found.\n" +
+					"An internal error occurred: flag \"id3v2Version\" is not found.\n" +
+					"An internal error occurred: flag \"maxArtworkSize\" is not found.\n" +
+					"An internal error occurred: flag \"maxNameLength\" is not found.\n" +
+					"An internal error occurred: flag \"target\" is not found.\n",
+				Log: "level='error' error='flag not found' flag='dryRun' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='prune' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='id3v2Version' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='maxArtworkSize' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='maxNameLength' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='target' msg='internal error'\n",
+			},
+		},
+		"good": {
+			values: goodValues(filepath.Join("usb", "music")),
+			want: &syncSettings{
+				dryRun:        cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true},
+				target:        filepath.Join("usb", "music"),
+				maxNameLength: 32,
+				conversion:    files.ID3V2Conversion{Version: 4, MaxArtworkSize: 256 * 1024},
+			},
+			want1: true,
+		},
+		"unsupported version": {
+			values: func() map[string]*cmdtoolkit.CommandFlag[any] {
+				values := goodValues(filepath.Join("usb", "music"))
+				values[id3v2Version] = &cmdtoolkit.CommandFlag[any]{Value: id3v2Keep}
+				return values
+			}(),
+			want: &syncSettings{
+				dryRun:        cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true},
+				target:        filepath.Join("usb", "music"),
+				maxNameLength: 32,
+				conversion:    files.ID3V2Conversion{MaxArtworkSize: 256 * 1024},
+			},
+			want1: false,
+			WantedRecording: output.WantedRecording{
+				Error: "The --id3v2Version value \"keep\" cannot be used.\n" +
+					"Why?\n" +
+					"The value is not one of the supported values.\n" +
+					"What to do:\n" +
+					"Use one of these values: 2.3, 2.4.\n",
+				Log: "level='error' --id3v2Version='keep' user-set='false' msg='invalid value'\n",
+			},
+		},
+		"missing target": {
+			values: goodValues(""),
+			want: &syncSettings{
+				dryRun:        cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true},
+				maxNameLength: 32,
+				conversion:    files.ID3V2Conversion{Version: 4, MaxArtworkSize: 256 * 1024},
+			},
+			want1: false,
+			WantedRecording: output.WantedRecording{
+				Error: "No tracks will be copied.\n" +
+					"Why?\n" +
+					"The --target flag was not set.\n" +
+					"What to do:\n" +
+					"Set --target to the directory to which the tracks should be copied.\n",
+			},
+		},
+		"target inside music directory": {
+			values: goodValues(filepath.Join(musicDir, "usb")),
+			want: &syncSettings{
+				dryRun:        cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true},
+				maxNameLength: 32,
+				conversion:    files.ID3V2Conversion{Version: 4, MaxArtworkSize: 256 * 1024},
+			},
+			want1: false,
+			WantedRecording: output.WantedRecording{
+				Error: "The --target value \"" + filepath.Join(musicDir, "usb") + "\" cannot be used.\n" +
+					"Why?\n" +
+					"The directory overlaps the music directory \"" + musicDir + "\".\n" +
+					"What to do:\n" +
+					"Set --target to a directory outside the music directory.\n",
+				Log: "level='error'" +
+					" $XDG_MUSIC_DIR='" + musicDir + "'" +
+					" --target='" + filepath.Join(musicDir, "usb") + "'" +
+					" msg='invalid target directory'\n",
+			},
+		},
+		"target contains music directory": {
+			values: goodValues("Music"),
+			want: &syncSettings{
+				dryRun:        cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true},
+				maxNameLength: 32,
+				conversion:    files.ID3V2Conversion{Version: 4, MaxArtworkSize: 256 * 1024},
+			},
+			want1: false,
+			WantedRecording: output.WantedRecording{
+				Error: "The --target value \"Music\" cannot be used.\n" +
+					"Why?\n" +
+					"The directory overlaps the music directory \"" + musicDir + "\".\n" +
+					"What to do:\n" +
+					"Set --target to a directory outside the music directory.\n",
+				Log: "level='error'" +
+					" $XDG_MUSIC_DIR='" + musicDir + "'" +
+					" --target='Music'" +
+					" msg='invalid target directory'\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			got, got1 := processSyncFlags(o, tt.values, musicDir)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("processSyncFlags() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("processSyncFlags() got1 = %v, want %v", got1, tt.want1)
+			}
+			o.Report(t, "processSyncFlags()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_syncSettings_plan(t *testing.T) {
+	artist := files.NewArtist("Beyoncé", filepath.Join("Music", "Beyoncé"))
+	album := files.AlbumMaker{Title: "Lemonade?", Artist: artist, Directory: "Lemonade?"}.NewAlbum(true)
+	for _, maker := range []files.TrackMaker{
+		{Album: album, FileName: "01 Pray You Catch Me.MP3", SimpleName: "Pray You Catch Me", Number: 1},
+		{Album: album, FileName: "01 pray you catch me.mp3", SimpleName: "pray you catch me", Number: 1},
+		{Album: album, FileName: "02 A Very Long Track Name Indeed.mp3", SimpleName: "A Very Long Track Name Indeed",
+			Number: 2},
+	} {
+		maker.NewTrack(true)
+	}
+	syncs := &syncSettings{target: "usb", maxNameLength: 20}
+	albumDir := filepath.Join("usb", "Beyonce", "Lemonade_")
+	want := []string{
+		filepath.Join(albumDir, "01 Pray You Catc.mp3"),
+		filepath.Join(albumDir, "01 pray you (2).mp3"),
+		filepath.Join(albumDir, "02 A Very Long T.mp3"),
+	}
+	plan := syncs.plan([]*files.Artist{artist})
+	var got []string
+	for _, st := range plan {
+		got = append(got, st.destination)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("syncSettings.plan() = %v, want %v", got, want)
+	}
+}
+
+func Test_syncSettings_syncArtists(t *testing.T) {
+	originalFileSystem := cmdtoolkit.AssignFileSystem(afero.NewOsFs())
+	originalApplyID3V2Conversion := applyID3V2Conversion
+	originalCopyFile := copyFile
+	defer func() {
+		cmdtoolkit.AssignFileSystem(originalFileSystem)
+		applyID3V2Conversion = originalApplyID3V2Conversion
+		copyFile = originalCopyFile
+	}()
+	applyID3V2Conversion = func(_ files.ID3V2Conversion, _ string) error { return nil }
+	root := t.TempDir()
+	musicDir := filepath.Join(root, "Music")
+	artistDir := filepath.Join(musicDir, "The Beatles")
+	albumDir := filepath.Join(artistDir, "Abbey Road")
+	_ = os.MkdirAll(albumDir, 0o755)
+	_ = os.WriteFile(filepath.Join(albumDir, "01 Come Together.mp3"), []byte("track"), 0o644)
+	artist := files.NewArtist("The Beatles", artistDir)
+	album := files.AlbumMaker{Title: "Abbey Road", Artist: artist, Directory: albumDir}.NewAlbum(true)
+	track := files.TrackMaker{
+		Album:      album,
+		FileName:   "01 Come Together.mp3",
+		SimpleName: "Come Together",
+		Number:     1,
+	}.NewTrack(true)
+	target := filepath.Join(root, "usb")
+	copied := filepath.Join(target, "The Beatles", "Abbey Road", "01 Come Together.mp3")
+	stale := filepath.Join(target, "The Beatles", "Let It Be", "01 Two of Us.mp3")
+	unmanaged := filepath.Join(target, "Other", "01 Mine.mp3")
+	trackSize := int64(len("track"))
+	shortTarget := filepath.Join(root, "short")
+	shortCopy := filepath.Join(shortTarget, "The Beatles", "Abbey Road", "01 Come Together.mp3")
+	interruptedTarget := filepath.Join(root, "interrupted")
+	interruptedStale := filepath.Join(interruptedTarget, "The Beatles", "Let It Be", "01 Two of Us.mp3")
+	tests := map[string]struct {
+		syncs    *syncSettings
+		preTest  func()
+		cancel   bool
+		want     *cmdtoolkit.ExitError
+		wantOut  []string
+		wantNot  []string
+		wantSize int64
+		output.WantedRecording
+	}{
+		"dry run": {
+			syncs: &syncSettings{
+				dryRun:        cmdtoolkit.CommandFlag[bool]{Value: true},
+				prune:         cmdtoolkit.CommandFlag[bool]{Value: true},
+				target:        target,
+				maxNameLength: 64,
+			},
+			preTest: func() {},
+			want:    nil,
+			wantNot: []string{copied},
+			WantedRecording: output.WantedRecording{
+				Console: "\"" + track.Path() + "\" would be copied to \"" + copied + "\".\n" +
+					"Tracks to copy: 1; tracks already up to date: 0.\n" +
+					"Tracks to remove: 0.\n",
+			},
+		},
+		"copy and prune": {
+			syncs: &syncSettings{
+				prune:         cmdtoolkit.CommandFlag[bool]{Value: true},
+				target:        target,
+				maxNameLength: 64,
+			},
+			preTest: func() {
+				// the stale copy was made by an earlier sync; the other file
+				// was not, and so it is kept
+				_ = os.MkdirAll(filepath.Dir(stale), 0o755)
+				_ = os.WriteFile(stale, []byte("stale"), 0o644)
+				_ = os.MkdirAll(filepath.Dir(unmanaged), 0o755)
+				_ = os.WriteFile(unmanaged, []byte("mine"), 0o644)
+				_ = os.WriteFile(filepath.Join(target, syncManifestFile),
+					[]byte(`{"The Beatles/Let It Be/01 Two of Us.mp3":{"source":"gone.mp3"}}`), 0o644)
+			},
+			want:     nil,
+			wantOut:  []string{copied, unmanaged},
+			wantNot:  []string{stale, filepath.Dir(stale)},
+			wantSize: trackSize + 128,
+			WantedRecording: output.WantedRecording{
+				Console: "\"" + track.Path() + "\" copied to \"" + copied + "\".\n" +
+					"\"" + stale + "\" removed.\n" +
+					"Tracks copied: 1; tracks already up to date: 0.\n" +
+					"Tracks removed: 1.\n",
+			},
+		},
+		"up to date": {
+			syncs: &syncSettings{
+				target:        target,
+				maxNameLength: 64,
+			},
+			preTest: func() {},
+			want:    nil,
+			wantOut: []string{copied},
+			WantedRecording: output.WantedRecording{
+				Console: "Tracks copied: 0; tracks already up to date: 1.\n",
+			},
+		},
+		"settings changed": {
+			syncs: &syncSettings{
+				target:        target,
+				maxNameLength: 64,
+				conversion:    files.ID3V2Conversion{Version: 4},
+			},
+			preTest:  func() {},
+			want:     nil,
+			wantOut:  []string{copied},
+			wantSize: trackSize + 128,
+			WantedRecording: output.WantedRecording{
+				Console: "\"" + track.Path() + "\" copied to \"" + copied + "\".\n" +
+					"Tracks copied: 1; tracks already up to date: 0.\n",
+			},
+		},
+		"corrupt manifest": {
+			syncs: &syncSettings{
+				prune:         cmdtoolkit.CommandFlag[bool]{Value: true},
+				target:        target,
+				maxNameLength: 64,
+				conversion:    files.ID3V2Conversion{Version: 4},
+			},
+			preTest: func() {
+				_ = os.WriteFile(filepath.Join(target, syncManifestFile), []byte("{"), 0o644)
+			},
+			want:     nil,
+			wantOut:  []string{copied, unmanaged},
+			wantSize: trackSize + 128,
+			WantedRecording: output.WantedRecording{
+				Console: "\"" + track.Path() + "\" copied to \"" + copied + "\".\n" +
+					"Tracks copied: 1; tracks already up to date: 0.\n" +
+					"Tracks removed: 0.\n",
+				Error: "The sync manifest \"" + filepath.Join(target, syncManifestFile) +
+					"\" cannot be read: '*json.SyntaxError: unexpected end of JSON input'; no copies will be removed.\n",
+				Log: "level='error'" +
+					" command='sync'" +
+					" error='unexpected end of JSON input'" +
+					" file='" + filepath.Join(target, syncManifestFile) + "'" +
+					" msg='cannot read sync manifest'\n",
+			},
+		},
+		"conversion failure": {
+			syncs: &syncSettings{
+				target:        filepath.Join(root, "other"),
+				maxNameLength: 64,
+			},
+			preTest: func() {
+				applyID3V2Conversion = func(_ files.ID3V2Conversion, _ string) error {
+					return afero.ErrFileNotFound
+				}
+			},
+			want:    cmdtoolkit.NewExitSystemError(syncCommandName),
+			wantNot: []string{filepath.Join(root, "other", "The Beatles", "Abbey Road", "01 Come Together.mp3")},
+			WantedRecording: output.WantedRecording{
+				Console: "Tracks copied: 0; tracks already up to date: 0.\n",
+				Error: "The track file \"" + track.Path() + "\" could not be copied to \"" +
+					filepath.Join(root, "other", "The Beatles", "Abbey Road", "01 Come Together.mp3") +
+					"\": 'file does not exist'.\n",
+				Log: "level='error'" +
+					" command='sync'" +
+					" destination='" +
+					filepath.Join(root, "other", "The Beatles", "Abbey Road", "01 Come Together.mp3") + "'" +
+					" error='file does not exist'" +
+					" source='" + track.Path() + "'" +
+					" msg='cannot rewrite metadata'\n",
+			},
+		},
+		"incomplete copy": {
+			syncs: &syncSettings{
+				target:        shortTarget,
+				maxNameLength: 64,
+			},
+			preTest: func() {
+				applyID3V2Conversion = func(_ files.ID3V2Conversion, _ string) error { return nil }
+				copyFile = func(_, destination string) error {
+					return os.WriteFile(destination, []byte("tr"), 0o644)
+				}
+			},
+			want:    cmdtoolkit.NewExitSystemError(syncCommandName),
+			wantNot: []string{shortCopy, filepath.Join(shortTarget, syncManifestFile)},
+			WantedRecording: output.WantedRecording{
+				Console: "Tracks copied: 0; tracks already up to date: 0.\n",
+				Error: "The track file \"" + track.Path() + "\" could not be copied to \"" + shortCopy +
+					"\": 'the copy has 2 bytes, but the track file has 5 bytes'.\n",
+				Log: "level='error'" +
+					" command='sync'" +
+					" destination='" + shortCopy + "'" +
+					" error='the copy has 2 bytes, but the track file has 5 bytes'" +
+					" source='" + track.Path() + "'" +
+					" msg='incomplete copy'\n",
+			},
+		},
+		"interrupted": {
+			syncs: &syncSettings{
+				prune:         cmdtoolkit.CommandFlag[bool]{Value: true},
+				target:        interruptedTarget,
+				maxNameLength: 64,
+			},
+			preTest: func() {
+				copyFile = originalCopyFile
+				_ = os.MkdirAll(filepath.Dir(interruptedStale), 0o755)
+				_ = os.WriteFile(interruptedStale, []byte("stale"), 0o644)
+				_ = os.WriteFile(filepath.Join(interruptedTarget, syncManifestFile),
+					[]byte(`{"The Beatles/Let It Be/01 Two of Us.mp3":{"source":"gone.mp3"}}`), 0o644)
+			},
+			cancel:  true,
+			want:    nil,
+			wantOut: []string{interruptedStale},
+			wantNot: []string{filepath.Join(interruptedTarget, "The Beatles", "Abbey Road")},
+			WantedRecording: output.WantedRecording{
+				Console: "Tracks copied: 0; tracks already up to date: 0.\n",
+				Error:   "The sync was interrupted; 1 tracks were not copied.\n",
+				Log:     "level='info' command='sync' skipped='1' msg='sync interrupted'\n",
+			},
+		},
+	}
+	// the cases depend on each other, so they run in a fixed order
+	for _, name := range []string{
+		"dry run", "copy and prune", "up to date", "settings changed", "corrupt manifest", "conversion failure",
+		"incomplete copy", "interrupted",
+	} {
+		tt := tests[name]
+		t.Run(name, func(t *testing.T) {
+			tt.preTest()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+			o := output.NewRecorder()
+			got := tt.syncs.syncArtists(ctx, o, []*files.Artist{artist})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("syncSettings.syncArtists() = %v, want %v", got, tt.want)
+			}
+			for _, path := range tt.wantOut {
+				if _, err := os.Stat(path); err != nil {
+					t.Errorf("syncSettings.syncArtists() %q does not exist", path)
+				}
+			}
+			if tt.wantSize != 0 {
+				// the copy has been given an ID3V1 tag
+				if info, err := os.Stat(copied); err != nil || info.Size() != tt.wantSize {
+					t.Errorf("syncSettings.syncArtists() %q size = %v, want %d", copied, info, tt.wantSize)
+				}
+			}
+			for _, path := range tt.wantNot {
+				if _, err := os.Stat(path); err == nil {
+					t.Errorf("syncSettings.syncArtists() %q exists", path)
+				}
+			}
+			o.Report(t, "syncSettings.syncArtists()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_pathsOverlap(t *testing.T) {
+	tests := map[string]struct {
+		path1 string
+		path2 string
+		want  bool
+	}{
+		"same":          {path1: "music", path2: "music", want: true},
+		"inside":        {path1: filepath.Join("music", "usb"), path2: "music", want: true},
+		"containing":    {path1: "music", path2: filepath.Join("music", "usb"), want: true},
+		"siblings":      {path1: "music", path2: "usb", want: false},
+		"similar names": {path1: "music", path2: "music2", want: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := pathsOverlap(tt.path1, tt.path2); got != tt.want {
+				t.Errorf("pathsOverlap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sync_Help(t *testing.T) {
+	originalSearchFlags := searchFlags
+	originalMusicDir := xdg.UserDirs.Music
+	defer func() {
+		searchFlags = originalSearchFlags
+		xdg.UserDirs.Music = originalMusicDir
+	}()
+	searchFlags = safeSearchFlags
+	xdg.UserDirs.Music = "."
+	commandUnderTest := cloneCommand(syncCmd)
+	cmdtoolkit.AddFlags(output.NewNilBus(), cmdtoolkit.EmptyConfiguration(),
+		commandUnderTest.Flags(), syncFlags, searchFlags)
+	tests := map[string]struct {
+		output.WantedRecording
+	}{
+		"good": {
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"\"sync\" copies the tracks selected by the search filters to a target directory\n" +
+					"\n" +
+					"Each copied track is written to target/artist/album/NN title.mp3, where the artist,\n" +
+					"album, and title are converted to short names that FAT32 and exFAT devices can use,\n" +
+					"and the copy's ID3V2 tag is rewritten to the requested version; a copy without an\n" +
+					"ID3V1 tag is given one. Oversized artwork can be stripped from the copies.\n" +
+					"\n" +
+					"A manifest in the target directory records how each copy was made. Tracks whose\n" +
+					"copies were made from the unchanged original with the same settings are not copied\n" +
+					"again, and only copies listed in the manifest that are no longer selected can be\n" +
+					"removed; other files in the target directory are never removed. The files in the\n" +
+					"music directory are never modified.\n" +
+					"\n" +
+					"If interrupted (Ctrl+C), no further tracks are copied, and no copies are removed.\n" +
+					"\n" +
+					"Usage:\n" +
+					"  sync --target directory [--dryRun] [--id3v2Version version] [--maxArtworkSize KiB] " +
+					"[--maxNameLength length] [--prune] [--albumFilter regex] [--artistFilter regex] [--trackFilter " +
+					"regex] [--extensions extensions]\n" +
+					"\n" +
+					"Examples:\n" +
+					"sync --target E:\\ --artistFilter \"^The Beatles$\"\n" +
+					"  Copy all of the Beatles' tracks to E:\\, tagged as ID3V2.3\n" +
+					"sync --target E:\\ --maxArtworkSize 256 --prune\n" +
+					"  Copy all tracks to E:\\, dropping artwork larger than 256 KiB and removing\n" +
+					"  tracks that are no longer in the music directory\n" +
+					"\n" +
+					"Flags:\n" +
+					"      --albumFilter string    regular expression specifying which albums to select (default \".*\")\n" +
+					"      --artistFilter string   regular expression specifying which artists to select (default \".*\")\n" +
+					"      --dryRun                output what would have been copied and removed, but copies and " +
+					"removes no files (default false)\n" +
+					"      --extensions string     comma-delimited list of file extensions used by mp3 files (default " +
+					"\".mp3\")\n" +
+					"      --id3v2Version string   ID3V2 version of the copies' tags: 2.3 or 2.4 (default \"2.3\")\n" +
+					"      --maxArtworkSize int    the size, in KiB, of the largest artwork kept in the copies; 0 keeps " +
+					"all artwork (at least 0, at most 32767, default 0) (default 0)\n" +
+					"      --maxNameLength int     the maximum length of the copies' file and directory names (at least " +
+					"8, at most 255, default 64) (default 64)\n" +
+					"      --prune                 remove copies made by earlier syncs that are not selected " +
+					"(default false)\n" +
+					"      --target string         the directory to which the selected tracks are copied (default \"\")\n" +
+					"      --trackFilter string    regular expression specifying which tracks to select (default \".*\")\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			command := commandUnderTest
+			enableCommandRecording(o, command)
+			_ = command.Help()
+			o.Report(t, "sync Help()", tt.WantedRecording)
+		})
+	}
+}
@@ -0,0 +1,602 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"maps"
+	"mp3repair/internal/files"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+
+	"github.com/majohn-r/output"
+	"github.com/spf13/cobra"
+)
+
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+const (
+	watchCommandName     = "watch"
+	watchInterval        = "interval"
+	watchIntervalFlag    = "--" + watchInterval
+	watchMaxRewrites     = "maxRewrites"
+	watchMaxRewritesFlag = "--" + watchMaxRewrites
+	watchQuiet           = "quiet"
+	watchQuietFlag       = "--" + watchQuiet
+	watchRewrite         = "rewrite"
+	watchRewriteFlag     = "--" + watchRewrite
+	watchIntervalMinimum = 1
+	watchIntervalDefault = 5
+	watchIntervalMaximum = 3600
+	watchQuietMinimum    = 1
+	watchQuietDefault    = 30
+	watchQuietMaximum    = 3600
+	watchRewriteMinimum  = 1
+	watchRewriteDefault  = 20
+	watchRewriteMaximum  = 1000
+	fileCreated          = "created"
+	fileModified         = "modified"
+	fileRemoved          = "removed"
+	fileRenamed          = "renamed"
+)
+
+var (
+	watchIntervalBounds = cmdtoolkit.NewIntBounds(watchIntervalMinimum, watchIntervalDefault, watchIntervalMaximum)
+	watchQuietBounds    = cmdtoolkit.NewIntBounds(watchQuietMinimum, watchQuietDefault, watchQuietMaximum)
+	watchRewriteBounds  = cmdtoolkit.NewIntBounds(watchRewriteMinimum, watchRewriteDefault, watchRewriteMaximum)
+	watchCmd            = &cobra.Command{
+		Use: watchCommandName + " [" + watchIntervalFlag + " seconds] [" + watchQuietFlag + " seconds] [" +
+			watchRewriteFlag + "] [" + watchMaxRewritesFlag + " count] [" + suppressionsFileFlag + " file] [" +
+			framePolicyFileFlag + " file] " + searchUsage + " " + ioUsage + " " + namesUsage + " " + id3v2Usage,
+		DisableFlagsInUseLine: true,
+		Short:                 "Rescans albums as their files change",
+		Long: "" +
+			fmt.Sprintf("%q monitors the music directory for mp3 files that are created, renamed,\n",
+				watchCommandName) +
+			"modified, or removed\n" +
+			"\n" +
+			"Once the music directory has been quiet for a while, the albums containing the changed\n" +
+			"files are scanned as the " + scanCommand + " command would, and concerns that were not\n" +
+			"reported before are written to the console and to the log.\n" +
+			"\n" +
+			fmt.Sprintf("If %s is set, albums that were created while watching are also rewritten as the\n",
+				watchRewriteFlag) +
+			rewriteCommandName + " command would, provided that they are safe to rewrite:\n" +
+			"\n" +
+			"* the scan found no empty or numbering concerns in the album, and\n" +
+			fmt.Sprintf("* no more than %s of the album's tracks need to be rewritten.\n", watchMaxRewritesFlag) +
+			"\n" +
+			"Scans and rewrites use the suppressions, frame policy, and ID3V2 settings, as the\n" +
+			scanCommand + " and " + rewriteCommandName + " commands do.\n" +
+			"\n" +
+			"Each album is rewritten at most once. Press Ctrl+C to stop watching.",
+		Example: watchCommandName + "\n" +
+			"  Report new concerns in albums as they change\n" +
+			watchCommandName + " " + watchQuietFlag + " 120 " + watchRewriteFlag + "\n" +
+			"  Wait for two minutes without changes before scanning, and rewrite new albums",
+		RunE: watchRun,
+	}
+	watchFlags = &cmdtoolkit.FlagSet{
+		Name: watchCommandName,
+		Details: map[string]*cmdtoolkit.FlagDetails{
+			watchInterval: {
+				Usage: fmt.Sprintf("the number of seconds between checks for changed files "+
+					"(at least %d, at most %d, default %d)",
+					watchIntervalMinimum, watchIntervalMaximum, watchIntervalDefault),
+				ExpectedType: cmdtoolkit.IntType,
+				DefaultValue: watchIntervalBounds,
+			},
+			watchMaxRewrites: {
+				Usage: fmt.Sprintf("the largest number of tracks in a new album that may be rewritten "+
+					"(at least %d, at most %d, default %d)",
+					watchRewriteMinimum, watchRewriteMaximum, watchRewriteDefault),
+				ExpectedType: cmdtoolkit.IntType,
+				DefaultValue: watchRewriteBounds,
+			},
+			watchQuiet: {
+				Usage: fmt.Sprintf("the number of seconds without changes before changed albums are scanned "+
+					"(at least %d, at most %d, default %d)",
+					watchQuietMinimum, watchQuietMaximum, watchQuietDefault),
+				ExpectedType: cmdtoolkit.IntType,
+				DefaultValue: watchQuietBounds,
+			},
+			watchRewrite: {
+				Usage:        "rewrite albums created while watching, if they are safe to rewrite",
+				ExpectedType: cmdtoolkit.BoolType,
+				DefaultValue: false,
+			},
+			suppressionsFile: {
+				Usage:        suppressionsUsage,
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+			framePolicyFile: {
+				Usage:        framePolicyUsage,
+				ExpectedType: cmdtoolkit.StringType,
+				DefaultValue: "",
+			},
+		},
+	}
+)
+
+func watchRun(cmd *cobra.Command, _ []string) error {
+	exitError := cmdtoolkit.NewExitProgrammingError(watchCommandName)
+	o := getBus()
+	ctx := commandContext(cmd)
+	runsUntilInterrupted(ctx)
+	producer := cmd.Flags()
+	values, eSlice := cmdtoolkit.ReadFlags(producer, watchFlags)
+	ss, searchFlagsOk := evaluateSearchFlags(o, producer)
+	ios, ioFlagsOk := evaluateIOFlags(o, producer)
+	ns, namesFlagsOk := evaluateNamesFlags(o, producer)
+	is, id3v2FlagsOk := evaluateID3V2Flags(o, producer)
+	if cmdtoolkit.ProcessFlagErrors(o, eSlice) && searchFlagsOk && ioFlagsOk && namesFlagsOk && id3v2FlagsOk {
+		is.apply()
+		if ws, flagsOk := processWatchFlags(o, values); flagsOk {
+			ws.names = ns.equivalence
+			exitError = newWatcher(ws, ss, ios).run(ctx, o)
+		}
+	}
+	return cmdtoolkit.ToErrorInterface(exitError)
+}
+
+type watchSettings struct {
+	interval     time.Duration
+	quiet        time.Duration
+	rewrite      cmdtoolkit.CommandFlag[bool]
+	maxRewrites  int
+	suppressions *suppressions
+	framePolicy  *framePolicies
+	names        files.NameEquivalence
+}
+
+// fileState is what is known about a track file between checks
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// fileChange describes a track file that changed between checks; from is only
+// set for renamed files
+type fileChange struct {
+	path   string
+	from   string
+	change string
+}
+
+type watcher struct {
+	ws  *watchSettings
+	ss  *searchSettings
+	ios *ioSettings
+	// the track files found by the most recent check
+	files map[string]fileState
+	// album directories that had track files when watching started, or that
+	// have been rewritten since
+	knownAlbums map[string]bool
+	// album directories with changes that have not been scanned yet
+	pending    map[string]bool
+	lastChange time.Time
+	// the concerns most recently reported for each album directory
+	reported map[string][]string
+}
+
+func newWatcher(ws *watchSettings, ss *searchSettings, ios *ioSettings) *watcher {
+	return &watcher{
+		ws:          ws,
+		ss:          ss,
+		ios:         ios,
+		files:       map[string]fileState{},
+		knownAlbums: map[string]bool{},
+		pending:     map[string]bool{},
+		reported:    map[string][]string{},
+	}
+}
+
+// run watches the music directory until the context is cancelled
+func (w *watcher) run(ctx context.Context, o output.Bus) *cmdtoolkit.ExitError {
+	current, walkErr := w.snapshot()
+	if walkErr != nil {
+		w.reportWalkError(o, walkErr)
+		return cmdtoolkit.NewExitUserError(watchCommandName)
+	}
+	w.files = current
+	for path := range current {
+		w.knownAlbums[filepath.Dir(path)] = true
+	}
+	o.ConsolePrintf("Watching %q for changes; press Ctrl+C to stop.\n", w.ss.musicDir)
+	o.Log(output.Info, "watching", map[string]any{
+		"command":            watchCommandName,
+		"directory":          w.ss.musicDir,
+		"tracks":             len(current),
+		watchIntervalFlag:    w.ws.interval,
+		watchQuietFlag:       w.ws.quiet,
+		watchRewriteFlag:     w.ws.rewrite.Value,
+		watchMaxRewritesFlag: w.ws.maxRewrites,
+	})
+	ticker := time.NewTicker(w.ws.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			o.ConsolePrintln("Stopped watching.")
+			return nil
+		case now := <-ticker.C:
+			w.poll(ctx, o, now)
+		}
+	}
+}
+
+// poll checks for changed track files, and scans the albums containing them
+// once there have been no changes for the quiet period
+func (w *watcher) poll(ctx context.Context, o output.Bus, now time.Time) {
+	current, walkErr := w.snapshot()
+	if walkErr != nil {
+		// keep the previous state; otherwise, every track would appear to
+		// have been removed
+		w.reportWalkError(o, walkErr)
+		return
+	}
+	changes := diffSnapshots(w.files, current)
+	w.files = current
+	for _, c := range changes {
+		fields := map[string]any{
+			"command": watchCommandName,
+			"file":    c.path,
+			"change":  c.change,
+		}
+		if c.from != "" {
+			fields["from"] = c.from
+			w.pending[filepath.Dir(c.from)] = true
+		}
+		o.Log(output.Info, "track file changed", fields)
+		w.pending[filepath.Dir(c.path)] = true
+		w.lastChange = now
+	}
+	if len(w.pending) != 0 && now.Sub(w.lastChange) >= w.ws.quiet {
+		albumDirs := w.pending
+		w.pending = map[string]bool{}
+		w.rescan(ctx, o, albumDirs)
+	}
+}
+
+func (w *watcher) reportWalkError(o output.Bus, walkErr error) {
+	o.ErrorPrintf("The directory %q cannot be read: %s.\n", w.ss.musicDir, cmdtoolkit.ErrorToString(walkErr))
+	o.Log(output.Error, "cannot read directory", map[string]any{
+		"command":   watchCommandName,
+		"directory": w.ss.musicDir,
+		"error":     walkErr,
+	})
+}
+
+// snapshot records the track files in the album directories of the music
+// directory; deeper directories, such as backup directories, are ignored
+func (w *watcher) snapshot() (map[string]fileState, error) {
+	states := map[string]fileState{}
+	root := w.ss.musicDir
+	walkErr := walkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// the directory may have been removed while it was being read
+			return nil
+		}
+		depth := 0
+		if rel, relErr := filepath.Rel(root, path); relErr == nil && rel != "." {
+			depth = len(strings.Split(rel, string(filepath.Separator)))
+		}
+		if d.IsDir() {
+			if depth > 2 {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if depth != 3 || !slices.Contains(w.ss.fileExtensions, filepath.Ext(path)) {
+			return nil
+		}
+		if info, infoErr := d.Info(); infoErr == nil {
+			states[path] = fileState{size: info.Size(), modTime: info.ModTime()}
+		}
+		return nil
+	})
+	return states, walkErr
+}
+
+// diffSnapshots compares two snapshots; a removed file and a created file with
+// the same size and modification time are reported as a single rename
+func diffSnapshots(previous, current map[string]fileState) []fileChange {
+	var created, removed []string
+	var changes []fileChange
+	for path, state := range current {
+		if oldState, found := previous[path]; !found {
+			created = append(created, path)
+		} else if oldState.size != state.size || !oldState.modTime.Equal(state.modTime) {
+			changes = append(changes, fileChange{path: path, change: fileModified})
+		}
+	}
+	for path := range previous {
+		if _, found := current[path]; !found {
+			removed = append(removed, path)
+		}
+	}
+	slices.Sort(created)
+	slices.Sort(removed)
+	renamed := map[string]bool{}
+	for _, path := range created {
+		from := slices.IndexFunc(removed, func(old string) bool {
+			return !renamed[old] && previous[old].size == current[path].size &&
+				previous[old].modTime.Equal(current[path].modTime)
+		})
+		if from == -1 {
+			changes = append(changes, fileChange{path: path, change: fileCreated})
+			continue
+		}
+		renamed[removed[from]] = true
+		changes = append(changes, fileChange{path: path, from: removed[from], change: fileRenamed})
+	}
+	for _, path := range removed {
+		if !renamed[path] {
+			changes = append(changes, fileChange{path: path, change: fileRemoved})
+		}
+	}
+	slices.SortFunc(changes, func(a, b fileChange) int { return strings.Compare(a.path, b.path) })
+	return changes
+}
+
+// rescan scans the albums in the specified directories, reports concerns that
+// have not been reported before, and rewrites new albums if so requested
+func (w *watcher) rescan(ctx context.Context, o output.Bus, albumDirs map[string]bool) {
+	var selected []*files.Artist
+	if artists := w.ss.load(ctx, o); len(artists) != 0 {
+		selected = selectAlbumDirectories(w.ss.filter(o, artists), albumDirs)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	w.forgetRemovedAlbums(selected, albumDirs)
+	if len(selected) == 0 {
+		return
+	}
+	applyNameEquivalence(selected, w.ws.names)
+	readMetadata(ctx, o, selected, w.ios.openFileLimit)
+	if ctx.Err() != nil {
+		return
+	}
+	if w.ws.suppressions != nil {
+		w.ws.suppressions.suppressFields(selected, currentTime())
+	}
+	concernedArtists := createConcernedArtists(selected)
+	scanSets := &scanSettings{
+		empty:     cmdtoolkit.CommandFlag[bool]{Value: true},
+		files:     cmdtoolkit.CommandFlag[bool]{Value: true},
+		numbering: cmdtoolkit.CommandFlag[bool]{Value: true},
+	}
+	scanSets.performEmptyAnalysis(concernedArtists)
+	scanSets.performNumberingAnalysis(concernedArtists)
+	for _, artist := range selected {
+		for _, album := range artist.Albums() {
+			for _, track := range album.Tracks() {
+				concerns := append(track.ReportMetadataProblems(), track.ID3V2FormatProblems()...)
+				if w.ws.framePolicy != nil {
+					concerns = append(concerns,
+						track.FramePolicyViolations(w.ws.framePolicy.forArtist(artist.Name()))...)
+				}
+				recordTrackFileConcerns(concernedArtists, track, concerns)
+			}
+		}
+	}
+	if w.ws.suppressions != nil {
+		w.ws.suppressions.hide(concernedArtists, currentTime())
+	}
+	newConcerns := 0
+	var albumCount int
+	for _, cAr := range concernedArtists {
+		cAr.rollup()
+		for _, cAl := range cAr.albums() {
+			albumCount++
+			newConcerns += w.reportNewConcerns(o, cAl)
+			if w.ws.rewrite.Value {
+				w.maybeRewrite(ctx, o, cAr.backingArtist(), cAl)
+			}
+		}
+	}
+	if newConcerns == 0 {
+		o.ConsolePrintf("Scanned %d changed album(s); no new concerns were found.\n", albumCount)
+	}
+}
+
+// selectAlbumDirectories copies the albums in the specified directories,
+// grouped by artist
+func selectAlbumDirectories(artists []*files.Artist, albumDirs map[string]bool) []*files.Artist {
+	var selected []*files.Artist
+	for _, artist := range artists {
+		var artistCopy *files.Artist
+		for _, album := range artist.Albums() {
+			if !albumDirs[album.Directory()] {
+				continue
+			}
+			if artistCopy == nil {
+				artistCopy = artist.Copy()
+				selected = append(selected, artistCopy)
+			}
+			album.Copy(artistCopy, true, true)
+		}
+	}
+	return selected
+}
+
+// forgetRemovedAlbums discards what was reported for changed albums that no
+// longer exist
+func (w *watcher) forgetRemovedAlbums(selected []*files.Artist, albumDirs map[string]bool) {
+	remaining := map[string]bool{}
+	for _, artist := range selected {
+		for _, album := range artist.Albums() {
+			remaining[album.Directory()] = true
+		}
+	}
+	for dir := range albumDirs {
+		if !remaining[dir] {
+			delete(w.reported, dir)
+		}
+	}
+}
+
+// albumConcerns lists an album's concerns, and those of its tracks, one per
+// line
+func albumConcerns(cAl *concernedAlbum) []string {
+	report := cAl.toReport()
+	lines := concernLines("", report.Concerns)
+	for _, track := range report.Children {
+		lines = append(lines, concernLines(fmt.Sprintf("Track %q: ", track.Name), track.Concerns)...)
+	}
+	return lines
+}
+
+func concernLines(prefix string, concerns map[string][]string) []string {
+	var lines []string
+	for _, kind := range slices.Sorted(maps.Keys(concerns)) {
+		for _, issue := range concerns[kind] {
+			lines = append(lines, fmt.Sprintf("%s[%s] %s", prefix, kind, issue))
+		}
+	}
+	return lines
+}
+
+// reportNewConcerns writes the album's concerns that have not been reported
+// before, and returns how many there were
+func (w *watcher) reportNewConcerns(o output.Bus, cAl *concernedAlbum) int {
+	album := cAl.backingAlbum()
+	lines := albumConcerns(cAl)
+	previous := w.reported[album.Directory()]
+	w.reported[album.Directory()] = lines
+	var fresh []string
+	for _, line := range lines {
+		if !slices.Contains(previous, line) {
+			fresh = append(fresh, line)
+		}
+	}
+	if len(fresh) == 0 {
+		return 0
+	}
+	o.ConsolePrintf("New concerns in album %q by %q:\n", album.Title(), album.RecordingArtistName())
+	o.IncrementTab(2)
+	for _, line := range fresh {
+		o.ConsolePrintf("* %s\n", line)
+		o.Log(output.Warning, "new concern", map[string]any{
+			"command":   watchCommandName,
+			"directory": album.Directory(),
+			"concern":   line,
+		})
+	}
+	o.DecrementTab(2)
+	return len(fresh)
+}
+
+// maybeRewrite rewrites an album created while watching, if the album is safe
+// to rewrite
+func (w *watcher) maybeRewrite(ctx context.Context, o output.Bus, artist *files.Artist, cAl *concernedAlbum) {
+	album := cAl.backingAlbum()
+	if w.knownAlbums[album.Directory()] {
+		return
+	}
+	if reason := unsafeToRewrite(cAl); reason != "" {
+		o.ConsolePrintf("Album %q by %q will not be rewritten: %s.\n", album.Title(),
+			album.RecordingArtistName(), reason)
+		return
+	}
+	// scan a fresh copy of the album, so that only what the rewrite command
+	// would fix is rewritten
+	artistCopy := artist.Copy()
+	album.Copy(artistCopy, true, true)
+	concernedArtists := createConcernedArtists([]*files.Artist{artistCopy})
+	count := findConflictedTracks(concernedArtists) + findMisformattedTracks(concernedArtists) +
+		findUncleanTracks(concernedArtists, w.ws.framePolicy)
+	if count > w.ws.maxRewrites {
+		o.ConsolePrintf("Album %q by %q will not be rewritten: %d tracks need to be rewritten, but %s is %d.\n",
+			album.Title(), album.RecordingArtistName(), count, watchMaxRewritesFlag, w.ws.maxRewrites)
+		return
+	}
+	// whatever the outcome, the album is not rewritten again
+	w.knownAlbums[album.Directory()] = true
+	if count == 0 {
+		return
+	}
+	o.ConsolePrintf("Rewriting album %q by %q.\n", album.Title(), album.RecordingArtistName())
+	if rewriteErr := backupAndRewriteTracks(ctx, o, concernedArtists, w.ios.openFileLimit, false,
+		nil); rewriteErr != nil {
+		o.ErrorPrintf("Album %q by %q could not be completely rewritten.\n", album.Title(),
+			album.RecordingArtistName())
+		o.Log(output.Error, "cannot rewrite album", map[string]any{
+			"command":   watchCommandName,
+			"directory": album.Directory(),
+			"error":     rewriteErr,
+		})
+	}
+}
+
+// unsafeToRewrite explains why an album should not be rewritten automatically,
+// or returns an empty string if it is safe to rewrite
+func unsafeToRewrite(cAl *concernedAlbum) string {
+	unsafeConcerns := []concernType{emptyConcern, numberingConcern}
+	for _, source := range unsafeConcerns {
+		if len(cAl.concerns.concernsCollection[source]) != 0 {
+			return fmt.Sprintf("the album has %s concerns", concernName(source))
+		}
+		for _, cT := range cAl.tracks() {
+			if len(cT.concerns.concernsCollection[source]) != 0 {
+				return fmt.Sprintf("the album has %s concerns", concernName(source))
+			}
+		}
+	}
+	return ""
+}
+
+func processWatchFlags(o output.Bus, values map[string]*cmdtoolkit.CommandFlag[any]) (*watchSettings, bool) {
+	ws := &watchSettings{}
+	flagsOk := true // optimistic
+	var flagErr error
+	if rawValue, intErr := cmdtoolkit.GetInt(o, values, watchInterval); intErr == nil {
+		ws.interval = time.Duration(constrainBoundedValue(o, watchIntervalFlag, rawValue.Value,
+			watchIntervalBounds)) * time.Second
+	} else {
+		flagsOk = false
+	}
+	if rawValue, intErr := cmdtoolkit.GetInt(o, values, watchQuiet); intErr == nil {
+		ws.quiet = time.Duration(constrainBoundedValue(o, watchQuietFlag, rawValue.Value,
+			watchQuietBounds)) * time.Second
+	} else {
+		flagsOk = false
+	}
+	if ws.rewrite, flagErr = cmdtoolkit.GetBool(o, values, watchRewrite); flagErr != nil {
+		flagsOk = false
+	}
+	if rawValue, intErr := cmdtoolkit.GetInt(o, values, watchMaxRewrites); intErr == nil {
+		ws.maxRewrites = constrainBoundedValue(o, watchMaxRewritesFlag, rawValue.Value, watchRewriteBounds)
+	} else {
+		flagsOk = false
+	}
+	if sups, suppressionsOk := evaluateSuppressions(o, values); suppressionsOk {
+		ws.suppressions = sups
+	} else {
+		flagsOk = false
+	}
+	if policies, policiesOk := evaluateFramePolicies(o, values); policiesOk {
+		ws.framePolicy = policies
+	} else {
+		flagsOk = false
+	}
+	return ws, flagsOk
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	cmdtoolkit.AddDefaults(watchFlags)
+	cmdtoolkit.AddFlags(getBus(), getConfiguration(), watchCmd.Flags(), watchFlags, searchFlags, ioFlags,
+		namesFlags, id3v2Flags)
+}
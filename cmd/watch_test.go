@@ -0,0 +1,448 @@
+/*
+ * Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"mp3repair/internal/files"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+func Test_processWatchFlags(t *testing.T) {
+	tests := map[string]struct {
+		values map[string]*cmdtoolkit.CommandFlag[any]
+		want   *watchSettings
+		want1  bool
+		output.WantedRecording
+	}{
+		"no data": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{},
+			want:   &watchSettings{},
+			want1:  false,
+			WantedRecording: output.WantedRecording{
+				Error: "" +
+					"An internal error occurred: flag \"interval\" is not found.\n" +
+					"An internal error occurred: flag \"quiet\" is not found.\n" +
+					"An internal error occurred: flag \"rewrite\" is not found.\n" +
+					"An internal error occurred: flag \"maxRewrites\" is not found.\n" +
+					"An internal error occurred: flag \"suppressions\" is not found.\n" +
+					"An internal error occurred: flag \"framePolicy\" is not found.\n",
+				Log: "" +
+					"level='error' error='flag not found' flag='interval' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='quiet' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='rewrite' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='maxRewrites' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='suppressions' msg='internal error'\n" +
+					"level='error' error='flag not found' flag='framePolicy' msg='internal error'\n",
+			},
+		},
+		"values": {
+			values: map[string]*cmdtoolkit.CommandFlag[any]{
+				watchInterval:    {Value: 0, UserSet: true},
+				watchQuiet:       {Value: 120, UserSet: true},
+				watchRewrite:     {Value: true, UserSet: true},
+				watchMaxRewrites: {Value: 12},
+				suppressionsFile: {Value: ""},
+				framePolicyFile:  {Value: ""},
+			},
+			want: &watchSettings{
+				interval:    time.Second,
+				quiet:       2 * time.Minute,
+				rewrite:     cmdtoolkit.CommandFlag[bool]{Value: true, UserSet: true},
+				maxRewrites: 12,
+			},
+			want1: true,
+			WantedRecording: output.WantedRecording{
+				Log: "level='warning'" +
+					" flag='--interval'" +
+					" providedValue='0'" +
+					" replacedBy='1'" +
+					" msg='user-supplied value replaced'\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			got, got1 := processWatchFlags(o, tt.values)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("processWatchFlags() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("processWatchFlags() got1 = %v, want %v", got1, tt.want1)
+			}
+			o.Report(t, "processWatchFlags()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_diffSnapshots(t *testing.T) {
+	then := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	later := then.Add(time.Hour)
+	previous := map[string]fileState{
+		"a.mp3": {size: 10, modTime: then},
+		"b.mp3": {size: 20, modTime: then},
+		"c.mp3": {size: 30, modTime: then},
+		"d.mp3": {size: 40, modTime: then},
+	}
+	current := map[string]fileState{
+		"a.mp3": {size: 10, modTime: then},
+		"b.mp3": {size: 20, modTime: later},
+		"e.mp3": {size: 30, modTime: then},
+		"f.mp3": {size: 50, modTime: later},
+	}
+	want := []fileChange{
+		{path: "b.mp3", change: fileModified},
+		{path: "d.mp3", change: fileRemoved},
+		{path: "e.mp3", from: "c.mp3", change: fileRenamed},
+		{path: "f.mp3", change: fileCreated},
+	}
+	if got := diffSnapshots(previous, current); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffSnapshots() = %v, want %v", got, want)
+	}
+	if got := diffSnapshots(current, current); len(got) != 0 {
+		t.Errorf("diffSnapshots() = %v, want no changes", got)
+	}
+}
+
+func writeWatchedTrack(t *testing.T, path string) {
+	t.Helper()
+	if mkdirErr := os.MkdirAll(filepath.Dir(path), 0o755); mkdirErr != nil {
+		t.Fatalf("cannot create %q: %v", filepath.Dir(path), mkdirErr)
+	}
+	if writeErr := os.WriteFile(path, []byte("track"), 0o644); writeErr != nil {
+		t.Fatalf("cannot write %q: %v", path, writeErr)
+	}
+}
+
+func newTestWatcher(musicDir string) *watcher {
+	return newWatcher(
+		&watchSettings{interval: time.Second, quiet: 30 * time.Second, maxRewrites: watchRewriteDefault},
+		&searchSettings{
+			artistFilter:   regexp.MustCompile(".*"),
+			albumFilter:    regexp.MustCompile(".*"),
+			trackFilter:    regexp.MustCompile(".*"),
+			fileExtensions: []string{".mp3"},
+			musicDir:       musicDir,
+		},
+		&ioSettings{openFileLimit: 1},
+	)
+}
+
+func Test_watcher_snapshot(t *testing.T) {
+	musicDir := t.TempDir()
+	albumDir := filepath.Join(musicDir, "artist", "album")
+	writeWatchedTrack(t, filepath.Join(albumDir, "1 track.mp3"))
+	writeWatchedTrack(t, filepath.Join(albumDir, "cover.jpg"))
+	writeWatchedTrack(t, filepath.Join(albumDir, "pre-repair-backup", "1.mp3"))
+	writeWatchedTrack(t, filepath.Join(musicDir, "artist", "stray.mp3"))
+	w := newTestWatcher(musicDir)
+	got, gotErr := w.snapshot()
+	if gotErr != nil {
+		t.Fatalf("watcher.snapshot() error = %v", gotErr)
+	}
+	if _, found := got[filepath.Join(albumDir, "1 track.mp3")]; !found || len(got) != 1 {
+		t.Errorf("watcher.snapshot() = %v, want only the track in the album directory", got)
+	}
+	w.ss.musicDir = filepath.Join(musicDir, "missing")
+	if _, gotErr = w.snapshot(); gotErr == nil {
+		t.Errorf("watcher.snapshot() found a missing directory")
+	}
+}
+
+func Test_watcher_poll(t *testing.T) {
+	musicDir := t.TempDir()
+	albumDir := filepath.Join(musicDir, "artist", "album")
+	writeWatchedTrack(t, filepath.Join(albumDir, "1 track.mp3"))
+	w := newTestWatcher(musicDir)
+	w.files, _ = w.snapshot()
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	// a new track is noticed, but the album is not scanned until the
+	// directory has been quiet
+	writeWatchedTrack(t, filepath.Join(albumDir, "3 another track.mp3"))
+	o := output.NewRecorder()
+	w.poll(context.Background(), o, start)
+	if o.ConsoleOutput() != "" || !w.pending[albumDir] {
+		t.Errorf("watcher.poll() scanned too soon: %q, pending %v", o.ConsoleOutput(), w.pending)
+	}
+	if !strings.Contains(o.LogOutput(), "change='created'") {
+		t.Errorf("watcher.poll() log = %q, want a created file", o.LogOutput())
+	}
+
+	// once quiet, the album is scanned and its concerns are reported
+	o = output.NewRecorder()
+	w.poll(context.Background(), o, start.Add(31*time.Second))
+	console := o.ConsoleOutput()
+	if !strings.Contains(console, "New concerns in album \"album\" by \"artist\":\n") ||
+		!strings.Contains(console, "* [numbering] missing tracks identified: 2\n") {
+		t.Errorf("watcher.poll() console = %q, want new concerns", console)
+	}
+	if len(w.pending) != 0 {
+		t.Errorf("watcher.poll() pending = %v, want none", w.pending)
+	}
+
+	// rescanning the album does not repeat the concerns
+	writeWatchedTrack(t, filepath.Join(albumDir, "1 track.mp3"))
+	w.files[filepath.Join(albumDir, "1 track.mp3")] = fileState{}
+	o = output.NewRecorder()
+	w.poll(context.Background(), o, start.Add(time.Minute))
+	w.poll(context.Background(), o, start.Add(2*time.Minute))
+	if got, want := o.ConsoleOutput(), "Scanned 1 changed album(s); no new concerns were found.\n"; got != want {
+		t.Errorf("watcher.poll() console = %q, want %q", got, want)
+	}
+}
+
+func Test_watcher_run(t *testing.T) {
+	w := newTestWatcher(filepath.Join(t.TempDir(), "missing"))
+	ctx, stop := context.WithCancel(context.Background())
+	o := output.NewRecorder()
+	if got := w.run(ctx, o); got == nil {
+		t.Errorf("watcher.run() = nil, want an error for a missing directory")
+	}
+	if !strings.Contains(o.ErrorOutput(), "cannot be read") {
+		t.Errorf("watcher.run() error output = %q", o.ErrorOutput())
+	}
+	musicDir := t.TempDir()
+	writeWatchedTrack(t, filepath.Join(musicDir, "artist", "album", "1 track.mp3"))
+	w = newTestWatcher(musicDir)
+	stop()
+	o = output.NewRecorder()
+	if got := w.run(ctx, o); got != nil {
+		t.Errorf("watcher.run() = %v, want nil", got)
+	}
+	wantConsole := fmt.Sprintf("Watching %q for changes; press Ctrl+C to stop.\n", musicDir) +
+		"Stopped watching.\n"
+	if got := o.ConsoleOutput(); got != wantConsole {
+		t.Errorf("watcher.run() console = %q, want %q", got, wantConsole)
+	}
+	if !w.knownAlbums[filepath.Join(musicDir, "artist", "album")] {
+		t.Errorf("watcher.run() known albums = %v", w.knownAlbums)
+	}
+}
+
+func Test_unsafeToRewrite(t *testing.T) {
+	var album *files.Album
+	if artists := generateArtists(1, 1, 2, nil); len(artists) > 0 {
+		album = artists[0].Albums()[0]
+	}
+	clean := newConcernedAlbum(album)
+	conflicted := newConcernedAlbum(album)
+	conflicted.tracks()[0].addConcern(filesConcern, "the year field does not match")
+	misnumbered := newConcernedAlbum(album)
+	misnumbered.tracks()[1].addConcern(numberingConcern, "duplicate track 1")
+	empty := newConcernedAlbum(album)
+	empty.addConcern(emptyConcern, "no tracks")
+	tests := map[string]struct {
+		cAl  *concernedAlbum
+		want string
+	}{
+		"clean":       {cAl: clean, want: ""},
+		"conflicted":  {cAl: conflicted, want: ""},
+		"misnumbered": {cAl: misnumbered, want: "the album has numbering concerns"},
+		"empty":       {cAl: empty, want: "the album has empty concerns"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := unsafeToRewrite(tt.cAl); got != tt.want {
+				t.Errorf("unsafeToRewrite() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_watcher_maybeRewrite(t *testing.T) {
+	var artist *files.Artist
+	if artists := generateArtists(1, 1, 2, nil); len(artists) > 0 {
+		artist = artists[0]
+	}
+	album := artist.Albums()[0]
+	misnumbered := newConcernedAlbum(album)
+	misnumbered.tracks()[1].addConcern(numberingConcern, "duplicate track 1")
+	tests := map[string]struct {
+		known bool
+		output.WantedRecording
+	}{
+		"known album": {known: true},
+		"unsafe album": {
+			WantedRecording: output.WantedRecording{
+				Console: "Album \"my album 00\" by \"my artist 0\" will not be rewritten: " +
+					"the album has numbering concerns.\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := newTestWatcher("Music")
+			w.knownAlbums[album.Directory()] = tt.known
+			o := output.NewRecorder()
+			w.maybeRewrite(context.Background(), o, artist, misnumbered)
+			if w.knownAlbums[album.Directory()] != tt.known {
+				t.Errorf("watcher.maybeRewrite() marked the album as known")
+			}
+			o.Report(t, "watcher.maybeRewrite()", tt.WantedRecording)
+		})
+	}
+}
+
+func Test_watcher_maybeRewrite_failure(t *testing.T) {
+	// the tracks' metadata conflicts with their names, and the tracks do not
+	// exist, and so cannot be backed up
+	metadata := (&files.TrackMetadataMaker{
+		Artist:      "other artist",
+		Album:       "other album",
+		TrackName:   "other track",
+		TrackNumber: 1,
+		Source:      files.ID3V2,
+	}).MakeMetadata()
+	var artist *files.Artist
+	if artists := generateArtists(1, 1, 2, metadata); len(artists) > 0 {
+		artist = artists[0]
+	}
+	album := artist.Albums()[0]
+	w := newTestWatcher("Music")
+	o := output.NewRecorder()
+	w.maybeRewrite(context.Background(), o, artist, newConcernedAlbum(album))
+	if !w.knownAlbums[album.Directory()] {
+		t.Errorf("watcher.maybeRewrite() did not mark the album as known")
+	}
+	// the backup failure is described in platform-specific terms
+	wantError := "Album \"my album 00\" by \"my artist 0\" could not be completely rewritten.\n"
+	if got := o.ErrorOutput(); !strings.HasSuffix(got, wantError) {
+		t.Errorf("watcher.maybeRewrite() error output = %q, want it to end with %q", got, wantError)
+	}
+	wantLog := "level='error'" +
+		" command='watch'" +
+		" directory='" + album.Directory() + "'" +
+		" error='command \"rewrite\" terminated with an error (system call failed)'" +
+		" msg='cannot rewrite album'\n"
+	if got := o.LogOutput(); !strings.HasSuffix(got, wantLog) {
+		t.Errorf("watcher.maybeRewrite() log output = %q, want it to end with %q", got, wantLog)
+	}
+}
+
+func Test_albumConcerns(t *testing.T) {
+	var album *files.Album
+	if artists := generateArtists(1, 1, 2, nil); len(artists) > 0 {
+		album = artists[0].Albums()[0]
+	}
+	cAl := newConcernedAlbum(album)
+	cAl.addConcern(numberingConcern, "missing track 3")
+	cAl.tracks()[1].addConcern(filesConcern, "no metadata")
+	want := []string{
+		"[numbering] missing track 3",
+		"Track \"my track 002\": [files] no metadata",
+	}
+	if got := albumConcerns(cAl); !reflect.DeepEqual(got, want) {
+		t.Errorf("albumConcerns() = %v, want %v", got, want)
+	}
+}
+
+func Test_watch_Help(t *testing.T) {
+	originalSearchFlags := searchFlags
+	originalMusicDir := xdg.UserDirs.Music
+	defer func() {
+		searchFlags = originalSearchFlags
+		xdg.UserDirs.Music = originalMusicDir
+	}()
+	searchFlags = safeSearchFlags
+	xdg.UserDirs.Music = "."
+	commandUnderTest := cloneCommand(watchCmd)
+	cmdtoolkit.AddFlags(output.NewNilBus(), cmdtoolkit.EmptyConfiguration(),
+		commandUnderTest.Flags(), watchFlags, searchFlags, ioFlags, namesFlags, id3v2Flags)
+	tests := map[string]struct {
+		output.WantedRecording
+	}{
+		"good": {
+			WantedRecording: output.WantedRecording{
+				Console: "" +
+					"\"watch\" monitors the music directory for mp3 files that are created, renamed,\n" +
+					"modified, or removed\n" +
+					"\n" +
+					"Once the music directory has been quiet for a while, the albums containing the changed\n" +
+					"files are scanned as the scan command would, and concerns that were not\n" +
+					"reported before are written to the console and to the log.\n" +
+					"\n" +
+					"If --rewrite is set, albums that were created while watching are also rewritten as the\n" +
+					"rewrite command would, provided that they are safe to rewrite:\n" +
+					"\n" +
+					"* the scan found no empty or numbering concerns in the album, and\n" +
+					"* no more than --maxRewrites of the album's tracks need to be rewritten.\n" +
+					"\n" +
+					"Scans and rewrites use the suppressions, frame policy, and ID3V2 settings, as the\n" +
+					"scan and rewrite commands do.\n" +
+					"\n" +
+					"Each album is rewritten at most once. Press Ctrl+C to stop watching.\n" +
+					"\n" +
+					"Usage:\n" +
+					"  watch [--interval seconds] [--quiet seconds] [--rewrite] [--maxRewrites count] [--suppressions " +
+					"file] [--framePolicy file] [--albumFilter regex] [--artistFilter regex] [--trackFilter regex] " +
+					"[--extensions extensions] [--maxOpenFiles count] [--aliases aliases] [--ampersand] [--foldCase] " +
+					"[--invertArticles] [--normalizeUnicode] [--id3v2Version version] [--id3v2Encoding encoding]\n" +
+					"\n" +
+					"Examples:\n" +
+					"watch\n" +
+					"  Report new concerns in albums as they change\n" +
+					"watch --quiet 120 --rewrite\n" +
+					"  Wait for two minutes without changes before scanning, and rewrite new albums\n" +
+					"\n" +
+					"Flags:\n" +
+					"      --albumFilter string     regular expression specifying which albums to select (default \".*\")\n" +
+					"      --aliases string         semicolon-delimited list of alias=preferred name pairs for artist " +
+					"and album names (default \"\")\n" +
+					"      --ampersand              treat '&' and 'and' as equal in artist and album names (default " +
+					"false)\n" +
+					"      --artistFilter string    regular expression specifying which artists to select (default \".*\")\n" +
+					"      --extensions string      comma-delimited list of file extensions used by mp3 files (default " +
+					"\".mp3\")\n" +
+					"      --foldCase               treat artist and album names differing only in letter case as equal " +
+					"(default false)\n" +
+					"      --framePolicy string     the path of a YAML file listing the ID3V2 frames that tags may or " +
+					"must contain; if empty, no frame policy is applied (default \"\")\n" +
+					"      --id3v2Encoding string   text encoding of rewritten ID3V2 tags: keep (each frame's own " +
+					"encoding), iso-8859-1, utf-16, or utf-8 (2.4 only) (default \"keep\")\n" +
+					"      --id3v2Version string    ID3V2 version of rewritten tags: keep (each tag's own version), 2.3, " +
+					"or 2.4 (default \"keep\")\n" +
+					"      --interval int           the number of seconds between checks for changed files (at least 1, " +
+					"at most 3600, default 5) (default 5)\n" +
+					"      --invertArticles         treat artist and album names such as 'Beatles, The' and 'The " +
+					"Beatles' as equal (default false)\n" +
+					"      --maxOpenFiles int       the maximum number of files that can be read simultaneously (at " +
+					"least 1, at most 32767, default 1000) (default 1000)\n" +
+					"      --maxRewrites int        the largest number of tracks in a new album that may be rewritten " +
+					"(at least 1, at most 1000, default 20) (default 20)\n" +
+					"      --normalizeUnicode       treat the NFC and NFD forms of artist and album names as equal " +
+					"(default false)\n" +
+					"      --quiet int              the number of seconds without changes before changed albums are " +
+					"scanned (at least 1, at most 3600, default 30) (default 30)\n" +
+					"      --rewrite                rewrite albums created while watching, if they are safe to rewrite " +
+					"(default false)\n" +
+					"      --suppressions string    the path of a YAML file listing concerns that are known and " +
+					"accepted; if empty, no concerns are suppressed (default \"\")\n" +
+					"      --trackFilter string     regular expression specifying which tracks to select (default \".*\")\n",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := output.NewRecorder()
+			command := commandUnderTest
+			enableCommandRecording(o, command)
+			_ = command.Help()
+			o.Report(t, "watch Help()", tt.WantedRecording)
+		})
+	}
+}
@@ -100,6 +100,17 @@ func (a *Album) HasTracks() bool {
 	return len(a.tracks) != 0
 }
 
+// MetadataRead returns true if the metadata of every one of the album's tracks
+// has been read
+func (a *Album) MetadataRead() bool {
+	for _, t := range a.tracks {
+		if t.needsMetadata() {
+			return false
+		}
+	}
+	return true
+}
+
 func (a *Album) subDirectory(s string) string {
 	return filepath.Join(a.directory, s)
 }
@@ -225,6 +225,37 @@ func TestAlbum_HasTracks(t *testing.T) {
 	}
 }
 
+func TestAlbum_MetadataRead(t *testing.T) {
+	tests := map[string]struct {
+		a    *Album
+		want bool
+	}{
+		"empty": {
+			a:    &Album{},
+			want: true,
+		},
+		"all tracks read": {
+			a: &Album{
+				tracks: []*Track{{metadata: newTrackMetadata()}, {metadata: newTrackMetadata()}},
+			},
+			want: true,
+		},
+		"some tracks not read": {
+			a: &Album{
+				tracks: []*Track{{metadata: newTrackMetadata()}, {}},
+			},
+			want: false,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.a.MetadataRead(); got != tt.want {
+				t.Errorf("Album.MetadataRead() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestAlbum_Tracks(t *testing.T) {
 	type fields struct {
 		tracks          []*Track
@@ -16,6 +16,9 @@ type Artist struct {
 	name       string
 	directory  string
 	sharedName string
+	// the rules for comparing the names of the artist and its albums with
+	// their metadata
+	equivalence NameEquivalence
 }
 
 func (a *Artist) canonicalName() string { return a.sharedName }
@@ -34,9 +37,16 @@ func NewArtistFromFile(f fs.FileInfo, dir string) *Artist {
 func (a *Artist) Copy() *Artist {
 	a2 := NewArtist(a.name, a.directory)
 	a2.sharedName = a.sharedName
+	a2.equivalence = a.equivalence
 	return a2
 }
 
+// SetNameEquivalence sets the rules used to compare the names of the artist
+// and its albums with their metadata
+func (a *Artist) SetNameEquivalence(e NameEquivalence) {
+	a.equivalence = e
+}
+
 // NewArtist creates a new instance of Artist
 func NewArtist(name, directory string) *Artist {
 	return &Artist{name: name, directory: directory, sharedName: name}
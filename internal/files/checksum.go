@@ -0,0 +1,135 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"sync"
+	"time"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+)
+
+const (
+	apeTagFooterLength  = 32
+	apeTagHeaderLength  = 32
+	apeTagHasHeaderFlag = 1 << 31
+)
+
+// AudioChecksum returns the SHA-256 checksum, in hexadecimal, of the file's
+// audio payload: the content between the ID3V2 tags at its start and any APE
+// tag, ID3V2 tag, or ID3V1 tag at its end. Rewriting the file's tags does not
+// change the checksum.
+func AudioChecksum(path string) (string, error) {
+	checksum, _, err := readAudio(path)
+	return checksum, err
+}
+
+// readAudio returns the checksum and the estimated duration of the file's
+// audio payload
+func readAudio(path string) (string, time.Duration, error) {
+	file, openErr := cmdtoolkit.FileSystem().Open(path)
+	if openErr != nil {
+		return "", 0, openErr
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	stat, statErr := file.Stat()
+	if statErr != nil {
+		return "", 0, statErr
+	}
+	layout := readID3V2Layout(file, stat.Size())
+	audioEnd := layout.audioEnd - apeTagLength(file, layout.audioStart, layout.audioEnd)
+	hash := sha256.New()
+	audio := io.NewSectionReader(file, layout.audioStart, audioEnd-layout.audioStart)
+	if _, copyErr := io.Copy(hash, audio); copyErr != nil {
+		return "", 0, copyErr
+	}
+	return hex.EncodeToString(hash.Sum(nil)), audioDuration(file, layout.audioStart, audioEnd), nil
+}
+
+// apeTagLength returns the length of the APE tag, if any, that ends at the end
+// of the audio, including its header and footer
+func apeTagLength(r io.ReaderAt, audioStart, audioEnd int64) int64 {
+	if audioEnd-audioStart < apeTagFooterLength {
+		return 0
+	}
+	footer := make([]byte, apeTagFooterLength)
+	if _, readErr := r.ReadAt(footer, audioEnd-apeTagFooterLength); readErr != nil ||
+		string(footer[0:8]) != "APETAGEX" {
+		return 0
+	}
+	// the size includes the footer, but not the header
+	length := int64(binary.LittleEndian.Uint32(footer[12:16]))
+	if binary.LittleEndian.Uint32(footer[20:24])&apeTagHasHeaderFlag != 0 {
+		length += apeTagHeaderLength
+	}
+	if length < apeTagFooterLength || length > audioEnd-audioStart {
+		return 0
+	}
+	return length
+}
+
+// AudioChecksumResult is the audio checksum and estimated duration of a track,
+// or the error that prevented them from being computed; the duration is zero if
+// it cannot be estimated
+type AudioChecksumResult struct {
+	Track    *Track
+	Checksum string
+	Duration time.Duration
+	Err      error
+}
+
+// ComputeAudioChecksums computes the audio checksums of all the artists'
+// tracks, with at most fileLimit files open at once. If the context is
+// cancelled, no further checksums are computed; the computations in progress
+// are allowed to finish, and the tracks that were not read are omitted from
+// the results.
+func ComputeAudioChecksums(
+	ctx context.Context,
+	o output.Bus,
+	artists []*Artist,
+	fileLimit int,
+) []AudioChecksumResult {
+	var tracks []*Track
+	for _, artist := range artists {
+		for _, album := range artist.Albums() {
+			tracks = append(tracks, album.tracks...)
+		}
+	}
+	o.ErrorPrintln("Computing audio checksums.")
+	results := make([]AudioChecksumResult, len(tracks))
+	openFiles := make(chan empty, fileLimit)
+	bar := NewTrackProgressBar(o, len(tracks))
+	var wg sync.WaitGroup
+	scheduled := 0
+	for k, track := range tracks {
+		if ctx.Err() != nil {
+			break
+		}
+		openFiles <- empty{} // block while full
+		wg.Go(func() {
+			defer func() {
+				bar.Increment()
+				<-openFiles // read to release a slot
+			}()
+			checksum, duration, checksumErr := readAudio(track.filePath)
+			results[k] = AudioChecksumResult{Track: track, Checksum: checksum, Duration: duration, Err: checksumErr}
+		})
+		scheduled++
+	}
+	wg.Wait()
+	bar.Finish()
+	if ctx.Err() != nil {
+		o.ErrorPrintln("Computing audio checksums was interrupted.")
+	}
+	return results[:scheduled]
+}
@@ -0,0 +1,135 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/majohn-r/output"
+	"github.com/spf13/afero"
+)
+
+// makeAPETag makes an APEv2 tag holding a single item, with an optional
+// header
+func makeAPETag(header bool) []byte {
+	item := []byte{5, 0, 0, 0, 0, 0, 0, 0}
+	item = append(item, "Title\x00title"...)
+	var flags uint32
+	if header {
+		flags = apeTagHasHeaderFlag
+	}
+	headerOrFooter := func(preamble uint32) []byte {
+		b := []byte("APETAGEX")
+		b = binary.LittleEndian.AppendUint32(b, 2000)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(item)+apeTagFooterLength))
+		b = binary.LittleEndian.AppendUint32(b, 1)
+		b = binary.LittleEndian.AppendUint32(b, flags|preamble)
+		return append(b, make([]byte, 8)...)
+	}
+	var tag []byte
+	if header {
+		tag = headerOrFooter(1 << 29)
+	}
+	tag = append(tag, item...)
+	return append(tag, headerOrFooter(0)...)
+}
+
+func TestAudioChecksum(t *testing.T) {
+	originalFileSystem := cmdtoolkit.AssignFileSystem(afero.NewMemMapFs())
+	defer func() {
+		cmdtoolkit.AssignFileSystem(originalFileSystem)
+	}()
+	audio := bytes.Repeat([]byte{0xFF, 0xFB, 0x90, 0x64}, 64)
+	id3v1Trailer := append([]byte("TAG"), bytes.Repeat([]byte{'x'}, id3v1Length-3)...)
+	frames := [][]byte{
+		makeSizedTextFrame("TALB", "fine album", true),
+		makeSizedTextFrame("TIT2", "fine track", true),
+	}
+	contents := map[string][]byte{
+		"untagged": audio,
+		"tagged":   append(makeID3V2Tag(3, false, 100, makeSizedTextFrame("TIT2", "track", false)), audio...),
+		"stacked tags": append(append(makeID3V2Tag(4, false, 0, frames...), makeID3V2Tag(3, false, 0)...),
+			audio...),
+		"ID3V1 tag": append(append([]byte{}, audio...), id3v1Trailer...),
+		"appended tag": append(append(append([]byte{}, audio...), makeID3V2Tag(4, true, 0, frames...)...),
+			id3v1Trailer...),
+		"APE tag": append(append(append([]byte{}, audio...), makeAPETag(true)...), id3v1Trailer...),
+		"APE tag without header": append(append(makeID3V2Tag(3, false, 0, frames[0]), audio...),
+			makeAPETag(false)...),
+	}
+	want, _ := AudioChecksum("missing.mp3")
+	for name, content := range contents {
+		_ = createNamedFile(name+".mp3", content)
+		got, err := AudioChecksum(name + ".mp3")
+		if err != nil {
+			t.Errorf("AudioChecksum(%q) error = %v", name, err)
+			continue
+		}
+		if want == "" {
+			want = got
+		}
+		if got != want {
+			t.Errorf("AudioChecksum(%q) = %q, want %q", name, got, want)
+		}
+	}
+	_ = createNamedFile("other.mp3", append(makeID3V2Tag(3, false, 0, frames[1]), audio[4:]...))
+	if got, _ := AudioChecksum("other.mp3"); got == want {
+		t.Errorf("AudioChecksum() of different audio = %q, want a different checksum", got)
+	}
+	if _, err := AudioChecksum("missing.mp3"); err == nil {
+		t.Errorf("AudioChecksum() of a missing file returned no error")
+	}
+}
+
+func TestComputeAudioChecksums(t *testing.T) {
+	testDir := "computeAudioChecksums"
+	albumDir := filepath.Join(testDir, "my album")
+	_ = cmdtoolkit.Mkdir(testDir)
+	_ = cmdtoolkit.Mkdir(albumDir)
+	defer func() {
+		_ = os.RemoveAll(testDir)
+	}()
+	artist := NewArtist("my artist", testDir)
+	album := AlbumMaker{Title: "my album", Artist: artist, Directory: albumDir}.NewAlbum(true)
+	audio := bytes.Repeat([]byte{0xFF, 0xFB, 0x90, 0x64}, 64)
+	_ = createFileWithContent(albumDir, "1 tagged.mp3", append(makeID3V2Tag(3, false, 0,
+		makeSizedTextFrame("TIT2", "tagged", false)), audio...))
+	_ = createFileWithContent(albumDir, "2 untagged.mp3", audio)
+	for k, name := range []string{"tagged", "untagged", "missing"} {
+		TrackMaker{Album: album, FileName: fmt.Sprintf("%d %s.mp3", k+1, name), SimpleName: name, Number: k + 1}.
+			NewTrack(true)
+	}
+	want, _ := AudioChecksum(filepath.Join(albumDir, "2 untagged.mp3"))
+	o := output.NewRecorder()
+	results := ComputeAudioChecksums(context.Background(), o, []*Artist{artist}, 2)
+	if len(results) != 3 {
+		t.Fatalf("ComputeAudioChecksums() returned %d results, want 3", len(results))
+	}
+	for k, result := range results[:2] {
+		if result.Track != album.tracks[k] || result.Checksum != want || result.Err != nil {
+			t.Errorf("ComputeAudioChecksums() result %d = %v, want checksum %q", k, result, want)
+		}
+	}
+	if results[2].Err == nil {
+		t.Errorf("ComputeAudioChecksums() computed the checksum of a missing file")
+	}
+	o.Report(t, "ComputeAudioChecksums()", output.WantedRecording{Error: "Computing audio checksums.\n"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	o = output.NewRecorder()
+	if got := ComputeAudioChecksums(ctx, o, []*Artist{artist}, 2); len(got) != 0 {
+		t.Errorf("ComputeAudioChecksums() after cancellation returned %d results, want 0", len(got))
+	}
+	o.Report(t, "ComputeAudioChecksums()", output.WantedRecording{
+		Error: "Computing audio checksums.\nComputing audio checksums was interrupted.\n",
+	})
+}
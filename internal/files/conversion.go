@@ -0,0 +1,395 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+const (
+	attachedPictureFrame = "APIC"
+	dateFrame            = "TDAT"
+	originalYearFrame    = "TORY"
+	recordingTimeFrame   = "TDRC"
+	releaseTimeFrame     = "TDOR"
+	yearFrame            = "TYER"
+)
+
+// the text encodings that an ID3V2Conversion may require
+const (
+	// KeepEncoding keeps each frame's encoding, unless the tag's version does
+	// not support it
+	KeepEncoding  = "keep"
+	ISOEncoding   = "ISO-8859-1"
+	UTF16Encoding = "UTF-16"
+	UTF8Encoding  = "UTF-8"
+)
+
+// ID3V2Conversion describes how an ID3V2 tag is to be rewritten
+type ID3V2Conversion struct {
+	// Version is the ID3V2 version (3 or 4) that the tag is to be written as;
+	// the policy set by SetID3V2Policy may use 0 to keep each tag's version
+	Version byte
+	// Encoding is the text encoding (KeepEncoding, ISOEncoding, UTF16Encoding,
+	// or UTF8Encoding) that the tag's frames are to use; if empty, the
+	// encoding best suited to the version is used. ISO-8859-1 is only used for
+	// text that it can represent, and UTF-16 is used instead of UTF-8 for
+	// ID3V2.3 tags, which do not support UTF-8.
+	Encoding string
+	// MaxArtworkSize is the largest attached picture, in bytes, that is kept;
+	// if 0, all attached pictures are kept
+	MaxArtworkSize int
+}
+
+var (
+	errUnsupportedID3V2Version  = fmt.Errorf("unsupported ID3V2 version")
+	errUnsupportedID3V2Encoding = fmt.Errorf("unsupported ID3V2 text encoding")
+	// id3v2Policy is the ID3V2 version and text encoding that rewritten and
+	// newly created ID3V2 tags use
+	id3v2Policy = ID3V2Conversion{Encoding: KeepEncoding}
+)
+
+// SetID3V2Policy sets the ID3V2 version and text encoding that rewritten and
+// newly created ID3V2 tags are to use, and against which ID3V2 tags are
+// checked by Track.ID3V2FormatProblems; the policy's MaxArtworkSize is
+// ignored.
+func SetID3V2Policy(c ID3V2Conversion) {
+	c.MaxArtworkSize = 0
+	id3v2Policy = c
+}
+
+// Validate verifies that the conversion's version and encoding are supported,
+// and are supported together
+func (c ID3V2Conversion) Validate() error {
+	if c.Version != 3 && c.Version != 4 {
+		return fmt.Errorf("%w: %d", errUnsupportedID3V2Version, c.Version)
+	}
+	return c.validateEncoding()
+}
+
+func (c ID3V2Conversion) validateEncoding() error {
+	switch c.Encoding {
+	case "", KeepEncoding, ISOEncoding, UTF16Encoding:
+		return nil
+	case UTF8Encoding:
+		if c.Version == 3 {
+			return fmt.Errorf("%w: ID3V2.3 does not support %s", errUnsupportedID3V2Encoding, c.Encoding)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", errUnsupportedID3V2Encoding, c.Encoding)
+	}
+}
+
+// forVersion returns the conversion to use for a tag of the specified version
+func (c ID3V2Conversion) forVersion(version byte) ID3V2Conversion {
+	if c.Version == 0 {
+		c.Version = version
+	}
+	return c
+}
+
+// Apply rewrites the ID3V2 tag of the specified file: the tag's version is set,
+// text is re-encoded as needed for that version, frames whose identifiers
+// differ between ID3V2.3 and ID3V2.4 are renamed, and oversized attached
+// pictures are removed. The file's ID3V1 tag and audio are left intact.
+func (c ID3V2Conversion) Apply(path string) error {
+	if validationErr := c.Validate(); validationErr != nil {
+		return validationErr
+	}
+	tag, readErr := readID3V2Tag(path)
+	if readErr != nil {
+		return readErr
+	}
+	defer func() {
+		_ = tag.Close()
+	}()
+	c.convert(tag)
+	return tag.Save()
+}
+
+func (c ID3V2Conversion) convert(tag *id3v2.Tag) {
+	tag.SetVersion(c.Version)
+	c.renameDateFrames(tag)
+	for id, frames := range tag.AllFrames() {
+		converted := make([]id3v2.Framer, 0, len(frames))
+		for _, frame := range frames {
+			if frame = c.convertFrame(id, frame); frame != nil {
+				converted = append(converted, frame)
+			}
+		}
+		tag.DeleteFrames(id)
+		for _, frame := range converted {
+			tag.AddFrame(id, frame)
+		}
+	}
+}
+
+// renameDateFrames moves the year between the ID3V2.3 TYER and TORY frames and
+// the ID3V2.4 TDRC and TDOR frames; the recording day and month move between
+// the ID3V2.3 TDAT frame and the ID3V2.4 TDRC timestamp
+func (c ID3V2Conversion) renameDateFrames(tag *id3v2.Tag) {
+	renames := map[string]string{yearFrame: recordingTimeFrame, originalYearFrame: releaseTimeFrame}
+	if c.Version == 3 {
+		renames = map[string]string{recordingTimeFrame: yearFrame, releaseTimeFrame: originalYearFrame}
+	}
+	date := removeLeadingBOMs(tag.GetTextFrame(dateFrame).Text)
+	if c.Version == 4 {
+		// ID3V2.4 has no TDAT frame
+		tag.DeleteFrames(dateFrame)
+	}
+	for from, to := range renames {
+		frame := tag.GetTextFrame(from)
+		tag.DeleteFrames(from)
+		if frame.Text == "" || tag.GetTextFrame(to).Text != "" {
+			continue
+		}
+		text := removeLeadingBOMs(frame.Text)
+		switch {
+		case c.Version == 3 && len(text) > 4:
+			// ID3V2.3 years are exactly four characters; ID3V2.4 timestamps
+			// begin with the year
+			if ddmm, found := timestampDate(text); found && from == recordingTimeFrame && date == "" {
+				tag.AddTextFrame(dateFrame, frame.Encoding, ddmm)
+			}
+			text = text[:4]
+		case c.Version == 4 && from == yearFrame:
+			text = recordingTimestamp(text, date)
+		}
+		tag.AddTextFrame(to, frame.Encoding, text)
+	}
+}
+
+// recordingTimestamp combines an ID3V2.3 year (YYYY) and date (DDMM) into an
+// ID3V2.4 timestamp (YYYY-MM-DD); if the date is not usable, the year is
+// returned
+func recordingTimestamp(year, date string) string {
+	if len(year) != 4 || len(date) != 4 || strings.Trim(date, "0123456789") != "" {
+		return year
+	}
+	return fmt.Sprintf("%s-%s-%s", year, date[2:], date[:2])
+}
+
+// timestampDate extracts the ID3V2.3 date (DDMM) from an ID3V2.4 timestamp
+// (YYYY-MM-DD, optionally followed by a time)
+func timestampDate(timestamp string) (string, bool) {
+	if len(timestamp) < 10 || timestamp[4] != '-' || timestamp[7] != '-' {
+		return "", false
+	}
+	return timestamp[8:10] + timestamp[5:7], true
+}
+
+// convertFrame returns the frame re-encoded for the target version, or nil if
+// the frame is to be removed
+func (c ID3V2Conversion) convertFrame(id string, frame id3v2.Framer) id3v2.Framer {
+	switch f := frame.(type) {
+	case id3v2.TextFrame:
+		f.Text = removeLeadingBOMs(f.Text)
+		f.Encoding = c.encoding(f.Encoding, f.Text)
+		return f
+	case id3v2.CommentFrame:
+		f.Encoding = c.encoding(f.Encoding, f.Description, f.Text)
+		return f
+	case id3v2.UserDefinedTextFrame:
+		f.Encoding = c.encoding(f.Encoding, f.Description, f.Value)
+		return f
+	case id3v2.UnsynchronisedLyricsFrame:
+		f.Encoding = c.encoding(f.Encoding, f.ContentDescriptor, f.Lyrics)
+		return f
+	case id3v2.PictureFrame:
+		if id == attachedPictureFrame && c.MaxArtworkSize > 0 && len(f.Picture) > c.MaxArtworkSize {
+			return nil
+		}
+		f.Encoding = c.encoding(f.Encoding, f.Description)
+		return f
+	default:
+		return frame
+	}
+}
+
+// encoding selects the encoding for text currently written in the specified
+// encoding. Unless another encoding is required, ID3V2.4 tags use UTF-8, which
+// ID3V2.3 does not support; ID3V2.3 tags use ISO-8859-1 if the text can be
+// represented in it, and UTF-16 otherwise.
+func (c ID3V2Conversion) encoding(current id3v2.Encoding, text ...string) id3v2.Encoding {
+	switch c.Encoding {
+	case KeepEncoding:
+		if c.supports(current) {
+			return current
+		}
+	case UTF16Encoding:
+		return id3v2.EncodingUTF16
+	case ISOEncoding:
+		if representableAsISO(text...) {
+			return id3v2.EncodingISO
+		}
+		return id3v2.EncodingUTF16
+	}
+	if c.Version == 4 {
+		return id3v2.EncodingUTF8
+	}
+	if representableAsISO(text...) {
+		return id3v2.EncodingISO
+	}
+	return id3v2.EncodingUTF16
+}
+
+// supports determines whether the conversion's version supports the encoding;
+// ID3V2.3 supports only ISO-8859-1 and UTF-16 with a byte order mark
+func (c ID3V2Conversion) supports(e id3v2.Encoding) bool {
+	return c.Version == 4 || e.Equals(id3v2.EncodingISO) || e.Equals(id3v2.EncodingUTF16)
+}
+
+func representableAsISO(text ...string) bool {
+	for _, s := range text {
+		for _, r := range s {
+			if r > 0xFF {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// encodedText records the encoding of the text in an ID3V2 frame
+type encodedText struct {
+	id       string
+	encoding id3v2.Encoding
+	text     []string
+}
+
+// frameText returns the encoding and text of frames that contain encoded text
+func frameText(id string, frame id3v2.Framer) (encodedText, bool) {
+	switch f := frame.(type) {
+	case id3v2.TextFrame:
+		return encodedText{id: id, encoding: f.Encoding, text: []string{removeLeadingBOMs(f.Text)}}, true
+	case id3v2.CommentFrame:
+		return encodedText{id: id, encoding: f.Encoding, text: []string{f.Description, f.Text}}, true
+	case id3v2.UserDefinedTextFrame:
+		return encodedText{id: id, encoding: f.Encoding, text: []string{f.Description, f.Value}}, true
+	case id3v2.UnsynchronisedLyricsFrame:
+		return encodedText{id: id, encoding: f.Encoding, text: []string{f.ContentDescriptor, f.Lyrics}}, true
+	case id3v2.PictureFrame:
+		return encodedText{id: id, encoding: f.Encoding, text: []string{f.Description}}, true
+	default:
+		return encodedText{}, false
+	}
+}
+
+// encodingName returns a short name for an ID3V2 text encoding
+func encodingName(e id3v2.Encoding) string {
+	switch {
+	case e.Equals(id3v2.EncodingISO):
+		return ISOEncoding
+	case e.Equals(id3v2.EncodingUTF16):
+		return UTF16Encoding
+	case e.Equals(id3v2.EncodingUTF16BE):
+		return "UTF-16BE"
+	case e.Equals(id3v2.EncodingUTF8):
+		return UTF8Encoding
+	default:
+		return e.Name
+	}
+}
+
+// problems describes how a tag of the specified version, whose frames use the
+// specified encodings, deviates from the conversion
+func (c ID3V2Conversion) problems(version byte, frames []encodedText) []string {
+	var problems []string
+	if c.Version != 0 && version != c.Version {
+		problems = append(problems, fmt.Sprintf("the ID3V2 tag is version 2.%d, not 2.%d", version, c.Version))
+	}
+	target := c.forVersion(version)
+	// group the deviating frames by their current and required encodings
+	deviations := map[string][]string{}
+	for _, frame := range frames {
+		if want := target.encoding(frame.encoding, frame.text...); !want.Equals(frame.encoding) {
+			key := fmt.Sprintf("%s, not %s", encodingName(frame.encoding), encodingName(want))
+			if !slices.Contains(deviations[key], frame.id) {
+				deviations[key] = append(deviations[key], frame.id)
+			}
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(deviations)) {
+		ids := deviations[key]
+		slices.Sort(ids)
+		problems = append(problems, fmt.Sprintf("the ID3V2 %s frames are encoded as %s", strings.Join(ids, ", "), key))
+	}
+	return problems
+}
+
+// applyID3V2Policy converts the tag to the ID3V2 version and text encoding set
+// by SetID3V2Policy
+func applyID3V2Policy(tag *id3v2.Tag) {
+	id3v2Policy.forVersion(tag.Version()).convert(tag)
+}
+
+// ID3V2FormatProblems describes how the track's ID3V2 tag deviates from the
+// ID3V2 version and text encoding set by SetID3V2Policy; the track's metadata
+// must have been read.
+func (t *Track) ID3V2FormatProblems() []string {
+	if t.metadata == nil || t.metadata.id3v2Version == 0 {
+		return nil
+	}
+	return id3v2Policy.problems(t.metadata.id3v2Version, t.metadata.id3v2Text)
+}
+
+// mixedEncodings names the encoding of an ID3V2 tag whose frames' text is
+// encoded in more than one way
+const mixedEncodings = "mixed"
+
+// ID3V2Format returns the version of the track's ID3V2 tag and the encoding of
+// its frames' text, as collected when the track's metadata was read: the
+// encoding shared by all of the text, mixedEncodings if the text is encoded in
+// more than one way, or, for a tag without text, the version's default. It
+// reports false if the track has no readable ID3V2 tag.
+func (t *Track) ID3V2Format() (version byte, encoding string, ok bool) {
+	if t.metadata == nil || t.metadata.id3v2Version == 0 {
+		return 0, "", false
+	}
+	version = t.metadata.id3v2Version
+	for _, text := range t.metadata.id3v2Text {
+		switch name := encodingName(text.encoding); {
+		case encoding == "":
+			encoding = name
+		case encoding != name:
+			return version, mixedEncodings, true
+		}
+	}
+	if encoding == "" {
+		encoding = ISOEncoding
+		if version == 4 {
+			encoding = UTF8Encoding
+		}
+	}
+	return version, encoding, true
+}
+
+// ConvertID3V2Tag rewrites the track's ID3V2 tag with the ID3V2 version and
+// text encoding set by SetID3V2Policy, and then reads the track's metadata
+// again
+func (t *Track) ConvertID3V2Tag() error {
+	if t.metadata == nil {
+		return errMetadataNotRead
+	}
+	tag, readErr := readID3V2Tag(t.filePath)
+	if readErr != nil {
+		return readErr
+	}
+	defer func() {
+		_ = tag.Close()
+	}()
+	applyID3V2Policy(tag)
+	if saveErr := tag.Save(); saveErr != nil {
+		return saveErr
+	}
+	t.metadata = initializeMetadata(t.filePath)
+	return nil
+}
@@ -0,0 +1,399 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+package files
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bogem/id3v2/v2"
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/spf13/afero"
+)
+
+func TestID3V2Conversion_Apply(t *testing.T) {
+	// unfortunately, we cannot use a memory-mapped filesystem here, as the
+	// library used for updating ID3V2 tags is hardcoded to use the os file
+	// system.
+	originalFileSystem := cmdtoolkit.AssignFileSystem(afero.NewOsFs())
+	defer func() {
+		cmdtoolkit.AssignFileSystem(originalFileSystem)
+	}()
+	testDir := t.TempDir()
+	audio := []byte("convert this track")
+	frames := map[string]string{
+		"TALB": "Abbey Road",
+		"TIT2": "Come Together",
+		"TPE1": "The Beatles",
+		"TYER": "1969",
+	}
+	tests := map[string]struct {
+		conversion  ID3V2Conversion
+		wantErr     bool
+		wantVersion byte
+		wantFrames  map[string]string
+	}{
+		"unsupported version": {
+			conversion: ID3V2Conversion{Version: 2},
+			wantErr:    true,
+		},
+		"unsupported encoding": {
+			conversion: ID3V2Conversion{Version: 3, Encoding: UTF8Encoding},
+			wantErr:    true,
+		},
+		"to ID3V2.3": {
+			conversion:  ID3V2Conversion{Version: 3},
+			wantVersion: 3,
+			wantFrames: map[string]string{
+				"TALB": "Abbey Road",
+				"TIT2": "Come Together",
+				"TPE1": "The Beatles",
+				"TYER": "1969",
+				"TDRC": "",
+			},
+		},
+		"to ID3V2.4": {
+			conversion:  ID3V2Conversion{Version: 4},
+			wantVersion: 4,
+			wantFrames: map[string]string{
+				"TALB": "Abbey Road",
+				"TIT2": "Come Together",
+				"TPE1": "The Beatles",
+				"TDRC": "1969",
+				"TYER": "",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(testDir, name+".mp3")
+			if err := os.WriteFile(path, createID3v2TaggedData(audio, frames), cmdtoolkit.StdFilePermissions); err != nil {
+				t.Fatalf("ID3V2Conversion.Apply() cannot create test file: %v", err)
+			}
+			if err := tt.conversion.Apply(path); (err != nil) != tt.wantErr {
+				t.Errorf("ID3V2Conversion.Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			tag, err := readID3V2Tag(path)
+			if err != nil {
+				t.Fatalf("ID3V2Conversion.Apply() cannot read converted tag: %v", err)
+			}
+			defer func() {
+				_ = tag.Close()
+			}()
+			if got := tag.Version(); got != tt.wantVersion {
+				t.Errorf("ID3V2Conversion.Apply() version = %d, want %d", got, tt.wantVersion)
+			}
+			for id, want := range tt.wantFrames {
+				if got := tag.GetTextFrame(id).Text; got != want {
+					t.Errorf("ID3V2Conversion.Apply() frame %s = %q, want %q", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestID3V2Conversion_Apply_missingFile(t *testing.T) {
+	originalFileSystem := cmdtoolkit.AssignFileSystem(afero.NewMemMapFs())
+	defer func() {
+		cmdtoolkit.AssignFileSystem(originalFileSystem)
+	}()
+	err := ID3V2Conversion{Version: 3}.Apply("no such file.mp3")
+	if !errors.Is(err, afero.ErrFileNotFound) {
+		t.Errorf("ID3V2Conversion.Apply() error = %v, want %v", err, afero.ErrFileNotFound)
+	}
+}
+
+func TestID3V2Conversion_convertFrame(t *testing.T) {
+	picture := id3v2.PictureFrame{Encoding: id3v2.EncodingUTF8, Description: "cover", Picture: make([]byte, 10)}
+	tests := map[string]struct {
+		conversion ID3V2Conversion
+		id         string
+		frame      id3v2.Framer
+		want       id3v2.Framer
+	}{
+		"latin-1 text to ID3V2.3": {
+			conversion: ID3V2Conversion{Version: 3},
+			id:         "TIT2",
+			frame:      id3v2.TextFrame{Encoding: id3v2.EncodingUTF8, Text: "Café"},
+			want:       id3v2.TextFrame{Encoding: id3v2.EncodingISO, Text: "Café"},
+		},
+		"wide text to ID3V2.3": {
+			conversion: ID3V2Conversion{Version: 3},
+			id:         "TIT2",
+			frame:      id3v2.TextFrame{Encoding: id3v2.EncodingUTF8, Text: "猫"},
+			want:       id3v2.TextFrame{Encoding: id3v2.EncodingUTF16, Text: "猫"},
+		},
+		"text to ID3V2.4": {
+			conversion: ID3V2Conversion{Version: 4},
+			id:         "TIT2",
+			frame:      id3v2.TextFrame{Encoding: id3v2.EncodingISO, Text: "Something"},
+			want:       id3v2.TextFrame{Encoding: id3v2.EncodingUTF8, Text: "Something"},
+		},
+		"comment": {
+			conversion: ID3V2Conversion{Version: 3},
+			id:         "COMM",
+			frame:      id3v2.CommentFrame{Encoding: id3v2.EncodingUTF8, Language: "eng", Text: "fine"},
+			want:       id3v2.CommentFrame{Encoding: id3v2.EncodingISO, Language: "eng", Text: "fine"},
+		},
+		"small picture": {
+			conversion: ID3V2Conversion{Version: 3, MaxArtworkSize: 10},
+			id:         "APIC",
+			frame:      picture,
+			want: id3v2.PictureFrame{
+				Encoding:    id3v2.EncodingISO,
+				Description: "cover",
+				Picture:     make([]byte, 10),
+			},
+		},
+		"large picture": {
+			conversion: ID3V2Conversion{Version: 3, MaxArtworkSize: 9},
+			id:         "APIC",
+			frame:      picture,
+			want:       nil,
+		},
+		"keep supported encoding": {
+			conversion: ID3V2Conversion{Version: 4, Encoding: KeepEncoding},
+			id:         "TIT2",
+			frame:      id3v2.TextFrame{Encoding: id3v2.EncodingUTF16, Text: "Something"},
+			want:       id3v2.TextFrame{Encoding: id3v2.EncodingUTF16, Text: "Something"},
+		},
+		"keep unsupported encoding": {
+			conversion: ID3V2Conversion{Version: 3, Encoding: KeepEncoding},
+			id:         "TIT2",
+			frame:      id3v2.TextFrame{Encoding: id3v2.EncodingUTF8, Text: "Something"},
+			want:       id3v2.TextFrame{Encoding: id3v2.EncodingISO, Text: "Something"},
+		},
+		"latin-1 text to ISO-8859-1": {
+			conversion: ID3V2Conversion{Version: 4, Encoding: ISOEncoding},
+			id:         "TIT2",
+			frame:      id3v2.TextFrame{Encoding: id3v2.EncodingUTF8, Text: "Café"},
+			want:       id3v2.TextFrame{Encoding: id3v2.EncodingISO, Text: "Café"},
+		},
+		"wide text to ISO-8859-1": {
+			conversion: ID3V2Conversion{Version: 4, Encoding: ISOEncoding},
+			id:         "TIT2",
+			frame:      id3v2.TextFrame{Encoding: id3v2.EncodingUTF8, Text: "猫"},
+			want:       id3v2.TextFrame{Encoding: id3v2.EncodingUTF16, Text: "猫"},
+		},
+		"text to UTF-16": {
+			conversion: ID3V2Conversion{Version: 4, Encoding: UTF16Encoding},
+			id:         "TIT2",
+			frame:      id3v2.TextFrame{Encoding: id3v2.EncodingUTF8, Text: "Something"},
+			want:       id3v2.TextFrame{Encoding: id3v2.EncodingUTF16, Text: "Something"},
+		},
+		"text to UTF-8 in ID3V2.3": {
+			conversion: ID3V2Conversion{Version: 3, Encoding: UTF8Encoding},
+			id:         "TIT2",
+			frame:      id3v2.TextFrame{Encoding: id3v2.EncodingUTF8, Text: "猫"},
+			want:       id3v2.TextFrame{Encoding: id3v2.EncodingUTF16, Text: "猫"},
+		},
+		"unknown frame": {
+			conversion: ID3V2Conversion{Version: 4},
+			id:         "MCDI",
+			frame:      id3v2.UnknownFrame{Body: []byte("cd")},
+			want:       id3v2.UnknownFrame{Body: []byte("cd")},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := tt.conversion.convertFrame(tt.id, tt.frame)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ID3V2Conversion.convertFrame() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestID3V2Conversion_Apply_dates(t *testing.T) {
+	originalFileSystem := cmdtoolkit.AssignFileSystem(afero.NewOsFs())
+	defer func() {
+		cmdtoolkit.AssignFileSystem(originalFileSystem)
+	}()
+	testDir := t.TempDir()
+	tests := map[string]struct {
+		frames     map[string]string
+		conversion []ID3V2Conversion
+		wantFrames map[string]string
+	}{
+		"year and date to ID3V2.4": {
+			frames:     map[string]string{"TYER": "1969", "TDAT": "2609"},
+			conversion: []ID3V2Conversion{{Version: 4}},
+			wantFrames: map[string]string{"TDRC": "1969-09-26", "TYER": "", "TDAT": ""},
+		},
+		"year and bad date to ID3V2.4": {
+			frames:     map[string]string{"TYER": "1969", "TDAT": "Sept"},
+			conversion: []ID3V2Conversion{{Version: 4}},
+			wantFrames: map[string]string{"TDRC": "1969", "TYER": "", "TDAT": ""},
+		},
+		"round trip": {
+			frames:     map[string]string{"TYER": "1969", "TDAT": "2609"},
+			conversion: []ID3V2Conversion{{Version: 4}, {Version: 3}},
+			wantFrames: map[string]string{"TYER": "1969", "TDAT": "2609", "TDRC": ""},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(testDir, name+".mp3")
+			if err := os.WriteFile(path, createID3v2TaggedData([]byte(name), tt.frames),
+				cmdtoolkit.StdFilePermissions); err != nil {
+				t.Fatalf("ID3V2Conversion.Apply() cannot create test file: %v", err)
+			}
+			for _, c := range tt.conversion {
+				if err := c.Apply(path); err != nil {
+					t.Fatalf("ID3V2Conversion.Apply() error = %v", err)
+				}
+			}
+			tag, err := readID3V2Tag(path)
+			if err != nil {
+				t.Fatalf("ID3V2Conversion.Apply() cannot read converted tag: %v", err)
+			}
+			defer func() {
+				_ = tag.Close()
+			}()
+			for id, want := range tt.wantFrames {
+				if got := tag.GetTextFrame(id).Text; got != want {
+					t.Errorf("ID3V2Conversion.Apply() frame %s = %q, want %q", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestID3V2Conversion_problems(t *testing.T) {
+	frames := []encodedText{
+		{id: "TALB", encoding: id3v2.EncodingUTF8, text: []string{"Abbey Road"}},
+		{id: "TIT2", encoding: id3v2.EncodingUTF8, text: []string{"Come Together"}},
+		{id: "TPE1", encoding: id3v2.EncodingISO, text: []string{"The Beatles"}},
+	}
+	tests := map[string]struct {
+		conversion ID3V2Conversion
+		version    byte
+		want       []string
+	}{
+		"keep everything": {
+			conversion: ID3V2Conversion{Encoding: KeepEncoding},
+			version:    4,
+		},
+		"keep unsupported encoding": {
+			conversion: ID3V2Conversion{Encoding: KeepEncoding},
+			version:    3,
+			want:       []string{"the ID3V2 TALB, TIT2 frames are encoded as UTF-8, not ISO-8859-1"},
+		},
+		"wrong version": {
+			conversion: ID3V2Conversion{Version: 3, Encoding: KeepEncoding},
+			version:    4,
+			want: []string{
+				"the ID3V2 tag is version 2.4, not 2.3",
+				"the ID3V2 TALB, TIT2 frames are encoded as UTF-8, not ISO-8859-1",
+			},
+		},
+		"wrong encoding": {
+			conversion: ID3V2Conversion{Version: 4, Encoding: UTF16Encoding},
+			version:    4,
+			want: []string{
+				"the ID3V2 TPE1 frames are encoded as ISO-8859-1, not UTF-16",
+				"the ID3V2 TALB, TIT2 frames are encoded as UTF-8, not UTF-16",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.conversion.problems(tt.version, frames); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ID3V2Conversion.problems() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrack_ID3V2Format(t *testing.T) {
+	utf8Text := encodedText{id: "TIT2", encoding: id3v2.EncodingUTF8, text: []string{"Come Together"}}
+	isoText := encodedText{id: "TPE1", encoding: id3v2.EncodingISO, text: []string{"The Beatles"}}
+	tests := map[string]struct {
+		version      byte
+		text         []encodedText
+		wantVersion  byte
+		wantEncoding string
+		wantOk       bool
+	}{
+		"no tag": {},
+		"one encoding": {
+			version:      3,
+			text:         []encodedText{utf8Text, utf8Text},
+			wantVersion:  3,
+			wantEncoding: "UTF-8",
+			wantOk:       true,
+		},
+		"mixed encodings": {
+			version:      4,
+			text:         []encodedText{utf8Text, isoText},
+			wantVersion:  4,
+			wantEncoding: "mixed",
+			wantOk:       true,
+		},
+		"no text, version 3": {version: 3, wantVersion: 3, wantEncoding: "ISO-8859-1", wantOk: true},
+		"no text, version 4": {version: 4, wantVersion: 4, wantEncoding: "UTF-8", wantOk: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tm := newTrackMetadata()
+			tm.setID3v2Format(tt.version, tt.text, nil)
+			track := &Track{metadata: tm}
+			gotVersion, gotEncoding, gotOk := track.ID3V2Format()
+			if gotVersion != tt.wantVersion || gotEncoding != tt.wantEncoding || gotOk != tt.wantOk {
+				t.Errorf("Track.ID3V2Format() = %d, %q, %t, want %d, %q, %t", gotVersion, gotEncoding, gotOk,
+					tt.wantVersion, tt.wantEncoding, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestTrack_ConvertID3V2Tag(t *testing.T) {
+	// as with TestTrack_UpdateMetadata, the ID3V2 library requires the os file
+	// system
+	testDir := "convertID3V2Tag"
+	_ = cmdtoolkit.Mkdir(testDir)
+	defer func() {
+		_ = os.RemoveAll(testDir)
+		SetID3V2Policy(ID3V2Conversion{Encoding: KeepEncoding})
+	}()
+	trackName := "convert this track.mp3"
+	_ = createFileWithContent(testDir, trackName, createID3v2TaggedData([]byte(trackName), map[string]string{
+		"TALB": "Abbey Road",
+		"TIT2": "Come Together",
+		"TRCK": "1",
+		"TYER": "1969",
+	}))
+	path := filepath.Join(testDir, trackName)
+	track := &Track{filePath: path, metadata: initializeMetadata(path)}
+	SetID3V2Policy(ID3V2Conversion{Encoding: KeepEncoding})
+	if got := track.ID3V2FormatProblems(); len(got) != 0 {
+		t.Errorf("Track.ID3V2FormatProblems() = %v, want none", got)
+	}
+	SetID3V2Policy(ID3V2Conversion{Version: 4, Encoding: UTF8Encoding})
+	want := []string{
+		"the ID3V2 tag is version 2.3, not 2.4",
+		"the ID3V2 TALB, TIT2, TRCK, TYER frames are encoded as ISO-8859-1, not UTF-8",
+	}
+	if got := track.ID3V2FormatProblems(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Track.ID3V2FormatProblems() = %v, want %v", got, want)
+	}
+	if err := (&Track{filePath: path}).ConvertID3V2Tag(); err == nil {
+		t.Errorf("Track.ConvertID3V2Tag() succeeded without reading metadata")
+	}
+	if err := track.ConvertID3V2Tag(); err != nil {
+		t.Errorf("Track.ConvertID3V2Tag() error = %v", err)
+	}
+	if got := track.ID3V2FormatProblems(); len(got) != 0 {
+		t.Errorf("Track.ConvertID3V2Tag() left problems %v", got)
+	}
+	if got := track.metadata.albumYear(ID3V2).original; got != "1969" {
+		t.Errorf("Track.ConvertID3V2Tag() year = %q, want %q", got, "1969")
+	}
+}
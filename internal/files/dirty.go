@@ -5,6 +5,8 @@ Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
 package files
 
 import (
+	"sync"
+
 	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
 	"github.com/majohn-r/output"
 )
@@ -15,12 +17,17 @@ const (
 
 var (
 	stateFileInitializationFailureLogged bool
+	// serializes access to the state file, as tracks may be rewritten
+	// concurrently
+	stateFileLock sync.Mutex
 	// a variable so testing can substitute another implementation
 	initStateFile = cmdtoolkit.InitStateFile
 )
 
 // MarkDirty mark the system dirty
 func MarkDirty(o output.Bus) {
+	stateFileLock.Lock()
+	defer stateFileLock.Unlock()
 	sf := safeStateFile(o)
 	defer sf.Close()
 	if err := sf.Create(dirtyFileName); err != nil {
@@ -0,0 +1,160 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+const (
+	mpegFrameHeaderLength = 4
+	// how far into the audio to look for the first frame; encoders may leave
+	// some junk between the ID3V2 tag and the audio
+	mpegFrameSearchLimit = 64 * 1024
+	xingFramesFlag       = 1
+)
+
+const (
+	mpegVersion25 = 0
+	mpegVersion2  = 2
+	mpegVersion1  = 3
+)
+
+const (
+	mpegLayer3 = 1
+	mpegLayer2 = 2
+	mpegLayer1 = 3
+)
+
+var (
+	// bit rates, in kilobits per second, indexed by the frame header's bit
+	// rate index
+	mpeg1BitRates = map[int][]int{
+		mpegLayer1: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		mpegLayer2: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		mpegLayer3: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	}
+	mpeg2BitRates = map[int][]int{
+		mpegLayer1: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		mpegLayer2: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		mpegLayer3: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	}
+	mpeg1SampleRates = []int{44100, 48000, 32000}
+)
+
+// mpegFrameHeader holds the fields of an MPEG audio frame header needed to
+// estimate the duration of the audio
+type mpegFrameHeader struct {
+	version    int
+	layer      int
+	bitRate    int // bits per second
+	sampleRate int // samples per second
+	mono       bool
+}
+
+// parseMPEGFrameHeader parses a 4-byte MPEG audio frame header, returning
+// false if the bytes are not a valid header
+func parseMPEGFrameHeader(b []byte) (mpegFrameHeader, bool) {
+	if len(b) < mpegFrameHeaderLength || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return mpegFrameHeader{}, false
+	}
+	h := mpegFrameHeader{
+		version: int(b[1]>>3) & 3,
+		layer:   int(b[1]>>1) & 3,
+		mono:    b[3]>>6 == 3,
+	}
+	bitRateIndex := int(b[2] >> 4)
+	sampleRateIndex := int(b[2]>>2) & 3
+	if h.version == 1 || h.layer == 0 || bitRateIndex == 0 || bitRateIndex == 15 || sampleRateIndex == 3 {
+		return mpegFrameHeader{}, false
+	}
+	h.sampleRate = mpeg1SampleRates[sampleRateIndex]
+	switch h.version {
+	case mpegVersion1:
+		h.bitRate = mpeg1BitRates[h.layer][bitRateIndex] * 1000
+	case mpegVersion2:
+		h.bitRate = mpeg2BitRates[h.layer][bitRateIndex] * 1000
+		h.sampleRate /= 2
+	default:
+		h.bitRate = mpeg2BitRates[h.layer][bitRateIndex] * 1000
+		h.sampleRate /= 4
+	}
+	return h, true
+}
+
+// samplesPerFrame returns the number of audio samples encoded in each frame
+func (h mpegFrameHeader) samplesPerFrame() int {
+	switch {
+	case h.layer == mpegLayer1:
+		return 384
+	case h.layer == mpegLayer3 && h.version != mpegVersion1:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+// xingOffset returns the offset, from the start of the frame, of a Xing or
+// Info header, which follows the frame's side information
+func (h mpegFrameHeader) xingOffset() int64 {
+	switch {
+	case h.version == mpegVersion1 && !h.mono:
+		return mpegFrameHeaderLength + 32
+	case h.version == mpegVersion1 || !h.mono:
+		return mpegFrameHeaderLength + 17
+	default:
+		return mpegFrameHeaderLength + 9
+	}
+}
+
+// audioDuration estimates the duration of the audio occupying [audioStart,
+// audioEnd). The number of frames recorded in a Xing, Info, or VBRI header is
+// used if there is one, as variable bit rate audio has no other reliable
+// measure; otherwise, the bit rate of the first frame is assumed to apply
+// throughout. Zero is returned if no frame can be found.
+func audioDuration(r io.ReaderAt, audioStart, audioEnd int64) time.Duration {
+	searchLength := min(audioEnd-audioStart, mpegFrameSearchLimit)
+	if searchLength < mpegFrameHeaderLength {
+		return 0
+	}
+	buffer := make([]byte, searchLength)
+	n, _ := r.ReadAt(buffer, audioStart)
+	buffer = buffer[:n]
+	for k := 0; k+mpegFrameHeaderLength <= len(buffer); k++ {
+		h, ok := parseMPEGFrameHeader(buffer[k:])
+		if !ok {
+			continue
+		}
+		frameStart := audioStart + int64(k)
+		if frames := vbrFrameCount(r, frameStart, h); frames > 0 {
+			samples := int64(frames) * int64(h.samplesPerFrame())
+			return time.Duration(samples * int64(time.Second) / int64(h.sampleRate))
+		}
+		bits := (audioEnd - frameStart) * 8
+		return time.Duration(bits * int64(time.Second) / int64(h.bitRate))
+	}
+	return 0
+}
+
+// vbrFrameCount returns the number of frames recorded in the Xing, Info, or
+// VBRI header held by the first frame, or 0 if there is none
+func vbrFrameCount(r io.ReaderAt, frameStart int64, h mpegFrameHeader) uint32 {
+	xing := make([]byte, 12)
+	if _, readErr := r.ReadAt(xing, frameStart+h.xingOffset()); readErr == nil {
+		tag := string(xing[0:4])
+		if (tag == "Xing" || tag == "Info") && binary.BigEndian.Uint32(xing[4:8])&xingFramesFlag != 0 {
+			return binary.BigEndian.Uint32(xing[8:12])
+		}
+	}
+	// the VBRI header always follows 32 bytes of side information
+	vbri := make([]byte, 18)
+	if _, readErr := r.ReadAt(vbri, frameStart+mpegFrameHeaderLength+32); readErr == nil &&
+		string(vbri[0:4]) == "VBRI" {
+		return binary.BigEndian.Uint32(vbri[14:18])
+	}
+	return 0
+}
@@ -0,0 +1,102 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// makeMPEGFrames makes count 417-byte frames of 128 kbps, 44.1 kHz, stereo
+// MPEG-1 layer III audio; if xing is true, the first frame holds a Xing
+// header recording the number of frames that follow it
+func makeMPEGFrames(count int, xing bool) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x64})
+	var audio []byte
+	for k := range count {
+		f := bytes.Clone(frame)
+		if k == 0 && xing {
+			header := append([]byte("Xing"), 0, 0, 0, xingFramesFlag)
+			header = binary.BigEndian.AppendUint32(header, uint32(count-1))
+			copy(f[mpegFrameHeaderLength+32:], header)
+		}
+		audio = append(audio, f...)
+	}
+	return audio
+}
+
+func TestParseMPEGFrameHeader(t *testing.T) {
+	tests := map[string]struct {
+		b      []byte
+		want   mpegFrameHeader
+		wantOk bool
+	}{
+		"MPEG-1 layer III": {
+			b:      []byte{0xFF, 0xFB, 0x90, 0x64},
+			want:   mpegFrameHeader{version: mpegVersion1, layer: mpegLayer3, bitRate: 128000, sampleRate: 44100},
+			wantOk: true,
+		},
+		"MPEG-2 layer III mono": {
+			b: []byte{0xFF, 0xF3, 0x84, 0xC4},
+			want: mpegFrameHeader{
+				version:    mpegVersion2,
+				layer:      mpegLayer3,
+				bitRate:    64000,
+				sampleRate: 24000,
+				mono:       true,
+			},
+			wantOk: true,
+		},
+		"MPEG-2.5 layer III": {
+			b:      []byte{0xFF, 0xE3, 0x18, 0x00},
+			want:   mpegFrameHeader{version: mpegVersion25, layer: mpegLayer3, bitRate: 8000, sampleRate: 8000},
+			wantOk: true,
+		},
+		"too short":          {b: []byte{0xFF, 0xFB}},
+		"no sync":            {b: []byte{0xFF, 0x1B, 0x90, 0x64}},
+		"reserved version":   {b: []byte{0xFF, 0xEB, 0x90, 0x64}},
+		"free bit rate":      {b: []byte{0xFF, 0xFB, 0x00, 0x64}},
+		"bad bit rate":       {b: []byte{0xFF, 0xFB, 0xF0, 0x64}},
+		"reserved frequency": {b: []byte{0xFF, 0xFB, 0x9C, 0x64}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, gotOk := parseMPEGFrameHeader(tt.b)
+			if got != tt.want || gotOk != tt.wantOk {
+				t.Errorf("parseMPEGFrameHeader() = %v, %t, want %v, %t", got, gotOk, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestAudioDuration(t *testing.T) {
+	// each frame holds 1152 samples at 44.1 kHz
+	frameDuration := time.Duration(1152 * int64(time.Second) / 44100)
+	tests := map[string]struct {
+		audio []byte
+		want  time.Duration
+	}{
+		"no audio":  {audio: nil, want: 0},
+		"no frames": {audio: bytes.Repeat([]byte{0x55}, 1000), want: 0},
+		// 100 frames of 417 bytes at 128 kbps
+		"constant bit rate": {audio: makeMPEGFrames(100, false), want: 2606250 * time.Microsecond},
+		"leading junk": {
+			audio: append(bytes.Repeat([]byte{0}, 10), makeMPEGFrames(100, false)...),
+			want:  2606250 * time.Microsecond,
+		},
+		"xing header": {audio: makeMPEGFrames(100, true), want: 99 * frameDuration},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := audioDuration(bytes.NewReader(tt.audio), 0, int64(len(tt.audio)))
+			if diff := got - tt.want; diff < -time.Millisecond || diff > time.Millisecond {
+				t.Errorf("audioDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
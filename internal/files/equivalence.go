@@ -0,0 +1,120 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NameEquivalence describes which differences between an artist or album
+// directory name and the corresponding metadata are forgiven, in addition to
+// the illegal file name characters and ID3V1 truncation that are always
+// forgiven. The zero value forgives nothing more.
+type NameEquivalence struct {
+	// NormalizeUnicode treats the NFC and NFD forms of a name as equal
+	NormalizeUnicode bool
+	// FoldCase treats names differing only in letter case, as determined by
+	// full Unicode case folding, as equal
+	FoldCase bool
+	// InvertArticles treats "X, The" and "The X" as equal
+	InvertArticles bool
+	// Ampersand treats "&" and "and" as equal
+	Ampersand bool
+	// Aliases maps alternative names to their preferred names
+	Aliases map[string]string
+}
+
+var invertedArticleRegex = regexp.MustCompile(`(?i)^(.+), (the)$`)
+
+func (e NameEquivalence) enabled() bool {
+	return e.NormalizeUnicode || e.FoldCase || e.InvertArticles || e.Ampersand || len(e.Aliases) != 0
+}
+
+func (e NameEquivalence) normalize(s string) string {
+	if e.NormalizeUnicode {
+		s = norm.NFC.String(s)
+	}
+	if e.FoldCase {
+		s = cases.Fold().String(s)
+	}
+	if e.InvertArticles {
+		s = invertedArticleRegex.ReplaceAllString(s, "$2 $1")
+	}
+	if e.Ampersand && strings.Contains(s, "&") {
+		// "&" may or may not be surrounded by spaces, as in "R&B"
+		s = strings.Join(strings.Fields(strings.ReplaceAll(s, "&", " and ")), " ")
+	}
+	return s
+}
+
+// alias returns the preferred name for a name that is an alias; aliases are
+// matched without regard to letter case
+func (e NameEquivalence) alias(s string) (preferred string, isAlias bool) {
+	key := strings.ToLower(e.normalize(s))
+	for alias, name := range e.Aliases {
+		if strings.ToLower(e.normalize(alias)) == key {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// CanonicalName returns the form of an artist or album name that the name
+// equivalence rules consider equal to all of its equivalent names; if the name
+// is an alias, the canonical form of its preferred name is returned instead
+func (e NameEquivalence) CanonicalName(s string) string {
+	if preferred, isAlias := e.alias(s); isAlias {
+		return e.normalize(preferred)
+	}
+	return e.normalize(s)
+}
+
+// preferredName returns the preferred name for a name that is an alias;
+// otherwise, the name is returned unchanged
+func (e NameEquivalence) preferredName(s string) string {
+	if preferred, isAlias := e.alias(s); isAlias {
+		return preferred
+	}
+	return s
+}
+
+// holdsAlias reports whether a name is an alias rather than its preferred name
+func (e NameEquivalence) holdsAlias(s string) bool {
+	preferred, isAlias := e.alias(s)
+	return isAlias && e.normalize(s) != e.normalize(preferred)
+}
+
+// namesDiffer compares names using the comparator for the specified source;
+// names that the comparator finds to be different are compared again using
+// their canonical forms. A name from the file structure that is an alias is
+// compared as its preferred name, and metadata that holds an alias always
+// differs, so that it is corrected to the preferred name.
+func (e NameEquivalence) namesDiffer(src sourceType, cS *comparableStrings) bool {
+	comparator, exists := nameComparators[src]
+	if !exists {
+		return true
+	}
+	if cS.metadata != "" && e.holdsAlias(cS.metadata) {
+		return true
+	}
+	preferred := &comparableStrings{
+		external: e.preferredName(cS.external),
+		metadata: cS.metadata,
+	}
+	if !comparator(preferred) {
+		return false
+	}
+	if !e.enabled() || preferred.external == "" || preferred.metadata == "" {
+		return true
+	}
+	return comparator(&comparableStrings{
+		external: e.CanonicalName(preferred.external),
+		metadata: e.CanonicalName(preferred.metadata),
+	})
+}
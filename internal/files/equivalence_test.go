@@ -0,0 +1,191 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+package files
+
+import (
+	"testing"
+)
+
+func TestNameEquivalence_NamesDiffer(t *testing.T) {
+	allRules := NameEquivalence{
+		NormalizeUnicode: true,
+		FoldCase:         true,
+		InvertArticles:   true,
+		Ampersand:        true,
+		Aliases:          map[string]string{"Fab Four": "The Beatles"},
+	}
+	tests := map[string]struct {
+		rules NameEquivalence
+		src   sourceType
+		cS    *comparableStrings
+		want  bool
+	}{
+		"unknown source": {
+			rules: allRules,
+			src:   undefinedSource,
+			cS:    &comparableStrings{external: "The Beatles", metadata: "The Beatles"},
+			want:  true,
+		},
+		"identical names": {
+			rules: NameEquivalence{},
+			src:   ID3V2,
+			cS:    &comparableStrings{external: "The Beatles", metadata: "The Beatles"},
+			want:  false,
+		},
+		"inverted article, no rules": {
+			rules: NameEquivalence{},
+			src:   ID3V2,
+			cS:    &comparableStrings{external: "Beatles, The", metadata: "The Beatles"},
+			want:  true,
+		},
+		"inverted article": {
+			rules: allRules,
+			src:   ID3V2,
+			cS:    &comparableStrings{external: "Beatles, The", metadata: "The Beatles"},
+			want:  false,
+		},
+		"inverted article, lower case": {
+			rules: NameEquivalence{InvertArticles: true},
+			src:   ID3V2,
+			cS:    &comparableStrings{external: "Beatles, the", metadata: "the Beatles"},
+			want:  false,
+		},
+		"case differs": {
+			rules: NameEquivalence{},
+			src:   ID3V2,
+			cS:    &comparableStrings{external: "the beatles", metadata: "The Beatles"},
+			want:  false,
+		},
+		"folded case differs, no folding": {
+			rules: NameEquivalence{InvertArticles: true},
+			src:   ID3V2,
+			cS:    &comparableStrings{external: "Strasse", metadata: "Straße"},
+			want:  true,
+		},
+		"folded case differs": {
+			rules: allRules,
+			src:   ID3V2,
+			cS:    &comparableStrings{external: "Strasse", metadata: "Straße"},
+			want:  false,
+		},
+		"NFD vs NFC": {
+			rules: NameEquivalence{NormalizeUnicode: true},
+			src:   ID3V2,
+			cS:    &comparableStrings{external: "Beyonce\u0301", metadata: "Beyonc\u00e9"},
+			want:  false,
+		},
+		"NFD vs NFC, no normalization": {
+			rules: NameEquivalence{FoldCase: true},
+			src:   ID3V2,
+			cS:    &comparableStrings{external: "Beyonce\u0301", metadata: "Beyonc\u00e9"},
+			want:  true,
+		},
+		"ampersand": {
+			rules: NameEquivalence{Ampersand: true},
+			src:   ID3V2,
+			cS:    &comparableStrings{external: "Simon & Garfunkel", metadata: "Simon and Garfunkel"},
+			want:  false,
+		},
+		"ampersand without spaces": {
+			rules: NameEquivalence{Ampersand: true},
+			src:   ID3V2,
+			cS:    &comparableStrings{external: "Simon&Garfunkel", metadata: "Simon and Garfunkel"},
+			want:  false,
+		},
+		"ampersand, no rule": {
+			rules: NameEquivalence{FoldCase: true},
+			src:   ID3V2,
+			cS:    &comparableStrings{external: "Simon & Garfunkel", metadata: "Simon and Garfunkel"},
+			want:  true,
+		},
+		"alias": {
+			rules: allRules,
+			src:   ID3V2,
+			cS:    &comparableStrings{external: "fab four", metadata: "The Beatles"},
+			want:  false,
+		},
+		"alias, ID3V1": {
+			rules: allRules,
+			src:   ID3V1,
+			cS:    &comparableStrings{external: "Fab Four", metadata: "The Beatles"},
+			want:  false,
+		},
+		"alias in metadata": {
+			rules: allRules,
+			src:   ID3V2,
+			cS:    &comparableStrings{external: "The Beatles", metadata: "Fab Four"},
+			want:  true,
+		},
+		"alias in both": {
+			rules: allRules,
+			src:   ID3V2,
+			cS:    &comparableStrings{external: "Fab Four", metadata: "Fab Four"},
+			want:  true,
+		},
+		"alias for an equivalent name": {
+			rules: NameEquivalence{
+				InvertArticles: true,
+				Aliases:        map[string]string{"Beatles, The": "The Beatles"},
+			},
+			src:  ID3V2,
+			cS:   &comparableStrings{external: "Beatles, The", metadata: "The Beatles"},
+			want: false,
+		},
+		"empty metadata": {
+			rules: allRules,
+			src:   ID3V2,
+			cS:    &comparableStrings{external: "The Beatles", metadata: ""},
+			want:  true,
+		},
+		"different names": {
+			rules: allRules,
+			src:   ID3V2,
+			cS:    &comparableStrings{external: "The Rolling Stones", metadata: "The Beatles"},
+			want:  true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.rules.namesDiffer(tt.src, tt.cS); got != tt.want {
+				t.Errorf("NameEquivalence.namesDiffer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNameEquivalence_PreferredName(t *testing.T) {
+	tests := map[string]struct {
+		rules NameEquivalence
+		s     string
+		want  string
+	}{
+		"no aliases": {
+			rules: NameEquivalence{},
+			s:     "Fab Four",
+			want:  "Fab Four",
+		},
+		"alias": {
+			rules: NameEquivalence{Aliases: map[string]string{"Fab Four": "The Beatles"}},
+			s:     "Fab Four",
+			want:  "The Beatles",
+		},
+		"alias, different case": {
+			rules: NameEquivalence{Aliases: map[string]string{"Fab Four": "The Beatles"}},
+			s:     "FAB FOUR",
+			want:  "The Beatles",
+		},
+		"not an alias": {
+			rules: NameEquivalence{Aliases: map[string]string{"Fab Four": "The Beatles"}},
+			s:     "The Rolling Stones",
+			want:  "The Rolling Stones",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.rules.preferredName(tt.s); got != tt.want {
+				t.Errorf("NameEquivalence.preferredName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
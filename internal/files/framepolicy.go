@@ -0,0 +1,214 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+)
+
+const (
+	id3v2HeaderLength      = 10
+	id3v2FrameHeaderLength = 10
+	userDefinedTextFrame   = "TXXX"
+)
+
+var (
+	// managedFrames are the frames holding the metadata that mp3repair reads
+	// and corrects; a frame policy cannot remove them
+	managedFrames = []string{
+		"TALB", "TCON", dateFrame, recordingTimeFrame, "TIT2", "TPE1", trackFrame, yearFrame, mcdiFrame,
+	}
+	frameIDPattern = regexp.MustCompile(`^[A-Z][A-Z0-9]{3}$`)
+)
+
+// FramePolicy describes which ID3V2 frames a track's ID3V2 tag may and must
+// contain. If Allow is not empty, only the listed frames (and the frames
+// holding the metadata that mp3repair manages) are permitted; otherwise, all
+// frames except those listed in Deny are permitted. The frames listed in
+// Require must be present.
+type FramePolicy struct {
+	Allow   []string
+	Deny    []string
+	Require []string
+}
+
+// Validate verifies that the policy's frame identifiers are well-formed, that
+// the policy does not both allow and deny frames, and that it neither denies
+// the frames holding the metadata that mp3repair manages nor requires frames
+// that it does not permit
+func (p FramePolicy) Validate() error {
+	var problems []error
+	if len(p.Allow) != 0 && len(p.Deny) != 0 {
+		problems = append(problems, errors.New("a frame policy cannot have both allowed and denied frames"))
+	}
+	for _, list := range [][]string{p.Allow, p.Deny, p.Require} {
+		for _, id := range list {
+			if !frameIDPattern.MatchString(id) {
+				problems = append(problems, fmt.Errorf("%q is not a valid ID3V2 frame identifier", id))
+			}
+		}
+	}
+	for _, id := range p.Deny {
+		if slices.Contains(managedFrames, id) {
+			problems = append(problems, fmt.Errorf("the %s frame holds metadata and cannot be denied", id))
+		}
+	}
+	for _, id := range p.Require {
+		if !p.permits(id) {
+			problems = append(problems, fmt.Errorf("the %s frame is required, but is not permitted", id))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+func (p FramePolicy) permits(id string) bool {
+	switch {
+	case slices.Contains(managedFrames, id):
+		return true
+	case len(p.Allow) != 0:
+		return slices.Contains(p.Allow, id)
+	default:
+		return !slices.Contains(p.Deny, id)
+	}
+}
+
+// frameCounts counts the occurrences of each frame in the tag
+func frameCounts(frames []string) map[string]int {
+	counts := map[string]int{}
+	for _, id := range frames {
+		counts[id]++
+	}
+	return counts
+}
+
+// isDuplicated determines whether a frame that may appear only once in a tag
+// appears more than once; text frames, other than user-defined text frames,
+// may appear only once
+func isDuplicated(id string, count int) bool {
+	return count > 1 && strings.HasPrefix(id, "T") && id != userDefinedTextFrame
+}
+
+// FramePolicyViolations reports the frames in the track's ID3V2 tag that the
+// policy does not permit, the frames that the policy requires and that the tag
+// lacks, and the text frames that appear more than once; the track's metadata
+// must have been read.
+func (t *Track) FramePolicyViolations(p FramePolicy) []string {
+	if t.metadata == nil || t.metadata.id3v2Version == 0 {
+		return nil
+	}
+	counts := frameCounts(t.metadata.id3v2Frames)
+	var violations []string
+	for _, id := range slices.Sorted(maps.Keys(counts)) {
+		if !p.permits(id) {
+			violations = append(violations, fmt.Sprintf(
+				"the ID3V2 tag contains the %s frame (%s), which the frame policy does not permit", id,
+				FrameDescription(id)))
+		}
+		if isDuplicated(id, counts[id]) {
+			violations = append(violations, fmt.Sprintf("the ID3V2 tag contains %d %s frames (%s)", counts[id], id,
+				FrameDescription(id)))
+		}
+	}
+	for _, id := range p.Require {
+		if counts[id] == 0 {
+			violations = append(violations, fmt.Sprintf(
+				"the ID3V2 tag does not contain the %s frame (%s), which the frame policy requires", id,
+				FrameDescription(id)))
+		}
+	}
+	return violations
+}
+
+// HasRemovableFrames determines whether the track's ID3V2 tag contains frames
+// that the policy does not permit, or duplicated text frames, which
+// CleanFrames removes
+func (t *Track) HasRemovableFrames(p FramePolicy) bool {
+	if t.metadata == nil || t.metadata.id3v2Version == 0 {
+		return false
+	}
+	for id, count := range frameCounts(t.metadata.id3v2Frames) {
+		if !p.permits(id) || isDuplicated(id, count) {
+			return true
+		}
+	}
+	return false
+}
+
+// CleanFrames removes the frames that the policy does not permit from the
+// track's ID3V2 tag, and keeps only the last of any duplicated text frames;
+// the tag is written with the ID3V2 version and text encoding set by
+// SetID3V2Policy. The track's metadata is then read again, and the identifiers
+// of the removed frames are returned.
+func (t *Track) CleanFrames(p FramePolicy) ([]string, error) {
+	if t.metadata == nil {
+		return nil, errMetadataNotRead
+	}
+	tag, readErr := readID3V2Tag(t.filePath)
+	if readErr != nil {
+		return nil, readErr
+	}
+	defer func() {
+		_ = tag.Close()
+	}()
+	// the parsed tag already holds a single copy of each text frame
+	var removed []string
+	for id, count := range frameCounts(t.metadata.id3v2Frames) {
+		if !p.permits(id) {
+			tag.DeleteFrames(id)
+			removed = append(removed, id)
+		} else if isDuplicated(id, count) {
+			removed = append(removed, id)
+		}
+	}
+	applyID3V2Policy(tag)
+	if saveErr := tag.Save(); saveErr != nil {
+		return nil, saveErr
+	}
+	t.metadata = initializeMetadata(t.filePath)
+	slices.Sort(removed)
+	return removed, nil
+}
+
+// readID3V2FrameIDs returns the identifiers of the frames in the file's ID3V2
+// tag, in the order in which they appear, including any duplicates, which the
+// ID3V2 library discards
+func readID3V2FrameIDs(path string) ([]string, error) {
+	file, openErr := cmdtoolkit.FileSystem().Open(path)
+	if openErr != nil {
+		return nil, openErr
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	stat, statErr := file.Stat()
+	if statErr != nil {
+		return nil, statErr
+	}
+	b := readID3V2Block(file, stat.Size(), 0)
+	if b == nil {
+		return nil, errNoID3V2MetadataFound
+	}
+	if !b.parsed {
+		return nil, fmt.Errorf("the ID3V2.%d tag's frames cannot be listed", b.version)
+	}
+	ids := make([]string, 0, len(b.frames))
+	for _, frame := range b.frames {
+		ids = append(ids, frame.id)
+	}
+	return ids, nil
+}
+
+// synchsafeInt decodes a four-byte ID3V2 synchsafe integer, in which the high
+// bit of each byte is zero
+func synchsafeInt(b []byte) int {
+	return int(b[0]&0x7F)<<21 | int(b[1]&0x7F)<<14 | int(b[2]&0x7F)<<7 | int(b[3]&0x7F)
+}
@@ -0,0 +1,136 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+)
+
+// createID3v2TaggedFrames creates ID3V2.3-tagged content from identifier and
+// value pairs; unlike createID3v2TaggedData, frames may be repeated
+func createID3v2TaggedFrames(audio []byte, pairs ...string) []byte {
+	var frames []byte
+	for k := 0; k+1 < len(pairs); k += 2 {
+		frames = append(frames, makeTextFrame(pairs[k], pairs[k+1])...)
+	}
+	size := len(frames)
+	content := []byte{'I', 'D', '3', 3, 0, 0,
+		byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)}
+	content = append(content, frames...)
+	return append(content, audio...)
+}
+
+func TestFramePolicy_Validate(t *testing.T) {
+	tests := map[string]struct {
+		p       FramePolicy
+		wantErr string
+	}{
+		"empty":   {},
+		"deny":    {p: FramePolicy{Deny: []string{"PRIV", "TENC"}, Require: []string{"APIC"}}},
+		"allow":   {p: FramePolicy{Allow: []string{"APIC"}, Require: []string{"APIC", "TIT2"}}},
+		"managed": {p: FramePolicy{Allow: []string{"APIC"}, Require: []string{"TALB"}}},
+		"allow and deny": {
+			p:       FramePolicy{Allow: []string{"APIC"}, Deny: []string{"PRIV"}},
+			wantErr: "a frame policy cannot have both allowed and denied frames",
+		},
+		"bad identifiers": {
+			p:       FramePolicy{Deny: []string{"priv", "TIT"}},
+			wantErr: "\"priv\" is not a valid ID3V2 frame identifier\n\"TIT\" is not a valid ID3V2 frame identifier",
+		},
+		"deny managed frame": {
+			p:       FramePolicy{Deny: []string{"TYER"}},
+			wantErr: "the TYER frame holds metadata and cannot be denied",
+		},
+		"require denied frame": {
+			p:       FramePolicy{Deny: []string{"APIC"}, Require: []string{"APIC"}},
+			wantErr: "the APIC frame is required, but is not permitted",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tt.p.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("FramePolicy.Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("FramePolicy.Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTrack_FramePolicy(t *testing.T) {
+	// as with TestTrack_UpdateMetadata, the ID3V2 library requires the os file
+	// system
+	testDir := "framePolicy"
+	_ = cmdtoolkit.Mkdir(testDir)
+	defer func() {
+		_ = os.RemoveAll(testDir)
+	}()
+	trackName := "clean this track.mp3"
+	_ = createFileWithContent(testDir, trackName, createID3v2TaggedFrames([]byte(trackName),
+		"TALB", "fine album",
+		"TIT2", "old title",
+		"TENC", "some ripper",
+		"TIT2", "clean this track",
+		"PRIV", "clutter",
+		"TPE1", "fine artist",
+		"TRCK", "1",
+	))
+	path := filepath.Join(testDir, trackName)
+	if got, err := readID3V2FrameIDs(path); err != nil ||
+		!reflect.DeepEqual(got, []string{"TALB", "TIT2", "TENC", "TIT2", "PRIV", "TPE1", "TRCK"}) {
+		t.Errorf("readID3V2FrameIDs() = %v, %v", got, err)
+	}
+	track := &Track{filePath: path, metadata: initializeMetadata(path)}
+	policy := FramePolicy{Deny: []string{"PRIV", "TENC"}, Require: []string{"APIC"}}
+	wantViolations := []string{
+		"the ID3V2 tag contains the PRIV frame (Private frame), which the frame policy does not permit",
+		"the ID3V2 tag contains the TENC frame (Encoded by), which the frame policy does not permit",
+		"the ID3V2 tag contains 2 TIT2 frames (Title/songname/content description)",
+		"the ID3V2 tag does not contain the APIC frame (Attached picture), which the frame policy requires",
+	}
+	if got := track.FramePolicyViolations(policy); !reflect.DeepEqual(got, wantViolations) {
+		t.Errorf("Track.FramePolicyViolations() = %v, want %v", got, wantViolations)
+	}
+	allowed := FramePolicy{Allow: []string{"TENC"}}
+	wantAllowedViolations := []string{
+		"the ID3V2 tag contains the PRIV frame (Private frame), which the frame policy does not permit",
+		"the ID3V2 tag contains 2 TIT2 frames (Title/songname/content description)",
+	}
+	if got := track.FramePolicyViolations(allowed); !reflect.DeepEqual(got, wantAllowedViolations) {
+		t.Errorf("Track.FramePolicyViolations() = %v, want %v", got, wantAllowedViolations)
+	}
+	if !track.HasRemovableFrames(policy) {
+		t.Errorf("Track.HasRemovableFrames() = false, want true")
+	}
+	if _, err := (&Track{filePath: path}).CleanFrames(policy); err == nil {
+		t.Errorf("Track.CleanFrames() succeeded without reading metadata")
+	}
+	removed, err := track.CleanFrames(policy)
+	if err != nil {
+		t.Errorf("Track.CleanFrames() error = %v", err)
+	}
+	if want := []string{"PRIV", "TENC", "TIT2"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("Track.CleanFrames() removed %v, want %v", removed, want)
+	}
+	if track.HasRemovableFrames(policy) {
+		t.Errorf("Track.CleanFrames() left removable frames")
+	}
+	if got := track.FramePolicyViolations(policy); !reflect.DeepEqual(got, wantViolations[3:]) {
+		t.Errorf("Track.CleanFrames() left violations %v, want %v", got, wantViolations[3:])
+	}
+	if got := track.metadata.trackName(ID3V2).original; got != "clean this track" {
+		t.Errorf("Track.CleanFrames() title = %q, want %q", got, "clean this track")
+	}
+}
@@ -4,10 +4,14 @@ Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
 package files
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 
 	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
@@ -46,6 +50,8 @@ const (
 	genreLength = 1
 	// total length of the ID3V1 block
 	id3v1Length = genreOffset + genreLength
+	// the genre list index that means no genre
+	noGenre = 255
 )
 
 type id3v1Field struct {
@@ -779,83 +785,204 @@ func updateID3V1TrackMetadata(tm *TrackMetadata, path string) error {
 	if !tm.editRequired(src) {
 		return nil
 	}
+	// complete any interrupted write, so that the corrections are applied to
+	// the tag that the interrupted write was making
+	if recoveryErr := recoverID3V1Journal(path); recoveryErr != nil {
+		return recoveryErr
+	}
 	var v1 *id3v1Metadata
 	var fileErr error
 	v1, fileErr = internalReadID3V1Metadata(path, fileReader)
 	if fileErr != nil {
 		return fileErr
 	}
+	v1.applyCorrections(tm)
+	return v1.write(path)
+}
+
+// applyCorrections writes the corrected ID3V1 values into the tag
+func (im *id3v1Metadata) applyCorrections(tm *TrackMetadata) {
+	const src = ID3V1
+	if tm.artistName(src).removal {
+		im.setArtist("")
+	}
+	if tm.albumName(src).removal {
+		im.setAlbum("")
+	}
+	if tm.albumGenre(src).removal {
+		im.writeInt(noGenre, genreField)
+	}
+	if tm.albumYear(src).removal {
+		im.setYear("")
+	}
+	if tm.trackName(src).removal {
+		im.setTitle("")
+	}
+	if tm.trackNumber(src).removal {
+		im.writeInt(0, trackField)
+	}
 	if artistName := tm.artistName(src).correctedValue(); artistName != "" {
-		v1.setArtist(artistName)
+		im.setArtist(artistName)
 	}
 	if albumName := tm.albumName(src).correctedValue(); albumName != "" {
-		v1.setAlbum(albumName)
+		im.setAlbum(albumName)
 	}
 	if albumGenre := tm.albumGenre(src).correctedValue(); albumGenre != "" {
-		v1.setGenre(albumGenre)
+		im.setGenre(albumGenre)
 	}
 	if albumYear := tm.albumYear(src).correctedValue(); albumYear != "" {
-		v1.setYear(albumYear)
+		im.setYear(albumYear)
 	}
 	if trackName := tm.trackName(src).correctedValue(); trackName != "" {
-		v1.setTitle(trackName)
+		im.setTitle(trackName)
 	}
 	if trackNumber := tm.trackNumber(src).correctedValue(); trackNumber != 0 {
-		_ = v1.setTrack(trackNumber)
+		_ = im.setTrack(trackNumber)
 	}
-	return v1.write(path)
 }
 
+// internalWrite patches the ID3V1 tag at the end of the file in place. To
+// survive a crash part way through the patch, the new tag is first written to
+// a journal beside the file and flushed to storage; the journal is removed
+// once the patched file has been flushed. A journal left behind by an
+// interrupted write is replayed before the file's ID3V1 tag is next written;
+// reading the tag leaves the file, and the journal, alone.
 func (im *id3v1Metadata) internalWrite(path string,
-	writeFunc func(f afero.File, b []byte) (int, error)) (fileErr error) {
+	writeFunc func(f afero.File, b []byte) (int, error)) error {
+	if recoveryErr := recoverID3V1Journal(path); recoveryErr != nil {
+		return recoveryErr
+	}
 	fS := cmdtoolkit.FileSystem()
-	var src afero.File
-	if src, fileErr = fS.Open(path); fileErr == nil {
-		defer func() {
-			_ = src.Close()
-		}()
-		var stat fs.FileInfo
-		if stat, fileErr = src.Stat(); fileErr == nil {
-			tmpPath := path + "-id3v1"
-			var tmpFile afero.File
-			if tmpFile, fileErr = fS.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE, stat.Mode()); fileErr == nil {
-				defer func() {
-					_ = tmpFile.Close()
-				}()
-				// borrowed this piece of logic from id3v2 tag.Save() method
-				tempFileShouldBeRemoved := true
-				defer func() {
-					if tempFileShouldBeRemoved {
-						_ = fS.Remove(tmpPath)
-					}
-				}()
-				if _, fileErr = io.Copy(tmpFile, src); fileErr == nil {
-					_ = src.Close()
-					fileInfo, _ := fS.Stat(tmpPath)
-					if fileInfo != nil && fileInfo.Size() < id3v1Length {
-						fileErr = fmt.Errorf("file %q is too short", tmpPath)
-						return
-					}
-					if _, fileErr = tmpFile.Seek(-id3v1Length, io.SeekEnd); fileErr == nil {
-						var n int
-						if n, fileErr = writeFunc(tmpFile, im.data); fileErr == nil {
-							_ = tmpFile.Close()
-							if n != id3v1Length {
-								fileErr = fmt.Errorf(
-									"wrote %d bytes to %q, expected to write %d bytes", n,
-									tmpPath, id3v1Length)
-								return
-							}
-							if fileErr = fS.Rename(tmpPath, path); fileErr == nil {
-								tempFileShouldBeRemoved = false
-							}
-						}
-					}
-				}
-			}
+	file, openErr := fS.OpenFile(path, os.O_RDWR, 0)
+	if openErr != nil {
+		return openErr
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	stat, statErr := file.Stat()
+	if statErr != nil {
+		return statErr
+	}
+	if stat.Size() < id3v1Length {
+		return fmt.Errorf("file %q is too short", path)
+	}
+	if journalErr := writeID3V1Journal(path, stat.Size(), im.data); journalErr != nil {
+		return journalErr
+	}
+	if _, seekErr := file.Seek(-id3v1Length, io.SeekEnd); seekErr != nil {
+		return seekErr
+	}
+	// on failure, the journal is kept, so that the patch can be completed
+	n, writeErr := writeFunc(file, im.data)
+	if writeErr != nil {
+		return writeErr
+	}
+	if n != id3v1Length {
+		return fmt.Errorf("wrote %d bytes to %q, expected to write %d bytes", n, path, id3v1Length)
+	}
+	if syncErr := file.Sync(); syncErr != nil {
+		return syncErr
+	}
+	return fS.Remove(id3v1JournalPath(path))
+}
+
+const (
+	// id3v1JournalMagic identifies an ID3V1 journal; the magic is followed by
+	// the size of the file being patched, as a big-endian 64-bit integer, and
+	// then by the new ID3V1 tag
+	id3v1JournalMagic  = "MP3RJNL1"
+	id3v1JournalLength = len(id3v1JournalMagic) + 8 + id3v1Length
+)
+
+func id3v1JournalPath(path string) string {
+	return path + "-id3v1.journal"
+}
+
+// writeID3V1Journal records the new ID3V1 tag for the file, and flushes the
+// journal, and the directory entry that names it, to storage
+func writeID3V1Journal(path string, size int64, data []byte) error {
+	journal := make([]byte, 0, id3v1JournalLength)
+	journal = append(journal, id3v1JournalMagic...)
+	journal = binary.BigEndian.AppendUint64(journal, uint64(size))
+	journal = append(journal, data...)
+	fS := cmdtoolkit.FileSystem()
+	f, createErr := fS.OpenFile(id3v1JournalPath(path), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if createErr != nil {
+		return createErr
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if _, writeErr := f.Write(journal); writeErr != nil {
+		return writeErr
+	}
+	if syncErr := f.Sync(); syncErr != nil {
+		return syncErr
+	}
+	return syncDirectory(filepath.Dir(path))
+}
+
+// syncDirectory flushes the directory's entries to storage, so that a file
+// created in it survives a crash. Windows cannot flush a directory, but NTFS
+// journals its directory entries.
+func syncDirectory(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, openErr := cmdtoolkit.FileSystem().Open(dir)
+	if openErr != nil {
+		return openErr
+	}
+	defer func() {
+		_ = d.Close()
+	}()
+	return d.Sync()
+}
+
+// recoverID3V1Journal completes an ID3V1 write that was interrupted after its
+// journal was written. An incomplete journal, or one recorded for a file of a
+// different size, means that the file was not patched, and so the journal is
+// discarded.
+func recoverID3V1Journal(path string) error {
+	fS := cmdtoolkit.FileSystem()
+	journalPath := id3v1JournalPath(path)
+	journal, readErr := afero.ReadFile(fS, journalPath)
+	if readErr != nil {
+		if errors.Is(readErr, fs.ErrNotExist) {
+			return nil
 		}
+		return readErr
 	}
-	return
+	if len(journal) == id3v1JournalLength && string(journal[:len(id3v1JournalMagic)]) == id3v1JournalMagic {
+		size := int64(binary.BigEndian.Uint64(journal[len(id3v1JournalMagic):]))
+		data := journal[id3v1JournalLength-id3v1Length:]
+		if replayErr := replayID3V1Journal(path, size, data); replayErr != nil {
+			return replayErr
+		}
+	}
+	return fS.Remove(journalPath)
+}
+
+func replayID3V1Journal(path string, size int64, data []byte) error {
+	file, openErr := cmdtoolkit.FileSystem().OpenFile(path, os.O_RDWR, 0)
+	if openErr != nil {
+		return openErr
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	stat, statErr := file.Stat()
+	if statErr != nil {
+		return statErr
+	}
+	if stat.Size() != size {
+		return nil
+	}
+	if _, writeErr := file.WriteAt(data, size-id3v1Length); writeErr != nil {
+		return writeErr
+	}
+	return file.Sync()
 }
 
 func id3v1NameDiffers(cS *comparableStrings) bool {
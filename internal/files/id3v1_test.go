@@ -4,7 +4,10 @@ Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
 package files
 
 import (
+	"encoding/binary"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
@@ -918,6 +921,8 @@ func TestId3v1MetadataInternalWrite(t *testing.T) {
 		args
 		wantErr  bool
 		wantData []byte
+		// a failed patch leaves its journal, so that it can be completed later
+		wantJournal bool
 	}{
 		"non-existent file": {args: args{oldPath: "./no such file"}, wantErr: true},
 		"short file": {
@@ -932,7 +937,8 @@ func TestId3v1MetadataInternalWrite(t *testing.T) {
 					return 0, fmt.Errorf("ruh-roh")
 				},
 			},
-			wantErr: true,
+			wantErr:     true,
+			wantJournal: true,
 		},
 		"short write": {
 			v1: newID3v1MetadataWithData(id3v1DataSet1),
@@ -942,7 +948,8 @@ func TestId3v1MetadataInternalWrite(t *testing.T) {
 					return 127, nil
 				},
 			},
-			wantErr: true,
+			wantErr:     true,
+			wantJournal: true,
 		},
 		"good write": {
 			v1: newID3v1MetadataWithData(id3v1DataSet2),
@@ -994,6 +1001,11 @@ func TestId3v1MetadataInternalWrite(t *testing.T) {
 					t.Errorf("id3v1Metadata.internalWrite() got %v want %v", got, tt.wantData)
 				}
 			}
+			journalExists, _ := afero.Exists(cmdtoolkit.FileSystem(), id3v1JournalPath(tt.args.oldPath))
+			if journalExists != tt.wantJournal {
+				t.Errorf("id3v1Metadata.internalWrite() journal exists = %t, want %t", journalExists,
+					tt.wantJournal)
+			}
 		})
 	}
 }
@@ -1308,3 +1320,163 @@ func TestRuneMapping(t *testing.T) {
 		}
 	}
 }
+
+func TestRecoverID3V1Journal(t *testing.T) {
+	originalFileSystem := cmdtoolkit.AssignFileSystem(afero.NewMemMapFs())
+	defer func() {
+		cmdtoolkit.AssignFileSystem(originalFileSystem)
+	}()
+	testDir := "id3v1journal"
+	_ = cmdtoolkit.Mkdir(testDir)
+	audio := make([]byte, 256)
+	original := append(append([]byte{}, audio...), id3v1DataSet1...)
+	patched := append(append([]byte{}, audio...), id3v1DataSet2...)
+	journal := func(size int, data []byte) []byte {
+		content := []byte(id3v1JournalMagic)
+		content = binary.BigEndian.AppendUint64(content, uint64(size))
+		return append(content, data...)
+	}
+	tests := map[string]struct {
+		journal  []byte
+		wantData []byte
+	}{
+		"no journal": {wantData: original},
+		"complete journal": {
+			journal:  journal(len(original), id3v1DataSet2),
+			wantData: patched,
+		},
+		"incomplete journal": {
+			journal:  journal(len(original), id3v1DataSet2)[:100],
+			wantData: original,
+		},
+		"journal for a different file size": {
+			journal:  journal(len(original)+1, id3v1DataSet2),
+			wantData: original,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(testDir, name+".mp3")
+			_ = createNamedFile(path, original)
+			if tt.journal != nil {
+				_ = createNamedFile(id3v1JournalPath(path), tt.journal)
+			}
+			if err := recoverID3V1Journal(path); err != nil {
+				t.Errorf("recoverID3V1Journal() error = %v", err)
+			}
+			if got, _ := afero.ReadFile(cmdtoolkit.FileSystem(), path); !reflect.DeepEqual(got, tt.wantData) {
+				t.Errorf("recoverID3V1Journal() got %v want %v", got, tt.wantData)
+			}
+			if exists, _ := afero.Exists(cmdtoolkit.FileSystem(), id3v1JournalPath(path)); exists {
+				t.Errorf("recoverID3V1Journal() left the journal")
+			}
+		})
+	}
+}
+
+func TestInternalReadId3V1Metadata_journal(t *testing.T) {
+	originalFileSystem := cmdtoolkit.AssignFileSystem(afero.NewMemMapFs())
+	defer func() {
+		cmdtoolkit.AssignFileSystem(originalFileSystem)
+	}()
+	testDir := "id3v1journalread"
+	_ = cmdtoolkit.Mkdir(testDir)
+	original := append(make([]byte, 256), id3v1DataSet1...)
+	path := filepath.Join(testDir, "track.mp3")
+	_ = createNamedFile(path, original)
+	journal := binary.BigEndian.AppendUint64([]byte(id3v1JournalMagic), uint64(len(original)))
+	journal = append(journal, id3v1DataSet2...)
+	_ = createNamedFile(id3v1JournalPath(path), journal)
+	got, err := internalReadID3V1Metadata(path, fileReader)
+	if err != nil {
+		t.Errorf("internalReadID3V1Metadata() error = %v", err)
+		return
+	}
+	if !reflect.DeepEqual(got.data, id3v1DataSet1) {
+		t.Errorf("internalReadID3V1Metadata() got %v want %v", got.data, id3v1DataSet1)
+	}
+	if content, _ := afero.ReadFile(cmdtoolkit.FileSystem(), path); !reflect.DeepEqual(content, original) {
+		t.Errorf("internalReadID3V1Metadata() changed the file")
+	}
+	if exists, _ := afero.Exists(cmdtoolkit.FileSystem(), id3v1JournalPath(path)); !exists {
+		t.Errorf("internalReadID3V1Metadata() removed the journal")
+	}
+}
+
+// benchmarkLibrary creates a library of tracks of the specified size, in the os
+// file system, each with an ID3V1 tag
+func benchmarkLibrary(b *testing.B, tracks, size int) []string {
+	b.Helper()
+	dir := b.TempDir()
+	content := make([]byte, size-id3v1Length)
+	content = append(content, id3v1DataSet1...)
+	paths := make([]string, 0, tracks)
+	for k := range tracks {
+		path := filepath.Join(dir, fmt.Sprintf("%02d track.mp3", k+1))
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			b.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// copyAndRewrite rewrites the ID3V1 tag as the ID3V1 writer once did, copying
+// the entire file and then renaming the copy; it is kept as a baseline
+func copyAndRewrite(path string, data []byte) error {
+	src, openErr := os.Open(path)
+	if openErr != nil {
+		return openErr
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+	tmp, createErr := os.Create(path + "-id3v1")
+	if createErr != nil {
+		return createErr
+	}
+	defer func() {
+		_ = tmp.Close()
+	}()
+	n, copyErr := io.Copy(tmp, src)
+	if copyErr != nil {
+		return copyErr
+	}
+	if _, writeErr := tmp.WriteAt(data, n-id3v1Length); writeErr != nil {
+		return writeErr
+	}
+	_ = tmp.Close()
+	return os.Rename(path+"-id3v1", path)
+}
+
+// BenchmarkID3V1Write reports the throughput, in terms of the size of the
+// tracks rewritten, of rewriting the ID3V1 tags of a library of tracks of
+// typical sizes, in place and by copying
+func BenchmarkID3V1Write(b *testing.B) {
+	const tracks = 16
+	for _, size := range []int{1 << 20, 8 << 20, 32 << 20} {
+		v1 := newID3v1MetadataWithData(id3v1DataSet2)
+		b.Run(fmt.Sprintf("in place/%dMiB", size>>20), func(b *testing.B) {
+			paths := benchmarkLibrary(b, tracks, size)
+			b.SetBytes(int64(tracks * size))
+			for b.Loop() {
+				for _, path := range paths {
+					if err := v1.write(path); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("copy/%dMiB", size>>20), func(b *testing.B) {
+			paths := benchmarkLibrary(b, tracks, size)
+			b.SetBytes(int64(tracks * size))
+			for b.Loop() {
+				for _, path := range paths {
+					if err := copyAndRewrite(path, v1.data); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -23,6 +23,9 @@ type id3v2Metadata struct {
 	trackName         string
 	trackNumber       int
 	year              string
+	version           byte
+	text              []encodedText
+	frames            []string
 }
 
 func readID3V2Tag(path string) (*id3v2.Tag, error) {
@@ -44,16 +47,44 @@ func isTagAbsent(tag *id3v2.Tag) bool {
 	return tag.Count() == 0
 }
 
-func rawReadID3V2Metadata(path string) (d *id3v2Metadata) {
-	d = &id3v2Metadata{}
+// rawReadID3V2Metadata reads the metadata from the file's ID3V2 tag; the tag is
+// read lazily, if possible, and otherwise parsed in full
+func rawReadID3V2Metadata(path string) *id3v2Metadata {
+	if d, ok := lazilyReadID3V2Metadata(path); ok {
+		return d
+	}
+	return parseID3V2Metadata(path)
+}
+
+// parseID3V2Metadata reads the metadata from the file's ID3V2 tag, parsing the
+// whole tag
+func parseID3V2Metadata(path string) *id3v2Metadata {
 	tag, readErr := readID3V2Tag(path)
 	if readErr != nil {
-		d.err = readErr
-		return
+		return &id3v2Metadata{err: readErr}
 	}
 	defer func() {
 		_ = tag.Close()
 	}()
+	d := newID3V2Metadata(tag)
+	if d.err != nil {
+		return d
+	}
+	if frames, listErr := readID3V2FrameIDs(path); listErr == nil {
+		slices.Sort(frames)
+		d.frames = frames
+	} else {
+		// duplicated frames cannot be detected
+		d.frames = slices.Sorted(maps.Keys(tag.AllFrames()))
+	}
+	return d
+}
+
+// newID3V2Metadata collects the metadata from a parsed tag; the identifiers of
+// the tag's frames, including any duplicates, which the tag does not hold, are
+// left to the caller
+func newID3V2Metadata(tag *id3v2.Tag) (d *id3v2Metadata) {
+	d = &id3v2Metadata{}
 	trackNumber, trackErr := toTrackNumber(tag.GetTextFrame(trackFrame).Text)
 	if trackErr != nil {
 		d.err = trackErr
@@ -67,6 +98,15 @@ func rawReadID3V2Metadata(path string) (d *id3v2Metadata) {
 	d.year = removeLeadingBOMs(tag.Year())
 	mcdiFramers := tag.AllFrames()[mcdiFrame]
 	d.musicCDIdentifier = selectUnknownFrame(mcdiFramers)
+	d.version = tag.Version()
+	for id, frames := range tag.AllFrames() {
+		for _, frame := range frames {
+			if text, found := frameText(id, frame); found {
+				d.text = append(d.text, text)
+			}
+		}
+	}
+	slices.SortStableFunc(d.text, func(a, b encodedText) int { return strings.Compare(a.id, b.id) })
 	return
 }
 
@@ -170,6 +210,26 @@ func updateID3V2TrackMetadata(tm *TrackMetadata, path string) error {
 		_ = tag.Close()
 	}()
 	tag.SetDefaultEncoding(id3v2.EncodingUTF8)
+	applyID3V2Corrections(tag, tm)
+	applyID3V2Policy(tag)
+	return tag.Save()
+}
+
+// applyID3V2Corrections writes the corrected ID3V2 values into the tag
+func applyID3V2Corrections(tag *id3v2.Tag, tm *TrackMetadata) {
+	const src = ID3V2
+	removeFrame := func(removal bool, id string) {
+		if removal {
+			tag.DeleteFrames(id)
+		}
+	}
+	removeFrame(tm.artistName(src).removal, tag.CommonID("Artist"))
+	removeFrame(tm.albumName(src).removal, tag.CommonID("Album/Movie/Show title"))
+	removeFrame(tm.albumGenre(src).removal, tag.CommonID("Content type"))
+	removeFrame(tm.albumYear(src).removal, tag.CommonID("Year"))
+	removeFrame(tm.trackName(src).removal, tag.CommonID("Title"))
+	removeFrame(tm.trackNumber(src).removal, "TRCK")
+	removeFrame(tm.cdIdentifier().removal, mcdiFrame)
 	if artistName := tm.artistName(src).correctedValue(); artistName != "" {
 		tag.SetArtist(artistName)
 	}
@@ -193,7 +253,6 @@ func updateID3V2TrackMetadata(tm *TrackMetadata, path string) error {
 		tag.DeleteFrames(mcdiFrame)
 		tag.AddFrame(mcdiFrame, cdIdentifier)
 	}
-	return tag.Save()
 }
 
 type id3v2TrackFrame struct {
@@ -91,6 +91,16 @@ func createID3v2TaggedData(audio []byte, frames map[string]string) []byte {
 
 }
 
+// isoText returns the encoded text of the frames written by
+// createID3v2TaggedData, sorted by frame identifier
+func isoText(frames map[string]string) []encodedText {
+	text := make([]encodedText, 0, len(frames))
+	for _, id := range slices.Sorted(maps.Keys(frames)) {
+		text = append(text, encodedText{id: id, encoding: id3v2.EncodingISO, text: []string{frames[id]}})
+	}
+	return text
+}
+
 func Test_rawReadID3V2Metadata(t *testing.T) {
 	originalFileSystem := cmdtoolkit.AssignFileSystem(afero.NewMemMapFs())
 	defer func() {
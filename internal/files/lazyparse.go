@@ -0,0 +1,141 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/bogem/id3v2/v2"
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+)
+
+// pictureDescriptionLength is how much of an attached picture frame is read in
+// order to decode the picture's description, which precedes the picture data;
+// descriptions are rarely more than a few dozen characters
+const pictureDescriptionLength = 1024
+
+// isDecodedFrame determines whether reading a track's metadata decodes the
+// frame: the text frames, the other frames holding text whose encoding is
+// checked, and the music CD identifier. Other frames are skipped.
+func isDecodedFrame(id string) bool {
+	return strings.HasPrefix(id, "T") || id == "COMM" || id == "USLT" || id == attachedPictureFrame || id == mcdiFrame
+}
+
+// lazilyReadID3V2Metadata reads the metadata from the file's ID3V2 tag without
+// parsing the whole tag: it reads the tag header, walks the frame headers, and
+// reads and decodes only the frames that isDecodedFrame selects; of an
+// attached picture, only enough is read to decode its description. The
+// selected frames are decoded by the ID3V2 library, just as if the whole tag
+// had been parsed.
+//
+// It reports false if the tag cannot be read lazily: if the file has no ID3V2
+// tag at its start, or if the tag has an extended header, is unsynchronised,
+// has frames that cannot be walked, or has other features that the ID3V2
+// library would read differently. Such tags must be parsed in full.
+func lazilyReadID3V2Metadata(path string) (*id3v2Metadata, bool) {
+	file, openErr := cmdtoolkit.FileSystem().Open(path)
+	if openErr != nil {
+		return nil, false
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	stat, statErr := file.Stat()
+	if statErr != nil {
+		return nil, false
+	}
+	b := readID3V2Block(file, stat.Size(), 0)
+	if !isLazilyReadable(b) {
+		return nil, false
+	}
+	if len(b.frames) == 0 {
+		return &id3v2Metadata{err: errNoID3V2MetadataFound}, true
+	}
+	var body []byte
+	ids := make([]string, 0, len(b.frames))
+	for _, frame := range b.frames {
+		ids = append(ids, frame.id)
+		if !isDecodedFrame(frame.id) {
+			continue
+		}
+		data, readErr := readDecodedFrame(file, b.version, frame)
+		if readErr != nil {
+			return nil, false
+		}
+		body = appendFrame(body, b.version, frame, data)
+	}
+	tag, parseErr := parseSyntheticTag(b.version, body)
+	if parseErr != nil {
+		// let the ID3V2 library report the problem
+		return nil, false
+	}
+	d := newID3V2Metadata(tag)
+	if d.err == nil {
+		slices.Sort(ids)
+		d.frames = ids
+	}
+	return d, true
+}
+
+// isLazilyReadable determines whether the tag's frames can be read lazily,
+// with the same results as the ID3V2 library would get by parsing the whole
+// tag
+func isLazilyReadable(b *id3v2Block) bool {
+	switch {
+	case b == nil || !b.parsed || b.version < 3:
+		return false
+	case b.flags&(id3v2UnsynchronisedFlag|id3v2ExtendedHeaderFlag) != 0:
+		// the ID3V2 library reads neither
+		return false
+	case !b.synchsafe:
+		// the ID3V2 library reads ID3V2.4 frame sizes only as synchsafe
+		// integers
+		return false
+	}
+	// the ID3V2 library stops reading at an empty frame
+	return !slices.ContainsFunc(b.frames, func(f id3v2Frame) bool { return f.size == 0 })
+}
+
+// readDecodedFrame reads the data of a frame that is to be decoded; of an
+// attached picture, only the start of the frame is read, unless it is too
+// short to hold the picture's description
+func readDecodedFrame(r io.ReaderAt, version byte, frame id3v2Frame) ([]byte, error) {
+	if frame.id != attachedPictureFrame || frame.size <= pictureDescriptionLength {
+		return frame.read(r)
+	}
+	prefix := make([]byte, pictureDescriptionLength)
+	if _, readErr := r.ReadAt(prefix, frame.offset); readErr != nil {
+		return nil, readErr
+	}
+	// the description has been read in full if some picture data follows it
+	tag, parseErr := parseSyntheticTag(version, appendFrame(nil, version, frame, prefix))
+	if parseErr == nil {
+		if frames := tag.GetFrames(attachedPictureFrame); len(frames) == 1 {
+			if picture, ok := frames[0].(id3v2.PictureFrame); ok && len(picture.Picture) != 0 {
+				return prefix, nil
+			}
+		}
+	}
+	return frame.read(r)
+}
+
+// appendFrame appends the frame, with the specified data, to a tag body
+func appendFrame(body []byte, version byte, frame id3v2Frame, data []byte) []byte {
+	body = append(body, frame.id...)
+	body = append(body, encodeSize(len(data), version == 4)...)
+	body = append(body, frame.flags[:]...)
+	return append(body, data...)
+}
+
+// parseSyntheticTag parses a tag made from the frames in body
+func parseSyntheticTag(version byte, body []byte) (*id3v2.Tag, error) {
+	content := []byte{'I', 'D', '3', version, 0, 0}
+	content = append(content, encodeSize(len(body), true)...)
+	content = append(content, body...)
+	return id3v2.ParseReader(bytes.NewReader(content), id3v2.Options{Parse: true})
+}
@@ -0,0 +1,164 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/spf13/afero"
+)
+
+// makeFrame makes a frame with the specified data, whose size is synchsafe or
+// plain
+func makeFrame(id string, data []byte, synchsafe bool) []byte {
+	frame := []byte(id)
+	frame = append(frame, encodeSize(len(data), synchsafe)...)
+	frame = append(frame, 0, 0)
+	return append(frame, data...)
+}
+
+// makePictureData makes the data of an attached picture frame; the description
+// must already be encoded, including its terminator
+func makePictureData(encoding byte, description []byte, pictureSize int) []byte {
+	data := []byte{encoding}
+	data = append(data, "image/jpeg\x00"...)
+	data = append(data, 3) // front cover
+	data = append(data, description...)
+	return append(data, bytes.Repeat([]byte{0xD8}, pictureSize)...)
+}
+
+func TestLazilyReadID3V2Metadata(t *testing.T) {
+	originalFileSystem := cmdtoolkit.AssignFileSystem(afero.NewMemMapFs())
+	defer func() {
+		cmdtoolkit.AssignFileSystem(originalFileSystem)
+	}()
+	testDir := "lazyParse"
+	_ = cmdtoolkit.Mkdir(testDir)
+	audio := bytes.Repeat([]byte{0xFF, 0xFB, 0x90, 0x64}, 64)
+	v3Frames := [][]byte{
+		makeSizedTextFrame("TALB", "fine album", false),
+		makeSizedTextFrame("TPE1", "fine artist", false),
+		makeSizedTextFrame("TIT2", "fine track", false),
+		makeSizedTextFrame("TRCK", "3/12", false),
+		makeSizedTextFrame("TYER", "1999", false),
+		makeSizedTextFrame("TCON", "(17)Rock", false),
+		makeFrame("APIC", makePictureData(0, []byte("cover\x00"), 64*1024), false),
+		makeFrame("COMM", []byte("\x00engshort\x00a comment"), false),
+		makeFrame("TXXX", []byte("\x00key\x00value"), false),
+		makeFrame("PRIV", bytes.Repeat([]byte{1}, 4096), false),
+		makeFrame("MCDI", []byte{1, 2, 3, 4}, false),
+	}
+	// "cover" in UTF-16, with a byte order mark
+	utf16Description := []byte{0xFF, 0xFE, 'c', 0, 'o', 0, 'v', 0, 'e', 0, 'r', 0, 0, 0}
+	v4Frames := [][]byte{
+		makeFrame("TALB", []byte("\x03fine album"), true),
+		makeFrame("TPE1", []byte("\x03fine artist"), true),
+		makeFrame("TIT2", []byte("\x03fine track"), true),
+		makeFrame("TRCK", []byte("\x034"), true),
+		makeFrame("TDRC", []byte("\x032001"), true),
+		makeFrame("APIC", makePictureData(1, utf16Description, 200*1024), true),
+	}
+	longDescription := append(bytes.Repeat([]byte{'d'}, 2*pictureDescriptionLength), 0)
+	extendedHeader := []byte{'I', 'D', '3', 3, 0, id3v2ExtendedHeaderFlag}
+	extendedBody := append([]byte{0, 0, 0, 6, 0, 0, 0, 0, 0, 0}, v3Frames[0]...)
+	extendedHeader = append(extendedHeader, encodeSize(len(extendedBody), true)...)
+	tests := map[string]struct {
+		content  []byte
+		wantLazy bool
+	}{
+		"ID3V2.3 tag with artwork": {
+			content:  append(makeID3V2Tag(3, false, 256, v3Frames...), audio...),
+			wantLazy: true,
+		},
+		"ID3V2.4 tag with artwork": {
+			content:  append(makeID3V2Tag(4, false, 0, v4Frames...), audio...),
+			wantLazy: true,
+		},
+		"long picture description": {
+			content: append(makeID3V2Tag(3, false, 0, append(v3Frames[0:4],
+				makeFrame("APIC", makePictureData(0, longDescription, 8192), false))...), audio...),
+			wantLazy: true,
+		},
+		"duplicated frames": {
+			content: append(makeID3V2Tag(3, false, 0, append(v3Frames,
+				makeSizedTextFrame("TIT2", "another track", false))...), audio...),
+			wantLazy: true,
+		},
+		"malformed track number": {
+			content: append(makeID3V2Tag(3, false, 0,
+				makeSizedTextFrame("TIT2", "fine track", false),
+				makeSizedTextFrame("TRCK", "x", false)), audio...),
+			wantLazy: true,
+		},
+		"no frames": {
+			content:  append(makeID3V2Tag(3, false, 100), audio...),
+			wantLazy: true,
+		},
+		"extended header": {
+			content:  append(append(extendedHeader, extendedBody...), audio...),
+			wantLazy: false,
+		},
+		"plain ID3V2.4 frame sizes": {
+			content: append(makeID3V2Tag(4, false, 0,
+				makeFrame("TIT2", append([]byte{3}, bytes.Repeat([]byte{'x'}, 200)...), false),
+				makeFrame("TRCK", []byte("\x031"), false)), audio...),
+			wantLazy: false,
+		},
+		"untagged": {
+			content:  audio,
+			wantLazy: false,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(testDir, name+".mp3")
+			_ = createNamedFile(path, tt.content)
+			want := parseID3V2Metadata(path)
+			got, lazy := lazilyReadID3V2Metadata(path)
+			if lazy != tt.wantLazy {
+				t.Errorf("lazilyReadID3V2Metadata() read lazily = %t, want %t", lazy, tt.wantLazy)
+			}
+			if lazy && !reflect.DeepEqual(got, want) {
+				t.Errorf("lazilyReadID3V2Metadata() = %#v, want %#v", got, want)
+			}
+			if got := rawReadID3V2Metadata(path); !reflect.DeepEqual(got, want) {
+				t.Errorf("rawReadID3V2Metadata() = %#v, want %#v", got, want)
+			}
+		})
+	}
+}
+
+func BenchmarkReadID3V2Metadata(b *testing.B) {
+	originalFileSystem := cmdtoolkit.AssignFileSystem(afero.NewMemMapFs())
+	defer func() {
+		cmdtoolkit.AssignFileSystem(originalFileSystem)
+	}()
+	path := "artwork.mp3"
+	_ = createNamedFile(path, append(makeID3V2Tag(3, false, 0,
+		makeSizedTextFrame("TALB", "fine album", false),
+		makeSizedTextFrame("TPE1", "fine artist", false),
+		makeSizedTextFrame("TIT2", "fine track", false),
+		makeSizedTextFrame("TRCK", "1", false),
+		makeFrame("APIC", makePictureData(0, []byte("cover\x00"), 4*1024*1024), false),
+	), make([]byte, 1024*1024)...))
+	readers := map[string]func(string) *id3v2Metadata{
+		"lazy": rawReadID3V2Metadata,
+		"full": parseID3V2Metadata,
+	}
+	for name, read := range readers {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if d := read(path); d.err != nil {
+					b.Fatal(d.err)
+				}
+			}
+		})
+	}
+}
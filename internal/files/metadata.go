@@ -6,6 +6,10 @@ package files
 
 import (
 	"bytes"
+	"encoding/hex"
+	"maps"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/bogem/id3v2/v2"
@@ -69,6 +73,8 @@ type correctableValue[V metadataValue] struct {
 	original         V
 	correction       V
 	differenceExists bool
+	// the correction removes the value instead of replacing it
+	removal bool
 }
 
 func (cv correctableValue[V]) correctedValue() V {
@@ -90,6 +96,11 @@ type TrackMetadata struct {
 	data              map[sourceType]*commonMetadata
 	musicCDIdentifier correctableValue[id3v2.UnknownFrame]
 	canonicalSrc      sourceType
+	// the ID3V2 tag's version, or 0 if the tag could not be read, the
+	// encodings of its frames' text, and the identifiers of its frames
+	id3v2Version byte
+	id3v2Text    []encodedText
+	id3v2Frames  []string
 }
 
 func newTrackMetadata() *TrackMetadata {
@@ -108,6 +119,8 @@ type TrackMetadataMaker struct {
 	TrackNumber  int
 	CDIdentifier []byte
 	Source       sourceType
+	// the ID3V2 tag's version; 0, the default, leaves the tag's format unknown
+	ID3V2Version byte
 }
 
 func (maker *TrackMetadataMaker) MakeMetadata() *TrackMetadata {
@@ -121,6 +134,7 @@ func (maker *TrackMetadataMaker) MakeMetadata() *TrackMetadata {
 		tm.setTrackNumber(src, maker.TrackNumber)
 	}
 	tm.setCDIdentifier(maker.CDIdentifier)
+	tm.setID3v2Format(maker.ID3V2Version, nil, nil)
 	tm.setCanonicalSource(maker.Source)
 	return tm
 }
@@ -165,31 +179,30 @@ func (tm *TrackMetadata) canonicalArtistName() string {
 	return tm.artistName(tm.canonicalSrc).original
 }
 
-func (tm *TrackMetadata) artistNameDiffers(nameFromFile string) (differs bool) {
+func (tm *TrackMetadata) artistNameDiffers(nameFromFile string, e NameEquivalence) (differs bool) {
 	for _, src := range sourceTypes {
 		comparison := &comparableStrings{
 			external: nameFromFile,
 			metadata: tm.artistName(src).original,
 		}
-		if tm.errorCause(src) == "" && nameComparators[src](comparison) {
+		if tm.errorCause(src) == "" && e.namesDiffer(src, comparison) {
 			differs = true
 			tm.setEditRequired(src)
-			tm.correctArtistName(src, nameFromFile)
+			tm.correctArtistName(src, e.preferredName(nameFromFile))
 		}
 	}
 	return
 }
 
-func (tm *TrackMetadata) canonicalArtistNameMatches(artistNameFromFile string) bool {
+func (tm *TrackMetadata) canonicalArtistNameMatches(artistNameFromFile string, e NameEquivalence) bool {
 	comparison := &comparableStrings{
 		external: artistNameFromFile,
 		metadata: tm.canonicalArtistName(),
 	}
-	comparator, exists := nameComparators[tm.canonicalSrc]
-	if !exists {
+	if _, exists := nameComparators[tm.canonicalSrc]; !exists {
 		return false
 	}
-	return !comparator(comparison)
+	return !e.namesDiffer(tm.canonicalSrc, comparison)
 }
 
 func (tm *TrackMetadata) setAlbumName(src sourceType, name string) {
@@ -209,31 +222,30 @@ func (tm *TrackMetadata) canonicalAlbumName() string {
 	return tm.albumName(tm.canonicalSrc).original
 }
 
-func (tm *TrackMetadata) albumNameDiffers(nameFromFile string) (differs bool) {
+func (tm *TrackMetadata) albumNameDiffers(nameFromFile string, e NameEquivalence) (differs bool) {
 	for _, src := range sourceTypes {
 		comparison := &comparableStrings{
 			external: nameFromFile,
 			metadata: tm.albumName(src).original,
 		}
-		if tm.errorCause(src) == "" && nameComparators[src](comparison) {
+		if tm.errorCause(src) == "" && e.namesDiffer(src, comparison) {
 			differs = true
 			tm.setEditRequired(src)
-			tm.correctAlbumName(src, nameFromFile)
+			tm.correctAlbumName(src, e.preferredName(nameFromFile))
 		}
 	}
 	return
 }
 
-func (tm *TrackMetadata) canonicalAlbumNameMatches(nameFromFile string) bool {
+func (tm *TrackMetadata) canonicalAlbumNameMatches(nameFromFile string, e NameEquivalence) bool {
 	comparison := &comparableStrings{
 		external: nameFromFile,
 		metadata: tm.canonicalAlbumName(),
 	}
-	comparator, exists := nameComparators[tm.canonicalSrc]
-	if !exists {
+	if _, exists := nameComparators[tm.canonicalSrc]; !exists {
 		return false
 	}
-	return !comparator(comparison)
+	return !e.namesDiffer(tm.canonicalSrc, comparison)
 }
 
 func (tm *TrackMetadata) setAlbumGenre(src sourceType, name string) {
@@ -390,6 +402,157 @@ func (tm *TrackMetadata) cdIdentifierDiffers(canonicalCDIdentifier id3v2.Unknown
 	return
 }
 
+// MetadataField identifies a metadata field that rewriting can correct
+type MetadataField int
+
+const (
+	ArtistNameField MetadataField = iota
+	AlbumNameField
+	GenreField
+	YearField
+	TrackNameField
+	TrackNumberField
+	CDIdentifierField
+)
+
+var metadataFieldNames = map[MetadataField]string{
+	ArtistNameField:   "artist",
+	AlbumNameField:    "album",
+	GenreField:        "genre",
+	YearField:         "year",
+	TrackNameField:    "title",
+	TrackNumberField:  "number",
+	CDIdentifierField: "mcdi",
+}
+
+// String returns the field's name, as used in configuration files
+func (f MetadataField) String() string {
+	if name, found := metadataFieldNames[f]; found {
+		return name
+	}
+	return "unknown"
+}
+
+// MetadataFields returns all the fields that rewriting can correct
+func MetadataFields() []MetadataField {
+	return slices.Sorted(maps.Keys(metadataFieldNames))
+}
+
+// MetadataFieldNames returns the names of the fields, sorted alphabetically
+func MetadataFieldNames() []string {
+	return slices.Sorted(maps.Values(metadataFieldNames))
+}
+
+// LookupMetadataField returns the field with the specified name
+func LookupMetadataField(name string) (MetadataField, bool) {
+	for field, fieldName := range metadataFieldNames {
+		if fieldName == name {
+			return field, true
+		}
+	}
+	return ArtistNameField, false
+}
+
+// dropCorrection discards any correction to the field, so that rewriting
+// leaves the field as it is
+func (tm *TrackMetadata) dropCorrection(field MetadataField) {
+	for _, src := range sourceTypes {
+		data := tm.commonMetadata(src)
+		switch field {
+		case ArtistNameField:
+			data.artistName = correctableValue[string]{original: data.artistName.original}
+		case AlbumNameField:
+			data.albumName = correctableValue[string]{original: data.albumName.original}
+		case GenreField:
+			data.albumGenre = correctableValue[string]{original: data.albumGenre.original}
+		case YearField:
+			data.albumYear = correctableValue[string]{original: data.albumYear.original}
+		case TrackNameField:
+			data.trackName = correctableValue[string]{original: data.trackName.original}
+		case TrackNumberField:
+			data.trackNumber = correctableValue[int]{original: data.trackNumber.original}
+		}
+	}
+	if field == CDIdentifierField {
+		tm.musicCDIdentifier = correctableValue[id3v2.UnknownFrame]{original: tm.musicCDIdentifier.original}
+	}
+	tm.refreshEditRequired()
+}
+
+// MetadataChange describes a correction that rewriting makes to one field of
+// one source of a track's metadata
+type MetadataChange struct {
+	Source   string
+	Field    MetadataField
+	OldValue string
+	NewValue string
+}
+
+// changes returns the corrections that rewriting makes; the sources are
+// listed in the order in which they are written
+func (tm *TrackMetadata) changes() []MetadataChange {
+	var result []MetadataChange
+	for _, src := range sourceTypes {
+		data := tm.commonMetadata(src)
+		if !data.requiresEdit {
+			continue
+		}
+		addString := func(field MetadataField, value correctableValue[string]) {
+			if value.differenceExists && value.correction != "" {
+				result = append(result, MetadataChange{
+					Source:   src.name(),
+					Field:    field,
+					OldValue: value.original,
+					NewValue: value.correction,
+				})
+			}
+		}
+		addString(ArtistNameField, data.artistName)
+		addString(AlbumNameField, data.albumName)
+		addString(GenreField, data.albumGenre)
+		addString(YearField, data.albumYear)
+		addString(TrackNameField, data.trackName)
+		if data.trackNumber.differenceExists && data.trackNumber.correction != 0 {
+			// a track number of zero means there was none
+			oldNumber := ""
+			if data.trackNumber.original != 0 {
+				oldNumber = strconv.Itoa(data.trackNumber.original)
+			}
+			result = append(result, MetadataChange{
+				Source:   src.name(),
+				Field:    TrackNumberField,
+				OldValue: oldNumber,
+				NewValue: strconv.Itoa(data.trackNumber.correction),
+			})
+		}
+		mcdi := tm.musicCDIdentifier
+		if src == ID3V2 && mcdi.differenceExists && len(mcdi.correction.Body) != 0 {
+			result = append(result, MetadataChange{
+				Source:   src.name(),
+				Field:    CDIdentifierField,
+				OldValue: hex.EncodeToString(mcdi.original.Body),
+				NewValue: hex.EncodeToString(mcdi.correction.Body),
+			})
+		}
+	}
+	return result
+}
+
+// refreshEditRequired marks each source as requiring an edit only if one of its
+// fields still has a correction
+func (tm *TrackMetadata) refreshEditRequired() {
+	for _, src := range sourceTypes {
+		data := tm.commonMetadata(src)
+		data.requiresEdit = data.artistName.differenceExists ||
+			data.albumName.differenceExists ||
+			data.albumGenre.differenceExists ||
+			data.albumYear.differenceExists ||
+			data.trackName.differenceExists ||
+			data.trackNumber.differenceExists ||
+			(src == ID3V2 && tm.musicCDIdentifier.differenceExists)
+	}
+}
+
 func (tm *TrackMetadata) setCanonicalSource(src sourceType) {
 	if isValidSource(src) {
 		tm.canonicalSrc = src
@@ -404,6 +567,13 @@ func (tm *TrackMetadata) setID3v2Values(d *id3v2Metadata) {
 	tm.setTrackName(ID3V2, d.trackName)
 	tm.setTrackNumber(ID3V2, d.trackNumber)
 	tm.setCDIdentifier(d.musicCDIdentifier.Body)
+	tm.setID3v2Format(d.version, d.text, d.frames)
+}
+
+func (tm *TrackMetadata) setID3v2Format(version byte, text []encodedText, frames []string) {
+	tm.id3v2Version = version
+	tm.id3v2Text = text
+	tm.id3v2Frames = frames
 }
 
 func (tm *TrackMetadata) setID3v1Values(v1 *id3v1Metadata) {
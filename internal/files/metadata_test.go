@@ -4,8 +4,10 @@ Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
 package files
 
 import (
+	"maps"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"testing"
 
 	"github.com/bogem/id3v2/v2"
@@ -787,6 +789,7 @@ func TestInitializeMetadata(t *testing.T) {
 	onlyID3V2Metadata.setCDIdentifier([]byte{0})
 	onlyID3V2Metadata.setCanonicalSource(ID3V2)
 	onlyID3V2Metadata.setErrorCause(ID3V1, "no ID3V1 metadata found")
+	onlyID3V2Metadata.setID3v2Format(3, isoText(frames), slices.Sorted(maps.Keys(frames)))
 	allMetadata := newTrackMetadata()
 	allMetadata.setArtistName(ID3V1, "The Beatles")
 	allMetadata.setAlbumName(ID3V1, "On Air: Live At The BBC, Volum")
@@ -802,6 +805,7 @@ func TestInitializeMetadata(t *testing.T) {
 	allMetadata.setTrackNumber(ID3V2, 2)
 	allMetadata.setCDIdentifier([]byte{0})
 	allMetadata.setCanonicalSource(ID3V2)
+	allMetadata.setID3v2Format(3, isoText(frames), slices.Sorted(maps.Keys(frames)))
 	tests := map[string]struct {
 		path string
 		want *TrackMetadata
@@ -1370,7 +1374,7 @@ func TestTrackMetadata_AlbumNameDiffers(t *testing.T) {
 	}
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
-			if got := tt.tm.albumNameDiffers(tt.nameFromFile); got != tt.wantDiffers {
+			if got := tt.tm.albumNameDiffers(tt.nameFromFile, NameEquivalence{}); got != tt.wantDiffers {
 				t.Errorf("TrackMetadata.albumNameDiffers() = %v, want %v", got, tt.wantDiffers)
 			}
 			if got := tt.tm.albumName(ID3V1).correctedValue(); got != tt.wantCorrectedID3V1AlbumName {
@@ -1545,7 +1549,7 @@ func TestTrackMetadata_ArtistNameDiffers(t *testing.T) {
 	}
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
-			if got := tt.tm.artistNameDiffers(tt.nameFromFile); got != tt.wantDiffers {
+			if got := tt.tm.artistNameDiffers(tt.nameFromFile, NameEquivalence{}); got != tt.wantDiffers {
 				t.Errorf("TrackMetadata.artistNameDiffers() = %v, want %v", got, tt.wantDiffers)
 			}
 			if got := tt.tm.artistName(ID3V1).correctedValue(); got != tt.wantCorrectedID3V1ArtistName {
@@ -1580,6 +1584,50 @@ func TestTrackMetadata_ArtistNameDiffers(t *testing.T) {
 	}
 }
 
+func TestTrackMetadata_ArtistNameDiffers_alias(t *testing.T) {
+	rules := NameEquivalence{Aliases: map[string]string{"Fab Four": "The Beatles"}}
+	tests := map[string]struct {
+		nameFromFile   string
+		metadata       string
+		wantDiffers    bool
+		wantCorrection string
+	}{
+		"preferred name in metadata": {
+			nameFromFile: "Fab Four",
+			metadata:     "The Beatles",
+			wantDiffers:  false,
+		},
+		"alias in metadata": {
+			nameFromFile:   "The Beatles",
+			metadata:       "Fab Four",
+			wantDiffers:    true,
+			wantCorrection: "The Beatles",
+		},
+		"alias in both": {
+			nameFromFile:   "Fab Four",
+			metadata:       "Fab Four",
+			wantDiffers:    true,
+			wantCorrection: "The Beatles",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tm := newTrackMetadata()
+			tm.setArtistName(ID3V1, tt.metadata)
+			tm.setArtistName(ID3V2, tt.metadata)
+			if got := tm.artistNameDiffers(tt.nameFromFile, rules); got != tt.wantDiffers {
+				t.Errorf("TrackMetadata.artistNameDiffers() = %v, want %v", got, tt.wantDiffers)
+			}
+			for _, src := range sourceTypes {
+				if got := tm.artistName(src).correctedValue(); got != tt.wantCorrection {
+					t.Errorf("TrackMetadata.artistNameDiffers() corrected %s artist name = %q, want %q",
+						src.name(), got, tt.wantCorrection)
+				}
+			}
+		})
+	}
+}
+
 func TestTrackMetadata_AlbumGenreDiffers(t *testing.T) {
 	expectedGenre := "rock"
 	// 1. neither ID3V1 nor ID3v2 have errors, and neither ID3V1 nor ID3V2 album
@@ -2051,7 +2099,7 @@ func TestTrackMetadata_CanonicalAlbumNameMatches(t *testing.T) {
 	}
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
-			if got := tt.tm.canonicalAlbumNameMatches(tt.nameFromFile); got != tt.want {
+			if got := tt.tm.canonicalAlbumNameMatches(tt.nameFromFile, NameEquivalence{}); got != tt.want {
 				t.Errorf("TrackMetadata.canonicalAlbumNameMatches() = %v, want %v", got, tt.want)
 			}
 		})
@@ -2105,7 +2153,7 @@ func TestTrackMetadata_CanonicalArtistNameMatches(t *testing.T) {
 	}
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
-			if got := tt.tm.canonicalArtistNameMatches(tt.nameFromFile); got != tt.want {
+			if got := tt.tm.canonicalArtistNameMatches(tt.nameFromFile, NameEquivalence{}); got != tt.want {
 				t.Errorf("TrackMetadata.canonicalArtistNameMatches() = %v, want %v", got, tt.want)
 			}
 		})
@@ -2236,3 +2284,21 @@ func TestTrackMetadataMaker_Make(t *testing.T) {
 		})
 	}
 }
+
+func TestLookupMetadataField(t *testing.T) {
+	for _, field := range MetadataFields() {
+		if got, found := LookupMetadataField(field.String()); !found || got != field {
+			t.Errorf("LookupMetadataField(%q) = %v, %v, want %v, true", field.String(), got, found, field)
+		}
+	}
+	if _, found := LookupMetadataField("composer"); found {
+		t.Errorf("LookupMetadataField(\"composer\") found a field")
+	}
+	want := []string{"album", "artist", "genre", "mcdi", "number", "title", "year"}
+	if got := MetadataFieldNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("MetadataFieldNames() = %v, want %v", got, want)
+	}
+	if got := MetadataField(99).String(); got != "unknown" {
+		t.Errorf("MetadataField.String() = %q, want \"unknown\"", got)
+	}
+}
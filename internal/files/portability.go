@@ -0,0 +1,210 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxPortablePathLength is the longest path, in UTF-16 code units, that
+// Windows applications can use without resorting to extended-length paths
+const MaxPortablePathLength = 260
+
+// PortabilityProfile identifies a target file system, which determines the
+// characters that cannot be used in file names
+type PortabilityProfile struct {
+	name string
+}
+
+// Name returns the profile's name
+func (p PortabilityProfile) Name() string { return p.name }
+
+var (
+	illegalRuneDetectors = map[string]func(r rune) bool{
+		"exfat":   isIllegalRuneForFileNames,
+		"fat32":   isIllegalRuneForFileNames,
+		"linux":   isIllegalRuneForLinuxFileNames,
+		"macos":   isIllegalRuneForMacOSFileNames,
+		"posix":   isIllegalRuneForPOSIXFileNames,
+		"windows": isIllegalRuneForFileNames,
+	}
+	// https://learn.microsoft.com/en-us/windows/win32/fileio/naming-a-file
+	reservedWindowsNames = []string{
+		"AUX", "CON", "NUL", "PRN",
+		"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+		"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+	}
+)
+
+// PortabilityProfileNames returns the sorted names of the known portability
+// profiles
+func PortabilityProfileNames() []string {
+	names := make([]string, 0, len(illegalRuneDetectors))
+	for name := range illegalRuneDetectors {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// LookupPortabilityProfile returns the named portability profile; the lookup
+// ignores case
+func LookupPortabilityProfile(name string) (PortabilityProfile, bool) {
+	name = strings.ToLower(name)
+	if _, found := illegalRuneDetectors[name]; !found {
+		return PortabilityProfile{}, false
+	}
+	return PortabilityProfile{name: name}, true
+}
+
+func isIllegalRuneForLinuxFileNames(r rune) bool {
+	return r == 0 || r == '/'
+}
+
+func isIllegalRuneForMacOSFileNames(r rune) bool {
+	return r == 0 || r == '/' || r == ':'
+}
+
+// identifies whether the specified rune is outside the POSIX portable file name
+// character set:
+// https://pubs.opengroup.org/onlinepubs/9699919799/basedefs/V1_chap03.html#tag_03_282
+func isIllegalRuneForPOSIXFileNames(r rune) bool {
+	switch {
+	case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		return false
+	case r == '.', r == '_', r == '-':
+		return false
+	default:
+		return true
+	}
+}
+
+// NameProblems returns descriptions of the reasons why a file or directory name
+// may not be usable on other file systems: Windows reserved names, trailing
+// periods and spaces, and characters that the profile does not allow
+func (p PortabilityProfile) NameProblems(name string) []string {
+	var problems []string
+	baseName, _, _ := strings.Cut(name, ".")
+	if slices.Contains(reservedWindowsNames, strings.ToUpper(strings.TrimRight(baseName, " "))) {
+		problems = append(problems, fmt.Sprintf("%q is a reserved name on Windows", name))
+	}
+	switch {
+	case strings.HasSuffix(name, "."):
+		problems = append(problems, fmt.Sprintf("%q ends with a period", name))
+	case strings.HasSuffix(name, " "):
+		problems = append(problems, fmt.Sprintf("%q ends with a space", name))
+	}
+	var illegal []string
+	isIllegal, found := illegalRuneDetectors[p.name]
+	if !found {
+		isIllegal = isIllegalRuneForFileNames
+	}
+	for _, r := range name {
+		if isIllegal(r) {
+			if s := fmt.Sprintf("%q", r); !slices.Contains(illegal, s) {
+				illegal = append(illegal, s)
+			}
+		}
+	}
+	if len(illegal) != 0 {
+		problems = append(problems, fmt.Sprintf("%q contains characters that cannot be used on %s: %s",
+			name, p.name, strings.Join(illegal, ", ")))
+	}
+	return problems
+}
+
+// PathLength returns the length of the absolute form of a path in UTF-16 code
+// units, the measure Windows uses to enforce its path length limit
+func PathLength(path string) int {
+	if absolutePath, err := filepath.Abs(path); err == nil {
+		path = absolutePath
+	}
+	return len(utf16.Encode([]rune(path)))
+}
+
+// NameCollisions examines the names of the files or directories within a
+// single directory and returns, for each name that collides with another
+// name, descriptions of the collisions: names whose NFC and NFD forms are
+// identical, and names that differ only in letter case, cannot coexist on
+// many file systems
+func NameCollisions(names []string) map[string][]string {
+	collisions := map[string][]string{}
+	byNormalForm := map[string][]string{}
+	byFoldedCase := map[string][]string{}
+	for _, name := range names {
+		normalForm := norm.NFC.String(name)
+		byNormalForm[normalForm] = append(byNormalForm[normalForm], name)
+		foldedForm := cases.Fold().String(normalForm)
+		byFoldedCase[foldedForm] = append(byFoldedCase[foldedForm], name)
+	}
+	recordCollisions(collisions, byNormalForm, "differs only in Unicode normalization (NFC vs NFD) from",
+		func(_, _ string) bool { return true })
+	// names with identical normal forms have already been reported
+	recordCollisions(collisions, byFoldedCase, "differs only in letter case from",
+		func(name, other string) bool { return norm.NFC.String(name) != norm.NFC.String(other) })
+	return collisions
+}
+
+func recordCollisions(collisions, groups map[string][]string, description string, related func(string, string) bool) {
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		for _, name := range group {
+			var others []string
+			for _, other := range group {
+				if other != name && related(name, other) {
+					others = append(others, fmt.Sprintf("%q", other))
+				}
+			}
+			if len(others) != 0 {
+				slices.Sort(others)
+				collisions[name] = append(collisions[name],
+					fmt.Sprintf("%q %s %s", name, description, strings.Join(others, ", ")))
+			}
+		}
+	}
+}
+
+// PortableName converts a name into one that can be used on any of the
+// profiled file systems other than posix: accents are removed, non-ASCII
+// characters and characters that Windows does not allow are replaced by
+// underscores, runs of spaces are collapsed, reserved names are suffixed by an
+// underscore, the result is truncated to at most maxLength characters, and
+// trailing periods and spaces are removed
+func PortableName(name string, maxLength int) string {
+	var builder strings.Builder
+	for _, r := range norm.NFD.String(name) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// drop combining marks, such as accents
+		case r < unicode.MaxASCII && unicode.IsPrint(r) && !isIllegalRuneForFileNames(r):
+			builder.WriteRune(r)
+		default:
+			builder.WriteRune('_')
+		}
+	}
+	portable := strings.Join(strings.Fields(builder.String()), " ")
+	if baseName, _, _ := strings.Cut(portable, "."); slices.Contains(reservedWindowsNames,
+		strings.ToUpper(baseName)) {
+		portable = baseName + "_" + strings.TrimPrefix(portable, baseName)
+	}
+	if maxLength > 0 && len(portable) > maxLength {
+		portable = portable[:maxLength]
+	}
+	portable = strings.TrimRight(portable, ". ")
+	if portable == "" {
+		portable = "_"
+	}
+	return portable
+}
@@ -0,0 +1,187 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+package files
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookupPortabilityProfile(t *testing.T) {
+	tests := map[string]struct {
+		name  string
+		want  PortabilityProfile
+		want1 bool
+	}{
+		"windows":    {name: "windows", want: PortabilityProfile{name: "windows"}, want1: true},
+		"mixed case": {name: "FAT32", want: PortabilityProfile{name: "fat32"}, want1: true},
+		"unknown":    {name: "amiga", want: PortabilityProfile{}, want1: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, got1 := LookupPortabilityProfile(tt.name)
+			if got != tt.want {
+				t.Errorf("LookupPortabilityProfile() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("LookupPortabilityProfile() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func TestPortabilityProfile_NameProblems(t *testing.T) {
+	tests := map[string]struct {
+		profile string
+		name    string
+		want    []string
+	}{
+		"clean name": {
+			profile: "windows",
+			name:    "01 Come Together.mp3",
+			want:    nil,
+		},
+		"reserved name": {
+			profile: "linux",
+			name:    "con",
+			want:    []string{`"con" is a reserved name on Windows`},
+		},
+		"reserved name with extension": {
+			profile: "linux",
+			name:    "Lpt1.mp3",
+			want:    []string{`"Lpt1.mp3" is a reserved name on Windows`},
+		},
+		"name starting with a reserved name": {
+			profile: "windows",
+			name:    "Console",
+			want:    nil,
+		},
+		"trailing period": {
+			profile: "windows",
+			name:    "Help!.",
+			want:    []string{`"Help!." ends with a period`},
+		},
+		"trailing space": {
+			profile: "windows",
+			name:    "Help! ",
+			want:    []string{`"Help! " ends with a space`},
+		},
+		"illegal characters for windows": {
+			profile: "windows",
+			name:    "What? Why? Who: *",
+			want:    []string{`"What? Why? Who: *" contains characters that cannot be used on windows: '?', ':', '*'`},
+		},
+		"same characters for linux": {
+			profile: "linux",
+			name:    "What? Why? Who: *",
+			want:    nil,
+		},
+		"same characters for macos": {
+			profile: "macos",
+			name:    "What? Why? Who: *",
+			want:    []string{`"What? Why? Who: *" contains characters that cannot be used on macos: ':'`},
+		},
+		"posix": {
+			profile: "posix",
+			name:    "01 Come_Together.mp3",
+			want:    []string{`"01 Come_Together.mp3" contains characters that cannot be used on posix: ' '`},
+		},
+		"everything": {
+			profile: "fat32",
+			name:    "NUL.a|.",
+			want: []string{
+				`"NUL.a|." is a reserved name on Windows`,
+				`"NUL.a|." ends with a period`,
+				`"NUL.a|." contains characters that cannot be used on fat32: '|'`,
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, _ := LookupPortabilityProfile(tt.profile)
+			if got := p.NameProblems(tt.name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PortabilityProfile.NameProblems() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNameCollisions(t *testing.T) {
+	tests := map[string]struct {
+		names []string
+		want  map[string][]string
+	}{
+		"no names": {names: nil, want: map[string][]string{}},
+		"no collisions": {
+			names: []string{"Abbey Road", "Let It Be", "Revolver"},
+			want:  map[string][]string{},
+		},
+		"case collision": {
+			names: []string{"Abbey Road", "ABBEY ROAD", "Let It Be"},
+			want: map[string][]string{
+				"Abbey Road": {`"Abbey Road" differs only in letter case from "ABBEY ROAD"`},
+				"ABBEY ROAD": {`"ABBEY ROAD" differs only in letter case from "Abbey Road"`},
+			},
+		},
+		"normalization collision": {
+			names: []string{"Beyonce\u0301", "Beyonc\u00e9"},
+			want: map[string][]string{
+				"Beyonce\u0301": {
+					"\"Beyonce\u0301\" differs only in Unicode normalization (NFC vs NFD) from \"Beyonc\u00e9\"",
+				},
+				"Beyonc\u00e9": {
+					"\"Beyonc\u00e9\" differs only in Unicode normalization (NFC vs NFD) from \"Beyonce\u0301\"",
+				},
+			},
+		},
+		"both collisions": {
+			names: []string{"Beyonce\u0301", "Beyonc\u00e9", "BEYONC\u00c9"},
+			want: map[string][]string{
+				"Beyonce\u0301": {
+					"\"Beyonce\u0301\" differs only in Unicode normalization (NFC vs NFD) from \"Beyonc\u00e9\"",
+					"\"Beyonce\u0301\" differs only in letter case from \"BEYONC\u00c9\"",
+				},
+				"Beyonc\u00e9": {
+					"\"Beyonc\u00e9\" differs only in Unicode normalization (NFC vs NFD) from \"Beyonce\u0301\"",
+					"\"Beyonc\u00e9\" differs only in letter case from \"BEYONC\u00c9\"",
+				},
+				"BEYONC\u00c9": {
+					"\"BEYONC\u00c9\" differs only in letter case from \"Beyonce\u0301\", \"Beyonc\u00e9\"",
+				},
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := NameCollisions(tt.names); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NameCollisions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortableName(t *testing.T) {
+	tests := map[string]struct {
+		name      string
+		maxLength int
+		want      string
+	}{
+		"clean name":         {name: "Abbey Road", maxLength: 64, want: "Abbey Road"},
+		"accents":            {name: "Beyoncé", maxLength: 64, want: "Beyonce"},
+		"illegal characters": {name: "What? Why? Who: *", maxLength: 64, want: "What_ Why_ Who_ _"},
+		"non-ASCII":          {name: "猫", maxLength: 64, want: "_"},
+		"spaces":             {name: "  Let   It  Be ", maxLength: 64, want: "Let It Be"},
+		"reserved name":      {name: "Con.mp3", maxLength: 64, want: "Con_.mp3"},
+		"truncation":         {name: "Sgt. Pepper's Lonely Hearts Club Band", maxLength: 5, want: "Sgt"},
+		"unlimited":          {name: "Sgt. Pepper's", maxLength: 0, want: "Sgt. Pepper's"},
+		"empty":              {name: "...", maxLength: 64, want: "_"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := PortableName(tt.name, tt.maxLength); got != tt.want {
+				t.Errorf("PortableName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
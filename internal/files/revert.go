@@ -0,0 +1,194 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+// ErrValueChanged is returned when a change cannot be reverted because the
+// field no longer holds the value that the change wrote
+var ErrValueChanged = fmt.Errorf("the current value does not match the recorded value")
+
+var errMetadataNotRead = fmt.Errorf("the metadata has not been read")
+
+func lookupSource(name string) (sourceType, bool) {
+	for _, src := range sourceTypes {
+		if src.name() == name {
+			return src, true
+		}
+	}
+	return undefinedSource, false
+}
+
+// currentValue returns the field's value, formatted as a MetadataChange
+// formats it
+func (tm *TrackMetadata) currentValue(src sourceType, field MetadataField) string {
+	data := tm.commonMetadata(src)
+	switch field {
+	case ArtistNameField:
+		return data.artistName.original
+	case AlbumNameField:
+		return data.albumName.original
+	case GenreField:
+		return data.albumGenre.original
+	case YearField:
+		return data.albumYear.original
+	case TrackNameField:
+		return data.trackName.original
+	case TrackNumberField:
+		return strconv.Itoa(data.trackNumber.original)
+	case CDIdentifierField:
+		return hex.EncodeToString(tm.musicCDIdentifier.original.Body)
+	default:
+		return ""
+	}
+}
+
+// storedValue returns the value that is read back after the value is written
+// to the field; ID3V1 truncates names, repairs characters that cannot be
+// encoded, and maps unknown genres to "Other"
+func storedValue(src sourceType, field MetadataField, value string) string {
+	if src != ID3V1 {
+		return value
+	}
+	v1 := newID3v1Metadata()
+	switch field {
+	case ArtistNameField:
+		v1.setArtist(value)
+		return v1.artist()
+	case AlbumNameField:
+		v1.setAlbum(value)
+		return v1.album()
+	case GenreField:
+		v1.setGenre(value)
+		genre, _ := v1.genre()
+		return genre
+	case YearField:
+		v1.setYear(value)
+		return v1.year()
+	case TrackNameField:
+		v1.setTitle(value)
+		return v1.title()
+	default:
+		return value
+	}
+}
+
+// remove sets the correction that removes the field's value
+func (tm *TrackMetadata) remove(src sourceType, field MetadataField) error {
+	data := tm.commonMetadata(src)
+	switch field {
+	case ArtistNameField:
+		data.artistName = correctableValue[string]{differenceExists: true, removal: true}
+	case AlbumNameField:
+		data.albumName = correctableValue[string]{differenceExists: true, removal: true}
+	case GenreField:
+		data.albumGenre = correctableValue[string]{differenceExists: true, removal: true}
+	case YearField:
+		data.albumYear = correctableValue[string]{differenceExists: true, removal: true}
+	case TrackNameField:
+		data.trackName = correctableValue[string]{differenceExists: true, removal: true}
+	case TrackNumberField:
+		data.trackNumber = correctableValue[int]{differenceExists: true, removal: true}
+	case CDIdentifierField:
+		if src != ID3V2 {
+			return fmt.Errorf("the %s %s value cannot be removed", src.name(), field)
+		}
+		tm.musicCDIdentifier = correctableValue[id3v2.UnknownFrame]{differenceExists: true, removal: true}
+	default:
+		return fmt.Errorf("the field %s cannot be restored", field)
+	}
+	tm.setEditRequired(src)
+	return nil
+}
+
+// restore sets the correction that writes the value to the field; an empty
+// value, which a change records when the field had no value, removes the
+// field's value
+func (tm *TrackMetadata) restore(src sourceType, field MetadataField, value string) error {
+	if value == "" {
+		return tm.remove(src, field)
+	}
+	switch field {
+	case ArtistNameField:
+		tm.correctArtistName(src, value)
+	case AlbumNameField:
+		tm.correctAlbumName(src, value)
+	case GenreField:
+		tm.correctAlbumGenre(src, value)
+	case YearField:
+		tm.correctAlbumYear(src, value)
+	case TrackNameField:
+		tm.correctTrackName(src, value)
+	case TrackNumberField:
+		number, parseErr := strconv.Atoi(value)
+		if parseErr != nil || number < 1 {
+			return fmt.Errorf("the %s %s value %q is not a valid track number", src.name(), field, value)
+		}
+		tm.correctTrackNumber(src, number)
+	case CDIdentifierField:
+		body, decodeErr := hex.DecodeString(value)
+		if src != ID3V2 || decodeErr != nil {
+			return fmt.Errorf("the %s %s value %q cannot be restored", src.name(), field, value)
+		}
+		tm.correctCDIdentifier(body)
+	default:
+		return fmt.Errorf("the field %s cannot be restored", field)
+	}
+	tm.setEditRequired(src)
+	return nil
+}
+
+// prepareRevert verifies that each change can be reverted, and returns the
+// metadata corrections that revert them
+func (t *Track) prepareRevert(changes []MetadataChange) (*TrackMetadata, error) {
+	if t.metadata == nil {
+		return nil, errMetadataNotRead
+	}
+	reverted := newTrackMetadata()
+	for _, change := range changes {
+		src, found := lookupSource(change.Source)
+		if !found {
+			return nil, fmt.Errorf("the metadata source %q is not recognized", change.Source)
+		}
+		if cause := t.metadata.errorCause(src); cause != "" {
+			return nil, fmt.Errorf("the %s metadata cannot be read: %s", src.name(), cause)
+		}
+		if current := t.metadata.currentValue(src, change.Field); current !=
+			storedValue(src, change.Field, change.NewValue) {
+			return nil, fmt.Errorf("%w: the %s %s value is %q, not %q", ErrValueChanged, src.name(), change.Field,
+				current, change.NewValue)
+		}
+		if restoreErr := reverted.restore(src, change.Field, change.OldValue); restoreErr != nil {
+			return nil, restoreErr
+		}
+	}
+	return reverted, nil
+}
+
+// CanRevertMetadata verifies that RevertMetadata can revert the changes; the
+// track's metadata must have been read.
+func (t *Track) CanRevertMetadata(changes []MetadataChange) error {
+	_, revertErr := t.prepareRevert(changes)
+	return revertErr
+}
+
+// RevertMetadata restores the old values of the changes, provided that each
+// field still holds the new value that the change wrote; the track's metadata
+// must have been read. The fields are written by the same code that
+// UpdateMetadata uses.
+func (t *Track) RevertMetadata(changes []MetadataChange) error {
+	reverted, revertErr := t.prepareRevert(changes)
+	if revertErr != nil {
+		return revertErr
+	}
+	return errors.Join(reverted.update(t.filePath)...)
+}
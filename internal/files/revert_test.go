@@ -0,0 +1,162 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+)
+
+func Test_storedValue(t *testing.T) {
+	tests := map[string]struct {
+		src   sourceType
+		field MetadataField
+		value string
+		want  string
+	}{
+		"ID3V2 artist": {
+			src:   ID3V2,
+			field: ArtistNameField,
+			value: "an artist whose name is far too long for ID3V1",
+			want:  "an artist whose name is far too long for ID3V1",
+		},
+		"ID3V1 artist": {
+			src:   ID3V1,
+			field: ArtistNameField,
+			value: "an artist whose name is far too long for ID3V1",
+			want:  "an artist whose name is far to",
+		},
+		"ID3V1 genre": {src: ID3V1, field: GenreField, value: "no such genre", want: "other"},
+		"ID3V1 year":  {src: ID3V1, field: YearField, value: "1999", want: "1999"},
+		"ID3V1 track": {src: ID3V1, field: TrackNumberField, value: "3", want: "3"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := storedValue(tt.src, tt.field, tt.value); got != tt.want {
+				t.Errorf("storedValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrack_RevertMetadata(t *testing.T) {
+	// as with TestTrack_UpdateMetadata, the ID3V2 library requires the os file
+	// system
+	testDir := "revertMetadata"
+	_ = cmdtoolkit.Mkdir(testDir)
+	defer func() {
+		_ = os.RemoveAll(testDir)
+	}()
+	trackName := "revert this track.mp3"
+	_ = createFileWithContent(testDir, trackName, createConsistentlyTaggedData([]byte(trackName), map[string]any{
+		"artist": "unknown artist",
+		"album":  "unknown album",
+		"title":  "unknown title",
+		"genre":  "unknown",
+		"year":   "1900",
+		"track":  1,
+	}))
+	path := filepath.Join(testDir, trackName)
+	newTrack := func(read bool) *Track {
+		track := &Track{filePath: path, simpleName: strings.TrimSuffix(trackName, ".mp3")}
+		if read {
+			track.metadata = initializeMetadata(path)
+		}
+		return track
+	}
+	tests := map[string]struct {
+		t            *Track
+		changes      []MetadataChange
+		wantErr      string
+		wantChanged  bool
+		wantV2Year   string
+		wantV1Artist string
+	}{
+		"metadata not read": {
+			t:       newTrack(false),
+			changes: []MetadataChange{{Source: "ID3V2", Field: YearField, OldValue: "2000", NewValue: "1900"}},
+			wantErr: "the metadata has not been read",
+		},
+		"unknown source": {
+			t:       newTrack(true),
+			changes: []MetadataChange{{Source: "ID3V3", Field: YearField, OldValue: "2000", NewValue: "1900"}},
+			wantErr: `the metadata source "ID3V3" is not recognized`,
+		},
+		"empty old values": {
+			t: newTrack(true),
+			changes: []MetadataChange{
+				{Source: "ID3V2", Field: YearField, OldValue: "", NewValue: "1900"},
+				{Source: "ID3V1", Field: ArtistNameField, OldValue: "", NewValue: "unknown artist"},
+			},
+			wantV2Year:   "",
+			wantV1Artist: "",
+		},
+		"value changed since": {
+			t: newTrack(true),
+			changes: []MetadataChange{
+				{Source: "ID3V1", Field: YearField, OldValue: "2000", NewValue: "1900"},
+				{Source: "ID3V2", Field: YearField, OldValue: "2000", NewValue: "1950"},
+			},
+			wantErr:     `the current value does not match the recorded value: the ID3V2 year value is "1900", not "1950"`,
+			wantChanged: true,
+		},
+		"bad track number": {
+			t:       newTrack(true),
+			changes: []MetadataChange{{Source: "ID3V2", Field: TrackNumberField, OldValue: "x", NewValue: "1"}},
+			wantErr: `the ID3V2 number value "x" is not a valid track number`,
+		},
+		"revert": {
+			t: newTrack(true),
+			changes: []MetadataChange{
+				{Source: "ID3V2", Field: YearField, OldValue: "2000", NewValue: "1900"},
+				{
+					Source:   "ID3V1",
+					Field:    ArtistNameField,
+					OldValue: "the old artist",
+					NewValue: "unknown artist",
+				},
+			},
+			wantV2Year:   "2000",
+			wantV1Artist: "the old artist",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			canErr := tt.t.CanRevertMetadata(tt.changes)
+			err := tt.t.RevertMetadata(tt.changes)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Track.RevertMetadata() error = %v, want %q", err, tt.wantErr)
+				}
+				if canErr == nil || canErr.Error() != tt.wantErr {
+					t.Errorf("Track.CanRevertMetadata() error = %v, want %q", canErr, tt.wantErr)
+				}
+				if got := errors.Is(err, ErrValueChanged); got != tt.wantChanged {
+					t.Errorf("Track.RevertMetadata() errors.Is(ErrValueChanged) = %t, want %t", got, tt.wantChanged)
+				}
+				return
+			}
+			if err != nil || canErr != nil {
+				t.Errorf("Track.RevertMetadata() error = %v, %v, want nil", canErr, err)
+				return
+			}
+			gotTm := initializeMetadata(path)
+			if got := gotTm.albumYear(ID3V2).original; got != tt.wantV2Year {
+				t.Errorf("Track.RevertMetadata() ID3V2 year = %q, want %q", got, tt.wantV2Year)
+			}
+			if got := gotTm.albumYear(ID3V1).original; got != "1900" {
+				t.Errorf("Track.RevertMetadata() ID3V1 year = %q, want %q", got, "1900")
+			}
+			if got := gotTm.artistName(ID3V1).original; got != tt.wantV1Artist {
+				t.Errorf("Track.RevertMetadata() ID3V1 artist = %q, want %q", got, tt.wantV1Artist)
+			}
+		})
+	}
+}
@@ -0,0 +1,404 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/spf13/afero"
+)
+
+const (
+	id3v2FooterLength = 10
+	// maxID3V2Padding is the largest amount of padding that a well-formed
+	// ID3V2 tag is expected to have; tagging software rarely writes more than a
+	// few kilobytes
+	maxID3V2Padding         = 64 * 1024
+	id3v2UnsynchronisedFlag = 0x80
+	id3v2ExtendedHeaderFlag = 0x40
+	id3v2FooterFlag         = 0x10
+)
+
+var errNoStructuralDefects = errors.New("the ID3V2 tags have no structural defects")
+
+// id3v2Frame locates a frame in an ID3V2 tag; its data is read only when it is
+// needed
+type id3v2Frame struct {
+	id    string
+	flags [2]byte
+	// the frame's data occupies [offset, offset+size) in the file
+	offset int64
+	size   int
+}
+
+// read reads the frame's data
+func (f id3v2Frame) read(r io.ReaderAt) ([]byte, error) {
+	data := make([]byte, f.size)
+	if _, readErr := r.ReadAt(data, f.offset); readErr != nil {
+		return nil, readErr
+	}
+	return data, nil
+}
+
+// id3v2Block is an ID3V2 tag as it is stored in a file
+type id3v2Block struct {
+	offset  int64
+	version byte
+	flags   byte
+	// the size of the tag's content, following its header and excluding any
+	// footer
+	size int64
+	// the frames and padding, if the frames could be walked
+	frames    []id3v2Frame
+	padding   int
+	parsed    bool
+	synchsafe bool
+}
+
+func (b *id3v2Block) length() int64 {
+	n := id3v2HeaderLength + b.size
+	if b.flags&id3v2FooterFlag != 0 {
+		n += id3v2FooterLength
+	}
+	return n
+}
+
+// id3v2Layout describes where a file's ID3V2 tags, audio, and ID3V1 tag are
+type id3v2Layout struct {
+	// the tags stacked at the start of the file
+	leading []*id3v2Block
+	// a tag appended to the end of the file, identified by its footer
+	appended *id3v2Block
+	// the audio occupies [audioStart, audioEnd)
+	audioStart int64
+	audioEnd   int64
+	hasID3V1   bool
+}
+
+// readID3V2Block reads the header of the ID3V2 tag, if any, at the specified
+// offset, and walks its frame headers; the frames' data is not read
+func readID3V2Block(r io.ReaderAt, size, offset int64) *id3v2Block {
+	if offset+id3v2HeaderLength > size {
+		return nil
+	}
+	header := make([]byte, id3v2HeaderLength)
+	if _, readErr := r.ReadAt(header, offset); readErr != nil || string(header[0:3]) != "ID3" {
+		return nil
+	}
+	if header[3] < 2 || header[3] > 4 || header[4] == 0xFF || !isSynchsafe(header[6:10]) {
+		return nil
+	}
+	b := &id3v2Block{offset: offset, version: header[3], flags: header[5], size: int64(synchsafeInt(header[6:10]))}
+	if offset+id3v2HeaderLength+b.size > size {
+		return nil
+	}
+	if b.version != 4 {
+		// only ID3V2.4 tags may have footers
+		b.flags &^= id3v2FooterFlag
+	}
+	b.parseFrames(r)
+	return b
+}
+
+// parseFrames walks the tag's frames; ID3V2.4 frame sizes should be
+// synchsafe, but some software writes them as plain integers, and so a walk
+// that fails with synchsafe sizes is retried with plain sizes
+func (b *id3v2Block) parseFrames(r io.ReaderAt) {
+	if b.version == 2 || b.flags&id3v2UnsynchronisedFlag != 0 {
+		// ID3V2.2 frames have three-character identifiers, and the frames of
+		// unsynchronised tags cannot be walked without decoding them
+		return
+	}
+	start := b.offset + id3v2HeaderLength
+	end := start + b.size
+	if b.flags&id3v2ExtendedHeaderFlag != 0 {
+		if b.size < 4 {
+			return
+		}
+		extendedSize := make([]byte, 4)
+		if _, readErr := r.ReadAt(extendedSize, start); readErr != nil {
+			return
+		}
+		// skip the extended header; its ID3V2.3 size excludes the size field
+		if b.version == 3 {
+			start += 4 + int64(binary.BigEndian.Uint32(extendedSize))
+		} else {
+			start += int64(synchsafeInt(extendedSize))
+		}
+	}
+	if b.version == 4 {
+		if frames, padding, ok := walkFrames(r, start, end, true); ok {
+			b.frames, b.padding, b.parsed, b.synchsafe = frames, padding, true, true
+			return
+		}
+	}
+	if frames, padding, ok := walkFrames(r, start, end, false); ok {
+		b.frames, b.padding, b.parsed = frames, padding, true
+		b.synchsafe = b.version != 4
+	}
+}
+
+// walkFrames reads the frame headers from the start offset to the padding or
+// the end offset, and reports whether every frame was well-formed and the
+// padding consists only of zeroes
+func walkFrames(r io.ReaderAt, start, end int64, synchsafe bool) (frames []id3v2Frame, padding int, ok bool) {
+	header := make([]byte, id3v2FrameHeaderLength)
+	offset := start
+	for offset < end {
+		if _, readErr := r.ReadAt(header[0:1], offset); readErr != nil {
+			return nil, 0, false
+		}
+		if header[0] == 0 {
+			if !isZeroFilled(r, offset, end) {
+				return nil, 0, false
+			}
+			return frames, int(end - offset), true
+		}
+		if offset+id3v2FrameHeaderLength > end {
+			return nil, 0, false
+		}
+		if _, readErr := r.ReadAt(header, offset); readErr != nil {
+			return nil, 0, false
+		}
+		id := string(header[0:4])
+		if !frameIDPattern.MatchString(id) {
+			return nil, 0, false
+		}
+		sizeBytes := header[4:8]
+		size := int64(binary.BigEndian.Uint32(sizeBytes))
+		if synchsafe {
+			if !isSynchsafe(sizeBytes) {
+				return nil, 0, false
+			}
+			size = int64(synchsafeInt(sizeBytes))
+		}
+		dataStart := offset + id3v2FrameHeaderLength
+		if size > end-dataStart {
+			return nil, 0, false
+		}
+		frames = append(frames, id3v2Frame{
+			id:     id,
+			flags:  [2]byte{header[8], header[9]},
+			offset: dataStart,
+			size:   int(size),
+		})
+		offset = dataStart + size
+	}
+	return frames, 0, true
+}
+
+// isZeroFilled determines whether the bytes in [start, end) are all zeroes
+func isZeroFilled(r io.ReaderAt, start, end int64) bool {
+	chunk := make([]byte, min(end-start, 4096))
+	for offset := start; offset < end; {
+		n := min(end-offset, int64(len(chunk)))
+		if _, readErr := r.ReadAt(chunk[:n], offset); readErr != nil {
+			return false
+		}
+		if slices.ContainsFunc(chunk[:n], func(c byte) bool { return c != 0 }) {
+			return false
+		}
+		offset += n
+	}
+	return true
+}
+
+// isSynchsafe determines whether none of the bytes has its high bit set
+func isSynchsafe(b []byte) bool {
+	return !slices.ContainsFunc(b, func(c byte) bool { return c&0x80 != 0 })
+}
+
+// readID3V2Layout locates the file's stacked and appended ID3V2 tags
+func readID3V2Layout(r io.ReaderAt, size int64) *id3v2Layout {
+	layout := &id3v2Layout{audioEnd: size}
+	for b := readID3V2Block(r, size, 0); b != nil; b = readID3V2Block(r, size, layout.audioStart) {
+		layout.leading = append(layout.leading, b)
+		layout.audioStart += b.length()
+	}
+	if size-layout.audioStart >= id3v1Length {
+		trailer := make([]byte, 3)
+		if _, readErr := r.ReadAt(trailer, size-id3v1Length); readErr == nil && string(trailer) == "TAG" {
+			layout.hasID3V1 = true
+			layout.audioEnd -= id3v1Length
+		}
+	}
+	footerOffset := layout.audioEnd - id3v2FooterLength
+	if footerOffset < layout.audioStart {
+		return layout
+	}
+	footer := make([]byte, id3v2FooterLength)
+	if _, readErr := r.ReadAt(footer, footerOffset); readErr != nil || string(footer[0:3]) != "3DI" ||
+		!isSynchsafe(footer[6:10]) {
+		return layout
+	}
+	offset := footerOffset - int64(synchsafeInt(footer[6:10])) - id3v2HeaderLength
+	if offset < layout.audioStart {
+		return layout
+	}
+	if b := readID3V2Block(r, size, offset); b != nil && b.flags&id3v2FooterFlag != 0 &&
+		offset+b.length() == layout.audioEnd {
+		layout.appended = b
+		layout.audioEnd = offset
+	}
+	return layout
+}
+
+// defects describes the layout's structural defects
+func (l *id3v2Layout) defects() []string {
+	var defects []string
+	if len(l.leading) > 1 {
+		defects = append(defects, fmt.Sprintf("the file begins with %d ID3V2 tags", len(l.leading)))
+	}
+	if l.appended != nil {
+		defects = append(defects, "the file ends with an appended ID3V2 tag")
+	}
+	if primary := l.primary(); primary != nil {
+		switch {
+		case primary.version == 2 || primary.flags&id3v2UnsynchronisedFlag != 0:
+			// the frames cannot be examined
+		case !primary.parsed:
+			defects = append(defects, fmt.Sprintf("the ID3V2.%d tag's frames cannot be read", primary.version))
+		default:
+			if !primary.synchsafe {
+				defects = append(defects, "the ID3V2.4 tag's frame sizes are not synchsafe")
+			}
+			if primary.padding > maxID3V2Padding {
+				defects = append(defects, fmt.Sprintf("the ID3V2 tag has %d bytes of padding", primary.padding))
+			}
+		}
+	}
+	return defects
+}
+
+// primary returns the tag that ID3V2 readers see: the first tag at the start of
+// the file or, failing that, the appended tag
+func (l *id3v2Layout) primary() *id3v2Block {
+	if len(l.leading) != 0 {
+		return l.leading[0]
+	}
+	return l.appended
+}
+
+// repairedTag builds a single ID3V2 tag, without padding, from the frames of
+// the primary tag and of any other tags of the same version; frames from
+// later tags are kept only if no earlier tag has a frame with the same
+// identifier. The frames' data is read from r.
+func (l *id3v2Layout) repairedTag(r io.ReaderAt) ([]byte, error) {
+	primary := l.primary()
+	if primary == nil || !primary.parsed {
+		return nil, errors.New("the ID3V2 tag cannot be repaired")
+	}
+	blocks := append([]*id3v2Block{}, l.leading...)
+	if l.appended != nil {
+		blocks = append(blocks, l.appended)
+	}
+	var frames []id3v2Frame
+	seen := map[string]bool{}
+	for _, b := range blocks {
+		if b.version != primary.version || !b.parsed {
+			continue
+		}
+		added := map[string]bool{}
+		for _, frame := range b.frames {
+			if seen[frame.id] {
+				continue
+			}
+			frames = append(frames, frame)
+			added[frame.id] = true
+		}
+		for id := range added {
+			seen[id] = true
+		}
+	}
+	var body []byte
+	for _, frame := range frames {
+		data, readErr := frame.read(r)
+		if readErr != nil {
+			return nil, readErr
+		}
+		body = appendFrame(body, primary.version, frame, data)
+	}
+	tag := []byte{'I', 'D', '3', primary.version, 0, 0}
+	tag = append(tag, encodeSize(len(body), true)...)
+	return append(tag, body...), nil
+}
+
+// encodeSize encodes a four-byte ID3V2 size, synchsafe or plain
+func encodeSize(n int, synchsafe bool) []byte {
+	if synchsafe {
+		return []byte{byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+	}
+	return binary.BigEndian.AppendUint32(nil, uint32(n))
+}
+
+// ID3V2StructureDefects reports structural defects in the track's ID3V2 tags:
+// stacked tags at the start of the file, a tag appended to the end of the
+// file, ID3V2.4 frame sizes that are not synchsafe, unreadable frames, and
+// oversized padding. Most ID3V2 readers, including the one mp3repair uses, see
+// only the first tag in a file.
+func (t *Track) ID3V2StructureDefects() []string {
+	file, openErr := cmdtoolkit.FileSystem().Open(t.filePath)
+	if openErr != nil {
+		return nil
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	stat, statErr := file.Stat()
+	if statErr != nil {
+		return nil
+	}
+	return readID3V2Layout(file, stat.Size()).defects()
+}
+
+// RepairID3V2Structure replaces the track's ID3V2 tags with a single tag at the
+// start of the file, holding the frames of the first tag and any frames of the
+// other tags of the same version that the first tag lacks; the frame sizes are
+// written correctly, and the tag has no padding. The audio and any ID3V1 tag
+// are preserved. The track's metadata, if it has been read, is then read
+// again.
+func (t *Track) RepairID3V2Structure() error {
+	fS := cmdtoolkit.FileSystem()
+	content, readErr := afero.ReadFile(fS, t.filePath)
+	if readErr != nil {
+		return readErr
+	}
+	r := bytes.NewReader(content)
+	layout := readID3V2Layout(r, int64(len(content)))
+	if len(layout.defects()) == 0 {
+		return errNoStructuralDefects
+	}
+	tag, tagErr := layout.repairedTag(r)
+	if tagErr != nil {
+		return tagErr
+	}
+	stat, statErr := fS.Stat(t.filePath)
+	if statErr != nil {
+		return statErr
+	}
+	repaired := append(tag, content[layout.audioStart:layout.audioEnd]...)
+	if layout.hasID3V1 {
+		repaired = append(repaired, content[len(content)-id3v1Length:]...)
+	}
+	tmpPath := t.filePath + "-id3v2"
+	if writeErr := afero.WriteFile(fS, tmpPath, repaired, stat.Mode()); writeErr != nil {
+		_ = fS.Remove(tmpPath)
+		return writeErr
+	}
+	if renameErr := fS.Rename(tmpPath, t.filePath); renameErr != nil {
+		_ = fS.Remove(tmpPath)
+		return renameErr
+	}
+	if t.metadata != nil {
+		t.metadata = initializeMetadata(t.filePath)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+)
+
+// makeSizedTextFrame makes an ISO-8859-1 text frame, whose size is synchsafe
+// or plain
+func makeSizedTextFrame(id, content string, synchsafe bool) []byte {
+	frame := []byte(id)
+	frame = append(frame, encodeSize(1+len(content), synchsafe)...)
+	frame = append(frame, 0, 0, 0)
+	return append(frame, content...)
+}
+
+// makeID3V2Tag makes an ID3V2 tag from its frames, padding, and, for ID3V2.4
+// tags, an optional footer
+func makeID3V2Tag(version byte, footer bool, padding int, frames ...[]byte) []byte {
+	var body []byte
+	for _, frame := range frames {
+		body = append(body, frame...)
+	}
+	body = append(body, make([]byte, padding)...)
+	var flags byte
+	if footer {
+		flags = id3v2FooterFlag
+	}
+	tag := []byte{'I', 'D', '3', version, 0, flags}
+	tag = append(tag, encodeSize(len(body), true)...)
+	tag = append(tag, body...)
+	if footer {
+		tag = append(tag, '3', 'D', 'I', version, 0, flags)
+		tag = append(tag, encodeSize(len(body), true)...)
+	}
+	return tag
+}
+
+func TestTrack_ID3V2Structure(t *testing.T) {
+	// as with TestTrack_UpdateMetadata, the ID3V2 library requires the os file
+	// system
+	testDir := "id3v2Structure"
+	_ = cmdtoolkit.Mkdir(testDir)
+	defer func() {
+		_ = os.RemoveAll(testDir)
+	}()
+	audio := bytes.Repeat([]byte{0xFF, 0xFB, 0x90, 0x64}, 64)
+	id3v1Trailer := append([]byte("TAG"), make([]byte, id3v1Length-3)...)
+	longTitle := string(bytes.Repeat([]byte{'x'}, 200))
+	v3Frames := [][]byte{
+		makeSizedTextFrame("TALB", "fine album", false),
+		makeSizedTextFrame("TIT2", "fine track", false),
+	}
+	v4Frames := [][]byte{
+		makeSizedTextFrame("TALB", "fine album", true),
+		makeSizedTextFrame("TIT2", longTitle, true),
+	}
+	concat := func(parts ...[]byte) []byte {
+		var content []byte
+		for _, part := range parts {
+			content = append(content, part...)
+		}
+		return content
+	}
+	tests := map[string]struct {
+		content     []byte
+		wantDefects []string
+		wantErr     error
+		wantTag     []byte
+		wantID3V1   bool
+	}{
+		"clean": {
+			content: concat(makeID3V2Tag(3, false, 100, v3Frames...), audio),
+			wantErr: errNoStructuralDefects,
+		},
+		"untagged": {
+			content: audio,
+			wantErr: errNoStructuralDefects,
+		},
+		"stacked tags": {
+			content: concat(
+				makeID3V2Tag(3, false, 0, v3Frames...),
+				makeID3V2Tag(3, false, 0,
+					makeSizedTextFrame("TIT2", "old track", false),
+					makeSizedTextFrame("TPE1", "fine artist", false)),
+				audio, id3v1Trailer),
+			wantDefects: []string{"the file begins with 2 ID3V2 tags"},
+			wantTag: makeID3V2Tag(3, false, 0, append(v3Frames,
+				makeSizedTextFrame("TPE1", "fine artist", false))...),
+			wantID3V1: true,
+		},
+		"plain ID3V2.4 frame sizes": {
+			content: concat(makeID3V2Tag(4, false, 0,
+				makeSizedTextFrame("TALB", "fine album", false),
+				makeSizedTextFrame("TIT2", longTitle, false)), audio),
+			wantDefects: []string{"the ID3V2.4 tag's frame sizes are not synchsafe"},
+			wantTag:     makeID3V2Tag(4, false, 0, v4Frames...),
+		},
+		"appended tag": {
+			content:     concat(audio, makeID3V2Tag(4, true, 0, v4Frames...), id3v1Trailer),
+			wantDefects: []string{"the file ends with an appended ID3V2 tag"},
+			wantTag:     makeID3V2Tag(4, false, 0, v4Frames...),
+			wantID3V1:   true,
+		},
+		"oversized padding": {
+			content:     concat(makeID3V2Tag(3, false, maxID3V2Padding+1, v3Frames...), audio),
+			wantDefects: []string{"the ID3V2 tag has 65537 bytes of padding"},
+			wantTag:     makeID3V2Tag(3, false, 0, v3Frames...),
+		},
+		"unreadable frames": {
+			content:     concat(makeID3V2Tag(3, false, 0, []byte("TIT2\x00\x00\x10\x00\x00\x00junk")), audio),
+			wantDefects: []string{"the ID3V2.3 tag's frames cannot be read"},
+			wantErr:     errors.New("the ID3V2 tag cannot be repaired"),
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_ = createFileWithContent(testDir, name+".mp3", tt.content)
+			track := &Track{filePath: filepath.Join(testDir, name+".mp3")}
+			if got := track.ID3V2StructureDefects(); !reflect.DeepEqual(got, tt.wantDefects) {
+				t.Errorf("Track.ID3V2StructureDefects() = %v, want %v", got, tt.wantDefects)
+			}
+			err := track.RepairID3V2Structure()
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Track.RepairID3V2Structure() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			want := concat(tt.wantTag, audio)
+			if tt.wantID3V1 {
+				want = append(want, id3v1Trailer...)
+			}
+			got, _ := os.ReadFile(track.filePath)
+			if !bytes.Equal(got, want) {
+				t.Errorf("Track.RepairID3V2Structure() content = %v, want %v", got, want)
+			}
+			if defects := track.ID3V2StructureDefects(); len(defects) != 0 {
+				t.Errorf("Track.RepairID3V2Structure() left defects %v", defects)
+			}
+		})
+	}
+}
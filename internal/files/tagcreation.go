@@ -0,0 +1,180 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/bogem/id3v2/v2"
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+	"github.com/spf13/afero"
+)
+
+// noID3v1Genre is the ID3V1 genre byte that does not map to any genre
+const noID3v1Genre = 255
+
+var trackTagCreators = map[sourceType]func(tm *TrackMetadata, path string) error{
+	ID3V1: createID3V1Tag,
+	ID3V2: createID3V2Tag,
+}
+
+func (tm *TrackMetadata) tagMissing(src sourceType) bool {
+	switch src {
+	case ID3V1:
+		return tm.errorCause(src) == errNoID3V1MetadataFound.Error()
+	case ID3V2:
+		return tm.errorCause(src) == errNoID3V2MetadataFound.Error()
+	default:
+		return false
+	}
+}
+
+// MissingTags returns the names of the metadata sources (ID3V1, ID3V2) for
+// which the track's file has no tag; the track's metadata must have been read.
+func (t *Track) MissingTags() []string {
+	if t.metadata == nil {
+		return nil
+	}
+	var missing []string
+	for _, src := range sourceTypes {
+		if t.metadata.tagMissing(src) {
+			missing = append(missing, src.name())
+		}
+	}
+	return missing
+}
+
+// CreateMissingTags writes a new tag for each of the named metadata sources for
+// which the track's file has no tag. The artist, album, track name, and track
+// number come from the track's directory and file names; the genre, year, and
+// music CD identifier come from the album's canonical values. The track's
+// metadata is then read again, and the fields written to the new tags are
+// returned.
+func (t *Track) CreateMissingTags(sources ...string) (changes []MetadataChange, e []error) {
+	if t.metadata == nil {
+		e = append(e, errMetadataNotRead)
+		return
+	}
+	created := newTrackMetadata()
+	for _, src := range sourceTypes {
+		if !slices.Contains(sources, src.name()) || !t.metadata.tagMissing(src) {
+			continue
+		}
+		t.setNewTagValues(created, src)
+		if createErr := trackTagCreators[src](created, t.filePath); createErr != nil {
+			created.commonMetadata(src).requiresEdit = false
+			e = append(e, createErr)
+		}
+	}
+	if changes = created.changes(); len(changes) != 0 {
+		t.metadata = initializeMetadata(t.filePath)
+	}
+	return
+}
+
+// AddID3V1Tag appends an ID3V1 tag to the specified file, a copy of the track,
+// if the file has none. The tag's values come from the file's ID3V2 tag; the
+// artist, album, track name, and track number that the ID3V2 tag lacks come
+// from the track's directory and file names. It reports whether a tag was
+// added.
+func (t *Track) AddID3V1Tag(path string) (bool, error) {
+	if _, readErr := internalReadID3V1Metadata(path, fileReader); !errors.Is(readErr, errNoID3V1MetadataFound) {
+		return false, readErr
+	}
+	artistName := t.album.recordingArtist.Name()
+	albumName := t.album.title
+	trackName := t.simpleName
+	trackNumber := t.number
+	var genre, year string
+	if d := rawReadID3V2Metadata(path); d.err == nil {
+		artistName = cmp.Or(d.artistName, artistName)
+		albumName = cmp.Or(d.albumTitle, albumName)
+		trackName = cmp.Or(d.trackName, trackName)
+		trackNumber = cmp.Or(d.trackNumber, trackNumber)
+		genre = d.genre
+		year = d.year
+	}
+	tm := newTrackMetadata()
+	tm.correctArtistName(ID3V1, artistName)
+	tm.correctAlbumName(ID3V1, albumName)
+	tm.correctTrackName(ID3V1, trackName)
+	tm.correctTrackNumber(ID3V1, trackNumber)
+	if genre != "" {
+		tm.correctAlbumGenre(ID3V1, genre)
+	}
+	if year != "" {
+		tm.correctAlbumYear(ID3V1, year)
+	}
+	tm.setEditRequired(ID3V1)
+	if createErr := createID3V1Tag(tm, path); createErr != nil {
+		return false, createErr
+	}
+	return true, nil
+}
+
+func (t *Track) setNewTagValues(tm *TrackMetadata, src sourceType) {
+	tm.correctArtistName(src, t.album.recordingArtist.canonicalName())
+	tm.correctAlbumName(src, t.album.canonicalTitle)
+	if t.album.genre != "" {
+		tm.correctAlbumGenre(src, t.album.genre)
+	}
+	if t.album.year != "" {
+		tm.correctAlbumYear(src, t.album.year)
+	}
+	tm.correctTrackName(src, t.simpleName)
+	tm.correctTrackNumber(src, t.number)
+	if src == ID3V2 && len(t.album.cdIdentifier.Body) != 0 {
+		tm.correctCDIdentifier(t.album.cdIdentifier.Body)
+	}
+	tm.setEditRequired(src)
+}
+
+func createID3V1Tag(tm *TrackMetadata, path string) (fileErr error) {
+	if !tm.editRequired(ID3V1) {
+		return nil
+	}
+	v1 := newID3v1Metadata()
+	v1.writeString("TAG", tagField)
+	v1.writeInt(noID3v1Genre, genreField)
+	v1.applyCorrections(tm)
+	var f afero.File
+	if f, fileErr = cmdtoolkit.FileSystem().OpenFile(path, os.O_APPEND|os.O_WRONLY, 0); fileErr != nil {
+		return
+	}
+	defer func() {
+		fileErr = errors.Join(fileErr, f.Close())
+	}()
+	var n int
+	if n, fileErr = f.Write(v1.data); fileErr == nil && n != id3v1Length {
+		fileErr = fmt.Errorf("wrote %d bytes to %q, expected to write %d bytes", n, path, id3v1Length)
+	}
+	return
+}
+
+func createID3V2Tag(tm *TrackMetadata, path string) error {
+	if !tm.editRequired(ID3V2) {
+		return nil
+	}
+	tag, readErr := readID3V2Tag(path)
+	if tag != nil {
+		defer func() {
+			_ = tag.Close()
+		}()
+	}
+	switch {
+	case readErr == nil:
+		return fmt.Errorf("the file %q already has ID3V2 metadata", path)
+	case !errors.Is(readErr, errNoID3V2MetadataFound) || tag == nil:
+		return readErr
+	}
+	tag.SetDefaultEncoding(id3v2.EncodingUTF8)
+	applyID3V2Corrections(tag, tm)
+	applyID3V2Policy(tag)
+	return tag.Save()
+}
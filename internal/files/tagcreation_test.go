@@ -0,0 +1,223 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bogem/id3v2/v2"
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+)
+
+func TestTrack_CreateMissingTags(t *testing.T) {
+	// as with TestTrack_UpdateMetadata, the ID3V2 library requires the os file
+	// system
+	testDir := "createMissingTags"
+	_ = cmdtoolkit.Mkdir(testDir)
+	defer func() {
+		_ = os.RemoveAll(testDir)
+	}()
+	album := &Album{
+		title:           "fine album",
+		canonicalTitle:  "fine album",
+		genre:           "Classic Rock",
+		year:            "2022",
+		cdIdentifier:    id3v2.UnknownFrame{Body: []byte{1, 2}},
+		recordingArtist: NewArtist("fine artist", filepath.Join(testDir, "fine artist")),
+	}
+	newTrack := func(name string, content []byte) *Track {
+		_ = createFileWithContent(testDir, name, content)
+		path := filepath.Join(testDir, name)
+		return &Track{
+			filePath:   path,
+			simpleName: "fine track",
+			number:     3,
+			album:      album,
+			metadata:   initializeMetadata(path),
+		}
+	}
+	v1Changes := []MetadataChange{
+		{Source: "ID3V1", Field: ArtistNameField, NewValue: "fine artist"},
+		{Source: "ID3V1", Field: AlbumNameField, NewValue: "fine album"},
+		{Source: "ID3V1", Field: GenreField, NewValue: "Classic Rock"},
+		{Source: "ID3V1", Field: YearField, NewValue: "2022"},
+		{Source: "ID3V1", Field: TrackNameField, NewValue: "fine track"},
+		{Source: "ID3V1", Field: TrackNumberField, NewValue: "3"},
+	}
+	v2Changes := []MetadataChange{
+		{Source: "ID3V2", Field: ArtistNameField, NewValue: "fine artist"},
+		{Source: "ID3V2", Field: AlbumNameField, NewValue: "fine album"},
+		{Source: "ID3V2", Field: GenreField, NewValue: "Classic Rock"},
+		{Source: "ID3V2", Field: YearField, NewValue: "2022"},
+		{Source: "ID3V2", Field: TrackNameField, NewValue: "fine track"},
+		{Source: "ID3V2", Field: TrackNumberField, NewValue: "3"},
+		{Source: "ID3V2", Field: CDIdentifierField, NewValue: "0102"},
+	}
+	v2Only := createID3v2TaggedData([]byte("audio"), map[string]string{
+		"TPE1": "fine artist",
+		"TALB": "fine album",
+		"TIT2": "fine track",
+		"TCON": "Classic Rock",
+		"TYER": "2022",
+		"TRCK": "3",
+	})
+	tests := map[string]struct {
+		t           *Track
+		sources     []string
+		wantMissing []string
+		wantChanges []MetadataChange
+		wantErrs    []string
+		wantAfter   []string
+		// the existing ID3V2 tags have no MCDI frame, and so conflict with the
+		// album
+		wantConsistent bool
+	}{
+		"metadata not read": {
+			t:        &Track{},
+			sources:  []string{"ID3V1", "ID3V2"},
+			wantErrs: []string{"the metadata has not been read"},
+		},
+		"untagged, create both": {
+			t:              newTrack("01 untagged.mp3", []byte("audio with no tags at all, but long enough")),
+			sources:        []string{"ID3V1", "ID3V2"},
+			wantMissing:    []string{"ID3V1", "ID3V2"},
+			wantChanges:    append(append([]MetadataChange{}, v1Changes...), v2Changes...),
+			wantConsistent: true,
+		},
+		"untagged, create ID3V2": {
+			t:              newTrack("02 untagged.mp3", []byte("audio with no tags at all, but long enough")),
+			sources:        []string{"ID3V2"},
+			wantMissing:    []string{"ID3V1", "ID3V2"},
+			wantChanges:    v2Changes,
+			wantAfter:      []string{"ID3V1"},
+			wantConsistent: true,
+		},
+		"ID3V2 only, create both": {
+			t:           newTrack("03 v2 only.mp3", v2Only),
+			sources:     []string{"ID3V1", "ID3V2"},
+			wantMissing: []string{"ID3V1"},
+			wantChanges: v1Changes,
+		},
+		"ID3V2 only, create ID3V2": {
+			t:           newTrack("04 v2 only.mp3", v2Only),
+			sources:     []string{"ID3V2"},
+			wantMissing: []string{"ID3V1"},
+			wantAfter:   []string{"ID3V1"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.t.MissingTags(); !reflect.DeepEqual(got, tt.wantMissing) {
+				t.Errorf("Track.MissingTags() = %v, want %v", got, tt.wantMissing)
+			}
+			gotChanges, gotErrs := tt.t.CreateMissingTags(tt.sources...)
+			if !reflect.DeepEqual(gotChanges, tt.wantChanges) {
+				t.Errorf("Track.CreateMissingTags() changes = %v, want %v", gotChanges, tt.wantChanges)
+			}
+			var errStrings []string
+			for _, e := range gotErrs {
+				errStrings = append(errStrings, e.Error())
+			}
+			if !reflect.DeepEqual(errStrings, tt.wantErrs) {
+				t.Errorf("Track.CreateMissingTags() errors = %v, want %v", errStrings, tt.wantErrs)
+			}
+			if len(gotErrs) != 0 {
+				return
+			}
+			if got := tt.t.MissingTags(); !reflect.DeepEqual(got, tt.wantAfter) {
+				t.Errorf("Track.CreateMissingTags() left missing tags %v, want %v", got, tt.wantAfter)
+			}
+			if !tt.t.metadata.IsValid() {
+				t.Errorf("Track.CreateMissingTags() metadata is not valid")
+			}
+			if got := !tt.t.ReconcileMetadata().HasConflicts(); got != tt.wantConsistent {
+				t.Errorf("Track.CreateMissingTags() consistent = %t, want %t: %v", got, tt.wantConsistent,
+					tt.t.ReportMetadataProblems())
+			}
+		})
+	}
+}
+
+func TestTrack_AddID3V1Tag(t *testing.T) {
+	testDir := "addID3V1Tag"
+	_ = cmdtoolkit.Mkdir(testDir)
+	defer func() {
+		_ = os.RemoveAll(testDir)
+	}()
+	album := &Album{
+		title:           "fine album",
+		recordingArtist: NewArtist("fine artist", filepath.Join(testDir, "fine artist")),
+	}
+	track := &Track{simpleName: "fine track", number: 3, album: album}
+	v2Only := createID3v2TaggedData([]byte("audio"), map[string]string{
+		"TPE1": "tagged artist",
+		"TIT2": "tagged track",
+		"TCON": "Classic Rock",
+		"TYER": "2022",
+		"TRCK": "5",
+	})
+	_ = createFileWithContent(testDir, "v2 only.mp3", v2Only)
+	_ = createFileWithContent(testDir, "no tags.mp3", []byte("audio"))
+	type wantTag struct {
+		artist, album, title, year, genre string
+		track                             int
+	}
+	tests := map[string]struct {
+		name    string
+		want    bool
+		wantTag wantTag
+	}{
+		"from ID3V2 tag": {
+			name: "v2 only.mp3",
+			want: true,
+			wantTag: wantTag{
+				artist: "tagged artist",
+				album:  "fine album",
+				title:  "tagged track",
+				year:   "2022",
+				genre:  "classic rock",
+				track:  5,
+			},
+		},
+		"from names": {
+			name:    "no tags.mp3",
+			want:    true,
+			wantTag: wantTag{artist: "fine artist", album: "fine album", title: "fine track", track: 3},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(testDir, tt.name)
+			got, gotErr := track.AddID3V1Tag(path)
+			if got != tt.want || gotErr != nil {
+				t.Errorf("Track.AddID3V1Tag() = %t, %v, want %t, nil", got, gotErr, tt.want)
+			}
+			v1, readErr := internalReadID3V1Metadata(path, fileReader)
+			if readErr != nil {
+				t.Fatalf("Track.AddID3V1Tag() tag cannot be read: %v", readErr)
+			}
+			genre, _ := v1.genre()
+			trackNumber, _ := v1.track()
+			gotTag := wantTag{
+				artist: v1.artist(),
+				album:  v1.album(),
+				title:  v1.title(),
+				year:   v1.year(),
+				genre:  genre,
+				track:  trackNumber,
+			}
+			if gotTag != tt.wantTag {
+				t.Errorf("Track.AddID3V1Tag() tag = %+v, want %+v", gotTag, tt.wantTag)
+			}
+			// a second call finds the tag and leaves the file alone
+			if got, gotErr = track.AddID3V1Tag(path); got || gotErr != nil {
+				t.Errorf("Track.AddID3V1Tag() again = %t, %v, want false, nil", got, gotErr)
+			}
+		})
+	}
+}
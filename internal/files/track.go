@@ -5,13 +5,15 @@ Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
 package files
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/bogem/id3v2/v2"
 	"github.com/cheggaaa/pb/v3"
@@ -119,6 +121,8 @@ type Track struct {
 	simpleName string
 	// number of the track
 	number int
+	// metadata fields that are not to be corrected
+	suppressedFields []MetadataField
 }
 
 // FrameDescription returns a description of a frame based on the frame's name
@@ -173,11 +177,12 @@ func (t *Track) FileName() string {
 // Copy copies a track and optionally associates the copy with a new album
 func (t *Track) Copy(a *Album, addToAlbum bool) *Track {
 	t2 := &Track{
-		filePath:   t.filePath,
-		simpleName: t.simpleName,
-		number:     t.number,
-		metadata:   t.metadata,
-		album:      a, // do not use source track's album!
+		filePath:         t.filePath,
+		simpleName:       t.simpleName,
+		number:           t.number,
+		metadata:         t.metadata,
+		album:            a, // do not use source track's album!
+		suppressedFields: slices.Clone(t.suppressedFields),
 	}
 	if addToAlbum {
 		a.addTrack(t2)
@@ -185,6 +190,21 @@ func (t *Track) Copy(a *Album, addToAlbum bool) *Track {
 	return t2
 }
 
+// StagingCopy returns a copy of the track backed by the named file in the
+// track's directory, rather than by the track's own file; the named file is
+// not created. The copy shares the track's metadata, so that rewriting the
+// copy's file makes the changes that the track needs.
+func (t *Track) StagingCopy(fileName string) *Track {
+	return &Track{
+		filePath:         filepath.Join(t.Directory(), fileName),
+		simpleName:       t.simpleName,
+		number:           t.number,
+		metadata:         t.metadata,
+		album:            t.album,
+		suppressedFields: slices.Clone(t.suppressedFields),
+	}
+}
+
 type TrackMaker struct {
 	Album      *Album
 	FileName   string // just the name of the track file, no parent directories
@@ -263,7 +283,9 @@ func (m MetadataState) HasArtistNameConflict() bool {
 	return m.artistNameConflict
 }
 
-func (m MetadataState) hasConflicts() bool {
+// HasConflicts returns true if any of the track's metadata fields conflicts
+// with the track's file name, its album, or its recording artist.
+func (m MetadataState) HasConflicts() bool {
 	return m.numberingConflict ||
 		m.trackNameConflict ||
 		m.albumNameConflict ||
@@ -273,6 +295,25 @@ func (m MetadataState) hasConflicts() bool {
 		m.mcdiConflict
 }
 
+func (m *MetadataState) suppress(field MetadataField) {
+	switch field {
+	case ArtistNameField:
+		m.artistNameConflict = false
+	case AlbumNameField:
+		m.albumNameConflict = false
+	case GenreField:
+		m.genreConflict = false
+	case YearField:
+		m.yearConflict = false
+	case TrackNameField:
+		m.trackNameConflict = false
+	case TrackNumberField:
+		m.numberingConflict = false
+	case CDIdentifierField:
+		m.mcdiConflict = false
+	}
+}
+
 // HasMCDIConflict returns true if there is conflict between the track's album's
 // music CD identifier and the value of the track's ID3V2 MCDI frame.
 func (m MetadataState) HasMCDIConflict() bool {
@@ -318,14 +359,38 @@ func (t *Track) ReconcileMetadata() MetadataState {
 	}
 	mS.numberingConflict = t.metadata.trackNumberDiffers(t.number)
 	mS.trackNameConflict = t.metadata.trackNameDiffers(t.simpleName)
-	mS.albumNameConflict = t.metadata.albumNameDiffers(t.album.canonicalTitle)
-	mS.artistNameConflict = t.metadata.artistNameDiffers(t.album.recordingArtist.canonicalName())
+	e := t.album.recordingArtist.equivalence
+	mS.albumNameConflict = t.metadata.albumNameDiffers(t.album.canonicalTitle, e)
+	mS.artistNameConflict = t.metadata.artistNameDiffers(t.album.recordingArtist.canonicalName(), e)
 	mS.genreConflict = t.metadata.albumGenreDiffers(t.album.genre)
 	mS.yearConflict = t.metadata.albumYearDiffers(t.album.year)
 	mS.mcdiConflict = t.metadata.cdIdentifierDiffers(t.album.cdIdentifier)
+	for _, field := range t.suppressedFields {
+		mS.suppress(field)
+		t.metadata.dropCorrection(field)
+	}
 	return mS
 }
 
+// SuppressFields prevents conflicts in the specified metadata fields from being
+// reported or corrected
+func (t *Track) SuppressFields(fields ...MetadataField) {
+	for _, field := range fields {
+		if !slices.Contains(t.suppressedFields, field) {
+			t.suppressedFields = append(t.suppressedFields, field)
+		}
+	}
+}
+
+// MetadataChanges returns the corrections that UpdateMetadata makes to the
+// track's metadata; ReconcileMetadata must be called first.
+func (t *Track) MetadataChanges() []MetadataChange {
+	if t.metadata == nil {
+		return nil
+	}
+	return t.metadata.changes()
+}
+
 // ReportMetadataProblems returns a slice of strings describing the problems
 // found by calling ReconcileMetadata().
 func (t *Track) ReportMetadataProblems() []string {
@@ -340,7 +405,7 @@ func (t *Track) ReportMetadataProblems() []string {
 	if s.noMetadata {
 		return []string{"differences cannot be determined: metadata has not been read"}
 	}
-	if !s.hasConflicts() {
+	if !s.HasConflicts() {
 		return nil
 	}
 	// 13: 2 each for
@@ -419,7 +484,7 @@ func (t *Track) ReportMetadataProblems() []string {
 // UpdateMetadata verifies that a track's metadata needs to be edited and then
 // performs that work
 func (t *Track) UpdateMetadata() (e []error) {
-	if !t.ReconcileMetadata().hasConflicts() {
+	if !t.ReconcileMetadata().HasConflicts() {
 		e = append(e, errNoEditNeeded)
 		return
 	}
@@ -432,21 +497,25 @@ func (t *Track) UpdateMetadata() (e []error) {
 
 type empty struct{}
 
-func (t *Track) loadMetadata(openFiles chan empty, bar *pb.ProgressBar) {
+func (t *Track) loadMetadata(wg *sync.WaitGroup, openFiles chan empty, bar *pb.ProgressBar) {
 	if t.needsMetadata() {
 		openFiles <- empty{} // block while full
-		go func() {
+		wg.Go(func() {
 			defer func() {
 				bar.Increment()
 				<-openFiles // read to release a slot
 			}()
 			t.metadata = initializeMetadata(t.filePath)
-		}()
+		})
 	}
 }
 
-// ReadMetadata reads the metadata for all the artists' tracks.
-func ReadMetadata(o output.Bus, artists []*Artist, fileLimit int) {
+// ReadMetadata reads the metadata for all the artists' tracks. If the context
+// is cancelled, no further tracks are read; the reads in progress are allowed
+// to finish, and the tracks that were not read are left without metadata. The
+// albums whose tracks were all read are processed as if the reading had not
+// been interrupted.
+func ReadMetadata(ctx context.Context, o output.Bus, artists []*Artist, fileLimit int) {
 	// count the tracks
 	count := 0
 	for _, artist := range artists {
@@ -456,25 +525,50 @@ func ReadMetadata(o output.Bus, artists []*Artist, fileLimit int) {
 	}
 	o.ErrorPrintln("Reading track metadata.")
 	openFiles := make(chan empty, fileLimit)
-	// derived from the Default ProgressBarTemplate used by the progress bar,
-	// following guidance in the ElementSpeed definition to change the output to
-	// display the speed in tracks per second
-	t := `{{with string . "prefix"}}{{.}} {{end}}{{counters . }} {{bar . }}` +
-		` {{percent . }} {{speed . "%s tracks per second"}}{{with string . "suffix"}}` +
-		` {{.}}{{end}}`
-	bar := pb.New(count).SetWriter(progressWriter(o)).SetTemplateString(t).Start()
+	bar := NewTrackProgressBar(o, count)
+	var wg sync.WaitGroup
+	scheduleMetadataReads(ctx, artists, &wg, openFiles, bar)
+	wg.Wait()
+	bar.Finish()
+	if ctx.Err() != nil {
+		o.ErrorPrintln("Reading track metadata was interrupted.")
+		processFinishedAlbumMetadata(o, artists)
+	} else {
+		processAlbumMetadata(o, artists)
+	}
+	processArtistMetadata(o, artists)
+	reportAllTrackErrors(o, artists)
+}
+
+func scheduleMetadataReads(
+	ctx context.Context,
+	artists []*Artist,
+	wg *sync.WaitGroup,
+	openFiles chan empty,
+	bar *pb.ProgressBar,
+) {
 	for _, artist := range artists {
 		for _, album := range artist.Albums() {
 			for _, track := range album.tracks {
-				track.loadMetadata(openFiles, bar)
+				if ctx.Err() != nil {
+					return
+				}
+				track.loadMetadata(wg, openFiles, bar)
 			}
 		}
 	}
-	waitForFilesClosed(openFiles)
-	bar.Finish()
-	processAlbumMetadata(o, artists)
-	processArtistMetadata(o, artists)
-	reportAllTrackErrors(o, artists)
+}
+
+// NewTrackProgressBar starts a progress bar for work on the specified number of
+// tracks
+func NewTrackProgressBar(o output.Bus, count int) *pb.ProgressBar {
+	// derived from the Default ProgressBarTemplate used by the progress bar,
+	// following guidance in the ElementSpeed definition to change the output to
+	// display the speed in tracks per second
+	t := `{{with string . "prefix"}}{{.}} {{end}}{{counters . }} {{bar . }}` +
+		` {{percent . }} {{speed . "%s tracks per second"}}{{with string . "suffix"}}` +
+		` {{.}}{{end}}`
+	return pb.New(count).SetWriter(progressWriter(o)).SetTemplateString(t).Start()
 }
 
 func progressWriter(o output.Bus) io.Writer {
@@ -495,7 +589,7 @@ func processArtistMetadata(o output.Bus, artists []*Artist) {
 		for _, album := range artist.Albums() {
 			for _, track := range album.tracks {
 				if track.metadata != nil && track.metadata.IsValid() &&
-					track.metadata.canonicalArtistNameMatches(artist.Name()) {
+					track.metadata.canonicalArtistNameMatches(artist.Name(), artist.equivalence) {
 					recordedArtistNames[track.metadata.canonicalArtistName()]++
 				}
 			}
@@ -532,91 +626,109 @@ func logAmbiguousValue(o output.Bus, m map[string]any) {
 func processAlbumMetadata(o output.Bus, artists []*Artist) {
 	for _, ar := range artists {
 		for _, al := range ar.Albums() {
-			recordedMCDIs := make(map[string]int)
-			recordedMCDIFrames := make(map[string]id3v2.UnknownFrame)
-			recordedGenres := make(map[string]int)
-			recordedYears := make(map[string]int)
-			recordedAlbumTitles := make(map[string]int)
-			for _, t := range al.tracks {
-				if t.metadata == nil || !t.metadata.IsValid() {
-					continue
-				}
-				genre := strings.ToLower(t.metadata.canonicalAlbumGenre())
-				if genre != "" && !strings.HasPrefix(genre, "unknown") {
-					recordedGenres[t.metadata.canonicalAlbumGenre()]++
-				}
-				if t.metadata.canonicalAlbumYear() != "" {
-					recordedYears[t.metadata.canonicalAlbumYear()]++
-				}
-				if t.metadata.canonicalAlbumNameMatches(al.title) {
-					recordedAlbumTitles[t.metadata.canonicalAlbumName()]++
-				}
-				mcdiKey := string(t.metadata.canonicalCDIdentifier().Body)
-				recordedMCDIs[mcdiKey]++
-				recordedMCDIFrames[mcdiKey] = t.metadata.canonicalCDIdentifier()
-			}
-			canonicalGenre, genreSelected := canonicalChoice(recordedGenres)
-			switch {
-			case genreSelected:
-				al.genre = canonicalGenre
-			default:
-				reportAmbiguousChoices(o, "genre",
-					fmt.Sprintf("%s by %s", al.title, ar.Name()), recordedGenres)
-				logAmbiguousValue(o, map[string]any{
-					"field":      "genre",
-					"settings":   recordedGenres,
-					"albumName":  al.title,
-					"artistName": ar.Name(),
-				})
-			}
-			canonicalYear, yearSelected := canonicalChoice(recordedYears)
-			switch {
-			case yearSelected:
-				al.year = canonicalYear
-			default:
-				reportAmbiguousChoices(o, "year",
-					fmt.Sprintf("%s by %s", al.title, ar.Name()), recordedYears)
-				logAmbiguousValue(o, map[string]any{
-					"field":      "year",
-					"settings":   recordedYears,
-					"albumName":  al.title,
-					"artistName": ar.Name(),
-				})
-			}
-			canonicalAlbumTitle, albumTitleSelected := canonicalChoice(recordedAlbumTitles)
-			switch {
-			case albumTitleSelected:
-				if canonicalAlbumTitle != "" {
-					al.canonicalTitle = canonicalAlbumTitle
-				}
-			default:
-				reportAmbiguousChoices(o, "album title",
-					fmt.Sprintf("%s by %s", al.title, ar.Name()), recordedAlbumTitles)
-				logAmbiguousValue(o, map[string]any{
-					"field":      "album title",
-					"settings":   recordedAlbumTitles,
-					"albumName":  al.title,
-					"artistName": ar.Name(),
-				})
-			}
-			canonicalMCDI, MCDISelected := canonicalChoice(recordedMCDIs)
-			switch {
-			case MCDISelected:
-				al.cdIdentifier = recordedMCDIFrames[canonicalMCDI]
-			default:
-				reportAmbiguousChoices(o, "MCDI frame",
-					fmt.Sprintf("%s by %s", al.title, ar.Name()), recordedMCDIs)
-				logAmbiguousValue(o, map[string]any{
-					"field":      "mcdi frame",
-					"settings":   recordedMCDIs,
-					"albumName":  al.title,
-					"artistName": ar.Name(),
-				})
+			al.processMetadata(o, ar)
+		}
+	}
+}
+
+// processFinishedAlbumMetadata processes the metadata of the albums whose
+// tracks were all read before the reading was interrupted
+func processFinishedAlbumMetadata(o output.Bus, artists []*Artist) {
+	for _, ar := range artists {
+		for _, al := range ar.Albums() {
+			if al.MetadataRead() {
+				al.processMetadata(o, ar)
 			}
 		}
 	}
 }
 
+// processMetadata selects the album's genre, year, title, and MCDI frame from
+// the values recorded by its tracks
+func (al *Album) processMetadata(o output.Bus, ar *Artist) {
+	recordedMCDIs := make(map[string]int)
+	recordedMCDIFrames := make(map[string]id3v2.UnknownFrame)
+	recordedGenres := make(map[string]int)
+	recordedYears := make(map[string]int)
+	recordedAlbumTitles := make(map[string]int)
+	for _, t := range al.tracks {
+		if t.metadata == nil || !t.metadata.IsValid() {
+			continue
+		}
+		genre := strings.ToLower(t.metadata.canonicalAlbumGenre())
+		if genre != "" && !strings.HasPrefix(genre, "unknown") {
+			recordedGenres[t.metadata.canonicalAlbumGenre()]++
+		}
+		if t.metadata.canonicalAlbumYear() != "" {
+			recordedYears[t.metadata.canonicalAlbumYear()]++
+		}
+		if t.metadata.canonicalAlbumNameMatches(al.title, ar.equivalence) {
+			recordedAlbumTitles[t.metadata.canonicalAlbumName()]++
+		}
+		mcdiKey := string(t.metadata.canonicalCDIdentifier().Body)
+		recordedMCDIs[mcdiKey]++
+		recordedMCDIFrames[mcdiKey] = t.metadata.canonicalCDIdentifier()
+	}
+	canonicalGenre, genreSelected := canonicalChoice(recordedGenres)
+	switch {
+	case genreSelected:
+		al.genre = canonicalGenre
+	default:
+		reportAmbiguousChoices(o, "genre",
+			fmt.Sprintf("%s by %s", al.title, ar.Name()), recordedGenres)
+		logAmbiguousValue(o, map[string]any{
+			"field":      "genre",
+			"settings":   recordedGenres,
+			"albumName":  al.title,
+			"artistName": ar.Name(),
+		})
+	}
+	canonicalYear, yearSelected := canonicalChoice(recordedYears)
+	switch {
+	case yearSelected:
+		al.year = canonicalYear
+	default:
+		reportAmbiguousChoices(o, "year",
+			fmt.Sprintf("%s by %s", al.title, ar.Name()), recordedYears)
+		logAmbiguousValue(o, map[string]any{
+			"field":      "year",
+			"settings":   recordedYears,
+			"albumName":  al.title,
+			"artistName": ar.Name(),
+		})
+	}
+	canonicalAlbumTitle, albumTitleSelected := canonicalChoice(recordedAlbumTitles)
+	switch {
+	case albumTitleSelected:
+		if canonicalAlbumTitle != "" {
+			al.canonicalTitle = canonicalAlbumTitle
+		}
+	default:
+		reportAmbiguousChoices(o, "album title",
+			fmt.Sprintf("%s by %s", al.title, ar.Name()), recordedAlbumTitles)
+		logAmbiguousValue(o, map[string]any{
+			"field":      "album title",
+			"settings":   recordedAlbumTitles,
+			"albumName":  al.title,
+			"artistName": ar.Name(),
+		})
+	}
+	canonicalMCDI, MCDISelected := canonicalChoice(recordedMCDIs)
+	switch {
+	case MCDISelected:
+		al.cdIdentifier = recordedMCDIFrames[canonicalMCDI]
+	default:
+		reportAmbiguousChoices(o, "MCDI frame",
+			fmt.Sprintf("%s by %s", al.title, ar.Name()), recordedMCDIs)
+		logAmbiguousValue(o, map[string]any{
+			"field":      "mcdi frame",
+			"settings":   recordedMCDIs,
+			"albumName":  al.title,
+			"artistName": ar.Name(),
+		})
+	}
+}
+
 func encodeChoices(m map[string]int) string {
 	values := make([]string, 0, len(m))
 	for k, count := range m {
@@ -686,12 +798,6 @@ func (t *Track) reportMetadataErrors(o output.Bus) {
 	}
 }
 
-func waitForFilesClosed(openFiles chan empty) {
-	for len(openFiles) != 0 {
-		time.Sleep(1 * time.Microsecond)
-	}
-}
-
 type TrackNameParser struct {
 	FileName  string
 	Album     *Album
@@ -754,6 +860,69 @@ func (t *Track) RecordingArtist() string {
 	return t.album.RecordingArtistName()
 }
 
+// ArtistName returns the name of the track's artist, as recorded in its
+// metadata; if the metadata has not been read, or records no artist, the name
+// of the artist on whose album this track appears is returned. The names
+// differ for tracks on compilations.
+func (t *Track) ArtistName() string {
+	if t.metadata != nil && t.metadata.IsValid() {
+		if name := t.metadata.canonicalArtistName(); name != "" {
+			return name
+		}
+	}
+	return t.RecordingArtist()
+}
+
+// Genre returns the track's genre, as recorded in its metadata; if the
+// metadata has not been read, or records no genre, the album's genre is
+// returned.
+func (t *Track) Genre() string {
+	if t.metadata != nil && t.metadata.IsValid() {
+		if genre := t.metadata.canonicalAlbumGenre(); genre != "" {
+			return genre
+		}
+	}
+	if t.album == nil {
+		return ""
+	}
+	return t.album.genre
+}
+
+// HasMetadata determines whether the track's metadata was successfully read
+// from the specified source (ID3V1 or ID3V2)
+func (t *Track) HasMetadata(src sourceType) bool {
+	return t.metadata != nil && t.metadata.IsValid() && t.metadata.errorCause(src) == ""
+}
+
+// HasCDIdentifier determines whether the track's ID3V2 metadata includes a
+// music CD identifier (MCDI) frame
+func (t *Track) HasCDIdentifier() bool {
+	return t.HasMetadata(ID3V2) && len(t.metadata.canonicalCDIdentifier().Body) != 0
+}
+
+// CDIdentifier returns the body of the track's music CD identifier (MCDI)
+// frame, or nil if its ID3V2 metadata has not been read or has none
+func (t *Track) CDIdentifier() []byte {
+	if !t.HasCDIdentifier() {
+		return nil
+	}
+	return t.metadata.canonicalCDIdentifier().Body
+}
+
+// Year returns the track's year, as recorded in its metadata; if the metadata
+// has not been read, or records no year, the album's year is returned.
+func (t *Track) Year() string {
+	if t.metadata != nil && t.metadata.IsValid() {
+		if year := t.metadata.canonicalAlbumYear(); year != "" {
+			return year
+		}
+	}
+	if t.album == nil {
+		return ""
+	}
+	return t.album.year
+}
+
 // ID3V1Diagnostics returns the ID3V1 tag contents, if any; a missing ID3V1 tag
 // (e.g., the input file is too short to have an ID3V1 tag), or an invalid ID3V1
 // tag (IsValid() is false), returns a non-nil error
@@ -4,6 +4,7 @@ Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
 package files
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/bogem/id3v2/v2"
@@ -194,6 +196,101 @@ func TestTrack_RecordingArtist(t *testing.T) {
 	}
 }
 
+func TestTrack_Genre(t *testing.T) {
+	tests := map[string]struct {
+		t    *Track
+		want string
+	}{
+		"orphan track": {t: &Track{}, want: ""},
+		"no metadata": {
+			t:    &Track{album: &Album{genre: "rock"}},
+			want: "rock",
+		},
+		"metadata": {
+			t: &Track{
+				album:    &Album{genre: "rock"},
+				metadata: (&TrackMetadataMaker{Genre: "pop", Source: ID3V2}).MakeMetadata(),
+			},
+			want: "pop",
+		},
+		"metadata without genre": {
+			t: &Track{
+				album:    &Album{genre: "rock"},
+				metadata: (&TrackMetadataMaker{Source: ID3V2}).MakeMetadata(),
+			},
+			want: "rock",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.t.Genre(); got != tt.want {
+				t.Errorf("Track.Genre() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrack_HasMetadata(t *testing.T) {
+	id3v1Only := newTrackMetadata()
+	id3v1Only.setErrorCause(ID3V2, "no ID3V2 metadata found")
+	id3v1Only.setCanonicalSource(ID3V1)
+	unreadable := newTrackMetadata()
+	unreadable.setErrorCause(ID3V1, "no ID3V1 metadata found")
+	unreadable.setErrorCause(ID3V2, "no ID3V2 metadata found")
+	both := (&TrackMetadataMaker{CDIdentifier: []byte("mcdi"), Source: ID3V2}).MakeMetadata()
+	tests := map[string]struct {
+		t         *Track
+		wantID3V1 bool
+		wantID3V2 bool
+		wantMCDI  bool
+	}{
+		"metadata not read": {t: &Track{}},
+		"unreadable":        {t: &Track{metadata: unreadable}},
+		"ID3V1 only":        {t: &Track{metadata: id3v1Only}, wantID3V1: true},
+		"both":              {t: &Track{metadata: both}, wantID3V1: true, wantID3V2: true, wantMCDI: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.t.HasMetadata(ID3V1); got != tt.wantID3V1 {
+				t.Errorf("Track.HasMetadata(ID3V1) = %v, want %v", got, tt.wantID3V1)
+			}
+			if got := tt.t.HasMetadata(ID3V2); got != tt.wantID3V2 {
+				t.Errorf("Track.HasMetadata(ID3V2) = %v, want %v", got, tt.wantID3V2)
+			}
+			if got := tt.t.HasCDIdentifier(); got != tt.wantMCDI {
+				t.Errorf("Track.HasCDIdentifier() = %v, want %v", got, tt.wantMCDI)
+			}
+		})
+	}
+}
+
+func TestTrack_Year(t *testing.T) {
+	tests := map[string]struct {
+		t    *Track
+		want string
+	}{
+		"orphan track": {t: &Track{}, want: ""},
+		"no metadata": {
+			t:    &Track{album: &Album{year: "1969"}},
+			want: "1969",
+		},
+		"metadata": {
+			t: &Track{
+				album:    &Album{year: "1969"},
+				metadata: (&TrackMetadataMaker{Year: "1970", Source: ID3V1}).MakeMetadata(),
+			},
+			want: "1970",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.t.Year(); got != tt.want {
+				t.Errorf("Track.Year() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestTrack_Directory(t *testing.T) {
 	tests := map[string]struct {
 		t    *Track
@@ -527,6 +624,14 @@ func TestTrackLoadMetadata(t *testing.T) {
 	}
 	postReadTm.setCDIdentifier([]byte{0})
 	postReadTm.setCanonicalSource(ID3V2)
+	postReadTm.setID3v2Format(3, isoText(map[string]string{
+		"TALB": albumName,
+		"TCON": genre,
+		"TIT2": trackName,
+		"TPE1": artistName,
+		"TRCK": "5",
+		"TYER": year,
+	}), []string{"TALB", "TCON", "TIT2", "TPE1", "TRCK", "TYER"})
 	tests := map[string]struct {
 		t    *Track
 		want *TrackMetadata
@@ -545,8 +650,9 @@ func TestTrackLoadMetadata(t *testing.T) {
 			bar.SetWriter(output.NewNilBus().ErrorWriter())
 			bar.Start()
 			openFiles := make(chan empty, 20)
-			tt.t.loadMetadata(openFiles, bar)
-			waitForFilesClosed(openFiles)
+			var wg sync.WaitGroup
+			tt.t.loadMetadata(&wg, openFiles, bar)
+			wg.Wait()
 			bar.Finish()
 			if !reflect.DeepEqual(tt.t.metadata, tt.want) {
 				t.Errorf("Track.loadMetadata() got %#v want %#v", tt.t.metadata, tt.want)
@@ -618,7 +724,7 @@ func TestReadMetadata(t *testing.T) {
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			o := output.NewRecorder()
-			ReadMetadata(o, tt.artists, 20)
+			ReadMetadata(context.Background(), o, tt.artists, 20)
 			o.Report(t, "ReadMetadata()", tt.WantedRecording)
 			for _, artist := range tt.artists {
 				for _, album := range artist.Albums() {
@@ -637,6 +743,40 @@ func TestReadMetadata(t *testing.T) {
 	}
 }
 
+func TestReadMetadata_interrupted(t *testing.T) {
+	originalFileSystem := cmdtoolkit.AssignFileSystem(afero.NewMemMapFs())
+	defer func() {
+		cmdtoolkit.AssignFileSystem(originalFileSystem)
+	}()
+	testDir := "ReadMetadataInterrupted"
+	_ = cmdtoolkit.Mkdir(testDir)
+	artist := NewArtist("artist", testDir)
+	album := AlbumMaker{Title: "album", Artist: artist, Directory: "album"}.NewAlbum(true)
+	for n := range 3 {
+		trackFileName := fmt.Sprintf("%02d track.mp3", n+1)
+		_ = createFileWithContent(testDir, trackFileName, createConsistentlyTaggedData([]byte{byte(n)},
+			map[string]any{"artist": "artist", "album": "album", "title": "track", "track": n + 1}))
+		album.addTrack(&Track{
+			filePath:   filepath.Join(testDir, trackFileName),
+			simpleName: "track",
+			album:      album,
+			number:     n + 1,
+		})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	o := output.NewRecorder()
+	ReadMetadata(ctx, o, []*Artist{artist}, 1)
+	o.Report(t, "ReadMetadata()", output.WantedRecording{
+		Error: "Reading track metadata.\nReading track metadata was interrupted.\n",
+	})
+	for _, track := range album.tracks {
+		if !track.needsMetadata() {
+			t.Errorf("ReadMetadata() read track %q after being interrupted", track.filePath)
+		}
+	}
+}
+
 func TestTrack_ReportMetadataProblems(t *testing.T) {
 	problematicArtist := NewArtist("problematic:artist", "")
 	problematicAlbum := &Album{
@@ -813,6 +953,14 @@ func TestTrack_UpdateMetadata(t *testing.T) {
 	}
 	editedTm.setCDIdentifier([]byte("fine album"))
 	editedTm.setCanonicalSource(ID3V2)
+	editedTm.setID3v2Format(3, isoText(map[string]string{
+		"TALB": "fine album",
+		"TCON": "classic rock",
+		"TIT2": "edit this track",
+		"TPE1": "fine artist",
+		"TRCK": "2",
+		"TYER": "2022",
+	}), []string{"MCDI", "TALB", "TCON", "TIT2", "TPE1", "TRCK", "TYER"})
 	tests := map[string]struct {
 		t      *Track
 		wantE  []string
@@ -1655,6 +1803,37 @@ func TestTrack_Copy(t1 *testing.T) {
 	}
 }
 
+func TestTrack_StagingCopy(t *testing.T) {
+	album := AlbumMaker{Title: "my album", Directory: filepath.Join("my artist", "my album")}.NewAlbum(false)
+	metadata := newTrackMetadata()
+	track := &Track{
+		album:            album,
+		filePath:         filepath.Join("my artist", "my album", "01 my track.mp3"),
+		metadata:         metadata,
+		simpleName:       "my track",
+		number:           1,
+		suppressedFields: []MetadataField{GenreField},
+	}
+	want := &Track{
+		album:            album,
+		filePath:         filepath.Join("my artist", "my album", "01 my track.mp3-staged"),
+		metadata:         metadata,
+		simpleName:       "my track",
+		number:           1,
+		suppressedFields: []MetadataField{GenreField},
+	}
+	got := track.StagingCopy("01 my track.mp3-staged")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Track.StagingCopy() = %v, want %v", got, want)
+	}
+	if got.metadata != track.metadata {
+		t.Errorf("Track.StagingCopy() does not share the track's metadata")
+	}
+	if len(album.Tracks()) != 0 {
+		t.Errorf("Track.StagingCopy() added the copy to the album")
+	}
+}
+
 func TestFrameDescription(t *testing.T) {
 	tests := map[string]struct {
 		name string
@@ -1677,3 +1856,95 @@ func TestFrameDescription(t *testing.T) {
 		})
 	}
 }
+
+func TestTrack_SuppressFields(t *testing.T) {
+	artist := NewArtist("artist", "")
+	album := &Album{
+		title:           "album",
+		recordingArtist: artist,
+		genre:           "Rock",
+		year:            "1999",
+		canonicalTitle:  "album",
+	}
+	src := ID3V2
+	metadata := newTrackMetadata()
+	metadata.setCanonicalSource(src)
+	metadata.setErrorCause(ID3V1, errNoID3V1MetadataFound.Error())
+	metadata.setArtistName(src, "artist")
+	metadata.setAlbumName(src, "transliterated album")
+	metadata.setAlbumGenre(src, "Rock")
+	metadata.setAlbumYear(src, "2001")
+	metadata.setTrackName(src, "track")
+	metadata.setTrackNumber(src, 1)
+	track := TrackMaker{Album: album, FileName: "01 track.mp3", SimpleName: "track", Number: 1}.NewTrack(false)
+	track.metadata = metadata
+	album.addTrack(track)
+	track.SuppressFields(AlbumNameField, AlbumNameField)
+	if got := track.Copy(album, false).suppressedFields; !reflect.DeepEqual(got, []MetadataField{AlbumNameField}) {
+		t.Errorf("Track.Copy() suppressed fields = %v", got)
+	}
+	state := track.ReconcileMetadata()
+	if state.HasAlbumNameConflict() || !state.HasYearConflict() {
+		t.Errorf("Track.ReconcileMetadata() = %v, want only a year conflict", state)
+	}
+	want := []string{"ID3V2 metadata [2001] does not agree with album year \"1999\""}
+	if got := track.ReportMetadataProblems(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Track.ReportMetadataProblems() = %v, want %v", got, want)
+	}
+	if got := metadata.albumName(src).correctedValue(); got != "" {
+		t.Errorf("Track.ReconcileMetadata() album name correction = %q, want none", got)
+	}
+	if !metadata.editRequired(src) {
+		t.Errorf("Track.ReconcileMetadata() dropped the edit needed for the year")
+	}
+	track.SuppressFields(YearField)
+	if state = track.ReconcileMetadata(); state.HasConflicts() {
+		t.Errorf("Track.ReconcileMetadata() = %v, want no conflicts", state)
+	}
+	if metadata.editRequired(src) {
+		t.Errorf("Track.ReconcileMetadata() requires an edit, but all conflicts are suppressed")
+	}
+	if got := track.UpdateMetadata(); !reflect.DeepEqual(got, []error{errNoEditNeeded}) {
+		t.Errorf("Track.UpdateMetadata() = %v, want no edit needed", got)
+	}
+}
+
+func TestTrack_MetadataChanges(t *testing.T) {
+	artist := NewArtist("artist", "")
+	album := &Album{
+		title:           "album",
+		recordingArtist: artist,
+		genre:           "Rock",
+		year:            "1999",
+		canonicalTitle:  "album",
+		cdIdentifier:    id3v2.UnknownFrame{Body: []byte{1, 2}},
+	}
+	metadata := newTrackMetadata()
+	metadata.setCanonicalSource(ID3V2)
+	for _, src := range sourceTypes {
+		metadata.setArtistName(src, "artist")
+		metadata.setAlbumName(src, "album")
+		metadata.setAlbumGenre(src, "Rock")
+		metadata.setAlbumYear(src, "1999")
+		metadata.setTrackName(src, "track")
+		metadata.setTrackNumber(src, 1)
+	}
+	metadata.setAlbumYear(ID3V1, "2001")
+	metadata.setTrackNumber(ID3V2, 2)
+	metadata.setCDIdentifier([]byte{1})
+	track := TrackMaker{Album: album, FileName: "01 track.mp3", SimpleName: "track", Number: 1}.NewTrack(false)
+	if got := track.MetadataChanges(); got != nil {
+		t.Errorf("Track.MetadataChanges() without metadata = %v, want nil", got)
+	}
+	track.metadata = metadata
+	album.addTrack(track)
+	track.ReconcileMetadata()
+	want := []MetadataChange{
+		{Source: "ID3V1", Field: YearField, OldValue: "2001", NewValue: "1999"},
+		{Source: "ID3V2", Field: TrackNumberField, OldValue: "2", NewValue: "1"},
+		{Source: "ID3V2", Field: CDIdentifierField, OldValue: "01", NewValue: "0102"},
+	}
+	if got := track.MetadataChanges(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Track.MetadataChanges() = %v, want %v", got, want)
+	}
+}
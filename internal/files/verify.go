@@ -0,0 +1,44 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	errAudioChanged       = errors.New("the audio has changed")
+	errMetadataUnreadable = errors.New("the metadata can no longer be read")
+)
+
+// ReloadMetadata reads the track's metadata again
+func (t *Track) ReloadMetadata() {
+	t.metadata = initializeMetadata(t.filePath)
+}
+
+// VerifyRewrite reads the track's metadata again, after the track file has
+// been rewritten, and verifies that the metadata is still readable and no
+// longer conflicts with the track's file structure, and that the audio payload
+// still has the specified checksum, which was computed before the rewrite
+func (t *Track) VerifyRewrite(audioChecksum string) error {
+	wasReadable := t.metadata != nil && t.metadata.IsValid()
+	t.ReloadMetadata()
+	if wasReadable && !t.metadata.IsValid() {
+		return errMetadataUnreadable
+	}
+	if t.ReconcileMetadata().HasConflicts() {
+		return fmt.Errorf("the metadata still has problems: %s", strings.Join(t.ReportMetadataProblems(), "; "))
+	}
+	checksum, checksumErr := AudioChecksum(t.filePath)
+	if checksumErr != nil {
+		return checksumErr
+	}
+	if checksum != audioChecksum {
+		return errAudioChanged
+	}
+	return nil
+}
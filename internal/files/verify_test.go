@@ -0,0 +1,80 @@
+/*
+Copyright © 2026 Marc Johnson (marc.johnson27591@gmail.com)
+*/
+
+package files
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bogem/id3v2/v2"
+	cmdtoolkit "github.com/majohn-r/cmd-toolkit"
+)
+
+func TestTrack_VerifyRewrite(t *testing.T) {
+	// as with TestTrack_UpdateMetadata, the ID3V2 library requires the os file
+	// system
+	testDir := "verifyRewrite"
+	_ = cmdtoolkit.Mkdir(testDir)
+	defer func() {
+		_ = os.RemoveAll(testDir)
+	}()
+	artist := NewArtist("my artist", testDir)
+	album := AlbumMaker{Title: "my album", Artist: artist, Directory: testDir}.NewAlbum(true)
+	// as reading the album's metadata would set it for tracks without an MCDI
+	// frame
+	album.cdIdentifier = id3v2.UnknownFrame{Body: []byte{0}}
+	audio := bytes.Repeat([]byte{0xFF, 0xFB, 0x90, 0x64}, 64)
+	taggedContent := func(title string) []byte {
+		return append(makeID3V2Tag(3, false, 0,
+			makeSizedTextFrame("TALB", "my album", false),
+			makeSizedTextFrame("TIT2", title, false),
+			makeSizedTextFrame("TPE1", "my artist", false),
+			makeSizedTextFrame("TRCK", "1", false)), audio...)
+	}
+	tests := map[string]struct {
+		before  []byte
+		after   []byte
+		wantErr error
+	}{
+		"verified": {
+			before: taggedContent("old track"),
+			after:  taggedContent("my track"),
+		},
+		"conflicting metadata": {
+			before: taggedContent("old track"),
+			after:  taggedContent("old track"),
+			wantErr: errors.New("the metadata still has problems:" +
+				" ID3V2 metadata [old track] does not agree with track name \"my track\""),
+		},
+		"unreadable metadata": {
+			before:  taggedContent("old track"),
+			after:   audio,
+			wantErr: errMetadataUnreadable,
+		},
+		"changed audio": {
+			before:  taggedContent("old track"),
+			after:   append(taggedContent("my track"), 0),
+			wantErr: errAudioChanged,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			fileName := "1 my track " + name + ".mp3"
+			path := filepath.Join(testDir, fileName)
+			_ = createNamedFile(path, tt.before)
+			track := TrackMaker{Album: album, FileName: fileName, SimpleName: "my track", Number: 1}.NewTrack(false)
+			track.ReloadMetadata()
+			checksum, _ := AudioChecksum(path)
+			_ = os.WriteFile(path, tt.after, cmdtoolkit.StdFilePermissions)
+			if err := track.VerifyRewrite(checksum); !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Track.VerifyRewrite() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}